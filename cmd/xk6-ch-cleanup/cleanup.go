@@ -0,0 +1,72 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// selectRuns returns the runs to delete: those whose last sample is older
+// than olderThan days before now, and those beyond the keepLatest most
+// recent (by first sample) of their branch. A zero limit disables it. The
+// result is ordered from the oldest run.
+func selectRuns(runs []testRun, now time.Time, olderThan, keepLatest int) []testRun {
+	sorted := slices.Clone(runs)
+	slices.SortStableFunc(sorted, func(a, b testRun) int {
+		return cmp.Or(b.start.Compare(a.start), cmp.Compare(a.testID, b.testID))
+	})
+
+	cutoff := now.AddDate(0, 0, -olderThan)
+	kept := make(map[string]int) // runs kept so far, by branch
+	var selected []testRun
+	for _, r := range sorted {
+		expired := olderThan > 0 && r.end.Before(cutoff)
+		surplus := keepLatest > 0 && kept[r.branch] >= keepLatest
+		if expired || surplus {
+			selected = append(selected, r)
+			continue
+		}
+		kept[r.branch]++
+	}
+
+	slices.Reverse(selected)
+	return selected
+}
+
+// cleanup deletes the runs selected by opts, printing one line per run to
+// stdout. With opts.dryRun it only prints them.
+func cleanup(ctx context.Context, st *store, opts options, now time.Time, stdout io.Writer) error {
+	runs, err := st.listRuns(ctx)
+	if err != nil {
+		return err
+	}
+	selected := selectRuns(runs, now, opts.olderThan, opts.keepLatest)
+
+	byPartition, err := st.partitionedByRun(ctx)
+	if err != nil {
+		return err
+	}
+	action, remove := "delete", st.deleteRun
+	if byPartition {
+		action, remove = "drop partitions of", st.dropRun
+	}
+	if opts.dryRun {
+		action = "would " + action
+	}
+
+	for _, r := range selected {
+		_, _ = fmt.Fprintf(stdout, "%s run %s (branch %q, %s to %s, %d rows)\n",
+			action, r.testID, r.branch, r.start.UTC().Format(time.RFC3339), r.end.UTC().Format(time.RFC3339), r.rows)
+		if opts.dryRun {
+			continue
+		}
+		if err := remove(ctx, r.testID); err != nil {
+			return err
+		}
+	}
+	_, _ = fmt.Fprintf(stdout, "%d of %d runs selected\n", len(selected), len(runs))
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectRuns(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return now.AddDate(0, 0, -d) }
+	runs := []testRun{
+		{testID: "main-1", branch: "main", start: day(40), end: day(40)},
+		{testID: "main-2", branch: "main", start: day(20), end: day(20)},
+		{testID: "main-3", branch: "main", start: day(10), end: day(10)},
+		{testID: "main-4", branch: "main", start: day(1), end: day(1)},
+		{testID: "feat-1", branch: "feat", start: day(35), end: day(29)},
+		{testID: "untagged", start: day(50), end: day(50)},
+	}
+	ids := func(runs []testRun) []string {
+		var out []string
+		for _, r := range runs {
+			out = append(out, r.testID)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"untagged", "main-1"}, ids(selectRuns(runs, now, 30, 0)),
+		"runs are aged by their last sample")
+	assert.Equal(t, []string{"main-1", "main-2"}, ids(selectRuns(runs, now, 0, 2)),
+		"each branch keeps its own latest runs")
+	assert.Equal(t, []string{"untagged", "main-1", "feat-1", "main-2"}, ids(selectRuns(runs, now, 25, 2)),
+		"both limits apply")
+	assert.Empty(t, selectRuns(runs, now, 0, 0))
+}
+
+func TestHasRunPrefix(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, hasRunPrefix("testid", "testid"))
+	assert.True(t, hasRunPrefix("testid, toYYYYMM(timestamp)", "testid"))
+	assert.True(t, hasRunPrefix("(testid, toYYYYMM(timestamp))", "testid"))
+	assert.True(t, hasRunPrefix("tags['testid']", "tags['testid']"))
+	assert.False(t, hasRunPrefix("toYYYYMM(timestamp)", "testid"))
+	assert.False(t, hasRunPrefix("testid_day", "testid"))
+	assert.False(t, hasRunPrefix("", "testid"))
+}
+
+func TestParseFlags(t *testing.T) {
+	t.Parallel()
+
+	opts, err := parseFlags([]string{"-schema", "compatible", "-older-than", "30", "-keep-latest", "5", "-dry-run"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, schemaCompatible, opts.schema)
+	assert.Equal(t, 30, opts.olderThan)
+	assert.Equal(t, 5, opts.keepLatest)
+	assert.True(t, opts.dryRun)
+
+	_, err = parseFlags(nil, io.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nothing to do")
+
+	_, err = parseFlags([]string{"-older-than", "-1"}, io.Discard)
+	require.Error(t, err)
+
+	_, err = parseFlags([]string{"-keep-latest", "1", "extra"}, io.Discard)
+	require.Error(t, err)
+
+	assert.Equal(t, exitError, run([]string{"-database", "bad-name", "-older-than", "1"}, io.Discard, io.Discard))
+}
@@ -0,0 +1,116 @@
+// Command xk6-ch-cleanup removes old k6 test runs stored by
+// xk6-output-clickhouse. It deletes the runs whose last sample is older than
+// -older-than days, and the runs beyond the -keep-latest most recent of each
+// branch:
+//
+//	xk6-ch-cleanup -addr clickhouse:9000 -older-than 30 -keep-latest 20
+//
+// Runs are identified by their testid tag (k6 run --tag testid=<id>). When the
+// table is partitioned by testid (partitionBy=testid or testid_time), a run's
+// partitions are dropped; otherwise its rows are removed with a lightweight
+// DELETE. -dry-run prints the plan without changing anything.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mkutlak/xk6-output-clickhouse/internal/cmdutil"
+)
+
+// Exit statuses.
+const (
+	exitOK    = 0
+	exitError = 1
+)
+
+// options holds the command-line flags.
+type options struct {
+	addr       string
+	user       string
+	password   string
+	database   string
+	table      string
+	schema     string
+	olderThan  int
+	keepLatest int
+	dryRun     bool
+	timeout    time.Duration
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run parses args, removes the selected runs, and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	opts, err := parseFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "xk6-ch-cleanup:", err)
+		return exitError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	st, err := openStore(opts)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "xk6-ch-cleanup:", err)
+		return exitError
+	}
+	defer func() { _ = st.close() }()
+
+	if err := cleanup(ctx, st, opts, time.Now(), stdout); err != nil {
+		_, _ = fmt.Fprintln(stderr, "xk6-ch-cleanup:", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// parseFlags parses args into options. Connection flags default to the
+// K6_CLICKHOUSE_* variables the output itself reads.
+func parseFlags(args []string, stderr io.Writer) (opts options, err error) {
+	fs := flag.NewFlagSet("xk6-ch-cleanup", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "Usage: xk6-ch-cleanup [flags]")
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&opts.addr, "addr", cmdutil.EnvOr("K6_CLICKHOUSE_ADDR", "localhost:9000"), "ClickHouse native address (env K6_CLICKHOUSE_ADDR)")
+	fs.StringVar(&opts.user, "user", cmdutil.EnvOr("K6_CLICKHOUSE_USER", "default"), "ClickHouse user (env K6_CLICKHOUSE_USER)")
+	fs.StringVar(&opts.password, "password", os.Getenv("K6_CLICKHOUSE_PASSWORD"), "ClickHouse password (env K6_CLICKHOUSE_PASSWORD)")
+	fs.StringVar(&opts.database, "database", cmdutil.EnvOr("K6_CLICKHOUSE_DB", "k6"), "database holding the samples (env K6_CLICKHOUSE_DB)")
+	fs.StringVar(&opts.table, "table", cmdutil.EnvOr("K6_CLICKHOUSE_TABLE", "samples"), "table holding the samples (env K6_CLICKHOUSE_TABLE)")
+	fs.StringVar(&opts.schema, "schema", cmdutil.EnvOr("K6_CLICKHOUSE_SCHEMA_MODE", schemaSimple), "schema the table uses: simple or compatible (env K6_CLICKHOUSE_SCHEMA_MODE)")
+	fs.IntVar(&opts.olderThan, "older-than", 0, "delete runs whose last sample is older than this many days (0: no age limit)")
+	fs.IntVar(&opts.keepLatest, "keep-latest", 0, "keep only this many most recent runs per branch (0: no limit)")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "print the runs that would be deleted without deleting them")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Minute, "timeout for the whole cleanup")
+
+	if err = fs.Parse(args); err != nil {
+		return options{}, err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return options{}, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if opts.schema != schemaCompatible && opts.schema != schemaSimple {
+		return options{}, fmt.Errorf("invalid -schema %q (must be %s or %s)", opts.schema, schemaSimple, schemaCompatible)
+	}
+	if opts.olderThan < 0 || opts.keepLatest < 0 {
+		return options{}, errors.New("-older-than and -keep-latest must not be negative")
+	}
+	if opts.olderThan == 0 && opts.keepLatest == 0 {
+		return options{}, errors.New("nothing to do: set -older-than, -keep-latest, or both")
+	}
+	return opts, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/mkutlak/xk6-output-clickhouse/pkg/chquery"
+)
+
+// Schemas whose tables the command can clean; they match the output's
+// schemaMode names.
+const (
+	schemaSimple     = string(chquery.SchemaSimple)
+	schemaCompatible = string(chquery.SchemaCompatible)
+)
+
+// testRun describes one test run stored in the table.
+type testRun struct {
+	testID string
+	branch string
+	start  time.Time // first sample
+	end    time.Time // last sample
+	rows   uint64
+}
+
+// store reads and deletes runs of a samples table.
+type store struct {
+	db       *sql.DB
+	database string
+	table    string // unescaped, for system.tables
+	escaped  string // escaped database.table
+	testID   string // expression yielding a sample's testid
+	branch   string // expression yielding a sample's branch
+}
+
+// openStore connects to the ClickHouse server named by opts.
+func openStore(opts options) (*store, error) {
+	if err := chquery.ValidateIdentifier("database", opts.database); err != nil {
+		return nil, err
+	}
+	if err := chquery.ValidateIdentifier("table", opts.table); err != nil {
+		return nil, err
+	}
+	testID, err := chquery.TestIDColumn(chquery.Schema(opts.schema))
+	if err != nil {
+		return nil, err
+	}
+
+	db := clickhouse.OpenDB(&clickhouse.Options{
+		Addr: []string{opts.addr},
+		Auth: clickhouse.Auth{
+			Database: opts.database,
+			Username: opts.user,
+			Password: opts.password,
+		},
+	})
+
+	st := &store{
+		db:       db,
+		database: opts.database,
+		table:    opts.table,
+		escaped:  fmt.Sprintf("`%s`.`%s`", opts.database, opts.table),
+		testID:   testID,
+		branch:   "tags['branch']",
+	}
+	if opts.schema == schemaCompatible {
+		st.branch = "branch"
+	}
+	return st, nil
+}
+
+// close releases the connection pool.
+func (s *store) close() error {
+	return s.db.Close()
+}
+
+// listRuns returns the runs stored in the table. Samples without a testid
+// tag belong to no run and are never deleted.
+func (s *store) listRuns(ctx context.Context) ([]testRun, error) {
+	//nolint:gosec // G201: the table name is validated with chquery.ValidateIdentifier and escaped with backticks
+	query := fmt.Sprintf(
+		"SELECT %s AS run, any(%s), min(timestamp), max(timestamp), count() "+
+			"FROM %s WHERE run != '' GROUP BY run", s.testID, s.branch, s.escaped)
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var runs []testRun
+	for rows.Next() {
+		var r testRun
+		if err := rows.Scan(&r.testID, &r.branch, &r.start, &r.end, &r.rows); err != nil {
+			return nil, fmt.Errorf("failed to read runs: %w", err)
+		}
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read runs: %w", err)
+	}
+	return runs, nil
+}
+
+// partitionedByRun reports whether the table's partition key starts with
+// the testid, so that no partition holds rows of two runs.
+func (s *store) partitionedByRun(ctx context.Context) (bool, error) {
+	var key string
+	if err := s.db.QueryRowContext(ctx,
+		"SELECT partition_key FROM system.tables WHERE database = ? AND name = ?",
+		s.database, s.table).Scan(&key); err != nil {
+		return false, fmt.Errorf("failed to read the partition key of %s: %w", s.escaped, err)
+	}
+	return hasRunPrefix(key, s.testID), nil
+}
+
+// hasRunPrefix reports whether partition key key starts with the testID
+// expression, alone or as the first element of a tuple.
+func hasRunPrefix(key, testID string) bool {
+	key = strings.TrimPrefix(strings.TrimSpace(key), "(")
+	rest, ok := strings.CutPrefix(key, testID)
+	if !ok {
+		return false
+	}
+	rest = strings.TrimSpace(rest)
+	return rest == "" || rest == ")" || strings.HasPrefix(rest, ",")
+}
+
+// dropRun drops every partition holding rows of the run tagged testID. It
+// must only be used on tables partitioned by run (see partitionedByRun).
+func (s *store) dropRun(ctx context.Context, testID string) error {
+	//nolint:gosec // G201: the table name is validated with chquery.ValidateIdentifier and escaped with backticks
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT DISTINCT _partition_id FROM %s WHERE %s = ?", s.escaped, s.testID), testID)
+	if err != nil {
+		return fmt.Errorf("failed to find the partitions of run %q: %w", testID, err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to read the partitions of run %q: %w", testID, err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to read the partitions of run %q: %w", testID, err)
+	}
+
+	for _, id := range ids {
+		//nolint:gosec // G201: the table name is validated with chquery.ValidateIdentifier and escaped with backticks
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s DROP PARTITION ID ?", s.escaped), id); err != nil {
+			return fmt.Errorf("failed to drop partition %s of run %q: %w", id, testID, err)
+		}
+	}
+	return nil
+}
+
+// deleteRun removes the rows of the run tagged testID with a lightweight
+// DELETE: they disappear from queries at once and from disk with the next
+// merges.
+func (s *store) deleteRun(ctx context.Context, testID string) error {
+	//nolint:gosec // G201: the table name is validated with chquery.ValidateIdentifier and escaped with backticks
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s = ?", s.escaped, s.testID), testID); err != nil {
+		return fmt.Errorf("failed to delete run %q: %w", testID, err)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// thresholds bound the changes tolerated before a metric counts as regressed.
+type thresholds struct {
+	relative float64 // p95 and throughput change, in percent
+	rate     float64 // rate change, in percentage points
+}
+
+// direction tells which way a statistic gets worse.
+type direction int
+
+const (
+	informational direction = iota // gauges: never a regression
+	higherIsWorse                  // latencies, error rates
+	lowerIsWorse                   // throughput, check pass rate
+)
+
+// comparison is one line of the report.
+type comparison struct {
+	metric     string
+	stat       string
+	baseline   float64
+	candidate  float64
+	hasBase    bool
+	hasCand    bool
+	delta      float64 // percent, or percentage points for rates
+	deltaOK    bool    // false when the baseline is zero
+	points     bool    // delta is in percentage points
+	regression bool
+}
+
+// compareRuns compares every metric present in either run, sorted by name.
+func compareRuns(base, cand runStats, th thresholds) []comparison {
+	names := make([]string, 0, len(base.metrics)+len(cand.metrics))
+	for name := range base.metrics {
+		names = append(names, name)
+	}
+	for name := range cand.metrics {
+		if _, ok := base.metrics[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	result := make([]comparison, 0, len(names))
+	for _, name := range names {
+		b, hasBase := base.metrics[name]
+		c, hasCand := cand.metrics[name]
+		kind := b.kind
+		if !hasBase {
+			kind = c.kind
+		}
+
+		cmp := comparison{metric: name, hasBase: hasBase, hasCand: hasCand}
+		var dir direction
+		cmp.stat, dir = statFor(name, kind)
+		cmp.points = kind == "rate"
+		if hasBase {
+			cmp.baseline = statValue(b, base.duration)
+		}
+		if hasCand {
+			cmp.candidate = statValue(c, cand.duration)
+		}
+		if hasBase && hasCand {
+			cmp.delta, cmp.deltaOK = delta(cmp.baseline, cmp.candidate, cmp.points)
+			cmp.regression = regressed(cmp, dir, th)
+		}
+		result = append(result, cmp)
+	}
+	return result
+}
+
+// statFor returns the statistic compared for a metric type and the direction
+// in which it regresses. For the checks rate, a drop is the regression.
+func statFor(metric, kind string) (string, direction) {
+	switch kind {
+	case "counter":
+		return "per sec", lowerIsWorse
+	case "gauge":
+		return "avg", informational
+	case "rate":
+		if metric == "checks" {
+			return "rate %", lowerIsWorse
+		}
+		return "rate %", higherIsWorse
+	default:
+		return "p95", higherIsWorse
+	}
+}
+
+// statValue returns the compared statistic of m over a run lasting duration.
+func statValue(m metricStats, duration time.Duration) float64 {
+	switch m.kind {
+	case "counter":
+		return m.sum / max(duration, time.Second).Seconds()
+	case "gauge":
+		return m.avg
+	case "rate":
+		return m.avg * 100
+	default:
+		return m.p95
+	}
+}
+
+// delta returns the change from base to cand: the difference when points is
+// set, the relative change in percent otherwise. The relative change is
+// undefined for a zero baseline.
+func delta(base, cand float64, points bool) (float64, bool) {
+	if points {
+		return cand - base, true
+	}
+	if base == 0 {
+		return 0, cand == 0
+	}
+	return (cand - base) / math.Abs(base) * 100, true
+}
+
+// regressed reports whether cmp changed for the worse beyond the threshold.
+// Growth from a zero baseline counts as a regression when growth is worse.
+func regressed(cmp comparison, dir direction, th thresholds) bool {
+	limit := th.relative
+	if cmp.points {
+		limit = th.rate
+	}
+
+	switch dir {
+	case higherIsWorse:
+		if !cmp.deltaOK {
+			return cmp.candidate > cmp.baseline
+		}
+		return cmp.delta > limit
+	case lowerIsWorse:
+		return cmp.deltaOK && -cmp.delta > limit
+	default:
+		return false
+	}
+}
+
+// countRegressions returns the number of regressed comparisons.
+func countRegressions(rows []comparison) int {
+	n := 0
+	for _, r := range rows {
+		if r.regression {
+			n++
+		}
+	}
+	return n
+}
+
+// ANSI escape sequences for the regression marker.
+const (
+	ansiRed   = "\x1b[31;1m"
+	ansiReset = "\x1b[0m"
+)
+
+// printReport writes the comparison table and a summary line.
+func printReport(w io.Writer, baseline, candidate string, rows []comparison, color bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "METRIC\tSTAT\tBASELINE\tCANDIDATE\tDELTA\t\n")
+	for _, r := range rows {
+		marker := ""
+		if r.regression {
+			marker = "REGRESSION"
+			if color {
+				marker = ansiRed + marker + ansiReset
+			}
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.metric, r.stat,
+			formatValue(r.baseline, r.hasBase), formatValue(r.candidate, r.hasCand), formatDelta(r), marker)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	n := countRegressions(rows)
+	var err error
+	switch n {
+	case 0:
+		_, err = fmt.Fprintf(w, "\nNo regressions in %s compared to %s.\n", candidate, baseline)
+	case 1:
+		_, err = fmt.Fprintf(w, "\n1 regression in %s compared to %s.\n", candidate, baseline)
+	default:
+		_, err = fmt.Fprintf(w, "\n%d regressions in %s compared to %s.\n", n, candidate, baseline)
+	}
+	return err
+}
+
+// formatValue formats a statistic, or "-" when the run lacks the metric.
+func formatValue(v float64, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// formatDelta formats the change of r.
+func formatDelta(r comparison) string {
+	switch {
+	case !r.hasBase:
+		return "new"
+	case !r.hasCand:
+		return "missing"
+	case !r.deltaOK:
+		return "n/a"
+	case r.points:
+		return fmt.Sprintf("%+.2fpp", r.delta)
+	default:
+		return fmt.Sprintf("%+.1f%%", r.delta)
+	}
+}
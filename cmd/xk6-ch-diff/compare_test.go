@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareRuns(t *testing.T) {
+	t.Parallel()
+
+	base := runStats{testID: "base", duration: 10 * time.Second, metrics: map[string]metricStats{
+		"http_req_duration": {metric: "http_req_duration", kind: "trend", p95: 100},
+		"http_req_failed":   {metric: "http_req_failed", kind: "rate", avg: 0.01},
+		"checks":            {metric: "checks", kind: "rate", avg: 0.99},
+		"http_reqs":         {metric: "http_reqs", kind: "counter", sum: 1000},
+		"vus":               {metric: "vus", kind: "gauge", avg: 10},
+		"old_metric":        {metric: "old_metric", kind: "trend", p95: 1},
+	}}
+	cand := runStats{testID: "cand", duration: 10 * time.Second, metrics: map[string]metricStats{
+		"http_req_duration": {metric: "http_req_duration", kind: "trend", p95: 115},
+		"http_req_failed":   {metric: "http_req_failed", kind: "rate", avg: 0.015},
+		"checks":            {metric: "checks", kind: "rate", avg: 0.95},
+		"http_reqs":         {metric: "http_reqs", kind: "counter", sum: 950},
+		"vus":               {metric: "vus", kind: "gauge", avg: 50},
+		"new_metric":        {metric: "new_metric", kind: "trend", p95: 1},
+	}}
+
+	rows := compareRuns(base, cand, thresholds{relative: 10, rate: 1})
+	byMetric := make(map[string]comparison, len(rows))
+	names := make([]string, 0, len(rows))
+	for _, r := range rows {
+		byMetric[r.metric] = r
+		names = append(names, r.metric)
+	}
+
+	assert.Equal(t, []string{"checks", "http_req_duration", "http_req_failed", "http_reqs", "new_metric", "old_metric", "vus"}, names)
+
+	duration := byMetric["http_req_duration"]
+	assert.Equal(t, "p95", duration.stat)
+	assert.InDelta(t, 15, duration.delta, 1e-9)
+	assert.True(t, duration.regression, "p95 grew 15%, beyond 10%")
+
+	failed := byMetric["http_req_failed"]
+	assert.InDelta(t, 0.5, failed.delta, 1e-9)
+	assert.False(t, failed.regression, "error rate grew 0.5pp, within 1pp")
+
+	checks := byMetric["checks"]
+	assert.InDelta(t, -4, checks.delta, 1e-9)
+	assert.True(t, checks.regression, "check pass rate dropped 4pp")
+
+	reqs := byMetric["http_reqs"]
+	assert.Equal(t, "per sec", reqs.stat)
+	assert.InDelta(t, 100, reqs.baseline, 1e-9)
+	assert.InDelta(t, 95, reqs.candidate, 1e-9)
+	assert.False(t, reqs.regression, "throughput dropped 5%, within 10%")
+
+	assert.False(t, byMetric["vus"].regression, "gauges are informational")
+	assert.False(t, byMetric["new_metric"].hasBase)
+	assert.False(t, byMetric["old_metric"].hasCand)
+	assert.Equal(t, 2, countRegressions(rows))
+}
+
+func TestRegressed(t *testing.T) {
+	t.Parallel()
+
+	th := thresholds{relative: 10, rate: 1}
+
+	tests := []struct {
+		name      string
+		metric    string
+		kind      string
+		base      float64
+		cand      float64
+		regressed bool
+	}{
+		{name: "faster trend", kind: "trend", base: 100, cand: 50},
+		{name: "slower trend", kind: "trend", base: 100, cand: 111, regressed: true},
+		{name: "trend from zero", kind: "trend", base: 0, cand: 5, regressed: true},
+		{name: "trend stays zero", kind: "trend", base: 0, cand: 0},
+		{name: "throughput drop", kind: "counter", base: 100, cand: 80, regressed: true},
+		{name: "throughput gain", kind: "counter", base: 100, cand: 200},
+		{name: "error rate up", metric: "http_req_failed", kind: "rate", base: 1, cand: 2.5, regressed: true},
+		{name: "checks up", metric: "checks", kind: "rate", base: 90, cand: 99},
+		{name: "gauge change", kind: "gauge", base: 1, cand: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, dir := statFor(tt.metric, tt.kind)
+			cmp := comparison{baseline: tt.base, candidate: tt.cand, hasBase: true, hasCand: true, points: tt.kind == "rate"}
+			cmp.delta, cmp.deltaOK = delta(tt.base, tt.cand, cmp.points)
+			assert.Equal(t, tt.regressed, regressed(cmp, dir, th))
+		})
+	}
+}
+
+func TestPrintReport(t *testing.T) {
+	t.Parallel()
+
+	rows := []comparison{
+		{metric: "http_req_duration", stat: "p95", baseline: 100, candidate: 120, hasBase: true, hasCand: true, delta: 20, deltaOK: true, regression: true},
+		{metric: "http_req_failed", stat: "rate %", baseline: 1, candidate: 1.5, hasBase: true, hasCand: true, delta: 0.5, deltaOK: true, points: true},
+		{metric: "new_metric", stat: "p95", candidate: 3, hasCand: true},
+	}
+
+	var plain bytes.Buffer
+	require.NoError(t, printReport(&plain, "base", "cand", rows, false))
+	out := plain.String()
+	assert.Contains(t, out, "METRIC")
+	assert.Contains(t, out, "+20.0%")
+	assert.Contains(t, out, "REGRESSION")
+	assert.Contains(t, out, "+0.50pp")
+	assert.Contains(t, out, "new")
+	assert.Contains(t, out, "1 regression in cand compared to base.")
+	assert.NotContains(t, out, "\x1b[")
+
+	var colored bytes.Buffer
+	require.NoError(t, printReport(&colored, "base", "cand", rows, true))
+	assert.Contains(t, colored.String(), ansiRed+"REGRESSION"+ansiReset)
+}
+
+func TestParseFlags(t *testing.T) {
+	t.Parallel()
+
+	opts, baseline, candidate, err := parseFlags([]string{"-schema", "compatible", "-threshold", "5", "a", "b"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "a", baseline)
+	assert.Equal(t, "b", candidate)
+	assert.Equal(t, schemaCompatible, opts.schema)
+	assert.InDelta(t, 5, opts.threshold, 1e-9)
+
+	_, _, _, err = parseFlags([]string{"a"}, io.Discard)
+	require.Error(t, err)
+
+	_, _, _, err = parseFlags([]string{"-schema", "wide", "a", "b"}, io.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid -schema "wide"`)
+
+	assert.Equal(t, exitError, run([]string{"-database", "bad-name", "a", "b"}, io.Discard, io.Discard))
+}
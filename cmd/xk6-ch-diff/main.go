@@ -0,0 +1,139 @@
+// Command xk6-ch-diff compares two k6 test runs stored by xk6-output-clickhouse
+// and prints per-metric deltas: p95 for trends, the rate for rates, and the
+// per-second throughput for counters. Changes beyond the thresholds are
+// flagged as regressions and make the command exit with status 1, so it can
+// gate a CI pipeline:
+//
+//	xk6-ch-diff -addr clickhouse:9000 -threshold 10 baseline-run candidate-run
+//
+// Runs are selected by their testid tag (k6 run --tag testid=<id>).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mkutlak/xk6-output-clickhouse/internal/cmdutil"
+)
+
+// Exit statuses.
+const (
+	exitOK         = 0
+	exitRegression = 1
+	exitError      = 2
+)
+
+// options holds the command-line flags.
+type options struct {
+	addr          string
+	user          string
+	password      string
+	database      string
+	table         string
+	schema        string
+	threshold     float64
+	rateThreshold float64
+	timeout       time.Duration
+	noColor       bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run parses args, compares the two runs, and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	opts, baseline, candidate, err := parseFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "xk6-ch-diff:", err)
+		return exitError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	src, err := openSource(opts)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "xk6-ch-diff:", err)
+		return exitError
+	}
+	defer func() { _ = src.close() }()
+
+	base, err := src.runStats(ctx, baseline)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "xk6-ch-diff:", err)
+		return exitError
+	}
+	cand, err := src.runStats(ctx, candidate)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "xk6-ch-diff:", err)
+		return exitError
+	}
+
+	rows := compareRuns(base, cand, thresholds{relative: opts.threshold, rate: opts.rateThreshold})
+	color := !opts.noColor && isTerminal(stdout)
+	if err := printReport(stdout, baseline, candidate, rows, color); err != nil {
+		_, _ = fmt.Fprintln(stderr, "xk6-ch-diff:", err)
+		return exitError
+	}
+
+	if countRegressions(rows) > 0 {
+		return exitRegression
+	}
+	return exitOK
+}
+
+// parseFlags parses args into options and the two testids. Connection flags
+// default to the K6_CLICKHOUSE_* variables the output itself reads.
+func parseFlags(args []string, stderr io.Writer) (opts options, baseline, candidate string, err error) {
+	fs := flag.NewFlagSet("xk6-ch-diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "Usage: xk6-ch-diff [flags] <baseline-testid> <candidate-testid>")
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&opts.addr, "addr", cmdutil.EnvOr("K6_CLICKHOUSE_ADDR", "localhost:9000"), "ClickHouse native address (env K6_CLICKHOUSE_ADDR)")
+	fs.StringVar(&opts.user, "user", cmdutil.EnvOr("K6_CLICKHOUSE_USER", "default"), "ClickHouse user (env K6_CLICKHOUSE_USER)")
+	fs.StringVar(&opts.password, "password", os.Getenv("K6_CLICKHOUSE_PASSWORD"), "ClickHouse password (env K6_CLICKHOUSE_PASSWORD)")
+	fs.StringVar(&opts.database, "database", cmdutil.EnvOr("K6_CLICKHOUSE_DB", "k6"), "database holding the samples (env K6_CLICKHOUSE_DB)")
+	fs.StringVar(&opts.table, "table", cmdutil.EnvOr("K6_CLICKHOUSE_TABLE", "samples"), "table holding the samples (env K6_CLICKHOUSE_TABLE)")
+	fs.StringVar(&opts.schema, "schema", cmdutil.EnvOr("K6_CLICKHOUSE_SCHEMA_MODE", schemaSimple), "schema the table uses: simple or compatible (env K6_CLICKHOUSE_SCHEMA_MODE)")
+	fs.Float64Var(&opts.threshold, "threshold", 10, "regression threshold for p95 and throughput, in percent")
+	fs.Float64Var(&opts.rateThreshold, "rate-threshold", 1, "regression threshold for rates, in percentage points")
+	fs.DurationVar(&opts.timeout, "timeout", time.Minute, "timeout for the queries")
+	fs.BoolVar(&opts.noColor, "no-color", os.Getenv("NO_COLOR") != "", "disable colored output (env NO_COLOR)")
+
+	if err = fs.Parse(args); err != nil {
+		return options{}, "", "", err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return options{}, "", "", errors.New("expected a baseline and a candidate testid")
+	}
+	if opts.schema != schemaCompatible && opts.schema != schemaSimple {
+		return options{}, "", "", fmt.Errorf("invalid -schema %q (must be %s or %s)", opts.schema, schemaSimple, schemaCompatible)
+	}
+	if opts.threshold < 0 || opts.rateThreshold < 0 {
+		return options{}, "", "", errors.New("thresholds must not be negative")
+	}
+	return opts, fs.Arg(0), fs.Arg(1), nil
+}
+
+// isTerminal reports whether w is a character device such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
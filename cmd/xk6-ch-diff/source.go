@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/mkutlak/xk6-output-clickhouse/pkg/chquery"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// Schemas whose tables the command can read; they match the output's
+// schemaMode names.
+const (
+	schemaSimple     = string(chquery.SchemaSimple)
+	schemaCompatible = string(chquery.SchemaCompatible)
+)
+
+// metricStats aggregates one metric of one run.
+type metricStats struct {
+	metric string
+	kind   string // counter, gauge, rate, or trend
+	count  uint64
+	p95    float64
+	avg    float64
+	sum    float64
+}
+
+// runStats aggregates all metrics of one run.
+type runStats struct {
+	testID   string
+	duration time.Duration
+	metrics  map[string]metricStats
+}
+
+// source reads run statistics from a samples table.
+type source struct {
+	db     *sql.DB
+	client *chquery.Client
+
+	// builtin resolves metric types for the simple schema, which does not
+	// store them.
+	builtin *metrics.Registry
+}
+
+// openSource connects to the ClickHouse server named by opts.
+func openSource(opts options) (*source, error) {
+	db := clickhouse.OpenDB(&clickhouse.Options{
+		Addr: []string{opts.addr},
+		Auth: clickhouse.Auth{
+			Database: opts.database,
+			Username: opts.user,
+			Password: opts.password,
+		},
+	})
+	client, err := chquery.New(db, opts.database, opts.table, chquery.Schema(opts.schema))
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	builtin := metrics.NewRegistry()
+	metrics.RegisterBuiltinMetrics(builtin)
+
+	return &source{db: db, client: client, builtin: builtin}, nil
+}
+
+// close releases the connection pool.
+func (s *source) close() error {
+	return s.db.Close()
+}
+
+// runStats aggregates every metric of the run tagged testID.
+func (s *source) runStats(ctx context.Context, testID string) (runStats, error) {
+	run, err := s.client.RunForTest(ctx, testID)
+	if err != nil {
+		return runStats{}, err
+	}
+	all, err := s.client.MetricsForTest(ctx, testID)
+	if err != nil {
+		return runStats{}, err
+	}
+
+	stats := runStats{testID: testID, duration: run.End.Sub(run.Start), metrics: make(map[string]metricStats, len(all))}
+	for _, m := range all {
+		kind := m.Type
+		if kind == "" {
+			kind = s.metricKind(m.Metric)
+		}
+		stats.metrics[m.Metric] = metricStats{
+			metric: m.Metric, kind: kind, count: m.Count, p95: m.P95, avg: m.Avg, sum: m.Sum,
+		}
+	}
+	return stats, nil
+}
+
+// metricKind returns the type of a k6 builtin metric. Custom metrics are
+// compared as trends, since the simple schema does not record their type.
+func (s *source) metricKind(name string) string {
+	if m := s.builtin.Get(name); m != nil {
+		return m.Type.String()
+	}
+	return metrics.Trend.String()
+}
@@ -0,0 +1,14 @@
+// Package cmdutil holds helpers shared by the repository's command-line
+// tools.
+package cmdutil
+
+import "os"
+
+// EnvOr returns the environment variable key, or def when it is unset or
+// empty.
+func EnvOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
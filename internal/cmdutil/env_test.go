@@ -0,0 +1,15 @@
+package cmdutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvOr(t *testing.T) {
+	t.Setenv("K6_CLICKHOUSE_CMDUTIL_TEST", "compatible")
+	assert.Equal(t, "compatible", EnvOr("K6_CLICKHOUSE_CMDUTIL_TEST", "simple"))
+
+	t.Setenv("K6_CLICKHOUSE_CMDUTIL_TEST", "")
+	assert.Equal(t, "simple", EnvOr("K6_CLICKHOUSE_CMDUTIL_TEST", "simple"), "empty counts as unset")
+}
@@ -0,0 +1,321 @@
+// Package chquery reads k6 results stored by xk6-output-clickhouse. Its typed
+// functions cover the built-in simple and compatible schemas, so Go tooling
+// and CI gates can consume results without hand-writing SQL.
+//
+// Runs are identified by their testid tag (k6 run --tag testid=<id>). The
+// compatible schema stores it in the testid column; the simple schema is read
+// through tags['testid'], which requires the default Map tag storage. Tables
+// written with rateBoolColumn=true are detected and read through value + rate.
+//
+//	db := clickhouse.OpenDB(&clickhouse.Options{Addr: []string{"localhost:9000"}})
+//	q, err := chquery.New(db, "k6", "samples", chquery.SchemaCompatible)
+//	...
+//	p, err := q.PercentilesForTest(ctx, "nightly-42", "http_req_duration")
+package chquery
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Schema names the table layout a Client reads; the values match the
+// output's schemaMode names.
+type Schema string
+
+// Built-in schemas.
+const (
+	// SchemaSimple is the 4-column layout with tags in a Map column.
+	SchemaSimple Schema = "simple"
+
+	// SchemaCompatible is the 21-column layout with typed tag columns.
+	SchemaCompatible Schema = "compatible"
+)
+
+// ErrNoSamples is returned when the requested run or metric has no samples.
+var ErrNoSamples = errors.New("no samples found")
+
+// identifierPattern matches the database and table names the output accepts.
+var identifierPattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,63}$`)
+
+// ValidateIdentifier returns an error unless name, a database or table name
+// as told by kind, is one the output accepts. Valid names are safe to quote
+// with backticks in a query.
+func ValidateIdentifier(kind, name string) error {
+	if !identifierPattern.MatchString(name) {
+		return fmt.Errorf("invalid %s name: %s (must be alphanumeric + underscore, max 63 chars)", kind, name)
+	}
+	return nil
+}
+
+// TestIDColumn returns the expression yielding a sample's testid in a table
+// laid out as schema.
+func TestIDColumn(schema Schema) (string, error) {
+	switch schema {
+	case SchemaSimple:
+		return "tags['testid']", nil
+	case SchemaCompatible:
+		return "testid", nil
+	default:
+		return "", fmt.Errorf("unsupported schema %q (must be %s or %s)", schema, SchemaSimple, SchemaCompatible)
+	}
+}
+
+// Client runs result queries against one samples table. It is safe for
+// concurrent use.
+type Client struct {
+	db       *sql.DB
+	database string
+	name     string // unescaped table name, for system.columns
+	table    string // escaped database.table
+	schema   Schema
+	testID   string // expression yielding a sample's testid
+
+	mu    sync.Mutex
+	value string // expression yielding a sample's value; "" until detected
+}
+
+// New returns a Client reading database.table, laid out as schema. The caller
+// owns db and closes it.
+func New(db *sql.DB, database, table string, schema Schema) (*Client, error) {
+	if db == nil {
+		return nil, errors.New("chquery: db must not be nil")
+	}
+	if err := ValidateIdentifier("database", database); err != nil {
+		return nil, err
+	}
+	if err := ValidateIdentifier("table", table); err != nil {
+		return nil, err
+	}
+	testID, err := TestIDColumn(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		db:       db,
+		database: database,
+		name:     table,
+		table:    fmt.Sprintf("`%s`.`%s`", database, table),
+		schema:   schema,
+		testID:   testID,
+	}, nil
+}
+
+// rateColumn is written by the output with rateBoolColumn=true: Rate rows
+// then hold their outcome there and 0 in value.
+const rateColumn = "rate"
+
+// valueExpr returns the expression yielding the value k6 emitted for a row:
+// value + rate when the table has the rate column, value otherwise. The
+// table's columns are looked up once, on first use.
+func (c *Client) valueExpr(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.value != "" {
+		return c.value, nil
+	}
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT name FROM system.columns WHERE database = ? AND table = ? AND name = ?", c.database, c.name, rateColumn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the columns of %s: %w", c.table, err)
+	}
+	defer func() { _ = rows.Close() }()
+	hasRate := rows.Next()
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to read the columns of %s: %w", c.table, err)
+	}
+
+	c.value = "value"
+	if hasRate {
+		c.value = "(value + " + rateColumn + ")"
+	}
+	return c.value, nil
+}
+
+// Percentiles summarizes the values of one metric in one run.
+type Percentiles struct {
+	Count uint64
+	Min   float64
+	Max   float64
+	Avg   float64
+	P50   float64
+	P90   float64
+	P95   float64
+	P99   float64
+}
+
+// PercentilesForTest returns the distribution of metric's values in the run
+// tagged testID. It returns ErrNoSamples when the run has no such samples.
+func (c *Client) PercentilesForTest(ctx context.Context, testID, metric string) (Percentiles, error) {
+	value, err := c.valueExpr(ctx)
+	if err != nil {
+		return Percentiles{}, err
+	}
+	//nolint:gosec // G201: the table name is validated in New and escaped with backticks
+	query := fmt.Sprintf(
+		"SELECT count(), min(%[1]s), max(%[1]s), avg(%[1]s), quantiles(0.5, 0.9, 0.95, 0.99)(%[1]s) "+
+			"FROM %[2]s WHERE %[3]s = ? AND metric = ?", value, c.table, c.testID)
+
+	var (
+		p         Percentiles
+		quantiles []float64
+	)
+	if err := c.db.QueryRowContext(ctx, query, testID, metric).
+		Scan(&p.Count, &p.Min, &p.Max, &p.Avg, &quantiles); err != nil {
+		return Percentiles{}, fmt.Errorf("failed to query %s percentiles of run %q: %w", metric, testID, err)
+	}
+	if p.Count == 0 {
+		return Percentiles{}, fmt.Errorf("%s in run %q: %w", metric, testID, ErrNoSamples)
+	}
+	if len(quantiles) != 4 {
+		return Percentiles{}, fmt.Errorf("unexpected quantiles result for %s in run %q: %v", metric, testID, quantiles)
+	}
+	p.P50, p.P90, p.P95, p.P99 = quantiles[0], quantiles[1], quantiles[2], quantiles[3]
+	return p, nil
+}
+
+// ErrorRate counts failed HTTP requests, as recorded by k6's http_req_failed
+// metric.
+type ErrorRate struct {
+	Requests uint64
+	Failed   uint64
+
+	// Rate is Failed/Requests, between 0 and 1.
+	Rate float64
+}
+
+// ErrorRateForTest returns the HTTP error rate of the run tagged testID. It
+// returns ErrNoSamples when the run made no HTTP requests.
+func (c *Client) ErrorRateForTest(ctx context.Context, testID string) (ErrorRate, error) {
+	value, err := c.valueExpr(ctx)
+	if err != nil {
+		return ErrorRate{}, err
+	}
+	//nolint:gosec // G201: the table name is validated in New and escaped with backticks
+	query := fmt.Sprintf(
+		"SELECT count(), countIf(%s != 0) FROM %s WHERE %s = ? AND metric = 'http_req_failed'",
+		value, c.table, c.testID)
+
+	var r ErrorRate
+	if err := c.db.QueryRowContext(ctx, query, testID).Scan(&r.Requests, &r.Failed); err != nil {
+		return ErrorRate{}, fmt.Errorf("failed to query error rate of run %q: %w", testID, err)
+	}
+	if r.Requests == 0 {
+		return ErrorRate{}, fmt.Errorf("http_req_failed in run %q: %w", testID, ErrNoSamples)
+	}
+	r.Rate = float64(r.Failed) / float64(r.Requests)
+	return r, nil
+}
+
+// MetricStats summarizes one metric of one run.
+type MetricStats struct {
+	Metric string
+
+	// Type is the metric's k6 type (counter, gauge, rate, or trend). It is
+	// empty for the simple schema, which does not store it.
+	Type string
+
+	Count uint64
+	P95   float64
+	Avg   float64
+	Sum   float64
+}
+
+// MetricsForTest returns the statistics of every metric in the run tagged
+// testID, ordered by name. It returns ErrNoSamples when the run has no
+// samples.
+func (c *Client) MetricsForTest(ctx context.Context, testID string) ([]MetricStats, error) {
+	value, err := c.valueExpr(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metricType := "''"
+	if c.schema == SchemaCompatible {
+		metricType = "toString(metric_type)"
+	}
+	//nolint:gosec // G201: the table name is validated in New and escaped with backticks
+	query := fmt.Sprintf(
+		"SELECT metric, %[1]s AS type, count(), quantile(0.95)(%[2]s), avg(%[2]s), sum(%[2]s) "+
+			"FROM %[3]s WHERE %[4]s = ? GROUP BY metric, type ORDER BY metric",
+		metricType, value, c.table, c.testID)
+
+	rows, err := c.db.QueryContext(ctx, query, testID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metrics of run %q: %w", testID, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var stats []MetricStats
+	for rows.Next() {
+		var m MetricStats
+		if err := rows.Scan(&m.Metric, &m.Type, &m.Count, &m.P95, &m.Avg, &m.Sum); err != nil {
+			return nil, fmt.Errorf("failed to read metrics of run %q: %w", testID, err)
+		}
+		stats = append(stats, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metrics of run %q: %w", testID, err)
+	}
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("run %q: %w", testID, ErrNoSamples)
+	}
+	return stats, nil
+}
+
+// Run describes one test run stored in the table.
+type Run struct {
+	TestID  string
+	Start   time.Time // first sample
+	End     time.Time // last sample
+	Samples uint64
+}
+
+// RunForTest returns the run tagged testID. It returns ErrNoSamples when the
+// table holds no samples of that run.
+func (c *Client) RunForTest(ctx context.Context, testID string) (Run, error) {
+	//nolint:gosec // G201: the table name is validated in New and escaped with backticks
+	query := fmt.Sprintf("SELECT min(timestamp), max(timestamp), count() FROM %s WHERE %s = ?", c.table, c.testID)
+
+	r := Run{TestID: testID}
+	if err := c.db.QueryRowContext(ctx, query, testID).Scan(&r.Start, &r.End, &r.Samples); err != nil {
+		return Run{}, fmt.Errorf("failed to query run %q: %w", testID, err)
+	}
+	if r.Samples == 0 {
+		return Run{}, fmt.Errorf("run %q: %w", testID, ErrNoSamples)
+	}
+	return r, nil
+}
+
+// ListRuns returns the runs stored in the table, most recent first. Samples
+// without a testid tag are not listed.
+func (c *Client) ListRuns(ctx context.Context) ([]Run, error) {
+	//nolint:gosec // G201: the table name is validated in New and escaped with backticks
+	query := fmt.Sprintf(
+		"SELECT %s AS run, min(timestamp) AS start, max(timestamp), count() "+
+			"FROM %s WHERE run != '' GROUP BY run ORDER BY start DESC", c.testID, c.table)
+
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var runs []Run
+	for rows.Next() {
+		var r Run
+		if err := rows.Scan(&r.TestID, &r.Start, &r.End, &r.Samples); err != nil {
+			return nil, fmt.Errorf("failed to read runs: %w", err)
+		}
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read runs: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,280 @@
+package chquery
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB is a database/sql connector answering every query with a canned
+// result set and recording the queries and their arguments. Lookups in
+// system.columns are answered from columns instead and not recorded.
+type fakeDB struct {
+	mu      sync.Mutex
+	rows    [][]driver.Value
+	columns []string
+	err     error
+	queries []string
+	args    [][]any
+	lookups int // system.columns queries
+}
+
+func newFakeDB(t *testing.T, rows ...[]driver.Value) (*fakeDB, *sql.DB) {
+	t.Helper()
+	f := &fakeDB{rows: rows}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { _ = db.Close() })
+	return f, db
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("fake driver: prepare") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("fake driver: begin") }
+
+// CheckNamedValue accepts arguments unconverted, as clickhouse-go does.
+func (fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	values := make([]any, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	if strings.Contains(query, "system.columns") {
+		c.db.lookups++
+		var rows [][]driver.Value
+		for _, col := range c.db.columns {
+			if col == values[len(values)-1] {
+				rows = append(rows, []driver.Value{col})
+			}
+		}
+		return &fakeRows{rows: rows}, nil
+	}
+	c.db.queries = append(c.db.queries, query)
+	c.db.args = append(c.db.args, values)
+	if c.db.err != nil {
+		return nil, c.db.err
+	}
+	return &fakeRows{rows: c.db.rows}, nil
+}
+
+type fakeRows struct{ rows [][]driver.Value }
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	_, db := newFakeDB(t)
+
+	_, err := New(db, "k6", "samples", SchemaSimple)
+	require.NoError(t, err)
+
+	_, err = New(nil, "k6", "samples", SchemaSimple)
+	require.Error(t, err)
+
+	_, err = New(db, "k6; DROP", "samples", SchemaSimple)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid database name")
+
+	_, err = New(db, "k6", "samples", Schema("wide"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported schema "wide"`)
+}
+
+func TestValidateIdentifier(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, ValidateIdentifier("table", "samples_2026"))
+	require.EqualError(t, ValidateIdentifier("table", "samples`"),
+		"invalid table name: samples` (must be alphanumeric + underscore, max 63 chars)")
+	require.Error(t, ValidateIdentifier("database", ""))
+}
+
+func TestPercentilesForTest(t *testing.T) {
+	t.Parallel()
+
+	f, db := newFakeDB(t, []driver.Value{uint64(200), 1.0, 900.0, 120.0, []float64{100, 180, 250, 600}})
+	q, err := New(db, "k6", "samples", SchemaCompatible)
+	require.NoError(t, err)
+
+	p, err := q.PercentilesForTest(context.Background(), "run-1", "http_req_duration")
+	require.NoError(t, err)
+	assert.Equal(t, Percentiles{Count: 200, Min: 1, Max: 900, Avg: 120, P50: 100, P90: 180, P95: 250, P99: 600}, p)
+
+	require.Len(t, f.queries, 1)
+	assert.Contains(t, f.queries[0], "FROM `k6`.`samples` WHERE testid = ? AND metric = ?")
+	assert.Equal(t, []any{"run-1", "http_req_duration"}, f.args[0])
+}
+
+func TestPercentilesForTest_NoSamples(t *testing.T) {
+	t.Parallel()
+
+	_, db := newFakeDB(t, []driver.Value{uint64(0), 0.0, 0.0, 0.0, []float64{0, 0, 0, 0}})
+	q, err := New(db, "k6", "samples", SchemaSimple)
+	require.NoError(t, err)
+
+	_, err = q.PercentilesForTest(context.Background(), "missing", "http_req_duration")
+	require.ErrorIs(t, err, ErrNoSamples)
+}
+
+func TestErrorRateForTest(t *testing.T) {
+	t.Parallel()
+
+	f, db := newFakeDB(t, []driver.Value{uint64(400), uint64(10)})
+	q, err := New(db, "k6", "samples", SchemaSimple)
+	require.NoError(t, err)
+
+	r, err := q.ErrorRateForTest(context.Background(), "run-1")
+	require.NoError(t, err)
+	assert.Equal(t, ErrorRate{Requests: 400, Failed: 10, Rate: 0.025}, r)
+	assert.Contains(t, f.queries[0], "WHERE tags['testid'] = ? AND metric = 'http_req_failed'")
+
+	f.mu.Lock()
+	f.rows = [][]driver.Value{{uint64(0), uint64(0)}}
+	f.mu.Unlock()
+	_, err = q.ErrorRateForTest(context.Background(), "run-2")
+	require.ErrorIs(t, err, ErrNoSamples)
+}
+
+func TestClient_RateColumn(t *testing.T) {
+	t.Parallel()
+
+	// A table written with rateBoolColumn=true: Rate rows hold 0 in value
+	f, db := newFakeDB(t, []driver.Value{uint64(10), uint64(2)})
+	f.columns = []string{"timestamp", "metric", "value", "tags", "rate"}
+	q, err := New(db, "k6", "samples", SchemaSimple)
+	require.NoError(t, err)
+
+	r, err := q.ErrorRateForTest(context.Background(), "run-1")
+	require.NoError(t, err)
+	assert.Equal(t, ErrorRate{Requests: 10, Failed: 2, Rate: 0.2}, r)
+	assert.Contains(t, f.queries[0], "countIf((value + rate) != 0)")
+
+	f.mu.Lock()
+	f.rows = [][]driver.Value{{"checks", "", uint64(4), 1.0, 0.75, 3.0}}
+	f.mu.Unlock()
+	_, err = q.MetricsForTest(context.Background(), "run-1")
+	require.NoError(t, err)
+	assert.Contains(t, f.queries[1], "quantile(0.95)((value + rate)), avg((value + rate)), sum((value + rate))")
+	assert.Equal(t, 1, f.lookups, "the columns are looked up once")
+
+	// Without the column, value is read as is
+	f, db = newFakeDB(t, []driver.Value{uint64(10), uint64(2)})
+	q, err = New(db, "k6", "samples", SchemaSimple)
+	require.NoError(t, err)
+	_, err = q.ErrorRateForTest(context.Background(), "run-1")
+	require.NoError(t, err)
+	assert.Contains(t, f.queries[0], "countIf(value != 0)")
+	assert.Equal(t, 1, f.lookups)
+}
+
+func TestMetricsForTest(t *testing.T) {
+	t.Parallel()
+
+	f, db := newFakeDB(t,
+		[]driver.Value{"http_req_duration", "trend", uint64(200), 250.0, 120.0, 24000.0},
+		[]driver.Value{"http_reqs", "counter", uint64(200), 1.0, 1.0, 200.0},
+	)
+	q, err := New(db, "k6", "samples", SchemaCompatible)
+	require.NoError(t, err)
+
+	stats, err := q.MetricsForTest(context.Background(), "run-1")
+	require.NoError(t, err)
+	assert.Equal(t, []MetricStats{
+		{Metric: "http_req_duration", Type: "trend", Count: 200, P95: 250, Avg: 120, Sum: 24000},
+		{Metric: "http_reqs", Type: "counter", Count: 200, P95: 1, Avg: 1, Sum: 200},
+	}, stats)
+	assert.Contains(t, f.queries[0], "toString(metric_type) AS type")
+	assert.Contains(t, f.queries[0], "WHERE testid = ? GROUP BY metric, type")
+
+	f.mu.Lock()
+	f.rows = nil
+	f.mu.Unlock()
+	_, err = q.MetricsForTest(context.Background(), "missing")
+	require.ErrorIs(t, err, ErrNoSamples)
+}
+
+func TestRunForTest(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	f, db := newFakeDB(t, []driver.Value{start, start.Add(time.Minute), uint64(10)})
+	q, err := New(db, "k6", "samples", SchemaSimple)
+	require.NoError(t, err)
+
+	r, err := q.RunForTest(context.Background(), "run-1")
+	require.NoError(t, err)
+	assert.Equal(t, Run{TestID: "run-1", Start: start, End: start.Add(time.Minute), Samples: 10}, r)
+	assert.Contains(t, f.queries[0], "WHERE tags['testid'] = ?")
+
+	f.mu.Lock()
+	f.rows = [][]driver.Value{{time.Time{}, time.Time{}, uint64(0)}}
+	f.mu.Unlock()
+	_, err = q.RunForTest(context.Background(), "missing")
+	require.ErrorIs(t, err, ErrNoSamples)
+}
+
+func TestListRuns(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, db := newFakeDB(t,
+		[]driver.Value{"run-2", start.Add(time.Hour), start.Add(2 * time.Hour), uint64(50)},
+		[]driver.Value{"run-1", start, start.Add(time.Minute), uint64(10)},
+	)
+	q, err := New(db, "k6", "samples", SchemaCompatible)
+	require.NoError(t, err)
+
+	runs, err := q.ListRuns(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Run{
+		{TestID: "run-2", Start: start.Add(time.Hour), End: start.Add(2 * time.Hour), Samples: 50},
+		{TestID: "run-1", Start: start, End: start.Add(time.Minute), Samples: 10},
+	}, runs)
+}
+
+func TestListRuns_QueryError(t *testing.T) {
+	t.Parallel()
+
+	f, db := newFakeDB(t)
+	f.err = errors.New("connection refused")
+	q, err := New(db, "k6", "samples", SchemaCompatible)
+	require.NoError(t, err)
+
+	_, err = q.ListRuns(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to list runs: connection refused")
+}
@@ -0,0 +1,148 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// Values of the audit table's status column.
+const (
+	// auditCommitted marks a batch the server acknowledged.
+	auditCommitted = "committed"
+
+	// auditAmbiguous marks a batch whose send failed without a server
+	// response; look its query_id up in system.query_log.
+	auditAmbiguous = "ambiguous"
+)
+
+// maxAuditPending caps the audit rows kept while the audit table cannot be
+// written; the oldest are dropped beyond it.
+const maxAuditPending = 10000
+
+// auditEntry describes one sent batch.
+type auditEntry struct {
+	queryID  string
+	table    string
+	status   string
+	rows     int
+	minTime  time.Time
+	maxTime  time.Time
+	duration time.Duration
+	sentAt   time.Time
+}
+
+// auditLog collects an entry per sent batch until the next flush writes them
+// to Config.AuditTable.
+type auditLog struct {
+	pending pendingRows[auditEntry]
+}
+
+// newAuditLog returns nil when no audit table is configured.
+func newAuditLog(table string) *auditLog {
+	if table == "" {
+		return nil
+	}
+	return &auditLog{pending: pendingRows[auditEntry]{limit: maxAuditPending}}
+}
+
+// record queues an entry for the audit table.
+func (a *auditLog) record(e auditEntry) {
+	a.pending.add(e)
+}
+
+// newQueryID returns a random UUID used as the query ID of an audited insert,
+// which ties the audit row to the insert's entry in system.query_log.
+func newQueryID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])  // never fails, see crypto/rand.Read
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// withQueryID gives the insert prepared with ctx a fresh query ID.
+func withQueryID(ctx context.Context) (context.Context, string) {
+	id := newQueryID()
+	return clickhouse.Context(ctx, clickhouse.WithQueryID(id)), id
+}
+
+// createAuditTable creates the audit table.
+func createAuditTable(ctx context.Context, db *sql.DB, database, table string) error {
+	if !isValidIdentifier(database) {
+		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", database)
+	}
+	if !isValidIdentifier(table) {
+		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
+	}
+
+	//nolint:gosec // G201: identifiers are validated with isValidIdentifier() and escaped with backticks
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s.%s (
+			query_id      String,
+			target_table  LowCardinality(String),
+			instance      LowCardinality(String),
+			status        LowCardinality(String),
+			rows          UInt64,
+			min_timestamp DateTime64(%d, 'UTC'),
+			max_timestamp DateTime64(%d, 'UTC'),
+			duration_ms   Float64,
+			sent_at       DateTime64(%d, 'UTC')
+		) ENGINE = MergeTree()
+		ORDER BY (target_table, sent_at)
+	`, escapeIdentifier(database), escapeIdentifier(table), TimestampPrecision, TimestampPrecision, TimestampPrecision)
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create audit table: %w", err)
+	}
+	return nil
+}
+
+// writeAudit inserts entries into the audit table in one batch.
+func writeAudit(ctx context.Context, db *sql.DB, database, table, instance string, entries []auditEntry) error {
+	if db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	batch, err := prepareInsert(ctx, db, nil, fmt.Sprintf(
+		"INSERT INTO %s.%s (query_id, target_table, instance, status, rows, min_timestamp, max_timestamp, duration_ms, sent_at) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		escapeIdentifier(database), escapeIdentifier(table)))
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		ms := float64(e.duration.Microseconds()) / 1000
+		if err := batch.append(ctx, e.queryID, e.table, instance, e.status, uint64(e.rows),
+			e.minTime, e.maxTime, ms, e.sentAt); err != nil {
+			batch.abort()
+			return fmt.Errorf("failed to insert audit row: %w", err)
+		}
+	}
+	if err := batch.send(); err != nil {
+		return fmt.Errorf("failed to send audit rows: %w", err)
+	}
+	return nil
+}
+
+// flushAudit writes the entries recorded since the last flush. Failures are
+// logged and the entries retried on the next flush; they never fail the
+// samples.
+func (o *Output) flushAudit(ctx context.Context, audit *auditLog) {
+	if audit == nil {
+		return
+	}
+	table := o.config.AuditTable
+	flushPendingRows(o, &audit.pending, table, "audit", func(entries []auditEntry) error {
+		o.mu.RLock()
+		db := o.db
+		o.mu.RUnlock()
+		return writeAudit(o.config.insertContext(ctx), db, o.config.Database, table, o.config.InstanceName, entries)
+	})
+}
@@ -0,0 +1,71 @@
+package clickhouse
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// auditRows returns the committed rows written to the audit table, which are
+// the only ones with nine columns.
+func auditRows(fake *fakeDB) [][]any {
+	var rows [][]any
+	for _, row := range fake.Rows() {
+		if len(row) == 9 {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func TestOutput_AuditTable(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval":  "1h",
+		"auditTable":    "k6_audit",
+		"instanceName":  "eu",
+		"retryAttempts": 0,
+	})
+
+	ddl := fake.DDL()
+	assert.Contains(t, ddl[len(ddl)-1], "CREATE TABLE IF NOT EXISTS `k6`.`k6_audit`")
+
+	addStatusSamples(o, 3, 0)
+	o.flush()
+
+	rows := auditRows(fake)
+	require.Len(t, rows, 1)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), rows[0][0])
+	assert.Equal(t, []any{"samples", "eu", auditCommitted, uint64(3)}, rows[0][1:5])
+
+	// A lost send is audited as ambiguous once the audit table is reachable
+	fake.set(func(f *fakeDB) { f.commitErr = errors.New("write: broken pipe") })
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	fake.set(func(f *fakeDB) { f.commitErr = nil })
+	o.flush()
+
+	rows = auditRows(fake)
+	require.Len(t, rows, 2)
+	assert.Equal(t, auditAmbiguous, rows[1][3])
+	assert.Equal(t, uint64(2), rows[1][4])
+	assert.NotEqual(t, rows[0][0], rows[1][0], "every batch gets its own query ID")
+}
+
+func TestAuditLog_RequeueCap(t *testing.T) {
+	t.Parallel()
+
+	a := newAuditLog("audit")
+	a.record(auditEntry{queryID: "newest"})
+	entries := make([]auditEntry, maxAuditPending)
+	assert.Equal(t, 1, a.pending.requeue(entries))
+
+	pending := a.pending.take()
+	assert.Len(t, pending, maxAuditPending)
+	assert.Equal(t, "newest", pending[len(pending)-1].queryID, "oldest entries dropped first")
+	assert.Nil(t, newAuditLog(""))
+}
@@ -0,0 +1,83 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// baselineViewDDL returns the CREATE OR REPLACE VIEW statement of
+// Config.BaselineView over table, or "" if the schema of t does not store the
+// testid. The view has one row per metric with the aggregates of the run
+// testID next to those of the baseline run and their relative change:
+//
+//	metric, current_testid, baseline_testid,
+//	current_count, baseline_count, current_avg, baseline_avg,
+//	current_p95, baseline_p95, avg_change, p95_change
+//
+// The baseline is baselineTestID, or else resolved whenever the view is read:
+// the testid of the latest row on branch other than testID.
+func baselineViewDDL(database, view string, t *schemaTarget, testID, baselineTestID, branch string) string {
+	testid := runTagExpr(t.schema, "testid")
+	if testid == "" {
+		return ""
+	}
+	table := escapeIdentifier(database) + "." + escapeIdentifier(t.table)
+
+	baseline := quoteLiteral(baselineTestID)
+	if baselineTestID == "" {
+		baseline = fmt.Sprintf("(SELECT argMax(%s, timestamp) FROM %s WHERE %s = %s AND %s NOT IN ('', %s))",
+			testid, table, runTagExpr(t.schema, "branch"), quoteLiteral(branch), testid, quoteLiteral(testID))
+	}
+
+	//nolint:gosec // G201: identifiers are validated with isValidIdentifier() and escaped with backticks; values are quoted
+	return fmt.Sprintf(`
+		CREATE OR REPLACE VIEW %s.%s AS
+		WITH
+			%s AS current_testid,
+			%s AS baseline_testid
+		SELECT
+			metric,
+			current_testid,
+			baseline_testid,
+			countIf(%[5]s = current_testid) AS current_count,
+			countIf(%[5]s = baseline_testid) AS baseline_count,
+			avgIf(%[7]s, %[5]s = current_testid) AS current_avg,
+			avgIf(%[7]s, %[5]s = baseline_testid) AS baseline_avg,
+			quantileIf(0.95)(%[7]s, %[5]s = current_testid) AS current_p95,
+			quantileIf(0.95)(%[7]s, %[5]s = baseline_testid) AS baseline_p95,
+			if(baseline_avg = 0, NULL, current_avg / baseline_avg - 1) AS avg_change,
+			if(baseline_p95 = 0, NULL, current_p95 / baseline_p95 - 1) AS p95_change
+		FROM %[6]s
+		WHERE %[5]s IN (current_testid, baseline_testid)
+		GROUP BY metric
+		ORDER BY metric
+	`, escapeIdentifier(database), escapeIdentifier(view), quoteLiteral(testID), baseline, testid, table,
+		storedValueExpr(t.schema))
+}
+
+// createBaselineView creates or replaces Config.BaselineView over the first
+// target. A run without a testid, or a first table whose schema has no testid,
+// gets no view and a warning.
+func (o *Output) createBaselineView(ctx context.Context, db *sql.DB, targets []*schemaTarget) error {
+	if o.config.BaselineView == "" || len(targets) == 0 {
+		return nil
+	}
+	logger := o.logger.WithField("view", o.config.BaselineView)
+	if o.testID == "" {
+		logger.Warn("baselineView needs a testid tag (run k6 with --tag testid=<id>); not creating it")
+		return nil
+	}
+	query := baselineViewDDL(o.config.Database, o.config.BaselineView, targets[0], o.testID,
+		o.config.BaselineTestID, o.config.BaselineBranch)
+	if query == "" {
+		logger.WithField("schemaMode", targets[0].mode).
+			Warn("baselineView needs the simple or compatible schema for the first table; not creating it")
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create baseline view: %w", err)
+	}
+	logger.Debug("Baseline view created")
+	return nil
+}
@@ -0,0 +1,87 @@
+package clickhouse
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/lib"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestBaselineViewDDL(t *testing.T) {
+	t.Parallel()
+
+	compatible := &schemaTarget{table: "samples", schema: CompatibleSchema{}}
+	ddl := baselineViewDDL("k6", "vs_baseline", compatible, "v2", "v1", "main")
+	assert.Contains(t, ddl, "CREATE OR REPLACE VIEW `k6`.`vs_baseline` AS")
+	assert.Contains(t, ddl, "'v2' AS current_testid")
+	assert.Contains(t, ddl, "'v1' AS baseline_testid")
+	assert.Contains(t, ddl, "quantileIf(0.95)(value, testid = baseline_testid) AS baseline_p95")
+	assert.Contains(t, ddl, "FROM `k6`.`samples`\n\t\tWHERE testid IN (current_testid, baseline_testid)")
+
+	simple := &schemaTarget{table: "samples", schema: SimpleSchema{}}
+	ddl = baselineViewDDL("k6", "vs_baseline", simple, "it's", "", "main")
+	assert.Contains(t, ddl, `'it\'s' AS current_testid`)
+	assert.Contains(t, ddl, "(SELECT argMax(tags['testid'], timestamp) FROM `k6`.`samples` "+
+		`WHERE tags['branch'] = 'main' AND tags['testid'] NOT IN ('', 'it\'s')) AS baseline_testid`,
+		"the latest other run on the branch")
+	assert.Contains(t, ddl, "countIf(tags['testid'] = current_testid) AS current_count")
+
+	assert.Empty(t, baselineViewDDL("k6", "vs_baseline", &schemaTarget{table: "samples", schema: StarSchema{}},
+		"v2", "", "main"))
+}
+
+func TestOutput_BaselineView(t *testing.T) {
+	t.Parallel()
+
+	start := func(t *testing.T, runTags map[string]string, config map[string]any) []string {
+		t.Helper()
+
+		fake, out := newFakeOutput(t, output.Params{
+			ScriptOptions: lib.Options{RunTags: runTags},
+			JSONConfig:    mustMarshalJSON(config),
+		})
+		require.NoError(t, out.Start())
+		require.NoError(t, out.Stop())
+
+		var views []string
+		for _, ddl := range fake.DDL() {
+			if strings.Contains(ddl, "CREATE OR REPLACE VIEW") {
+				views = append(views, ddl)
+			}
+		}
+		return views
+	}
+
+	views := start(t, map[string]string{"testid": "nightly-8"}, map[string]any{
+		"schemaMode":     "compatible",
+		"baselineView":   "nightly_vs_baseline",
+		"baselineTestid": "nightly-7",
+	})
+	require.Len(t, views, 1)
+	assert.Contains(t, views[0], "`k6`.`nightly_vs_baseline`")
+	assert.Contains(t, views[0], "'nightly-7' AS baseline_testid")
+
+	assert.Empty(t, start(t, nil, map[string]any{"baselineView": "vs_baseline"}), "no testid, no view")
+	assert.Empty(t, start(t, map[string]string{"testid": "nightly-8"}, map[string]any{
+		"baselineView": "vs_baseline",
+		"createTable":  false,
+	}), "no DDL without createTable")
+}
+
+func TestConfig_BaselineView(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.BaselineView = "vs-baseline"
+	require.ErrorContains(t, cfg.Validate(), "invalid baselineView: vs-baseline")
+
+	cfg.BaselineView = "vs_baseline"
+	cfg.BaselineBranch = ""
+	require.ErrorContains(t, cfg.Validate(), "baselineView needs baselineTestid or baselineBranch")
+
+	cfg.BaselineTestID = "nightly-7"
+	require.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,111 @@
+package clickhouse
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// countSamples returns the number of samples held by containers.
+func countSamples(containers []metrics.SampleContainer) int {
+	n := 0
+	for _, sc := range containers {
+		n += len(sc.GetSamples())
+	}
+	return n
+}
+
+// rewriteSamples passes every sample of containers through rewrite, in
+// place of the container in the slice. Containers whose series all come back
+// unchanged are kept; the others are replaced by a copy, since k6 hands the
+// same containers to every output.
+func rewriteSamples(
+	containers []metrics.SampleContainer, rewrite func(metrics.Sample) metrics.Sample,
+) []metrics.SampleContainer {
+	for i, sc := range containers {
+		samples := sc.GetSamples()
+		var copied metrics.Samples
+		for j, s := range samples {
+			r := rewrite(s)
+			if copied == nil {
+				if r.TimeSeries == s.TimeSeries {
+					continue
+				}
+				copied = append(make(metrics.Samples, 0, len(samples)), samples[:j]...)
+			}
+			copied = append(copied, r)
+		}
+		if copied != nil {
+			containers[i] = copied
+		}
+	}
+	return containers
+}
+
+// splitBatch splits containers into batches of at most maxRows samples each.
+// Containers are kept whole unless one alone exceeds maxRows. maxRows <= 0
+// returns containers as a single batch.
+func splitBatch(containers []metrics.SampleContainer, maxRows int) [][]metrics.SampleContainer {
+	if maxRows <= 0 || countSamples(containers) <= maxRows {
+		return [][]metrics.SampleContainer{containers}
+	}
+
+	var (
+		batches [][]metrics.SampleContainer
+		batch   []metrics.SampleContainer
+		rows    int
+	)
+	for _, sc := range containers {
+		samples := sc.GetSamples()
+		for len(samples) > 0 {
+			if rows == maxRows {
+				batches = append(batches, batch)
+				batch, rows = nil, 0
+			}
+			if rows+len(samples) <= maxRows {
+				// Keep the original container when it fits
+				if len(samples) == len(sc.GetSamples()) {
+					batch = append(batch, sc)
+				} else {
+					batch = append(batch, sameOrigin(sc, samples))
+				}
+				rows += len(samples)
+				break
+			}
+			n := maxRows - rows
+			batch = append(batch, sameOrigin(sc, samples[:n]))
+			rows += n
+			samples = samples[n:]
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// halveBatch splits containers into two batches of about half the samples
+// each. It reports false when there are fewer than two samples to split.
+func halveBatch(containers []metrics.SampleContainer) ([2][]metrics.SampleContainer, bool) {
+	total := countSamples(containers)
+	if total < 2 {
+		return [2][]metrics.SampleContainer{}, false
+	}
+	batches := splitBatch(containers, (total+1)/2)
+	return [2][]metrics.SampleContainer{batches[0], batches[1]}, true
+}
+
+// splitTooLarge returns the halves of samples when err shows the server
+// rejected the batch as too large. A batch that cannot be halved further
+// fails like any other.
+func (o *Output) splitTooLarge(logger logrus.FieldLogger, err error, samples []metrics.SampleContainer) ([2][]metrics.SampleContainer, bool) {
+	if err == nil || classifyError(err) != errClassTooLarge {
+		return [2][]metrics.SampleContainer{}, false
+	}
+	halves, ok := halveBatch(samples)
+	if !ok {
+		return halves, false
+	}
+	o.batchSplits.Add(1)
+	logger.WithError(err).WithField("samples", countSamples(samples)).Warn("Batch rejected as too large, resending in halves")
+	return halves, true
+}
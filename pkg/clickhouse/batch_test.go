@@ -0,0 +1,136 @@
+package clickhouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// batchSizes returns the sample count of every batch.
+func batchSizes(batches [][]metrics.SampleContainer) []int {
+	sizes := make([]int, 0, len(batches))
+	for _, b := range batches {
+		sizes = append(sizes, countSamples(b))
+	}
+	return sizes
+}
+
+func TestSplitBatch(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("custom", metrics.Counter)
+	containers := func(sizes ...int) []metrics.SampleContainer {
+		var out []metrics.SampleContainer
+		for _, n := range sizes {
+			samples := make(metrics.Samples, n)
+			for i := range samples {
+				samples[i] = metrics.Sample{
+					TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet()},
+					Time:       time.Now(),
+				}
+			}
+			out = append(out, samples)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		sizes   []int
+		maxRows int
+		want    []int
+	}{
+		{name: "unlimited", sizes: []int{5, 5}, maxRows: 0, want: []int{10}},
+		{name: "fits", sizes: []int{5, 5}, maxRows: 10, want: []int{10}},
+		{name: "whole containers", sizes: []int{3, 3, 3}, maxRows: 6, want: []int{6, 3}},
+		{name: "oversized container", sizes: []int{7}, maxRows: 3, want: []int{3, 3, 1}},
+		{name: "mixed", sizes: []int{2, 5, 1}, maxRows: 4, want: []int{4, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, batchSizes(splitBatch(containers(tt.sizes...), tt.maxRows)))
+		})
+	}
+
+	halves, ok := halveBatch(containers(4, 3))
+	require.True(t, ok)
+	assert.Equal(t, []int{4, 3}, []int{countSamples(halves[0]), countSamples(halves[1])})
+
+	_, ok = halveBatch(containers(1))
+	assert.False(t, ok, "a single sample cannot be split")
+}
+
+func TestRewriteSamples(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("custom", metrics.Counter)
+	sample := func(name string) metrics.Sample {
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet().With("name", name)}}
+	}
+	untouched := metrics.Samples{sample("a"), sample("b")}
+	shared := metrics.Samples{sample("c"), sample("x")}
+
+	got := rewriteSamples([]metrics.SampleContainer{untouched, shared}, func(s metrics.Sample) metrics.Sample {
+		if name, _ := s.Tags.Get("name"); name == "x" {
+			s.Tags = s.Tags.With("name", "y")
+		}
+		return s
+	})
+
+	require.Len(t, got, 2)
+	assert.Equal(t, &untouched[0], &got[0].GetSamples()[0], "unchanged containers are kept")
+	name, _ := got[1].GetSamples()[1].Tags.Get("name")
+	assert.Equal(t, "y", name)
+	name, _ = shared[1].Tags.Get("name")
+	assert.Equal(t, "x", name, "containers shared with other outputs are not modified")
+}
+
+func TestOutput_MaxBatchRows(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"schemaMode":   "compatible",
+		"pushInterval": "1h",
+		"maxBatchRows": 4,
+	})
+	t.Cleanup(func() { require.NoError(t, o.Stop()) })
+
+	addStatusSamples(o, 10, 0)
+	o.flush()
+
+	assert.Len(t, fake.Rows(), 10)
+	fake.set(func(f *fakeDB) { assert.Equal(t, 3, f.commits) })
+}
+
+func TestOutput_SplitsTooLargeBatch(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"schemaMode":    "compatible",
+		"pushInterval":  "1h",
+		"retryAttempts": 2,
+		"retryDelay":    "1ms",
+		"retryMaxDelay": "1ms",
+	})
+	t.Cleanup(func() { require.NoError(t, o.Stop()) })
+
+	fake.set(func(f *fakeDB) { f.maxRows = 3 })
+	addStatusSamples(o, 10, 0)
+	o.flush()
+
+	// 10 -> 5+5 -> (3+2)+(3+2): every row is written exactly once
+	assert.Len(t, fake.Rows(), 10)
+	stats := o.GetErrorMetrics()
+	assert.Equal(t, uint64(3), stats.BatchSplits)
+	assert.Equal(t, uint64(10), stats.SamplesProcessed)
+	assert.Zero(t, stats.FlushFailures)
+	assert.Zero(t, stats.RetryAttempts, "a too-large batch is split, not retried")
+	assert.Zero(t, stats.BufferedSamples)
+}
@@ -3,6 +3,7 @@ package clickhouse
 import (
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"go.k6.io/k6/v2/metrics"
 )
@@ -20,6 +21,11 @@ const (
 	DropNewest DropPolicy = "newest"
 )
 
+// DropHandler receives the containers a SampleBuffer discards; expired is
+// true for containers evicted for exceeding the maximum age, false for
+// overflow drops.
+type DropHandler func(dropped []metrics.SampleContainer, expired bool)
+
 // SampleBuffer is a thread-safe ring buffer for storing metric samples
 // during ClickHouse connection failures. It supports configurable overflow
 // policies and provides metrics for monitoring buffer state.
@@ -31,9 +37,16 @@ type SampleBuffer struct {
 	count    int // Current number of items
 	capacity int
 	policy   DropPolicy
+	maxAge   time.Duration // 0 disables age-based eviction
+
+	// onDrop receives the containers discarded by overflow or eviction (nil
+	// when unset)
+	onDrop DropHandler
 
 	// Metrics (atomic for lock-free reads)
 	dropped atomic.Uint64 // Total samples dropped due to overflow
+	evicted atomic.Uint64 // Total samples evicted for exceeding maxAge
+	peak    atomic.Int64  // Highest count reached since creation or Reset
 }
 
 // NewSampleBuffer creates a new ring buffer with the specified capacity and overflow policy.
@@ -55,6 +68,26 @@ func NewSampleBuffer(capacity int, policy DropPolicy) *SampleBuffer {
 	}
 }
 
+// SetMaxAge enables age-based eviction: containers whose newest sample is
+// older than maxAge are discarded on the next Push or Pop, oldest first.
+// Samples replayed from a spill file are never evicted. 0 disables eviction.
+// Thread-safe.
+func (b *SampleBuffer) SetMaxAge(maxAge time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxAge = maxAge
+}
+
+// SetDropHandler installs fn to receive the containers discarded by
+// overflow or age eviction, so they can be kept elsewhere. fn is called
+// after the buffer's lock is released.
+// Thread-safe.
+func (b *SampleBuffer) SetDropHandler(fn DropHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onDrop = fn
+}
+
 // Push adds sample containers to the buffer.
 // Returns the number of samples dropped due to overflow.
 // Thread-safe.
@@ -64,9 +97,10 @@ func (b *SampleBuffer) Push(samples []metrics.SampleContainer) int {
 	}
 
 	b.mu.Lock()
-	defer b.mu.Unlock()
-
+	onDrop := b.onDrop
+	expired := b.evictExpiredLocked()
 	dropped := 0
+	var discarded []metrics.SampleContainer
 
 	for _, sample := range samples {
 		if b.count >= b.capacity {
@@ -74,12 +108,18 @@ func (b *SampleBuffer) Push(samples []metrics.SampleContainer) int {
 			switch b.policy {
 			case DropOldest:
 				// Remove oldest item to make room
+				if onDrop != nil {
+					discarded = append(discarded, b.items[b.head])
+				}
 				b.items[b.head] = nil // Help GC
 				b.head = (b.head + 1) % b.capacity
 				b.count--
 				dropped++
 			case DropNewest:
 				// Reject new sample
+				if onDrop != nil {
+					discarded = append(discarded, sample)
+				}
 				dropped++
 				continue
 			}
@@ -94,7 +134,19 @@ func (b *SampleBuffer) Push(samples []metrics.SampleContainer) int {
 	if dropped > 0 {
 		b.dropped.Add(uint64(dropped))
 	}
+	if int64(b.count) > b.peak.Load() {
+		b.peak.Store(int64(b.count)) // Only written under b.mu
+	}
+	b.mu.Unlock()
 
+	if onDrop != nil {
+		if len(expired) > 0 {
+			onDrop(expired, true)
+		}
+		if len(discarded) > 0 {
+			onDrop(discarded, false)
+		}
+	}
 	return dropped
 }
 
@@ -103,24 +155,108 @@ func (b *SampleBuffer) Push(samples []metrics.SampleContainer) int {
 // Thread-safe.
 func (b *SampleBuffer) PopAll() []metrics.SampleContainer {
 	b.mu.Lock()
-	defer b.mu.Unlock()
+	onDrop := b.onDrop
+	expired := b.evictExpiredLocked()
+	popped := b.popLocked(b.count)
+	b.mu.Unlock()
+
+	if onDrop != nil && len(expired) > 0 {
+		onDrop(expired, true)
+	}
+	return popped
+}
+
+// PopN removes and returns up to n of the oldest samples in FIFO order,
+// leaving the rest buffered. It lets a flush drain a backlog in bounded
+// chunks instead of all at once. Returns nil if the buffer is empty or
+// n <= 0.
+// Thread-safe.
+func (b *SampleBuffer) PopN(n int) []metrics.SampleContainer {
+	b.mu.Lock()
+	onDrop := b.onDrop
+	expired := b.evictExpiredLocked()
+	popped := b.popLocked(min(n, b.count))
+	b.mu.Unlock()
+
+	if onDrop != nil && len(expired) > 0 {
+		onDrop(expired, true)
+	}
+	return popped
+}
+
+// evictExpiredLocked drops expired containers from the head of the buffer.
+// Containers are buffered in arrival order, so eviction stops at the first
+// one still within maxAge, or replayed from a spill file. The evicted containers are returned when a drop
+// handler is installed. Caller must hold b.mu.
+func (b *SampleBuffer) evictExpiredLocked() []metrics.SampleContainer {
+	if b.maxAge <= 0 || b.count == 0 {
+		return nil
+	}
 
+	cutoff := time.Now().Add(-b.maxAge)
+	evicted := 0
+	var discarded []metrics.SampleContainer
+	for b.count > 0 && expiredContainer(b.items[b.head], cutoff) {
+		if b.onDrop != nil {
+			discarded = append(discarded, b.items[b.head])
+		}
+		b.items[b.head] = nil // Help GC
+		b.head = (b.head + 1) % b.capacity
+		b.count--
+		evicted++
+	}
 	if b.count == 0 {
+		b.head = 0
+		b.tail = 0
+	}
+	if evicted > 0 {
+		b.evicted.Add(uint64(evicted))
+	}
+	return discarded
+}
+
+// expiredContainer reports whether c is due for eviction: its newest sample
+// is before cutoff and it was not replayed from a spill file.
+func expiredContainer(c metrics.SampleContainer, cutoff time.Time) bool {
+	if _, ok := c.(replayedSamples); ok {
+		return false
+	}
+	return newestSampleTime(c).Before(cutoff)
+}
+
+// newestSampleTime returns the latest sample time in a container. An empty
+// container reports the zero time and is therefore always expired.
+func newestSampleTime(c metrics.SampleContainer) time.Time {
+	var newest time.Time
+	for _, s := range c.GetSamples() {
+		if s.Time.After(newest) {
+			newest = s.Time
+		}
+	}
+	return newest
+}
+
+// popLocked removes the n oldest items. Caller must hold b.mu and ensure
+// n <= b.count.
+func (b *SampleBuffer) popLocked(n int) []metrics.SampleContainer {
+	if n <= 0 {
 		return nil
 	}
 
-	// Extract all items in FIFO order
-	result := make([]metrics.SampleContainer, b.count)
-	for i := 0; i < b.count; i++ {
+	result := make([]metrics.SampleContainer, n)
+	for i := range n {
 		idx := (b.head + i) % b.capacity
 		result[i] = b.items[idx]
 		b.items[idx] = nil // Help GC
 	}
+	b.head = (b.head + n) % b.capacity
+	b.count -= n
 
-	// Reset buffer state
-	b.head = 0
-	b.tail = 0
-	b.count = 0
+	// Rewind an emptied buffer so the next Push starts at index 0
+	if b.count == 0 {
+		b.head = 0
+		b.tail = 0
+	}
 
 	return result
 }
@@ -144,6 +280,28 @@ func (b *SampleBuffer) DroppedCount() uint64 {
 	return b.dropped.Load()
 }
 
+// EvictedCount returns the total number of samples evicted for exceeding the
+// maximum age (see SetMaxAge).
+// Thread-safe and lock-free.
+func (b *SampleBuffer) EvictedCount() uint64 {
+	return b.evicted.Load()
+}
+
+// HighWatermark returns the highest number of items held at once since the
+// buffer was created or Reset. A value close to Capacity means an outage
+// nearly exhausted the buffer even if nothing was dropped.
+// Thread-safe and lock-free.
+func (b *SampleBuffer) HighWatermark() int {
+	return int(b.peak.Load())
+}
+
+// FillPercent returns the current occupancy as a percentage of Capacity
+// (0-100).
+// Thread-safe.
+func (b *SampleBuffer) FillPercent() float64 {
+	return float64(b.Len()) * 100 / float64(b.capacity)
+}
+
 // Reset clears the buffer and resets all counters.
 // Thread-safe.
 func (b *SampleBuffer) Reset() {
@@ -157,4 +315,6 @@ func (b *SampleBuffer) Reset() {
 	b.tail = 0
 	b.count = 0
 	b.dropped.Store(0)
+	b.evicted.Store(0)
+	b.peak.Store(0)
 }
@@ -3,6 +3,7 @@ package clickhouse
 import (
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -257,3 +258,181 @@ func TestSampleBuffer_WrapAround(t *testing.T) {
 	assert.Equal(t, float64(4), result[0].GetSamples()[0].Value)
 	assert.Equal(t, float64(5), result[1].GetSamples()[0].Value)
 }
+
+func TestSampleBuffer_PopN(t *testing.T) {
+	t.Parallel()
+
+	values := func(containers []metrics.SampleContainer) []float64 {
+		out := make([]float64, 0, len(containers))
+		for _, c := range containers {
+			out = append(out, c.GetSamples()[0].Value)
+		}
+		return out
+	}
+
+	t.Run("drains in FIFO chunks", func(t *testing.T) {
+		t.Parallel()
+		buf := NewSampleBuffer(5, DropOldest)
+		buf.Push([]metrics.SampleContainer{
+			newMockContainer(1), newMockContainer(2), newMockContainer(3), newMockContainer(4),
+		})
+
+		assert.Equal(t, []float64{1, 2}, values(buf.PopN(2)))
+		assert.Equal(t, 2, buf.Len())
+		assert.Equal(t, []float64{3, 4}, values(buf.PopN(10)), "n larger than the buffer returns the rest")
+		assert.Nil(t, buf.PopN(1))
+	})
+
+	t.Run("non-positive n", func(t *testing.T) {
+		t.Parallel()
+		buf := NewSampleBuffer(5, DropOldest)
+		buf.Push([]metrics.SampleContainer{newMockContainer(1)})
+
+		assert.Nil(t, buf.PopN(0))
+		assert.Nil(t, buf.PopN(-1))
+		assert.Equal(t, 1, buf.Len())
+	})
+
+	t.Run("interleaves with pushes across wrap-around", func(t *testing.T) {
+		t.Parallel()
+		buf := NewSampleBuffer(3, DropOldest)
+		buf.Push([]metrics.SampleContainer{newMockContainer(1), newMockContainer(2), newMockContainer(3)})
+
+		assert.Equal(t, []float64{1, 2}, values(buf.PopN(2)))
+		buf.Push([]metrics.SampleContainer{newMockContainer(4), newMockContainer(5)})
+		assert.Equal(t, 3, buf.Len())
+
+		// Full again: overflow still drops the oldest
+		buf.Push([]metrics.SampleContainer{newMockContainer(6)})
+		assert.Equal(t, []float64{4}, values(buf.PopN(1)))
+		assert.Equal(t, []float64{5, 6}, values(buf.PopAll()))
+	})
+}
+
+func TestSampleBuffer_Occupancy(t *testing.T) {
+	t.Parallel()
+
+	buf := NewSampleBuffer(4, DropOldest)
+	assert.Zero(t, buf.HighWatermark())
+	assert.InDelta(t, 0.0, buf.FillPercent(), 1e-9)
+
+	buf.Push([]metrics.SampleContainer{newMockContainer(1), newMockContainer(2), newMockContainer(3)})
+	assert.Equal(t, 3, buf.HighWatermark())
+	assert.InDelta(t, 75.0, buf.FillPercent(), 1e-9)
+
+	// Draining lowers the fill level but keeps the peak
+	buf.PopN(2)
+	assert.Equal(t, 3, buf.HighWatermark())
+	assert.InDelta(t, 25.0, buf.FillPercent(), 1e-9)
+
+	// Overflow caps the peak at capacity
+	buf.Push([]metrics.SampleContainer{
+		newMockContainer(4), newMockContainer(5), newMockContainer(6), newMockContainer(7), newMockContainer(8),
+	})
+	assert.Equal(t, 4, buf.HighWatermark())
+	assert.InDelta(t, 100.0, buf.FillPercent(), 1e-9)
+
+	buf.Reset()
+	assert.Zero(t, buf.HighWatermark())
+}
+
+func TestSampleBuffer_MaxAge(t *testing.T) {
+	t.Parallel()
+
+	container := func(age time.Duration, value float64) metrics.SampleContainer {
+		return metrics.Sample{Time: time.Now().Add(-age), Value: value}
+	}
+
+	t.Run("evicts stale containers oldest first", func(t *testing.T) {
+		t.Parallel()
+		buf := NewSampleBuffer(10, DropOldest)
+		buf.SetMaxAge(10 * time.Minute)
+		buf.Push([]metrics.SampleContainer{
+			container(20*time.Minute, 1),
+			container(15*time.Minute, 2),
+			container(time.Minute, 3),
+		})
+
+		result := buf.PopAll()
+		require.Len(t, result, 1)
+		assert.Equal(t, float64(3), result[0].GetSamples()[0].Value)
+		assert.Equal(t, uint64(2), buf.EvictedCount())
+		assert.Zero(t, buf.DroppedCount(), "evictions are not overflow drops")
+	})
+
+	t.Run("push evicts before applying the overflow policy", func(t *testing.T) {
+		t.Parallel()
+		buf := NewSampleBuffer(2, DropNewest)
+		buf.SetMaxAge(time.Minute)
+		buf.Push([]metrics.SampleContainer{container(time.Hour, 1), container(time.Hour, 2)})
+
+		// The stale containers would still be buffered without eviction,
+		// making DropNewest reject the fresh one
+		dropped := buf.Push([]metrics.SampleContainer{container(0, 3)})
+		assert.Zero(t, dropped)
+		assert.Equal(t, uint64(2), buf.EvictedCount())
+		assert.Equal(t, 1, buf.Len())
+	})
+
+	t.Run("spill replays are kept", func(t *testing.T) {
+		t.Parallel()
+		buf := NewSampleBuffer(10, DropOldest)
+		buf.SetMaxAge(time.Minute)
+		replayed := replayedSamples{{Time: time.Now().Add(-time.Hour), Value: 1}}
+		buf.Push([]metrics.SampleContainer{replayed, container(time.Hour, 2)})
+
+		// Eviction stops at the replayed container until it is popped
+		result := buf.PopAll()
+		require.Len(t, result, 2)
+		assert.Zero(t, buf.EvictedCount())
+
+		batches := splitBatch([]metrics.SampleContainer{append(replayed, replayed...)}, 1)
+		require.Len(t, batches, 2)
+		assert.IsType(t, replayedSamples{}, batches[1][0], "split replays stay exempt")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+		buf := NewSampleBuffer(10, DropOldest)
+		buf.Push([]metrics.SampleContainer{container(24*time.Hour, 1)})
+
+		assert.Len(t, buf.PopN(5), 1)
+		assert.Zero(t, buf.EvictedCount())
+	})
+}
+
+func TestSampleBuffer_DropHandler(t *testing.T) {
+	t.Parallel()
+
+	type drop struct {
+		values  []float64
+		expired bool
+	}
+	var drops []drop
+	buf := NewSampleBuffer(2, DropOldest)
+	buf.SetMaxAge(time.Minute)
+	buf.SetDropHandler(func(dropped []metrics.SampleContainer, expired bool) {
+		d := drop{expired: expired}
+		for _, c := range dropped {
+			d.values = append(d.values, c.GetSamples()[0].Value)
+		}
+		drops = append(drops, d)
+	})
+
+	fresh := func(value float64) metrics.SampleContainer { return metrics.Sample{Time: time.Now(), Value: value} }
+	stale := metrics.Sample{Time: time.Now().Add(-time.Hour), Value: 1}
+	buf.Push([]metrics.SampleContainer{stale, fresh(2)})
+	buf.Push([]metrics.SampleContainer{fresh(3), fresh(4)})
+
+	assert.Equal(t, []drop{
+		{values: []float64{1}, expired: true},
+		{values: []float64{2}},
+	}, drops)
+
+	dropNewest := NewSampleBuffer(1, DropNewest)
+	var rejected []metrics.SampleContainer
+	dropNewest.SetDropHandler(func(dropped []metrics.SampleContainer, _ bool) { rejected = append(rejected, dropped...) })
+	dropNewest.Push([]metrics.SampleContainer{newMockContainer(1), newMockContainer(2)})
+	require.Len(t, rejected, 1)
+	assert.Equal(t, float64(2), rejected[0].GetSamples()[0].Value)
+}
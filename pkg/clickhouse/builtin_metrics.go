@@ -0,0 +1,112 @@
+package clickhouse
+
+import (
+	"reflect"
+	"strings"
+
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+var _ output.WithBuiltinMetrics = (*Output)(nil)
+
+// builtinColumn flags the samples of builtin metrics with BuiltinColumn.
+const builtinColumn = "builtin"
+
+// builtinColumnDDL returns the definition of the builtin column, or "" when
+// disabled.
+func builtinColumnDDL(enabled bool) string {
+	if !enabled {
+		return ""
+	}
+	return ",\n\t\t\t" + builtinColumn + " Bool DEFAULT false"
+}
+
+// builtinMetricSet holds the builtin metrics of the run's registry, so their
+// samples are recognized by metric identity rather than by name. The value
+// marks the execution and volume metrics dropped by skipInternalMetrics. A
+// nil set (k6 did not pass its builtin metrics) falls back to
+// builtinMetricNames and internalMetricNames.
+type builtinMetricSet map[*metrics.Metric]bool
+
+// newBuiltinMetricSet collects every metric of b. The fields are walked by
+// reflection, so metrics k6 adds or renames later are included as well.
+func newBuiltinMetricSet(b *metrics.BuiltinMetrics) builtinMetricSet {
+	if b == nil {
+		return nil
+	}
+	set := make(builtinMetricSet)
+	v := reflect.ValueOf(b).Elem()
+	for i := range v.NumField() {
+		f := v.Field(i)
+		if !f.CanInterface() {
+			continue // unexported
+		}
+		if m, ok := f.Interface().(*metrics.Metric); ok && m != nil {
+			set[m] = false
+		}
+	}
+	for _, m := range []*metrics.Metric{b.VUs, b.VUsMax, b.Iterations, b.IterationDuration, b.DataSent, b.DataReceived} {
+		if m != nil {
+			set[m] = true
+		}
+	}
+	return set
+}
+
+// isBuiltinSample reports whether sample belongs to a metric emitted by k6 or
+// its browser module, which registers its metrics separately.
+func (s builtinMetricSet) isBuiltinSample(sample metrics.Sample) bool {
+	if s == nil {
+		return isBuiltinSample(sample)
+	}
+	if sample.Metric == nil {
+		return false
+	}
+	_, ok := s[sample.Metric]
+	return ok || strings.HasPrefix(sample.Metric.Name, "browser_")
+}
+
+// isInternalSample reports whether sample belongs to one of k6's execution
+// and volume metrics.
+func (s builtinMetricSet) isInternalSample(sample metrics.Sample) bool {
+	if s == nil {
+		return isInternalSample(sample)
+	}
+	return sample.Metric != nil && s[sample.Metric]
+}
+
+// isCustomSample reports whether sample belongs to a metric defined by the
+// test script.
+func (s builtinMetricSet) isCustomSample(sample metrics.Sample) bool {
+	return !s.isBuiltinSample(sample)
+}
+
+// sampleFilter returns the identity-based counterpart of the registered
+// skipInternalMetrics, builtinMetricsOnly or customMetricsOnly filter, if
+// name is one of them.
+func (s builtinMetricSet) sampleFilter(name string) (SampleFilter, bool) {
+	if s == nil {
+		return nil, false
+	}
+	switch name {
+	case FilterSkipInternalMetrics:
+		return SampleFilterFunc(func(sample metrics.Sample) bool { return !s.isInternalSample(sample) }), true
+	case FilterBuiltinMetricsOnly:
+		return SampleFilterFunc(s.isBuiltinSample), true
+	case FilterCustomMetricsOnly:
+		return SampleFilterFunc(s.isCustomSample), true
+	default:
+		return nil, false
+	}
+}
+
+// SetBuiltinMetrics records the builtin metrics of the run's registry for the
+// split routing preset, the builtin column, and the skipInternalMetrics,
+// builtinMetricsOnly and customMetricsOnly filters. k6 calls it before Start.
+func (o *Output) SetBuiltinMetrics(builtinMetrics *metrics.BuiltinMetrics) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.builtinMetrics = newBuiltinMetricSet(builtinMetrics)
+}
@@ -0,0 +1,124 @@
+package clickhouse
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestBuiltinMetricSet(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	builtin := metrics.RegisterBuiltinMetrics(registry)
+	set := newBuiltinMetricSet(builtin)
+	assert.Len(t, set, reflect.TypeFor[metrics.BuiltinMetrics]().NumField(), "every builtin metric")
+
+	sample := func(m *metrics.Metric) metrics.Sample {
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: m}}
+	}
+	assert.True(t, set.isBuiltinSample(sample(builtin.HTTPReqDuration)))
+	assert.True(t, set.isBuiltinSample(sample(builtin.DataSent)))
+	assert.True(t, set.isBuiltinSample(sample(registry.MustNewMetric("browser_web_vital_lcp", metrics.Trend))))
+	assert.False(t, set.isBuiltinSample(sample(registry.MustNewMetric("checkout_duration", metrics.Trend))))
+	assert.True(t, set.isCustomSample(sample(registry.MustNewMetric("checkout_duration", metrics.Trend))))
+	assert.False(t, set.isBuiltinSample(metrics.Sample{}))
+
+	// Another registry's metric of the same name is not this run's builtin
+	other := metrics.NewRegistry().MustNewMetric(metrics.VUsName, metrics.Gauge)
+	assert.False(t, set.isBuiltinSample(sample(other)))
+	assert.True(t, builtinMetricSet(nil).isBuiltinSample(sample(other)), "without the set, names decide")
+
+	assert.Nil(t, newBuiltinMetricSet(nil))
+	_, ok := builtinMetricSet(nil).sampleFilter(FilterBuiltinMetricsOnly)
+	assert.False(t, ok, "the registered filter applies")
+
+	// Execution and volume metrics are internal, matched by identity too
+	assert.True(t, set.isInternalSample(sample(builtin.Iterations)))
+	assert.True(t, set.isInternalSample(sample(builtin.DataReceived)))
+	assert.False(t, set.isInternalSample(sample(builtin.HTTPReqs)))
+	assert.False(t, set.isInternalSample(sample(other)))
+	assert.True(t, builtinMetricSet(nil).isInternalSample(sample(other)))
+	skip, ok := set.sampleFilter(FilterSkipInternalMetrics)
+	require.True(t, ok)
+	assert.False(t, skip.Keep(sample(builtin.VUs)))
+	assert.True(t, skip.Keep(sample(other)))
+}
+
+func TestOutput_SetBuiltinMetrics(t *testing.T) {
+	t.Parallel()
+
+	fake, o := newFakeOutput(t, output.Params{
+		JSONConfig: mustMarshalJSON(map[string]any{"sampleFilters": []string{FilterBuiltinMetricsOnly}}),
+	})
+
+	registry := metrics.NewRegistry()
+	builtin := metrics.RegisterBuiltinMetrics(registry)
+	o.SetBuiltinMetrics(builtin)
+	require.NoError(t, o.Start())
+	defer func() { require.NoError(t, o.Stop()) }()
+
+	now := time.Now()
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+		{TimeSeries: metrics.TimeSeries{Metric: builtin.Iterations}, Time: now, Value: 1},
+		{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("checkout_duration", metrics.Trend)}, Time: now, Value: 34},
+	}})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 1)
+	assert.Equal(t, metrics.IterationsName, rows[0][1])
+}
+
+func TestSchemas_BuiltinColumn(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.BuiltinColumn = true
+	for _, configure := range []func(Config) (SchemaImplementation, error){configureSimple, configureCompatible} {
+		impl, err := configure(cfg)
+		require.NoError(t, err)
+
+		fake, db := newFakeDB(t)
+		require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		assert.Regexp(t, `builtin\s+Bool DEFAULT false`, fake.DDL()[1], impl.Name)
+		assert.Contains(t, impl.Converter.(ColumnNamer).ColumnNames(), builtinColumn, impl.Name)
+	}
+}
+
+func TestOutput_BuiltinColumn(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []string{"simple", "compatible"} {
+		fake, o := newFakeOutput(t, output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{"schemaMode": mode, "builtinColumn": true, "pushInterval": "1h"}),
+		})
+		registry := metrics.NewRegistry()
+		builtin := metrics.RegisterBuiltinMetrics(registry)
+		o.SetBuiltinMetrics(builtin)
+		require.NoError(t, o.Start())
+
+		now := time.Now()
+		o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+			{TimeSeries: metrics.TimeSeries{Metric: builtin.HTTPReqs}, Time: now, Value: 1},
+			{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("checkout_duration", metrics.Trend)}, Time: now, Value: 34},
+			{TimeSeries: metrics.TimeSeries{Metric: metrics.NewRegistry().MustNewMetric(metrics.VUsName, metrics.Gauge)}, Time: now, Value: 2},
+		}})
+		o.flush()
+		require.NoError(t, o.Stop())
+
+		col := slices.Index(o.targets[0].columns, builtinColumn)
+		require.Positive(t, col, mode)
+		rows := fake.Rows()
+		require.Len(t, rows, 3, mode)
+		assert.Equal(t, []any{true, false, false}, []any{rows[0][col], rows[1][col], rows[2][col]},
+			"%s: another registry's vus is not this run's builtin", mode)
+	}
+}
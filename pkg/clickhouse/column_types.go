@@ -0,0 +1,88 @@
+package clickhouse
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// stringColumns maps the string columns of the compatible schema, including
+// the optional ones, to whether they are LowCardinality(String) by default.
+// Config.LowCardinalityColumns and Config.StringColumns switch them.
+var stringColumns = map[string]bool{
+	"metric":         true,
+	"testid":         true,
+	"release":        true,
+	"scenario":       true,
+	"version":        true,
+	"branch":         true,
+	"name":           false,
+	"method":         true,
+	"error_code":     true,
+	"rating":         true,
+	"resource_type":  true,
+	"ui_feature":     true,
+	"check_name":     false,
+	"group_name":     true,
+	"grpc_service":   true,
+	"ws_url":         false,
+	"ws_subprotocol": true,
+	"protocol":       true,
+	"error_name":     true,
+	"hostname":       true,
+}
+
+// validateColumnTypes checks the LowCardinalityColumns and StringColumns
+// entries.
+func (c Config) validateColumnTypes() error {
+	for _, list := range []struct {
+		key     string
+		columns []string
+	}{
+		{"lowCardinalityColumns", c.LowCardinalityColumns},
+		{"stringColumns", c.StringColumns},
+	} {
+		for _, column := range list.columns {
+			if _, ok := stringColumns[column]; !ok {
+				return fmt.Errorf("invalid %s: %q is not a string column of the compatible schema (valid: %s)",
+					list.key, column, strings.Join(slices.Sorted(maps.Keys(stringColumns)), ", "))
+			}
+		}
+	}
+	for _, column := range c.LowCardinalityColumns {
+		if slices.Contains(c.StringColumns, column) {
+			return fmt.Errorf("column %s is listed in both lowCardinalityColumns and stringColumns", column)
+		}
+	}
+	return nil
+}
+
+// stringType returns the type of the string column column: its default,
+// unless the lowCardinality or plainString option lists it.
+func (o compatibleOptions) stringType(column string) string {
+	lowCardinality := stringColumns[column]
+	switch {
+	case slices.Contains(o.lowCardinality, column):
+		lowCardinality = true
+	case slices.Contains(o.plainString, column):
+		lowCardinality = false
+	}
+	if lowCardinality {
+		return "LowCardinality(String)"
+	}
+	return "String"
+}
+
+// nullableDDL returns the type and default of a column of an optional tag:
+// typ with default def, or with the nullable option, typ made Nullable, whose
+// default is NULL. LowCardinality wraps Nullable, not the other way around.
+func (o compatibleOptions) nullableDDL(typ, def string) string {
+	if !o.nullable {
+		return typ + " DEFAULT " + def
+	}
+	if inner, ok := strings.CutPrefix(typ, "LowCardinality("); ok {
+		return "LowCardinality(Nullable(" + inner + ")"
+	}
+	return "Nullable(" + typ + ")"
+}
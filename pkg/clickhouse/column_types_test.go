@@ -0,0 +1,46 @@
+package clickhouse
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestConfig_ValidateColumnTypes(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.LowCardinalityColumns = []string{"name", "ws_url"}
+	cfg.StringColumns = []string{"testid"}
+	require.NoError(t, cfg.Validate())
+
+	cfg.StringColumns = []string{"status"}
+	assert.ErrorContains(t, cfg.Validate(), `invalid stringColumns: "status" is not a string column`)
+
+	cfg.StringColumns = []string{"name"}
+	assert.ErrorContains(t, cfg.Validate(), "listed in both")
+}
+
+func TestCompatibleSchema_ColumnTypes(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{
+		ConfigArgument: "localhost:9000?lowCardinalityColumns=name,ws_url&stringColumns=testid,scenario&wsColumns=true",
+	})
+	require.NoError(t, err)
+	impl, err := configureCompatible(cfg)
+	require.NoError(t, err)
+
+	fake, db := newFakeDB(t)
+	require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	ddl := fake.DDL()[1]
+	assert.Contains(t, ddl, "name              LowCardinality(String) DEFAULT '' CODEC(ZSTD(1)),")
+	assert.Contains(t, ddl, "ws_url            LowCardinality(String) DEFAULT '' CODEC(ZSTD(1)),")
+	assert.Contains(t, ddl, "testid            String DEFAULT '',")
+	assert.Contains(t, ddl, "scenario          String DEFAULT '',")
+	assert.Contains(t, ddl, "release           LowCardinality(String) DEFAULT '',", "other columns keep their type")
+	assert.Contains(t, ddl, "check_name        String DEFAULT '' CODEC(ZSTD(1)),")
+}
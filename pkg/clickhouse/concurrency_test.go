@@ -134,7 +134,7 @@ func TestConcurrentConvertToCompatible(t *testing.T) {
 			}
 
 			for range 100 {
-				cs, err := convertToCompatible(sample, 12345)
+				cs, err := convertToCompatible(sample, newCompatibleDefaults(12345))
 				if err != nil {
 					errors <- err
 					return
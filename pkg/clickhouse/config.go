@@ -1,13 +1,16 @@
 package clickhouse
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/url"
 	"os"
+	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -30,6 +33,10 @@ func isValidIdentifier(name string) bool {
 // MaxUint+1 wraps to 0, which retry-go interprets as INFINITE retry. See Validate().
 const maxRetryAttempts = 100
 
+// maxBlockBufferSize is the upper bound for Config.BlockBufferSize; the driver
+// stores it as a uint8.
+const maxBlockBufferSize = 255
+
 // TLSConfig holds TLS/SSL configuration options
 type TLSConfig struct {
 	// Enabled controls whether TLS is enabled
@@ -61,19 +68,105 @@ type TLSConfig struct {
 //
 // Default values:
 //   - Addr: "localhost:9000"
+//   - ShardAddrs: none
+//   - ShardBy: "none"
 //   - User: "default"
 //   - Password: "" (empty)
 //   - Database: "k6"
 //   - Table: "samples"
+//   - TableTemplate: "" (disabled)
 //   - PushInterval: 1s
+//   - AlignFlushes: false
 //   - SchemaMode: "simple"
+//   - MetricRouting: "none"
 //   - SkipSchemaCreation: false
+//   - SkipSchemaValidation: false
+//   - CreateDatabase: true
+//   - CreateTable: true
+//   - ConnMaxLifetime: 0 (driver default, 1h)
+//   - ConnMaxIdleTime: 0 (no idle limit)
+//   - KeepAlive: 0 (Go default, 15s)
+//   - BlockBufferSize: 0 (driver default, 2)
+//   - MaxCompressionBuffer: 0 (driver default, 10 MiB)
 //   - RetryAttempts: 3
 //   - RetryDelay: 100ms
 //   - RetryMaxDelay: 5s
+//   - ShutdownFlushRetries: nil (RetryAttempts)
+//   - ShutdownRetryBackoff: 0 (RetryDelay)
 //   - BufferEnabled: true
 //   - BufferMaxSamples: 10000
 //   - BufferDropPolicy: "oldest"
+//   - BufferMaxAge: 0 (no age limit)
+//   - SpillDir: "" (disabled)
+//   - DeadLetterDir: "" (disabled)
+//   - TypedExtraTags: false
+//   - TagStorage: "map"
+//   - KeepRawTags: false
+//   - HashTags: none
+//   - HashTagsLookupTable: "" (disabled)
+//   - SanitizeMetricNames: false
+//   - MetricNameMaxLength: 0 (no limit)
+//   - MaxTagsPerSample: 0 (no limit)
+//   - TestIDDefault: "default"
+//   - BranchDefault: "master"
+//   - BuildIDDefault: "timestamp"
+//   - SkipBuiltinInternalMetrics: false
+//   - IncludeScenarios: none (all scenarios)
+//   - ExcludeScenarios: none
+//   - MaxConvertErrorRate: 0 (disabled)
+//   - ConvertErrorAction: "log"
+//   - AbortFlushTimeout: 5s
+//   - Name: "" (unnamed)
+//   - InstanceName: Name
+//   - LogFile: "" (k6's logger)
+//   - MaxBatchRows: 0 (unlimited)
+//   - FlushOverlapPolicy: "queue"
+//   - MaxConcurrentFlushes: 2
+//   - SkipPing: false
+//   - MaxMemoryUsage: 0 (server setting)
+//   - MaxInsertThreads: 0 (server setting)
+//   - QueryPriority: 0 (no priority)
+//   - AsyncInsert: false
+//   - Role: "" (default roles)
+//   - AuditTable: "" (disabled)
+//   - SummaryFile: "" (disabled)
+//   - WebhookURL: "" (disabled)
+//   - WebhookFailures: 3
+//   - WebhookDroppedSamples: 1 (the first drop)
+//   - FallbackSink: "" (disabled)
+//   - WALDir: "" (disabled)
+//   - ExportDir: "" (disabled)
+//   - ExportFormat: "csv"
+//   - TracesEndpoint: "" (disabled)
+//   - GRPCColumns: false
+//   - WSColumns: false
+//   - ProtocolColumn: false
+//   - ErrorNameColumn: false
+//   - HostnameColumn: false
+//   - VUColumns: false
+//   - TraceIDColumn: false
+//   - SeriesIDColumn: false
+//   - SeriesTable: "series"
+//   - IngestedAtColumn: false
+//   - CounterMode: "raw"
+//   - RateBoolColumn: false
+//   - BuiltinColumn: false
+//   - TableEngine: "MergeTree"
+//   - PartitionBy: "time"
+//   - MetricTypeTTL: none (365 days for every type)
+//   - MaterializedColumns: none
+//   - LowCardinalityColumns: none
+//   - StringColumns: none
+//   - NullableColumns: false
+//   - LoadProfileTable: "" (disabled)
+//   - ThresholdsTable: "" (disabled)
+//   - EventsTable: "" (disabled)
+//   - BaselineView: "" (disabled)
+//   - BaselineTestID: "" (latest on BaselineBranch)
+//   - BaselineBranch: "main"
+//   - SchemaFollower: false
+//   - SchemaWaitTimeout: 1m
+//   - StrictConfig: true
 //
 // Configuration sources (in priority order):
 //  1. Environment variables (K6_CLICKHOUSE_*)
@@ -81,10 +174,24 @@ type TLSConfig struct {
 //  3. JSON config file (collectors.xk6-clickhouse, via --config)
 //  4. Default values
 type Config struct {
-	// Addr is the ClickHouse server address (host:port).
+	// Addr is the ClickHouse server address (host:port). ParseConfig adds the
+	// default native port, 9000 or 9440 with TLS, to a bare host.
 	// Env: K6_CLICKHOUSE_ADDR
 	Addr string
 
+	// ShardAddrs lists the addresses of further shards of the cluster Addr
+	// belongs to, for clusters without a Distributed table. With ShardBy set,
+	// Addr is shard 0 and ShardAddrs[i] shard i+1. Default: none
+	// Env: K6_CLICKHOUSE_SHARD_ADDRS
+	ShardAddrs []string
+
+	// ShardBy routes each sample to one shard of Addr and ShardAddrs by a
+	// hash: "testid" keeps a test run on one shard, "series" a time series
+	// (see SeriesID). Only the metric tables are sharded; the other tables
+	// live on Addr. Default: "none"
+	// Env: K6_CLICKHOUSE_SHARD_BY
+	ShardBy string
+
 	// User is the ClickHouse username.
 	// Env: K6_CLICKHOUSE_USER
 	User string
@@ -93,29 +200,115 @@ type Config struct {
 	// Env: K6_CLICKHOUSE_PASSWORD
 	Password string
 
-	// Database is the database name to store metrics.
+	// Database is the database name to store metrics. It may contain the
+	// {testid} and {date} placeholders to write each run to its own database.
 	// Env: K6_CLICKHOUSE_DB
 	Database string
 
-	// Table is the table name to store metrics.
+	// Table is the table name to store metrics. It accepts the same
+	// placeholders as Database.
 	// Env: K6_CLICKHOUSE_TABLE
 	Table string
 
-	// PushInterval is how often to flush metrics to ClickHouse.
-	// Env: K6_CLICKHOUSE_PUSH_INTERVAL (parsed as duration, e.g. "1s")
+	// TableTemplate, when set, replaces Table with a name that may change
+	// during the run: {yyyyMMdd} and {yyyyMM} expand to the current UTC day
+	// or month at every flush, and a new table is created when the name
+	// changes. {testid} and {date} expand once, as in Table. Default: ""
+	// (Table is used)
+	// Env: K6_CLICKHOUSE_TABLE_TEMPLATE
+	TableTemplate string
+
+	// PushInterval is how often to flush metrics to ClickHouse. Intervals
+	// below one second are supported down to 100ms; Start warns about them
+	// unless AsyncInsert is set, as every flush creates a part to merge.
+	// Env: K6_CLICKHOUSE_PUSH_INTERVAL (parsed as duration, e.g. "1s", or
+	// as a bare number: seconds below 100, e.g. "5", and milliseconds from
+	// 100 on, e.g. "5000", as in k6's other outputs)
 	PushInterval time.Duration
 
+	// AlignFlushes runs flushes on wall-clock multiples of PushInterval
+	// (with 5s: at :00, :05, :10, ...) instead of every PushInterval from
+	// start, so the batches of several instances line up. Default: false
+	// Env: K6_CLICKHOUSE_ALIGN_FLUSHES
+	AlignFlushes bool
+
 	// SchemaMode determines the table schema ("simple" or "compatible").
+	// A comma-separated list ("simple,compatible") writes every sample to each
+	// schema: the first writes to Table, the others to Table_<mode>.
 	// Env: K6_CLICKHOUSE_SCHEMA_MODE
 	SchemaMode string
 
+	// MetricRouting selects a routing preset: "none" (default) writes every
+	// sample to the SchemaMode table(s); "split" writes k6 builtin metrics to a
+	// typed Table_builtin (compatible schema) and custom metrics to a map-based
+	// Table_custom (simple schema), ignoring SchemaMode.
+	// Env: K6_CLICKHOUSE_METRIC_ROUTING
+	MetricRouting string
+
+	// SchemaFiles lists JSON or YAML schema definition files. Each
+	// registers a schema under its name at config parsing, for use in
+	// SchemaMode (see SchemaDefinition). Default: none
+	// Env: K6_CLICKHOUSE_SCHEMA_FILES
+	SchemaFiles []string
+
 	// SkipSchemaCreation disables automatic database and table creation.
+	// When true, it overrides CreateDatabase and CreateTable.
 	// Env: K6_CLICKHOUSE_SKIP_SCHEMA_CREATION (parsed as bool, e.g. "true"/"1" to skip)
 	SkipSchemaCreation bool
 
+	// SkipSchemaValidation disables the check, at Start, that an existing
+	// table the output does not create matches its schema (columns, types,
+	// and engine). Default: false
+	// Env: K6_CLICKHOUSE_SKIP_SCHEMA_VALIDATION
+	SkipSchemaValidation bool
+
+	// CreateDatabase runs CREATE DATABASE IF NOT EXISTS at Start. Disable it
+	// when the user may create tables in an existing database but not
+	// databases. Default: true
+	// Env: K6_CLICKHOUSE_CREATE_DATABASE
+	CreateDatabase bool
+
+	// CreateTable runs CREATE TABLE IF NOT EXISTS for every destination table
+	// at Start. Default: true
+	// Env: K6_CLICKHOUSE_CREATE_TABLE
+	CreateTable bool
+
 	// TLS holds TLS/SSL configuration
 	TLS TLSConfig
 
+	// Connection lifetime settings for long-running tests behind proxies and
+	// load balancers that silently drop idle TCP connections
+
+	// ConnMaxLifetime is the maximum time a pooled connection is reused before
+	// it is closed and re-dialed. 0 keeps the driver default (1h).
+	// Env: K6_CLICKHOUSE_CONN_MAX_LIFETIME
+	ConnMaxLifetime time.Duration
+
+	// ConnMaxIdleTime is the maximum time a pooled connection may sit idle
+	// before it is closed. Set it below the idle timeout of any load balancer
+	// in the path. 0 means idle connections are not closed.
+	// Env: K6_CLICKHOUSE_CONN_MAX_IDLE_TIME
+	ConnMaxIdleTime time.Duration
+
+	// KeepAlive is the TCP keep-alive probe interval for new connections.
+	// 0 uses the Go default (15s); a negative value disables keep-alive probes.
+	// Env: K6_CLICKHOUSE_KEEP_ALIVE
+	KeepAlive time.Duration
+
+	// Client-side driver buffer tuning for very large batches
+
+	// BlockBufferSize is the number of column blocks the driver buffers while
+	// encoding a batch (1-255). Higher values trade memory for throughput.
+	// 0 keeps the driver default (2).
+	// Env: K6_CLICKHOUSE_BLOCK_BUFFER_SIZE
+	BlockBufferSize int
+
+	// MaxCompressionBuffer is the size in bytes of the driver's compression
+	// buffer before a block is flushed to the connection.
+	// 0 keeps the driver default (10 MiB).
+	// Env: K6_CLICKHOUSE_MAX_COMPRESSION_BUFFER
+	MaxCompressionBuffer int
+
 	// Retry settings for handling transient connection failures
 
 	// RetryAttempts is the maximum number of retry attempts per flush operation.
@@ -132,6 +325,20 @@ type Config struct {
 	// Env: K6_CLICKHOUSE_RETRY_MAX_DELAY
 	RetryMaxDelay time.Duration
 
+	// ShutdownFlushRetries is the maximum number of retry attempts of the
+	// batches flushed and drained by Stop(), replacing RetryAttempts once
+	// shutdown has begun; nil keeps RetryAttempts. The drain stays bounded by
+	// its 30s deadline. Default: nil
+	// Env: K6_CLICKHOUSE_SHUTDOWN_FLUSH_RETRIES
+	ShutdownFlushRetries *uint
+
+	// ShutdownRetryBackoff is the initial delay between the retries of
+	// Stop(), doubling per attempt up to RetryMaxDelay (or
+	// ShutdownRetryBackoff itself when larger); 0 keeps RetryDelay.
+	// Default: 0
+	// Env: K6_CLICKHOUSE_SHUTDOWN_RETRY_BACKOFF
+	ShutdownRetryBackoff time.Duration
+
 	// Buffer settings for handling extended outages
 
 	// BufferEnabled enables in-memory buffering of samples during connection failures.
@@ -151,6 +358,576 @@ type Config struct {
 	// Default: "oldest"
 	// Env: K6_CLICKHOUSE_BUFFER_DROP_POLICY
 	BufferDropPolicy string
+
+	// BufferMaxAge evicts buffered sample containers whose newest sample is
+	// older than this, so a prolonged outage keeps fresh data instead of
+	// replaying stale samples. 0 disables age-based eviction. Default: 0
+	// Env: K6_CLICKHOUSE_BUFFER_MAX_AGE
+	BufferMaxAge time.Duration
+
+	// SpillDir is a directory receiving failover buffer contents that are
+	// still undelivered when Stop() finishes (ClickHouse unreachable), as
+	// NDJSON spill files, instead of discarding them. "" disables spilling.
+	// Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_SPILL_DIR
+	SpillDir string
+
+	// DeadLetterDir is a directory receiving samples rejected for data
+	// reasons (conversion errors, values the server refuses) as NDJSON
+	// dead-letter files, one per table and run. "" disables the sink.
+	// Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_DEAD_LETTER_DIR
+	DeadLetterDir string
+
+	// Tag storage settings for the compatible schema
+
+	// TypedExtraTags moves extra tags whose values are numeric or boolean
+	// ("true"/"false") out of extra_tags into extra_tags_num
+	// Map(LowCardinality(String), Float64) and extra_tags_bool
+	// Map(LowCardinality(String), Bool) columns, so they can be aggregated
+	// without casts. Compatible schema only. Default: false
+	// Env: K6_CLICKHOUSE_TYPED_EXTRA_TAGS
+	TypedExtraTags bool
+
+	// TagStorage selects the column type of the tags (simple) and extra_tags
+	// (compatible) columns: "map" for Map(String, String), "json" for the
+	// native JSON type (ClickHouse 24.8+, checked at Start), or "string" for a
+	// JSON-encoded String. Default: "map"
+	// Env: K6_CLICKHOUSE_TAG_STORAGE
+	TagStorage string
+
+	// KeepRawTags adds a raw_tags column holding the sample's complete tag set
+	// as k6 emitted it, before any tag is moved into its own column, so tag
+	// mapping issues can be debugged without re-running the test. It has the
+	// column type of extra_tags. Compatible schema only. Default: false
+	// Env: K6_CLICKHOUSE_KEEP_RAW_TAGS
+	KeepRawTags bool
+
+	// Tag hashing settings for high-cardinality tags
+
+	// HashTags lists tags whose values are replaced by their xxHash64 (as a
+	// decimal string) before conversion, taming cardinality while keeping
+	// distinct counts intact. URL and env accept a comma-separated list.
+	// Env: K6_CLICKHOUSE_HASH_TAGS
+	HashTags []string
+
+	// HashTagsLookupTable, when set, names a side table in Database that
+	// receives one (tag, hash, value) row per distinct hashed value, so hashes
+	// can be mapped back to the originals. Empty disables the lookup table.
+	// Env: K6_CLICKHOUSE_HASH_TAGS_LOOKUP_TABLE
+	HashTagsLookupTable string
+
+	// SanitizeMetricNames replaces every character of a metric name outside
+	// A-Z, a-z, 0-9, and _ with _ before insert, so custom metric names with
+	// spaces, punctuation, or non-ASCII letters are safe to use unquoted in
+	// SQL and dashboards. Names that differ only in those characters merge.
+	// Default: false
+	// Env: K6_CLICKHOUSE_SANITIZE_METRIC_NAMES
+	SanitizeMetricNames bool
+
+	// MetricNameMaxLength truncates longer metric names to this many bytes
+	// before insert; 0 keeps names whole. Default: 0
+	// Env: K6_CLICKHOUSE_METRIC_NAME_MAX_LENGTH
+	MetricNameMaxLength int
+
+	// MaxTagsPerSample caps the number of tags of a sample. The tags beyond
+	// the cap are collapsed into a single _overflow tag, keeping k6's system
+	// tags first, and the sample is counted in
+	// ErrorMetrics.TagOverflowSamples; 0 means no limit. Default: 0
+	// Env: K6_CLICKHOUSE_MAX_TAGS_PER_SAMPLE
+	MaxTagsPerSample int
+
+	// Fallbacks for the compatible schema's testid, branch, and build_id columns
+
+	// TestIDDefault is written to testid when neither testid nor test_run_id
+	// is tagged. "empty" writes '', "error" drops samples missing the tag.
+	// Default: "default"
+	// Env: K6_CLICKHOUSE_TESTID_DEFAULT
+	TestIDDefault string
+
+	// BranchDefault is written to branch when the tag is missing. "empty"
+	// writes '', "error" drops samples missing the tag. Default: "master"
+	// Env: K6_CLICKHOUSE_BRANCH_DEFAULT
+	BranchDefault string
+
+	// BuildIDDefault is written to build_id when the buildId tag is missing:
+	// "timestamp" (process start Unix time), "empty" (0), "error" (drop the
+	// sample), or a fixed number. Default: "timestamp"
+	// Env: K6_CLICKHOUSE_BUILD_ID_DEFAULT
+	BuildIDDefault string
+
+	// Metric filtering
+
+	// SkipBuiltinInternalMetrics drops k6's execution and volume metrics
+	// (vus, vus_max, iterations, iteration_duration, data_sent, data_received)
+	// before insertion, for users who only query protocol-level metrics.
+	// Default: false
+	// Env: K6_CLICKHOUSE_SKIP_BUILTIN_INTERNAL_METRICS
+	SkipBuiltinInternalMetrics bool
+
+	// IncludeScenarios, when set, writes only the samples of these
+	// scenarios (by their scenario tag); the other scenarios still run.
+	// Samples without a scenario tag are always written. Default: none
+	// Env: K6_CLICKHOUSE_INCLUDE_SCENARIOS
+	IncludeScenarios []string
+
+	// ExcludeScenarios drops the samples of these scenarios, such as a
+	// warm-up or background load, before conversion. Default: none
+	// Env: K6_CLICKHOUSE_EXCLUDE_SCENARIOS
+	ExcludeScenarios []string
+
+	// SampleFilters lists registered sample filters (see
+	// RegisterSampleFilter) applied before conversion; a sample is written
+	// only when every filter keeps it. Built in: skipInternalMetrics,
+	// builtinMetricsOnly, customMetricsOnly. Default: none
+	// Env: K6_CLICKHOUSE_SAMPLE_FILTERS
+	SampleFilters []string
+
+	// TagTransformers lists registered tag transformers (see
+	// RegisterTagTransformer) that rewrite each sample's tags, in order,
+	// before conversion and tag hashing. Built in: stripURLQuery.
+	// Default: none
+	// Env: K6_CLICKHOUSE_TAG_TRANSFORMERS
+	TagTransformers []string
+
+	// Conversion error guard
+
+	// MaxConvertErrorRate is the highest tolerated share (0-1) of samples that
+	// fail conversion within one flush of at least 50 samples. Exceeding it
+	// triggers ConvertErrorAction. 0 disables the check. Default: 0
+	// Env: K6_CLICKHOUSE_MAX_CONVERT_ERROR_RATE
+	MaxConvertErrorRate float64
+
+	// ConvertErrorAction is what happens when MaxConvertErrorRate is exceeded:
+	// "log" (error log, keep writing), "stopOutput" (stop writing, keep the
+	// test running), or "abortTest" (abort the k6 test run). Default: "log"
+	// Env: K6_CLICKHOUSE_CONVERT_ERROR_ACTION
+	ConvertErrorAction string
+
+	// Interrupted run shutdown
+
+	// AbortFlushTimeout bounds the final flush and buffer drain when k6 stops
+	// an interrupted or aborted run (SIGINT/SIGTERM, test.abort()). Failed
+	// inserts are not retried in that window. Default: 5s
+	// Env: K6_CLICKHOUSE_ABORT_FLUSH_TIMEOUT
+	AbortFlushTimeout time.Duration
+
+	// Multiple outputs
+
+	// Name identifies this output when k6 runs several clickhouse outputs
+	// (-o xk6-clickhouse=A?name=a -o xk6-clickhouse=B?name=b). Environment
+	// variables K6_CLICKHOUSE_<NAME>_<OPTION> then override the shared
+	// K6_CLICKHOUSE_<OPTION> for this output only. Also the default
+	// InstanceName. Set via the "name" URL parameter only. Default: "" (unnamed)
+	Name string
+
+	// InstanceName labels this output in log lines ("instance" field) and in
+	// Description(), e.g. a load generator ID in distributed runs. Default:
+	// Name
+	// Env: K6_CLICKHOUSE_INSTANCE_NAME
+	InstanceName string
+
+	// LogFile routes this output's own log lines to a file, appended to,
+	// instead of k6's console, so verbose debugging does not interleave
+	// with the progress display. The level is k6's. Default: "" (k6's
+	// logger)
+	// Env: K6_CLICKHOUSE_LOG_FILE
+	LogFile string
+
+	// Batch splitting
+
+	// MaxBatchRows caps the samples sent in one INSERT. A larger flush (e.g.
+	// the failover buffer replayed after a stall) is split into several
+	// batches, each retried and buffered independently. 0 means unlimited.
+	// Batches the server rejects as too large are halved and retried
+	// regardless. Default: 0
+	// Env: K6_CLICKHOUSE_MAX_BATCH_ROWS
+	MaxBatchRows int
+
+	// Flush overlap
+
+	// FlushOverlapPolicy decides what happens when a flush is still running
+	// at the next PushInterval tick: "queue" (the next flush starts as soon
+	// as it finishes; missed ticks collapse into one), "skip" (the tick is
+	// dropped and its samples wait for the next one), or "concurrent" (up to
+	// MaxConcurrentFlushes flushes run at once). Default: "queue"
+	// Env: K6_CLICKHOUSE_FLUSH_OVERLAP_POLICY
+	FlushOverlapPolicy string
+
+	// MaxConcurrentFlushes caps the flushes in flight with
+	// FlushOverlapPolicy "concurrent". Default: 2
+	// Env: K6_CLICKHOUSE_MAX_CONCURRENT_FLUSHES
+	MaxConcurrentFlushes int
+
+	// Offline start
+
+	// SkipPing lets Start() succeed while ClickHouse is unreachable, for runs
+	// where the network path comes up mid-test. Connection, schema creation,
+	// and the permission probe are then retried on every flush, and samples
+	// wait in the failover buffer until they succeed. Server errors (auth,
+	// grants, ...) still fail Start(). Default: false
+	// Env: K6_CLICKHOUSE_SKIP_PING
+	SkipPing bool
+
+	// Session resource limits, sent as settings with every insert so that
+	// ingestion cannot starve other queries on a shared cluster
+
+	// MaxMemoryUsage caps the memory of one insert, in bytes
+	// (max_memory_usage). Default: 0 (server setting)
+	// Env: K6_CLICKHOUSE_MAX_MEMORY_USAGE
+	MaxMemoryUsage uint64
+
+	// MaxInsertThreads caps the threads processing one insert
+	// (max_insert_threads). Default: 0 (server setting)
+	// Env: K6_CLICKHOUSE_MAX_INSERT_THREADS
+	MaxInsertThreads uint
+
+	// QueryPriority is the priority of inserts relative to concurrent queries
+	// (priority); lower values take precedence and 0 means none. Default: 0
+	// Env: K6_CLICKHOUSE_PRIORITY
+	QueryPriority uint
+
+	// AsyncInsert sends inserts with async_insert=1 and
+	// wait_for_async_insert=1: the server buffers them and writes one part
+	// per batch of inserts instead of one per flush, while each flush still
+	// waits for its rows to be written. Recommended with a PushInterval
+	// below one second. Default: false
+	// Env: K6_CLICKHOUSE_ASYNC_INSERT
+	AsyncInsert bool
+
+	// Role is activated with SET ROLE on every new connection, for
+	// deployments that attach the INSERT grant to a non-default role.
+	// Ignored for a handle injected with WithDB. Default: "" (the user's
+	// default roles)
+	// Env: K6_CLICKHOUSE_ROLE
+	Role string
+
+	// AuditTable, when set, names a table in Database that receives one row
+	// per sent batch (query ID, row count, timestamp range, duration), for
+	// reconciling deliveries after network incidents. Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_AUDIT_TABLE
+	AuditTable string
+
+	// SummaryFile, when set, is the path of a handleSummary-style JSON file
+	// written at Stop() from the rows read back from ClickHouse, to confirm
+	// what landed. Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_SUMMARY_FILE
+	SummaryFile string
+
+	// WebhookURL, when set, receives a JSON POST when flushes keep failing,
+	// when samples start being dropped, and when delivery recovers, so
+	// unattended runs surface ingestion problems. Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_WEBHOOK_URL
+	WebhookURL string
+
+	// WebhookFailures is the number of consecutive failed flushes that
+	// triggers the webhook. Default: 3
+	// Env: K6_CLICKHOUSE_WEBHOOK_FAILURES
+	WebhookFailures uint
+
+	// WebhookDroppedSamples is the number of dropped samples that triggers
+	// the webhook, once per run. Default: 1 (the first drop)
+	// Env: K6_CLICKHOUSE_WEBHOOK_DROPPED_SAMPLES
+	WebhookDroppedSamples uint
+
+	// FallbackSink receives, as NDJSON, samples the output would otherwise
+	// lose after their retries failed: failover buffer overflow and age
+	// eviction, failures with buffering disabled, and samples not drained at
+	// Stop() (when no spill directory is set). "stdout" writes to standard
+	// output, any other value is a file path appended to. Default: ""
+	// (disabled)
+	// Env: K6_CLICKHOUSE_FALLBACK_SINK
+	FallbackSink string
+
+	// WALDir enables a write-ahead log: every batch is written to a segment
+	// file in this directory before it is sent and removed once it is
+	// committed, and segments left by a crashed run are replayed at the next
+	// start with their original insert_deduplication_token. Default: ""
+	// (disabled)
+	// Env: K6_CLICKHOUSE_WAL_DIR
+	WALDir string
+
+	// ExportDir receives batches that exhausted their retries as files in
+	// the target table's column layout (see ExportFormat), instead of holding
+	// them in the failover buffer, so they can be bulk-loaded later with
+	// clickhouse-client. An s3://bucket/prefix URL uploads the files to S3
+	// with the AWS default credential chain instead. Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_EXPORT_DIR
+	ExportDir string
+
+	// ExportFormat is the format of export files: "csv" (CSVWithNames) or
+	// "parquet" (loadable with INSERT ... FORMAT Parquet). Default: "csv"
+	// Env: K6_CLICKHOUSE_EXPORT_FORMAT
+	ExportFormat string
+
+	// TracesEndpoint is an OTLP/HTTP endpoint (e.g. http://localhost:4318)
+	// receiving OpenTelemetry spans for Start, schema creation, and every
+	// flush and insert. Embedders can pass their own provider with
+	// WithTracerProvider instead. Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_TRACES_ENDPOINT
+	TracesEndpoint string
+
+	// GRPCColumns adds grpc_service LowCardinality(String) and grpc_status
+	// Int8 columns, filled from the service and status tags of gRPC
+	// samples (grpc_* metrics, or any sample with a grpc_status tag), so
+	// status codes can be aggregated without reading extra_tags. Other
+	// samples get grpc_status -1. Compatible schema only. Default: false
+	// Env: K6_CLICKHOUSE_GRPC_COLUMNS
+	GRPCColumns bool
+
+	// WSColumns adds ws_url String and ws_subprotocol LowCardinality(String)
+	// columns, filled from the url and subproto tags of ws_* samples, so
+	// WebSocket sessions can be grouped without reading extra_tags. The
+	// handshake status stays in status. Compatible schema only.
+	// Default: false
+	// Env: K6_CLICKHOUSE_WS_COLUMNS
+	WSColumns bool
+
+	// ProtocolColumn adds a protocol LowCardinality(String) column holding
+	// the family of the metric: http, ws, grpc, browser, or custom, so
+	// cross-protocol dashboards can filter without matching metric names.
+	// Compatible schema only. Default: false
+	// Env: K6_CLICKHOUSE_PROTOCOL_COLUMN
+	ProtocolColumn bool
+
+	// ErrorNameColumn adds an error_name LowCardinality(String) column
+	// holding the k6 name of the numeric error_code tag (e.g. "dial_timeout"
+	// for 1211). Compatible schema only. Default: false
+	// Env: K6_CLICKHOUSE_ERROR_NAME_COLUMN
+	ErrorNameColumn bool
+
+	// HostnameColumn adds a hostname LowCardinality(String) column holding
+	// the host name of the machine running k6, or the sample's hostname tag
+	// when set, so the rows of one load generator of a distributed test can
+	// be told apart. Compatible schema only. Default: false
+	// Env: K6_CLICKHOUSE_HOSTNAME_COLUMN
+	HostnameColumn bool
+
+	// VUColumns adds vu UInt32 and iter UInt64 columns, filled from the vu
+	// and iter metadata k6 records when they are enabled in systemTags
+	// (or from tags of those names), so one misbehaving VU can be traced.
+	// Rows without them get 0. Compatible schema only. Default: false
+	// Env: K6_CLICKHOUSE_VU_COLUMNS
+	VUColumns bool
+
+	// TraceIDColumn adds a trace_id FixedString(32) column holding the
+	// W3C trace ID k6's tracing instrumentation records as trace_id
+	// metadata (or a tag of that name), so rows can be joined with the
+	// traces in Tempo or Jaeger. Rows without a valid 32-digit hex trace ID
+	// get an empty value. Compatible schema only. Default: false
+	// Env: K6_CLICKHOUSE_TRACE_ID_COLUMN
+	TraceIDColumn bool
+
+	// SeriesIDColumn adds a series_id UInt64 column holding the fingerprint
+	// of the sample's time series, a hash of its metric and sorted tags
+	// (see SeriesID), so series can be grouped and joined on one integer
+	// instead of the tag map. Default: false
+	// Env: K6_CLICKHOUSE_SERIES_ID_COLUMN
+	SeriesIDColumn bool
+
+	// SeriesTable names the dimension table of the star schema in
+	// Database: one (series_id, metric, metric_type, tags) row per distinct
+	// series, written the first time a run sees it, while the fact table
+	// holds only series_id, timestamp, and value. Star schema only.
+	// Default: "series"
+	// Env: K6_CLICKHOUSE_SERIES_TABLE
+	SeriesTable string
+
+	// IngestedAtColumn adds an ingested_at DateTime DEFAULT now() column to
+	// created tables. The output never writes it, so it records when the
+	// server received each row and pipeline latency is ingested_at minus
+	// timestamp. Default: false
+	// Env: K6_CLICKHOUSE_INGESTED_AT_COLUMN
+	IngestedAtColumn bool
+
+	// CounterMode selects how Counter samples are written: "raw" writes one
+	// row per sample; "delta" aggregates each series (metric and tags) per
+	// flush into one row whose value is the series' increase during the
+	// flush, and adds a delta Float64 column holding the same increase (0
+	// for other metric types). The simple and compatible schemas add the
+	// column. Default: "raw"
+	// Env: K6_CLICKHOUSE_COUNTER_MODE
+	CounterMode string
+
+	// RateBoolColumn adds a rate Bool column holding the outcome of Rate
+	// samples (value != 0), whose value is then written as 0 so the
+	// Float64 column compresses away; other metric types write false. The
+	// simple and compatible schemas add the column. Default: false
+	// Env: K6_CLICKHOUSE_RATE_BOOL_COLUMN
+	RateBoolColumn bool
+
+	// BuiltinColumn adds a builtin Bool column, true on the samples of
+	// metrics emitted by k6 or its browser module rather than defined by the
+	// script. The metrics k6 passes to the output are matched by identity,
+	// otherwise by name. The simple and compatible schemas add the column.
+	// Default: false
+	// Env: K6_CLICKHOUSE_BUILTIN_COLUMN
+	BuiltinColumn bool
+
+	// Table engine settings for the built-in schemas
+
+	// TableEngine is the engine of created tables: "MergeTree" or
+	// "ReplacingMergeTree". ReplacingMergeTree adds a row_version UInt64
+	// column, set from a per-insert sequence, and extends the sorting key
+	// with every column, so duplicate rows from replays and retried batches
+	// collapse in background merges. Default: "MergeTree"
+	// Env: K6_CLICKHOUSE_TABLE_ENGINE
+	TableEngine string
+
+	// PartitionBy is the partition key of created tables: "time" (the
+	// schema's month or day), "testid" (one partition per test run), or
+	// "testid_time" (per run and month or day). Partitioning by testid
+	// lets a run be removed instantly with DROP PARTITION.
+	// Default: "time"
+	// Env: K6_CLICKHOUSE_PARTITION_BY
+	PartitionBy string
+
+	// MetricTypeTTL sets how many days the compatible schema keeps samples
+	// of each metric type ("counter", "gauge", "rate", "trend"), e.g. raw
+	// trends for 30 days and counters for 730. Types not listed keep the
+	// default 365 days. Default: none
+	// Env: K6_CLICKHOUSE_METRIC_TYPE_TTL (e.g. "trend=30,counter=730")
+	MetricTypeTTL map[string]int
+
+	// MaterializedColumns adds a MATERIALIZED column per entry, named by the
+	// key and computed by ClickHouse from the SQL expression in the value,
+	// to the tables the simple and compatible schemas create, e.g.
+	// status_class: "intDiv(status, 100)". Expressions are not checked by
+	// the output; an invalid one fails table creation. Default: none
+	// Env: K6_CLICKHOUSE_MATERIALIZED_COLUMNS (e.g.
+	// "status_class=intDiv(status, 100);url_host=domain(name)")
+	MaterializedColumns map[string]string
+
+	// LowCardinalityColumns lists compatible-schema columns created as
+	// LowCardinality(String) instead of their default String (name,
+	// check_name, ws_url), for values with few distinct strings.
+	// Default: none
+	// Env: K6_CLICKHOUSE_LOW_CARDINALITY_COLUMNS
+	LowCardinalityColumns []string
+
+	// StringColumns lists compatible-schema columns created as plain String
+	// instead of LowCardinality(String), for values with too many distinct
+	// strings for a LowCardinality dictionary (e.g. testid with one id per
+	// run, or scenario names carrying ids). Default: none
+	// Env: K6_CLICKHOUSE_STRING_COLUMNS
+	StringColumns []string
+
+	// NullableColumns declares the compatible-schema columns of optional
+	// tags (scenario, version, name, method, status, expected_response,
+	// error_code, rating, resource_type, ui_feature, check_name, group_name,
+	// and grpc_status) as Nullable and writes NULL when the tag is absent,
+	// so "no status" is not confused with status 0. Default: false
+	// Env: K6_CLICKHOUSE_NULLABLE_COLUMNS
+	NullableColumns bool
+
+	// LoadProfileTable, when set, names a table in Database that receives
+	// one row per flush with the current vus and vus_max and the iterations
+	// completed since the previous flush, so dashboards can overlay the
+	// applied load on latency without scanning the samples.
+	// Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_LOAD_PROFILE_TABLE
+	LoadProfileTable string
+
+	// ThresholdsTable, when set, names a table in Database that receives
+	// the run's threshold expressions, one row per threshold, as soon as the
+	// output starts, so dashboards can draw SLO lines while the test runs.
+	// Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_THRESHOLDS_TABLE
+	ThresholdsTable string
+
+	// EventsTable, when set, names a table in Database that receives the
+	// run's lifecycle events: run_started, scenario_started and
+	// scenario_finished per scenario, and run_finished. A run_started row
+	// without a run_finished row marks a run that crashed.
+	// Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_EVENTS_TABLE
+	EventsTable string
+
+	// BaselineView, when set, names a view in Database that Start creates
+	// (or replaces) to compare the run's per-metric aggregates with those of
+	// a baseline run: BaselineTestID, or else the latest run on
+	// BaselineBranch. It reads the first table, which must use the simple or
+	// compatible schema, and needs a testid tag. Default: "" (disabled)
+	// Env: K6_CLICKHOUSE_BASELINE_VIEW
+	BaselineView string
+
+	// BaselineTestID is the testid of the run BaselineView compares with.
+	// Default: "" (the latest run on BaselineBranch)
+	// Env: K6_CLICKHOUSE_BASELINE_TESTID
+	BaselineTestID string
+
+	// BaselineBranch is the branch tag whose latest run BaselineView
+	// compares with when BaselineTestID is unset. Default: "main"
+	// Env: K6_CLICKHOUSE_BASELINE_BRANCH
+	BaselineBranch string
+
+	// SchemaFollower makes this instance run no DDL: Start waits up to
+	// SchemaWaitTimeout for the database and tables that the leader, an
+	// instance without SchemaFollower, creates. Set it on all but one instance
+	// of a distributed run so schema creation happens exactly once.
+	// Default: false
+	// Env: K6_CLICKHOUSE_SCHEMA_FOLLOWER
+	SchemaFollower bool
+
+	// SchemaWaitTimeout bounds how long a SchemaFollower instance waits for
+	// the leader's tables at Start.
+	// Default: 1m
+	// Env: K6_CLICKHOUSE_SCHEMA_WAIT_TIMEOUT
+	SchemaWaitTimeout time.Duration
+
+	// StrictConfig rejects unknown or misspelled JSON config keys and config
+	// argument parameters, which are usually typos. With it off they are
+	// only logged as a warning.
+	// Default: true
+	// Env: K6_CLICKHOUSE_STRICT_CONFIG
+	StrictConfig bool
+
+	// ignoredKeys lists the unknown keys and parameters ParseConfig let
+	// through with StrictConfig off, for New to warn about.
+	ignoredKeys error
+
+	// schemaDefinitions holds the schemas of SchemaFiles, loaded by
+	// ParseConfig and registered by New.
+	schemaDefinitions []SchemaDefinition
+
+	// builtinMetrics recognizes k6's builtin metrics for the builtin column;
+	// newTargets sets it for the schemas' Configure.
+	builtinMetrics builtinMetricSet
+}
+
+// envPrefix prefixes every environment variable read by the output.
+const envPrefix = "K6_CLICKHOUSE_"
+
+// getenv returns the environment variable K6_CLICKHOUSE_<key>. For a named
+// output, K6_CLICKHOUSE_<NAME>_<key> takes precedence so that two outputs in
+// the same run can be pointed at different destinations, while unscoped
+// variables still apply to both.
+func (c Config) getenv(key string) string {
+	return os.Getenv(c.envName(key))
+}
+
+// envName returns the name of the variable getenv reads for key: the
+// output's own K6_CLICKHOUSE_<NAME>_<key> when set, otherwise
+// K6_CLICKHOUSE_<key>. Errors name it so the right variable gets fixed.
+func (c Config) envName(key string) string {
+	if c.Name != "" {
+		if name := envPrefix + strings.ToUpper(c.Name) + "_" + key; os.Getenv(name) != "" {
+			return name
+		}
+	}
+	return envPrefix + key
+}
+
+// splitList splits a comma-separated URL/env value into its trimmed,
+// non-empty elements.
+func splitList(s string) []string {
+	var out []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
 }
 
 // validateFileReadable checks if a file exists and is readable
@@ -181,41 +958,180 @@ func validateFileReadable(path string) error {
 	return nil
 }
 
-// Validate checks the configuration for validity
+// minPushInterval is the smallest pushInterval. Each flush inserts a new
+// part per table, and more than a few per second outpace background merges
+// (TOO_MANY_PARTS) even with small batches.
+const minPushInterval = 100 * time.Millisecond
+
+// minUnitlessPushInterval is the threshold between the two meanings of a
+// pushInterval without a unit: smaller numbers are seconds, as users of
+// other tools write them ("pushInterval": 5), and larger ones milliseconds,
+// as in k6's other outputs ("pushInterval": 5000). No interval is both: the
+// seconds start at 100ms (0.1) and the milliseconds end below 100s.
+const minUnitlessPushInterval = 100
+
+// parsePushInterval parses a pushInterval value: a Go duration ("5s",
+// "500ms") or a bare number, read as seconds below minUnitlessPushInterval
+// and as milliseconds from it on ("5" and "5000" are both 5s).
+func parsePushInterval(value string) (time.Duration, error) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("%w (expected a duration such as \"5s\", "+
+				"or a number: seconds below %d, milliseconds from %d on)",
+				err, minUnitlessPushInterval, minUnitlessPushInterval)
+		}
+		return d, nil
+	}
+	if n < minUnitlessPushInterval {
+		return time.Duration(n * float64(time.Second)), nil
+	}
+	return time.Duration(n * float64(time.Millisecond)), nil
+}
+
+// jsonScalar returns a JSON string unquoted, a number in its exact decimal
+// form (json.Number, so integers above 2^53 keep their precision), and any
+// other JSON value as written. Missing and null values are "".
+func jsonScalar(raw json.RawMessage) string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return string(raw)
+	}
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return string(raw)
+	}
+}
+
+// Validate checks the configuration for validity. It reports every problem
+// it finds, joined with errors.Join, so a config can be fixed in one pass.
 //
 //nolint:gocyclo // complexity is acceptable for validation with many fields
 func (c Config) Validate() error {
+	var errs []error
+
 	if c.Addr == "" {
-		return fmt.Errorf("clickhouse address is required")
+		errs = append(errs, fmt.Errorf("clickhouse address is required"))
+	} else if err := validateAddr(c.Addr); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validateSharding(); err != nil {
+		errs = append(errs, err)
 	}
 
 	if c.User == "" {
-		return fmt.Errorf("clickhouse user is required")
+		errs = append(errs, fmt.Errorf("clickhouse user is required"))
 	}
 
 	if c.Database == "" {
-		return fmt.Errorf("clickhouse database name is required")
-	}
-
-	if !isValidIdentifier(c.Database) {
-		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", c.Database)
+		errs = append(errs, fmt.Errorf("clickhouse database name is required"))
+	} else if !isValidIdentifier(c.Database) {
+		errs = append(errs, fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", c.Database))
 	}
 
 	if c.Table == "" {
-		return fmt.Errorf("clickhouse table name is required")
+		errs = append(errs, fmt.Errorf("clickhouse table name is required"))
+	} else if !isValidIdentifier(c.Table) {
+		errs = append(errs, fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", c.Table))
 	}
 
-	if !isValidIdentifier(c.Table) {
-		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", c.Table)
+	if c.PushInterval <= 0 {
+		errs = append(errs, fmt.Errorf("push interval must be positive, got %v", c.PushInterval))
+	} else if c.PushInterval < minPushInterval {
+		errs = append(errs, fmt.Errorf("push interval must be at least %v, got %v (use %q or more, "+
+			"with asyncInsert=true for sub-second intervals)", minPushInterval, c.PushInterval, minPushInterval.String()))
 	}
 
-	if c.PushInterval <= 0 {
-		return fmt.Errorf("push interval must be positive, got %v", c.PushInterval)
+	// Validate schema mode(s) against registered implementations
+	errs = append(errs, c.validateSchemaModes())
+	errs = append(errs, c.validateRouting())
+	errs = append(errs, c.validateSampleFilters())
+	errs = append(errs, c.validateTagTransformers())
+	errs = append(errs, c.validateTagStorage())
+	errs = append(errs, c.validateTableEngine())
+	errs = append(errs, c.validatePartitionBy())
+	errs = append(errs, c.validateMetricTypeTTL())
+	errs = append(errs, c.validateMaterializedColumns())
+	errs = append(errs, c.validateCounterMode())
+	errs = append(errs, c.validateColumnTypes())
+	if c.MetricNameMaxLength < 0 {
+		errs = append(errs, fmt.Errorf("metricNameMaxLength must be non-negative, got %d", c.MetricNameMaxLength))
+	}
+	if c.MaxTagsPerSample < 0 {
+		errs = append(errs, fmt.Errorf("maxTagsPerSample must be non-negative, got %d", c.MaxTagsPerSample))
+	}
+	for _, tag := range c.HashTags {
+		if strings.TrimSpace(tag) == "" {
+			errs = append(errs, fmt.Errorf("invalid hashTags: tag names must not be empty"))
+			break
+		}
+	}
+	if _, err := compatibleDefaultsFromConfig(c, 0); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Name != "" && !isValidIdentifier(c.Name) {
+		errs = append(errs, fmt.Errorf("invalid name: %s (must be alphanumeric + underscore, max 63 chars)", c.Name))
+	}
+	if c.AbortFlushTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("abort flush timeout must be positive, got %v", c.AbortFlushTimeout))
+	}
+	if c.SchemaFollower && c.SchemaWaitTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("schema wait timeout must be positive, got %v", c.SchemaWaitTimeout))
+	}
+	errs = append(errs, c.validateConvertErrorGuard())
+	errs = append(errs, c.validateFlushOverlap())
+	if c.HashTagsLookupTable != "" {
+		if len(c.HashTags) == 0 {
+			errs = append(errs, fmt.Errorf("hashTagsLookupTable requires hashTags"))
+		}
+		if !isValidIdentifier(c.HashTagsLookupTable) {
+			errs = append(errs, fmt.Errorf("invalid hashTagsLookupTable: %s (must be alphanumeric + underscore, max 63 chars)", c.HashTagsLookupTable))
+		}
 	}
 
-	// Validate schema mode against registered implementations
-	if _, err := GetSchema(c.SchemaMode); err != nil {
-		return fmt.Errorf("invalid schemaMode: %s (available: %v)", c.SchemaMode, AvailableSchemas())
+	if slices.Contains(c.SchemaModes(), StarSchemaImpl.Name) {
+		if !isValidIdentifier(c.SeriesTable) {
+			errs = append(errs, fmt.Errorf("invalid seriesTable: %q (must be alphanumeric + underscore, max 63 chars)", c.SeriesTable))
+		} else if c.SeriesTable == c.Table {
+			errs = append(errs, fmt.Errorf("seriesTable %s must differ from table", c.SeriesTable))
+		}
+	}
+	if c.AuditTable != "" && !isValidIdentifier(c.AuditTable) {
+		errs = append(errs, fmt.Errorf("invalid auditTable: %s (must be alphanumeric + underscore, max 63 chars)", c.AuditTable))
+	}
+	if c.LoadProfileTable != "" && !isValidIdentifier(c.LoadProfileTable) {
+		errs = append(errs, fmt.Errorf("invalid loadProfileTable: %s (must be alphanumeric + underscore, max 63 chars)", c.LoadProfileTable))
+	}
+	if c.ThresholdsTable != "" && !isValidIdentifier(c.ThresholdsTable) {
+		errs = append(errs, fmt.Errorf("invalid thresholdsTable: %s (must be alphanumeric + underscore, max 63 chars)", c.ThresholdsTable))
+	}
+	if c.EventsTable != "" && !isValidIdentifier(c.EventsTable) {
+		errs = append(errs, fmt.Errorf("invalid eventsTable: %s (must be alphanumeric + underscore, max 63 chars)", c.EventsTable))
+	}
+	if c.BaselineView != "" {
+		if !isValidIdentifier(c.BaselineView) {
+			errs = append(errs, fmt.Errorf("invalid baselineView: %s (must be alphanumeric + underscore, max 63 chars)", c.BaselineView))
+		}
+		if c.BaselineTestID == "" && c.BaselineBranch == "" {
+			errs = append(errs, errors.New("baselineView needs baselineTestid or baselineBranch"))
+		}
+	}
+	errs = append(errs, c.validateWebhook())
+	errs = append(errs, c.validateTracing())
+	errs = append(errs, c.validateExportFormat())
+	if strings.Contains(c.ExportDir, "://") {
+		if _, _, err := parseS3URL(c.ExportDir); err != nil {
+			errs = append(errs, fmt.Errorf("invalid exportDir: %s (must be a local directory or an s3://bucket/prefix URL)", c.ExportDir))
+		}
 	}
 
 	// Validate TLS configuration
@@ -223,7 +1139,7 @@ func (c Config) Validate() error {
 		// Validate CA certificate file if specified
 		if c.TLS.CAFile != "" {
 			if err := validateFileReadable(c.TLS.CAFile); err != nil {
-				return fmt.Errorf("TLS CA file validation failed: %w", err)
+				errs = append(errs, fmt.Errorf("TLS CA file validation failed: %w", err))
 			}
 		}
 
@@ -233,64 +1149,111 @@ func (c Config) Validate() error {
 		hasKey := c.TLS.KeyFile != ""
 
 		if hasCert != hasKey {
-			return fmt.Errorf("TLS client certificate and key must be specified together")
+			errs = append(errs, fmt.Errorf("TLS client certificate and key must be specified together"))
 		}
 
 		if hasCert {
 			if err := validateFileReadable(c.TLS.CertFile); err != nil {
-				return fmt.Errorf("TLS client certificate file validation failed: %w", err)
+				errs = append(errs, fmt.Errorf("TLS client certificate file validation failed: %w", err))
 			}
 		}
 
 		if hasKey {
 			if err := validateFileReadable(c.TLS.KeyFile); err != nil {
-				return fmt.Errorf("TLS client key file validation failed: %w", err)
+				errs = append(errs, fmt.Errorf("TLS client key file validation failed: %w", err))
 			}
 		}
 	}
 
+	// Validate connection lifetime configuration
+	if c.ConnMaxLifetime < 0 {
+		errs = append(errs, fmt.Errorf("conn max lifetime must be non-negative, got %v", c.ConnMaxLifetime))
+	}
+	if c.ConnMaxIdleTime < 0 {
+		errs = append(errs, fmt.Errorf("conn max idle time must be non-negative, got %v", c.ConnMaxIdleTime))
+	}
+
+	// Validate driver buffer configuration
+	if c.BlockBufferSize < 0 || c.BlockBufferSize > maxBlockBufferSize {
+		errs = append(errs, fmt.Errorf("block buffer size must be between 0 and %d, got %d", maxBlockBufferSize, c.BlockBufferSize))
+	}
+	if c.MaxCompressionBuffer < 0 {
+		errs = append(errs, fmt.Errorf("max compression buffer must be non-negative, got %d", c.MaxCompressionBuffer))
+	}
+
 	// Validate retry configuration
 	if c.RetryAttempts > maxRetryAttempts {
-		return fmt.Errorf("retry attempts must not exceed %d, got %d", maxRetryAttempts, c.RetryAttempts)
+		errs = append(errs, fmt.Errorf("retry attempts must not exceed %d, got %d", maxRetryAttempts, c.RetryAttempts))
 	}
 	if c.RetryDelay < 0 {
-		return fmt.Errorf("retry delay must be non-negative, got %v", c.RetryDelay)
+		errs = append(errs, fmt.Errorf("retry delay must be non-negative, got %v", c.RetryDelay))
 	}
 	if c.RetryMaxDelay < 0 {
-		return fmt.Errorf("retry max delay must be non-negative, got %v", c.RetryMaxDelay)
+		errs = append(errs, fmt.Errorf("retry max delay must be non-negative, got %v", c.RetryMaxDelay))
 	}
 	// A zero max delay disables the exponential-backoff cap, letting per-retry
 	// delays grow without bound. Require a positive cap whenever retries with a
 	// non-zero base delay are enabled, so a misconfigured "0" can't stall flushes.
 	if c.RetryAttempts > 0 && c.RetryDelay > 0 && c.RetryMaxDelay == 0 {
-		return fmt.Errorf("retry max delay must be positive when retries are enabled (got 0); set retryMaxDelay to cap exponential backoff")
+		errs = append(errs, fmt.Errorf("retry max delay must be positive when retries are enabled (got 0); set retryMaxDelay to cap exponential backoff"))
 	}
 	if c.RetryMaxDelay > 0 && c.RetryDelay > c.RetryMaxDelay {
-		return fmt.Errorf("retry delay (%v) cannot exceed max delay (%v)", c.RetryDelay, c.RetryMaxDelay)
+		errs = append(errs, fmt.Errorf("retry delay (%v) cannot exceed max delay (%v)", c.RetryDelay, c.RetryMaxDelay))
+	}
+	if c.ShutdownFlushRetries != nil && *c.ShutdownFlushRetries > maxRetryAttempts {
+		errs = append(errs, fmt.Errorf("shutdown flush retries must not exceed %d, got %d",
+			maxRetryAttempts, *c.ShutdownFlushRetries))
+	}
+	if c.ShutdownRetryBackoff < 0 {
+		errs = append(errs, fmt.Errorf("shutdown retry backoff must be non-negative, got %v", c.ShutdownRetryBackoff))
 	}
 
 	// Validate buffer configuration
 	if c.BufferEnabled && c.BufferMaxSamples <= 0 {
-		return fmt.Errorf("buffer max samples must be positive when buffering is enabled, got %d", c.BufferMaxSamples)
+		errs = append(errs, fmt.Errorf("buffer max samples must be positive when buffering is enabled, got %d", c.BufferMaxSamples))
 	}
 	if c.BufferDropPolicy != "" && c.BufferDropPolicy != "oldest" && c.BufferDropPolicy != "newest" {
-		return fmt.Errorf("invalid buffer drop policy: %s (valid: oldest, newest)", c.BufferDropPolicy)
+		errs = append(errs, fmt.Errorf("invalid buffer drop policy: %s (valid: oldest, newest)", c.BufferDropPolicy))
+	}
+	if c.BufferMaxAge < 0 {
+		errs = append(errs, fmt.Errorf("buffer max age must be non-negative, got %v", c.BufferMaxAge))
 	}
 
-	return nil
+	// Validate batch splitting configuration
+	if c.MaxBatchRows < 0 {
+		errs = append(errs, fmt.Errorf("max batch rows must be non-negative, got %d", c.MaxBatchRows))
+	}
+
+	return errors.Join(errs...)
+}
+
+// createsDatabase reports whether Start creates the database. Schema
+// followers leave it to the leader.
+func (c Config) createsDatabase() bool {
+	return c.CreateDatabase && !c.SkipSchemaCreation && !c.SchemaFollower
+}
+
+// createsTable reports whether Start creates the destination tables. Schema
+// followers leave them to the leader.
+func (c Config) createsTable() bool {
+	return c.CreateTable && !c.SkipSchemaCreation && !c.SchemaFollower
 }
 
 // NewConfig returns a Config with default values
 func NewConfig() Config {
 	return Config{
 		Addr:               "localhost:9000",
+		ShardBy:            ShardByNone,
 		User:               "default",
 		Password:           "",
 		Database:           "k6",
 		Table:              "samples",
 		PushInterval:       1 * time.Second,
 		SchemaMode:         "simple",
+		MetricRouting:      RoutingNone,
 		SkipSchemaCreation: false,
+		CreateDatabase:     true,
+		CreateTable:        true,
 		TLS: TLSConfig{
 			Enabled:            false,
 			InsecureSkipVerify: false,
@@ -299,6 +1262,13 @@ func NewConfig() Config {
 			KeyFile:            "",
 			ServerName:         "",
 		},
+		// Connection lifetime defaults: 0 defers to the driver / Go defaults
+		ConnMaxLifetime: 0,
+		ConnMaxIdleTime: 0,
+		KeepAlive:       0,
+		// Driver buffer defaults: 0 defers to the driver defaults
+		BlockBufferSize:      0,
+		MaxCompressionBuffer: 0,
 		// Retry defaults: 3 attempts with exponential backoff (100ms, 200ms, 400ms...)
 		RetryAttempts: 3,
 		RetryDelay:    100 * time.Millisecond,
@@ -307,6 +1277,57 @@ func NewConfig() Config {
 		BufferEnabled:    true,
 		BufferMaxSamples: 10000,
 		BufferDropPolicy: "oldest",
+		// Tag storage defaults
+		TypedExtraTags: false,
+		TagStorage:     TagStorageMap,
+		// Compatible schema tag fallbacks
+		TestIDDefault:  "default",
+		BranchDefault:  "master",
+		BuildIDDefault: BuildIDDefaultTimestamp,
+		// Metric filter defaults
+		SkipBuiltinInternalMetrics: false,
+		// Conversion error guard defaults
+		MaxConvertErrorRate: 0,
+		ConvertErrorAction:  ConvertErrorActionLog,
+		// Interrupted run defaults
+		AbortFlushTimeout: 5 * time.Second,
+		// Flush overlap defaults
+		FlushOverlapPolicy:   FlushOverlapQueue,
+		MaxConcurrentFlushes: 2,
+		// Offline start defaults
+		SkipPing: false,
+		// Session resource limits defaults
+		MaxMemoryUsage:   0,
+		MaxInsertThreads: 0,
+		QueryPriority:    0,
+		// Role defaults
+		Role: "",
+		// Audit defaults
+		AuditTable: "",
+		// Summary defaults
+		SummaryFile: "",
+		// Webhook defaults
+		WebhookURL:            "",
+		WebhookFailures:       3,
+		WebhookDroppedSamples: 1,
+		// Fallback defaults
+		FallbackSink: "",
+		// Write-ahead log defaults
+		WALDir: "",
+		// Export defaults
+		ExportDir:    "",
+		ExportFormat: ExportFormatCSV,
+		// Tracing defaults
+		TracesEndpoint: "",
+		// Table engine defaults
+		TableEngine:       EngineMergeTree,
+		PartitionBy:       PartitionByTime,
+		SchemaWaitTimeout: time.Minute,
+		StrictConfig:      true,
+		SeriesTable:       "series",
+		BaselineBranch:    "main",
+		CounterMode:       CounterModeRaw,
+		KeepRawTags:       false,
 	}
 }
 
@@ -317,16 +1338,20 @@ func ParseConfig(params output.Params) (Config, error) {
 	cfg := NewConfig()
 
 	// Parse JSON config if provided
+	var unknown []error
 	if params.JSONConfig != nil {
 		jsonConf := struct {
-			Addr               string `json:"addr"`
-			User               string `json:"user"`
-			Password           string `json:"password"`
-			Database           string `json:"database"`
-			Table              string `json:"table"`
-			PushInterval       string `json:"pushInterval"`
-			SchemaMode         string `json:"schemaMode"`
-			SkipSchemaCreation *bool  `json:"skipSchemaCreation"` // Pointer to distinguish unset from false
+			Addr               string          `json:"addr"`
+			User               string          `json:"user"`
+			Password           string          `json:"password"`
+			Database           string          `json:"database"`
+			Table              string          `json:"table"`
+			PushInterval       json.RawMessage `json:"pushInterval"` // "5s", or a number (see parsePushInterval)
+			SchemaMode         string          `json:"schemaMode"`
+			MetricRouting      string          `json:"metricRouting"`
+			SkipSchemaCreation *bool           `json:"skipSchemaCreation"` // Pointer to distinguish unset from false
+			CreateDatabase     *bool           `json:"createDatabase"`
+			CreateTable        *bool           `json:"createTable"`
 			TLS                *struct {
 				Enabled            *bool  `json:"enabled"`            // Pointer to distinguish unset from false
 				InsecureSkipVerify *bool  `json:"insecureSkipVerify"` // Pointer to distinguish unset from false
@@ -335,19 +1360,128 @@ func ParseConfig(params output.Params) (Config, error) {
 				KeyFile            string `json:"keyFile"`
 				ServerName         string `json:"serverName"`
 			} `json:"tls"`
+			// Connection lifetime configuration
+			ConnMaxLifetime string `json:"connMaxLifetime"`
+			ConnMaxIdleTime string `json:"connMaxIdleTime"`
+			KeepAlive       string `json:"keepAlive"`
+			// Driver buffer configuration
+			BlockBufferSize      *int            `json:"blockBufferSize"`
+			MaxCompressionBuffer json.RawMessage `json:"maxCompressionBuffer"`
 			// Retry configuration
 			RetryAttempts *uint  `json:"retryAttempts"` // Pointer to distinguish unset from 0
 			RetryDelay    string `json:"retryDelay"`
 			RetryMaxDelay string `json:"retryMaxDelay"`
 			// Buffer configuration
-			BufferEnabled    *bool  `json:"bufferEnabled"`    // Pointer to distinguish unset from false
-			BufferMaxSamples *int   `json:"bufferMaxSamples"` // Pointer to distinguish unset from 0
-			BufferDropPolicy string `json:"bufferDropPolicy"`
+			BufferEnabled    *bool           `json:"bufferEnabled"` // Pointer to distinguish unset from false
+			BufferMaxSamples json.RawMessage `json:"bufferMaxSamples"`
+			BufferDropPolicy string          `json:"bufferDropPolicy"`
+			BufferMaxAge     string          `json:"bufferMaxAge"`
+			SpillDir         string          `json:"spillDir"`
+			DeadLetterDir    string          `json:"deadLetterDir"`
+			// Tag storage configuration
+			TypedExtraTags *bool  `json:"typedExtraTags"`
+			TagStorage     string `json:"tagStorage"`
+			// Tag hashing configuration
+			HashTags            []string `json:"hashTags"`
+			HashTagsLookupTable string   `json:"hashTagsLookupTable"`
+			// Tag defaults configuration
+			TestIDDefault  string `json:"testidDefault"`
+			BranchDefault  string `json:"branchDefault"`
+			BuildIDDefault string `json:"buildIdDefault"`
+			// Metric filter configuration
+			SkipBuiltinInternalMetrics *bool `json:"skipBuiltinInternalMetrics"`
+			// Conversion error guard configuration
+			MaxConvertErrorRate *float64 `json:"maxConvertErrorRate"`
+			ConvertErrorAction  string   `json:"convertErrorAction"`
+			// Interrupted run configuration
+			AbortFlushTimeout string `json:"abortFlushTimeout"`
+			// Instance configuration
+			InstanceName string `json:"instanceName"`
+			// Batch splitting configuration
+			MaxBatchRows json.RawMessage `json:"maxBatchRows"`
+			// Flush overlap configuration
+			FlushOverlapPolicy   string `json:"flushOverlapPolicy"`
+			MaxConcurrentFlushes *int   `json:"maxConcurrentFlushes"`
+			// Offline start configuration
+			SkipPing *bool `json:"skipPing"`
+			// Session resource limits configuration
+			MaxMemoryUsage   json.RawMessage `json:"maxMemoryUsage"`
+			MaxInsertThreads *uint           `json:"maxInsertThreads"`
+			QueryPriority    *uint           `json:"priority"`
+			// Role configuration
+			Role string `json:"role"`
+			// Audit configuration
+			AuditTable string `json:"auditTable"`
+			// Summary configuration
+			SummaryFile string `json:"summaryFile"`
+			// Webhook configuration
+			WebhookURL            string          `json:"webhookURL"`
+			WebhookFailures       *uint           `json:"webhookFailures"`
+			WebhookDroppedSamples json.RawMessage `json:"webhookDroppedSamples"`
+			// Fallback configuration
+			FallbackSink string `json:"fallbackSink"`
+			// Write-ahead log configuration
+			WALDir string `json:"walDir"`
+			// Export configuration
+			ExportDir    string `json:"exportDir"`
+			ExportFormat string `json:"exportFormat"`
+			// Tracing configuration
+			TracesEndpoint string `json:"tracesEndpoint"`
+			// Compatible schema protocol columns
+			GRPCColumns      *bool `json:"grpcColumns"`
+			WSColumns        *bool `json:"wsColumns"`
+			ProtocolColumn   *bool `json:"protocolColumn"`
+			ErrorNameColumn  *bool `json:"errorNameColumn"`
+			IngestedAtColumn *bool `json:"ingestedAtColumn"`
+			// Table engine configuration
+			TableEngine           string            `json:"tableEngine"`
+			PartitionBy           string            `json:"partitionBy"`
+			MetricTypeTTL         map[string]int    `json:"metricTypeTTL"`
+			MaterializedColumns   map[string]string `json:"materializedColumns"`
+			LowCardinalityColumns []string          `json:"lowCardinalityColumns"`
+			StringColumns         []string          `json:"stringColumns"`
+			NullableColumns       *bool             `json:"nullableColumns"`
+			LoadProfileTable      string            `json:"loadProfileTable"`
+			ThresholdsTable       string            `json:"thresholdsTable"`
+			EventsTable           string            `json:"eventsTable"`
+			SchemaFollower        *bool             `json:"schemaFollower"`
+			SchemaWaitTimeout     string            `json:"schemaWaitTimeout"`
+			StrictConfig          *bool             `json:"strictConfig"`
+			SampleFilters         []string          `json:"sampleFilters"`
+			TagTransformers       []string          `json:"tagTransformers"`
+			SkipSchemaValidation  *bool             `json:"skipSchemaValidation"`
+			SchemaFiles           []string          `json:"schemaFiles"`
+			HostnameColumn        *bool             `json:"hostnameColumn"`
+			VUColumns             *bool             `json:"vuColumns"`
+			SeriesIDColumn        *bool             `json:"seriesIdColumn"`
+			SeriesTable           string            `json:"seriesTable"`
+			AsyncInsert           *bool             `json:"asyncInsert"`
+			SanitizeMetricNames   *bool             `json:"sanitizeMetricNames"`
+			MetricNameMaxLength   *int              `json:"metricNameMaxLength"`
+			MaxTagsPerSample      *int              `json:"maxTagsPerSample"`
+			AlignFlushes          *bool             `json:"alignFlushes"`
+			TableTemplate         string            `json:"tableTemplate"`
+			BaselineView          string            `json:"baselineView"`
+			BaselineTestID        string            `json:"baselineTestid"`
+			BaselineBranch        string            `json:"baselineBranch"`
+			IncludeScenarios      []string          `json:"includeScenarios"`
+			ExcludeScenarios      []string          `json:"excludeScenarios"`
+			CounterMode           string            `json:"counterMode"`
+			RateBoolColumn        *bool             `json:"rateBoolColumn"`
+			BuiltinColumn         *bool             `json:"builtinColumn"`
+			KeepRawTags           *bool             `json:"keepRawTags"`
+			ShutdownFlushRetries  *uint             `json:"shutdownFlushRetries"`
+			ShutdownRetryBackoff  string            `json:"shutdownRetryBackoff"`
+			ShardAddrs            []string          `json:"shardAddrs"`
+			ShardBy               string            `json:"shardBy"`
+			LogFile               string            `json:"logFile"`
+			TraceIDColumn         *bool             `json:"traceIdColumn"`
 		}{}
 
 		if err := json.Unmarshal(params.JSONConfig, &jsonConf); err != nil {
 			return cfg, fmt.Errorf("failed to parse json config: %w", err)
 		}
+		unknown = append(unknown, unknownJSONKeys(params.JSONConfig, reflect.TypeOf(jsonConf), ""))
 
 		if jsonConf.Addr != "" {
 			cfg.Addr = jsonConf.Addr
@@ -364,8 +1498,8 @@ func ParseConfig(params output.Params) (Config, error) {
 		if jsonConf.Table != "" {
 			cfg.Table = jsonConf.Table
 		}
-		if jsonConf.PushInterval != "" {
-			d, err := time.ParseDuration(jsonConf.PushInterval)
+		if pushInterval := jsonScalar(jsonConf.PushInterval); pushInterval != "" {
+			d, err := parsePushInterval(pushInterval)
 			if err != nil {
 				return cfg, fmt.Errorf("invalid pushInterval: %w", err)
 			}
@@ -374,9 +1508,18 @@ func ParseConfig(params output.Params) (Config, error) {
 		if jsonConf.SchemaMode != "" {
 			cfg.SchemaMode = jsonConf.SchemaMode
 		}
+		if jsonConf.MetricRouting != "" {
+			cfg.MetricRouting = jsonConf.MetricRouting
+		}
 		if jsonConf.SkipSchemaCreation != nil {
 			cfg.SkipSchemaCreation = *jsonConf.SkipSchemaCreation
 		}
+		if jsonConf.CreateDatabase != nil {
+			cfg.CreateDatabase = *jsonConf.CreateDatabase
+		}
+		if jsonConf.CreateTable != nil {
+			cfg.CreateTable = *jsonConf.CreateTable
+		}
 		// Parse TLS config
 		if jsonConf.TLS != nil {
 			// Enabled/InsecureSkipVerify are pointers so an omitted key leaves the
@@ -400,6 +1543,39 @@ func ParseConfig(params output.Params) (Config, error) {
 				cfg.TLS.ServerName = jsonConf.TLS.ServerName
 			}
 		}
+		// Parse connection lifetime config
+		if jsonConf.ConnMaxLifetime != "" {
+			d, err := time.ParseDuration(jsonConf.ConnMaxLifetime)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid connMaxLifetime: %w", err)
+			}
+			cfg.ConnMaxLifetime = d
+		}
+		if jsonConf.ConnMaxIdleTime != "" {
+			d, err := time.ParseDuration(jsonConf.ConnMaxIdleTime)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid connMaxIdleTime: %w", err)
+			}
+			cfg.ConnMaxIdleTime = d
+		}
+		if jsonConf.KeepAlive != "" {
+			d, err := time.ParseDuration(jsonConf.KeepAlive)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid keepAlive: %w", err)
+			}
+			cfg.KeepAlive = d
+		}
+		// Parse driver buffer config
+		if jsonConf.BlockBufferSize != nil {
+			cfg.BlockBufferSize = *jsonConf.BlockBufferSize
+		}
+		if maxCompressionBuffer := jsonScalar(jsonConf.MaxCompressionBuffer); maxCompressionBuffer != "" {
+			v, err := intSize(parseByteSize(maxCompressionBuffer))
+			if err != nil {
+				return cfg, fmt.Errorf("invalid maxCompressionBuffer: %w", err)
+			}
+			cfg.MaxCompressionBuffer = v
+		}
 		// Parse retry config
 		if jsonConf.RetryAttempts != nil {
 			cfg.RetryAttempts = *jsonConf.RetryAttempts
@@ -422,36 +1598,318 @@ func ParseConfig(params output.Params) (Config, error) {
 		if jsonConf.BufferEnabled != nil {
 			cfg.BufferEnabled = *jsonConf.BufferEnabled
 		}
-		if jsonConf.BufferMaxSamples != nil {
-			cfg.BufferMaxSamples = *jsonConf.BufferMaxSamples
+		if bufferMaxSamples := jsonScalar(jsonConf.BufferMaxSamples); bufferMaxSamples != "" {
+			v, err := intSize(parseQuantity(bufferMaxSamples))
+			if err != nil {
+				return cfg, fmt.Errorf("invalid bufferMaxSamples: %w", err)
+			}
+			cfg.BufferMaxSamples = v
 		}
 		if jsonConf.BufferDropPolicy != "" {
 			cfg.BufferDropPolicy = jsonConf.BufferDropPolicy
 		}
+		if jsonConf.BufferMaxAge != "" {
+			d, err := time.ParseDuration(jsonConf.BufferMaxAge)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid bufferMaxAge: %w", err)
+			}
+			cfg.BufferMaxAge = d
+		}
+		if jsonConf.SpillDir != "" {
+			cfg.SpillDir = jsonConf.SpillDir
+		}
+		if jsonConf.DeadLetterDir != "" {
+			cfg.DeadLetterDir = jsonConf.DeadLetterDir
+		}
+		// Parse tag storage config
+		if jsonConf.TypedExtraTags != nil {
+			cfg.TypedExtraTags = *jsonConf.TypedExtraTags
+		}
+		if jsonConf.TagStorage != "" {
+			cfg.TagStorage = jsonConf.TagStorage
+		}
+		// Parse tag hashing config
+		if jsonConf.HashTags != nil {
+			cfg.HashTags = jsonConf.HashTags
+		}
+		if jsonConf.HashTagsLookupTable != "" {
+			cfg.HashTagsLookupTable = jsonConf.HashTagsLookupTable
+		}
+		// Parse tag defaults config
+		if jsonConf.TestIDDefault != "" {
+			cfg.TestIDDefault = jsonConf.TestIDDefault
+		}
+		if jsonConf.BranchDefault != "" {
+			cfg.BranchDefault = jsonConf.BranchDefault
+		}
+		if jsonConf.BuildIDDefault != "" {
+			cfg.BuildIDDefault = jsonConf.BuildIDDefault
+		}
+		// Parse metric filter config
+		if jsonConf.SkipBuiltinInternalMetrics != nil {
+			cfg.SkipBuiltinInternalMetrics = *jsonConf.SkipBuiltinInternalMetrics
+		}
+		// Parse conversion error guard config
+		if jsonConf.MaxConvertErrorRate != nil {
+			cfg.MaxConvertErrorRate = *jsonConf.MaxConvertErrorRate
+		}
+		if jsonConf.ConvertErrorAction != "" {
+			cfg.ConvertErrorAction = jsonConf.ConvertErrorAction
+		}
+		// Parse interrupted run config
+		if jsonConf.AbortFlushTimeout != "" {
+			d, err := time.ParseDuration(jsonConf.AbortFlushTimeout)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid abortFlushTimeout: %w", err)
+			}
+			cfg.AbortFlushTimeout = d
+		}
+
+		// Parse instance config
+		if jsonConf.InstanceName != "" {
+			cfg.InstanceName = jsonConf.InstanceName
+		}
+		// Parse batch splitting config
+		if maxBatchRows := jsonScalar(jsonConf.MaxBatchRows); maxBatchRows != "" {
+			v, err := intSize(parseQuantity(maxBatchRows))
+			if err != nil {
+				return cfg, fmt.Errorf("invalid maxBatchRows: %w", err)
+			}
+			cfg.MaxBatchRows = v
+		}
+		// Parse flush overlap config
+		if jsonConf.FlushOverlapPolicy != "" {
+			cfg.FlushOverlapPolicy = jsonConf.FlushOverlapPolicy
+		}
+		if jsonConf.MaxConcurrentFlushes != nil {
+			cfg.MaxConcurrentFlushes = *jsonConf.MaxConcurrentFlushes
+		}
+		// Parse offline start config
+		if jsonConf.SkipPing != nil {
+			cfg.SkipPing = *jsonConf.SkipPing
+		}
+		// Parse session resource limits config
+		if maxMemoryUsage := jsonScalar(jsonConf.MaxMemoryUsage); maxMemoryUsage != "" {
+			v, err := uint64Size(parseByteSize(maxMemoryUsage))
+			if err != nil {
+				return cfg, fmt.Errorf("invalid maxMemoryUsage: %w", err)
+			}
+			cfg.MaxMemoryUsage = v
+		}
+		if jsonConf.MaxInsertThreads != nil {
+			cfg.MaxInsertThreads = *jsonConf.MaxInsertThreads
+		}
+		if jsonConf.QueryPriority != nil {
+			cfg.QueryPriority = *jsonConf.QueryPriority
+		}
+		// Parse role config
+		if jsonConf.Role != "" {
+			cfg.Role = jsonConf.Role
+		}
+		// Parse audit config
+		if jsonConf.AuditTable != "" {
+			cfg.AuditTable = jsonConf.AuditTable
+		}
+		// Parse summary config
+		if jsonConf.SummaryFile != "" {
+			cfg.SummaryFile = jsonConf.SummaryFile
+		}
+		// Parse webhook config
+		if jsonConf.WebhookURL != "" {
+			cfg.WebhookURL = jsonConf.WebhookURL
+		}
+		if jsonConf.WebhookFailures != nil {
+			cfg.WebhookFailures = *jsonConf.WebhookFailures
+		}
+		if webhookDroppedSamples := jsonScalar(jsonConf.WebhookDroppedSamples); webhookDroppedSamples != "" {
+			v, err := uintSize(parseQuantity(webhookDroppedSamples))
+			if err != nil {
+				return cfg, fmt.Errorf("invalid webhookDroppedSamples: %w", err)
+			}
+			cfg.WebhookDroppedSamples = v
+		}
+		// Parse fallback config
+		if jsonConf.FallbackSink != "" {
+			cfg.FallbackSink = jsonConf.FallbackSink
+		}
+		// Parse write-ahead log config
+		if jsonConf.WALDir != "" {
+			cfg.WALDir = jsonConf.WALDir
+		}
+		// Parse export config
+		if jsonConf.ExportDir != "" {
+			cfg.ExportDir = jsonConf.ExportDir
+		}
+		if jsonConf.ExportFormat != "" {
+			cfg.ExportFormat = jsonConf.ExportFormat
+		}
+		// Parse tracing config
+		if jsonConf.TracesEndpoint != "" {
+			cfg.TracesEndpoint = jsonConf.TracesEndpoint
+		}
+		if jsonConf.GRPCColumns != nil {
+			cfg.GRPCColumns = *jsonConf.GRPCColumns
+		}
+		if jsonConf.WSColumns != nil {
+			cfg.WSColumns = *jsonConf.WSColumns
+		}
+		if jsonConf.ProtocolColumn != nil {
+			cfg.ProtocolColumn = *jsonConf.ProtocolColumn
+		}
+		if jsonConf.ErrorNameColumn != nil {
+			cfg.ErrorNameColumn = *jsonConf.ErrorNameColumn
+		}
+		if jsonConf.IngestedAtColumn != nil {
+			cfg.IngestedAtColumn = *jsonConf.IngestedAtColumn
+		}
+		// Parse table engine config
+		if jsonConf.TableEngine != "" {
+			cfg.TableEngine = jsonConf.TableEngine
+		}
+		if jsonConf.PartitionBy != "" {
+			cfg.PartitionBy = jsonConf.PartitionBy
+		}
+		if jsonConf.MetricTypeTTL != nil {
+			cfg.MetricTypeTTL = jsonConf.MetricTypeTTL
+		}
+		if jsonConf.MaterializedColumns != nil {
+			cfg.MaterializedColumns = jsonConf.MaterializedColumns
+		}
+		if jsonConf.LowCardinalityColumns != nil {
+			cfg.LowCardinalityColumns = jsonConf.LowCardinalityColumns
+		}
+		if jsonConf.StringColumns != nil {
+			cfg.StringColumns = jsonConf.StringColumns
+		}
+		if jsonConf.NullableColumns != nil {
+			cfg.NullableColumns = *jsonConf.NullableColumns
+		}
+		if jsonConf.LoadProfileTable != "" {
+			cfg.LoadProfileTable = jsonConf.LoadProfileTable
+		}
+		if jsonConf.ThresholdsTable != "" {
+			cfg.ThresholdsTable = jsonConf.ThresholdsTable
+		}
+		if jsonConf.EventsTable != "" {
+			cfg.EventsTable = jsonConf.EventsTable
+		}
+		if jsonConf.SchemaFollower != nil {
+			cfg.SchemaFollower = *jsonConf.SchemaFollower
+		}
+		if jsonConf.SchemaWaitTimeout != "" {
+			d, err := time.ParseDuration(jsonConf.SchemaWaitTimeout)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid schemaWaitTimeout: %w", err)
+			}
+			cfg.SchemaWaitTimeout = d
+		}
+		if jsonConf.StrictConfig != nil {
+			cfg.StrictConfig = *jsonConf.StrictConfig
+		}
+		if jsonConf.SampleFilters != nil {
+			cfg.SampleFilters = jsonConf.SampleFilters
+		}
+		if jsonConf.TagTransformers != nil {
+			cfg.TagTransformers = jsonConf.TagTransformers
+		}
+		if jsonConf.SkipSchemaValidation != nil {
+			cfg.SkipSchemaValidation = *jsonConf.SkipSchemaValidation
+		}
+		if jsonConf.SchemaFiles != nil {
+			cfg.SchemaFiles = jsonConf.SchemaFiles
+		}
+		if jsonConf.HostnameColumn != nil {
+			cfg.HostnameColumn = *jsonConf.HostnameColumn
+		}
+		if jsonConf.VUColumns != nil {
+			cfg.VUColumns = *jsonConf.VUColumns
+		}
+		if jsonConf.SeriesIDColumn != nil {
+			cfg.SeriesIDColumn = *jsonConf.SeriesIDColumn
+		}
+		if jsonConf.SeriesTable != "" {
+			cfg.SeriesTable = jsonConf.SeriesTable
+		}
+		if jsonConf.AsyncInsert != nil {
+			cfg.AsyncInsert = *jsonConf.AsyncInsert
+		}
+		if jsonConf.SanitizeMetricNames != nil {
+			cfg.SanitizeMetricNames = *jsonConf.SanitizeMetricNames
+		}
+		if jsonConf.MetricNameMaxLength != nil {
+			cfg.MetricNameMaxLength = *jsonConf.MetricNameMaxLength
+		}
+		if jsonConf.MaxTagsPerSample != nil {
+			cfg.MaxTagsPerSample = *jsonConf.MaxTagsPerSample
+		}
+		if jsonConf.AlignFlushes != nil {
+			cfg.AlignFlushes = *jsonConf.AlignFlushes
+		}
+		if jsonConf.TableTemplate != "" {
+			cfg.TableTemplate = jsonConf.TableTemplate
+		}
+		if jsonConf.BaselineView != "" {
+			cfg.BaselineView = jsonConf.BaselineView
+		}
+		if jsonConf.BaselineTestID != "" {
+			cfg.BaselineTestID = jsonConf.BaselineTestID
+		}
+		if jsonConf.BaselineBranch != "" {
+			cfg.BaselineBranch = jsonConf.BaselineBranch
+		}
+		if jsonConf.IncludeScenarios != nil {
+			cfg.IncludeScenarios = jsonConf.IncludeScenarios
+		}
+		if jsonConf.ExcludeScenarios != nil {
+			cfg.ExcludeScenarios = jsonConf.ExcludeScenarios
+		}
+		if jsonConf.CounterMode != "" {
+			cfg.CounterMode = jsonConf.CounterMode
+		}
+		if jsonConf.RateBoolColumn != nil {
+			cfg.RateBoolColumn = *jsonConf.RateBoolColumn
+		}
+		if jsonConf.BuiltinColumn != nil {
+			cfg.BuiltinColumn = *jsonConf.BuiltinColumn
+		}
+		if jsonConf.KeepRawTags != nil {
+			cfg.KeepRawTags = *jsonConf.KeepRawTags
+		}
+		if jsonConf.ShutdownFlushRetries != nil {
+			cfg.ShutdownFlushRetries = jsonConf.ShutdownFlushRetries
+		}
+		if jsonConf.ShutdownRetryBackoff != "" {
+			d, err := time.ParseDuration(jsonConf.ShutdownRetryBackoff)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid shutdownRetryBackoff: %w", err)
+			}
+			cfg.ShutdownRetryBackoff = d
+		}
+		if jsonConf.ShardAddrs != nil {
+			cfg.ShardAddrs = jsonConf.ShardAddrs
+		}
+		if jsonConf.ShardBy != "" {
+			cfg.ShardBy = jsonConf.ShardBy
+		}
+		if jsonConf.LogFile != "" {
+			cfg.LogFile = jsonConf.LogFile
+		}
+		if jsonConf.TraceIDColumn != nil {
+			cfg.TraceIDColumn = *jsonConf.TraceIDColumn
+		}
 	}
 
 	// Parse the config argument (--out xk6-clickhouse=addr or addr?param=value).
 	if arg := params.ConfigArgument; arg != "" {
-		// A bare "host:port" is not a URL — url.Parse would misread the host as a
-		// scheme. Only parse as a URL when a scheme ("://") is present; otherwise
-		// treat the argument as a raw address with an optional "?query" suffix.
-		addr, rawQuery := arg, ""
-		if strings.Contains(arg, "://") {
-			u, err := url.Parse(arg)
-			if err != nil {
-				return cfg, fmt.Errorf("invalid clickhouse config argument %q: %w", arg, err)
-			}
-			addr, rawQuery = u.Host, u.RawQuery
-		} else if before, after, found := strings.Cut(arg, "?"); found {
-			addr, rawQuery = before, after
+		addr, q, err := parseConfigArgument(arg)
+		if err != nil {
+			return cfg, err
 		}
 		if addr != "" {
 			cfg.Addr = addr
 		}
-
-		q, err := url.ParseQuery(rawQuery)
-		if err != nil {
-			return cfg, fmt.Errorf("invalid clickhouse config argument query %q: %w", arg, err)
+		if name := q.Get("name"); name != "" {
+			cfg.Name = name
 		}
 		if user := q.Get("user"); user != "" {
 			cfg.User = user
@@ -466,7 +1924,7 @@ func ParseConfig(params output.Params) (Config, error) {
 			cfg.Table = table
 		}
 		if pushInterval := q.Get("pushInterval"); pushInterval != "" {
-			d, err := time.ParseDuration(pushInterval)
+			d, err := parsePushInterval(pushInterval)
 			if err != nil {
 				return cfg, fmt.Errorf("invalid pushInterval URL parameter value %q: %w", pushInterval, err)
 			}
@@ -475,6 +1933,9 @@ func ParseConfig(params output.Params) (Config, error) {
 		if schemaMode := q.Get("schemaMode"); schemaMode != "" {
 			cfg.SchemaMode = schemaMode
 		}
+		if metricRouting := q.Get("metricRouting"); metricRouting != "" {
+			cfg.MetricRouting = metricRouting
+		}
 		if skipSchema := q.Get("skipSchemaCreation"); skipSchema != "" {
 			v, err := strconv.ParseBool(skipSchema)
 			if err != nil {
@@ -482,6 +1943,20 @@ func ParseConfig(params output.Params) (Config, error) {
 			}
 			cfg.SkipSchemaCreation = v
 		}
+		if createDatabase := q.Get("createDatabase"); createDatabase != "" {
+			v, err := strconv.ParseBool(createDatabase)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid createDatabase URL parameter value %q: %w", createDatabase, err)
+			}
+			cfg.CreateDatabase = v
+		}
+		if createTable := q.Get("createTable"); createTable != "" {
+			v, err := strconv.ParseBool(createTable)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid createTable URL parameter value %q: %w", createTable, err)
+			}
+			cfg.CreateTable = v
+		}
 
 		// Parse TLS URL parameters
 		if tlsEnabled := q.Get("tlsEnabled"); tlsEnabled != "" {
@@ -511,6 +1986,45 @@ func ParseConfig(params output.Params) (Config, error) {
 			cfg.TLS.ServerName = tlsServerName
 		}
 
+		// Parse connection lifetime URL parameters
+		if connMaxLifetime := q.Get("connMaxLifetime"); connMaxLifetime != "" {
+			d, err := time.ParseDuration(connMaxLifetime)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid connMaxLifetime URL parameter value %q: %w", connMaxLifetime, err)
+			}
+			cfg.ConnMaxLifetime = d
+		}
+		if connMaxIdleTime := q.Get("connMaxIdleTime"); connMaxIdleTime != "" {
+			d, err := time.ParseDuration(connMaxIdleTime)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid connMaxIdleTime URL parameter value %q: %w", connMaxIdleTime, err)
+			}
+			cfg.ConnMaxIdleTime = d
+		}
+		if keepAlive := q.Get("keepAlive"); keepAlive != "" {
+			d, err := time.ParseDuration(keepAlive)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid keepAlive URL parameter value %q: %w", keepAlive, err)
+			}
+			cfg.KeepAlive = d
+		}
+
+		// Parse driver buffer URL parameters
+		if blockBufferSize := q.Get("blockBufferSize"); blockBufferSize != "" {
+			v, err := strconv.Atoi(blockBufferSize)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid blockBufferSize URL parameter value %q: %w", blockBufferSize, err)
+			}
+			cfg.BlockBufferSize = v
+		}
+		if maxCompressionBuffer := q.Get("maxCompressionBuffer"); maxCompressionBuffer != "" {
+			v, err := intSize(parseByteSize(maxCompressionBuffer))
+			if err != nil {
+				return cfg, fmt.Errorf("invalid maxCompressionBuffer URL parameter value %q: %w", maxCompressionBuffer, err)
+			}
+			cfg.MaxCompressionBuffer = v
+		}
+
 		// Parse retry URL parameters
 		if retryAttempts := q.Get("retryAttempts"); retryAttempts != "" {
 			v, err := strconv.ParseUint(retryAttempts, 10, 32)
@@ -543,7 +2057,7 @@ func ParseConfig(params output.Params) (Config, error) {
 			cfg.BufferEnabled = enabled
 		}
 		if bufferMaxSamples := q.Get("bufferMaxSamples"); bufferMaxSamples != "" {
-			v, err := strconv.Atoi(bufferMaxSamples)
+			v, err := intSize(parseQuantity(bufferMaxSamples))
 			if err != nil {
 				return cfg, fmt.Errorf("invalid bufferMaxSamples URL parameter value %q: %w", bufferMaxSamples, err)
 			}
@@ -552,111 +2066,1075 @@ func ParseConfig(params output.Params) (Config, error) {
 		if bufferDropPolicy := q.Get("bufferDropPolicy"); bufferDropPolicy != "" {
 			cfg.BufferDropPolicy = bufferDropPolicy
 		}
-	}
-
-	// Parse environment variables (highest priority)
-	if addr := os.Getenv("K6_CLICKHOUSE_ADDR"); addr != "" {
-		cfg.Addr = addr
-	}
-	if user := os.Getenv("K6_CLICKHOUSE_USER"); user != "" {
-		cfg.User = user
-	}
-	if password := os.Getenv("K6_CLICKHOUSE_PASSWORD"); password != "" {
-		cfg.Password = password
-	}
-	if db := os.Getenv("K6_CLICKHOUSE_DB"); db != "" {
-		cfg.Database = db
-	}
-	if table := os.Getenv("K6_CLICKHOUSE_TABLE"); table != "" {
-		cfg.Table = table
-	}
-	if pushInterval := os.Getenv("K6_CLICKHOUSE_PUSH_INTERVAL"); pushInterval != "" {
-		d, err := time.ParseDuration(pushInterval)
-		if err != nil {
-			return cfg, fmt.Errorf("invalid K6_CLICKHOUSE_PUSH_INTERVAL value %q: %w", pushInterval, err)
+		if bufferMaxAge := q.Get("bufferMaxAge"); bufferMaxAge != "" {
+			d, err := time.ParseDuration(bufferMaxAge)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid bufferMaxAge URL parameter value %q: %w", bufferMaxAge, err)
+			}
+			cfg.BufferMaxAge = d
 		}
-		cfg.PushInterval = d
-	}
-	if schemaMode := os.Getenv("K6_CLICKHOUSE_SCHEMA_MODE"); schemaMode != "" {
-		cfg.SchemaMode = schemaMode
-	}
-	if skipSchema := os.Getenv("K6_CLICKHOUSE_SKIP_SCHEMA_CREATION"); skipSchema != "" {
-		v, err := strconv.ParseBool(skipSchema)
-		if err != nil {
-			return cfg, fmt.Errorf("invalid K6_CLICKHOUSE_SKIP_SCHEMA_CREATION value %q: %w", skipSchema, err)
+		if spillDir := q.Get("spillDir"); spillDir != "" {
+			cfg.SpillDir = spillDir
+		}
+		if deadLetterDir := q.Get("deadLetterDir"); deadLetterDir != "" {
+			cfg.DeadLetterDir = deadLetterDir
 		}
-		cfg.SkipSchemaCreation = v
-	}
 
-	// Parse TLS environment variables
-	if tlsEnabled := os.Getenv("K6_CLICKHOUSE_TLS_ENABLED"); tlsEnabled != "" {
-		enabled, err := strconv.ParseBool(tlsEnabled)
+		// Parse tag storage URL parameters
+		if typedExtraTags := q.Get("typedExtraTags"); typedExtraTags != "" {
+			v, err := strconv.ParseBool(typedExtraTags)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid typedExtraTags URL parameter value %q: %w", typedExtraTags, err)
+			}
+			cfg.TypedExtraTags = v
+		}
+		if tagStorage := q.Get("tagStorage"); tagStorage != "" {
+			cfg.TagStorage = tagStorage
+		}
+
+		// Parse tag hashing URL parameters
+		if hashTags := q.Get("hashTags"); hashTags != "" {
+			cfg.HashTags = splitList(hashTags)
+		}
+		if hashTagsLookupTable := q.Get("hashTagsLookupTable"); hashTagsLookupTable != "" {
+			cfg.HashTagsLookupTable = hashTagsLookupTable
+		}
+
+		// Parse tag defaults URL parameters
+		if testidDefault := q.Get("testidDefault"); testidDefault != "" {
+			cfg.TestIDDefault = testidDefault
+		}
+		if branchDefault := q.Get("branchDefault"); branchDefault != "" {
+			cfg.BranchDefault = branchDefault
+		}
+		if buildIdDefault := q.Get("buildIdDefault"); buildIdDefault != "" {
+			cfg.BuildIDDefault = buildIdDefault
+		}
+
+		// Parse metric filter URL parameters
+		if skipBuiltinInternalMetrics := q.Get("skipBuiltinInternalMetrics"); skipBuiltinInternalMetrics != "" {
+			v, err := strconv.ParseBool(skipBuiltinInternalMetrics)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid skipBuiltinInternalMetrics URL parameter value %q: %w", skipBuiltinInternalMetrics, err)
+			}
+			cfg.SkipBuiltinInternalMetrics = v
+		}
+
+		// Parse conversion error guard URL parameters
+		if maxConvertErrorRate := q.Get("maxConvertErrorRate"); maxConvertErrorRate != "" {
+			v, err := strconv.ParseFloat(maxConvertErrorRate, 64)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid maxConvertErrorRate URL parameter value %q: %w", maxConvertErrorRate, err)
+			}
+			cfg.MaxConvertErrorRate = v
+		}
+		if convertErrorAction := q.Get("convertErrorAction"); convertErrorAction != "" {
+			cfg.ConvertErrorAction = convertErrorAction
+		}
+
+		// Parse interrupted run URL parameters
+		if abortFlushTimeout := q.Get("abortFlushTimeout"); abortFlushTimeout != "" {
+			d, err := time.ParseDuration(abortFlushTimeout)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid abortFlushTimeout URL parameter value %q: %w", abortFlushTimeout, err)
+			}
+			cfg.AbortFlushTimeout = d
+		}
+
+		// Parse instance URL parameters
+		if instanceName := q.Get("instanceName"); instanceName != "" {
+			cfg.InstanceName = instanceName
+		}
+
+		// Parse batch splitting URL parameters
+		if maxBatchRows := q.Get("maxBatchRows"); maxBatchRows != "" {
+			v, err := intSize(parseQuantity(maxBatchRows))
+			if err != nil {
+				return cfg, fmt.Errorf("invalid maxBatchRows URL parameter value %q: %w", maxBatchRows, err)
+			}
+			cfg.MaxBatchRows = v
+		}
+
+		// Parse flush overlap URL parameters
+		if flushOverlapPolicy := q.Get("flushOverlapPolicy"); flushOverlapPolicy != "" {
+			cfg.FlushOverlapPolicy = flushOverlapPolicy
+		}
+		if maxConcurrentFlushes := q.Get("maxConcurrentFlushes"); maxConcurrentFlushes != "" {
+			v, err := strconv.Atoi(maxConcurrentFlushes)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid maxConcurrentFlushes URL parameter value %q: %w", maxConcurrentFlushes, err)
+			}
+			cfg.MaxConcurrentFlushes = v
+		}
+
+		// Parse offline start URL parameters
+		if skipPing := q.Get("skipPing"); skipPing != "" {
+			v, err := strconv.ParseBool(skipPing)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid skipPing URL parameter value %q: %w", skipPing, err)
+			}
+			cfg.SkipPing = v
+		}
+
+		// Parse session resource limits URL parameters
+		if maxMemoryUsage := q.Get("maxMemoryUsage"); maxMemoryUsage != "" {
+			v, err := uint64Size(parseByteSize(maxMemoryUsage))
+			if err != nil {
+				return cfg, fmt.Errorf("invalid maxMemoryUsage URL parameter value %q: %w", maxMemoryUsage, err)
+			}
+			cfg.MaxMemoryUsage = v
+		}
+		if maxInsertThreads := q.Get("maxInsertThreads"); maxInsertThreads != "" {
+			v, err := strconv.ParseUint(maxInsertThreads, 10, 32)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid maxInsertThreads URL parameter value %q: %w", maxInsertThreads, err)
+			}
+			cfg.MaxInsertThreads = uint(v)
+		}
+		if priority := q.Get("priority"); priority != "" {
+			v, err := strconv.ParseUint(priority, 10, 32)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid priority URL parameter value %q: %w", priority, err)
+			}
+			cfg.QueryPriority = uint(v)
+		}
+
+		// Parse role URL parameters
+		if role := q.Get("role"); role != "" {
+			cfg.Role = role
+		}
+
+		// Parse audit URL parameters
+		if auditTable := q.Get("auditTable"); auditTable != "" {
+			cfg.AuditTable = auditTable
+		}
+
+		// Parse summary URL parameters
+		if summaryFile := q.Get("summaryFile"); summaryFile != "" {
+			cfg.SummaryFile = summaryFile
+		}
+
+		// Parse webhook URL parameters
+		if webhookURL := q.Get("webhookURL"); webhookURL != "" {
+			cfg.WebhookURL = webhookURL
+		}
+		if webhookFailures := q.Get("webhookFailures"); webhookFailures != "" {
+			v, err := strconv.ParseUint(webhookFailures, 10, 32)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid webhookFailures URL parameter value %q: %w", webhookFailures, err)
+			}
+			cfg.WebhookFailures = uint(v)
+		}
+		if webhookDroppedSamples := q.Get("webhookDroppedSamples"); webhookDroppedSamples != "" {
+			v, err := uintSize(parseQuantity(webhookDroppedSamples))
+			if err != nil {
+				return cfg, fmt.Errorf("invalid webhookDroppedSamples URL parameter value %q: %w", webhookDroppedSamples, err)
+			}
+			cfg.WebhookDroppedSamples = v
+		}
+
+		// Parse fallback URL parameters
+		if fallbackSink := q.Get("fallbackSink"); fallbackSink != "" {
+			cfg.FallbackSink = fallbackSink
+		}
+
+		// Parse write-ahead log URL parameters
+		if walDir := q.Get("walDir"); walDir != "" {
+			cfg.WALDir = walDir
+		}
+
+		// Parse export URL parameters
+		if exportDir := q.Get("exportDir"); exportDir != "" {
+			cfg.ExportDir = exportDir
+		}
+		if exportFormat := q.Get("exportFormat"); exportFormat != "" {
+			cfg.ExportFormat = exportFormat
+		}
+
+		// Parse tracing URL parameters
+		if tracesEndpoint := q.Get("tracesEndpoint"); tracesEndpoint != "" {
+			cfg.TracesEndpoint = tracesEndpoint
+		}
+		if grpcColumns := q.Get("grpcColumns"); grpcColumns != "" {
+			v, err := strconv.ParseBool(grpcColumns)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid grpcColumns URL parameter value %q: %w", grpcColumns, err)
+			}
+			cfg.GRPCColumns = v
+		}
+		if wsColumns := q.Get("wsColumns"); wsColumns != "" {
+			v, err := strconv.ParseBool(wsColumns)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid wsColumns URL parameter value %q: %w", wsColumns, err)
+			}
+			cfg.WSColumns = v
+		}
+		if protocolColumn := q.Get("protocolColumn"); protocolColumn != "" {
+			v, err := strconv.ParseBool(protocolColumn)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid protocolColumn URL parameter value %q: %w", protocolColumn, err)
+			}
+			cfg.ProtocolColumn = v
+		}
+		if errorNameColumn := q.Get("errorNameColumn"); errorNameColumn != "" {
+			v, err := strconv.ParseBool(errorNameColumn)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid errorNameColumn URL parameter value %q: %w", errorNameColumn, err)
+			}
+			cfg.ErrorNameColumn = v
+		}
+		if ingestedAtColumn := q.Get("ingestedAtColumn"); ingestedAtColumn != "" {
+			v, err := strconv.ParseBool(ingestedAtColumn)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid ingestedAtColumn URL parameter value %q: %w", ingestedAtColumn, err)
+			}
+			cfg.IngestedAtColumn = v
+		}
+
+		// Parse table engine URL parameters
+		if tableEngine := q.Get("tableEngine"); tableEngine != "" {
+			cfg.TableEngine = tableEngine
+		}
+		if partitionBy := q.Get("partitionBy"); partitionBy != "" {
+			cfg.PartitionBy = partitionBy
+		}
+		if metricTypeTTL := q.Get("metricTypeTTL"); metricTypeTTL != "" {
+			ttl, err := parseMetricTypeTTL(metricTypeTTL)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid metricTypeTTL URL parameter value %q: %w", metricTypeTTL, err)
+			}
+			cfg.MetricTypeTTL = ttl
+		}
+		if materializedColumns := q.Get("materializedColumns"); materializedColumns != "" {
+			columns, err := parseMaterializedColumns(materializedColumns)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid materializedColumns URL parameter value %q: %w", materializedColumns, err)
+			}
+			cfg.MaterializedColumns = columns
+		}
+		if lowCardinalityColumns := q.Get("lowCardinalityColumns"); lowCardinalityColumns != "" {
+			cfg.LowCardinalityColumns = splitList(lowCardinalityColumns)
+		}
+		if stringColumns := q.Get("stringColumns"); stringColumns != "" {
+			cfg.StringColumns = splitList(stringColumns)
+		}
+		if nullableColumns := q.Get("nullableColumns"); nullableColumns != "" {
+			v, err := strconv.ParseBool(nullableColumns)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid nullableColumns URL parameter value %q: %w", nullableColumns, err)
+			}
+			cfg.NullableColumns = v
+		}
+		if loadProfileTable := q.Get("loadProfileTable"); loadProfileTable != "" {
+			cfg.LoadProfileTable = loadProfileTable
+		}
+		if thresholdsTable := q.Get("thresholdsTable"); thresholdsTable != "" {
+			cfg.ThresholdsTable = thresholdsTable
+		}
+		if eventsTable := q.Get("eventsTable"); eventsTable != "" {
+			cfg.EventsTable = eventsTable
+		}
+		if schemaFollower := q.Get("schemaFollower"); schemaFollower != "" {
+			v, err := strconv.ParseBool(schemaFollower)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid schemaFollower URL parameter value %q: %w", schemaFollower, err)
+			}
+			cfg.SchemaFollower = v
+		}
+		if schemaWaitTimeout := q.Get("schemaWaitTimeout"); schemaWaitTimeout != "" {
+			d, err := time.ParseDuration(schemaWaitTimeout)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid schemaWaitTimeout URL parameter value %q: %w", schemaWaitTimeout, err)
+			}
+			cfg.SchemaWaitTimeout = d
+		}
+		if strictConfig := q.Get("strictConfig"); strictConfig != "" {
+			v, err := strconv.ParseBool(strictConfig)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid strictConfig URL parameter value %q: %w", strictConfig, err)
+			}
+			cfg.StrictConfig = v
+		}
+		if sampleFilters := q.Get("sampleFilters"); sampleFilters != "" {
+			cfg.SampleFilters = splitList(sampleFilters)
+		}
+		if tagTransformers := q.Get("tagTransformers"); tagTransformers != "" {
+			cfg.TagTransformers = splitList(tagTransformers)
+		}
+		if skipSchemaValidation := q.Get("skipSchemaValidation"); skipSchemaValidation != "" {
+			v, err := strconv.ParseBool(skipSchemaValidation)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid skipSchemaValidation URL parameter value %q: %w", skipSchemaValidation, err)
+			}
+			cfg.SkipSchemaValidation = v
+		}
+		if schemaFiles := q.Get("schemaFiles"); schemaFiles != "" {
+			cfg.SchemaFiles = splitList(schemaFiles)
+		}
+		if hostnameColumn := q.Get("hostnameColumn"); hostnameColumn != "" {
+			v, err := strconv.ParseBool(hostnameColumn)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid hostnameColumn URL parameter value %q: %w", hostnameColumn, err)
+			}
+			cfg.HostnameColumn = v
+		}
+		if vuColumns := q.Get("vuColumns"); vuColumns != "" {
+			v, err := strconv.ParseBool(vuColumns)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid vuColumns URL parameter value %q: %w", vuColumns, err)
+			}
+			cfg.VUColumns = v
+		}
+		if seriesIdColumn := q.Get("seriesIdColumn"); seriesIdColumn != "" {
+			v, err := strconv.ParseBool(seriesIdColumn)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid seriesIdColumn URL parameter value %q: %w", seriesIdColumn, err)
+			}
+			cfg.SeriesIDColumn = v
+		}
+		if seriesTable := q.Get("seriesTable"); seriesTable != "" {
+			cfg.SeriesTable = seriesTable
+		}
+		if asyncInsert := q.Get("asyncInsert"); asyncInsert != "" {
+			v, err := strconv.ParseBool(asyncInsert)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid asyncInsert URL parameter value %q: %w", asyncInsert, err)
+			}
+			cfg.AsyncInsert = v
+		}
+		if sanitizeMetricNames := q.Get("sanitizeMetricNames"); sanitizeMetricNames != "" {
+			v, err := strconv.ParseBool(sanitizeMetricNames)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid sanitizeMetricNames URL parameter value %q: %w", sanitizeMetricNames, err)
+			}
+			cfg.SanitizeMetricNames = v
+		}
+		if metricNameMaxLength := q.Get("metricNameMaxLength"); metricNameMaxLength != "" {
+			v, err := strconv.Atoi(metricNameMaxLength)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid metricNameMaxLength URL parameter value %q: %w", metricNameMaxLength, err)
+			}
+			cfg.MetricNameMaxLength = v
+		}
+		if maxTagsPerSample := q.Get("maxTagsPerSample"); maxTagsPerSample != "" {
+			v, err := strconv.Atoi(maxTagsPerSample)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid maxTagsPerSample URL parameter value %q: %w", maxTagsPerSample, err)
+			}
+			cfg.MaxTagsPerSample = v
+		}
+		if alignFlushes := q.Get("alignFlushes"); alignFlushes != "" {
+			v, err := strconv.ParseBool(alignFlushes)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid alignFlushes URL parameter value %q: %w", alignFlushes, err)
+			}
+			cfg.AlignFlushes = v
+		}
+		if tableTemplate := q.Get("tableTemplate"); tableTemplate != "" {
+			cfg.TableTemplate = tableTemplate
+		}
+		if baselineView := q.Get("baselineView"); baselineView != "" {
+			cfg.BaselineView = baselineView
+		}
+		if baselineTestid := q.Get("baselineTestid"); baselineTestid != "" {
+			cfg.BaselineTestID = baselineTestid
+		}
+		if baselineBranch := q.Get("baselineBranch"); baselineBranch != "" {
+			cfg.BaselineBranch = baselineBranch
+		}
+		if includeScenarios := q.Get("includeScenarios"); includeScenarios != "" {
+			cfg.IncludeScenarios = splitList(includeScenarios)
+		}
+		if excludeScenarios := q.Get("excludeScenarios"); excludeScenarios != "" {
+			cfg.ExcludeScenarios = splitList(excludeScenarios)
+		}
+		if counterMode := q.Get("counterMode"); counterMode != "" {
+			cfg.CounterMode = counterMode
+		}
+		if rateBoolColumn := q.Get("rateBoolColumn"); rateBoolColumn != "" {
+			v, err := strconv.ParseBool(rateBoolColumn)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid rateBoolColumn URL parameter value %q: %w", rateBoolColumn, err)
+			}
+			cfg.RateBoolColumn = v
+		}
+		if builtinColumn := q.Get("builtinColumn"); builtinColumn != "" {
+			v, err := strconv.ParseBool(builtinColumn)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid builtinColumn URL parameter value %q: %w", builtinColumn, err)
+			}
+			cfg.BuiltinColumn = v
+		}
+		if keepRawTags := q.Get("keepRawTags"); keepRawTags != "" {
+			v, err := strconv.ParseBool(keepRawTags)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid keepRawTags URL parameter value %q: %w", keepRawTags, err)
+			}
+			cfg.KeepRawTags = v
+		}
+		if shutdownFlushRetries := q.Get("shutdownFlushRetries"); shutdownFlushRetries != "" {
+			v, err := strconv.ParseUint(shutdownFlushRetries, 10, 32)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid shutdownFlushRetries URL parameter value %q: %w", shutdownFlushRetries, err)
+			}
+			retries := uint(v)
+			cfg.ShutdownFlushRetries = &retries
+		}
+		if shutdownRetryBackoff := q.Get("shutdownRetryBackoff"); shutdownRetryBackoff != "" {
+			d, err := time.ParseDuration(shutdownRetryBackoff)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid shutdownRetryBackoff URL parameter value %q: %w", shutdownRetryBackoff, err)
+			}
+			cfg.ShutdownRetryBackoff = d
+		}
+		if shardAddrs := q.Get("shardAddrs"); shardAddrs != "" {
+			cfg.ShardAddrs = splitList(shardAddrs)
+		}
+		if shardBy := q.Get("shardBy"); shardBy != "" {
+			cfg.ShardBy = shardBy
+		}
+		if logFile := q.Get("logFile"); logFile != "" {
+			cfg.LogFile = logFile
+		}
+		if traceIdColumn := q.Get("traceIdColumn"); traceIdColumn != "" {
+			v, err := strconv.ParseBool(traceIdColumn)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid traceIdColumn URL parameter value %q: %w", traceIdColumn, err)
+			}
+			cfg.TraceIDColumn = v
+		}
+
+		// Every known parameter was read above; anything left is a mistake
+		unknown = append(unknown, q.checkUnknown())
+	}
+
+	// Parse environment variables (highest priority), scoped by Name
+	if addr := cfg.getenv("ADDR"); addr != "" {
+		cfg.Addr = addr
+	}
+	if user := cfg.getenv("USER"); user != "" {
+		cfg.User = user
+	}
+	if password := cfg.getenv("PASSWORD"); password != "" {
+		cfg.Password = password
+	}
+	if db := cfg.getenv("DB"); db != "" {
+		cfg.Database = db
+	}
+	if table := cfg.getenv("TABLE"); table != "" {
+		cfg.Table = table
+	}
+	if pushInterval := cfg.getenv("PUSH_INTERVAL"); pushInterval != "" {
+		d, err := parsePushInterval(pushInterval)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("PUSH_INTERVAL"), pushInterval, err)
+		}
+		cfg.PushInterval = d
+	}
+	if schemaMode := cfg.getenv("SCHEMA_MODE"); schemaMode != "" {
+		cfg.SchemaMode = schemaMode
+	}
+	if metricRouting := cfg.getenv("METRIC_ROUTING"); metricRouting != "" {
+		cfg.MetricRouting = metricRouting
+	}
+	if skipSchema := cfg.getenv("SKIP_SCHEMA_CREATION"); skipSchema != "" {
+		v, err := strconv.ParseBool(skipSchema)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("SKIP_SCHEMA_CREATION"), skipSchema, err)
+		}
+		cfg.SkipSchemaCreation = v
+	}
+	if createDatabase := cfg.getenv("CREATE_DATABASE"); createDatabase != "" {
+		v, err := strconv.ParseBool(createDatabase)
 		if err != nil {
-			return cfg, fmt.Errorf("invalid K6_CLICKHOUSE_TLS_ENABLED value %q: %w", tlsEnabled, err)
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("CREATE_DATABASE"), createDatabase, err)
+		}
+		cfg.CreateDatabase = v
+	}
+	if createTable := cfg.getenv("CREATE_TABLE"); createTable != "" {
+		v, err := strconv.ParseBool(createTable)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("CREATE_TABLE"), createTable, err)
+		}
+		cfg.CreateTable = v
+	}
+
+	// Parse TLS environment variables
+	if tlsEnabled := cfg.getenv("TLS_ENABLED"); tlsEnabled != "" {
+		enabled, err := strconv.ParseBool(tlsEnabled)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("TLS_ENABLED"), tlsEnabled, err)
 		}
 		cfg.TLS.Enabled = enabled
 	}
-	if tlsInsecure := os.Getenv("K6_CLICKHOUSE_TLS_INSECURE_SKIP_VERIFY"); tlsInsecure != "" {
+	if tlsInsecure := cfg.getenv("TLS_INSECURE_SKIP_VERIFY"); tlsInsecure != "" {
 		insecure, err := strconv.ParseBool(tlsInsecure)
 		if err != nil {
-			return cfg, fmt.Errorf("invalid K6_CLICKHOUSE_TLS_INSECURE_SKIP_VERIFY value %q: %w", tlsInsecure, err)
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("TLS_INSECURE_SKIP_VERIFY"), tlsInsecure, err)
 		}
 		cfg.TLS.InsecureSkipVerify = insecure
 	}
-	if tlsCAFile := os.Getenv("K6_CLICKHOUSE_TLS_CA_FILE"); tlsCAFile != "" {
+	if tlsCAFile := cfg.getenv("TLS_CA_FILE"); tlsCAFile != "" {
 		cfg.TLS.CAFile = tlsCAFile
 	}
-	if tlsCertFile := os.Getenv("K6_CLICKHOUSE_TLS_CERT_FILE"); tlsCertFile != "" {
+	if tlsCertFile := cfg.getenv("TLS_CERT_FILE"); tlsCertFile != "" {
 		cfg.TLS.CertFile = tlsCertFile
 	}
-	if tlsKeyFile := os.Getenv("K6_CLICKHOUSE_TLS_KEY_FILE"); tlsKeyFile != "" {
+	if tlsKeyFile := cfg.getenv("TLS_KEY_FILE"); tlsKeyFile != "" {
 		cfg.TLS.KeyFile = tlsKeyFile
 	}
-	if tlsServerName := os.Getenv("K6_CLICKHOUSE_TLS_SERVER_NAME"); tlsServerName != "" {
+	if tlsServerName := cfg.getenv("TLS_SERVER_NAME"); tlsServerName != "" {
 		cfg.TLS.ServerName = tlsServerName
 	}
 
+	// Parse connection lifetime environment variables
+	if connMaxLifetime := cfg.getenv("CONN_MAX_LIFETIME"); connMaxLifetime != "" {
+		d, err := time.ParseDuration(connMaxLifetime)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("CONN_MAX_LIFETIME"), connMaxLifetime, err)
+		}
+		cfg.ConnMaxLifetime = d
+	}
+	if connMaxIdleTime := cfg.getenv("CONN_MAX_IDLE_TIME"); connMaxIdleTime != "" {
+		d, err := time.ParseDuration(connMaxIdleTime)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("CONN_MAX_IDLE_TIME"), connMaxIdleTime, err)
+		}
+		cfg.ConnMaxIdleTime = d
+	}
+	if keepAlive := cfg.getenv("KEEP_ALIVE"); keepAlive != "" {
+		d, err := time.ParseDuration(keepAlive)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("KEEP_ALIVE"), keepAlive, err)
+		}
+		cfg.KeepAlive = d
+	}
+
+	// Parse driver buffer environment variables
+	if blockBufferSize := cfg.getenv("BLOCK_BUFFER_SIZE"); blockBufferSize != "" {
+		v, err := strconv.Atoi(blockBufferSize)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("BLOCK_BUFFER_SIZE"), blockBufferSize, err)
+		}
+		cfg.BlockBufferSize = v
+	}
+	if maxCompressionBuffer := cfg.getenv("MAX_COMPRESSION_BUFFER"); maxCompressionBuffer != "" {
+		v, err := intSize(parseByteSize(maxCompressionBuffer))
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("MAX_COMPRESSION_BUFFER"), maxCompressionBuffer, err)
+		}
+		cfg.MaxCompressionBuffer = v
+	}
+
 	// Parse retry environment variables
-	if retryAttempts := os.Getenv("K6_CLICKHOUSE_RETRY_ATTEMPTS"); retryAttempts != "" {
+	if retryAttempts := cfg.getenv("RETRY_ATTEMPTS"); retryAttempts != "" {
 		v, err := strconv.ParseUint(retryAttempts, 10, 32)
 		if err != nil {
-			return cfg, fmt.Errorf("invalid K6_CLICKHOUSE_RETRY_ATTEMPTS value %q: %w", retryAttempts, err)
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("RETRY_ATTEMPTS"), retryAttempts, err)
 		}
 		cfg.RetryAttempts = uint(v)
 	}
-	if retryDelay := os.Getenv("K6_CLICKHOUSE_RETRY_DELAY"); retryDelay != "" {
+	if retryDelay := cfg.getenv("RETRY_DELAY"); retryDelay != "" {
 		d, err := time.ParseDuration(retryDelay)
 		if err != nil {
-			return cfg, fmt.Errorf("invalid K6_CLICKHOUSE_RETRY_DELAY value %q: %w", retryDelay, err)
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("RETRY_DELAY"), retryDelay, err)
 		}
 		cfg.RetryDelay = d
 	}
-	if retryMaxDelay := os.Getenv("K6_CLICKHOUSE_RETRY_MAX_DELAY"); retryMaxDelay != "" {
+	if retryMaxDelay := cfg.getenv("RETRY_MAX_DELAY"); retryMaxDelay != "" {
 		d, err := time.ParseDuration(retryMaxDelay)
 		if err != nil {
-			return cfg, fmt.Errorf("invalid K6_CLICKHOUSE_RETRY_MAX_DELAY value %q: %w", retryMaxDelay, err)
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("RETRY_MAX_DELAY"), retryMaxDelay, err)
 		}
 		cfg.RetryMaxDelay = d
 	}
 
 	// Parse buffer environment variables
-	if bufferEnabled := os.Getenv("K6_CLICKHOUSE_BUFFER_ENABLED"); bufferEnabled != "" {
+	if bufferEnabled := cfg.getenv("BUFFER_ENABLED"); bufferEnabled != "" {
 		enabled, err := strconv.ParseBool(bufferEnabled)
 		if err != nil {
-			return cfg, fmt.Errorf("invalid K6_CLICKHOUSE_BUFFER_ENABLED value %q: %w", bufferEnabled, err)
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("BUFFER_ENABLED"), bufferEnabled, err)
 		}
 		cfg.BufferEnabled = enabled
 	}
-	if bufferMaxSamples := os.Getenv("K6_CLICKHOUSE_BUFFER_MAX_SAMPLES"); bufferMaxSamples != "" {
-		v, err := strconv.Atoi(bufferMaxSamples)
+	if bufferMaxSamples := cfg.getenv("BUFFER_MAX_SAMPLES"); bufferMaxSamples != "" {
+		v, err := intSize(parseQuantity(bufferMaxSamples))
 		if err != nil {
-			return cfg, fmt.Errorf("invalid K6_CLICKHOUSE_BUFFER_MAX_SAMPLES value %q: %w", bufferMaxSamples, err)
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("BUFFER_MAX_SAMPLES"), bufferMaxSamples, err)
 		}
 		cfg.BufferMaxSamples = v
 	}
-	if bufferDropPolicy := os.Getenv("K6_CLICKHOUSE_BUFFER_DROP_POLICY"); bufferDropPolicy != "" {
+	if bufferDropPolicy := cfg.getenv("BUFFER_DROP_POLICY"); bufferDropPolicy != "" {
 		cfg.BufferDropPolicy = bufferDropPolicy
 	}
+	if bufferMaxAge := cfg.getenv("BUFFER_MAX_AGE"); bufferMaxAge != "" {
+		d, err := time.ParseDuration(bufferMaxAge)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("BUFFER_MAX_AGE"), bufferMaxAge, err)
+		}
+		cfg.BufferMaxAge = d
+	}
+	if spillDir := cfg.getenv("SPILL_DIR"); spillDir != "" {
+		cfg.SpillDir = spillDir
+	}
+	if deadLetterDir := cfg.getenv("DEAD_LETTER_DIR"); deadLetterDir != "" {
+		cfg.DeadLetterDir = deadLetterDir
+	}
+
+	// Parse tag storage environment variables
+	if typedExtraTags := cfg.getenv("TYPED_EXTRA_TAGS"); typedExtraTags != "" {
+		v, err := strconv.ParseBool(typedExtraTags)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("TYPED_EXTRA_TAGS"), typedExtraTags, err)
+		}
+		cfg.TypedExtraTags = v
+	}
+	if tagStorage := cfg.getenv("TAG_STORAGE"); tagStorage != "" {
+		cfg.TagStorage = tagStorage
+	}
+
+	// Parse tag hashing environment variables
+	if hashTags := cfg.getenv("HASH_TAGS"); hashTags != "" {
+		cfg.HashTags = splitList(hashTags)
+	}
+	if hashTagsLookupTable := cfg.getenv("HASH_TAGS_LOOKUP_TABLE"); hashTagsLookupTable != "" {
+		cfg.HashTagsLookupTable = hashTagsLookupTable
+	}
+
+	// Parse tag defaults environment variables
+	if testidDefault := cfg.getenv("TESTID_DEFAULT"); testidDefault != "" {
+		cfg.TestIDDefault = testidDefault
+	}
+	if branchDefault := cfg.getenv("BRANCH_DEFAULT"); branchDefault != "" {
+		cfg.BranchDefault = branchDefault
+	}
+	if buildIdDefault := cfg.getenv("BUILD_ID_DEFAULT"); buildIdDefault != "" {
+		cfg.BuildIDDefault = buildIdDefault
+	}
+
+	// Parse metric filter environment variables
+	if skipBuiltinInternalMetrics := cfg.getenv("SKIP_BUILTIN_INTERNAL_METRICS"); skipBuiltinInternalMetrics != "" {
+		v, err := strconv.ParseBool(skipBuiltinInternalMetrics)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("SKIP_BUILTIN_INTERNAL_METRICS"), skipBuiltinInternalMetrics, err)
+		}
+		cfg.SkipBuiltinInternalMetrics = v
+	}
+
+	// Parse conversion error guard environment variables
+	if maxConvertErrorRate := cfg.getenv("MAX_CONVERT_ERROR_RATE"); maxConvertErrorRate != "" {
+		v, err := strconv.ParseFloat(maxConvertErrorRate, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("MAX_CONVERT_ERROR_RATE"), maxConvertErrorRate, err)
+		}
+		cfg.MaxConvertErrorRate = v
+	}
+	if convertErrorAction := cfg.getenv("CONVERT_ERROR_ACTION"); convertErrorAction != "" {
+		cfg.ConvertErrorAction = convertErrorAction
+	}
+
+	// Parse interrupted run environment variables
+	if abortFlushTimeout := cfg.getenv("ABORT_FLUSH_TIMEOUT"); abortFlushTimeout != "" {
+		d, err := time.ParseDuration(abortFlushTimeout)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("ABORT_FLUSH_TIMEOUT"), abortFlushTimeout, err)
+		}
+		cfg.AbortFlushTimeout = d
+	}
+
+	// Parse instance environment variables
+	if instanceName := cfg.getenv("INSTANCE_NAME"); instanceName != "" {
+		cfg.InstanceName = instanceName
+	}
+
+	// Parse batch splitting environment variables
+	if maxBatchRows := cfg.getenv("MAX_BATCH_ROWS"); maxBatchRows != "" {
+		v, err := intSize(parseQuantity(maxBatchRows))
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("MAX_BATCH_ROWS"), maxBatchRows, err)
+		}
+		cfg.MaxBatchRows = v
+	}
+
+	// Parse flush overlap environment variables
+	if flushOverlapPolicy := cfg.getenv("FLUSH_OVERLAP_POLICY"); flushOverlapPolicy != "" {
+		cfg.FlushOverlapPolicy = flushOverlapPolicy
+	}
+	if maxConcurrentFlushes := cfg.getenv("MAX_CONCURRENT_FLUSHES"); maxConcurrentFlushes != "" {
+		v, err := strconv.Atoi(maxConcurrentFlushes)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("MAX_CONCURRENT_FLUSHES"), maxConcurrentFlushes, err)
+		}
+		cfg.MaxConcurrentFlushes = v
+	}
+
+	// Parse offline start environment variables
+	if skipPing := cfg.getenv("SKIP_PING"); skipPing != "" {
+		v, err := strconv.ParseBool(skipPing)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("SKIP_PING"), skipPing, err)
+		}
+		cfg.SkipPing = v
+	}
+
+	// Parse session resource limits environment variables
+	if maxMemoryUsage := cfg.getenv("MAX_MEMORY_USAGE"); maxMemoryUsage != "" {
+		v, err := uint64Size(parseByteSize(maxMemoryUsage))
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("MAX_MEMORY_USAGE"), maxMemoryUsage, err)
+		}
+		cfg.MaxMemoryUsage = v
+	}
+	if maxInsertThreads := cfg.getenv("MAX_INSERT_THREADS"); maxInsertThreads != "" {
+		v, err := strconv.ParseUint(maxInsertThreads, 10, 32)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("MAX_INSERT_THREADS"), maxInsertThreads, err)
+		}
+		cfg.MaxInsertThreads = uint(v)
+	}
+	if priority := cfg.getenv("PRIORITY"); priority != "" {
+		v, err := strconv.ParseUint(priority, 10, 32)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("PRIORITY"), priority, err)
+		}
+		cfg.QueryPriority = uint(v)
+	}
+
+	// Parse role environment variables
+	if role := cfg.getenv("ROLE"); role != "" {
+		cfg.Role = role
+	}
+
+	// Parse audit environment variables
+	if auditTable := cfg.getenv("AUDIT_TABLE"); auditTable != "" {
+		cfg.AuditTable = auditTable
+	}
+
+	// Parse summary environment variables
+	if summaryFile := cfg.getenv("SUMMARY_FILE"); summaryFile != "" {
+		cfg.SummaryFile = summaryFile
+	}
+
+	// Parse webhook environment variables
+	if webhookURL := cfg.getenv("WEBHOOK_URL"); webhookURL != "" {
+		cfg.WebhookURL = webhookURL
+	}
+	if webhookFailures := cfg.getenv("WEBHOOK_FAILURES"); webhookFailures != "" {
+		v, err := strconv.ParseUint(webhookFailures, 10, 32)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("WEBHOOK_FAILURES"), webhookFailures, err)
+		}
+		cfg.WebhookFailures = uint(v)
+	}
+	if webhookDroppedSamples := cfg.getenv("WEBHOOK_DROPPED_SAMPLES"); webhookDroppedSamples != "" {
+		v, err := uintSize(parseQuantity(webhookDroppedSamples))
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("WEBHOOK_DROPPED_SAMPLES"), webhookDroppedSamples, err)
+		}
+		cfg.WebhookDroppedSamples = v
+	}
+
+	// Parse fallback environment variables
+	if fallbackSink := cfg.getenv("FALLBACK_SINK"); fallbackSink != "" {
+		cfg.FallbackSink = fallbackSink
+	}
+
+	// Parse write-ahead log environment variables
+	if walDir := cfg.getenv("WAL_DIR"); walDir != "" {
+		cfg.WALDir = walDir
+	}
+
+	// Parse export environment variables
+	if exportDir := cfg.getenv("EXPORT_DIR"); exportDir != "" {
+		cfg.ExportDir = exportDir
+	}
+	if exportFormat := cfg.getenv("EXPORT_FORMAT"); exportFormat != "" {
+		cfg.ExportFormat = exportFormat
+	}
+
+	// Parse tracing environment variables
+	if tracesEndpoint := cfg.getenv("TRACES_ENDPOINT"); tracesEndpoint != "" {
+		cfg.TracesEndpoint = tracesEndpoint
+	}
+	if grpcColumns := cfg.getenv("GRPC_COLUMNS"); grpcColumns != "" {
+		v, err := strconv.ParseBool(grpcColumns)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("GRPC_COLUMNS"), grpcColumns, err)
+		}
+		cfg.GRPCColumns = v
+	}
+	if wsColumns := cfg.getenv("WS_COLUMNS"); wsColumns != "" {
+		v, err := strconv.ParseBool(wsColumns)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("WS_COLUMNS"), wsColumns, err)
+		}
+		cfg.WSColumns = v
+	}
+	if protocolColumn := cfg.getenv("PROTOCOL_COLUMN"); protocolColumn != "" {
+		v, err := strconv.ParseBool(protocolColumn)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("PROTOCOL_COLUMN"), protocolColumn, err)
+		}
+		cfg.ProtocolColumn = v
+	}
+	if errorNameColumn := cfg.getenv("ERROR_NAME_COLUMN"); errorNameColumn != "" {
+		v, err := strconv.ParseBool(errorNameColumn)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("ERROR_NAME_COLUMN"), errorNameColumn, err)
+		}
+		cfg.ErrorNameColumn = v
+	}
+	if ingestedAtColumn := cfg.getenv("INGESTED_AT_COLUMN"); ingestedAtColumn != "" {
+		v, err := strconv.ParseBool(ingestedAtColumn)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("INGESTED_AT_COLUMN"), ingestedAtColumn, err)
+		}
+		cfg.IngestedAtColumn = v
+	}
+
+	// Parse table engine environment variables
+	if tableEngine := cfg.getenv("TABLE_ENGINE"); tableEngine != "" {
+		cfg.TableEngine = tableEngine
+	}
+	if partitionBy := cfg.getenv("PARTITION_BY"); partitionBy != "" {
+		cfg.PartitionBy = partitionBy
+	}
+	if metricTypeTTL := cfg.getenv("METRIC_TYPE_TTL"); metricTypeTTL != "" {
+		ttl, err := parseMetricTypeTTL(metricTypeTTL)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("METRIC_TYPE_TTL"), metricTypeTTL, err)
+		}
+		cfg.MetricTypeTTL = ttl
+	}
+	if materializedColumns := cfg.getenv("MATERIALIZED_COLUMNS"); materializedColumns != "" {
+		columns, err := parseMaterializedColumns(materializedColumns)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("MATERIALIZED_COLUMNS"), materializedColumns, err)
+		}
+		cfg.MaterializedColumns = columns
+	}
+	if lowCardinalityColumns := cfg.getenv("LOW_CARDINALITY_COLUMNS"); lowCardinalityColumns != "" {
+		cfg.LowCardinalityColumns = splitList(lowCardinalityColumns)
+	}
+	if stringColumns := cfg.getenv("STRING_COLUMNS"); stringColumns != "" {
+		cfg.StringColumns = splitList(stringColumns)
+	}
+	if nullableColumns := cfg.getenv("NULLABLE_COLUMNS"); nullableColumns != "" {
+		v, err := strconv.ParseBool(nullableColumns)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("NULLABLE_COLUMNS"), nullableColumns, err)
+		}
+		cfg.NullableColumns = v
+	}
+	if loadProfileTable := cfg.getenv("LOAD_PROFILE_TABLE"); loadProfileTable != "" {
+		cfg.LoadProfileTable = loadProfileTable
+	}
+	if thresholdsTable := cfg.getenv("THRESHOLDS_TABLE"); thresholdsTable != "" {
+		cfg.ThresholdsTable = thresholdsTable
+	}
+	if eventsTable := cfg.getenv("EVENTS_TABLE"); eventsTable != "" {
+		cfg.EventsTable = eventsTable
+	}
+	if schemaFollower := cfg.getenv("SCHEMA_FOLLOWER"); schemaFollower != "" {
+		v, err := strconv.ParseBool(schemaFollower)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("SCHEMA_FOLLOWER"), schemaFollower, err)
+		}
+		cfg.SchemaFollower = v
+	}
+	if schemaWaitTimeout := cfg.getenv("SCHEMA_WAIT_TIMEOUT"); schemaWaitTimeout != "" {
+		d, err := time.ParseDuration(schemaWaitTimeout)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("SCHEMA_WAIT_TIMEOUT"), schemaWaitTimeout, err)
+		}
+		cfg.SchemaWaitTimeout = d
+	}
+	if strictConfig := cfg.getenv("STRICT_CONFIG"); strictConfig != "" {
+		v, err := strconv.ParseBool(strictConfig)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("STRICT_CONFIG"), strictConfig, err)
+		}
+		cfg.StrictConfig = v
+	}
+	if sampleFilters := cfg.getenv("SAMPLE_FILTERS"); sampleFilters != "" {
+		cfg.SampleFilters = splitList(sampleFilters)
+	}
+	if tagTransformers := cfg.getenv("TAG_TRANSFORMERS"); tagTransformers != "" {
+		cfg.TagTransformers = splitList(tagTransformers)
+	}
+	if skipSchemaValidation := cfg.getenv("SKIP_SCHEMA_VALIDATION"); skipSchemaValidation != "" {
+		v, err := strconv.ParseBool(skipSchemaValidation)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("SKIP_SCHEMA_VALIDATION"), skipSchemaValidation, err)
+		}
+		cfg.SkipSchemaValidation = v
+	}
+	if schemaFiles := cfg.getenv("SCHEMA_FILES"); schemaFiles != "" {
+		cfg.SchemaFiles = splitList(schemaFiles)
+	}
+	if hostnameColumn := cfg.getenv("HOSTNAME_COLUMN"); hostnameColumn != "" {
+		v, err := strconv.ParseBool(hostnameColumn)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("HOSTNAME_COLUMN"), hostnameColumn, err)
+		}
+		cfg.HostnameColumn = v
+	}
+	if vuColumns := cfg.getenv("VU_COLUMNS"); vuColumns != "" {
+		v, err := strconv.ParseBool(vuColumns)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("VU_COLUMNS"), vuColumns, err)
+		}
+		cfg.VUColumns = v
+	}
+	if seriesIdColumn := cfg.getenv("SERIES_ID_COLUMN"); seriesIdColumn != "" {
+		v, err := strconv.ParseBool(seriesIdColumn)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("SERIES_ID_COLUMN"), seriesIdColumn, err)
+		}
+		cfg.SeriesIDColumn = v
+	}
+	if seriesTable := cfg.getenv("SERIES_TABLE"); seriesTable != "" {
+		cfg.SeriesTable = seriesTable
+	}
+	if asyncInsert := cfg.getenv("ASYNC_INSERT"); asyncInsert != "" {
+		v, err := strconv.ParseBool(asyncInsert)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("ASYNC_INSERT"), asyncInsert, err)
+		}
+		cfg.AsyncInsert = v
+	}
+	if sanitizeMetricNames := cfg.getenv("SANITIZE_METRIC_NAMES"); sanitizeMetricNames != "" {
+		v, err := strconv.ParseBool(sanitizeMetricNames)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("SANITIZE_METRIC_NAMES"), sanitizeMetricNames, err)
+		}
+		cfg.SanitizeMetricNames = v
+	}
+	if metricNameMaxLength := cfg.getenv("METRIC_NAME_MAX_LENGTH"); metricNameMaxLength != "" {
+		v, err := strconv.Atoi(metricNameMaxLength)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("METRIC_NAME_MAX_LENGTH"), metricNameMaxLength, err)
+		}
+		cfg.MetricNameMaxLength = v
+	}
+	if maxTagsPerSample := cfg.getenv("MAX_TAGS_PER_SAMPLE"); maxTagsPerSample != "" {
+		v, err := strconv.Atoi(maxTagsPerSample)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("MAX_TAGS_PER_SAMPLE"), maxTagsPerSample, err)
+		}
+		cfg.MaxTagsPerSample = v
+	}
+	if alignFlushes := cfg.getenv("ALIGN_FLUSHES"); alignFlushes != "" {
+		v, err := strconv.ParseBool(alignFlushes)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("ALIGN_FLUSHES"), alignFlushes, err)
+		}
+		cfg.AlignFlushes = v
+	}
+	if tableTemplate := cfg.getenv("TABLE_TEMPLATE"); tableTemplate != "" {
+		cfg.TableTemplate = tableTemplate
+	}
+	if baselineView := cfg.getenv("BASELINE_VIEW"); baselineView != "" {
+		cfg.BaselineView = baselineView
+	}
+	if baselineTestid := cfg.getenv("BASELINE_TESTID"); baselineTestid != "" {
+		cfg.BaselineTestID = baselineTestid
+	}
+	if baselineBranch := cfg.getenv("BASELINE_BRANCH"); baselineBranch != "" {
+		cfg.BaselineBranch = baselineBranch
+	}
+	if includeScenarios := cfg.getenv("INCLUDE_SCENARIOS"); includeScenarios != "" {
+		cfg.IncludeScenarios = splitList(includeScenarios)
+	}
+	if excludeScenarios := cfg.getenv("EXCLUDE_SCENARIOS"); excludeScenarios != "" {
+		cfg.ExcludeScenarios = splitList(excludeScenarios)
+	}
+	if counterMode := cfg.getenv("COUNTER_MODE"); counterMode != "" {
+		cfg.CounterMode = counterMode
+	}
+	if rateBoolColumn := cfg.getenv("RATE_BOOL_COLUMN"); rateBoolColumn != "" {
+		v, err := strconv.ParseBool(rateBoolColumn)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("RATE_BOOL_COLUMN"), rateBoolColumn, err)
+		}
+		cfg.RateBoolColumn = v
+	}
+	if builtinColumn := cfg.getenv("BUILTIN_COLUMN"); builtinColumn != "" {
+		v, err := strconv.ParseBool(builtinColumn)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("BUILTIN_COLUMN"), builtinColumn, err)
+		}
+		cfg.BuiltinColumn = v
+	}
+	if keepRawTags := cfg.getenv("KEEP_RAW_TAGS"); keepRawTags != "" {
+		v, err := strconv.ParseBool(keepRawTags)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("KEEP_RAW_TAGS"), keepRawTags, err)
+		}
+		cfg.KeepRawTags = v
+	}
+	if shutdownFlushRetries := cfg.getenv("SHUTDOWN_FLUSH_RETRIES"); shutdownFlushRetries != "" {
+		v, err := strconv.ParseUint(shutdownFlushRetries, 10, 32)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("SHUTDOWN_FLUSH_RETRIES"), shutdownFlushRetries, err)
+		}
+		retries := uint(v)
+		cfg.ShutdownFlushRetries = &retries
+	}
+	if shutdownRetryBackoff := cfg.getenv("SHUTDOWN_RETRY_BACKOFF"); shutdownRetryBackoff != "" {
+		d, err := time.ParseDuration(shutdownRetryBackoff)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("SHUTDOWN_RETRY_BACKOFF"), shutdownRetryBackoff, err)
+		}
+		cfg.ShutdownRetryBackoff = d
+	}
+	if shardAddrs := cfg.getenv("SHARD_ADDRS"); shardAddrs != "" {
+		cfg.ShardAddrs = splitList(shardAddrs)
+	}
+	if shardBy := cfg.getenv("SHARD_BY"); shardBy != "" {
+		cfg.ShardBy = shardBy
+	}
+	if logFile := cfg.getenv("LOG_FILE"); logFile != "" {
+		cfg.LogFile = logFile
+	}
+	if traceIdColumn := cfg.getenv("TRACE_ID_COLUMN"); traceIdColumn != "" {
+		v, err := strconv.ParseBool(traceIdColumn)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s value %q: %w", cfg.envName("TRACE_ID_COLUMN"), traceIdColumn, err)
+		}
+		cfg.TraceIDColumn = v
+	}
+
+	if cfg.InstanceName == "" {
+		cfg.InstanceName = cfg.Name
+	}
+
+	// An address without a port gets the default native port
+	cfg.Addr = normalizeAddr(cfg.Addr, cfg.TLS.Enabled)
+	for i, addr := range cfg.ShardAddrs {
+		cfg.ShardAddrs[i] = normalizeAddr(addr, cfg.TLS.Enabled)
+	}
+
+	// Unknown JSON keys and config argument parameters are usually typos
+	if err := errors.Join(unknown...); err != nil {
+		if cfg.StrictConfig {
+			return cfg, err
+		}
+		cfg.ignoredKeys = err
+	}
+
+	// Give the run its own database or table when the names are templated,
+	// once every source is parsed and a mistyped key has been reported
+	if err := cfg.expandRunNames(params.ScriptOptions.RunTags, time.Now()); err != nil {
+		return cfg, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// Schemas defined in files are loaded before schemaMode is checked; New
+	// registers them once the configuration is valid
+	var err error
+	if cfg.schemaDefinitions, err = loadSchemaFiles(cfg.SchemaFiles); err != nil {
+		return cfg, fmt.Errorf("invalid configuration: %w", err)
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
@@ -0,0 +1,138 @@
+package clickhouse
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// configQuery holds the query parameters of the config argument and records
+// which ones ParseConfig read, so that the rest can be reported as unknown.
+type configQuery struct {
+	values url.Values
+	known  map[string]bool
+}
+
+// Get returns the first value of the parameter key, or "".
+func (q configQuery) Get(key string) string {
+	q.known[key] = true
+	return q.values.Get(key)
+}
+
+// checkUnknown reports the parameters that were never read, suggesting the
+// closest known parameter for each.
+func (q configQuery) checkUnknown() error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(q.values)) {
+		if q.known[key] {
+			continue
+		}
+		err := fmt.Errorf("unknown clickhouse config argument parameter %q", key)
+		if suggestion := closestKey(key, slices.Sorted(maps.Keys(q.known))); suggestion != "" {
+			err = fmt.Errorf("%w (did you mean %q?)", err, suggestion)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// parseConfigArgument splits the config argument (--out
+// xk6-clickhouse=addr?param=value) into the address and the query.
+//
+// A bare "host:port" is not a URL — url.Parse would misread the host as a
+// scheme. Only parse as a URL when a scheme ("://") is present; otherwise
+// treat the argument as a raw address with an optional "?query" suffix.
+// URL parts the output has no use for are rejected rather than ignored, so
+// that a mistyped argument does not quietly connect to the default address.
+func parseConfigArgument(arg string) (string, configQuery, error) {
+	addr, rawQuery := arg, ""
+	shown := redactConfigArgument(arg) // the argument as quoted in errors
+	if strings.Contains(arg, "://") {
+		u, err := url.Parse(bracketIPv6Host(arg))
+		if err != nil {
+			if urlErr, ok := errors.AsType[*url.Error](err); ok {
+				err = urlErr.Err // its message repeats the whole argument
+			}
+			return "", configQuery{}, fmt.Errorf("invalid clickhouse config argument %q: %w", shown, err)
+		}
+		switch {
+		case u.Host == "":
+			return "", configQuery{}, fmt.Errorf("invalid clickhouse config argument %q: missing host", shown)
+		case u.User != nil:
+			return "", configQuery{}, fmt.Errorf("invalid clickhouse config argument %q: "+
+				"credentials in the URL are not supported, use the user and password parameters", redactConfigArgument(u.Redacted()))
+		case u.Path != "" && u.Path != "/":
+			return "", configQuery{}, fmt.Errorf("invalid clickhouse config argument %q: "+
+				"path %q is not supported, use the database and table parameters", shown, u.Path)
+		case u.Fragment != "":
+			return "", configQuery{}, fmt.Errorf("invalid clickhouse config argument %q: unexpected fragment %q", shown, u.Fragment)
+		}
+		addr, rawQuery = u.Host, u.RawQuery
+	} else if before, after, found := strings.Cut(arg, "?"); found {
+		addr, rawQuery = before, after
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", configQuery{}, fmt.Errorf("invalid clickhouse config argument query %q: %w", shown, err)
+	}
+	return addr, configQuery{values: values, known: make(map[string]bool)}, nil
+}
+
+// bracketIPv6Host wraps the host of a URL argument in brackets when it is a
+// bare IPv6 address, which url.Parse would otherwise misread as host:port
+// ("clickhouse://::1" as host ":" and port "1").
+func bracketIPv6Host(arg string) string {
+	scheme, rest, _ := strings.Cut(arg, "://")
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	host := rest[:end]
+	unescaped, err := url.PathUnescape(host) // zones are escaped: fe80::1%25eth0
+	if err != nil {
+		return arg
+	}
+	if ip, err := netip.ParseAddr(unescaped); err != nil || !ip.Is6() {
+		return arg
+	}
+	return scheme + "://[" + host + "]" + rest[end:]
+}
+
+// closestKey returns the first of the candidates nearest to key by edit
+// distance, ignoring case, or "" when none is close enough to be a likely
+// typo.
+func closestKey(key string, candidates []string) string {
+	best, bestDist := "", max(2, len(key)/3)+1
+	for _, c := range candidates {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(c)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
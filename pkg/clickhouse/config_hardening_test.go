@@ -204,6 +204,10 @@ func TestConfig_Validate(t *testing.T) {
 		}, "buffer max samples must be positive"},
 		{"invalid drop policy", func(c *Config) { c.BufferDropPolicy = "random" }, "invalid buffer drop policy"},
 		{"retry attempts over cap", func(c *Config) { c.RetryAttempts = maxRetryAttempts + 1 }, "retry attempts must not exceed"},
+		{"negative conn max lifetime", func(c *Config) { c.ConnMaxLifetime = -1 }, "conn max lifetime must be non-negative"},
+		{"negative conn max idle time", func(c *Config) { c.ConnMaxIdleTime = -1 }, "conn max idle time must be non-negative"},
+		{"block buffer size over uint8", func(c *Config) { c.BlockBufferSize = 256 }, "block buffer size must be between 0 and 255"},
+		{"negative max compression buffer", func(c *Config) { c.MaxCompressionBuffer = -1 }, "max compression buffer must be non-negative"},
 	}
 
 	for _, tt := range tests {
@@ -223,4 +227,22 @@ func TestConfig_Validate(t *testing.T) {
 		t.Parallel()
 		assert.NoError(t, NewConfig().Validate())
 	})
+
+	t.Run("all problems reported together", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := NewConfig()
+		cfg.Addr = ""
+		cfg.Table = "bad table"
+		cfg.PushInterval = 0
+		cfg.TLS = TLSConfig{Enabled: true, CertFile: "client.crt"}
+
+		err := cfg.Validate()
+		require.Error(t, err)
+		assert.Equal(t, "clickhouse address is required\n"+
+			"invalid table name: bad table (must be alphanumeric + underscore, max 63 chars)\n"+
+			"push interval must be positive, got 0s\n"+
+			"TLS client certificate and key must be specified together\n"+
+			"TLS client certificate file validation failed: file does not exist: client.crt", err.Error())
+	})
 }
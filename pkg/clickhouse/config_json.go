@@ -0,0 +1,62 @@
+package clickhouse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// unknownJSONKeys reports the keys of the JSON object data that match no
+// field of the struct type typ, suggesting the closest field for each. Keys
+// must match the field names exactly: encoding/json accepts "pushinterval"
+// for "pushInterval", but the URL parameters are case-sensitive, and the
+// JSON config should not read differently. Objects decoded into
+// structs are checked recursively, their keys prefixed with path.
+func unknownJSONKeys(data []byte, typ reflect.Type, path string) error {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil // not an object; json.Unmarshal into typ reports it
+	}
+
+	fields := make(map[string]reflect.Type, typ.NumField())
+	for f := range typ.Fields() {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = f.Type
+		}
+	}
+
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(object)) {
+		fieldType, ok := fields[key]
+		if !ok {
+			errs = append(errs, unknownJSONKey(path, key, slices.Sorted(maps.Keys(fields))))
+			continue
+		}
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct {
+			errs = append(errs, unknownJSONKeys(object[key], fieldType, path+key+"."))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// unknownJSONKey describes the key at path matching none of the fields.
+func unknownJSONKey(path, key string, fields []string) error {
+	for _, f := range fields {
+		if strings.EqualFold(f, key) {
+			return fmt.Errorf("json config key %q must be written %q", path+key, path+f)
+		}
+	}
+	err := fmt.Errorf("unknown json config key %q", path+key)
+	if suggestion := closestKey(key, fields); suggestion != "" {
+		err = fmt.Errorf("%w (did you mean %q?)", err, path+suggestion)
+	}
+	return err
+}
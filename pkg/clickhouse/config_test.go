@@ -262,6 +262,39 @@ func TestParseConfig_EdgeCases(t *testing.T) {
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "invalid clickhouse config argument")
 	})
+
+	t.Run("unused url parts return an error", func(t *testing.T) {
+		t.Parallel()
+
+		for arg, want := range map[string]string{
+			"clickhouse://?database=k6":               "missing host",
+			"clickhouse://bob:secret@ch:9000":         "use the user and password parameters",
+			"clickhouse://ch:9000/k6":                 `path "/k6" is not supported`,
+			"clickhouse://ch:9000#samples":            "unexpected fragment",
+			"localhost:9000?database=k6&table=%zz":    "invalid clickhouse config argument query",
+			"clickhouse://ch:9000/?database=k6&x=%zz": "invalid clickhouse config argument query",
+		} {
+			_, err := ParseConfig(output.Params{ConfigArgument: arg})
+			require.Error(t, err, arg)
+			assert.Contains(t, err.Error(), want, arg)
+			assert.NotContains(t, err.Error(), "secret", "password redacted")
+		}
+	})
+
+	t.Run("unknown query parameters return an error", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?databse=k6&pushinterval=5s&frobnicate=1"})
+		require.Error(t, err)
+		assert.Equal(t, `unknown clickhouse config argument parameter "databse" (did you mean "database"?)`+"\n"+
+			`unknown clickhouse config argument parameter "frobnicate"`+"\n"+
+			`unknown clickhouse config argument parameter "pushinterval" (did you mean "pushInterval"?)`, err.Error())
+
+		cfg, err := ParseConfig(output.Params{ConfigArgument: "clickhouse://ch:9000/?database=prod"})
+		require.NoError(t, err)
+		assert.Equal(t, "ch:9000", cfg.Addr)
+		assert.Equal(t, "prod", cfg.Database)
+	})
 }
 
 func TestConfig_Struct(t *testing.T) {
@@ -362,6 +395,14 @@ func TestParseConfig_ZeroValueOverrides(t *testing.T) {
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "buffer max samples must be positive")
 	})
+
+	t.Run("bufferMaxSamples above 2^53 keeps its precision", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := ParseConfig(output.Params{JSONConfig: []byte(`{"bufferMaxSamples": 9007199254740993}`)})
+		require.NoError(t, err)
+		assert.Equal(t, 9007199254740993, cfg.BufferMaxSamples)
+	})
 }
 
 // Test for Issue #5: Env var parse errors return errors instead of being silently swallowed
@@ -404,6 +445,18 @@ func TestParseConfig_InvalidEnvVars(t *testing.T) {
 			envValue:      "xyz",
 			errorContains: "invalid K6_CLICKHOUSE_RETRY_MAX_DELAY",
 		},
+		{
+			name:          "invalid K6_CLICKHOUSE_CONN_MAX_LIFETIME",
+			envVar:        "K6_CLICKHOUSE_CONN_MAX_LIFETIME",
+			envValue:      "forever",
+			errorContains: "invalid K6_CLICKHOUSE_CONN_MAX_LIFETIME",
+		},
+		{
+			name:          "invalid K6_CLICKHOUSE_KEEP_ALIVE",
+			envVar:        "K6_CLICKHOUSE_KEEP_ALIVE",
+			envValue:      "often",
+			errorContains: "invalid K6_CLICKHOUSE_KEEP_ALIVE",
+		},
 		{
 			name:          "invalid K6_CLICKHOUSE_BUFFER_ENABLED",
 			envVar:        "K6_CLICKHOUSE_BUFFER_ENABLED",
@@ -468,6 +521,11 @@ func TestParseConfig_InvalidURLParams(t *testing.T) {
 			urlParam:      "localhost:9000?retryMaxDelay=xyz",
 			errorContains: "invalid retryMaxDelay URL parameter value",
 		},
+		{
+			name:          "invalid connMaxIdleTime URL param",
+			urlParam:      "localhost:9000?connMaxIdleTime=soon",
+			errorContains: "invalid connMaxIdleTime URL parameter value",
+		},
 		{
 			name:          "invalid bufferEnabled URL param",
 			urlParam:      "localhost:9000?bufferEnabled=maybe",
@@ -525,6 +583,55 @@ func TestParseConfig_PushIntervalURLParam(t *testing.T) {
 	assert.Equal(t, 2*time.Second, cfg.PushInterval)
 }
 
+// TestParseConfig_PushIntervalFormats verifies that pushInterval takes a
+// bare number, seconds below 100 and milliseconds from 100 on, from every
+// source.
+func TestParseConfig_PushIntervalFormats(t *testing.T) {
+	t.Parallel()
+
+	for _, params := range []output.Params{
+		{JSONConfig: []byte(`{"pushInterval": 5000}`)},
+		{JSONConfig: []byte(`{"pushInterval": "5000"}`)},
+		{JSONConfig: []byte(`{"pushInterval": "5s"}`)},
+		{JSONConfig: []byte(`{"pushInterval": 5}`)},
+		{JSONConfig: []byte(`{"pushInterval": "5"}`)},
+		{ConfigArgument: "localhost:9000?pushInterval=5000"},
+		{ConfigArgument: "localhost:9000?pushInterval=5"},
+	} {
+		cfg, err := ParseConfig(params)
+		require.NoError(t, err)
+		assert.Equal(t, 5*time.Second, cfg.PushInterval)
+	}
+
+	cfg, err := ParseConfig(output.Params{JSONConfig: []byte(`{"pushInterval": 250.5}`)})
+	require.NoError(t, err)
+	assert.Equal(t, 250500*time.Microsecond, cfg.PushInterval)
+
+	cfg, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?pushInterval=200ms"})
+	require.NoError(t, err)
+	assert.Equal(t, 200*time.Millisecond, cfg.PushInterval)
+
+	// Either side of the threshold
+	cfg, err = ParseConfig(output.Params{JSONConfig: []byte(`{"pushInterval": 99}`)})
+	require.NoError(t, err)
+	assert.Equal(t, 99*time.Second, cfg.PushInterval)
+	cfg, err = ParseConfig(output.Params{JSONConfig: []byte(`{"pushInterval": 100}`)})
+	require.NoError(t, err)
+	assert.Equal(t, 100*time.Millisecond, cfg.PushInterval)
+	cfg, err = ParseConfig(output.Params{JSONConfig: []byte(`{"pushInterval": 0.5}`)})
+	require.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, cfg.PushInterval)
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?pushInterval=20ms"})
+	assert.ErrorContains(t, err, `push interval must be at least 100ms, got 20ms (use "100ms" or more`)
+	_, err = ParseConfig(output.Params{JSONConfig: []byte(`{"pushInterval": 0.05}`)})
+	assert.ErrorContains(t, err, `push interval must be at least 100ms, got 50ms (use "100ms" or more`)
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?pushInterval=soon"})
+	assert.ErrorContains(t, err, `expected a duration such as "5s", or a number: seconds below 100, milliseconds from 100 on`)
+	_, err = ParseConfig(output.Params{JSONConfig: []byte(`{"pushInterval": true}`)})
+	assert.ErrorContains(t, err, "invalid pushInterval")
+}
+
 // TestParseConfig_RetryURLParams verifies retryAttempts/retryDelay/retryMaxDelay URL params.
 func TestParseConfig_RetryURLParams(t *testing.T) {
 	t.Parallel()
@@ -538,6 +645,31 @@ func TestParseConfig_RetryURLParams(t *testing.T) {
 	assert.Equal(t, 10*time.Second, cfg.RetryMaxDelay)
 }
 
+// TestParseConfig_ShutdownRetryURLParams verifies shutdownFlushRetries/shutdownRetryBackoff URL params.
+func TestParseConfig_ShutdownRetryURLParams(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{
+		ConfigArgument: "localhost:9000?shutdownFlushRetries=10&shutdownRetryBackoff=1s",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, cfg.ShutdownFlushRetries)
+	assert.Equal(t, uint(10), *cfg.ShutdownFlushRetries)
+	assert.Equal(t, time.Second, cfg.ShutdownRetryBackoff)
+	assert.Nil(t, NewConfig().ShutdownFlushRetries, "unset keeps retryAttempts")
+	assert.Zero(t, NewConfig().ShutdownRetryBackoff, "unset keeps retryDelay")
+
+	cfg, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?shutdownFlushRetries=0"})
+	require.NoError(t, err)
+	require.NotNil(t, cfg.ShutdownFlushRetries, "0 disables retries at shutdown")
+	assert.Zero(t, *cfg.ShutdownFlushRetries)
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?shutdownFlushRetries=101"})
+	assert.ErrorContains(t, err, "shutdown flush retries must not exceed 100, got 101")
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?shutdownRetryBackoff=-1s"})
+	assert.ErrorContains(t, err, "shutdown retry backoff must be non-negative")
+}
+
 // TestParseConfig_BufferURLParams verifies bufferEnabled/bufferMaxSamples/bufferDropPolicy URL params.
 func TestParseConfig_BufferURLParams(t *testing.T) {
 	t.Parallel()
@@ -563,4 +695,295 @@ func TestParseConfig_BufferURLParams(t *testing.T) {
 		require.NoError(t, err)
 		assert.False(t, cfg.BufferEnabled)
 	})
+
+	t.Run("buffer max age", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := ParseConfig(output.Params{
+			ConfigArgument: "localhost:9000?bufferMaxAge=10m",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 10*time.Minute, cfg.BufferMaxAge)
+
+		_, err = ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{"bufferMaxAge": "-1m"}),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "buffer max age must be non-negative")
+	})
+
+	t.Run("max batch rows", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := ParseConfig(output.Params{
+			ConfigArgument: "localhost:9000?maxBatchRows=50000",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 50000, cfg.MaxBatchRows)
+
+		_, err = ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{"maxBatchRows": -1}),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "max batch rows must be non-negative")
+	})
+}
+
+// TestParseConfig_ConnectionLifetime verifies connMaxLifetime/connMaxIdleTime/keepAlive
+// are read from every config source with the documented precedence.
+func TestParseConfig_ConnectionLifetime(t *testing.T) {
+	t.Run("json config", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{
+				"connMaxLifetime": "10m",
+				"connMaxIdleTime": "50s",
+				"keepAlive":       "20s",
+			}),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 10*time.Minute, cfg.ConnMaxLifetime)
+		assert.Equal(t, 50*time.Second, cfg.ConnMaxIdleTime)
+		assert.Equal(t, 20*time.Second, cfg.KeepAlive)
+	})
+
+	t.Run("url params override json", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{
+				"connMaxLifetime": "10m",
+			}),
+			ConfigArgument: "localhost:9000?connMaxLifetime=2m&connMaxIdleTime=30s&keepAlive=-1s",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2*time.Minute, cfg.ConnMaxLifetime)
+		assert.Equal(t, 30*time.Second, cfg.ConnMaxIdleTime)
+		assert.Equal(t, -1*time.Second, cfg.KeepAlive, "negative keepAlive disables probes and is valid")
+	})
+
+	t.Run("env overrides url", func(t *testing.T) {
+		t.Setenv("K6_CLICKHOUSE_CONN_MAX_LIFETIME", "90s")
+		t.Setenv("K6_CLICKHOUSE_CONN_MAX_IDLE_TIME", "15s")
+		t.Setenv("K6_CLICKHOUSE_KEEP_ALIVE", "5s")
+
+		cfg, err := ParseConfig(output.Params{
+			ConfigArgument: "localhost:9000?connMaxLifetime=2m",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 90*time.Second, cfg.ConnMaxLifetime)
+		assert.Equal(t, 15*time.Second, cfg.ConnMaxIdleTime)
+		assert.Equal(t, 5*time.Second, cfg.KeepAlive)
+	})
+
+	t.Run("invalid json duration", func(t *testing.T) {
+		_, err := ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{"connMaxIdleTime": "idle"}),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid connMaxIdleTime")
+	})
+}
+
+// TestParseConfig_DriverBufferKnobs verifies blockBufferSize/maxCompressionBuffer
+// across config sources.
+func TestParseConfig_DriverBufferKnobs(t *testing.T) {
+	t.Run("json config", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{
+				"blockBufferSize":      8,
+				"maxCompressionBuffer": 33554432,
+			}),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 8, cfg.BlockBufferSize)
+		assert.Equal(t, 33554432, cfg.MaxCompressionBuffer)
+	})
+
+	t.Run("url params", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{
+			ConfigArgument: "localhost:9000?blockBufferSize=4&maxCompressionBuffer=1048576",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 4, cfg.BlockBufferSize)
+		assert.Equal(t, 1048576, cfg.MaxCompressionBuffer)
+	})
+
+	t.Run("env vars", func(t *testing.T) {
+		t.Setenv("K6_CLICKHOUSE_BLOCK_BUFFER_SIZE", "16")
+		t.Setenv("K6_CLICKHOUSE_MAX_COMPRESSION_BUFFER", "2097152")
+
+		cfg, err := ParseConfig(output.Params{})
+		require.NoError(t, err)
+		assert.Equal(t, 16, cfg.BlockBufferSize)
+		assert.Equal(t, 2097152, cfg.MaxCompressionBuffer)
+	})
+
+	t.Run("out of range block buffer size fails validation", func(t *testing.T) {
+		_, err := ParseConfig(output.Params{
+			ConfigArgument: "localhost:9000?blockBufferSize=1000",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "block buffer size must be between 0 and 255")
+	})
+
+	t.Run("invalid url value", func(t *testing.T) {
+		_, err := ParseConfig(output.Params{
+			ConfigArgument: "localhost:9000?maxCompressionBuffer=big",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid maxCompressionBuffer URL parameter value")
+	})
+}
+
+// TestParseConfig_TypedExtraTags verifies typedExtraTags across config sources.
+func TestParseConfig_TypedExtraTags(t *testing.T) {
+	t.Run("default off", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{})
+		require.NoError(t, err)
+		assert.False(t, cfg.TypedExtraTags)
+	})
+
+	t.Run("json config", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{"typedExtraTags": true}),
+		})
+		require.NoError(t, err)
+		assert.True(t, cfg.TypedExtraTags)
+	})
+
+	t.Run("env overrides url", func(t *testing.T) {
+		t.Setenv("K6_CLICKHOUSE_TYPED_EXTRA_TAGS", "false")
+
+		cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?typedExtraTags=true"})
+		require.NoError(t, err)
+		assert.False(t, cfg.TypedExtraTags)
+	})
+
+	t.Run("invalid url value", func(t *testing.T) {
+		_, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?typedExtraTags=maybe"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid typedExtraTags URL parameter value")
+	})
+}
+
+// TestParseConfig_TagDefaults verifies testidDefault/branchDefault/buildIdDefault
+// across config sources.
+func TestParseConfig_TagDefaults(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{})
+		require.NoError(t, err)
+		assert.Equal(t, "default", cfg.TestIDDefault)
+		assert.Equal(t, "master", cfg.BranchDefault)
+		assert.Equal(t, BuildIDDefaultTimestamp, cfg.BuildIDDefault)
+	})
+
+	t.Run("json config", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{
+				"testidDefault":  "error",
+				"branchDefault":  "main",
+				"buildIdDefault": "empty",
+			}),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, TagDefaultError, cfg.TestIDDefault)
+		assert.Equal(t, "main", cfg.BranchDefault)
+		assert.Equal(t, TagDefaultEmpty, cfg.BuildIDDefault)
+	})
+
+	t.Run("env overrides url", func(t *testing.T) {
+		t.Setenv("K6_CLICKHOUSE_BRANCH_DEFAULT", "trunk")
+		t.Setenv("K6_CLICKHOUSE_BUILD_ID_DEFAULT", "100")
+
+		cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?branchDefault=main&testidDefault=empty"})
+		require.NoError(t, err)
+		assert.Equal(t, TagDefaultEmpty, cfg.TestIDDefault)
+		assert.Equal(t, "trunk", cfg.BranchDefault)
+		assert.Equal(t, "100", cfg.BuildIDDefault)
+	})
+
+	t.Run("invalid build id default", func(t *testing.T) {
+		_, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?buildIdDefault=-1"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid buildIdDefault")
+	})
+}
+
+func TestParseConfig_NamedOutputs(t *testing.T) {
+	t.Setenv("K6_CLICKHOUSE_USER", "shared")
+	t.Setenv("K6_CLICKHOUSE_TABLE", "samples_all")
+	t.Setenv("K6_CLICKHOUSE_PRIMARY_TABLE", "samples_primary")
+	t.Setenv("K6_CLICKHOUSE_ARCHIVE_ADDR", "archive:9000")
+
+	primary, err := ParseConfig(output.Params{ConfigArgument: "ch1:9000?name=primary"})
+	require.NoError(t, err)
+	archive, err := ParseConfig(output.Params{ConfigArgument: "ch2:9000?name=archive"})
+	require.NoError(t, err)
+	unnamed, err := ParseConfig(output.Params{ConfigArgument: "ch3:9000"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "primary", primary.Name)
+	assert.Equal(t, "ch1:9000", primary.Addr)
+	assert.Equal(t, "samples_primary", primary.Table, "scoped variable wins")
+	assert.Equal(t, "shared", primary.User, "unscoped variable still applies")
+
+	assert.Equal(t, "archive:9000", archive.Addr)
+	assert.Equal(t, "samples_all", archive.Table)
+
+	assert.Equal(t, "primary", primary.InstanceName, "instance name defaults to name")
+	assert.Empty(t, unnamed.Name)
+	assert.Equal(t, "ch3:9000", unnamed.Addr, "scoped variables are ignored without a name")
+	assert.Equal(t, "samples_all", unnamed.Table)
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "ch1:9000?name=bad-name"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid name: bad-name")
+
+	// Errors name the variable that was read
+	t.Setenv("K6_CLICKHOUSE_RETRY_ATTEMPTS", "few")
+	t.Setenv("K6_CLICKHOUSE_ARCHIVE_RETRY_ATTEMPTS", "many")
+	_, err = ParseConfig(output.Params{ConfigArgument: "ch2:9000?name=archive"})
+	require.ErrorContains(t, err, `invalid K6_CLICKHOUSE_ARCHIVE_RETRY_ATTEMPTS value "many"`)
+	_, err = ParseConfig(output.Params{ConfigArgument: "ch1:9000?name=primary"})
+	require.ErrorContains(t, err, `invalid K6_CLICKHOUSE_RETRY_ATTEMPTS value "few"`)
+}
+
+func TestParseConfig_InstanceName(t *testing.T) {
+	cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?name=primary&instanceName=lg-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "lg-1", cfg.InstanceName)
+
+	t.Setenv("K6_CLICKHOUSE_PRIMARY_INSTANCE_NAME", "lg-2")
+	cfg, err = ParseConfig(output.Params{
+		JSONConfig:     mustMarshalJSON(map[string]any{"instanceName": "from-json"}),
+		ConfigArgument: "localhost:9000?name=primary",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "lg-2", cfg.InstanceName)
+
+	cfg, err = ParseConfig(output.Params{JSONConfig: mustMarshalJSON(map[string]any{"instanceName": "from-json"})})
+	require.NoError(t, err)
+	assert.Equal(t, "from-json", cfg.InstanceName)
+}
+
+func TestParseConfig_StrictJSON(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseConfig(output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"pushinterval": "5s",
+		"tls":          map[string]any{"enabled": true, "caFlie": "ca.pem"},
+		"retries":      3,
+	})})
+	require.Error(t, err)
+	assert.Equal(t, `json config key "pushinterval" must be written "pushInterval"`+"\n"+
+		`unknown json config key "retries"`+"\n"+
+		`unknown json config key "tls.caFlie" (did you mean "tls.caFile"?)`, err.Error())
+
+	cfg, err := ParseConfig(output.Params{
+		JSONConfig:     mustMarshalJSON(map[string]any{"pushinterval": "5s"}),
+		ConfigArgument: "localhost:9000?strictConfig=false&databse=k6",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, cfg.PushInterval, "encoding/json matches keys case-insensitively")
+	require.Error(t, cfg.ignoredKeys)
+	assert.Contains(t, cfg.ignoredKeys.Error(), `"pushinterval"`)
+	assert.Contains(t, cfg.ignoredKeys.Error(), `"databse"`)
 }
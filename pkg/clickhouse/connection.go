@@ -0,0 +1,180 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// defaultDialTimeout mirrors the clickhouse-go default dial timeout. It is only
+// used when the output installs its own dialer (see newDialContext), because a
+// custom DialContext bypasses the driver's built-in dial path.
+const defaultDialTimeout = 30 * time.Second
+
+// Default ports of the ClickHouse native protocol, plain and over TLS.
+const (
+	defaultNativePort    = "9000"
+	defaultNativeTLSPort = "9440"
+)
+
+// normalizeAddr completes an address given without a port with the default
+// native port, 9440 with TLS and 9000 otherwise, and writes IP addresses in
+// their canonical form. An IPv6 address is bracketed: "::1" becomes
+// "[::1]:9000". Without brackets an IPv6 address is taken whole, as no port
+// can be told apart from its last group. Malformed addresses are returned
+// unchanged for validateAddr.
+func normalizeAddr(addr string, tlsEnabled bool) string {
+	if addr == "" {
+		return addr
+	}
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip, err := netip.ParseAddr(host); err == nil {
+			return net.JoinHostPort(ip.String(), port)
+		}
+		return addr
+	}
+	host := addr
+	if ip, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")); err == nil {
+		host = ip.String()
+	} else if strings.Contains(addr, ":") {
+		return addr
+	}
+	port := defaultNativePort
+	if tlsEnabled {
+		port = defaultNativeTLSPort
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// validateAddr checks that addr is host:port with a port in 1-65535, so a
+// malformed address fails at startup rather than at dial time.
+func validateAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid addr %q: expected host:port: %w", addr, err)
+	}
+	if host == "" {
+		return fmt.Errorf("invalid addr %q: missing host", addr)
+	}
+	if strings.ContainsAny(host, "/@?# ") {
+		return fmt.Errorf("invalid addr %q: invalid host %q", addr, host)
+	}
+	if _, err := netip.ParseAddr(host); err != nil && strings.Contains(host, ":") {
+		return fmt.Errorf("invalid addr %q: invalid IPv6 address %q", addr, host)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid addr %q: port must be a number between 1 and 65535, got %q", addr, port)
+	}
+	return nil
+}
+
+// buildOptions assembles the clickhouse-go connection options from the config.
+// The database is intentionally left out of Auth: this allows CREATE DATABASE IF
+// NOT EXISTS to work when the target database doesn't exist, and all queries use
+// fully-qualified table names ({database}.{table}).
+//
+// dial, when non-nil, is an embedder-supplied dialer (see WithDialContext) that
+// takes precedence over the KeepAlive setting.
+func (c Config) buildOptions(tlsConfig *tls.Config, dial DialContextFunc) *clickhouse.Options {
+	opts := &clickhouse.Options{
+		Addr: []string{c.Addr},
+		Auth: clickhouse.Auth{
+			Username: c.User,
+			Password: c.Password,
+		},
+		TLS:                  tlsConfig,
+		ConnMaxLifetime:      c.ConnMaxLifetime,
+		BlockBufferSize:      uint8(c.BlockBufferSize), // range-checked in Validate()
+		MaxCompressionBuffer: c.MaxCompressionBuffer,
+	}
+
+	// The driver always applies its default TCP keep-alive; only take over the
+	// dial path when the user asked for a different probe interval.
+	switch {
+	case dial != nil:
+		opts.DialContext = wrapDialContext(dial, tlsConfig)
+	case c.KeepAlive != 0:
+		opts.DialContext = newDialContext(c.KeepAlive, tlsConfig)
+	}
+
+	return opts
+}
+
+// newDialContext returns a dial function with the given TCP keep-alive period.
+// Because the driver skips its own TLS handshake when DialContext is set, the
+// returned function performs the handshake itself when tlsConfig is non-nil.
+func newDialContext(keepAlive time.Duration, tlsConfig *tls.Config) func(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: keepAlive,
+	}
+
+	if tlsConfig == nil {
+		return func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}
+	}
+
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+}
+
+// wrapDialContext adapts an embedder-supplied dialer to the driver. As with
+// newDialContext, the TLS handshake is layered on top of the returned
+// connection when TLS is enabled, since the driver won't do it for us.
+func wrapDialContext(dial DialContextFunc, tlsConfig *tls.Config) func(ctx context.Context, addr string) (net.Conn, error) {
+	if tlsConfig == nil {
+		return dial
+	}
+
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := tlsConfig
+		if cfg.ServerName == "" {
+			// tls.Client, unlike tls.Dialer, does not derive SNI from the address.
+			cfg = tlsConfig.Clone()
+			if host, _, splitErr := net.SplitHostPort(addr); splitErr == nil {
+				cfg.ServerName = host
+			} else {
+				cfg.ServerName = addr
+			}
+		}
+
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("tls handshake over custom dialer: %w", err)
+		}
+		return tlsConn, nil
+	}
+}
+
+// openDB opens a database handle for the config and applies the pool settings
+// that clickhouse.OpenDB does not expose through Options. With Role set, every
+// connection activates the role first (see roleConnector).
+func (c Config) openDB(tlsConfig *tls.Config, dial DialContextFunc) *sql.DB {
+	var db *sql.DB
+	if c.Role != "" {
+		db = c.openRoleDB(c.buildOptions(tlsConfig, dial))
+	} else {
+		db = clickhouse.OpenDB(c.buildOptions(tlsConfig, dial))
+	}
+	if c.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+	return db
+}
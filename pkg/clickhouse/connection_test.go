@@ -0,0 +1,208 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestConfig_BuildOptions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("defaults leave driver dial path untouched", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := NewConfig()
+		opts := cfg.buildOptions(nil, nil)
+
+		assert.Equal(t, []string{"localhost:9000"}, opts.Addr)
+		assert.Equal(t, "default", opts.Auth.Username)
+		assert.Empty(t, opts.Auth.Database, "database must not be set in auth")
+		assert.Zero(t, opts.ConnMaxLifetime)
+		assert.Nil(t, opts.DialContext, "no custom dialer without a keepAlive override")
+	})
+
+	t.Run("conn max lifetime is passed through", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := NewConfig()
+		cfg.ConnMaxLifetime = 5 * time.Minute
+		opts := cfg.buildOptions(nil, nil)
+
+		assert.Equal(t, 5*time.Minute, opts.ConnMaxLifetime)
+	})
+
+	t.Run("driver buffer knobs are passed through", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := NewConfig()
+		cfg.BlockBufferSize = 10
+		cfg.MaxCompressionBuffer = 64 << 20
+		opts := cfg.buildOptions(nil, nil)
+
+		assert.Equal(t, uint8(10), opts.BlockBufferSize)
+		assert.Equal(t, 64<<20, opts.MaxCompressionBuffer)
+	})
+
+	t.Run("keepAlive installs a custom dialer", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := NewConfig()
+		cfg.KeepAlive = 30 * time.Second
+		opts := cfg.buildOptions(&tls.Config{MinVersion: tls.VersionTLS12}, nil)
+
+		assert.NotNil(t, opts.DialContext)
+		assert.NotNil(t, opts.TLS)
+	})
+}
+
+func TestNewDialContext_Plaintext(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+
+	accepted := make(chan struct{})
+	go func() {
+		conn, acceptErr := ln.Accept()
+		if acceptErr == nil {
+			_ = conn.Close()
+		}
+		close(accepted)
+	}()
+
+	dial := newDialContext(-1, nil) // keep-alive probes disabled
+	conn, err := dial(context.Background(), ln.Addr().String())
+	require.NoError(t, err)
+	_ = conn.Close()
+
+	<-accepted
+}
+
+func TestNewDialContext_TLSHandshakeAttempted(t *testing.T) {
+	t.Parallel()
+
+	// A plain TCP listener that closes immediately: a TLS dialer must fail the
+	// handshake, proving the handshake is performed by the custom dialer.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+
+	go func() {
+		conn, acceptErr := ln.Accept()
+		if acceptErr == nil {
+			_ = conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dial := newDialContext(10*time.Second, &tls.Config{MinVersion: tls.VersionTLS12, ServerName: "localhost"})
+	_, err = dial(ctx, ln.Addr().String())
+	assert.Error(t, err, "TLS handshake against a plain socket should fail")
+}
+
+func TestConfig_OpenDB(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.ConnMaxIdleTime = 30 * time.Second
+
+	db := cfg.openDB(nil, nil)
+	require.NotNil(t, db)
+	assert.NoError(t, db.Close())
+}
+
+func TestNormalizeAddr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		addr string
+		tls  bool
+		want string
+	}{
+		{"ch.example.com", false, "ch.example.com:9000"},
+		{"ch.example.com", true, "ch.example.com:9440"},
+		{"ch.example.com:9001", true, "ch.example.com:9001"},
+		{"10.0.0.7", false, "10.0.0.7:9000"},
+		{"::1", true, "[::1]:9440"},
+		{"[::1]", false, "[::1]:9000"},
+		{"[::1]:9001", false, "[::1]:9001"},
+		{"[0:0::1]:9001", false, "[::1]:9001"},
+		{"fe80::1%eth0", false, "[fe80::1%eth0]:9000"},
+		{"::1:9000", false, "[::1:9000]:9000"},  // unbracketed: all address
+		{"ch:9000:9000", false, "ch:9000:9000"}, // malformed, left to validateAddr
+		{"", false, ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, normalizeAddr(tt.addr, tt.tls), tt.addr)
+	}
+}
+
+func TestValidateAddr(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, validateAddr("ch.example.com:9440"))
+	require.NoError(t, validateAddr("[::1]:9000"))
+
+	for addr, want := range map[string]string{
+		"ch:9000:9000":   "expected host:port",
+		":9000":          "missing host",
+		"ch/k6:9000":     "invalid host",
+		"ch:native":      "port must be a number between 1 and 65535",
+		"ch:70000":       "port must be a number between 1 and 65535",
+		"ch.example.com": "expected host:port",
+		"[ch:1]:9000":    "invalid IPv6 address",
+	} {
+		assert.ErrorContains(t, validateAddr(addr), want, addr)
+	}
+}
+
+func TestParseConfig_DefaultPort(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{ConfigArgument: "ch.example.com?database=k6"})
+	require.NoError(t, err)
+	assert.Equal(t, "ch.example.com:9000", cfg.Addr)
+
+	cfg, err = ParseConfig(output.Params{ConfigArgument: "ch.example.com?tlsEnabled=true"})
+	require.NoError(t, err)
+	assert.Equal(t, "ch.example.com:9440", cfg.Addr)
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "ch.example.com:90000"})
+	assert.ErrorContains(t, err, `invalid addr "ch.example.com:90000"`)
+}
+
+func TestParseConfig_IPv6(t *testing.T) {
+	t.Parallel()
+
+	for arg, want := range map[string]string{
+		"::1?database=k6":                         "[::1]:9000",
+		"[::1]:9001?database=k6":                  "[::1]:9001",
+		"clickhouse://::1?database=k6":            "[::1]:9000",
+		"clickhouse://[::1]:9001/?database=k6":    "[::1]:9001",
+		"clickhouse://fe80::1%25eth0":             "[fe80::1%eth0]:9000",
+		"clickhouse://[2001:db8::7]?tlsEnabled=1": "[2001:db8::7]:9440",
+	} {
+		cfg, err := ParseConfig(output.Params{ConfigArgument: arg})
+		require.NoError(t, err, arg)
+		assert.Equal(t, want, cfg.Addr, arg)
+	}
+}
+
+func TestParseConfig_IPv6Env(t *testing.T) {
+	// NOT parallel: t.Setenv modifies process environment
+	t.Setenv("K6_CLICKHOUSE_ADDR", "2001:db8::7")
+
+	cfg, err := ParseConfig(output.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, "[2001:db8::7]:9000", cfg.Addr)
+}
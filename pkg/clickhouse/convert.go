@@ -0,0 +1,76 @@
+package clickhouse
+
+import (
+	"context"
+	"runtime"
+
+	"go.k6.io/k6/v2/metrics"
+	"golang.org/x/sync/errgroup"
+)
+
+// convertChunkSize is the number of samples one goroutine converts at a time.
+// A flush of at most one chunk is converted without spawning goroutines.
+const convertChunkSize = 1000
+
+// convertedRow is the outcome of converting one sample: a row of the target's
+// arity, or the error that rejected the sample.
+type convertedRow struct {
+	row []any
+	err error
+}
+
+// convertSamples converts samples with converter, up to GOMAXPROCS chunks at
+// once, and returns the outcomes in sample order so the batch is appended
+// exactly as a sequential conversion would. Rows whose length does not match
+// columns are released and reported as errors. If ctx is canceled, every
+// converted row is released and ctx.Err() is returned.
+func convertSamples(ctx context.Context, converter SampleConverter, columns []string, samples []metrics.Sample) ([]convertedRow, error) {
+	converted := make([]convertedRow, len(samples))
+
+	convertChunk := func(start int) error {
+		if ctx != nil {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		end := min(start+convertChunkSize, len(samples))
+		for i := start; i < end; i++ {
+			row, err := converter.Convert(ctx, samples[i])
+			if err == nil {
+				if err = rowArityError(row, columns); err != nil {
+					converter.Release(row)
+					row = nil
+				}
+			}
+			converted[i] = convertedRow{row: row, err: err}
+		}
+		return nil
+	}
+
+	var err error
+	if len(samples) <= convertChunkSize {
+		err = convertChunk(0)
+	} else {
+		var g errgroup.Group
+		g.SetLimit(runtime.GOMAXPROCS(0))
+		for start := 0; start < len(samples); start += convertChunkSize {
+			g.Go(func() error { return convertChunk(start) })
+		}
+		err = g.Wait()
+	}
+	if err != nil {
+		releaseConverted(converter, converted)
+		return nil, err
+	}
+	return converted, nil
+}
+
+// releaseConverted releases the rows of converted that were not appended to
+// a batch.
+func releaseConverted(converter SampleConverter, converted []convertedRow) {
+	for _, c := range converted {
+		if c.err == nil && c.row != nil {
+			converter.Release(c.row)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package clickhouse
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/v2/output"
+)
+
+// Actions taken when the conversion error rate exceeds MaxConvertErrorRate
+// (Config.ConvertErrorAction).
+const (
+	// ConvertErrorActionLog logs the breach at error level and keeps writing.
+	ConvertErrorActionLog = "log"
+
+	// ConvertErrorActionStopOutput stops this output from writing; later
+	// samples are discarded and counted as dropped. The test keeps running.
+	ConvertErrorActionStopOutput = "stopOutput"
+
+	// ConvertErrorActionAbortTest aborts the whole k6 test run.
+	ConvertErrorActionAbortTest = "abortTest"
+)
+
+// convertErrorRateMinSamples is the smallest flush window evaluated against
+// MaxConvertErrorRate, so a couple of bad samples in a near-idle window
+// cannot trip the guard.
+const convertErrorRateMinSamples = 50
+
+// Compile-time assertion that the output can abort the test run.
+var _ output.WithTestRunStop = (*Output)(nil)
+
+// SetTestRunStopCallback receives the k6 callback used to abort the test run
+// (convertErrorAction=abortTest). k6 calls it before Start.
+func (o *Output) SetTestRunStopCallback(stop func(error)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.testRunStop = stop
+}
+
+// validateConvertErrorGuard checks MaxConvertErrorRate and ConvertErrorAction.
+func (c Config) validateConvertErrorGuard() error {
+	if c.MaxConvertErrorRate < 0 || c.MaxConvertErrorRate > 1 {
+		return fmt.Errorf("max convert error rate must be between 0 and 1, got %v", c.MaxConvertErrorRate)
+	}
+	switch c.ConvertErrorAction {
+	case ConvertErrorActionLog, ConvertErrorActionStopOutput, ConvertErrorActionAbortTest:
+		return nil
+	default:
+		return fmt.Errorf("invalid convertErrorAction: %s (valid: %s, %s, %s)", c.ConvertErrorAction,
+			ConvertErrorActionLog, ConvertErrorActionStopOutput, ConvertErrorActionAbortTest)
+	}
+}
+
+// checkConvertErrorRate evaluates one flush window and applies
+// ConvertErrorAction when the share of failed conversions exceeds
+// MaxConvertErrorRate. Systematic tag problems otherwise drop most samples
+// with nothing but per-sample warnings.
+func (o *Output) checkConvertErrorRate(logger logrus.FieldLogger, failed uint64, total int) {
+	limit := o.config.MaxConvertErrorRate
+	if limit == 0 || total < convertErrorRateMinSamples {
+		return
+	}
+	rate := float64(failed) / float64(total)
+	if rate <= limit {
+		return
+	}
+
+	err := fmt.Errorf("%.1f%% of samples (%d/%d) failed conversion in one flush, exceeding maxConvertErrorRate %.1f%%",
+		rate*100, failed, total, limit*100)
+	logger = logger.WithError(err).WithField("action", o.config.ConvertErrorAction)
+
+	switch o.config.ConvertErrorAction {
+	case ConvertErrorActionStopOutput:
+		o.haltOutput(logger)
+	case ConvertErrorActionAbortTest:
+		o.mu.RLock()
+		stop := o.testRunStop
+		o.mu.RUnlock()
+		if stop == nil {
+			logger.Error("Conversion error rate exceeded and the test run cannot be aborted; stopping output instead")
+			o.haltOutput(logger)
+			return
+		}
+		o.abortOnce.Do(func() {
+			logger.Error("Conversion error rate exceeded, aborting test run")
+			stop(fmt.Errorf("clickhouse output: %w", err))
+		})
+	default:
+		logger.Error("Conversion error rate exceeded; most samples are being dropped — check tags against the schema")
+	}
+}
+
+// haltOutput stops all further writes from this output.
+func (o *Output) haltOutput(logger logrus.FieldLogger) {
+	if o.halted.CompareAndSwap(false, true) {
+		logger.Error("Conversion error rate exceeded, output stopped; further samples are discarded")
+	}
+}
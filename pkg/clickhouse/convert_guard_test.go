@@ -0,0 +1,155 @@
+package clickhouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestConfig_ValidateConvertErrorGuard(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		rate    float64
+		action  string
+		wantErr string
+	}{
+		{name: "disabled", rate: 0, action: ConvertErrorActionLog},
+		{name: "stop output", rate: 0.1, action: ConvertErrorActionStopOutput},
+		{name: "abort test", rate: 1, action: ConvertErrorActionAbortTest},
+		{name: "negative rate", rate: -0.1, action: ConvertErrorActionLog, wantErr: "between 0 and 1"},
+		{name: "rate above one", rate: 5, action: ConvertErrorActionLog, wantErr: "between 0 and 1"},
+		{name: "unknown action", rate: 0.1, action: "panic", wantErr: "invalid convertErrorAction: panic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := NewConfig()
+			cfg.MaxConvertErrorRate = tt.rate
+			cfg.ConvertErrorAction = tt.action
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestParseConfig_ConvertErrorGuard(t *testing.T) {
+	t.Setenv("K6_CLICKHOUSE_CONVERT_ERROR_ACTION", ConvertErrorActionAbortTest)
+
+	cfg, err := ParseConfig(output.Params{
+		JSONConfig:     mustMarshalJSON(map[string]any{"maxConvertErrorRate": 0.2, "convertErrorAction": "stopOutput"}),
+		ConfigArgument: "localhost:9000?maxConvertErrorRate=0.5",
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, cfg.MaxConvertErrorRate, 1e-9)
+	assert.Equal(t, ConvertErrorActionAbortTest, cfg.ConvertErrorAction)
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?maxConvertErrorRate=lots"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid maxConvertErrorRate URL parameter value")
+}
+
+// guardConfig configures a compatible-schema output with the conversion
+// error guard enabled.
+func guardConfig(action string) map[string]any {
+	return map[string]any{
+		"schemaMode":          "compatible",
+		"maxConvertErrorRate": 0.5,
+		"convertErrorAction":  action,
+	}
+}
+
+// addStatusSamples buffers n http_reqs samples; bad of them carry a
+// non-numeric status that the compatible converter rejects.
+func addStatusSamples(o *Output, n, bad int) {
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric(metrics.HTTPReqsName, metrics.Counter)
+	now := time.Now()
+
+	samples := make(metrics.Samples, 0, n)
+	for i := range n {
+		status := "200"
+		if i < bad {
+			status = "not-a-status"
+		}
+		samples = append(samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet().With("status", status)},
+			Time:       now,
+			Value:      1,
+		})
+	}
+	o.AddMetricSamples([]metrics.SampleContainer{samples})
+}
+
+func TestOutput_ConvertErrorRate_StopOutput(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, guardConfig(ConvertErrorActionStopOutput))
+
+	// Below the threshold: written normally
+	addStatusSamples(o, 100, 10)
+	o.flush()
+	require.Len(t, fake.Rows(), 90)
+	assert.False(t, o.halted.Load())
+
+	// Above the threshold: valid rows of this flush still commit, then the output halts
+	addStatusSamples(o, 100, 80)
+	o.flush()
+	require.Len(t, fake.Rows(), 110)
+	assert.True(t, o.halted.Load())
+
+	// Halted: later samples are discarded
+	addStatusSamples(o, 100, 0)
+	o.flush()
+	assert.Len(t, fake.Rows(), 110)
+	assert.Equal(t, uint64(100), o.GetErrorMetrics().DroppedSamples)
+}
+
+func TestOutput_ConvertErrorRate_SmallWindowIgnored(t *testing.T) {
+	t.Parallel()
+
+	_, o := startFakeOutput(t, guardConfig(ConvertErrorActionStopOutput))
+
+	addStatusSamples(o, convertErrorRateMinSamples-1, convertErrorRateMinSamples-1)
+	o.flush()
+	assert.False(t, o.halted.Load())
+}
+
+func TestOutput_ConvertErrorRate_AbortTest(t *testing.T) {
+	t.Parallel()
+
+	var stopErrs []error
+	_, o := startFakeOutput(t, guardConfig(ConvertErrorActionAbortTest))
+	o.SetTestRunStopCallback(func(err error) { stopErrs = append(stopErrs, err) })
+
+	addStatusSamples(o, 100, 100)
+	o.flush()
+	addStatusSamples(o, 100, 100)
+	o.flush()
+
+	require.Len(t, stopErrs, 1, "test run is aborted once")
+	assert.Contains(t, stopErrs[0].Error(), "maxConvertErrorRate")
+	assert.False(t, o.halted.Load())
+}
+
+func TestOutput_ConvertErrorRate_AbortWithoutCallback(t *testing.T) {
+	t.Parallel()
+
+	_, o := startFakeOutput(t, guardConfig(ConvertErrorActionAbortTest))
+
+	addStatusSamples(o, 100, 100)
+	o.flush()
+	assert.True(t, o.halted.Load(), "falls back to stopping the output")
+}
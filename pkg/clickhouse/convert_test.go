@@ -0,0 +1,76 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// valueConverter converts a sample to a one-column row of its value,
+// rejecting negative values, and counts the rows it releases.
+type valueConverter struct {
+	released *atomic.Int64
+}
+
+func (c valueConverter) Convert(_ context.Context, sample metrics.Sample) ([]any, error) {
+	if sample.Value < 0 {
+		return nil, errors.New("negative value")
+	}
+	if sample.Value == 7 {
+		return []any{sample.Value, "extra"}, nil
+	}
+	return []any{sample.Value}, nil
+}
+
+func (c valueConverter) Release([]any) { c.released.Add(1) }
+
+func valueSamples(n int) []metrics.Sample {
+	m := &metrics.Metric{Name: "iterations", Type: metrics.Counter}
+	samples := make([]metrics.Sample, n)
+	for i := range samples {
+		samples[i] = metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: m}, Value: float64(i)}
+	}
+	return samples
+}
+
+func TestConvertSamples(t *testing.T) {
+	t.Parallel()
+
+	samples := valueSamples(5*convertChunkSize + 17)
+	samples[3].Value = -1
+	converter := valueConverter{released: &atomic.Int64{}}
+
+	converted, err := convertSamples(context.Background(), converter, []string{"value"}, samples)
+	require.NoError(t, err)
+	require.Len(t, converted, len(samples))
+	for i, c := range converted {
+		switch i {
+		case 3:
+			require.EqualError(t, c.err, "negative value")
+		case 7:
+			require.ErrorContains(t, c.err, "converter returned 2 values for 1 columns")
+			assert.Nil(t, c.row)
+		default:
+			require.NoError(t, c.err)
+			require.Equal(t, []any{float64(i)}, c.row, "rows keep the sample order")
+		}
+	}
+	assert.Equal(t, int64(1), converter.released.Load(), "the row of the wrong length is released")
+}
+
+func TestConvertSamples_Canceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	converter := valueConverter{released: &atomic.Int64{}}
+
+	_, err := convertSamples(ctx, converter, nil, valueSamples(3*convertChunkSize))
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, converter.released.Load(), "nothing was converted")
+}
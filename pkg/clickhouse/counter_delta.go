@@ -0,0 +1,145 @@
+package clickhouse
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// Counter modes (Config.CounterMode).
+const (
+	// CounterModeRaw writes one row per Counter sample.
+	CounterModeRaw = "raw"
+
+	// CounterModeDelta writes one row per Counter series and flush, holding
+	// the series' increase during the flush in value and the delta column.
+	CounterModeDelta = "delta"
+)
+
+// deltaColumn holds the per-flush increase of a Counter series with
+// CounterModeDelta.
+const deltaColumn = "delta"
+
+// counterDeltaKey is the metadata key carrying the increase of an aggregated
+// Counter sample from the aggregation to the converters.
+const counterDeltaKey = "counter_delta"
+
+// validateCounterMode checks CounterMode.
+func (c Config) validateCounterMode() error {
+	switch c.CounterMode {
+	case "", CounterModeRaw, CounterModeDelta:
+		return nil
+	default:
+		return fmt.Errorf("invalid counterMode: %s (valid: %s, %s)", c.CounterMode, CounterModeRaw, CounterModeDelta)
+	}
+}
+
+// counterDelta reports whether Counter samples are aggregated per flush.
+func (c Config) counterDelta() bool { return c.CounterMode == CounterModeDelta }
+
+// deltaColumnDDL returns the definition of the delta column, or "" when
+// disabled.
+func deltaColumnDDL(enabled bool) string {
+	if !enabled {
+		return ""
+	}
+	return ",\n\t\t\t" + deltaColumn + " Float64 DEFAULT 0"
+}
+
+// hasDeltaColumn reports whether schema writes the delta column.
+func hasDeltaColumn(schema SchemaCreator) bool {
+	switch s := schema.(type) {
+	case SimpleSchema:
+		return s.counterDelta
+	case CompatibleSchema:
+		return s.opts.counterDelta
+	default:
+		return false
+	}
+}
+
+// sampleDelta returns the increase recorded on an aggregated Counter sample,
+// or 0 for any other sample.
+func sampleDelta(sample metrics.Sample) float64 {
+	v, ok := sample.Metadata[counterDeltaKey]
+	if !ok {
+		return 0
+	}
+	delta, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0
+	}
+	return delta
+}
+
+// counterAggregator folds the Counter samples of each flush into one sample
+// per series.
+type counterAggregator struct{}
+
+// newCounterAggregator returns nil unless CounterMode is delta.
+func newCounterAggregator(mode string) *counterAggregator {
+	if mode != CounterModeDelta {
+		return nil
+	}
+	return &counterAggregator{}
+}
+
+// aggregate returns samples with the Counter samples replaced by one sample
+// per series, appended after the other samples in the order the series were
+// first seen. The aggregated sample has the time of the series' last sample
+// in the flush and the increase as value and as metadata; the metadata of
+// the folded samples is dropped.
+func (a *counterAggregator) aggregate(samples []metrics.SampleContainer) []metrics.SampleContainer {
+	var (
+		order  []metrics.TimeSeries
+		deltas = make(map[metrics.TimeSeries]*metrics.Sample)
+		out    = make([]metrics.SampleContainer, 0, len(samples)+1)
+	)
+	for _, sc := range samples {
+		all := sc.GetSamples()
+		var kept metrics.Samples
+		for i, s := range all {
+			if s.Metric == nil || s.Metric.Type != metrics.Counter {
+				if kept != nil {
+					kept = append(kept, s)
+				}
+				continue
+			}
+			if kept == nil {
+				kept = append(make(metrics.Samples, 0, len(all)), all[:i]...)
+			}
+			d, ok := deltas[s.TimeSeries]
+			if !ok {
+				d = &metrics.Sample{TimeSeries: s.TimeSeries, Time: s.Time}
+				deltas[s.TimeSeries] = d
+				order = append(order, s.TimeSeries)
+			}
+			d.Value += s.Value
+			if s.Time.After(d.Time) {
+				d.Time = s.Time
+			}
+		}
+		switch {
+		case kept == nil:
+			out = append(out, sc) // no Counter samples
+		case len(kept) > 0:
+			out = append(out, kept)
+		}
+	}
+	if len(order) == 0 {
+		return samples
+	}
+
+	aggregated := make(metrics.Samples, len(order))
+	for i, series := range order {
+		d := deltas[series]
+		aggregated[i] = metrics.Sample{
+			TimeSeries: series,
+			Time:       d.Time,
+			Value:      d.Value,
+			Metadata:   map[string]string{counterDeltaKey: strconv.FormatFloat(d.Value, 'g', -1, 64)},
+		}
+	}
+	return append(out, aggregated)
+}
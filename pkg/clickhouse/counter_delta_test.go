@@ -0,0 +1,112 @@
+package clickhouse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestCounterAggregator(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newCounterAggregator(CounterModeRaw))
+
+	registry := metrics.NewRegistry()
+	reqs := registry.MustNewMetric(metrics.HTTPReqsName, metrics.Counter)
+	duration := registry.MustNewMetric(metrics.HTTPReqDurationName, metrics.Trend)
+	ok := metrics.TimeSeries{Metric: reqs, Tags: registry.RootTagSet().With("status", "200")}
+	failed := metrics.TimeSeries{Metric: reqs, Tags: registry.RootTagSet().With("status", "500")}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	a := newCounterAggregator(CounterModeDelta)
+	trends := metrics.Samples{{TimeSeries: metrics.TimeSeries{Metric: duration}, Time: at(0), Value: 12}}
+	got := a.aggregate([]metrics.SampleContainer{
+		trends,
+		metrics.Samples{
+			{TimeSeries: ok, Time: at(2), Value: 1, Metadata: map[string]string{"vu": "1"}},
+			{TimeSeries: metrics.TimeSeries{Metric: duration}, Time: at(2), Value: 34},
+			{TimeSeries: failed, Time: at(3), Value: 1},
+		},
+		metrics.Samples{{TimeSeries: ok, Time: at(1), Value: 1}},
+	})
+	require.Len(t, got, 3, "the trend-only container, the rest of the mixed one, and the aggregates")
+	assert.Equal(t, trends, got[0], "containers without counters pass through")
+	assert.Equal(t, metrics.Samples{{TimeSeries: metrics.TimeSeries{Metric: duration}, Time: at(2), Value: 34}}, got[1])
+	assert.Equal(t, []metrics.Sample{
+		{TimeSeries: ok, Time: at(2), Value: 2, Metadata: map[string]string{counterDeltaKey: "2"}},
+		{TimeSeries: failed, Time: at(3), Value: 1, Metadata: map[string]string{counterDeltaKey: "1"}},
+	}, got[2].GetSamples())
+
+	// Each flush starts from zero
+	got = a.aggregate([]metrics.SampleContainer{metrics.Samples{{TimeSeries: ok, Time: at(5), Value: 3}}})
+	require.Len(t, got, 1)
+	sample := got[0].GetSamples()[0]
+	assert.InDelta(t, 3.0, sample.Value, 0)
+	assert.InDelta(t, 3.0, sampleDelta(sample), 0)
+
+	assert.Nil(t, a.aggregate(nil))
+	assert.Zero(t, sampleDelta(metrics.Sample{}))
+}
+
+func TestConfig_CounterMode(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?counterMode=delta"})
+	require.NoError(t, err)
+	assert.Equal(t, CounterModeDelta, cfg.CounterMode)
+	assert.Equal(t, CounterModeRaw, NewConfig().CounterMode)
+
+	cfg.CounterMode = "cumulative"
+	require.ErrorContains(t, cfg.Validate(), "invalid counterMode: cumulative (valid: raw, delta)")
+}
+
+func TestSchemas_CounterDelta(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.CounterMode = CounterModeDelta
+	for _, configure := range []func(Config) (SchemaImplementation, error){configureSimple, configureCompatible} {
+		impl, err := configure(cfg)
+		require.NoError(t, err)
+
+		fake, db := newFakeDB(t)
+		require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		assert.Regexp(t, `delta\s+Float64 DEFAULT 0`, fake.DDL()[1], impl.Name)
+		assert.Contains(t, impl.Converter.(ColumnNamer).ColumnNames(), deltaColumn, impl.Name)
+		assert.True(t, hasDeltaColumn(impl.Schema), impl.Name)
+	}
+}
+
+func TestOutput_CounterDelta(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{"counterMode": "delta", "pushInterval": "1h"})
+
+	registry := metrics.NewRegistry()
+	reqs := registry.MustNewMetric(metrics.HTTPReqsName, metrics.Counter)
+	duration := registry.MustNewMetric(metrics.HTTPReqDurationName, metrics.Trend)
+	now := time.Now()
+	send := func(n int) {
+		samples := metrics.Samples{{TimeSeries: metrics.TimeSeries{Metric: duration}, Time: now, Value: 120}}
+		for range n {
+			samples = append(samples, metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: reqs}, Time: now, Value: 1})
+		}
+		o.AddMetricSamples([]metrics.SampleContainer{samples})
+		o.flush()
+	}
+	send(3)
+	send(2)
+
+	// timestamp, metric, value, tags, delta
+	rows := fake.Rows()
+	require.Len(t, rows, 4, "one row per trend sample and one per counter series and flush")
+	assert.Equal(t, []any{metrics.HTTPReqDurationName, 120.0, 0.0}, []any{rows[0][1], rows[0][2], rows[0][4]})
+	assert.Equal(t, []any{metrics.HTTPReqsName, 3.0, 3.0}, []any{rows[1][1], rows[1][2], rows[1][4]})
+	assert.Equal(t, []any{metrics.HTTPReqsName, 2.0, 2.0}, []any{rows[3][1], rows[3][2], rows[3][4]}, "sum(value) stays the count")
+}
@@ -0,0 +1,143 @@
+package clickhouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// deadLetter is a sample rejected for data reasons, with the reason.
+type deadLetter struct {
+	sample metrics.Sample
+	err    error
+}
+
+// deadLetterSink appends rejected samples to one NDJSON file per table and
+// run in DeadLetterDir:
+// deadletter.<database>.<table>.<unix-nanos>.ndjson. Records use the spill
+// format plus an "error" field, so they can be inspected, fixed, and fed
+// back by hand. Files are opened on the first rejected sample.
+type deadLetterSink struct {
+	dir      string
+	database string
+	runID    int64 // Start time, shared by the files of one run
+
+	mu    sync.Mutex
+	files map[string]*os.File // by table
+}
+
+// newDeadLetterSink returns a sink writing to dir, or nil when dir is empty.
+func newDeadLetterSink(dir, database string) *deadLetterSink {
+	if dir == "" {
+		return nil
+	}
+	return &deadLetterSink{
+		dir:      dir,
+		database: database,
+		runID:    time.Now().UnixNano(),
+		files:    make(map[string]*os.File),
+	}
+}
+
+// write appends letters to the table's dead-letter file and returns the
+// file path.
+func (d *deadLetterSink) write(table string, letters []deadLetter) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path := filepath.Join(d.dir, fmt.Sprintf("deadletter.%s.%s.%d%s", d.database, table, d.runID, spillFileExt))
+	f := d.files[table]
+	if f == nil {
+		if err := os.MkdirAll(d.dir, 0o750); err != nil {
+			return "", fmt.Errorf("failed to create dead-letter directory: %w", err)
+		}
+		var err error
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) // #nosec G304 - dir is operator config, name is built from identifiers
+		if err != nil {
+			return "", fmt.Errorf("failed to open dead-letter file: %w", err)
+		}
+		d.files[table] = f
+	}
+
+	// One write per batch keeps concurrent readers from seeing partial lines
+	var buf []byte
+	for _, l := range letters {
+		rec := newSpillRecord(l.sample)
+		rec.Error = l.err.Error()
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode dead-letter record: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	if _, err := f.Write(buf); err != nil {
+		return "", fmt.Errorf("failed to write dead-letter file: %w", err)
+	}
+	return path, nil
+}
+
+// close closes every open dead-letter file.
+func (d *deadLetterSink) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var firstErr error
+	for table, f := range d.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close dead-letter file for %s: %w", table, err)
+		}
+		delete(d.files, table)
+	}
+	return firstErr
+}
+
+// containerLetters expands the samples of a rejected batch into dead letters
+// sharing one reason, keeping only those routed to the target.
+func containerLetters(t *schemaTarget, samples []metrics.SampleContainer, err error) []deadLetter {
+	var letters []deadLetter
+	for _, sc := range samples {
+		for _, s := range sc.GetSamples() {
+			if t.accept == nil || t.accept(s) {
+				letters = append(letters, deadLetter{sample: s, err: err})
+			}
+		}
+	}
+	return letters
+}
+
+// divertDeadLetters writes samples that failed conversion to the dead-letter
+// sink. Without a sink they have already been logged and counted as
+// conversion errors.
+func (o *Output) divertDeadLetters(logger logrus.FieldLogger, t *schemaTarget, letters []deadLetter) {
+	if o.deadLetter == nil || len(letters) == 0 {
+		return
+	}
+	path, err := o.deadLetter.write(t.table, letters)
+	if err != nil {
+		logger.WithError(err).WithField("samples", len(letters)).Error("Failed to write dead-letter samples")
+		return
+	}
+	o.deadLetterSamples.Add(uint64(len(letters)))
+	logger.WithFields(logrus.Fields{
+		"deadLetterFile": path,
+		"samples":        len(letters),
+	}).Warn("Samples rejected for data errors written to dead-letter file")
+}
+
+// rejectBatch handles a batch the server refused for data reasons: replaying
+// it would fail the same way and block every later flush, so it is never
+// buffered. It goes to the dead-letter sink, or is counted as dropped.
+func (o *Output) rejectBatch(logger logrus.FieldLogger, t *schemaTarget, samples []metrics.SampleContainer, err error) {
+	if o.deadLetter != nil {
+		o.divertDeadLetters(logger, t, containerLetters(t, samples, err))
+		return
+	}
+	o.droppedSamples.Add(uint64(len(samples)))
+	logger.WithError(err).WithField("lostSamples", len(samples)).Error("Batch rejected for data errors, not buffering it (set deadLetterDir to keep such samples)")
+}
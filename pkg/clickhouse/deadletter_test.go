@@ -0,0 +1,149 @@
+package clickhouse
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// deadLetterConfig configures a compatible-schema output writing rejected
+// samples to dir ("" disables the sink).
+func deadLetterConfig(dir string) map[string]any {
+	return map[string]any{
+		"schemaMode":    "compatible",
+		"pushInterval":  "1h",
+		"retryAttempts": 2,
+		"retryDelay":    "1ms",
+		"retryMaxDelay": "1ms",
+		"deadLetterDir": dir,
+	}
+}
+
+// deadLetterRecords reads the records of the single dead-letter file in dir.
+func deadLetterRecords(t *testing.T, dir string) []spillRecord {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "deadletter.k6.samples.*"+spillFileExt))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	return readSpillRecords(t, files[0])
+}
+
+func TestDeadLetter_ConversionErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	fake, o := startFakeOutput(t, deadLetterConfig(dir))
+
+	addStatusSamples(o, 3, 1)
+	o.flush()
+
+	assert.Len(t, fake.Rows(), 2)
+	stats := o.GetErrorMetrics()
+	assert.Equal(t, uint64(1), stats.DeadLetterSamples)
+	assert.Equal(t, uint64(1), stats.ConvertErrors)
+
+	records := deadLetterRecords(t, dir)
+	require.Len(t, records, 1)
+	assert.Equal(t, "not-a-status", records[0].Tags["status"])
+	assert.Contains(t, records[0].Error, "status")
+
+	// Later rejections append to the same file
+	addStatusSamples(o, 2, 2)
+	o.flush()
+	assert.Len(t, deadLetterRecords(t, dir), 3)
+}
+
+func TestDeadLetter_DataErrorBatch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	fake, o := startFakeOutput(t, deadLetterConfig(dir))
+
+	fake.set(func(f *fakeDB) {
+		f.execErr = &clickhouse.Exception{Code: 321, Name: "VALUE_IS_OUT_OF_RANGE_OF_DATA_TYPE"}
+	})
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	fake.set(func(f *fakeDB) { f.execErr = nil })
+
+	stats := o.GetErrorMetrics()
+	assert.Zero(t, stats.RetryAttempts, "data errors are not retried")
+	assert.Zero(t, stats.BufferedSamples, "data errors are not buffered")
+	assert.Equal(t, uint64(3), stats.DeadLetterSamples)
+
+	records := deadLetterRecords(t, dir)
+	require.Len(t, records, 3)
+	assert.Contains(t, records[0].Error, "code: 321")
+
+	// The next flush is not blocked by the rejected batch
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	assert.Len(t, fake.Rows(), 1)
+}
+
+func TestDeadLetter_DataErrorWithoutSink(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, deadLetterConfig(""))
+
+	fake.set(func(f *fakeDB) { f.execErr = &clickhouse.Exception{Code: 6, Name: "CANNOT_PARSE_TEXT"} })
+	addStatusSamples(o, 3, 0)
+	o.flush()
+
+	stats := o.GetErrorMetrics()
+	assert.Zero(t, stats.BufferedSamples)
+	assert.Equal(t, uint64(1), stats.DroppedSamples, "the rejected container is dropped")
+	assert.Zero(t, stats.DeadLetterSamples)
+}
+
+func TestDeadLetter_TransientErrorBuffers(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	fake, o := startFakeOutput(t, deadLetterConfig(dir))
+
+	fake.set(func(f *fakeDB) { f.execErr = errors.New("connection refused") })
+	addStatusSamples(o, 3, 1)
+	o.flush()
+
+	// The batch is buffered; its conversion failure is reported once the
+	// buffered batch is finally delivered
+	stats := o.GetErrorMetrics()
+	assert.Equal(t, uint64(1), stats.BufferedSamples)
+	assert.Zero(t, stats.DeadLetterSamples)
+
+	fake.set(func(f *fakeDB) { f.execErr = nil })
+	o.flush()
+	assert.Len(t, fake.Rows(), 2)
+	assert.Equal(t, uint64(1), o.GetErrorMetrics().DeadLetterSamples)
+	assert.Len(t, deadLetterRecords(t, dir), 1)
+}
+
+func TestSpillFiles_IgnoresOtherFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	sink := newDeadLetterSink(dir, "k6")
+	registry := metrics.NewRegistry()
+	_, err := sink.write("samples", []deadLetter{{
+		sample: metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("custom", metrics.Counter), Tags: registry.RootTagSet()},
+			Time:       time.Now(),
+		},
+		err: errors.New("bad"),
+	}})
+	require.NoError(t, err)
+	require.NoError(t, sink.close())
+	spill, _, err := writeSpillFile(dir, "k6", "samples", nil)
+	require.NoError(t, err)
+
+	files, err := spillFiles(dir, "k6", "samples")
+	require.NoError(t, err)
+	assert.Equal(t, []string{spill}, files)
+}
@@ -0,0 +1,131 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Table engines (Config.TableEngine) of the tables created by the built-in
+// schemas.
+const (
+	// EngineMergeTree creates plain MergeTree tables (default).
+	EngineMergeTree = "MergeTree"
+
+	// EngineReplacingMergeTree creates ReplacingMergeTree tables versioned by
+	// the row_version column, so rows written twice collapse into one.
+	EngineReplacingMergeTree = "ReplacingMergeTree"
+)
+
+// Partition keys (Config.PartitionBy) of the tables created by the built-in
+// schemas.
+const (
+	// PartitionByTime partitions by the schema's time bucket (default): the
+	// month for the compatible schema, the day for the simple one.
+	PartitionByTime = "time"
+
+	// PartitionByTestID creates one partition per test run.
+	PartitionByTestID = "testid"
+
+	// PartitionByTestIDTime partitions by test run and time bucket.
+	PartitionByTestIDTime = "testid_time"
+)
+
+// rowVersionColumn is the version column of ReplacingMergeTree tables.
+const rowVersionColumn = "row_version"
+
+// validateTableEngine checks the TableEngine value.
+func (c Config) validateTableEngine() error {
+	switch c.TableEngine {
+	case EngineMergeTree, EngineReplacingMergeTree:
+		return nil
+	default:
+		return fmt.Errorf("invalid tableEngine: %s (valid: %s, %s)", c.TableEngine, EngineMergeTree, EngineReplacingMergeTree)
+	}
+}
+
+// validatePartitionBy checks the PartitionBy value.
+func (c Config) validatePartitionBy() error {
+	switch c.PartitionBy {
+	case PartitionByTime, PartitionByTestID, PartitionByTestIDTime:
+		return nil
+	default:
+		return fmt.Errorf("invalid partitionBy: %s (valid: %s, %s, %s)",
+			c.PartitionBy, PartitionByTime, PartitionByTestID, PartitionByTestIDTime)
+	}
+}
+
+// partitionByDDL returns the partition key for partitionBy, given the
+// schema's time bucket and testid expressions.
+func partitionByDDL(partitionBy, timeExpr, testidExpr string) string {
+	switch partitionBy {
+	case PartitionByTestID:
+		return testidExpr
+	case PartitionByTestIDTime:
+		return "(" + testidExpr + ", " + timeExpr + ")"
+	default:
+		return timeExpr
+	}
+}
+
+// versioned reports whether engine tables carry the row_version column.
+func versioned(engine string) bool {
+	return engine == EngineReplacingMergeTree
+}
+
+// engineDDL returns the ENGINE expression for engine.
+func engineDDL(engine string) string {
+	if versioned(engine) {
+		return "ReplacingMergeTree(" + rowVersionColumn + ")"
+	}
+	return "MergeTree()"
+}
+
+// orderByDDL returns the sorting key of a table: key for MergeTree. A
+// ReplacingMergeTree collapses rows with equal sorting keys, so its key is
+// extended with a hash of identity (the remaining columns that tell samples
+// apart) and the value; only rows equal in every column are duplicates.
+func orderByDDL(engine, key string, identity []string) string {
+	if !versioned(engine) {
+		return "(" + key + ")"
+	}
+	return fmt.Sprintf("(%s, cityHash64(toString(tuple(%s))), value)", key, strings.Join(identity, ", "))
+}
+
+// rowVersionDDL returns the definition of the row_version column, appended to
+// the last column of a built-in schema, or "" for unversioned engines.
+func rowVersionDDL(engine string) string {
+	if !versioned(engine) {
+		return ""
+	}
+	return ",\n\t\t\t" + rowVersionColumn + " UInt64"
+}
+
+// rowVersionKey is the context key of the row_version of an insert.
+type rowVersionKey struct{}
+
+// withRowVersion makes the rows converted with ctx carry version.
+func withRowVersion(ctx context.Context, version uint64) context.Context {
+	return context.WithValue(ctx, rowVersionKey{}, version)
+}
+
+// rowVersion returns the row_version set on ctx, or 0.
+func rowVersion(ctx context.Context) uint64 {
+	version, _ := ctx.Value(rowVersionKey{}).(uint64)
+	return version
+}
+
+// nextRowVersion returns a version above every version returned before. It
+// follows the clock (in nanoseconds), so a later run, replaying what an
+// earlier one left behind, also writes higher versions.
+func (o *Output) nextRowVersion() uint64 {
+	now := uint64(max(time.Now().UnixNano(), 0)) //nolint:gosec // G115: clamped to non-negative
+	for {
+		last := o.rowVersion.Load()
+		next := max(now, last+1)
+		if o.rowVersion.CompareAndSwap(last, next) {
+			return next
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package clickhouse
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_ValidateTableEngine(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	require.NoError(t, cfg.validateTableEngine())
+	cfg.TableEngine = EngineReplacingMergeTree
+	require.NoError(t, cfg.validateTableEngine())
+	cfg.TableEngine = "Log"
+	assert.ErrorContains(t, cfg.Validate(), "invalid tableEngine")
+}
+
+func TestSchemas_ReplacingMergeTree(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.TableEngine = EngineReplacingMergeTree
+	cfg.ProtocolColumn = true
+
+	simple, err := configureSimple(cfg)
+	require.NoError(t, err)
+	fake, db := newFakeDB(t)
+	require.NoError(t, simple.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	ddl := fake.DDL()[1]
+	assert.Contains(t, ddl, "row_version UInt64")
+	assert.Contains(t, ddl, "ENGINE = ReplacingMergeTree(row_version)")
+	assert.Contains(t, ddl, "ORDER BY (metric, timestamp, cityHash64(toString(tuple(tags))), value)")
+	assert.Contains(t, simple.Schema.InsertQuery("k6", "samples"), "tags, row_version) VALUES (?, ?, ?, ?, ?)")
+
+	compat, err := configureCompatible(cfg)
+	require.NoError(t, err)
+	fake, db = newFakeDB(t)
+	require.NoError(t, compat.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	ddl = fake.DDL()[1]
+	assert.Contains(t, ddl, "ENGINE = ReplacingMergeTree(row_version)")
+	assert.Contains(t, ddl, "group_name, extra_tags, protocol))), value)", "optional columns are part of the identity")
+	assert.Contains(t, compat.Schema.InsertQuery("k6", "samples"), "protocol, row_version")
+
+	// The default engine keeps the historical layout
+	fake, db = newFakeDB(t)
+	base, err := configureSimple(NewConfig())
+	require.NoError(t, err)
+	require.NoError(t, base.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	assert.Contains(t, fake.DDL()[1], "ENGINE = MergeTree()")
+	assert.Contains(t, fake.DDL()[1], "ORDER BY (metric, timestamp)\n")
+}
+
+func TestOutput_RowVersion(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval": "1h",
+		"tableEngine":  EngineReplacingMergeTree,
+	})
+
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	require.NoError(t, o.Stop())
+
+	rows := fake.Rows()
+	require.Len(t, rows, 3)
+	first, second := rows[0][4].(uint64), rows[2][4].(uint64)
+	assert.NotZero(t, first)
+	assert.Equal(t, first, rows[1][4], "rows of one insert share a version")
+	assert.Greater(t, second, first, "later inserts supersede earlier ones")
+}
+
+func TestOutput_NextRowVersion(t *testing.T) {
+	t.Parallel()
+
+	o := &Output{}
+	o.rowVersion.Store(^uint64(0) - 1) // A clock far ahead, as after a skew
+	assert.Equal(t, ^uint64(0), o.nextRowVersion(), "versions never go backwards")
+}
+
+func TestSchemas_PartitionBy(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.PartitionBy = "run"
+	assert.ErrorContains(t, cfg.Validate(), "invalid partitionBy")
+
+	tests := []struct {
+		name        string
+		partitionBy string
+		tagStorage  string
+		configure   func(Config) (SchemaImplementation, error)
+		expected    string
+	}{
+		{name: "compatible default", partitionBy: PartitionByTime, configure: configureCompatible, expected: "PARTITION BY toYYYYMM(timestamp)\n"},
+		{name: "compatible testid", partitionBy: PartitionByTestID, configure: configureCompatible, expected: "PARTITION BY testid\n"},
+		{name: "compatible testid and month", partitionBy: PartitionByTestIDTime, configure: configureCompatible, expected: "PARTITION BY (testid, toYYYYMM(timestamp))\n"},
+		{name: "simple default", partitionBy: PartitionByTime, configure: configureSimple, expected: "PARTITION BY toYYYYMMDD(timestamp)\n"},
+		{name: "simple map", partitionBy: PartitionByTestID, configure: configureSimple, expected: "PARTITION BY tags['testid']\n"},
+		{name: "simple string", partitionBy: PartitionByTestIDTime, tagStorage: TagStorageString, configure: configureSimple, expected: "PARTITION BY (JSONExtractString(tags, 'testid'), toYYYYMMDD(timestamp))\n"},
+		{name: "simple json", partitionBy: PartitionByTestID, tagStorage: TagStorageJSON, configure: configureSimple, expected: "PARTITION BY JSONExtractString(toString(tags), 'testid')\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := NewConfig()
+			cfg.PartitionBy = tt.partitionBy
+			if tt.tagStorage != "" {
+				cfg.TagStorage = tt.tagStorage
+			}
+			impl, err := tt.configure(cfg)
+			require.NoError(t, err)
+			fake, db := newFakeDB(t)
+			require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+			assert.Contains(t, fake.DDL()[1], tt.expected)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package clickhouse
+
+import "strconv"
+
+// k6ErrorNames names the error codes k6 writes to the error_code tag, after
+// the k6 error-code taxonomy (lib/netext/httpext/error_codes.go).
+var k6ErrorNames = map[int]string{
+	1000: "generic",
+	1010: "non_tcp_network",
+	1020: "invalid_url",
+	1050: "request_timeout",
+	1100: "dns",
+	1101: "dns_no_such_host",
+	1110: "blacklisted_ip",
+	1111: "blocked_hostname",
+	1200: "tcp",
+	1201: "tcp_broken_pipe",
+	1202: "tcp_unknown_errno",
+	1210: "dial",
+	1211: "dial_timeout",
+	1212: "dial_refused",
+	1213: "dial_unknown_errno",
+	1220: "tcp_reset_by_peer",
+	1300: "tls",
+	1301: "tls_header",
+	1310: "x509_unknown_authority",
+	1311: "x509_hostname_mismatch",
+	1600: "http2",
+	1610: "http2_goaway",
+	1630: "http2_stream",
+	1650: "http2_connection",
+	1701: "response_decompression",
+}
+
+// http2ErrorNames names the HTTP/2 error codes, which k6 adds (plus one) to
+// the GoAway, stream, and connection error codes.
+var http2ErrorNames = [...]string{
+	"no_error",
+	"protocol_error",
+	"internal_error",
+	"flow_control_error",
+	"settings_timeout",
+	"stream_closed",
+	"frame_size_error",
+	"refused_stream",
+	"cancel",
+	"compression_error",
+	"connect_error",
+	"enhance_your_calm",
+	"inadequate_security",
+	"http_1_1_required",
+}
+
+// errorName returns the name of a k6 error_code tag value: "http_404" for
+// 1404 (k6 reports 4xx/5xx responses as 1000 + status), "http2_stream_cancel"
+// for 1639, and so on. Codes outside the taxonomy are "unknown"; an empty or
+// non-numeric code has no name.
+func errorName(code string) string {
+	if code == "" {
+		return ""
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil {
+		return ""
+	}
+	if name, ok := k6ErrorNames[n]; ok {
+		return name
+	}
+	switch {
+	case n >= 1400 && n < 1600:
+		return "http_" + strconv.Itoa(n-1000)
+	case n > 1610 && n <= 1610+len(http2ErrorNames):
+		return "http2_goaway_" + http2ErrorNames[n-1611]
+	case n > 1630 && n <= 1630+len(http2ErrorNames):
+		return "http2_stream_" + http2ErrorNames[n-1631]
+	case n > 1650 && n <= 1650+len(http2ErrorNames):
+		return "http2_connection_" + http2ErrorNames[n-1651]
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,60 @@
+package clickhouse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+func TestErrorName(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"":     "",
+		"abc":  "",
+		"1000": "generic",
+		"1211": "dial_timeout",
+		"1311": "x509_hostname_mismatch",
+		"1404": "http_404",
+		"1503": "http_503",
+		"1610": "http2_goaway",
+		"1611": "http2_goaway_no_error",
+		"1639": "http2_stream_cancel",
+		"1664": "http2_connection_http_1_1_required",
+		"1665": "unknown",
+		"1701": "response_decompression",
+		"42":   "unknown",
+	}
+	for code, expected := range tests {
+		assert.Equal(t, expected, errorName(code), code)
+	}
+}
+
+func TestCompatibleSchema_ErrorNameColumn(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.ErrorNameColumn = true
+	impl, err := configureCompatible(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, impl.Schema.InsertQuery("k6", "samples"), "extra_tags, error_name")
+
+	registry := metrics.NewRegistry()
+	row, err := impl.Converter.Convert(context.Background(), metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: registry.MustNewMetric("http_req_failed", metrics.Rate),
+			Tags:   registry.RootTagSet().With("error_code", "1212"),
+		},
+		Time:  time.Now(),
+		Value: 1,
+	})
+	require.NoError(t, err)
+	require.Len(t, row, compatibleColumnCount+1)
+	assert.Equal(t, "1212", row[14], "error_code keeps the numeric code")
+	assert.Equal(t, "dial_refused", row[21])
+	impl.Converter.Release(row)
+}
@@ -0,0 +1,182 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// Values of the events table's event column.
+const (
+	eventRunStarted       = "run_started"
+	eventScenarioStarted  = "scenario_started"
+	eventScenarioFinished = "scenario_finished"
+	eventRunFinished      = "run_finished"
+)
+
+// maxEventsPending caps the events kept while the events table cannot be
+// written; the oldest are dropped beyond it.
+const maxEventsPending = 10000
+
+// runEvent is one row of the events table.
+type runEvent struct {
+	time     time.Time
+	event    string
+	scenario string // "" for run events
+	detail   string // for run_finished, the error that ended the run
+}
+
+// eventLog collects the lifecycle events of the run for Config.EventsTable.
+// Scenarios are seen through the scenario tag of their samples: a scenario
+// starts with its first sample and finishes, reported at Stop, with its last.
+type eventLog struct {
+	mu        sync.Mutex
+	scenarios map[string]time.Time // time of the last sample per scenario
+	runErr    error
+	pending   pendingRows[runEvent]
+}
+
+// newEventLog returns nil when no events table is configured.
+func newEventLog(table string) *eventLog {
+	if table == "" {
+		return nil
+	}
+	return &eventLog{scenarios: make(map[string]time.Time), pending: pendingRows[runEvent]{limit: maxEventsPending}}
+}
+
+// record queues an event.
+func (l *eventLog) record(e runEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.add(e)
+}
+
+// add queues an event; l.mu must be held.
+func (l *eventLog) add(e runEvent) {
+	l.pending.add(e)
+}
+
+// observe records a scenario_started event for each scenario seen for the
+// first time in samples.
+func (l *eventLog) observe(samples []metrics.SampleContainer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, sc := range samples {
+		for _, s := range sc.GetSamples() {
+			if s.Tags == nil {
+				continue
+			}
+			scenario, ok := s.Tags.Get("scenario")
+			if !ok || scenario == "" {
+				continue
+			}
+			last, seen := l.scenarios[scenario]
+			if !seen {
+				l.add(runEvent{time: s.Time, event: eventScenarioStarted, scenario: scenario})
+			}
+			if !seen || s.Time.After(last) {
+				l.scenarios[scenario] = s.Time
+			}
+		}
+	}
+}
+
+// fail keeps the error k6 stopped the run with for the run_finished event.
+func (l *eventLog) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.runErr = err
+}
+
+// finish records a scenario_finished event per scenario, at its last sample,
+// and the run_finished event at now.
+func (l *eventLog) finish(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, scenario := range slices.Sorted(maps.Keys(l.scenarios)) {
+		l.add(runEvent{time: l.scenarios[scenario], event: eventScenarioFinished, scenario: scenario})
+	}
+	finished := runEvent{time: now, event: eventRunFinished}
+	if l.runErr != nil {
+		finished.detail = l.runErr.Error()
+	}
+	l.add(finished)
+}
+
+// createEventsTable creates the events table.
+func createEventsTable(ctx context.Context, db *sql.DB, database, table string) error {
+	if !isValidIdentifier(database) {
+		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", database)
+	}
+	if !isValidIdentifier(table) {
+		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
+	}
+
+	//nolint:gosec // G201: identifiers are validated with isValidIdentifier() and escaped with backticks
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s.%s (
+			timestamp DateTime64(%d, 'UTC'),
+			testid    LowCardinality(String),
+			instance  LowCardinality(String),
+			event     LowCardinality(String),
+			scenario  LowCardinality(String),
+			detail    String
+		) ENGINE = MergeTree()
+		ORDER BY (testid, timestamp)
+	`, escapeIdentifier(database), escapeIdentifier(table), TimestampPrecision)
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create events table: %w", err)
+	}
+	return nil
+}
+
+// writeEvents inserts events into the events table in one batch.
+func writeEvents(ctx context.Context, db *sql.DB, database, table, testID, instance string, events []runEvent) error {
+	if db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	batch, err := prepareInsert(ctx, db, nil, fmt.Sprintf(
+		"INSERT INTO %s.%s (timestamp, testid, instance, event, scenario, detail) VALUES (?, ?, ?, ?, ?, ?)",
+		escapeIdentifier(database), escapeIdentifier(table)))
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		if err := batch.append(ctx, e.time, testID, instance, e.event, e.scenario, e.detail); err != nil {
+			batch.abort()
+			return fmt.Errorf("failed to insert event row: %w", err)
+		}
+	}
+	if err := batch.send(); err != nil {
+		return fmt.Errorf("failed to send event rows: %w", err)
+	}
+	return nil
+}
+
+// flushEvents writes the events recorded since the last flush. Like
+// flushThresholds it takes db because Start calls it with o.mu held.
+// Failures are logged and the events retried on the next flush; they never
+// fail the samples.
+func (o *Output) flushEvents(ctx context.Context, db *sql.DB, log *eventLog) {
+	if log == nil {
+		return
+	}
+	table := o.config.EventsTable
+	flushPendingRows(o, &log.pending, table, "event", func(events []runEvent) error {
+		return writeEvents(o.config.insertContext(ctx), db, o.config.Database, table, o.testID, o.config.InstanceName, events)
+	})
+}
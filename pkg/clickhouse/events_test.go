@@ -0,0 +1,76 @@
+package clickhouse
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/lib"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestOutput_EventsTable(t *testing.T) {
+	t.Parallel()
+
+	fake, o := newFakeOutput(t, output.Params{
+		JSONConfig: mustMarshalJSON(map[string]any{
+			"pushInterval": "1h",
+			"eventsTable":  "events",
+			"instanceName": "eu",
+		}),
+		ScriptOptions: lib.Options{RunTags: map[string]string{"testid": "nightly-7"}},
+	})
+	require.NoError(t, o.Start())
+
+	ddl := fake.DDL()
+	assert.Contains(t, ddl[len(ddl)-1], "CREATE TABLE IF NOT EXISTS `k6`.`events`")
+	rows := fake.Rows()
+	require.Len(t, rows, 1, "run_started is written at Start")
+	assert.Equal(t, []any{"nightly-7", "eu", "run_started", "", ""}, rows[0][1:])
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric(metrics.HTTPReqsName, metrics.Counter)
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	sample := func(scenario string, at time.Duration) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet().With("scenario", scenario)},
+			Time:       start.Add(at),
+			Value:      1,
+		}
+	}
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{sample("browse", 0), sample("browse", time.Second)}})
+	o.flush()
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{sample("checkout", 2*time.Second), sample("browse", 3*time.Second)}})
+	o.flush()
+
+	require.NoError(t, o.StopWithTestError(errors.New("thresholds on metrics 'http_req_failed' were crossed")))
+
+	var events [][]any
+	for _, row := range fake.Rows() {
+		if len(row) == 6 {
+			events = append(events, row)
+		}
+	}
+	require.Len(t, events, 6)
+	assert.Equal(t, []any{start, "nightly-7", "eu", "scenario_started", "browse", ""}, events[1])
+	assert.Equal(t, []any{start.Add(2 * time.Second), "nightly-7", "eu", "scenario_started", "checkout", ""}, events[2])
+	assert.Equal(t, []any{start.Add(3 * time.Second), "nightly-7", "eu", "scenario_finished", "browse", ""}, events[3])
+	assert.Equal(t, []any{start.Add(2 * time.Second), "nightly-7", "eu", "scenario_finished", "checkout", ""}, events[4])
+	assert.Equal(t, []any{"nightly-7", "eu", "run_finished", "", "thresholds on metrics 'http_req_failed' were crossed"}, events[5][1:])
+}
+
+func TestEventLog_RequeueCap(t *testing.T) {
+	t.Parallel()
+
+	l := newEventLog("events")
+	l.record(runEvent{event: eventRunStarted})
+	assert.Equal(t, 1, l.pending.requeue(make([]runEvent, maxEventsPending)))
+
+	pending := l.pending.take()
+	assert.Len(t, pending, maxEventsPending)
+	assert.Equal(t, eventRunStarted, pending[len(pending)-1].event, "oldest events dropped first")
+	assert.Nil(t, newEventLog(""))
+}
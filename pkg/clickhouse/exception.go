@@ -0,0 +1,160 @@
+package clickhouse
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/avast/retry-go/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// errorClass groups ClickHouse server exceptions by how a flush should react.
+type errorClass int
+
+const (
+	// errClassUnknown covers errors without a recognized exception code;
+	// they keep the generic network/EOF retry rules of isRetryableError.
+	errClassUnknown errorClass = iota
+
+	// errClassAuth: the credentials or grants are wrong. Retrying cannot help.
+	errClassAuth
+
+	// errClassReadOnly: the user, table, or replica does not accept writes.
+	errClassReadOnly
+
+	// errClassTooManyParts: merges cannot keep up with the insert rate. The
+	// server recovers on its own, but only if inserts back off.
+	errClassTooManyParts
+
+	// errClassQuota: the user's quota is exhausted until its interval ends.
+	errClassQuota
+
+	// errClassTransient: server-side overload or timeouts worth retrying.
+	errClassTransient
+
+	// errClassSchema: the table does not match the rows being inserted.
+	errClassSchema
+
+	// errClassData: the server or driver rejected the row values themselves.
+	// The same batch fails again on every retry or replay.
+	errClassData
+
+	// errClassTooLarge: the batch exceeds a server limit on rows or bytes
+	// per query. The same batch fails again, but its halves may not.
+	errClassTooLarge
+)
+
+// ClickHouse exception codes (src/Common/ErrorCodes.cpp) recognized by
+// classifyError.
+var exceptionClasses = map[int32]errorClass{
+	192: errClassAuth, // UNKNOWN_USER
+	193: errClassAuth, // WRONG_PASSWORD
+	497: errClassAuth, // ACCESS_DENIED
+	516: errClassAuth, // AUTHENTICATION_FAILED
+
+	164: errClassReadOnly, // READONLY
+	242: errClassReadOnly, // TABLE_IS_READ_ONLY
+
+	252: errClassTooManyParts, // TOO_MANY_PARTS
+
+	201: errClassQuota, // QUOTA_EXCEEDED
+
+	159: errClassTransient, // TIMEOUT_EXCEEDED
+	202: errClassTransient, // TOO_MANY_SIMULTANEOUS_QUERIES
+	209: errClassTransient, // SOCKET_TIMEOUT
+	210: errClassTransient, // NETWORK_ERROR
+	241: errClassTransient, // MEMORY_LIMIT_EXCEEDED
+	425: errClassTransient, // SYSTEM_ERROR
+
+	16: errClassSchema, // NO_SUCH_COLUMN_IN_TABLE
+	53: errClassSchema, // TYPE_MISMATCH
+	60: errClassSchema, // UNKNOWN_TABLE
+	81: errClassSchema, // UNKNOWN_DATABASE
+
+	6:   errClassData, // CANNOT_PARSE_TEXT
+	27:  errClassData, // CANNOT_PARSE_INPUT_ASSERTION_FAILED
+	41:  errClassData, // CANNOT_PARSE_DATETIME
+	69:  errClassData, // ARGUMENT_OUT_OF_BOUND
+	70:  errClassData, // CANNOT_CONVERT_TYPE
+	117: errClassData, // INCORRECT_DATA
+	321: errClassData, // VALUE_IS_OUT_OF_RANGE_OF_DATA_TYPE
+
+	158: errClassTooLarge, // TOO_MANY_ROWS
+	307: errClassTooLarge, // TOO_MANY_BYTES
+	396: errClassTooLarge, // TOO_MANY_ROWS_OR_BYTES
+}
+
+// classifyError returns the class of the ClickHouse exception wrapped by err.
+// Values the driver cannot encode for a column count as data errors too.
+func classifyError(err error) errorClass {
+	if _, ok := errors.AsType[*column.ColumnConverterError](err); ok {
+		return errClassData
+	}
+	exc, ok := errors.AsType[*clickhouse.Exception](err)
+	if !ok {
+		return errClassUnknown
+	}
+	return exceptionClasses[exc.Code]
+}
+
+// retryable reports whether a flush failing with this class is retried.
+// errClassUnknown is decided by the generic rules instead.
+func (c errorClass) retryable() bool {
+	switch c {
+	case errClassTooManyParts, errClassQuota, errClassTransient:
+		return true
+	default:
+		return false
+	}
+}
+
+// hint returns operator guidance logged with a failed flush.
+func (c errorClass) hint() string {
+	switch c {
+	case errClassAuth:
+		return "authentication or authorization failed: check user/password and that the user may INSERT into the table"
+	case errClassReadOnly:
+		return "the table or user is read-only: check the user's readonly setting and that addr points at a writable replica"
+	case errClassTooManyParts:
+		return "too many parts: inserts outpace background merges; increase pushInterval to send fewer, larger batches"
+	case errClassQuota:
+		return "the user's quota is exhausted: retries resume once the quota interval resets, or raise the quota"
+	case errClassTransient:
+		return "the server is overloaded or timed out: check its load, or raise retryAttempts/retryMaxDelay"
+	case errClassSchema:
+		return "the table does not match the schema: check schemaMode/table, or recreate the table"
+	case errClassData:
+		return "the batch contains values the table rejects; it is not retried (see deadLetterDir)"
+	case errClassTooLarge:
+		return "the batch exceeds a server row/byte limit; it is split in halves, and maxBatchRows caps future batches"
+	default:
+		return ""
+	}
+}
+
+// withErrorHint adds err and, for a recognized ClickHouse exception, its
+// class hint to logger.
+func withErrorHint(logger logrus.FieldLogger, err error) logrus.FieldLogger {
+	logger = logger.WithError(err)
+	if hint := classifyError(err).hint(); hint != "" {
+		logger = logger.WithField("hint", hint)
+	}
+	return logger
+}
+
+// backoffDelay returns a retry.DelayTypeFunc that backs off exponentially
+// like retry.BackOffDelay, except that TOO_MANY_PARTS and quota errors wait
+// maxDelay at once: the server needs time to recover, and quick retries
+// only add to the backlog.
+func backoffDelay(maxDelay time.Duration) retry.DelayTypeFunc {
+	return func(n uint, err error, config *retry.Config) time.Duration {
+		switch classifyError(err) {
+		case errClassTooManyParts, errClassQuota:
+			return maxDelay
+		default:
+			return retry.BackOffDelay(n, err, config)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package clickhouse
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/avast/retry-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+func TestClassifyError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       error
+		class     errorClass
+		retryable bool
+	}{
+		{name: "authentication failed", err: &clickhouse.Exception{Code: 516}, class: errClassAuth},
+		{name: "access denied", err: &clickhouse.Exception{Code: 497}, class: errClassAuth},
+		{name: "readonly", err: &clickhouse.Exception{Code: 164}, class: errClassReadOnly},
+		{name: "too many parts", err: &clickhouse.Exception{Code: 252}, class: errClassTooManyParts, retryable: true},
+		{name: "quota", err: &clickhouse.Exception{Code: 201}, class: errClassQuota, retryable: true},
+		{name: "memory limit", err: &clickhouse.Exception{Code: 241}, class: errClassTransient, retryable: true},
+		{name: "unknown table", err: &clickhouse.Exception{Code: 60}, class: errClassSchema},
+		{name: "too many rows or bytes", err: &clickhouse.Exception{Code: 396}, class: errClassTooLarge},
+		{name: "wrapped", err: fmt.Errorf("insert failed: %w", &clickhouse.Exception{Code: 252}), class: errClassTooManyParts, retryable: true},
+		{name: "unrecognized code", err: &clickhouse.Exception{Code: 1}, class: errClassUnknown},
+		{name: "not an exception", err: errors.New("connection refused"), class: errClassUnknown, retryable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.class, classifyError(tt.err))
+			assert.Equal(t, tt.retryable, isRetryableError(tt.err))
+			if tt.class != errClassUnknown {
+				assert.NotEmpty(t, tt.class.hint())
+			}
+		})
+	}
+
+	// Commit errors stay non-retryable whatever the server said
+	assert.False(t, isRetryableError(&commitError{err: &clickhouse.Exception{Code: 252}}))
+}
+
+func TestBackoffDelay(t *testing.T) {
+	t.Parallel()
+
+	var delays []time.Duration
+	delayType := backoffDelay(time.Second)
+	record := func(n uint, err error, config *retry.Config) time.Duration {
+		d := delayType(n, err, config)
+		delays = append(delays, d)
+		return 0 // don't actually sleep
+	}
+
+	errs := []error{&clickhouse.Exception{Code: 252}, &clickhouse.Exception{Code: 201}, errors.New("connection refused"), nil}
+	attempt := 0
+	_ = retry.Do(
+		func() error { err := errs[attempt]; attempt++; return err },
+		retry.Attempts(uint(len(errs))),
+		retry.Delay(10*time.Millisecond),
+		retry.DelayType(record),
+	)
+
+	require.Len(t, delays, 3)
+	assert.Equal(t, time.Second, delays[0], "TOO_MANY_PARTS waits the max delay at once")
+	assert.Equal(t, time.Second, delays[1], "quota errors wait the max delay at once")
+	assert.Less(t, delays[2], time.Second, "other errors back off exponentially")
+}
+
+func TestFlush_ExceptionClassRetries(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		code        int32
+		wantRetries uint64
+	}{
+		{name: "auth failure fails fast", code: 516, wantRetries: 0},
+		// Counted once per failed attempt: the initial one plus two retries
+		{name: "too many parts is retried", code: 252, wantRetries: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, o := startFakeOutput(t, map[string]any{
+				"retryAttempts": 2, "retryDelay": "1ms", "retryMaxDelay": "1ms",
+			})
+
+			fake.set(func(f *fakeDB) { f.execErr = &clickhouse.Exception{Code: tt.code, Name: "TEST"} })
+			registry := metrics.NewRegistry()
+			o.AddMetricSamples([]metrics.SampleContainer{metrics.Sample{
+				TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("custom", metrics.Counter), Tags: registry.RootTagSet()},
+				Time:       time.Now(),
+				Value:      1,
+			}})
+			o.flush()
+			fake.set(func(f *fakeDB) { f.execErr = nil })
+
+			stats := o.GetErrorMetrics()
+			assert.Equal(t, tt.wantRetries, stats.RetryAttempts)
+			assert.Equal(t, uint64(1), stats.FlushFailures)
+		})
+	}
+}
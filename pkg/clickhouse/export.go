@@ -0,0 +1,318 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// Export file formats (Config.ExportFormat).
+const (
+	// ExportFormatCSV writes CSVWithNames files (default).
+	ExportFormatCSV = "csv"
+
+	// ExportFormatParquet writes Parquet files, loadable with
+	// INSERT ... FORMAT Parquet.
+	ExportFormatParquet = "parquet"
+)
+
+// validateExportFormat checks the ExportFormat value.
+func (c Config) validateExportFormat() error {
+	switch c.ExportFormat {
+	case ExportFormatCSV, ExportFormatParquet:
+		return nil
+	default:
+		return fmt.Errorf("invalid exportFormat: %s (valid: %s, %s)", c.ExportFormat, ExportFormatCSV, ExportFormatParquet)
+	}
+}
+
+// insertColumns returns the column list of an INSERT query, in order.
+func insertColumns(query string) ([]string, error) {
+	open := strings.Index(query, "(")
+	end := strings.Index(query, ")")
+	if open < 0 || end < open {
+		return nil, errors.New("insert query has no column list")
+	}
+	var columns []string
+	for col := range strings.SplitSeq(query[open+1:end], ",") {
+		columns = append(columns, strings.Trim(strings.TrimSpace(col), "`"))
+	}
+	return columns, nil
+}
+
+// jsonColumns returns the columns of the built-in schemas that have the JSON
+// type; their maps are exported as JSON objects rather than Map literals.
+func jsonColumns(schema SchemaCreator) map[string]bool {
+	switch s := schema.(type) {
+	case SimpleSchema:
+		if s.tagStorage == TagStorageJSON {
+			return map[string]bool{"tags": true}
+		}
+	case CompatibleSchema:
+		if s.opts.tagStorage == TagStorageJSON {
+			return map[string]bool{"extra_tags": true}
+		}
+	}
+	return nil
+}
+
+// exportValue formats a converted row value as a CSV field ClickHouse parses
+// back into the same column. Timestamps are RFC 3339 in UTC, which needs
+// date_time_input_format=best_effort when loading.
+func exportValue(v any, jsonMap bool) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return `\N`, nil
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case map[string]string:
+		if jsonMap {
+			return exportJSON(v)
+		}
+		return mapLiteral(v, quoteLiteral), nil
+	case map[string]float64:
+		if jsonMap {
+			return exportJSON(v)
+		}
+		return mapLiteral(v, func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }), nil
+	case map[string]bool:
+		if jsonMap {
+			return exportJSON(v)
+		}
+		return mapLiteral(v, strconv.FormatBool), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// exportJSON encodes a map column of the JSON type.
+func exportJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// literalEscaper escapes a string for a single-quoted ClickHouse literal.
+var literalEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// quoteLiteral returns s as a single-quoted ClickHouse literal.
+func quoteLiteral(s string) string {
+	return "'" + literalEscaper.Replace(s) + "'"
+}
+
+// mapLiteral formats m as a ClickHouse Map literal, keys in order.
+func mapLiteral[V any](m map[string]V, format func(V) string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range slices.Sorted(maps.Keys(m)) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(quoteLiteral(k))
+		b.WriteByte(':')
+		b.WriteString(format(m[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// exportFileName names an export file like a spill file, with the format as
+// extension.
+func exportFileName(database, table, format string, at time.Time) string {
+	return strings.TrimSuffix(spillFileName(database, table, at), spillFileExt) + "." + format
+}
+
+// writeExportFile converts the samples routed to t into rows and writes them
+// to a new file of format in dir. It returns the path and the number of
+// rows; samples failing conversion are skipped, as in an insert.
+func writeExportFile(
+	ctx context.Context, dir, database, format string, t *schemaTarget, samples []metrics.SampleContainer,
+) (string, int, error) {
+	if len(t.columns) == 0 {
+		return "", 0, errors.New("insert query has no column list")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	path := filepath.Join(dir, exportFileName(database, t.table, format, time.Now()))
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600) // #nosec G304 - dir is operator config, name is built from identifiers
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create export file: %w", err)
+	}
+
+	count, err := writeExportRows(ctx, f, format, t, samples)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", 0, fmt.Errorf("failed to write export file: %w", err)
+	}
+	return path, count, nil
+}
+
+// uploadExportFile is writeExportFile for an S3 ExportDir: the file is
+// built in memory and uploaded as one object. It returns the object's URL.
+func uploadExportFile(
+	ctx context.Context, s3 *s3Exporter, database, format string, t *schemaTarget, samples []metrics.SampleContainer,
+) (string, int, error) {
+	if len(t.columns) == 0 {
+		return "", 0, errors.New("insert query has no column list")
+	}
+	var buf bytes.Buffer
+	count, err := writeExportRows(ctx, &buf, format, t, samples)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write export file: %w", err)
+	}
+	location, err := s3.put(ctx, exportFileName(database, t.table, format, time.Now()), buf.Bytes())
+	if err != nil {
+		return "", 0, err
+	}
+	return location, count, nil
+}
+
+// writeExportRows writes the converted samples routed to t as a file of
+// format.
+func writeExportRows(
+	ctx context.Context, out io.Writer, format string, t *schemaTarget, samples []metrics.SampleContainer,
+) (int, error) {
+	if format == ExportFormatParquet {
+		return writeParquetRows(ctx, out, t, samples)
+	}
+	return writeCSVRows(ctx, out, t, samples)
+}
+
+// eachExportRow calls fn with every converted sample routed to t, releasing
+// the row after fn returns; samples failing conversion are skipped.
+func eachExportRow(
+	ctx context.Context, t *schemaTarget, samples []metrics.SampleContainer, fn func(metrics.Sample, []any) error,
+) error {
+	for _, sc := range samples {
+		for _, sample := range sc.GetSamples() {
+			if t.accept != nil && !t.accept(sample) {
+				continue
+			}
+			row, err := t.converter.Convert(ctx, sample)
+			if err != nil {
+				continue
+			}
+			if err := rowArityError(row, t.columns); err != nil {
+				t.converter.Release(row)
+				return err
+			}
+			err = fn(sample, row)
+			t.converter.Release(row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeCSVRows writes the header and one record per converted sample.
+func writeCSVRows(ctx context.Context, out io.Writer, t *schemaTarget, samples []metrics.SampleContainer) (int, error) {
+	columns, jsonCols := t.columns, jsonColumns(t.schema)
+	w := csv.NewWriter(out)
+	if err := w.Write(columns); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	record := make([]string, len(columns))
+	err := eachExportRow(ctx, t, samples, func(sample metrics.Sample, row []any) error {
+		for i, v := range row {
+			var err error
+			if record[i], err = exportValue(v, jsonCols[columns[i]]); err != nil {
+				return fmt.Errorf("failed to format %s: %w", sample.Metric.Name, err)
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	w.Flush()
+	return count, w.Error()
+}
+
+// writeParquetRows writes the converted samples as a Parquet file.
+func writeParquetRows(
+	ctx context.Context, out io.Writer, t *schemaTarget, samples []metrics.SampleContainer,
+) (int, error) {
+	f := newParquetFile(t.columns, jsonColumns(t.schema))
+	err := eachExportRow(ctx, t, samples, func(sample metrics.Sample, row []any) error {
+		if err := f.appendRow(row); err != nil {
+			return fmt.Errorf("failed to format %s: %w", sample.Metric.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return f.rows, f.writeTo(out)
+}
+
+// exportBatch writes a batch that exhausted its retries to an export file in
+// ExportDir, or uploads it when ExportDir is an S3 URL. It reports false when
+// export is disabled or the file cannot be written, in which case the caller
+// buffers the batch as usual.
+func (o *Output) exportBatch(
+	ctx context.Context, logger logrus.FieldLogger, t *schemaTarget, samples []metrics.SampleContainer,
+) bool {
+	if o.config.ExportDir == "" {
+		return false
+	}
+	var (
+		path string
+		n    int
+		err  error
+	)
+	ctx = context.WithoutCancel(ctx)
+	if o.s3Export != nil {
+		path, n, err = uploadExportFile(ctx, o.s3Export, o.config.Database, o.config.ExportFormat, t, samples)
+	} else {
+		path, n, err = writeExportFile(ctx, o.config.ExportDir, o.config.Database, o.config.ExportFormat, t, samples)
+	}
+	if err != nil {
+		logger.WithError(err).WithField("samples", countSamples(samples)).Error("Failed to export batch")
+		return false
+	}
+	o.exportedSamples.Add(uint64(n))
+	logger.WithFields(logrus.Fields{
+		"exportFile": path,
+		"rows":       n,
+	}).Warn("Exported undelivered batch for a later bulk load")
+	return true
+}
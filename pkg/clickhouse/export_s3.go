@@ -0,0 +1,128 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// s3Scheme prefixes an ExportDir that names an S3 bucket and key prefix.
+	s3Scheme = "s3://"
+
+	// s3DefaultRegion is used for a custom endpoint when no region is
+	// configured; S3-compatible stores such as MinIO accept it.
+	s3DefaultRegion = "us-east-1"
+
+	// s3Timeout bounds loading the AWS configuration, discovering the
+	// bucket's region, and one export upload.
+	s3Timeout = 30 * time.Second
+)
+
+// isS3URL reports whether an ExportDir is an s3:// URL.
+func isS3URL(dir string) bool {
+	return strings.HasPrefix(dir, s3Scheme)
+}
+
+// parseS3URL splits an s3://bucket/prefix URL into the bucket and the key
+// prefix, without slashes at either end.
+func parseS3URL(raw string) (string, string, error) {
+	if !isS3URL(raw) {
+		return "", "", fmt.Errorf("%s is not an s3:// URL", raw)
+	}
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(raw, s3Scheme), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("%s has no bucket", raw)
+	}
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+// s3Exporter uploads export files to an S3 bucket, or an S3-compatible store
+// such as MinIO, with the AWS SDK's upload manager.
+type s3Exporter struct {
+	bucket   string
+	prefix   string
+	uploader *manager.Uploader //nolint:staticcheck // SA1019: its successor, transfermanager, is pre-release
+}
+
+// newS3Exporter returns an exporter for an s3://bucket/prefix ExportDir.
+// Credentials and region come from the AWS default chain: the AWS_*
+// variables, shared config and credentials files (AWS_PROFILE), SSO, web
+// identity (IRSA), and the EC2/ECS metadata endpoints. Without a configured
+// region, the bucket's region is discovered. AWS_ENDPOINT_URL_S3 (or
+// AWS_ENDPOINT_URL) selects an S3-compatible store, addressed path-style.
+func newS3Exporter(ctx context.Context, exportDir string) (*s3Exporter, error) {
+	bucket, prefix, err := parseS3URL(exportDir)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	customEndpoint := false
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if o.BaseEndpoint != nil {
+			customEndpoint = true
+			o.UsePathStyle = true
+			if o.Region == "" {
+				o.Region = s3DefaultRegion
+			}
+		}
+	})
+	if cfg.Region == "" && !customEndpoint {
+		region, err := manager.GetBucketRegion(ctx, client, bucket, func(o *s3.Options) {
+			o.Region = s3DefaultRegion
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover the region of bucket %s (set AWS_REGION): %w", bucket, err)
+		}
+		client = s3.NewFromConfig(cfg, func(o *s3.Options) { o.Region = region })
+	}
+
+	return &s3Exporter{
+		bucket:   bucket,
+		prefix:   prefix,
+		uploader: manager.NewUploader(client), //nolint:staticcheck // SA1019: see s3Exporter.uploader
+	}, nil
+}
+
+// put uploads body as name under the exporter's prefix and returns the
+// object's s3:// URL.
+func (e *s3Exporter) put(ctx context.Context, name string, body []byte) (string, error) {
+	key := name
+	if e.prefix != "" {
+		key = e.prefix + "/" + name
+	}
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+
+	_, err := e.uploader.Upload(ctx, &s3.PutObjectInput{ //nolint:staticcheck // SA1019: see s3Exporter.uploader
+		Bucket:      aws.String(e.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(exportContentType(name)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload export file: %w", err)
+	}
+	return s3Scheme + e.bucket + "/" + key, nil
+}
+
+// exportContentType returns the media type of an export file.
+func exportContentType(name string) string {
+	if strings.HasSuffix(name, "."+ExportFormatParquet) {
+		return "application/vnd.apache.parquet"
+	}
+	return "text/csv"
+}
@@ -0,0 +1,172 @@
+package clickhouse
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertColumns(t *testing.T) {
+	t.Parallel()
+
+	columns, err := insertColumns(SimpleSchema{}.InsertQuery("k6", "samples"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"timestamp", "metric", "value", "tags"}, columns)
+
+	columns, err = insertColumns(CompatibleSchema{}.InsertQuery("k6", "k6_samples"))
+	require.NoError(t, err)
+	assert.Len(t, columns, compatibleColumnCount)
+	assert.Equal(t, "extra_tags", columns[len(columns)-1])
+
+	_, err = insertColumns("INSERT INTO t VALUES")
+	assert.Error(t, err)
+}
+
+func TestExportValue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		value    any
+		jsonMap  bool
+		expected string
+	}{
+		{name: "time", value: time.Date(2025, 1, 2, 3, 4, 5, 6000000, time.FixedZone("CET", 3600)), expected: "2025-01-02T02:04:05.006Z"},
+		{name: "float", value: 0.25, expected: "0.25"},
+		{name: "bool", value: true, expected: "true"},
+		{name: "uint", value: uint32(42), expected: "42"},
+		{name: "null", value: nil, expected: `\N`},
+		{name: "map", value: map[string]string{"b": "it's", "a": `c:\`}, expected: `{'a':'c:\\','b':'it\'s'}`},
+		{name: "numeric map", value: map[string]float64{"size": 1.5}, expected: `{'size':1.5}`},
+		{name: "JSON map", value: map[string]string{"status": "200"}, jsonMap: true, expected: `{"status":"200"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := exportValue(tt.value, tt.jsonMap)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestOutput_ExportFailedBatch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval":  "1h",
+		"retryAttempts": 0,
+		"exportDir":     dir,
+	})
+
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	require.NoError(t, o.Stop())
+
+	files, err := filepath.Glob(filepath.Join(dir, "k6.samples.*.csv"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	f, err := os.Open(files[0]) // #nosec G304 - test temp dir
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"timestamp", "metric", "value", "tags"}, records[0])
+	assert.Equal(t, "http_reqs", records[1][1])
+	assert.Equal(t, "1", records[1][2])
+	assert.Equal(t, "{'status':'200'}", records[1][3])
+
+	stats := o.GetErrorMetrics()
+	assert.Equal(t, uint64(2), stats.ExportedSamples)
+	assert.Zero(t, stats.BufferedSamples, "exported batches are not buffered")
+	assert.Zero(t, stats.DroppedSamples)
+}
+
+func TestConfig_ValidateExportDir(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.ExportDir = "s3://bucket/k6"
+	require.NoError(t, cfg.Validate())
+
+	for _, dir := range []string{"gs://bucket/k6", "s3:///k6"} {
+		cfg.ExportDir = dir
+		err := cfg.Validate()
+		require.Error(t, err, dir)
+		assert.Contains(t, err.Error(), "invalid exportDir")
+	}
+}
+
+func TestExportContentType(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "text/csv", exportContentType("k6.samples.1.csv"))
+	assert.Equal(t, "application/vnd.apache.parquet", exportContentType("k6.samples.1.parquet"))
+}
+
+func TestOutput_ExportToS3(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		objects = map[string]string{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPut || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		objects[r.URL.Path] = string(body)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	// Keep the default credential chain to the variables set here.
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REQUEST_CHECKSUM_CALCULATION", "when_required")
+	t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL)
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval":  "1h",
+		"retryAttempts": 0,
+		"exportDir":     "s3://k6-exports/runs",
+	})
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	require.NoError(t, o.Stop())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, objects, 1)
+	for path, body := range objects {
+		assert.Regexp(t, `^/k6-exports/runs/k6\.samples\.\d+\.csv$`, path)
+		records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		assert.Equal(t, []string{"timestamp", "metric", "value", "tags"}, records[0])
+	}
+	assert.Equal(t, uint64(2), o.GetErrorMetrics().ExportedSamples)
+}
@@ -0,0 +1,349 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+// fakeDB is an in-memory database/sql driver for unit tests. It records DDL
+// executed on the connection and rows inserted through prepared statements.
+// Like clickhouse-go, Prepare opens an insert batch on the connection that
+// Commit sends and Rollback discards. Errors can be injected per operation to
+// exercise retry and failure paths without Docker.
+type fakeDB struct {
+	mu sync.Mutex
+
+	pingErr    error
+	prepareErr error // returned by Prepare (opening an insert batch)
+	execErr    error // returned by prepared-statement Exec (row inserts)
+	commitErr  error // returned by Commit (sending a batch)
+	ddlErr     error // returned by Exec on the connection (DDL, SET, ...)
+	queryErr   error // returned by queries (SELECT version(), ...)
+
+	maxRows int // commits of more rows fail with TOO_MANY_ROWS_OR_BYTES; 0 = unlimited
+
+	version string // reported by SELECT version(); defaults to fakeServerVersion
+
+	// tables describes existing tables to schema validation and migration,
+	// by name. Tables not listed exist with the simple schema's default
+	// columns at the current schema version.
+	tables map[string]fakeTable
+
+	selectRows [][]driver.Value // result of any other SELECT
+	selects    []string         // other SELECT queries, with their arguments in selectArgs
+	selectArgs [][]any
+
+	ddl       []string // statements executed directly on the connection
+	prepared  []string // queries passed to Prepare
+	committed [][]any  // rows from sent batches, in insert order
+	commits   int
+	aborts    int         // batches discarded by Rollback
+	conns     []*fakeConn // every connection opened, for breakConns
+}
+
+// fakeTable is a table as reported by system.tables and system.columns.
+type fakeTable struct {
+	engine  string
+	comment string
+	columns [][]driver.Value // name, type
+}
+
+// table returns the description of table for schema validation and
+// migration.
+func (f *fakeDB) table(name string) (fakeTable, bool) {
+	if t, ok := f.tables[name]; ok {
+		return t, t.engine != ""
+	}
+	t := fakeTable{engine: "MergeTree", comment: SchemaVersionComment(simpleSchemaVersion)}
+	for _, col := range parseColumnsDDL(SimpleSchema{}.columnsDDL()) {
+		t.columns = append(t.columns, []driver.Value{col.name, col.typ})
+	}
+	return t, true
+}
+
+// fakeServerVersion is the version reported when fakeDB.version is unset.
+const fakeServerVersion = "25.8.1.1"
+
+// newFakeDB returns a fake driver and a *sql.DB backed by it. The handle is
+// closed when the test finishes.
+func newFakeDB(t testing.TB) (*fakeDB, *sql.DB) {
+	t.Helper()
+	f := &fakeDB{}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { _ = db.Close() })
+	return f, db
+}
+
+// newFakeOutput returns an output writing to a new fakeDB, not yet started,
+// for tests that inject errors or set hooks before Start. The logger defaults
+// to newTestLogger.
+func newFakeOutput(t testing.TB, params output.Params) (*fakeDB, *Output) {
+	t.Helper()
+	if params.Logger == nil {
+		params.Logger = newTestLogger(t)
+	}
+	fake, db := newFakeDB(t)
+	out, err := NewWithDB(params, db)
+	require.NoError(t, err)
+	return fake, out.(*Output)
+}
+
+// startFakeOutput returns a started output writing to a new fakeDB, with the
+// JSON config cfg (nil for the defaults). It is stopped when the test
+// finishes; stopping it earlier is fine.
+func startFakeOutput(t testing.TB, cfg map[string]any) (*fakeDB, *Output) {
+	t.Helper()
+	var params output.Params
+	if cfg != nil {
+		params.JSONConfig = mustMarshalJSON(cfg)
+	}
+	fake, o := newFakeOutput(t, params)
+	require.NoError(t, o.Start())
+	t.Cleanup(func() { require.NoError(t, o.Stop()) })
+	return fake, o
+}
+
+// Rows returns a copy of all committed rows.
+func (f *fakeDB) Rows() [][]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]any(nil), f.committed...)
+}
+
+// DDL returns a copy of the statements executed directly on the connection.
+func (f *fakeDB) DDL() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.ddl...)
+}
+
+// Prepared returns a copy of the queries passed to Prepare.
+func (f *fakeDB) Prepared() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.prepared...)
+}
+
+// breakConns makes every open connection fail with driver.ErrBadConn, as
+// after a server restart. New connections work normally.
+func (f *fakeDB) breakConns() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.conns {
+		c.bad = true
+	}
+}
+
+// newConn opens a connection and records it.
+func (f *fakeDB) newConn() *fakeConn {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := &fakeConn{db: f}
+	f.conns = append(f.conns, c)
+	return c
+}
+
+// set runs fn under the fake's lock, for injecting errors mid-test.
+func (f *fakeDB) set(fn func(f *fakeDB)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn(f)
+}
+
+// Connect implements driver.Connector.
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return f.newConn(), nil }
+
+// Driver implements driver.Connector.
+func (f *fakeDB) Driver() driver.Driver { return fakeDriver{db: f} }
+
+type fakeDriver struct{ db *fakeDB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return d.db.newConn(), nil }
+
+type fakeConn struct {
+	db  *fakeDB
+	bad bool // see fakeDB.breakConns
+
+	inBatch bool
+	pending [][]any // rows appended to the open batch
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if c.bad {
+		return nil, driver.ErrBadConn
+	}
+	if c.db.prepareErr != nil {
+		return nil, c.db.prepareErr
+	}
+	c.db.prepared = append(c.db.prepared, query)
+	c.inBatch, c.pending = true, nil
+	return &fakeStmt{conn: c}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+// Begin returns the connection itself: as in clickhouse-go, there are no
+// transactions, only the batch opened by Prepare.
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+
+// Commit sends the open batch.
+func (c *fakeConn) Commit() error {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	pending := c.pending
+	c.inBatch, c.pending = false, nil
+	if db.commitErr != nil {
+		return db.commitErr
+	}
+	if db.maxRows > 0 && len(pending) > db.maxRows {
+		return &clickhouse.Exception{Code: 396, Name: "TOO_MANY_ROWS_OR_BYTES"}
+	}
+	db.committed = append(db.committed, pending...)
+	db.commits++
+	return nil
+}
+
+// Rollback discards the open batch.
+func (c *fakeConn) Rollback() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if c.inBatch {
+		c.db.aborts++
+	}
+	c.inBatch, c.pending = false, nil
+	return nil
+}
+
+func (c *fakeConn) Ping(context.Context) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	return c.db.pingErr
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if c.db.ddlErr != nil {
+		return nil, c.db.ddlErr
+	}
+	c.db.ddl = append(c.db.ddl, query)
+	return driver.RowsAffected(0), nil
+}
+
+// QueryContext answers SELECT version() with the fake server version, the
+// queries of schema validation and migration from tables, and any other
+// SELECT with selectRows.
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if c.db.queryErr != nil {
+		return nil, c.db.queryErr
+	}
+	if strings.HasPrefix(query, "SELECT engine FROM system.tables") || strings.HasPrefix(query, "SELECT comment FROM system.tables") ||
+		strings.Contains(query, "FROM system.columns") {
+		t, ok := c.db.table(args[1].Value.(string))
+		switch {
+		case !ok:
+			return &fakeRows{columns: []string{"engine"}}, nil
+		case strings.Contains(query, "system.columns"):
+			return &fakeRows{columns: []string{"name", "type"}, rows: slices.Clone(t.columns)}, nil
+		case strings.HasPrefix(query, "SELECT comment"):
+			return &fakeRows{columns: []string{"comment"}, rows: [][]driver.Value{{t.comment}}}, nil
+		default:
+			return &fakeRows{columns: []string{"engine"}, rows: [][]driver.Value{{t.engine}}}, nil
+		}
+	}
+	if !strings.Contains(query, "version()") {
+		if !strings.Contains(query, "SELECT") {
+			return nil, fmt.Errorf("fake driver: unsupported query %q", query)
+		}
+		values := make([]any, len(args))
+		for i, a := range args {
+			values[i] = a.Value
+		}
+		c.db.selects = append(c.db.selects, query)
+		c.db.selectArgs = append(c.db.selectArgs, values)
+		rows := slices.Clone(c.db.selectRows)
+		var columns []string
+		if len(rows) > 0 {
+			columns = make([]string, len(rows[0]))
+		}
+		return &fakeRows{columns: columns, rows: rows}, nil
+	}
+	version := c.db.version
+	if version == "" {
+		version = fakeServerVersion
+	}
+	return &fakeRows{columns: []string{"version()"}, rows: [][]driver.Value{{version}}}, nil
+}
+
+// CheckNamedValue accepts any Go value (maps, time.Time, ...) as the real
+// ClickHouse driver does, bypassing database/sql's default conversion.
+func (c *fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+type fakeStmt struct{ conn *fakeConn }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.execErr != nil {
+		return nil, db.execErr
+	}
+	if !s.conn.inBatch {
+		return nil, errors.New("fake driver: insert outside batch")
+	}
+
+	// Rows are pooled and released after commit — store a deep copy.
+	row := make([]any, len(args))
+	for i, v := range args {
+		if m, ok := v.(map[string]string); ok {
+			row[i] = maps.Clone(m)
+			continue
+		}
+		row[i] = v
+	}
+	s.conn.pending = append(s.conn.pending, row)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, io.EOF
+}
+
+// fakeRows is a static result set.
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
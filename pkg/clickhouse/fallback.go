@@ -0,0 +1,150 @@
+package clickhouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// fallbackStdout selects standard output as the fallback sink.
+const fallbackStdout = "stdout"
+
+// Reasons recorded in the error field of fallback records.
+const (
+	fallbackOverflow = "failover buffer overflow"
+	fallbackExpired  = "expired in failover buffer (bufferMaxAge)"
+	fallbackNoBuffer = "insert failed with buffering disabled"
+	fallbackShutdown = "not delivered at shutdown"
+)
+
+// fallbackSink is the last resort for samples the output gives up on. It
+// appends them in the spill format, plus the table and the reason, to
+// standard output or a file, so an outage never loses data entirely. The
+// file is opened on the first sample.
+type fallbackSink struct {
+	target string // fallbackStdout or a file path
+
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File // nil for standard output or before the first write
+}
+
+// newFallbackSink returns a sink writing to target, or nil when target is
+// empty.
+func newFallbackSink(target string) *fallbackSink {
+	if target == "" {
+		return nil
+	}
+	return &fallbackSink{target: target}
+}
+
+// writer returns the sink's writer, opening the file if needed. The caller
+// holds s.mu.
+func (s *fallbackSink) writer() (io.Writer, error) {
+	if s.w != nil {
+		return s.w, nil
+	}
+	if s.target == fallbackStdout {
+		s.w = os.Stdout
+		return s.w, nil
+	}
+	f, err := os.OpenFile(s.target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) // #nosec G304 - path is operator config
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fallback sink: %w", err)
+	}
+	s.w, s.file = f, f
+	return s.w, nil
+}
+
+// write appends the samples routed to t and returns how many were written.
+func (s *fallbackSink) write(t *schemaTarget, reason string, samples []metrics.SampleContainer) (int, error) {
+	var (
+		buf   []byte
+		count int
+	)
+	for _, sc := range samples {
+		for _, sample := range sc.GetSamples() {
+			if t.accept != nil && !t.accept(sample) {
+				continue
+			}
+			rec := newSpillRecord(sample)
+			rec.Table, rec.Error = t.table, reason
+			line, err := json.Marshal(rec)
+			if err != nil {
+				return 0, fmt.Errorf("failed to encode fallback record: %w", err)
+			}
+			buf = append(append(buf, line...), '\n')
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	// One write per batch keeps lines from concurrent flushes whole
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, err := s.writer()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(buf); err != nil {
+		return 0, fmt.Errorf("failed to write fallback sink: %w", err)
+	}
+	return count, nil
+}
+
+// close closes the sink's file; standard output is left open.
+func (s *fallbackSink) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.w, s.file = nil, nil
+	return err
+}
+
+// divertFallback writes samples undeliverable to t to the fallback sink. It
+// reports false when there is no sink or the write failed, in which case the
+// caller counts them as lost.
+func (o *Output) divertFallback(logger logrus.FieldLogger, t *schemaTarget, reason string, samples []metrics.SampleContainer) bool {
+	if o.fallback == nil || len(samples) == 0 {
+		return false
+	}
+	n, err := o.fallback.write(t, reason, samples)
+	if err != nil {
+		logger.WithError(err).WithField("samples", len(samples)).Error("Failed to write samples to fallback sink")
+		return false
+	}
+	o.fallbackSamples.Add(uint64(n))
+	logger.WithFields(logrus.Fields{
+		"fallbackSink": o.config.FallbackSink,
+		"samples":      n,
+		"reason":       reason,
+	}).Warn("Undeliverable samples written to fallback sink")
+	return true
+}
+
+// fallbackDropHandler diverts what t's failover buffer discards to the
+// fallback sink. Overflow drops the sink cannot take are counted as dropped,
+// as they would be without a sink.
+func (o *Output) fallbackDropHandler(t *schemaTarget) DropHandler {
+	logger := o.logger.WithField("table", t.table)
+	return func(dropped []metrics.SampleContainer, expired bool) {
+		if expired {
+			o.divertFallback(logger, t, fallbackExpired, dropped)
+			return
+		}
+		if !o.divertFallback(logger, t, fallbackOverflow, dropped) {
+			o.droppedSamples.Add(uint64(len(dropped)))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package clickhouse
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFallbackRecords decodes every record in a fallback file.
+func readFallbackRecords(t *testing.T, path string) []spillRecord {
+	t.Helper()
+
+	f, err := os.Open(path) // #nosec G304 - test temp dir
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	var records []spillRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec spillRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+// fallbackConfig adds to config a fallback sink in a temporary file, whose
+// path it returns, and no retries, so failed inserts go straight to it.
+func fallbackConfig(t *testing.T, config map[string]any) (map[string]any, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "fallback.ndjson")
+	config["pushInterval"] = "1h"
+	config["retryAttempts"] = 0
+	config["fallbackSink"] = path
+	return config, path
+}
+
+func TestFallbackSink_BufferingDisabled(t *testing.T) {
+	t.Parallel()
+
+	config, path := fallbackConfig(t, map[string]any{"bufferEnabled": false})
+	fake, o := startFakeOutput(t, config)
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	require.NoError(t, o.Stop())
+
+	records := readFallbackRecords(t, path)
+	require.Len(t, records, 2)
+	assert.Equal(t, "http_reqs", records[0].Metric)
+	assert.Equal(t, "samples", records[0].Table)
+	assert.Equal(t, fallbackNoBuffer, records[0].Error)
+	assert.Equal(t, uint64(2), o.GetErrorMetrics().FallbackSamples)
+}
+
+func TestFallbackSink_OverflowAndShutdown(t *testing.T) {
+	t.Parallel()
+
+	config, path := fallbackConfig(t, map[string]any{"bufferMaxSamples": 1})
+	fake, o := startFakeOutput(t, config)
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	addStatusSamples(o, 1, 0)
+	o.flush() // two containers in a buffer of one: the oldest overflows
+	require.NoError(t, o.Stop())
+
+	records := readFallbackRecords(t, path)
+	require.Len(t, records, 2)
+	assert.Equal(t, fallbackOverflow, records[0].Error)
+	assert.Equal(t, fallbackShutdown, records[1].Error, "the buffered container is not drained at Stop")
+
+	stats := o.GetErrorMetrics()
+	assert.Equal(t, uint64(2), stats.FallbackSamples)
+	assert.Zero(t, stats.DroppedSamples, "nothing is lost")
+}
@@ -0,0 +1,132 @@
+package clickhouse
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// Names of the built-in sample filters.
+const (
+	// FilterSkipInternalMetrics drops k6's execution and volume metrics, as
+	// skipBuiltinInternalMetrics does.
+	FilterSkipInternalMetrics = "skipInternalMetrics"
+
+	// FilterBuiltinMetricsOnly keeps only the metrics emitted by k6 itself.
+	FilterBuiltinMetricsOnly = "builtinMetricsOnly"
+
+	// FilterCustomMetricsOnly keeps only the metrics defined by the script.
+	FilterCustomMetricsOnly = "customMetricsOnly"
+)
+
+func init() {
+	RegisterSampleFilter(FilterSkipInternalMetrics, SampleFilterFunc(func(s metrics.Sample) bool {
+		return !isInternalSample(s)
+	}))
+	RegisterSampleFilter(FilterBuiltinMetricsOnly, SampleFilterFunc(isBuiltinSample))
+	RegisterSampleFilter(FilterCustomMetricsOnly, SampleFilterFunc(isCustomSample))
+}
+
+// validateSampleFilters checks that every filter in SampleFilters is
+// registered and that no scenario is both included and excluded.
+func (c Config) validateSampleFilters() error {
+	var errs []error
+	for _, scenario := range c.ExcludeScenarios {
+		if slices.Contains(c.IncludeScenarios, scenario) {
+			errs = append(errs, fmt.Errorf("scenario %s is listed in both includeScenarios and excludeScenarios", scenario))
+		}
+	}
+	for _, name := range c.SampleFilters {
+		if _, err := GetSampleFilter(name); err != nil {
+			errs = append(errs, fmt.Errorf("invalid sampleFilters: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolveSampleFilters returns the filters selected by the config: the
+// scenario filter first, then skipBuiltinInternalMetrics, then SampleFilters
+// in order. With the run's builtin metrics, skipInternalMetrics,
+// builtinMetricsOnly and customMetricsOnly match them by identity.
+func (c Config) resolveSampleFilters(builtin builtinMetricSet) ([]SampleFilter, error) {
+	names := c.SampleFilters
+	if c.SkipBuiltinInternalMetrics {
+		names = append([]string{FilterSkipInternalMetrics}, names...)
+	}
+	filters := make([]SampleFilter, 0, len(names)+1)
+	if f := newScenarioFilter(c.IncludeScenarios, c.ExcludeScenarios); f != nil {
+		filters = append(filters, f)
+	}
+	for _, name := range names {
+		if f, ok := builtin.sampleFilter(name); ok {
+			filters = append(filters, f)
+			continue
+		}
+		f, err := GetSampleFilter(name)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// acceptFilter combines the sample filters with a target's own routing
+// filter. It returns nil when every sample is accepted.
+func acceptFilter(filters []SampleFilter, route func(metrics.Sample) bool) func(metrics.Sample) bool {
+	if len(filters) == 0 {
+		return route
+	}
+	return func(s metrics.Sample) bool {
+		for _, f := range filters {
+			if !f.Keep(s) {
+				return false
+			}
+		}
+		return route == nil || route(s)
+	}
+}
+
+// scenarioFilter keeps the samples of the included scenarios (every scenario
+// when include is empty) that are not excluded, by their scenario tag.
+// Samples without a scenario tag, such as vus and vus_max, are kept.
+type scenarioFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// newScenarioFilter returns the filter of IncludeScenarios and
+// ExcludeScenarios, or nil when both are empty.
+func newScenarioFilter(include, exclude []string) SampleFilter {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil
+	}
+	f := scenarioFilter{exclude: make(map[string]bool, len(exclude))}
+	if len(include) > 0 {
+		f.include = make(map[string]bool, len(include))
+		for _, scenario := range include {
+			f.include[scenario] = true
+		}
+	}
+	for _, scenario := range exclude {
+		f.exclude[scenario] = true
+	}
+	return f
+}
+
+// Keep reports whether sample belongs to a written scenario.
+func (f scenarioFilter) Keep(sample metrics.Sample) bool {
+	if sample.Tags == nil {
+		return true
+	}
+	scenario, ok := sample.Tags.Get("scenario")
+	if !ok {
+		return true
+	}
+	if f.include != nil && !f.include[scenario] {
+		return false
+	}
+	return !f.exclude[scenario]
+}
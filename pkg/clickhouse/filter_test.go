@@ -0,0 +1,132 @@
+package clickhouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestSampleFilterRegistry(t *testing.T) {
+	t.Parallel()
+
+	assert.Subset(t, AvailableSampleFilters(),
+		[]string{FilterSkipInternalMetrics, FilterBuiltinMetricsOnly, FilterCustomMetricsOnly})
+
+	RegisterSampleFilter("test_drop_all", SampleFilterFunc(func(metrics.Sample) bool { return false }))
+	f, err := GetSampleFilter("test_drop_all")
+	require.NoError(t, err)
+	assert.False(t, f.Keep(metrics.Sample{}))
+
+	_, err = GetSampleFilter("nope")
+	assert.ErrorContains(t, err, `unknown sample filter: "nope"`)
+
+	assert.Panics(t, func() { RegisterSampleFilter("", SampleFilterFunc(nil)) })
+	assert.Panics(t, func() { RegisterSampleFilter("test_nil", nil) })
+}
+
+func TestConfig_ValidateSampleFilters(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?sampleFilters=customMetricsOnly,skipInternalMetrics"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{FilterCustomMetricsOnly, FilterSkipInternalMetrics}, cfg.SampleFilters)
+
+	_, err = ParseConfig(output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"sampleFilters": []string{"customMetricsOnly", "customMetricOnly"},
+	})})
+	assert.ErrorContains(t, err, `invalid sampleFilters: unknown sample filter: "customMetricOnly"`)
+}
+
+func TestOutput_SampleFilters(t *testing.T) {
+	t.Parallel()
+
+	fake, db := newFakeDB(t)
+	out, err := NewWithOptions(output.Params{
+		Logger:     newTestLogger(t),
+		JSONConfig: mustMarshalJSON(map[string]any{"sampleFilters": []string{FilterCustomMetricsOnly}}),
+	}, WithDB(db), WithSampleFilters(nil, SampleFilterFunc(func(s metrics.Sample) bool {
+		return s.Value >= 0
+	})))
+	require.NoError(t, err)
+	o := out.(*Output)
+	require.NoError(t, o.Start())
+	defer func() { require.NoError(t, o.Stop()) }()
+
+	registry := metrics.NewRegistry()
+	custom := registry.MustNewMetric("checkout_duration", metrics.Trend)
+	now := time.Now()
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+		{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(metrics.HTTPReqsName, metrics.Counter)}, Time: now, Value: 1},
+		{TimeSeries: metrics.TimeSeries{Metric: custom}, Time: now, Value: -1},
+		{TimeSeries: metrics.TimeSeries{Metric: custom}, Time: now, Value: 250},
+	}})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 1, "the config filter drops http_reqs, the code filter the negative value")
+	assert.Equal(t, "checkout_duration", rows[0][1])
+	assert.InDelta(t, 250.0, rows[0][2], 0)
+}
+
+func TestScenarioFilter(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("checkout_duration", metrics.Trend)
+	sample := func(scenario string) metrics.Sample {
+		tags := registry.RootTagSet()
+		if scenario != "" {
+			tags = tags.With("scenario", scenario)
+		}
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric, Tags: tags}}
+	}
+
+	assert.Nil(t, newScenarioFilter(nil, nil))
+
+	exclude := newScenarioFilter(nil, []string{"warmup"})
+	assert.False(t, exclude.Keep(sample("warmup")))
+	assert.True(t, exclude.Keep(sample("checkout")))
+	assert.True(t, exclude.Keep(sample("")), "samples without a scenario are kept")
+
+	include := newScenarioFilter([]string{"checkout", "search"}, []string{"warmup"})
+	assert.True(t, include.Keep(sample("search")))
+	assert.False(t, include.Keep(sample("background")))
+	assert.False(t, include.Keep(sample("warmup")))
+	assert.True(t, include.Keep(sample("")))
+	assert.True(t, include.Keep(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric}}))
+}
+
+func TestConfig_ScenarioFilters(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?includeScenarios=checkout,search&excludeScenarios=warmup"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"checkout", "search"}, cfg.IncludeScenarios)
+	assert.Equal(t, []string{"warmup"}, cfg.ExcludeScenarios)
+
+	cfg.ExcludeScenarios = append(cfg.ExcludeScenarios, "search")
+	require.ErrorContains(t, cfg.Validate(), "scenario search is listed in both includeScenarios and excludeScenarios")
+}
+
+func TestOutput_ExcludeScenarios(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{"excludeScenarios": []string{"warmup"}})
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric(metrics.HTTPReqsName, metrics.Counter)
+	now := time.Now()
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+		{TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet().With("scenario", "warmup")}, Time: now, Value: 1},
+		{TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet().With("scenario", "checkout")}, Time: now, Value: 1},
+	}})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 1)
+	assert.Equal(t, map[string]string{"scenario": "checkout"}, rows[0][3])
+}
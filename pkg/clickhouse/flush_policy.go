@@ -0,0 +1,163 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.k6.io/k6/v2/output"
+)
+
+// Behaviors when a flush is still running at the next PushInterval tick
+// (Config.FlushOverlapPolicy).
+const (
+	// FlushOverlapQueue runs the next flush as soon as the running one
+	// finishes. Ticks missed meanwhile collapse into that single flush.
+	FlushOverlapQueue = "queue"
+
+	// FlushOverlapSkip drops the tick; its samples stay in k6's buffer until
+	// the next tick that finds no flush running. Skips are counted.
+	FlushOverlapSkip = "skip"
+
+	// FlushOverlapConcurrent starts another flush alongside the running one,
+	// up to MaxConcurrentFlushes; ticks beyond the limit are skipped.
+	FlushOverlapConcurrent = "concurrent"
+)
+
+// validateFlushOverlap checks FlushOverlapPolicy and MaxConcurrentFlushes.
+func (c Config) validateFlushOverlap() error {
+	switch c.FlushOverlapPolicy {
+	case FlushOverlapQueue, FlushOverlapSkip:
+		return nil
+	case FlushOverlapConcurrent:
+		if c.MaxConcurrentFlushes <= 0 {
+			return fmt.Errorf("max concurrent flushes must be positive, got %d", c.MaxConcurrentFlushes)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid flushOverlapPolicy: %s (valid: %s, %s, %s)", c.FlushOverlapPolicy,
+			FlushOverlapQueue, FlushOverlapSkip, FlushOverlapConcurrent)
+	}
+}
+
+// tick is the PeriodicFlusher callback. The flusher waits for its callback,
+// so "queue" flushes in place, after any flush forced by Flush; the other
+// policies flush in the background and never hold up the next tick.
+func (o *Output) tick() {
+	if o.config.FlushOverlapPolicy == FlushOverlapQueue {
+		o.flushMu.Lock()
+		defer o.flushMu.Unlock()
+		_ = o.flushCycle(context.Background())
+		return
+	}
+
+	if !o.tryStartFlush() {
+		o.skippedFlushes.Add(1)
+		o.logger.Debug("Previous flush still running, skipping this cycle")
+		return
+	}
+	o.asyncFlushes.Add(1)
+	go func() {
+		defer o.asyncFlushes.Done()
+		defer o.endFlush()
+		_ = o.flushCycle(context.Background())
+	}()
+}
+
+// tryStartFlush claims a flush slot: a single one, or MaxConcurrentFlushes
+// with FlushOverlapPolicy "concurrent". It reports false when none is free.
+func (o *Output) tryStartFlush() bool {
+	if o.config.FlushOverlapPolicy != FlushOverlapConcurrent {
+		return o.flushMu.TryLock()
+	}
+	limit := int64(o.config.MaxConcurrentFlushes)
+	for {
+		n := o.activeFlushes.Load()
+		if n >= limit {
+			return false
+		}
+		if o.activeFlushes.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// endFlush releases the slot claimed by tryStartFlush.
+func (o *Output) endFlush() {
+	if o.config.FlushOverlapPolicy != FlushOverlapConcurrent {
+		o.flushMu.Unlock()
+		return
+	}
+	o.activeFlushes.Add(-1)
+}
+
+// flusher calls the flush callback periodically until Stop, which waits for
+// one last flush.
+type flusher interface {
+	Stop()
+}
+
+// newFlusher starts the flusher selected by AlignFlushes: k6's
+// PeriodicFlusher, or an alignedFlusher.
+func (o *Output) newFlusher() (flusher, error) {
+	if !o.config.AlignFlushes {
+		return output.NewPeriodicFlusher(o.config.PushInterval, o.tick)
+	}
+	return newAlignedFlusher(o.config.PushInterval, o.tick, time.Now), nil
+}
+
+// alignedFlusher is a PeriodicFlusher whose ticks fall on wall-clock
+// multiples of its period (AlignFlushes). Each wait is computed from the
+// clock, so ticks do not drift, and a boundary passed during a slow flush is
+// skipped like a missed ticker tick.
+type alignedFlusher struct {
+	period   time.Duration
+	callback func()
+	now      func() time.Time
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// newAlignedFlusher starts an alignedFlusher.
+func newAlignedFlusher(period time.Duration, callback func(), now func() time.Time) *alignedFlusher {
+	f := &alignedFlusher{
+		period:   period,
+		callback: callback,
+		now:      now,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go f.run()
+	return f
+}
+
+// nextTick returns the wait until the first period boundary after t.
+func nextTick(t time.Time, period time.Duration) time.Duration {
+	return t.Truncate(period).Add(period).Sub(t)
+}
+
+func (f *alignedFlusher) run() {
+	timer := time.NewTimer(nextTick(f.now(), f.period))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			f.callback()
+			timer.Reset(nextTick(f.now(), f.period))
+		case <-f.stop:
+			f.callback()
+			close(f.stopped)
+			return
+		}
+	}
+}
+
+// Stop flushes one last time and waits for it. It is safe to call several
+// times.
+func (f *alignedFlusher) Stop() {
+	f.once.Do(func() { close(f.stop) })
+	<-f.stopped
+}
@@ -0,0 +1,164 @@
+package clickhouse
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+// overlapConfig configures an output with the given flushOverlapPolicy
+// whose periodic flush never fires on its own.
+func overlapConfig(policy string) map[string]any {
+	return map[string]any{
+		"schemaMode":           "compatible",
+		"pushInterval":         "1h",
+		"flushOverlapPolicy":   policy,
+		"maxConcurrentFlushes": 2,
+	}
+}
+
+func TestFlushOverlap_Queue(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, overlapConfig(FlushOverlapQueue))
+	addStatusSamples(o, 3, 0)
+
+	// A forced flush is running: the tick waits for it, then flushes
+	require.True(t, o.tryStartFlush())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		o.tick()
+	}()
+	select {
+	case <-done:
+		t.Fatal("tick returned while a flush was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Empty(t, fake.Rows())
+	o.endFlush()
+
+	<-done
+	assert.Len(t, fake.Rows(), 3)
+	assert.Zero(t, o.GetErrorMetrics().SkippedFlushes)
+
+	require.NoError(t, o.Stop())
+}
+
+func TestFlushOverlap_Skip(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, overlapConfig(FlushOverlapSkip))
+	addStatusSamples(o, 3, 0)
+
+	// A flush is running: the tick is skipped and its samples wait
+	require.True(t, o.tryStartFlush())
+	o.tick()
+	assert.Equal(t, uint64(1), o.GetErrorMetrics().SkippedFlushes)
+	o.endFlush()
+
+	o.tick()
+	o.asyncFlushes.Wait()
+	assert.Len(t, fake.Rows(), 3)
+
+	require.NoError(t, o.Stop())
+}
+
+func TestFlushOverlap_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, overlapConfig(FlushOverlapConcurrent))
+
+	// One flush in flight leaves room for a second
+	require.True(t, o.tryStartFlush())
+	addStatusSamples(o, 3, 0)
+	o.tick()
+	o.asyncFlushes.Wait()
+	assert.Len(t, fake.Rows(), 3)
+
+	// At the limit, ticks are skipped
+	require.True(t, o.tryStartFlush())
+	assert.False(t, o.tryStartFlush())
+	o.tick()
+	assert.Equal(t, uint64(1), o.GetErrorMetrics().SkippedFlushes)
+	o.endFlush()
+	o.endFlush()
+
+	require.NoError(t, o.Stop())
+}
+
+func TestFlushOverlap_StopFlushesSkippedTick(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []string{FlushOverlapQueue, FlushOverlapSkip, FlushOverlapConcurrent} {
+		t.Run(policy, func(t *testing.T) {
+			t.Parallel()
+
+			fake, o := startFakeOutput(t, overlapConfig(policy))
+			addStatusSamples(o, 3, 0)
+			require.NoError(t, o.Stop())
+			assert.Len(t, fake.Rows(), 3)
+		})
+	}
+}
+
+func TestConfig_FlushOverlapValidation(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{
+		ConfigArgument: "localhost:9000?flushOverlapPolicy=concurrent&maxConcurrentFlushes=4",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, FlushOverlapConcurrent, cfg.FlushOverlapPolicy)
+	assert.Equal(t, 4, cfg.MaxConcurrentFlushes)
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?flushOverlapPolicy=parallel"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid flushOverlapPolicy: parallel")
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?flushOverlapPolicy=concurrent&maxConcurrentFlushes=0"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "max concurrent flushes must be positive")
+}
+
+func TestNextTick(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 3*time.Second, nextTick(base.Add(2*time.Second), 5*time.Second))
+	assert.Equal(t, 5*time.Second, nextTick(base, 5*time.Second), "a boundary waits for the next one")
+	assert.Equal(t, 50*time.Millisecond, nextTick(base.Add(1250*time.Millisecond), 100*time.Millisecond))
+	assert.Equal(t, time.Minute-17*time.Second, nextTick(base.Add(17*time.Second), time.Minute))
+}
+
+func TestAlignedFlusher(t *testing.T) {
+	t.Parallel()
+
+	var ticks atomic.Int32
+	f := newAlignedFlusher(10*time.Millisecond, func() { ticks.Add(1) }, time.Now)
+	require.Eventually(t, func() bool { return ticks.Load() >= 2 }, time.Second, time.Millisecond)
+
+	f.Stop()
+	stopped := ticks.Load()
+	f.Stop()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, stopped, ticks.Load(), "Stop flushes once and ends the ticks")
+}
+
+func TestOutput_AlignFlushes(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval": "1h",
+		"alignFlushes": true,
+	})
+	require.IsType(t, &alignedFlusher{}, o.periodicFlusher)
+
+	addStatusSamples(o, 2, 0)
+	require.NoError(t, o.Stop())
+	assert.Len(t, fake.Rows(), 2, "Stop flushes")
+}
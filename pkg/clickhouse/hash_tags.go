@@ -0,0 +1,188 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// hashTagValue returns the stable 64-bit hash that replaces a hashed tag value.
+// It is xxHash64 with seed 0, identical to ClickHouse's xxHash64(), so a known
+// value can be looked up in SQL with toString(xxHash64('value')).
+func hashTagValue(value string) uint64 {
+	return xxhash.Sum64String(value)
+}
+
+// maxTagHashesSeen bounds the pairs remembered as recorded, so hashing
+// unbounded values (session tokens, ...) cannot grow the set without limit.
+// Beyond it the set starts over: pairs seen again are written again, and the
+// lookup table's ReplacingMergeTree collapses the duplicates.
+const maxTagHashesSeen = 100000
+
+// maxTagLookupPending caps the pairs kept while the lookup table cannot be
+// written; the oldest are dropped beyond it.
+const maxTagLookupPending = 10000
+
+// tagHashEntry is one distinct (tag, value) pair recorded for the lookup table.
+type tagHashEntry struct {
+	tag   string
+	hash  uint64
+	value string
+}
+
+// tagHashKey identifies a recorded pair without retaining the original value.
+type tagHashKey struct {
+	tag  string
+	hash uint64
+}
+
+// tagHasher replaces the values of high-cardinality tags (user IDs, session
+// tokens, ...) by their hash before conversion. When a lookup table is
+// configured it also records each distinct pair so that hashes can be mapped
+// back to the original values.
+type tagHasher struct {
+	tags   []string
+	lookup bool
+
+	mu      sync.Mutex
+	seen    map[tagHashKey]struct{}
+	pending pendingRows[tagHashEntry]
+}
+
+// newTagHasher returns nil when no tags are configured for hashing.
+func newTagHasher(tags []string, lookup bool) *tagHasher {
+	if len(tags) == 0 {
+		return nil
+	}
+	return &tagHasher{
+		tags:    tags,
+		lookup:  lookup,
+		seen:    make(map[tagHashKey]struct{}),
+		pending: pendingRows[tagHashEntry]{limit: maxTagLookupPending},
+	}
+}
+
+// apply returns sample with the configured tag values replaced by their
+// decimal hash. k6's tag set is immutable, so a derived set is built and the
+// source sample is left untouched.
+func (h *tagHasher) apply(sample metrics.Sample) metrics.Sample {
+	if sample.Tags == nil {
+		return sample
+	}
+
+	tags := sample.Tags
+	for _, tag := range h.tags {
+		value, ok := tags.Get(tag)
+		if !ok {
+			continue
+		}
+		hash := hashTagValue(value)
+		tags = tags.With(tag, strconv.FormatUint(hash, 10))
+		if h.lookup {
+			h.record(tag, hash, value)
+		}
+	}
+	sample.Tags = tags
+	return sample
+}
+
+// record queues a pair for the lookup table unless it was already seen.
+func (h *tagHasher) record(tag string, hash uint64, value string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := tagHashKey{tag: tag, hash: hash}
+	if _, ok := h.seen[key]; ok {
+		return
+	}
+	if len(h.seen) >= maxTagHashesSeen {
+		clear(h.seen)
+	}
+	h.seen[key] = struct{}{}
+	h.pending.add(tagHashEntry{tag: tag, hash: hash, value: value})
+}
+
+// hashingConverter applies a tagHasher before delegating to the schema's
+// converter, so hashing works with every schema, including custom ones.
+type hashingConverter struct {
+	SampleConverter
+	hasher *tagHasher
+}
+
+// Convert hashes the configured tags, then converts with the wrapped converter.
+func (c hashingConverter) Convert(ctx context.Context, sample metrics.Sample) ([]any, error) {
+	return c.SampleConverter.Convert(ctx, c.hasher.apply(sample))
+}
+
+// createTagLookupTable creates the side table mapping hashes back to values.
+// ReplacingMergeTree collapses the duplicates written by separate test runs.
+func createTagLookupTable(ctx context.Context, db *sql.DB, database, table string) error {
+	if !isValidIdentifier(database) {
+		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", database)
+	}
+	if !isValidIdentifier(table) {
+		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
+	}
+
+	//nolint:gosec // G201: identifiers are validated with isValidIdentifier() and escaped with backticks
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s.%s (
+			tag        LowCardinality(String),
+			hash       UInt64,
+			value      String CODEC(ZSTD(1)),
+			first_seen DateTime64(%d, 'UTC') DEFAULT now64(%d)
+		) ENGINE = ReplacingMergeTree()
+		ORDER BY (tag, hash)
+	`, escapeIdentifier(database), escapeIdentifier(table), TimestampPrecision, TimestampPrecision)
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create tag lookup table: %w", err)
+	}
+	return nil
+}
+
+// writeTagLookup inserts newly seen pairs into the lookup table in one batch.
+func writeTagLookup(ctx context.Context, db *sql.DB, database, table string, entries []tagHashEntry) error {
+	if db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	batch, err := prepareInsert(ctx, db, nil, fmt.Sprintf(
+		"INSERT INTO %s.%s (tag, hash, value) VALUES (?, ?, ?)",
+		escapeIdentifier(database), escapeIdentifier(table)))
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := batch.append(ctx, e.tag, e.hash, e.value); err != nil {
+			batch.abort()
+			return fmt.Errorf("failed to insert tag lookup row: %w", err)
+		}
+	}
+	if err := batch.send(); err != nil {
+		return fmt.Errorf("failed to send tag lookup rows: %w", err)
+	}
+	return nil
+}
+
+// flushTagLookup writes the pairs recorded since the last flush. Failures are
+// logged and the pairs retried on the next flush; they never fail the samples.
+func (o *Output) flushTagLookup(ctx context.Context, hasher *tagHasher) {
+	if hasher == nil || !hasher.lookup {
+		return
+	}
+	table := o.config.HashTagsLookupTable
+	flushPendingRows(o, &hasher.pending, table, "tag hash lookup", func(entries []tagHashEntry) error {
+		o.mu.RLock()
+		db := o.db
+		o.mu.RUnlock()
+		return writeTagLookup(o.config.insertContext(ctx), db, o.config.Database, table, entries)
+	})
+}
@@ -0,0 +1,167 @@
+package clickhouse
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestHashTagValue_MatchesClickHouse(t *testing.T) {
+	t.Parallel()
+
+	// SELECT xxHash64('') = 17241709254077376921
+	assert.Equal(t, uint64(17241709254077376921), hashTagValue(""))
+	assert.Equal(t, hashTagValue("user-42"), hashTagValue("user-42"), "hash must be stable")
+	assert.NotEqual(t, hashTagValue("user-42"), hashTagValue("user-43"))
+}
+
+func TestTagHasher_Apply(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	source := registry.RootTagSet().WithTagsFromMap(map[string]string{
+		"user_id": "alice",
+		"method":  "GET",
+	})
+	sample := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: registry.MustNewMetric("http_reqs", metrics.Counter),
+			Tags:   source,
+		},
+	}
+
+	h := newTagHasher([]string{"user_id", "session"}, true)
+	got := h.apply(sample)
+
+	assert.Equal(t, map[string]string{
+		"user_id": strconv.FormatUint(hashTagValue("alice"), 10),
+		"method":  "GET",
+	}, got.Tags.Map())
+	assert.Equal(t, "alice", source.Map()["user_id"], "source tag set must not be mutated")
+
+	// The same value again is not recorded twice
+	h.apply(sample)
+	pending := h.pending.take()
+	require.Len(t, pending, 1)
+	assert.Equal(t, tagHashEntry{tag: "user_id", hash: hashTagValue("alice"), value: "alice"}, pending[0])
+	assert.Empty(t, h.pending.take())
+
+	t.Run("no tags", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, newTagHasher(nil, true))
+		assert.Equal(t, metrics.Sample{}, newTagHasher([]string{"x"}, false).apply(metrics.Sample{}))
+	})
+}
+
+func TestTagHasher_Bounded(t *testing.T) {
+	t.Parallel()
+
+	h := newTagHasher([]string{"session"}, true)
+	for i := range maxTagHashesSeen + 1 {
+		value := strconv.Itoa(i)
+		h.record("session", hashTagValue(value), value)
+	}
+	assert.Len(t, h.seen, 1, "a full set starts over")
+
+	pending := h.pending.take()
+	require.Len(t, pending, maxTagLookupPending, "the oldest unwritten pairs are dropped")
+	assert.Equal(t, strconv.Itoa(maxTagHashesSeen), pending[len(pending)-1].value)
+
+	// A pair forgotten with the set is written again
+	h.record("session", hashTagValue("0"), "0")
+	assert.Len(t, h.pending.take(), 1)
+}
+
+func TestConfig_ValidateHashTags(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.HashTagsLookupTable = "tag_lookup"
+	assert.ErrorContains(t, cfg.Validate(), "hashTagsLookupTable requires hashTags")
+
+	cfg.HashTags = []string{"user_id"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.HashTagsLookupTable = "tag-lookup"
+	assert.ErrorContains(t, cfg.Validate(), "invalid hashTagsLookupTable")
+
+	cfg.HashTagsLookupTable = ""
+	cfg.HashTags = []string{"user_id", " "}
+	assert.ErrorContains(t, cfg.Validate(), "tag names must not be empty")
+}
+
+func TestParseConfig_HashTags(t *testing.T) {
+	t.Run("json array", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{
+				"hashTags":            []string{"user_id", "session"},
+				"hashTagsLookupTable": "tag_lookup",
+			}),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user_id", "session"}, cfg.HashTags)
+		assert.Equal(t, "tag_lookup", cfg.HashTagsLookupTable)
+	})
+
+	t.Run("url list", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?hashTags=user_id,%20session,"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user_id", "session"}, cfg.HashTags)
+	})
+
+	t.Run("env overrides url", func(t *testing.T) {
+		t.Setenv("K6_CLICKHOUSE_HASH_TAGS", "trace_id")
+
+		cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?hashTags=user_id"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"trace_id"}, cfg.HashTags)
+	})
+}
+
+func TestOutput_HashTags(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"hashTags":            []string{"user_id"},
+		"hashTagsLookupTable": "tag_lookup",
+	})
+
+	ddl := fake.DDL()
+	require.Len(t, ddl, 3)
+	assert.Contains(t, ddl[2], "`k6`.`tag_lookup`")
+	assert.Contains(t, ddl[2], "ReplacingMergeTree")
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("checkout", metrics.Trend)
+	sampleFor := func(user string) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: metric,
+				Tags:   registry.RootTagSet().With("user_id", user),
+			},
+			Value: 1,
+		}
+	}
+
+	// A failed lookup write is retried on the next flush without losing rows
+	fake.set(func(f *fakeDB) { f.commitErr = errors.New("boom") })
+	o.tagHasher.apply(sampleFor("alice"))
+	o.flushTagLookup(t.Context(), o.tagHasher)
+	fake.set(func(f *fakeDB) { f.commitErr = nil })
+
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{sampleFor("alice"), sampleFor("bob")}})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 4, "two samples and two lookup rows")
+	hashed := func(v string) string { return strconv.FormatUint(hashTagValue(v), 10) }
+	assert.Equal(t, map[string]string{"user_id": hashed("alice")}, rows[0][3])
+	assert.Equal(t, map[string]string{"user_id": hashed("bob")}, rows[1][3])
+	assert.Equal(t, []any{"user_id", (hashTagValue("alice")), "alice"}, rows[2])
+	assert.Equal(t, []any{"user_id", (hashTagValue("bob")), "bob"}, rows[3])
+}
@@ -0,0 +1,269 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// batchConn is the part of clickhouse-go's database/sql connection that
+// drives its native insert batch. ClickHouse has no transactions: the
+// driver's BeginTx is a no-op, PrepareContext opens the batch, Commit sends
+// it, and Rollback discards it by closing the connection.
+type batchConn interface {
+	Commit() error
+	Rollback() error
+}
+
+// insertBatch is one INSERT sent through the driver's native batch API. The
+// batch lives on a connection pinned for its lifetime, so it works the same
+// whether db comes from clickhouse.OpenDB or from NewWithDB.
+//
+// Each phase fails differently:
+//   - prepare sends the INSERT header; on failure nothing was written.
+//   - append buffers rows client-side; on failure nothing was written.
+//   - send ships the rows in one round-trip; see sendError.
+type insertBatch struct {
+	conn     *sql.Conn
+	stmt     *sql.Stmt
+	slot     *connSlot // receives conn after a successful send; may be nil
+	pinnedAt time.Time
+}
+
+// buildInsertQuery returns the INSERT statement for columns of a table, with
+// one placeholder per column.
+func buildInsertQuery(database, table string, columns []string) string {
+	return fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES (%s)",
+		escapeIdentifier(database), escapeIdentifier(table), strings.Join(columns, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+}
+
+// rowArityError reports a row whose length does not match columns, naming
+// the columns it lacks or the number of values past the last one. It returns
+// nil for a matching row and when the columns are unknown.
+func rowArityError(row []any, columns []string) error {
+	switch {
+	case len(columns) == 0 || len(row) == len(columns):
+		return nil
+	case len(row) < len(columns):
+		return fmt.Errorf("converter returned %d values for %d columns: no value for %s",
+			len(row), len(columns), strings.Join(columns[len(row):], ", "))
+	default:
+		return fmt.Errorf("converter returned %d values for %d columns: %d past the last column, %s",
+			len(row), len(columns), len(row)-len(columns), columns[len(columns)-1])
+	}
+}
+
+// insertSettings returns the session resource limits and async insert
+// settings sent with every insert, or nil when none are configured.
+func (c Config) insertSettings() clickhouse.Settings {
+	settings := clickhouse.Settings{}
+	if c.MaxMemoryUsage > 0 {
+		settings["max_memory_usage"] = c.MaxMemoryUsage
+	}
+	if c.MaxInsertThreads > 0 {
+		settings["max_insert_threads"] = c.MaxInsertThreads
+	}
+	if c.QueryPriority > 0 {
+		settings["priority"] = c.QueryPriority
+	}
+	if c.AsyncInsert {
+		settings["async_insert"] = 1
+		settings["wait_for_async_insert"] = 1
+	}
+	if len(settings) == 0 {
+		return nil
+	}
+	return settings
+}
+
+// insertContext attaches the insert settings, and the batch's
+// insert_deduplication_token when the WAL set one (see withDedupToken), to
+// ctx. The driver sends them with the INSERT query when the batch is prepared.
+func (c Config) insertContext(ctx context.Context) context.Context {
+	settings := c.insertSettings()
+	if token := dedupToken(ctx); token != "" {
+		if settings == nil {
+			settings = clickhouse.Settings{}
+		}
+		settings["insert_deduplication_token"] = token
+	}
+	if settings == nil {
+		return ctx
+	}
+	return clickhouse.Context(ctx, clickhouse.WithSettings(settings))
+}
+
+// prepareInsert opens an insert batch for query on the connection parked in
+// slot, or on a connection from db's pool. slot may be nil.
+func prepareInsert(ctx context.Context, db *sql.DB, slot *connSlot, query string) (*insertBatch, error) {
+	if conn, pinnedAt := slot.take(); conn != nil {
+		if stmt, err := conn.PrepareContext(ctx, query); err == nil {
+			return &insertBatch{conn: conn, stmt: stmt, slot: slot, pinnedAt: pinnedAt}, nil
+		}
+		// The parked connection went bad (server restart, dropped by a
+		// proxy): discard it and start over from the pool.
+		discardConn(conn)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	stmt, err := conn.PrepareContext(ctx, query)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to prepare batch: %w", err)
+	}
+	return &insertBatch{conn: conn, stmt: stmt, slot: slot, pinnedAt: time.Now()}, nil
+}
+
+// append adds one row to the batch.
+func (b *insertBatch) append(ctx context.Context, row ...any) error {
+	_, err := b.stmt.ExecContext(ctx, row...)
+	return err
+}
+
+// send ships the batch to the server. On success the connection is parked
+// for the next batch; otherwise it is released.
+func (b *insertBatch) send() error {
+	err := b.conn.Raw(func(dc any) error {
+		c, ok := dc.(batchConn)
+		if !ok {
+			return fmt.Errorf("driver connection %T does not support batches", dc)
+		}
+		return c.Commit()
+	})
+	if err != nil {
+		b.close()
+		return err
+	}
+	_ = b.stmt.Close()
+	b.slot.put(b.conn, b.pinnedAt)
+	return nil
+}
+
+// abort discards an unsent batch. The server is still waiting for the rows
+// of the INSERT, so the connection cannot be reused and is closed.
+func (b *insertBatch) abort() {
+	defer b.close()
+	_ = b.conn.Raw(func(dc any) error {
+		if c, ok := dc.(batchConn); ok {
+			_ = c.Rollback()
+		}
+		return driver.ErrBadConn // drop the connection from the pool
+	})
+}
+
+func (b *insertBatch) close() {
+	_ = b.stmt.Close()
+	_ = b.conn.Close()
+}
+
+// sendError reports a failed send. A ClickHouse exception means the server
+// received the rows and refused the INSERT, so nothing was written and the
+// batch may be resent. Any other failure (a connection lost mid-send) is
+// ambiguous: the server may have persisted the rows before the response was
+// lost, so it becomes a commitError, which is never retried.
+func sendError(err error) error {
+	if _, ok := errors.AsType[*clickhouse.Exception](err); ok {
+		return fmt.Errorf("failed to send batch: %w", err)
+	}
+	return &commitError{err: err}
+}
+
+// connSlot parks the connection of a target's last successful batch until
+// the next flush. The native protocol needs a fresh INSERT header for every
+// batch, so the prepared batch itself cannot outlive a send; reusing its
+// connection keeps consecutive flushes on one warm connection instead of
+// going through the pool each time.
+//
+// A parked connection is invisible to the pool's own limits, so the slot
+// applies them itself: it drops a connection idle for longer than maxIdle
+// and hands one pinned for longer than maxLifetime back to the pool.
+type connSlot struct {
+	mu        sync.Mutex
+	conn      *sql.Conn
+	pinnedAt  time.Time // when conn was taken from the pool
+	idleSince time.Time
+
+	maxIdle     time.Duration // 0 = no idle limit
+	maxLifetime time.Duration
+}
+
+// newConnSlot returns a slot applying the config's connection lifetime
+// settings.
+func (c Config) newConnSlot() *connSlot {
+	lifetime := c.ConnMaxLifetime
+	if lifetime == 0 {
+		lifetime = defaultConnMaxLifetime
+	}
+	return &connSlot{maxIdle: c.ConnMaxIdleTime, maxLifetime: lifetime}
+}
+
+// defaultConnMaxLifetime is the driver's default for ConnMaxLifetime.
+const defaultConnMaxLifetime = time.Hour
+
+// take returns the parked connection, if any, and empties the slot.
+func (s *connSlot) take() (*sql.Conn, time.Time) {
+	if s == nil {
+		return nil, time.Time{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conn, pinnedAt := s.conn, s.pinnedAt
+	s.conn = nil
+	if conn != nil && s.maxIdle > 0 && time.Since(s.idleSince) > s.maxIdle {
+		// Likely dropped by a proxy by now; don't hand it to the pool either.
+		discardConn(conn)
+		return nil, time.Time{}
+	}
+	return conn, pinnedAt
+}
+
+// put parks conn, or returns it to the pool when the slot is taken or conn
+// has been pinned for maxLifetime.
+func (s *connSlot) put(conn *sql.Conn, pinnedAt time.Time) {
+	if s == nil {
+		_ = conn.Close()
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil || time.Since(pinnedAt) > s.maxLifetime {
+		_ = conn.Close()
+		return
+	}
+	s.conn, s.pinnedAt, s.idleSince = conn, pinnedAt, time.Now()
+}
+
+// close returns the parked connection to the pool.
+func (s *connSlot) close() {
+	if conn, _ := s.take(); conn != nil {
+		_ = conn.Close()
+	}
+}
+
+// discard closes the parked connection instead of returning it to the
+// pool, after the driver reported it closed.
+func (s *connSlot) discard() {
+	if conn, _ := s.take(); conn != nil {
+		discardConn(conn)
+	}
+}
+
+// discardConn closes conn's driver connection instead of returning it to
+// the pool.
+func discardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	_ = conn.Close()
+}
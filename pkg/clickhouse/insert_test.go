@@ -0,0 +1,235 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+// insertConfig configures a compatible-schema output that retries quickly
+// and only flushes when told to.
+func insertConfig() map[string]any {
+	return map[string]any{
+		"schemaMode":    "compatible",
+		"pushInterval":  "1h",
+		"retryAttempts": 1,
+		"retryDelay":    "1ms",
+		"retryMaxDelay": "1ms",
+	}
+}
+
+func TestSendError(t *testing.T) {
+	t.Parallel()
+
+	refused := sendError(&clickhouse.Exception{Code: 242, Name: "TABLE_IS_READ_ONLY"})
+	assert.False(t, isCommitError(refused), "a server exception means nothing was written")
+	assert.Equal(t, errClassReadOnly, classifyError(refused))
+
+	lost := sendError(errors.New("write: broken pipe"))
+	assert.True(t, isCommitError(lost), "a lost connection is ambiguous")
+	assert.False(t, isRetryableError(lost))
+}
+
+func TestBuildInsertQuery(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "INSERT INTO `k6`.`samples` (timestamp, metric, value) VALUES (?, ?, ?)",
+		buildInsertQuery("k6", "samples", []string{"timestamp", "metric", "value"}))
+}
+
+func TestRowArityError(t *testing.T) {
+	t.Parallel()
+
+	columns := []string{"timestamp", "metric", "value", "tags"}
+	require.NoError(t, rowArityError(make([]any, 4), columns))
+	require.NoError(t, rowArityError(make([]any, 2), nil), "unknown columns are not checked")
+	require.EqualError(t, rowArityError(make([]any, 2), columns),
+		"converter returned 2 values for 4 columns: no value for value, tags")
+	require.EqualError(t, rowArityError(make([]any, 6), columns),
+		"converter returned 6 values for 4 columns: 2 past the last column, tags")
+}
+
+// truncatingConverter drops the last value of every row.
+type truncatingConverter struct{ SampleConverter }
+
+func (c truncatingConverter) Convert(ctx context.Context, sample metrics.Sample) ([]any, error) {
+	row, err := c.SampleConverter.Convert(ctx, sample)
+	if err != nil {
+		return nil, err
+	}
+	return row[:len(row)-1], nil
+}
+
+func TestInsert_RowArityMismatch(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, insertConfig())
+	probes := len(fake.Prepared())
+	o.targets[0].converter = truncatingConverter{o.targets[0].converter}
+
+	addStatusSamples(o, 3, 0)
+	o.flush()
+
+	assert.Equal(t, uint64(3), o.GetErrorMetrics().ConvertErrors, "short rows fail conversion")
+	assert.Len(t, fake.Prepared(), probes, "the server is never sent a short row")
+}
+
+func TestInsert_ServerRefusalIsBuffered(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, insertConfig())
+
+	fake.set(func(f *fakeDB) { f.commitErr = &clickhouse.Exception{Code: 242, Name: "TABLE_IS_READ_ONLY"} })
+	addStatusSamples(o, 3, 0)
+	o.flush()
+
+	stats := o.GetErrorMetrics()
+	assert.Zero(t, stats.SamplesProcessed, "refused rows are not counted as processed")
+	assert.Equal(t, uint64(1), stats.BufferedSamples)
+
+	// Replayed once the table accepts writes again
+	fake.set(func(f *fakeDB) { f.commitErr = nil })
+	o.flush()
+	assert.Len(t, fake.Rows(), 3)
+}
+
+func TestInsert_LostSendIsNotResent(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, insertConfig())
+
+	fake.set(func(f *fakeDB) { f.commitErr = errors.New("write: broken pipe") })
+	addStatusSamples(o, 3, 0)
+	o.flush()
+
+	stats := o.GetErrorMetrics()
+	assert.Equal(t, uint64(3), stats.SamplesProcessed, "ambiguous sends count as processed")
+	assert.Zero(t, stats.BufferedSamples)
+	assert.Zero(t, stats.RetryAttempts)
+}
+
+func TestInsert_AppendErrorAbortsBatch(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, insertConfig())
+
+	fake.set(func(f *fakeDB) {
+		f.execErr = errors.New("connection reset by peer")
+		f.aborts = 0 // discard the Start probe
+	})
+	addStatusSamples(o, 3, 0)
+	o.flush()
+
+	assert.Empty(t, fake.Rows())
+	fake.set(func(f *fakeDB) {
+		assert.Equal(t, 2, f.aborts, "initial attempt and one retry")
+		assert.Zero(t, f.commits)
+	})
+}
+
+func TestInsert_NoBatchWithoutRows(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, insertConfig())
+	probes := len(fake.Prepared())
+
+	// Every sample fails conversion: the server is never contacted
+	addStatusSamples(o, 3, 3)
+	o.flush()
+
+	assert.Len(t, fake.Prepared(), probes)
+	fake.set(func(f *fakeDB) { assert.Equal(t, probes, f.aborts) })
+}
+
+func TestInsert_ReusesConnection(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, insertConfig())
+	slot := o.targets[0].conns
+
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	parked := slot.conn
+	require.NotNil(t, parked, "connection parked after a successful send")
+
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	assert.Same(t, parked, slot.conn, "next flush reuses the parked connection")
+
+	// A parked connection broken by a server restart is replaced
+	fake.breakConns()
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	assert.Len(t, fake.Rows(), 9)
+	assert.NotSame(t, parked, slot.conn)
+	assert.Zero(t, o.GetErrorMetrics().FlushFailures)
+}
+
+func TestConnSlot_Limits(t *testing.T) {
+	t.Parallel()
+
+	_, db := newFakeDB(t)
+	conn := func() *sql.Conn {
+		c, err := db.Conn(context.Background())
+		require.NoError(t, err)
+		return c
+	}
+
+	t.Run("idle", func(t *testing.T) {
+		t.Parallel()
+		slot := &connSlot{maxIdle: time.Millisecond, maxLifetime: time.Hour}
+		slot.put(conn(), time.Now())
+		time.Sleep(5 * time.Millisecond)
+		c, _ := slot.take()
+		assert.Nil(t, c, "idle connection dropped")
+	})
+
+	t.Run("lifetime", func(t *testing.T) {
+		t.Parallel()
+		slot := &connSlot{maxLifetime: time.Minute}
+		slot.put(conn(), time.Now().Add(-time.Hour))
+		c, _ := slot.take()
+		assert.Nil(t, c, "expired connection returned to the pool")
+	})
+
+	t.Run("occupied", func(t *testing.T) {
+		t.Parallel()
+		slot := &connSlot{maxLifetime: time.Hour}
+		first := conn()
+		slot.put(first, time.Now())
+		slot.put(conn(), time.Now())
+		c, _ := slot.take()
+		assert.Same(t, first, c)
+		require.NoError(t, c.Close())
+	})
+}
+
+func TestConfig_InsertSettings(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{
+		ConfigArgument: "localhost:9000?maxMemoryUsage=8000000000&maxInsertThreads=2&priority=5",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, clickhouse.Settings{
+		"max_memory_usage":   uint64(8000000000),
+		"max_insert_threads": uint(2),
+		"priority":           uint(5),
+	}, cfg.insertSettings())
+
+	cfg = NewConfig()
+	cfg.AsyncInsert = true
+	assert.Equal(t, clickhouse.Settings{"async_insert": 1, "wait_for_async_insert": 1}, cfg.insertSettings())
+
+	ctx := context.Background()
+	assert.Nil(t, NewConfig().insertSettings())
+	assert.Equal(t, ctx, NewConfig().insertContext(ctx), "no settings, context unchanged")
+}
@@ -19,12 +19,54 @@ type SchemaCreator interface {
 	InsertQuery(database, table string) string
 }
 
+// TableCreator is optionally implemented by a SchemaCreator that can create
+// its table in an existing database. The output needs it to create tables
+// with createDatabase=false; schemas without it then fail at Start.
+type TableCreator interface {
+	// CreateTable creates the table, but not the database, in ClickHouse.
+	// It should be idempotent (safe to call multiple times).
+	CreateTable(ctx context.Context, db *sql.DB, database, table string) error
+}
+
+// SchemaValidator is optionally implemented by a SchemaCreator that can check
+// an existing table. When the output does not create the table
+// (skipSchemaCreation, createTable=false, or schemaFollower), it calls
+// Validate at Start, so a table that does not match the schema fails the run
+// up front rather than every insert. Both built-in schemas implement it.
+type SchemaValidator interface {
+	// Validate returns an error describing how the table differs from the
+	// schema — missing columns, column types, engine — or nil if it matches.
+	// Columns the schema does not know are allowed.
+	Validate(ctx context.Context, db *sql.DB, database, table string) error
+}
+
+// SchemaMigrator is optionally implemented by a SchemaCreator whose table
+// changes between releases. Its tables carry a version marker, the table
+// comment SchemaVersionComment returns. When the output creates tables, it
+// reads the marker at Start and calls Migrate on a table of an older version
+// (0 for a table without marker, created before versioning), then updates
+// the marker. Both built-in schemas implement it.
+type SchemaMigrator interface {
+	// SchemaVersion returns the version of the table the schema creates. It
+	// starts at 1 and grows with each change that needs a migration;
+	// CreateTable stamps new tables with it.
+	SchemaVersion() int
+
+	// Migrate upgrades the table from fromVersion to SchemaVersion. Several
+	// instances may migrate at once and a failed migration is retried on the
+	// next Start, so it must be idempotent (ADD COLUMN IF NOT EXISTS, ...).
+	Migrate(ctx context.Context, db *sql.DB, database, table string, fromVersion int) error
+}
+
 // SampleConverter converts k6 metric samples to rows for ClickHouse insertion.
 // Implement this interface to customize how k6 tags map to your schema columns.
 type SampleConverter interface {
 	// Convert transforms a k6 sample into a row ([]any) for insertion.
-	// The returned slice must match the column order from InsertQuery.
+	// The returned slice must match the column order from InsertQuery (or
+	// from ColumnNames when InsertQuery lists no columns).
 	// Returns an error if conversion fails (e.g., type parsing errors).
+	// Convert is called from several goroutines at once, also within a
+	// single flush, and must be safe for concurrent use.
 	Convert(ctx context.Context, sample metrics.Sample) ([]any, error)
 
 	// Release returns pooled resources (e.g., maps, slices) after insertion.
@@ -32,6 +74,55 @@ type SampleConverter interface {
 	Release(row []any)
 }
 
+// ColumnNamer is optionally implemented by a SampleConverter that knows the
+// columns of its rows. The output then reports a row of the wrong length with
+// the columns it lacks, even when InsertQuery has no column list of its own;
+// a column list in InsertQuery still wins, so a schema that embeds a built-in
+// one and overrides InsertQuery inserts its own columns. The built-in
+// schemas build InsertQuery from the same names their converters return.
+type ColumnNamer interface {
+	// ColumnNames returns the columns of the rows Convert returns, in row
+	// order. Names must be valid identifiers (alphanumeric + underscore).
+	ColumnNames() []string
+}
+
+// SampleFilter decides which samples the output writes. Filters run before
+// conversion, for every target: a sample is written only when every filter
+// keeps it. Keep is called from concurrent flushes and must not modify the
+// sample.
+type SampleFilter interface {
+	// Keep reports whether sample is written.
+	Keep(sample metrics.Sample) bool
+}
+
+// SampleFilterFunc adapts an ordinary function to the SampleFilter interface.
+type SampleFilterFunc func(sample metrics.Sample) bool
+
+// Keep calls f(sample).
+func (f SampleFilterFunc) Keep(sample metrics.Sample) bool {
+	return f(sample)
+}
+
+// TagTransformer rewrites the tags of a sample before conversion — renaming,
+// redacting, or deriving tags — so that tag handling does not need a custom
+// SampleConverter. Transformers run for every target, before tag hashing.
+// Transform is called from concurrent flushes.
+type TagTransformer interface {
+	// Transform returns the tags the sample is converted with. k6 tag sets
+	// are immutable: derive the result with With and Without rather than
+	// modifying sample.Tags. Returning nil keeps the tags unchanged.
+	Transform(sample metrics.Sample) *metrics.TagSet
+}
+
+// TagTransformerFunc adapts an ordinary function to the TagTransformer
+// interface.
+type TagTransformerFunc func(sample metrics.Sample) *metrics.TagSet
+
+// Transform calls f(sample).
+func (f TagTransformerFunc) Transform(sample metrics.Sample) *metrics.TagSet {
+	return f(sample)
+}
+
 // SchemaImplementation bundles a schema creator with its corresponding converter.
 // This ensures the schema and conversion logic are always kept in sync.
 type SchemaImplementation struct {
@@ -43,4 +134,10 @@ type SchemaImplementation struct {
 
 	// Converter handles k6 sample to row conversion
 	Converter SampleConverter
+
+	// Configure optionally derives a variant of the implementation from the
+	// output configuration, for schemas with optional columns or storage
+	// toggles. It is called once per target at Start; when nil, Schema and
+	// Converter are used as registered.
+	Configure func(cfg Config) (SchemaImplementation, error)
 }
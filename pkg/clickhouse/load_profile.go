@@ -0,0 +1,165 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// maxLoadProfilePending caps the snapshots kept while the load profile table
+// cannot be written; the oldest are dropped beyond it.
+const maxLoadProfilePending = 10000
+
+// loadSnapshot is one row of the load profile table: the applied load at the
+// end of a flush interval.
+type loadSnapshot struct {
+	time       time.Time
+	testID     string
+	vus        uint32
+	vusMax     uint32
+	iterations uint64 // completed during the interval
+	dropped    uint64 // dropped_iterations during the interval
+}
+
+// loadProfile turns the vus, vus_max, iterations, and dropped_iterations
+// samples of each flush into a snapshot for Config.LoadProfileTable.
+type loadProfile struct {
+	mu      sync.Mutex
+	last    loadSnapshot // gauges carry over flushes without vus samples
+	pending pendingRows[loadSnapshot]
+}
+
+// newLoadProfile returns nil when no load profile table is configured.
+func newLoadProfile(table string) *loadProfile {
+	if table == "" {
+		return nil
+	}
+	return &loadProfile{pending: pendingRows[loadSnapshot]{limit: maxLoadProfilePending}}
+}
+
+// observe records a snapshot of the load in samples, if they hold any of
+// the load metrics.
+func (p *loadProfile) observe(samples []metrics.SampleContainer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snap := p.last
+	snap.iterations, snap.dropped = 0, 0
+	seen := false
+	for _, sc := range samples {
+		for _, s := range sc.GetSamples() {
+			if !applyLoadSample(&snap, s) {
+				continue
+			}
+			seen = true
+			if s.Time.After(snap.time) {
+				snap.time = s.Time
+			}
+			if s.Tags != nil {
+				if testID, ok := s.Tags.Get("testid"); ok {
+					snap.testID = testID
+				}
+			}
+		}
+	}
+	if !seen {
+		return
+	}
+	p.last = snap
+	p.pending.add(snap)
+}
+
+// applyLoadSample adds s to snap and reports whether s is a load metric.
+// Samples arrive in time order, so the last vus and vus_max values win;
+// iterations add up.
+func applyLoadSample(snap *loadSnapshot, s metrics.Sample) bool {
+	switch s.Metric.Name {
+	case metrics.VUsName:
+		snap.vus = uint32(max(s.Value, 0)) //nolint:gosec // G115: VU counts fit in uint32
+	case metrics.VUsMaxName:
+		snap.vusMax = uint32(max(s.Value, 0)) //nolint:gosec // G115: VU counts fit in uint32
+	case metrics.IterationsName:
+		snap.iterations += uint64(max(s.Value, 0))
+	case metrics.DroppedIterationsName:
+		snap.dropped += uint64(max(s.Value, 0))
+	default:
+		return false
+	}
+	return true
+}
+
+// createLoadProfileTable creates the load profile table.
+func createLoadProfileTable(ctx context.Context, db *sql.DB, database, table string) error {
+	if !isValidIdentifier(database) {
+		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", database)
+	}
+	if !isValidIdentifier(table) {
+		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
+	}
+
+	//nolint:gosec // G201: identifiers are validated with isValidIdentifier() and escaped with backticks
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s.%s (
+			timestamp          DateTime64(%d, 'UTC') CODEC(DoubleDelta, ZSTD(1)),
+			testid             LowCardinality(String),
+			instance           LowCardinality(String),
+			vus                UInt32,
+			vus_max            UInt32,
+			iterations         UInt64,
+			dropped_iterations UInt64
+		) ENGINE = MergeTree()
+		ORDER BY (testid, timestamp)
+	`, escapeIdentifier(database), escapeIdentifier(table), TimestampPrecision)
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create load profile table: %w", err)
+	}
+	return nil
+}
+
+// writeLoadProfile inserts snapshots into the load profile table in one batch.
+func writeLoadProfile(ctx context.Context, db *sql.DB, database, table, instance string, snaps []loadSnapshot) error {
+	if db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	batch, err := prepareInsert(ctx, db, nil, fmt.Sprintf(
+		"INSERT INTO %s.%s (timestamp, testid, instance, vus, vus_max, iterations, dropped_iterations) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?)",
+		escapeIdentifier(database), escapeIdentifier(table)))
+	if err != nil {
+		return err
+	}
+
+	for _, s := range snaps {
+		if err := batch.append(ctx, s.time, s.testID, instance, s.vus, s.vusMax, s.iterations, s.dropped); err != nil {
+			batch.abort()
+			return fmt.Errorf("failed to insert load profile row: %w", err)
+		}
+	}
+	if err := batch.send(); err != nil {
+		return fmt.Errorf("failed to send load profile rows: %w", err)
+	}
+	return nil
+}
+
+// flushLoadProfile writes the snapshots recorded since the last flush.
+// Failures are logged and the snapshots retried on the next flush; they
+// never fail the samples.
+func (o *Output) flushLoadProfile(ctx context.Context, profile *loadProfile) {
+	if profile == nil {
+		return
+	}
+	table := o.config.LoadProfileTable
+	flushPendingRows(o, &profile.pending, table, "load profile", func(snaps []loadSnapshot) error {
+		o.mu.RLock()
+		db := o.db
+		o.mu.RUnlock()
+		return writeLoadProfile(o.config.insertContext(ctx), db, o.config.Database, table, o.config.InstanceName, snaps)
+	})
+}
@@ -0,0 +1,84 @@
+package clickhouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// loadSamples returns the load metrics of one flush interval ending at end.
+func loadSamples(registry *metrics.Registry, end time.Time, vus float64, iterations int) metrics.Samples {
+	tags := registry.RootTagSet().With("testid", "nightly-7")
+	sample := func(name string, typ metrics.MetricType, at time.Time, v float64) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(name, typ), Tags: tags},
+			Time:       at,
+			Value:      v,
+		}
+	}
+	samples := metrics.Samples{
+		sample(metrics.VUsName, metrics.Gauge, end.Add(-time.Second), vus-1),
+		sample(metrics.VUsName, metrics.Gauge, end, vus),
+		sample(metrics.VUsMaxName, metrics.Gauge, end, 50),
+	}
+	for range iterations {
+		samples = append(samples, sample(metrics.IterationsName, metrics.Counter, end.Add(-time.Millisecond), 1))
+	}
+	return samples
+}
+
+func TestOutput_LoadProfileTable(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval":     "1h",
+		"loadProfileTable": "load_profile",
+		"instanceName":     "eu",
+	})
+
+	ddl := fake.DDL()
+	assert.Contains(t, ddl[len(ddl)-1], "CREATE TABLE IF NOT EXISTS `k6`.`load_profile`")
+
+	registry := metrics.NewRegistry()
+	end := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	o.AddMetricSamples([]metrics.SampleContainer{loadSamples(registry, end, 20, 3)})
+	o.flush()
+
+	// A flush without vus samples keeps the last gauges
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{{
+		TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(metrics.IterationsName, metrics.Counter), Tags: registry.RootTagSet()},
+		Time:       end.Add(500 * time.Millisecond),
+		Value:      1,
+	}}})
+	o.flush()
+
+	// Flushes without load metrics write no snapshot
+	addStatusSamples(o, 1, 0)
+	o.flush()
+
+	var rows [][]any
+	for _, row := range fake.Rows() {
+		if len(row) == 7 {
+			rows = append(rows, row)
+		}
+	}
+	require.Len(t, rows, 2)
+	assert.Equal(t, []any{end, "nightly-7", "eu", uint32(20), uint32(50), uint64(3), uint64(0)}, rows[0])
+	assert.Equal(t, []any{end.Add(500 * time.Millisecond), "nightly-7", "eu", uint32(20), uint32(50), uint64(1), uint64(0)}, rows[1])
+}
+
+func TestLoadProfile_RequeueCap(t *testing.T) {
+	t.Parallel()
+
+	p := newLoadProfile("load_profile")
+	p.observe([]metrics.SampleContainer{loadSamples(metrics.NewRegistry(), time.Now(), 1, 0)})
+	assert.Equal(t, 1, p.pending.requeue(make([]loadSnapshot, maxLoadProfilePending)))
+
+	pending := p.pending.take()
+	assert.Len(t, pending, maxLoadProfilePending)
+	assert.Equal(t, uint32(1), pending[len(pending)-1].vus, "oldest snapshots dropped first")
+	assert.Nil(t, newLoadProfile(""))
+}
@@ -0,0 +1,29 @@
+package clickhouse
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// openLogFile returns a logger appending to path (see Config.LogFile) at the
+// level of k6's logger, and the file to close at Stop().
+func openLogFile(k6Logger logrus.FieldLogger, path string) (*logrus.Logger, io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) // #nosec G304 - path is operator config
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open logFile: %w", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(f)
+	logger.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	switch l := k6Logger.(type) {
+	case *logrus.Logger:
+		logger.SetLevel(l.GetLevel())
+	case *logrus.Entry:
+		logger.SetLevel(l.Logger.GetLevel())
+	}
+	return logger, f, nil
+}
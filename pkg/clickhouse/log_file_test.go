@@ -0,0 +1,51 @@
+package clickhouse
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestOutput_LogFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "clickhouse.log")
+	k6Logger, hook := logtest.NewNullLogger()
+	k6Logger.SetLevel(logrus.DebugLevel)
+
+	_, out := newFakeOutput(t, output.Params{
+		Logger:     k6Logger,
+		JSONConfig: mustMarshalJSON(map[string]any{"pushInterval": "1h", "logFile": path}),
+	})
+	require.NoError(t, out.Start())
+	require.NoError(t, out.Stop())
+
+	require.Len(t, hook.AllEntries(), 1, "k6's console only learns where the logs go")
+	assert.Equal(t, path, hook.LastEntry().Data["logFile"])
+
+	logs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(logs), "level=debug msg=\"Parsed config\"", "k6's level applies")
+	assert.Contains(t, string(logs), "msg=\"ClickHouse output stopped\"")
+	assert.Contains(t, string(logs), "output=clickhouse")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestOutput_LogFileError(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(output.Params{
+		Logger:         newTestLogger(t),
+		ConfigArgument: "localhost:9000?logFile=" + filepath.Join(t.TempDir(), "missing", "clickhouse.log"),
+	})
+	require.ErrorContains(t, err, "failed to open logFile")
+}
@@ -0,0 +1,56 @@
+package clickhouse
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// parseMaterializedColumns parses a URL/env materializedColumns value such as
+// "status_class=intDiv(status, 100);url_host=domain(name)" into expressions
+// by column name. Entries are separated by ";" because expressions contain
+// commas.
+func parseMaterializedColumns(s string) (map[string]string, error) {
+	columns := make(map[string]string)
+	for item := range strings.SplitSeq(s, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, expr, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not name=expression", item)
+		}
+		columns[strings.TrimSpace(name)] = strings.TrimSpace(expr)
+	}
+	return columns, nil
+}
+
+// validateMaterializedColumns checks the MaterializedColumns entries. The
+// expressions themselves are left to the server.
+func (c Config) validateMaterializedColumns() error {
+	for _, name := range slices.Sorted(maps.Keys(c.MaterializedColumns)) {
+		expr := c.MaterializedColumns[name]
+		if !isValidIdentifier(name) {
+			return fmt.Errorf("invalid materializedColumns: column name %q "+
+				"(must be alphanumeric + underscore, max 63 chars)", name)
+		}
+		if strings.TrimSpace(expr) == "" {
+			return fmt.Errorf("invalid materializedColumns: %s has no expression", name)
+		}
+		if strings.ContainsAny(expr, ";\n") {
+			return fmt.Errorf("invalid materializedColumns: the expression of %s must be a single line without ;", name)
+		}
+	}
+	return nil
+}
+
+// materializedColumnsDDL returns the definitions of the materialized columns,
+// by name, to append to a schema's column definitions.
+func materializedColumnsDDL(columns map[string]string) string {
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(columns)) {
+		b.WriteString(",\n\t\t\t" + name + " MATERIALIZED " + strings.TrimSpace(columns[name]))
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestParseMaterializedColumns(t *testing.T) {
+	t.Parallel()
+
+	columns, err := parseMaterializedColumns("status_class=intDiv(status, 100); url_host = domain(name);")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"status_class": "intDiv(status, 100)", "url_host": "domain(name)"}, columns)
+
+	_, err = parseMaterializedColumns("status_class")
+	require.ErrorContains(t, err, `"status_class" is not name=expression`)
+
+	// ";" must be encoded in the config argument
+	cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?materializedColumns=a=1%3Bb=domain(name)"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "domain(name)"}, cfg.MaterializedColumns)
+}
+
+func TestParseConfig_MaterializedColumnsEnvironment(t *testing.T) {
+	t.Setenv("K6_CLICKHOUSE_MATERIALIZED_COLUMNS", "is_error=status >= 400;status_class=intDiv(status, 100)")
+
+	cfg, err := ParseConfig(output.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"is_error": "status >= 400", "status_class": "intDiv(status, 100)"},
+		cfg.MaterializedColumns)
+}
+
+func TestConfig_ValidateMaterializedColumns(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		columns map[string]string
+		wantErr string
+	}{
+		{columns: map[string]string{"status_class": "intDiv(status, 100)"}},
+		{columns: map[string]string{"status-class": "1"}, wantErr: `column name "status-class"`},
+		{columns: map[string]string{"status_class": " "}, wantErr: "status_class has no expression"},
+		{columns: map[string]string{"x": "1; DROP TABLE k6.samples"}, wantErr: "must be a single line without ;"},
+	}
+	for _, tt := range tests {
+		cfg := NewConfig()
+		cfg.MaterializedColumns = tt.columns
+		err := cfg.Validate()
+		if tt.wantErr == "" {
+			require.NoError(t, err)
+			continue
+		}
+		require.ErrorContains(t, err, tt.wantErr)
+	}
+}
+
+func TestSchemas_MaterializedColumns(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.MaterializedColumns = map[string]string{
+		"url_host":     "domain(name)",
+		"status_class": "intDiv(status, 100)",
+	}
+	for _, configure := range []func(Config) (SchemaImplementation, error){configureSimple, configureCompatible} {
+		impl, err := configure(cfg)
+		require.NoError(t, err)
+
+		fake, db := newFakeDB(t)
+		require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		assert.Regexp(t, `status_class MATERIALIZED intDiv\(status, 100\),\s+url_host MATERIALIZED domain\(name\)\s+\)`,
+			fake.DDL()[1], impl.Name)
+		assert.NotContains(t, impl.Schema.InsertQuery("k6", "samples"), "status_class", "the server computes the column")
+	}
+}
+
+func TestSimpleSchema_ValidateMaterializedColumns(t *testing.T) {
+	t.Parallel()
+
+	schema := SimpleSchema{materialized: map[string]string{"status": "tags['status']"}}
+	tb := simpleTable()
+	fake, db := newFakeDB(t)
+	fake.set(func(f *fakeDB) { f.tables = map[string]fakeTable{"samples": tb} })
+	require.EqualError(t, schema.Validate(context.Background(), db, "k6", "samples"),
+		"table k6.samples does not match the schema: column status is missing")
+
+	tb.columns = append(tb.columns, []driver.Value{"status", "String"})
+	fake.set(func(f *fakeDB) { f.tables = map[string]fakeTable{"samples": tb} })
+	require.NoError(t, schema.Validate(context.Background(), db, "k6", "samples"), "any type matches")
+}
+
+func TestOutput_MaterializedColumns(t *testing.T) {
+	t.Parallel()
+
+	fake, _ := startFakeOutput(t, map[string]any{
+		"materializedColumns": map[string]string{"status_class": "intDiv(toUInt16OrZero(tags['status']), 100)"},
+		"pushInterval":        "1h",
+	})
+
+	assert.Contains(t, fake.DDL()[1], "status_class MATERIALIZED intDiv(toUInt16OrZero(tags['status']), 100)")
+}
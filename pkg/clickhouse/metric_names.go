@@ -0,0 +1,97 @@
+package clickhouse
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// sanitizeMetricName returns name with every character outside [A-Za-z0-9_]
+// replaced by _ when sanitize is set, cut to maxLen bytes when maxLen is
+// positive. A cut never splits a multi-byte character.
+func sanitizeMetricName(name string, sanitize bool, maxLen int) string {
+	if sanitize {
+		name = strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+				return r
+			default:
+				return '_'
+			}
+		}, name)
+	}
+	if maxLen > 0 && len(name) > maxLen {
+		cut := maxLen
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut]
+	}
+	return name
+}
+
+// metricRenamer rewrites metric names (SanitizeMetricNames,
+// MetricNameMaxLength) at ingest. k6 shares one *metrics.Metric between all
+// samples of a metric, so renamed copies are made once per metric and never
+// modify k6's.
+type metricRenamer struct {
+	sanitize bool
+	maxLen   int
+
+	mu      sync.RWMutex
+	renamed map[*metrics.Metric]*metrics.Metric
+}
+
+// newMetricRenamer returns nil when metric names are written as is.
+func newMetricRenamer(sanitize bool, maxLen int) *metricRenamer {
+	if !sanitize && maxLen <= 0 {
+		return nil
+	}
+	return &metricRenamer{
+		sanitize: sanitize,
+		maxLen:   maxLen,
+		renamed:  make(map[*metrics.Metric]*metrics.Metric),
+	}
+}
+
+// apply returns sample with its metric renamed.
+func (r *metricRenamer) apply(sample metrics.Sample) metrics.Sample {
+	if sample.Metric == nil {
+		return sample
+	}
+	sample.Metric = r.rename(sample.Metric)
+	return sample
+}
+
+// rename returns the renamed copy of m, or m itself when its name is kept.
+func (r *metricRenamer) rename(m *metrics.Metric) *metrics.Metric {
+	r.mu.RLock()
+	renamed, ok := r.renamed[m]
+	r.mu.RUnlock()
+	if ok {
+		return renamed
+	}
+	renamed = m
+	if name := sanitizeMetricName(m.Name, r.sanitize, r.maxLen); name != m.Name {
+		renamed = &metrics.Metric{Name: name, Type: m.Type, Contains: m.Contains}
+	}
+	r.mu.Lock()
+	r.renamed[m] = renamed
+	r.mu.Unlock()
+	return renamed
+}
+
+// renameBuiltin adds the renamed copies of the builtin metrics to set, so
+// their samples are still recognized by identity after ingest.
+func (r *metricRenamer) renameBuiltin(set builtinMetricSet) {
+	if r == nil {
+		return
+	}
+	for _, m := range slices.Collect(maps.Keys(set)) {
+		set[r.rename(m)] = set[m]
+	}
+}
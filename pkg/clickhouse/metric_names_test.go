@@ -0,0 +1,96 @@
+package clickhouse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestSanitizeMetricName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		sanitize bool
+		maxLen   int
+		want     string
+	}{
+		{"http_req_duration", true, 0, "http_req_duration"},
+		{"checkout time (ms)", true, 0, "checkout_time__ms_"},
+		{"api/v2-latency", true, 0, "api_v2_latency"},
+		{"débit", true, 0, "d_bit"},
+		{"checkout_duration", false, 8, "checkout"},
+		{"débit", false, 2, "d"},
+		{"checkout time", true, 8, "checkout"},
+		{"short", true, 64, "short"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sanitizeMetricName(tt.name, tt.sanitize, tt.maxLen), tt.name)
+	}
+}
+
+func TestMetricRenamer(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newMetricRenamer(false, 0))
+
+	// k6's registry rejects such names, but other extensions may not use it
+	metric := &metrics.Metric{Name: "checkout time", Type: metrics.Trend}
+	plain := &metrics.Metric{Name: "http_reqs", Type: metrics.Counter}
+	r := newMetricRenamer(true, 0)
+
+	first := r.apply(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric}})
+	second := r.apply(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric}})
+	assert.Equal(t, "checkout_time", first.Metric.Name)
+	assert.Equal(t, metrics.Trend, first.Metric.Type)
+	assert.Same(t, first.Metric, second.Metric, "one copy per metric")
+	assert.Equal(t, "checkout time", metric.Name, "k6's metric is left untouched")
+
+	kept := r.apply(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: plain}})
+	assert.Same(t, plain, kept.Metric)
+
+	set := builtinMetricSet{metric: true}
+	r.renameBuiltin(set)
+	assert.True(t, set[first.Metric], "the renamed copy is builtin too")
+	(*metricRenamer)(nil).renameBuiltin(set)
+}
+
+func TestOutput_SanitizeMetricNames(t *testing.T) {
+	t.Parallel()
+
+	fake, o := newFakeOutput(t, output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"sanitizeMetricNames": true,
+		"metricNameMaxLength": 12,
+		"pushInterval":        "1h",
+	})})
+	registry := metrics.NewRegistry()
+	builtin := metrics.RegisterBuiltinMetrics(registry)
+	o.SetBuiltinMetrics(builtin)
+	require.NoError(t, o.Start())
+	defer func() { require.NoError(t, o.Stop()) }()
+
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+		{
+			TimeSeries: metrics.TimeSeries{
+				Metric: &metrics.Metric{Name: "checkout: add to cart", Type: metrics.Trend},
+				Tags:   registry.RootTagSet(),
+			},
+			Value: 1,
+		},
+		{TimeSeries: metrics.TimeSeries{Metric: builtin.HTTPReqDuration, Tags: registry.RootTagSet()}, Value: 2},
+	}})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 2)
+	assert.Equal(t, "checkout__ad", rows[0][1])
+	assert.Equal(t, "http_req_dur", rows[1][1])
+
+	// Renamed at ingest, so every reader of the name sees the new one
+	assert.True(t, o.builtinMetrics.isBuiltinSample(o.ingest([]metrics.SampleContainer{
+		metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: builtin.HTTPReqDuration}},
+	})[0].GetSamples()[0]), "a renamed builtin metric stays builtin")
+}
@@ -0,0 +1,79 @@
+package clickhouse
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// maxTrackedMetrics bounds the number of metric names counted separately, so
+// a script generating metric names cannot grow the counters without limit.
+const maxTrackedMetrics = 1000
+
+// otherMetrics counts the rows of metrics beyond maxTrackedMetrics.
+const otherMetrics = "(other)"
+
+// topMetricsLogged is the number of metrics listed in the stop log line.
+const topMetricsLogged = 10
+
+// metricStats counts the rows written per metric name. The zero value is
+// ready to use.
+type metricStats struct {
+	mu   sync.Mutex
+	rows map[string]uint64
+}
+
+// add records the rows of one sent batch.
+func (s *metricStats) add(rows map[string]uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rows == nil {
+		s.rows = make(map[string]uint64)
+	}
+	for name, n := range rows {
+		if _, ok := s.rows[name]; !ok && len(s.rows) >= maxTrackedMetrics {
+			name = otherMetrics
+		}
+		s.rows[name] += n
+	}
+}
+
+// snapshot returns a copy of the counters.
+func (s *metricStats) snapshot() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.rows)
+}
+
+// top formats the n metrics with the most rows as "name=rows", largest first.
+func (s *metricStats) top(n int) string {
+	rows := s.snapshot()
+	names := slices.SortedFunc(maps.Keys(rows), func(a, b string) int {
+		return cmp.Or(cmp.Compare(rows[b], rows[a]), strings.Compare(a, b))
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d", name, rows[name])
+	}
+	return strings.Join(parts, ",")
+}
+
+// GetMetricStats returns the number of rows written per metric name since
+// the output started, summed over all tables. Rows sent in an ambiguous
+// batch are included, as in SamplesProcessed. Beyond the first 1000 metric
+// names, rows are counted under "(other)". It is safe to call concurrently
+// with flushes; the returned map is a copy.
+func (o *Output) GetMetricStats() map[string]uint64 {
+	stats := o.metricStats.snapshot()
+	if stats == nil {
+		stats = make(map[string]uint64)
+	}
+	return stats
+}
@@ -0,0 +1,51 @@
+package clickhouse
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+func TestOutput_GetMetricStats(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{"pushInterval": "1h"})
+	assert.Empty(t, o.GetMetricStats())
+
+	registry := metrics.NewRegistry()
+	duration := registry.MustNewMetric("http_req_duration", metrics.Trend)
+	checks := registry.MustNewMetric("checks", metrics.Rate)
+	now := time.Now()
+	sample := func(m *metrics.Metric) metrics.Sample {
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: m, Tags: registry.RootTagSet()}, Time: now, Value: 1}
+	}
+	o.AddMetricSamples([]metrics.SampleContainer{
+		metrics.Samples{sample(duration), sample(duration), sample(checks)},
+	})
+	o.flush()
+	require.Len(t, fake.Rows(), 3)
+
+	assert.Equal(t, map[string]uint64{"http_req_duration": 2, "checks": 1}, o.GetMetricStats())
+	assert.Equal(t, "http_req_duration=2,checks=1", o.metricStats.top(topMetricsLogged))
+	require.NoError(t, o.Stop())
+}
+
+func TestMetricStats_Bounded(t *testing.T) {
+	t.Parallel()
+
+	var s metricStats
+	for i := range maxTrackedMetrics + 5 {
+		s.add(map[string]uint64{fmt.Sprintf("custom_%d", i): 1})
+	}
+	s.add(map[string]uint64{"custom_0": 1})
+
+	rows := s.snapshot()
+	assert.Len(t, rows, maxTrackedMetrics+1)
+	assert.Equal(t, uint64(5), rows[otherMetrics])
+	assert.Equal(t, uint64(2), rows["custom_0"], "tracked metrics keep counting")
+	assert.Equal(t, "(other)=5,custom_0=2", s.top(2))
+}
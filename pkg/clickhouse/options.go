@@ -0,0 +1,102 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"net"
+
+	"go.k6.io/k6/v2/output"
+)
+
+// DialContextFunc opens the transport connection to a ClickHouse address
+// (host:port as configured in Addr). It has the same shape as
+// net.Dialer.DialContext minus the network argument.
+type DialContextFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+// Option customizes an Output created with NewWithOptions. Options cover
+// programmatic hooks for embedders that cannot be expressed in the k6 config.
+type Option func(*Output)
+
+// WithDialContext installs a custom dial function, e.g. to connect through an
+// SSH tunnel, a unix socket, or a service-mesh sidecar.
+//
+// When TLS is enabled, the TLS handshake is still performed by the output on top
+// of the returned connection, so the hook only needs to provide the raw transport.
+// The keepAlive option is ignored when a custom dialer is installed.
+//
+// Example:
+//
+//	output.RegisterExtension("xk6-clickhouse", func(p output.Params) (output.Output, error) {
+//	    return clickhouse.NewWithOptions(p, clickhouse.WithDialContext(
+//	        func(ctx context.Context, _ string) (net.Conn, error) {
+//	            var d net.Dialer
+//	            return d.DialContext(ctx, "unix", "/var/run/clickhouse.sock")
+//	        },
+//	    ))
+//	})
+func WithDialContext(dial DialContextFunc) Option {
+	return func(o *Output) {
+		o.dialContext = dial
+	}
+}
+
+// WithDB makes the output use a pre-configured database handle instead of
+// opening its own connection from Addr/User/Password/TLS. The handle must use a
+// ClickHouse (or compatible test) driver; it is pinged at Start but never closed
+// by the output — the caller keeps ownership.
+func WithDB(db *sql.DB) Option {
+	return func(o *Output) {
+		o.externalDB = db
+	}
+}
+
+// WithSampleFilters adds filters applied before conversion, after those
+// listed in the sampleFilters config option; a sample is written only when
+// every filter keeps it. Use it for filters that need state from the
+// embedding application, or RegisterSampleFilter to make a filter
+// selectable from the config instead.
+func WithSampleFilters(filters ...SampleFilter) Option {
+	return func(o *Output) {
+		for _, f := range filters {
+			if f != nil {
+				o.sampleFilters = append(o.sampleFilters, f)
+			}
+		}
+	}
+}
+
+// WithTagTransformers adds tag transformers run before conversion, after
+// those listed in the tagTransformers config option. Use it for transformers
+// that need state from the embedding application, or RegisterTagTransformer
+// to make one selectable from the config instead.
+func WithTagTransformers(transformers ...TagTransformer) Option {
+	return func(o *Output) {
+		for _, t := range transformers {
+			if t != nil {
+				o.tagTransformers = append(o.tagTransformers, t)
+			}
+		}
+	}
+}
+
+// NewWithDB creates a new ClickHouse output that writes through db.
+// It is shorthand for NewWithOptions(params, WithDB(db)).
+func NewWithDB(params output.Params, db *sql.DB) (output.Output, error) {
+	return NewWithOptions(params, WithDB(db))
+}
+
+// NewWithOptions creates a new ClickHouse output like New, then applies opts.
+func NewWithOptions(params output.Params, opts ...Option) (output.Output, error) {
+	out, err := New(params)
+	if err != nil {
+		return nil, err
+	}
+
+	o := out.(*Output)
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o, nil
+}
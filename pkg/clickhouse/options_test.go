@@ -0,0 +1,155 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("applies WithDialContext", func(t *testing.T) {
+		t.Parallel()
+
+		dial := func(context.Context, string) (net.Conn, error) { return nil, errors.New("unused") }
+		out, err := NewWithOptions(output.Params{Logger: newTestLogger(t)}, WithDialContext(dial))
+		require.NoError(t, err)
+
+		o := out.(*Output)
+		assert.NotNil(t, o.dialContext)
+	})
+
+	t.Run("nil options are ignored", func(t *testing.T) {
+		t.Parallel()
+
+		out, err := NewWithOptions(output.Params{Logger: newTestLogger(t)}, nil)
+		require.NoError(t, err)
+		assert.Nil(t, out.(*Output).dialContext)
+	})
+
+	t.Run("config errors are returned", func(t *testing.T) {
+		t.Parallel()
+
+		out, err := NewWithOptions(output.Params{JSONConfig: []byte(`{invalid`)})
+		require.Error(t, err)
+		assert.Nil(t, out)
+	})
+}
+
+func TestBuildOptions_CustomDialerTakesPrecedence(t *testing.T) {
+	t.Parallel()
+
+	called := false
+	dial := func(context.Context, string) (net.Conn, error) {
+		called = true
+		return nil, errors.New("dial refused")
+	}
+
+	cfg := NewConfig()
+	cfg.KeepAlive = 10 * time.Second
+	opts := cfg.buildOptions(nil, dial)
+	require.NotNil(t, opts.DialContext)
+
+	_, err := opts.DialContext(context.Background(), "localhost:9000")
+	require.Error(t, err)
+	assert.True(t, called, "custom dialer must be used instead of the keep-alive dialer")
+}
+
+func TestWrapDialContext_TLSOverCustomTransport(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	defer func() { _ = server.Close() }()
+
+	// The server side records the SNI offered by the client and then aborts the
+	// handshake; that is enough to prove TLS is layered over the custom conn.
+	sni := make(chan string, 1)
+	go func() {
+		srv := tls.Server(server, &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				sni <- hello.ServerName
+				return nil, errors.New("no certificate")
+			},
+		})
+		_ = srv.Handshake()
+		_ = srv.Close()
+	}()
+
+	dial := wrapDialContext(
+		func(context.Context, string) (net.Conn, error) { return client, nil },
+		&tls.Config{MinVersion: tls.VersionTLS12},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := dial(ctx, "ch.internal:9440")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tls handshake over custom dialer")
+	assert.Equal(t, "ch.internal", <-sni, "SNI should be derived from the address host")
+}
+
+func TestWrapDialContext_PlaintextPassthrough(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	defer func() { _ = server.Close() }()
+
+	dial := wrapDialContext(func(context.Context, string) (net.Conn, error) { return client, nil }, nil)
+	conn, err := dial(context.Background(), "ignored:9000")
+	require.NoError(t, err)
+	assert.Same(t, client, conn)
+}
+
+func TestNewWithDB_UsesInjectedHandle(t *testing.T) {
+	t.Parallel()
+
+	fake, db := newFakeDB(t)
+
+	out, err := NewWithDB(output.Params{Logger: newTestLogger(t)}, db)
+	require.NoError(t, err)
+	o := out.(*Output)
+
+	require.NoError(t, o.Start())
+
+	ddl := fake.DDL()
+	require.Len(t, ddl, 2, "schema creation should run through the injected handle")
+	assert.Contains(t, ddl[0], "CREATE DATABASE IF NOT EXISTS `k6`")
+	assert.Contains(t, ddl[1], "CREATE TABLE IF NOT EXISTS `k6`.`samples`")
+
+	o.AddMetricSamples([]metrics.SampleContainer{makeSampleContainer(t)})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 1)
+	assert.Equal(t, "test_metric", rows[0][1])
+
+	require.NoError(t, o.Stop())
+	assert.NoError(t, db.PingContext(context.Background()), "Stop must not close a caller-owned handle")
+}
+
+func TestNewWithDB_PingFailure(t *testing.T) {
+	t.Parallel()
+
+	fake, db := newFakeDB(t)
+	fake.set(func(f *fakeDB) { f.pingErr = errors.New("unreachable") })
+
+	out, err := NewWithDB(output.Params{Logger: newTestLogger(t)}, db)
+	require.NoError(t, err)
+
+	err = out.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to clickhouse")
+	require.NoError(t, out.Stop())
+}
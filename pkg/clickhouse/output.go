@@ -6,19 +6,26 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/avast/retry-go/v4"
 	"github.com/sirupsen/logrus"
 	"go.k6.io/k6/v2/metrics"
 	"go.k6.io/k6/v2/output"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// finalDrainTimeout bounds the failover buffer drain of a regular Stop().
+const finalDrainTimeout = 30 * time.Second
+
 // Memory pools for reducing allocations during high-throughput operations
 var (
 	// tagMapPool reuses map[string]string for tag storage
@@ -46,9 +53,10 @@ var (
 	}
 )
 
-// commitError wraps errors that occur during batch.Commit().
-// Commit errors are ambiguous: the server may have persisted the data before the
-// response was lost. To avoid duplication, these errors are NOT retried.
+// commitError wraps errors that occur while sending a batch without a server
+// response (see sendError). They are ambiguous: the server may have persisted
+// the data before the response was lost. To avoid duplication, these errors
+// are NOT retried.
 type commitError struct{ err error }
 
 func (e *commitError) Error() string { return "commit error: " + e.err.Error() }
@@ -70,13 +78,102 @@ type Output struct {
 	output.SampleBuffer
 	config          Config
 	logger          logrus.FieldLogger
+	logFile         io.Closer // Config.LogFile, closed last by Stop(); nil when unused
 	db              *sql.DB
-	periodicFlusher *output.PeriodicFlusher
-	insertQuery     string // Pre-computed INSERT query
+	periodicFlusher flusher
+
+	// Embedder hooks (see options.go)
+	dialContext   DialContextFunc
+	externalDB    *sql.DB        // Caller-owned handle; never closed by Stop()
+	sampleFilters []SampleFilter // Applied after Config.SampleFilters
+
+	tagTransformers []TagTransformer // Applied after Config.TagTransformers
+
+	// Destination tables (one per schemaMode entry), resolved in Start()
+	targets []*schemaTarget
+
+	// shards are the handles of Config.ShardAddrs, opened in Start()
+	shards []*sql.DB
+
+	// tableRoller replaces targets as TableTemplate changes (nil when unused)
+	tableRoller *tableRoller
+
+	// tagHasher replaces hashTags values before conversion (nil when unused)
+	tagHasher *tagHasher
+
+	// transformers rewrite the tags of every sample once per flush cycle (see
+	// ingest): Config.TagTransformers, then tagTransformers
+	transformers []TagTransformer
+
+	// limiter enforces MaxTagsPerSample at ingest, after the transformers (nil
+	// when unused)
+	limiter *tagLimiter
+
+	// renamer rewrites metric names at ingest, ahead of the tags (nil when
+	// unused)
+	renamer *metricRenamer
+
+	// deadLetter receives samples rejected for data reasons (nil when unused)
+	deadLetter *deadLetterSink
+
+	// audit collects a row per sent batch for AuditTable (nil when unused)
+	audit *auditLog
+
+	// loadProfile collects a row per flush for LoadProfileTable (nil when unused)
+	loadProfile *loadProfile
+
+	// builtinMetrics recognizes k6's builtin metrics by identity (nil until
+	// SetBuiltinMetrics)
+	builtinMetrics builtinMetricSet
+
+	// thresholds holds the rows for ThresholdsTable until written (nil when unused)
+	thresholds *thresholdLog
+
+	// events collects the run's lifecycle events for EventsTable (nil when unused)
+	events *eventLog
+
+	// summary tracks the written metrics for SummaryFile (nil when unused)
+	summary *runSummary
+
+	// counters folds Counter samples per flush for CounterModeDelta (nil when unused)
+	counters *counterAggregator
+
+	// fallback keeps samples that would otherwise be lost (nil when unused)
+	fallback *fallbackSink
+
+	// s3Export uploads export files when ExportDir is an S3 URL (nil otherwise)
+	s3Export *s3Exporter
+
+	// webhook reports persistent failures to WebhookURL (nil when unused)
+	webhook *webhookNotifier
 
-	// Schema implementation (selected by schemaMode config)
-	schema    SchemaCreator
-	converter SampleConverter
+	// testID is the run's testid tag, used to read the run's rows back
+	testID string
+
+	// OpenTelemetry spans (see tracing.go)
+	tracer         trace.Tracer
+	customTracer   bool                     // tracer comes from WithTracerProvider
+	tracerProvider *sdktrace.TracerProvider // owned, for TracesEndpoint; nil otherwise
+
+	// Conversion error guard (see convert_guard.go)
+	testRunStop func(error) // k6 callback aborting the test run
+	abortOnce   sync.Once   // Abort the test run at most once
+	halted      atomic.Bool // Set by convertErrorAction=stopOutput
+
+	// lastFlushFailed is the outcome of the last completed flush cycle (see IsHealthy)
+	lastFlushFailed atomic.Bool
+
+	// lastFlushError is the most recent failed flush cycle (see GetLastFlushError)
+	lastFlushError   *FlushError
+	lastFlushErrorMu sync.Mutex
+
+	// interrupted is set when k6 stops an aborted or interrupted run; the
+	// final flush and drain then make a single attempt within AbortFlushTimeout.
+	interrupted atomic.Bool
+
+	// stopping is set once Stop() begins; the batches flushed from then on
+	// retry with ShutdownFlushRetries and ShutdownRetryBackoff.
+	stopping atomic.Bool
 
 	// Concurrency control
 	mu      sync.RWMutex
@@ -84,22 +181,61 @@ type Output struct {
 	flushWG sync.WaitGroup // Track in-flight flushes
 	flushMu sync.Mutex     // Prevents overlapping flush cycles during outages
 
+	activeFlushes atomic.Int64   // Flushes in flight with FlushOverlapPolicy "concurrent"
+	asyncFlushes  sync.WaitGroup // Background flushes started by tick
+
+	// Server setup deferred by skipPing (see setup.go)
+	serverReady atomic.Bool // Schema created and grants checked
+	setupMu     sync.Mutex  // Serializes deferred setup attempts
+
+	// Handles that lost their connection (see reconnect.go)
+	brokenShards map[int]bool // Shards whose handle is replaced before the next insert
+	reconnectMu  sync.Mutex   // Guards brokenShards and serializes reconnects
+
+	// Flush cycles in flight and the handles they may still hold (see
+	// reconnect.go), guarded by flightMu
+	flightMu   sync.Mutex
+	flightSeq  uint64              // Sequence number of the last flush cycle begun
+	inFlight   map[uint64]struct{} // Flush cycles begun and not yet ended
+	retiredDBs []retiredDB         // Replaced handles not yet closed
+
 	// Context cancellation for graceful shutdown
 	shutdownCtx    context.Context
 	shutdownCancel context.CancelFunc
 
-	// Resilience: in-memory buffer for samples during connection failures
-	failoverBuffer *SampleBuffer
-
 	// Error metrics (atomic for lock-free concurrent access)
 	convertErrors    atomic.Uint64 // Cumulative count of sample conversion failures
 	insertErrors     atomic.Uint64 // Cumulative count of database insert failures
-	samplesProcessed atomic.Uint64 // Cumulative count of successfully inserted samples
+	samplesProcessed atomic.Uint64 // Cumulative count of successfully inserted rows, across tables
 
 	// Resilience metrics (atomic for lock-free concurrent access)
 	retryAttempts  atomic.Uint64 // Total retry attempts across all flushes
+	retriedBatches atomic.Uint64 // Batches sent more than once
 	flushFailures  atomic.Uint64 // Flushes that failed after all retries
-	droppedSamples atomic.Uint64 // Samples dropped due to buffer overflow
+	droppedSamples atomic.Uint64 // Samples lost (see ErrorMetrics.DroppedSamples)
+	spilledSamples atomic.Uint64 // Samples written to a spill file at shutdown
+	lastErrorTime  atomic.Int64  // Unix nanoseconds of the last failed insert attempt
+	reconnects     atomic.Uint64 // Handles re-established after a closed connection
+
+	payloadBytes atomic.Uint64 // Estimated native-format bytes of committed batches
+	wireBytes    atomic.Uint64 // Bytes of committed batches the server reported receiving
+
+	deadLetterSamples atomic.Uint64 // Samples written to the dead-letter sink
+	fallbackSamples   atomic.Uint64 // Samples written to the fallback sink
+	exportedSamples   atomic.Uint64 // Rows written to export files
+	batchSplits       atomic.Uint64 // Batches halved after a too-large rejection
+	skippedFlushes    atomic.Uint64 // Ticks skipped while a flush was running
+
+	tagOverflowSamples atomic.Uint64 // Samples whose tags exceeded MaxTagsPerSample
+
+	// metricStats counts the rows written per metric (see GetMetricStats)
+	metricStats metricStats
+
+	// sampleLag tracks sample age and send duration of committed batches
+	sampleLag sampleLag
+
+	// rowVersion is the last row_version handed out (see nextRowVersion)
+	rowVersion atomic.Uint64
 }
 
 // ErrorMetrics contains cumulative error statistics from flush operations.
@@ -113,7 +249,10 @@ type ErrorMetrics struct {
 	// These occur when ExecContext fails for individual samples.
 	InsertErrors uint64
 
-	// SamplesProcessed is the total number of samples successfully inserted.
+	// SamplesProcessed is the total number of rows successfully inserted,
+	// across all tables: with several schemaModes, a sample written to each
+	// table counts once per table, and with counterMode=delta an aggregated
+	// Counter row counts once.
 	SamplesProcessed uint64
 
 	// RetryAttempts is the total number of retry attempts across all flushes.
@@ -128,9 +267,94 @@ type ErrorMetrics struct {
 	// Only populated when BufferEnabled is true.
 	BufferedSamples uint64
 
-	// DroppedSamples is the total number of samples dropped due to buffer overflow.
-	// Only relevant when BufferEnabled is true.
+	// DroppedSamples is the total number of samples lost: dropped on failover
+	// buffer overflow, undelivered with BufferEnabled off, undrained at
+	// shutdown, or discarded after convertErrorAction=stopOutput halted the
+	// output. Samples kept in a spill, dead-letter, export, or fallback file
+	// are not counted.
 	DroppedSamples uint64
+
+	// RetriedBatches is the number of batches that failed and were sent
+	// again, however many retries they took.
+	RetriedBatches uint64
+
+	// LastErrorTime is when an insert attempt last failed, retried or not;
+	// zero if none has.
+	LastErrorTime time.Time
+
+	// Reconnects is the number of times a connection reported closed by the
+	// driver was re-established before the next insert.
+	Reconnects uint64
+
+	// PayloadBytes is the estimated size of the committed batches in
+	// ClickHouse's native format, before compression.
+	PayloadBytes uint64
+
+	// WireBytes is the size of the committed batches as the server received
+	// them over the network, compressed if the driver compressed them, from
+	// the profile events it reports per INSERT. Zero if the server reports
+	// none.
+	WireBytes uint64
+
+	// SpilledSamples is the total number of samples written to a spill file
+	// in SpillDir because they could not be delivered at shutdown.
+	SpilledSamples uint64
+
+	// DeadLetterSamples is the total number of samples rejected for data
+	// reasons (conversion errors, values the server refuses) and written to
+	// the dead-letter sink in DeadLetterDir.
+	DeadLetterSamples uint64
+
+	// FallbackSamples is the total number of samples written to the
+	// FallbackSink instead of being lost.
+	FallbackSamples uint64
+
+	// ExportedSamples is the total number of rows written to export files in
+	// ExportDir for a later bulk load.
+	ExportedSamples uint64
+
+	// EvictedSamples is the total number of buffered samples discarded for
+	// exceeding BufferMaxAge during an outage.
+	EvictedSamples uint64
+
+	// SkippedFlushes is the number of PushInterval ticks skipped because
+	// earlier flushes were still running (FlushOverlapPolicy skip or
+	// concurrent).
+	SkippedFlushes uint64
+
+	// BatchSplits is the number of batches the server rejected as too large
+	// and that were split in halves and resent.
+	BatchSplits uint64
+
+	// TagOverflowSamples is the number of converted samples whose tags
+	// exceeded MaxTagsPerSample and were collapsed into an _overflow tag. A
+	// sample written to several tables counts once per table.
+	TagOverflowSamples uint64
+
+	// BufferHighWatermark is the highest number of samples held in a failover
+	// buffer at once (the fullest buffer when several tables are written).
+	// Compare with BufferMaxSamples to see how close an outage came to
+	// dropping data.
+	BufferHighWatermark uint64
+
+	// BufferFillPercent is the current occupancy of the fullest failover
+	// buffer as a percentage of BufferMaxSamples (0-100).
+	BufferFillPercent float64
+
+	// SampleLag is how old the oldest sample of the last committed batch was
+	// when the batch was sent: time spent buffered in k6 and the output,
+	// including pushInterval, retries, and the failover buffer.
+	SampleLag time.Duration
+
+	// MaxSampleLag is the largest SampleLag of any committed batch.
+	MaxSampleLag time.Duration
+
+	// SendDuration is how long ClickHouse took to ingest the last committed
+	// batch. Compare it with SampleLag to tell buffering from ingest delays.
+	SendDuration time.Duration
+
+	// MaxSendDuration is the largest SendDuration of any committed batch.
+	MaxSendDuration time.Duration
 }
 
 // Compile-time assertion that *Output satisfies k6's output.Output interface.
@@ -150,19 +374,54 @@ func New(params output.Params) (output.Output, error) {
 		logger = logrus.New()
 	}
 
+	var logFile io.Closer
+	if cfg.LogFile != "" {
+		fileLogger, f, err := openLogFile(logger, cfg.LogFile)
+		if err != nil {
+			return nil, err
+		}
+		logger.WithFields(logrus.Fields{"output": "clickhouse", "logFile": cfg.LogFile}).
+			Info("Writing ClickHouse output logs to logFile")
+		logger, logFile = fileLogger, f
+	}
+
+	logger = logger.WithField("output", "clickhouse")
+	if cfg.InstanceName != "" {
+		// Tell apart the log lines of several outputs or load generators
+		logger = logger.WithField("instance", cfg.InstanceName)
+	}
+
+	// Config.String masks the password and URL tokens
+	logger.WithField("config", cfg).Debug("Parsed config")
+
+	if cfg.ignoredKeys != nil {
+		logger.WithError(cfg.ignoredKeys).Warn("Config has unknown or misspelled keys (strictConfig=false)")
+	}
+
+	// The configuration is valid, so the schemas of its files can be used
+	registerSchemaDefinitions(cfg.schemaDefinitions)
+
+	testID, _ := runTestID(params.ScriptOptions.RunTags)
+
 	return &Output{
-		config: cfg,
-		logger: logger.WithField("output", "clickhouse"),
+		config:  cfg,
+		logger:  logger,
+		logFile: logFile,
+		testID:  testID,
+		tracer:  defaultTracer(),
 	}, nil
 }
 
 // Description returns a human-readable description
 func (o *Output) Description() string {
+	if o.config.InstanceName != "" {
+		return fmt.Sprintf("clickhouse (%s, instance=%s)", o.config.Addr, o.config.InstanceName)
+	}
 	return fmt.Sprintf("clickhouse (%s)", o.config.Addr)
 }
 
 // Start initializes the connection and starts the flusher
-func (o *Output) Start() error {
+func (o *Output) Start() (err error) {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
@@ -175,76 +434,137 @@ func (o *Output) Start() error {
 
 	o.logger.Debug("Starting ClickHouse output")
 
-	// Build TLS configuration
-	tlsConfig, err := o.config.TLS.BuildTLSConfig()
+	if err := o.startTracing(o.shutdownCtx); err != nil {
+		return err
+	}
+	ctx, span := o.tracer.Start(o.shutdownCtx, spanStart, trace.WithAttributes(o.config.serverAttributes()...))
+	defer func() {
+		endSpan(span, err)
+		if err != nil {
+			o.stopTracing()
+		}
+	}()
+
+	if isS3URL(o.config.ExportDir) {
+		if o.s3Export, err = newS3Exporter(ctx, o.config.ExportDir); err != nil {
+			return fmt.Errorf("invalid exportDir: %w", err)
+		}
+	}
+
+	db, err := o.openDB()
 	if err != nil {
-		return fmt.Errorf("failed to build TLS config: %w", err)
+		return err
 	}
 
-	o.logTLSStatus()
+	o.db = db
 
-	// Connect to ClickHouse without specifying database in auth.
-	// This allows CREATE DATABASE IF NOT EXISTS to work when the target database doesn't exist.
-	// All queries use fully-qualified table names ({database}.{table}), so no default database is needed.
-	db := clickhouse.OpenDB(&clickhouse.Options{
-		Addr: []string{o.config.Addr},
-		Auth: clickhouse.Auth{
-			Username: o.config.User,
-			Password: o.config.Password,
-		},
-		TLS: tlsConfig,
-	})
+	// Metrics are renamed at ingest; renamed builtin metrics stay builtin
+	o.renamer = newMetricRenamer(o.config.SanitizeMetricNames, o.config.MetricNameMaxLength)
+	o.renamer.renameBuiltin(o.builtinMetrics)
 
-	// Test connection
-	if err := db.PingContext(o.shutdownCtx); err != nil {
-		return fmt.Errorf("failed to connect to clickhouse at %s: %w "+
-			"(verify the address and the native port — 9000 by default, not the 8123 HTTP port — and the credentials)",
-			o.config.Addr, err)
+	// Resolve schema implementations and sample filters from the registry
+	// (one target per schemaMode entry)
+	filters, err := o.config.resolveSampleFilters(o.builtinMetrics)
+	if err != nil {
+		return err
+	}
+	targets, err := o.config.newTargets(append(filters, o.sampleFilters...), o.builtinMetrics)
+	if err != nil {
+		return err
+	}
+	if o.shards, err = o.openShards(); err != nil {
+		return err
+	}
+	for _, t := range targets {
+		if t.shard > 0 {
+			t.db = o.shards[t.shard-1]
+		}
 	}
 
-	o.db = db
-	o.logger.Debug("Connected to ClickHouse")
+	// Hash high-cardinality tags ahead of every schema's converter
+	hasher := newTagHasher(o.config.HashTags, o.config.HashTagsLookupTable != "")
+	if hasher != nil {
+		for _, t := range targets {
+			t.converter = hashingConverter{SampleConverter: t.converter, hasher: hasher}
+		}
+		o.logger.WithField("hashTags", o.config.HashTags).Debug("Tag hashing enabled")
+	}
+	o.tagHasher = hasher
 
-	// Get schema implementation from registry
-	impl, err := GetSchema(o.config.SchemaMode)
+	// Tags are rewritten, then limited, at ingest: ahead of hashing, so that
+	// renamed or derived tags can be hashed too
+	transformers, err := o.config.resolveTagTransformers()
 	if err != nil {
-		return fmt.Errorf("failed to get schema implementation: %w", err)
+		return err
+	}
+	o.transformers = append(transformers, o.tagTransformers...)
+	o.limiter = newTagLimiter(o.config.MaxTagsPerSample, &o.tagOverflowSamples)
+
+	o.deadLetter = newDeadLetterSink(o.config.DeadLetterDir, o.config.Database)
+	o.audit = newAuditLog(o.config.AuditTable)
+	o.loadProfile = newLoadProfile(o.config.LoadProfileTable)
+	o.events = newEventLog(o.config.EventsTable)
+	if o.events != nil {
+		o.events.record(runEvent{time: time.Now(), event: eventRunStarted})
+	}
+	o.summary = newRunSummary(o.config.SummaryFile, targets)
+	o.counters = newCounterAggregator(o.config.CounterMode)
+	o.webhook = o.config.newWebhookNotifier(o.logger)
+	o.fallback = newFallbackSink(o.config.FallbackSink)
+
+	for _, t := range targets {
+		if o.fallback != nil && t.failoverBuffer != nil {
+			t.failoverBuffer.SetDropHandler(o.fallbackDropHandler(t))
+		}
+		t.wal = newWALLog(o.config.WALDir, o.config.Database, t.table)
+		if n, err := t.wal.recover(); err != nil {
+			o.logger.WithError(err).WithField("table", t.table).Warn("Skipping WAL replay")
+		} else if n > 0 {
+			o.logger.WithFields(logrus.Fields{"table": t.table, "walSegments": n}).Info("Found WAL segments of an earlier run, replaying them")
+		}
+		o.logger.WithFields(logrus.Fields{"schemaMode": t.mode, "table": t.table}).Debug("Using schema implementation")
 	}
-	o.schema = impl.Schema
-	o.converter = impl.Converter
-	o.logger.WithField("schemaMode", o.config.SchemaMode).Debug("Using schema implementation")
+	o.targets = targets
+	o.tableRoller = newTableRoller(o.config.TableTemplate, o.config.Table)
 
-	// Create schema if not skipped
-	if !o.config.SkipSchemaCreation {
-		if err := o.schema.CreateSchema(o.shutdownCtx, db, o.config.Database, o.config.Table); err != nil {
+	// Connect, create the schema, and check grants. With skipPing an
+	// unreachable server is retried on every flush instead.
+	if err := o.prepareServer(ctx, db, targets, hasher); err != nil {
+		if !o.config.SkipPing || isServerError(err) {
 			return err
 		}
-		o.logger.Debug("Schema created")
+		o.logger.WithError(err).Warn("ClickHouse is unreachable, starting anyway (skipPing); " +
+			"setup is retried on every flush and samples are buffered until it succeeds")
 	} else {
-		o.logger.Debug("Schema creation skipped")
+		o.serverReady.Store(true)
+		o.flushThresholds(ctx, db, o.thresholds)
+		o.flushEvents(ctx, db, o.events)
 	}
 
-	// Pre-compute INSERT query from schema implementation
-	o.insertQuery = o.schema.InsertQuery(o.config.Database, o.config.Table)
+	// Queue samples a previous run could not deliver
+	if o.config.SpillDir != "" {
+		o.loadSpill(targets)
+	}
 
-	// Initialize failover buffer if enabled
 	if o.config.BufferEnabled {
-		o.failoverBuffer = NewSampleBuffer(
-			o.config.BufferMaxSamples,
-			DropPolicy(o.config.BufferDropPolicy),
-		)
 		o.logger.WithFields(logrus.Fields{
 			"capacity":   o.config.BufferMaxSamples,
 			"dropPolicy": o.config.BufferDropPolicy,
+			"targets":    len(targets),
 		}).Debug("Failover buffer initialized")
 	}
 
 	// Start periodic flusher
-	pf, err := output.NewPeriodicFlusher(o.config.PushInterval, o.flush)
+	pf, err := o.newFlusher()
 	if err != nil {
 		return err
 	}
 	o.periodicFlusher = pf
+	if o.config.PushInterval < time.Second && !o.config.AsyncInsert {
+		o.logger.WithField("interval", o.config.PushInterval).Warn("pushInterval is below 1s: every flush " +
+			"inserts a new part, which ClickHouse merges in the background; set asyncInsert=true to let the " +
+			"server batch them, or insert into a Buffer table")
+	}
 
 	o.logger.WithFields(logrus.Fields{
 		"interval":      o.config.PushInterval,
@@ -255,6 +575,34 @@ func (o *Output) Start() error {
 	return nil
 }
 
+// openDB returns the database handle for this output: the externally supplied
+// handle when one was injected with WithDB, otherwise a new connection built
+// from the config.
+func (o *Output) openDB() (*sql.DB, error) {
+	if o.externalDB != nil {
+		o.logger.Debug("Using externally supplied database handle")
+		if o.config.Role != "" {
+			o.logger.Warn("role is ignored for an externally supplied database handle; activate it on the handle's connections")
+		}
+		return o.externalDB, nil
+	}
+
+	// Build TLS configuration
+	tlsConfig, err := o.config.TLS.BuildTLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build TLS config: %w", err)
+	}
+
+	o.logTLSStatus()
+
+	if o.dialContext != nil && o.config.KeepAlive != 0 {
+		o.logger.Warn("keepAlive is ignored because a custom dialer is installed")
+	}
+
+	// Connect to ClickHouse without specifying database in auth (see buildOptions).
+	return o.config.openDB(tlsConfig, o.dialContext), nil
+}
+
 // logTLSStatus logs warnings about the TLS configuration: using the plaintext
 // port with TLS, verification being disabled, and TLS material that will be
 // silently ignored. Extracted from Start() to keep its complexity in check.
@@ -289,6 +637,46 @@ func (o *Output) logTLSStatus() {
 
 // Stop flushes remaining metrics and closes the connection
 func (o *Output) Stop() error {
+	return o.stop(time.Now().Add(finalDrainTimeout))
+}
+
+// Compile-time assertion that the output learns how the test run ended.
+var _ output.WithStopWithTestError = (*Output)(nil)
+
+// StopWithTestError is called by k6 instead of Stop. A non-nil testRunErr
+// means the run was interrupted (SIGINT/SIGTERM, test.abort(), a threshold
+// abort); the remaining samples are then flushed immediately with a single
+// attempt, and the whole shutdown is bounded by AbortFlushTimeout so a dead
+// ClickHouse cannot hold up k6's exit.
+func (o *Output) StopWithTestError(testRunErr error) error {
+	if testRunErr == nil {
+		return o.Stop()
+	}
+
+	o.interrupted.Store(true)
+	timeout := o.config.AbortFlushTimeout
+	o.logger.WithError(testRunErr).WithField("timeout", timeout).Warn("Test run interrupted, flushing remaining samples")
+
+	// Hard cap: cancelling the shutdown context aborts any insert or retry
+	// backoff still running when the budget runs out.
+	o.mu.RLock()
+	cancel := o.shutdownCancel
+	events := o.events
+	o.mu.RUnlock()
+	if cancel != nil {
+		timer := time.AfterFunc(timeout, cancel)
+		defer timer.Stop()
+	}
+	if events != nil {
+		events.fail(testRunErr)
+	}
+
+	return o.stop(time.Now().Add(timeout))
+}
+
+// stop shuts the output down; the final failover drain must finish by
+// drainDeadline.
+func (o *Output) stop(drainDeadline time.Time) error {
 	// Check if already stopped (read-only check to avoid blocking)
 	o.mu.RLock()
 	alreadyClosed := o.closed
@@ -300,6 +688,7 @@ func (o *Output) Stop() error {
 	}
 
 	o.logger.Debug("Stopping")
+	o.stopping.Store(true)
 
 	// Stop the periodic flusher FIRST — this triggers one final flush callback.
 	// Since o.closed is still false, the final flush() executes normally.
@@ -307,6 +696,14 @@ func (o *Output) Stop() error {
 		pf.Stop()
 	}
 
+	// Background flushes (flushOverlapPolicy skip/concurrent) may still be
+	// running, and the final tick may have been skipped: wait for them, then
+	// flush whatever k6 buffered since.
+	if o.config.FlushOverlapPolicy != FlushOverlapQueue {
+		o.asyncFlushes.Wait()
+		o.flush()
+	}
+
 	// Now mark as closed to prevent any new flushes from starting.
 	o.mu.Lock()
 	if o.closed {
@@ -320,48 +717,33 @@ func (o *Output) Stop() error {
 	// Wait for all in-flight flushes to complete (including the final one)
 	o.logger.Debug("Waiting for in-flight flushes to complete")
 	o.flushWG.Wait()
+	if o.events != nil {
+		o.events.finish(time.Now())
+	}
 	o.logger.Debug("All flushes completed")
 
-	// Final attempt to drain failover buffer before shutdown
-	if o.failoverBuffer != nil && o.failoverBuffer.Len() > 0 {
-		bufferedCount := o.failoverBuffer.Len()
-		o.logger.WithField("bufferedSamples", bufferedCount).Info("Draining failover buffer on shutdown")
-
-		// Use a fresh context for final drain (don't use cancelled shutdown context)
-		drainCtx, drainCancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer drainCancel()
-
-		samples := o.failoverBuffer.PopAll()
-		if len(samples) > 0 {
-			// Retry the final drain with the same backoff policy as a normal flush.
-			// The outage that filled the buffer may still be flapping, so a single
-			// unretried attempt would needlessly lose data inside the 30s window.
-			// config is immutable after New(); no flushes are in flight here (we
-			// already waited on flushWG), so reading it without the lock is safe.
-			err := retry.Do(
-				func() error { return o.doFlush(drainCtx, samples) },
-				retry.Attempts(o.config.RetryAttempts+1),
-				retry.Delay(o.config.RetryDelay),
-				retry.MaxDelay(o.config.RetryMaxDelay),
-				retry.DelayType(retry.BackOffDelay),
-				retry.Context(drainCtx),
-				retry.RetryIf(isRetryableError),
-			)
-			switch {
-			case err == nil:
-				o.logger.WithField("flushedSamples", len(samples)).Info("Successfully drained failover buffer")
-			case isCommitError(err):
-				// Commit errors are ambiguous — the server may already hold the data.
-				// Don't count them as dropped (mirrors flush()).
-				o.logger.WithError(err).WithField("samples", len(samples)).Warn("Commit error during shutdown drain (data may already be persisted)")
-			default:
-				// Unrecoverable at shutdown; count the loss so the final metrics
-				// summary is accurate instead of silently under-reporting drops.
-				o.droppedSamples.Add(uint64(len(samples)))
-				o.logger.WithError(err).WithField("lostSamples", len(samples)).Warn("Failed to drain buffer on shutdown, data lost")
-			}
+	// Final attempt to drain failover buffers before shutdown.
+	// Use a fresh context for final drain (don't use cancelled shutdown context);
+	// the budget is shared by all targets.
+	drainCtx, drainCancel := context.WithDeadline(context.Background(), drainDeadline)
+	defer drainCancel()
+	if o.config.SkipPing {
+		if err := o.ensureServer(drainCtx, o.db, o.targets, o.tagHasher); err != nil {
+			o.logger.WithError(err).Warn("ClickHouse is still not ready at shutdown")
 		}
 	}
+	for _, t := range o.targets {
+		o.drainTarget(drainCtx, t)
+	}
+	o.flushAudit(drainCtx, o.audit)
+	o.flushLoadProfile(drainCtx, o.loadProfile)
+	o.flushThresholds(drainCtx, o.db, o.thresholds)
+	o.flushEvents(drainCtx, o.db, o.events)
+	o.writeSummary(drainCtx, o.summary)
+	if o.webhook != nil {
+		o.webhook.checkDropped(o.droppedSamples.Load())
+		o.webhook.wait()
+	}
 
 	// Cancel shutdown context after final drain
 	if o.shutdownCancel != nil {
@@ -372,42 +754,368 @@ func (o *Output) Stop() error {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
-	if o.db != nil {
+	for _, t := range o.targets {
+		t.conns.close()
+	}
+	for _, db := range o.shards {
+		_ = db.Close()
+	}
+	o.flightMu.Lock()
+	for _, r := range o.retiredDBs {
+		_ = r.db.Close()
+	}
+	o.retiredDBs = nil
+	o.flightMu.Unlock()
+
+	// An injected handle belongs to the embedder; only close what we opened.
+	if o.db != nil && o.externalDB == nil {
 		_ = o.db.Close()
 	}
+	if o.deadLetter != nil {
+		if err := o.deadLetter.close(); err != nil {
+			o.logger.WithError(err).Warn("Failed to close dead-letter files")
+		}
+	}
+	if o.fallback != nil {
+		if err := o.fallback.close(); err != nil {
+			o.logger.WithError(err).Warn("Failed to close fallback sink")
+		}
+	}
 
 	// Log final metrics
 	errStats := o.GetErrorMetrics()
-	o.logger.WithFields(logrus.Fields{
-		"samplesProcessed": errStats.SamplesProcessed,
-		"convertErrors":    errStats.ConvertErrors,
-		"insertErrors":     errStats.InsertErrors,
-		"retryAttempts":    errStats.RetryAttempts,
-		"flushFailures":    errStats.FlushFailures,
-		"droppedSamples":   errStats.DroppedSamples,
+	logger := o.logger
+	if last := o.GetLastFlushError(); last != nil {
+		logger = logger.WithFields(logrus.Fields{
+			"lastFlushError":     last.Err.Error(),
+			"lastFlushErrorTime": last.Time.Format(time.RFC3339),
+		})
+		if !last.FailingSince.IsZero() {
+			logger = logger.WithField("failingSince", last.FailingSince.Format(time.RFC3339))
+		}
+	}
+	logger.WithFields(logrus.Fields{
+		"samplesProcessed":   errStats.SamplesProcessed,
+		"convertErrors":      errStats.ConvertErrors,
+		"insertErrors":       errStats.InsertErrors,
+		"retryAttempts":      errStats.RetryAttempts,
+		"retriedBatches":     errStats.RetriedBatches,
+		"flushFailures":      errStats.FlushFailures,
+		"droppedSamples":     errStats.DroppedSamples,
+		"spilledSamples":     errStats.SpilledSamples,
+		"deadLetterSamples":  errStats.DeadLetterSamples,
+		"fallbackSamples":    errStats.FallbackSamples,
+		"exportedSamples":    errStats.ExportedSamples,
+		"evictedSamples":     errStats.EvictedSamples,
+		"batchSplits":        errStats.BatchSplits,
+		"skippedFlushes":     errStats.SkippedFlushes,
+		"tagOverflowSamples": errStats.TagOverflowSamples,
+		"bufferPeak":         errStats.BufferHighWatermark,
+		"maxSampleLag":       errStats.MaxSampleLag,
+		"maxSendDuration":    errStats.MaxSendDuration,
+		"payloadBytes":       errStats.PayloadBytes,
+		"wireBytes":          errStats.WireBytes,
+		"topMetrics":         o.metricStats.top(topMetricsLogged),
 	}).Info("ClickHouse output stopped")
 
+	o.stopTracing()
+	if o.logFile != nil {
+		_ = o.logFile.Close()
+	}
+
 	return nil
 }
 
+// drainTarget makes a final attempt to deliver a target's failover buffer
+// during Stop(). Samples that still cannot be delivered are counted as dropped;
+// with a WAL, their segments are kept for the next run.
+func (o *Output) drainTarget(drainCtx context.Context, t *schemaTarget) {
+	logger := o.logger.WithField("table", t.table)
+	released := t.wal.takeBuffered()
+	if t.failoverBuffer == nil || t.failoverBuffer.Len() == 0 {
+		// Whatever the segments held was delivered or dropped from the buffer
+		t.wal.remove(logger, released)
+		return
+	}
+
+	logger.WithField("bufferedSamples", t.failoverBuffer.Len()).Info("Draining failover buffer on shutdown")
+
+	samples := t.failoverBuffer.PopAll()
+	batches := splitBatch(samples, o.config.MaxBatchRows)
+	segments := o.logBatches(logger, t, batches, released)
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		seg := segments[i]
+		ctx := drainCtx
+		if seg.path != "" {
+			ctx = withDedupToken(drainCtx, seg.token)
+		}
+		state := walPending
+		if err := o.drainBatch(ctx, logger, t, batch); err == nil {
+			state = walDelivered
+		}
+		t.wal.settle(logger, seg, state)
+	}
+}
+
+// drainBatch delivers one batch of a target's failover buffer during Stop().
+// A batch rejected as too large is halved and each half drained on its own.
+// The returned error reports samples that were neither delivered nor kept
+// elsewhere (spill file, fallback sink, dead-letter file), or whose delivery
+// is ambiguous.
+func (o *Output) drainBatch(drainCtx context.Context, logger logrus.FieldLogger, t *schemaTarget, samples []metrics.SampleContainer) error {
+	var rejected []deadLetter
+
+	// Retry the final drain with the shutdown retry policy. The outage that
+	// filled the buffer may still be flapping, so a single unretried attempt
+	// would needlessly lose data inside the drain window (unless the run was
+	// interrupted; see StopWithTestError).
+	policy := o.retryPolicy()
+	attempts := 0
+	err := retry.Do(
+		func() error {
+			o.countRetry(&attempts)
+			return o.doFlush(drainCtx, t, samples, &rejected)
+		},
+		retry.Attempts(policy.attempts+1),
+		retry.Delay(policy.delay),
+		retry.MaxDelay(policy.maxDelay),
+		retry.DelayType(backoffDelay(policy.maxDelay)),
+		retry.Context(drainCtx),
+		retry.RetryIf(o.shouldRetry),
+	)
+	if halves, ok := o.splitTooLarge(logger, err, samples); ok {
+		return errors.Join(
+			o.drainBatch(splitDedupToken(drainCtx, 0), logger, t, halves[0]),
+			o.drainBatch(splitDedupToken(drainCtx, 1), logger, t, halves[1]),
+		)
+	}
+	switch {
+	case err == nil:
+		o.divertDeadLetters(logger, t, rejected)
+		logger.WithField("flushedSamples", len(samples)).Info("Successfully drained failover buffer")
+		return nil
+	case isCommitError(err):
+		// Commit errors are ambiguous — the server may already hold the data.
+		// Don't count them as dropped (mirrors flush()).
+		o.divertDeadLetters(logger, t, rejected)
+		logger.WithError(err).WithField("samples", len(samples)).Warn("Commit error during shutdown drain (data may already be persisted)")
+		return err
+	case classifyError(err) == errClassData:
+		o.rejectBatch(logger, t, samples, err)
+		return nil
+	case o.config.SpillDir != "":
+		return o.spillTarget(logger.WithError(err), t, samples)
+	case o.exportBatch(drainCtx, logger.WithError(err), t, samples):
+		return nil
+	case o.divertFallback(logger.WithError(err), t, fallbackShutdown, samples):
+		return nil
+	default:
+		// Unrecoverable at shutdown; count the loss so the final metrics
+		// summary is accurate instead of silently under-reporting drops.
+		o.droppedSamples.Add(uint64(len(samples)))
+		logger.WithError(err).WithField("lostSamples", len(samples)).Warn("Failed to drain buffer on shutdown, data lost")
+		return err
+	}
+}
+
+// spillTarget persists samples that could not be drained at shutdown to a
+// spill file in SpillDir. Samples are only counted as dropped, and the error
+// returned, when the file cannot be written either.
+func (o *Output) spillTarget(logger logrus.FieldLogger, t *schemaTarget, samples []metrics.SampleContainer) error {
+	path, n, err := writeSpillFile(o.config.SpillDir, o.config.Database, t.table, samples)
+	if err != nil {
+		o.droppedSamples.Add(uint64(len(samples)))
+		logger.WithField("spillError", err).WithField("lostSamples", len(samples)).Error("Failed to drain buffer on shutdown and to spill it to disk, data lost")
+		return err
+	}
+	o.spilledSamples.Add(uint64(n))
+	logger.WithFields(logrus.Fields{
+		"spillFile":      path,
+		"spilledSamples": n,
+	}).Warn("Failed to drain buffer on shutdown, samples spilled to disk")
+	return nil
+}
+
+// shouldRetry reports whether a failed flush attempt is retried. Once the
+// run is interrupted, remaining time goes to the next batch instead.
+func (o *Output) shouldRetry(err error) bool {
+	return !o.interrupted.Load() && isRetryableError(err)
+}
+
+// countRetry counts the attempts of a batch and the batch as retried on its
+// second attempt.
+func (o *Output) countRetry(attempts *int) {
+	*attempts++
+	if *attempts == 2 {
+		o.retriedBatches.Add(1)
+	}
+}
+
+// retryPolicy is the retry budget of a batch insert.
+type retryPolicy struct {
+	attempts uint // Retries after the first attempt
+	delay    time.Duration
+	maxDelay time.Duration
+}
+
+// retryPolicy returns the retry budget of the batches flushed now: the
+// steady-state settings, or ShutdownFlushRetries and ShutdownRetryBackoff,
+// where set, once Stop() has begun.
+func (o *Output) retryPolicy() retryPolicy {
+	// config is immutable after New(), so reading it without the lock is safe.
+	p := retryPolicy{attempts: o.config.RetryAttempts, delay: o.config.RetryDelay, maxDelay: o.config.RetryMaxDelay}
+	if !o.stopping.Load() {
+		return p
+	}
+	if o.config.ShutdownFlushRetries != nil {
+		p.attempts = *o.config.ShutdownFlushRetries
+	}
+	if o.config.ShutdownRetryBackoff > 0 {
+		p.delay = o.config.ShutdownRetryBackoff
+		p.maxDelay = max(p.maxDelay, p.delay)
+	}
+	return p
+}
+
 // GetErrorMetrics returns cumulative error statistics from flush operations.
 // All counters are thread-safe and can be called concurrently with flush operations.
 func (o *Output) GetErrorMetrics() ErrorMetrics {
-	var bufferedSamples uint64
-	if o.failoverBuffer != nil {
-		if n := o.failoverBuffer.Len(); n > 0 {
-			bufferedSamples = uint64(n)
+	var bufferedSamples, evictedSamples, highWatermark uint64
+	var fillPercent float64
+	lastLag, maxLag, lastSend, maxSend := o.sampleLag.snapshot()
+	var lastError time.Time
+	if ns := o.lastErrorTime.Load(); ns != 0 {
+		lastError = time.Unix(0, ns)
+	}
+	for _, t := range o.targets {
+		if t.failoverBuffer != nil {
+			bufferedSamples += uint64(t.failoverBuffer.Len())
+			evictedSamples += t.failoverBuffer.EvictedCount()
+			highWatermark = max(highWatermark, uint64(t.failoverBuffer.HighWatermark()))
+			fillPercent = max(fillPercent, t.failoverBuffer.FillPercent())
 		}
 	}
 
 	return ErrorMetrics{
-		ConvertErrors:    o.convertErrors.Load(),
-		InsertErrors:     o.insertErrors.Load(),
-		SamplesProcessed: o.samplesProcessed.Load(),
-		RetryAttempts:    o.retryAttempts.Load(),
-		FlushFailures:    o.flushFailures.Load(),
-		BufferedSamples:  bufferedSamples,
-		DroppedSamples:   o.droppedSamples.Load(),
+		ConvertErrors:      o.convertErrors.Load(),
+		InsertErrors:       o.insertErrors.Load(),
+		SamplesProcessed:   o.samplesProcessed.Load(),
+		RetryAttempts:      o.retryAttempts.Load(),
+		RetriedBatches:     o.retriedBatches.Load(),
+		FlushFailures:      o.flushFailures.Load(),
+		BufferedSamples:    bufferedSamples,
+		DroppedSamples:     o.droppedSamples.Load(),
+		LastErrorTime:      lastError,
+		Reconnects:         o.reconnects.Load(),
+		PayloadBytes:       o.payloadBytes.Load(),
+		WireBytes:          o.wireBytes.Load(),
+		SpilledSamples:     o.spilledSamples.Load(),
+		DeadLetterSamples:  o.deadLetterSamples.Load(),
+		FallbackSamples:    o.fallbackSamples.Load(),
+		ExportedSamples:    o.exportedSamples.Load(),
+		EvictedSamples:     evictedSamples,
+		BatchSplits:        o.batchSplits.Load(),
+		SkippedFlushes:     o.skippedFlushes.Load(),
+		TagOverflowSamples: o.tagOverflowSamples.Load(),
+
+		BufferHighWatermark: highWatermark,
+		BufferFillPercent:   fillPercent,
+
+		SampleLag:       lastLag,
+		MaxSampleLag:    maxLag,
+		SendDuration:    lastSend,
+		MaxSendDuration: maxSend,
+	}
+}
+
+// GetConfig returns the output's configuration. The copy is the caller's to
+// modify; it does not affect the output. Log it as is: Config masks its
+// secrets when formatted.
+func (o *Output) GetConfig() Config {
+	cfg := o.config
+	cfg.ShardAddrs = slices.Clone(cfg.ShardAddrs)
+	cfg.HashTags = slices.Clone(cfg.HashTags)
+	cfg.LowCardinalityColumns = slices.Clone(cfg.LowCardinalityColumns)
+	cfg.StringColumns = slices.Clone(cfg.StringColumns)
+	cfg.IncludeScenarios = slices.Clone(cfg.IncludeScenarios)
+	cfg.ExcludeScenarios = slices.Clone(cfg.ExcludeScenarios)
+	cfg.SampleFilters = slices.Clone(cfg.SampleFilters)
+	cfg.TagTransformers = slices.Clone(cfg.TagTransformers)
+	cfg.SchemaFiles = slices.Clone(cfg.SchemaFiles)
+	cfg.MetricTypeTTL = maps.Clone(cfg.MetricTypeTTL)
+	cfg.MaterializedColumns = maps.Clone(cfg.MaterializedColumns)
+	return cfg
+}
+
+// GetSchemaMode returns the configured schema mode, such as "simple", or a
+// comma-separated list when samples are written to several schemas (see
+// Config.SchemaModes).
+func (o *Output) GetSchemaMode() string {
+	return o.config.SchemaMode
+}
+
+// IsHealthy reports whether the output is delivering samples: it has
+// started, finished its server setup, is neither stopped nor halted by
+// convertErrorAction, and its last flush succeeded. Samples of an unhealthy
+// output are buffered or diverted as configured, not necessarily lost; see
+// GetErrorMetrics for the counts. It is safe to call from any goroutine.
+func (o *Output) IsHealthy() bool {
+	o.mu.RLock()
+	started, closed := o.targets != nil, o.closed
+	o.mu.RUnlock()
+
+	return started && !closed && o.serverReady.Load() && !o.halted.Load() && !o.lastFlushFailed.Load()
+}
+
+// FlushError describes the most recent failed flush cycle.
+type FlushError struct {
+	// Err is the error of the failed flush.
+	Err error
+
+	// Time is when the flush failed.
+	Time time.Time
+
+	// FailingSince is when the current streak of failed flushes began; zero
+	// once a later flush succeeded. time.Since(FailingSince) is how long the
+	// output has been failing.
+	FailingSince time.Time
+}
+
+// GetLastFlushError returns the most recent failed flush cycle, or nil if
+// every flush so far succeeded. It is kept after later flushes succeed, with
+// FailingSince cleared, so an output that recovered can be told from one that
+// never failed. Flushes cut short by shutdown are not counted. It is safe to
+// call from any goroutine.
+func (o *Output) GetLastFlushError() *FlushError {
+	o.lastFlushErrorMu.Lock()
+	defer o.lastFlushErrorMu.Unlock()
+
+	if o.lastFlushError == nil {
+		return nil
+	}
+	e := *o.lastFlushError
+	return &e
+}
+
+// recordFlushError updates the last flush error with the outcome of a flush
+// cycle that ended at now.
+func (o *Output) recordFlushError(err error, now time.Time) {
+	o.lastFlushErrorMu.Lock()
+	defer o.lastFlushErrorMu.Unlock()
+
+	last := o.lastFlushError
+	switch {
+	case err != nil:
+		since := now
+		if last != nil && !last.FailingSince.IsZero() {
+			since = last.FailingSince
+		}
+		o.lastFlushError = &FlushError{Err: err, Time: now, FailingSince: since}
+	case last != nil && !last.FailingSince.IsZero():
+		o.lastFlushError = &FlushError{Err: last.Err, Time: last.Time}
 	}
 }
 
@@ -424,11 +1132,21 @@ func isRetryableError(err error) bool {
 		return false
 	}
 
+	// Recognized ClickHouse exceptions decide by their class
+	if class := classifyError(err); class != errClassUnknown {
+		return class.retryable()
+	}
+
 	// Check for EOF errors using typed checks (avoids matching "thereof", "whereof", etc.)
 	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
 		return true
 	}
 
+	// A closed connection is re-established before the next attempt
+	if isConnClosedError(err) {
+		return true
+	}
+
 	// Check for network errors (connection refused, timeout, etc.)
 	if _, ok := errors.AsType[net.Error](err); ok {
 		return true
@@ -454,165 +1172,436 @@ func isRetryableError(err error) bool {
 	return false
 }
 
+// Errors returned by Flush.
+var (
+	// ErrOutputStopped is returned once Stop has been called.
+	ErrOutputStopped = errors.New("clickhouse output is stopped")
+
+	// ErrOutputHalted is returned after convertErrorAction=stopOutput halted
+	// the output; the samples were discarded.
+	ErrOutputHalted = errors.New("clickhouse output is halted by convertErrorAction")
+)
+
+// flushPollInterval is how often Flush checks for a free flush slot while
+// another flush is running.
+const flushPollInterval = 10 * time.Millisecond
+
+// Flush writes the samples collected so far, and any failover buffer
+// contents, to ClickHouse now instead of at the next PushInterval tick; for
+// example before querying results mid-test. If flushes are running, it waits
+// for a free slot first. It is safe to call from any goroutine. A periodic
+// tick meanwhile follows FlushOverlapPolicy as it would for any running flush.
+//
+// Samples that cannot be delivered are handled as in a periodic flush
+// (buffered, dead-lettered, ...) and reported in the returned error.
+// Cancelling ctx aborts the wait and the flush.
+func (o *Output) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+	for !o.tryStartFlush() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	defer o.endFlush()
+
+	return o.flushCycle(ctx)
+}
+
 // flush writes buffered samples to ClickHouse with retry logic
 func (o *Output) flush() {
 	// Prevent overlapping flushes — if a previous flush is still running
 	// (e.g., retrying during an outage), skip this cycle to avoid amplifying
 	// load on an already-struggling ClickHouse.
-	if !o.flushMu.TryLock() {
+	if !o.tryStartFlush() {
 		return
 	}
-	defer o.flushMu.Unlock()
+	defer o.endFlush()
+
+	_ = o.flushCycle(context.Background())
+}
+
+// flushCycle writes the samples buffered by k6 to every target. The caller
+// holds a flush slot (see tryStartFlush). The flush is also cancelled on
+// shutdown.
+func (o *Output) flushCycle(ctx context.Context) (err error) {
+	// Hold on to the handles read from here on (see reconnect.go)
+	seq := o.holdHandles()
+	defer o.releaseHandles(seq)
+
+	// Move to the next table of TableTemplate before the targets are captured
+	o.rollTables(ctx, time.Now())
 
 	// Quick early exit check (before acquiring WaitGroup)
 	o.mu.RLock()
 	if o.closed {
 		o.mu.RUnlock()
-		return
+		return ErrOutputStopped
 	}
 
 	// Register active flush while still under lock (prevents race with Stop())
 	o.flushWG.Add(1)
 
 	// Capture state under lock
-	ctx := o.shutdownCtx
+	shutdownCtx := o.shutdownCtx
 	logger := o.logger
-	retryAttempts := o.config.RetryAttempts
-	retryDelay := o.config.RetryDelay
-	retryMaxDelay := o.config.RetryMaxDelay
-	bufferEnabled := o.config.BufferEnabled
+	db := o.db
+	targets := o.targets
+	hasher := o.tagHasher
+	audit := o.audit
+	profile := o.loadProfile
+	thresholds := o.thresholds
+	events := o.events
+	summary := o.summary
+	counters := o.counters
+	webhook := o.webhook
+	tracer := o.tracer
 	o.mu.RUnlock()
 
 	defer o.flushWG.Done()
 
 	// Check if context was cancelled during shutdown
-	if ctx != nil {
-		select {
-		case <-ctx.Done():
+	if shutdownCtx != nil {
+		if err := shutdownCtx.Err(); err != nil {
 			logger.Debug("Flush cancelled by shutdown context")
-			return
-		default:
+			return err
 		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(shutdownCtx, cancel)()
 	}
 
-	// Collect samples from both k6 buffer and failover buffer
+	// Collect samples from the k6 buffer; every target receives the same set
 	samples := o.GetBufferedSamples()
 
-	// Also get any previously failed samples from failover buffer
-	if o.failoverBuffer != nil {
-		bufferedSamples := o.failoverBuffer.PopAll()
+	ctx, span := tracer.Start(ctx, spanFlush, trace.WithAttributes(
+		attribute.Int("k6.samples", countSamples(samples)),
+		attribute.Int("clickhouse.targets", len(targets)),
+	))
+	defer func() { endSpan(span, err) }()
+
+	// A halted output keeps draining k6's buffer so memory stays bounded
+	if o.halted.Load() {
+		dropped := 0
+		for _, sc := range samples {
+			dropped += len(sc.GetSamples())
+		}
+		o.droppedSamples.Add(uint64(dropped))
+		return ErrOutputHalted
+	}
+
+	// Rewrite the samples once, ahead of every target and sink
+	samples = o.ingest(samples)
+
+	if summary != nil {
+		summary.observe(samples, targets)
+	}
+	if profile != nil {
+		profile.observe(samples)
+	}
+	if events != nil {
+		events.observe(samples)
+	}
+	if counters != nil {
+		samples = counters.aggregate(samples)
+	}
+
+	// Setup deferred by skipPing must succeed before anything is inserted
+	if err := o.ensureServer(ctx, db, targets, hasher); err != nil {
+		withErrorHint(logger, err).Warn("ClickHouse is still not ready, buffering samples")
+		for _, t := range targets {
+			tl := logger.WithField("table", t.table)
+			seg := o.logBatches(tl, t, [][]metrics.SampleContainer{samples}, nil)[0]
+			o.bufferSamples(tl, t, samples, nil)
+			t.wal.settle(tl, seg, walStateAfterFlush(t, err))
+		}
+		o.notifyFlush(ctx, webhook, err)
+		return err
+	}
+
+	var errs []error
+	for _, t := range targets {
+		if err := o.flushTarget(ctx, t, samples); err != nil {
+			errs = append(errs, fmt.Errorf("table %s: %w", t.table, err))
+		}
+	}
+
+	// Lookup, series, audit, and load profile rows are written after the
+	// samples they describe; thresholds not written at Start are retried here
+	o.flushTagLookup(ctx, hasher)
+	o.flushSeries(ctx, targets)
+	o.flushAudit(ctx, audit)
+	o.flushLoadProfile(ctx, profile)
+
+	// An insert above may have reconnected and replaced the handle
+	o.mu.RLock()
+	db = o.db
+	o.mu.RUnlock()
+	o.flushThresholds(ctx, db, thresholds)
+	o.flushEvents(ctx, db, events)
+
+	err = errors.Join(errs...)
+	o.notifyFlush(ctx, webhook, err)
+	return err
+}
+
+// ingest rewrites the samples of a flush cycle before they are fanned out to
+// the targets, the run summary, the load profile, the event log, and the
+// sinks of undelivered samples: metrics are renamed (sanitizeMetricNames,
+// metricNameMaxLength), then tags are transformed (tagTransformers) and
+// limited (maxTagsPerSample).
+func (o *Output) ingest(samples []metrics.SampleContainer) []metrics.SampleContainer {
+	if o.renamer == nil && len(o.transformers) == 0 && o.limiter == nil {
+		return samples
+	}
+	return rewriteSamples(samples, func(s metrics.Sample) metrics.Sample {
+		if o.renamer != nil {
+			s = o.renamer.apply(s)
+		}
+		s = transformTags(o.transformers, s)
+		if o.limiter != nil {
+			s = o.limiter.apply(s)
+		}
+		return s
+	})
+}
+
+// notifyFlush passes the outcome of a flush cycle to IsHealthy and the
+// webhook. Flushes cut short by shutdown are not counted as failures.
+func (o *Output) notifyFlush(ctx context.Context, webhook *webhookNotifier, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	o.lastFlushFailed.Store(err != nil)
+	o.recordFlushError(err, time.Now())
+	if webhook != nil {
+		webhook.flushDone(err, o.droppedSamples.Load())
+	}
+}
+
+// flushTarget writes samples, plus any samples previously buffered for this
+// target, to the target's table with retry logic. On failure the samples are
+// pushed into the target's failover buffer and an error is returned.
+func (o *Output) flushTarget(ctx context.Context, t *schemaTarget, samples []metrics.SampleContainer) error {
+	logger := o.logger.WithField("table", t.table)
+
+	// Also get any previously failed samples from failover buffer. Their WAL
+	// segments are released first, so samples buffered concurrently keep theirs.
+	released := t.wal.takeBuffered()
+	if t.failoverBuffer != nil {
+		evictedBefore := t.failoverBuffer.EvictedCount()
+		bufferedSamples := t.failoverBuffer.PopAll()
+		if evicted := t.failoverBuffer.EvictedCount() - evictedBefore; evicted > 0 {
+			logger.WithFields(logrus.Fields{
+				"evicted": evicted,
+				"maxAge":  o.config.BufferMaxAge,
+			}).Warn("Evicted stale samples from failover buffer")
+		}
 		if len(bufferedSamples) > 0 {
 			logger.WithField("count", len(bufferedSamples)).Debug("Recovered samples from failover buffer")
 			samples = append(bufferedSamples, samples...)
 		}
 	}
 
-	if len(samples) == 0 {
-		return
+	batches := splitBatch(samples, o.config.MaxBatchRows)
+	segments := o.logBatches(logger, t, batches, released)
+	var errs []error
+	for i, batch := range batches {
+		if len(batch) > 0 {
+			errs = append(errs, o.flushSegment(ctx, logger, t, batch, segments[i]))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
 	}
+	return o.replayWAL(ctx, logger, t)
+}
+
+// flushBatch writes one batch to the target's table with retry logic. On
+// failure the batch is pushed into the target's failover buffer; a batch
+// rejected as too large is halved and each half flushed on its own. The
+// returned error reports samples that were not delivered.
+func (o *Output) flushBatch(ctx context.Context, logger logrus.FieldLogger, t *schemaTarget, samples []metrics.SampleContainer) error {
+	policy := o.retryPolicy()
 
 	start := time.Now()
 
+	// Samples failing conversion in the final attempt
+	var rejected []deadLetter
+
 	// Wrap flush in retry logic
+	attempts := 0
 	err := retry.Do(
 		func() error {
-			return o.doFlush(ctx, samples)
+			o.countRetry(&attempts)
+			return o.doFlush(ctx, t, samples, &rejected)
 		},
-		retry.Attempts(retryAttempts+1), // +1 because Attempts includes the initial attempt
-		retry.Delay(retryDelay),
-		retry.MaxDelay(retryMaxDelay),
-		retry.DelayType(retry.BackOffDelay),
+		retry.Attempts(policy.attempts+1), // +1 because Attempts includes the initial attempt
+		retry.Delay(policy.delay),
+		retry.MaxDelay(policy.maxDelay),
+		retry.DelayType(backoffDelay(policy.maxDelay)),
 		retry.Context(ctx),
 		retry.OnRetry(func(n uint, err error) {
 			o.retryAttempts.Add(1)
-			logger.WithError(err).WithFields(logrus.Fields{
+			withErrorHint(logger, err).WithFields(logrus.Fields{
 				// Total attempt budget is retryAttempts+1 (initial + retries);
 				// report that so "attempt" never exceeds "maxAttempts".
 				"attempt":     n + 1,
-				"maxAttempts": retryAttempts + 1,
+				"maxAttempts": policy.attempts + 1,
 			}).Warn("Flush failed, retrying")
 		}),
-		retry.RetryIf(isRetryableError),
+		retry.RetryIf(o.shouldRetry),
 	)
 
-	if err != nil {
-		o.flushFailures.Add(1)
-		logger.WithError(err).WithField("elapsed", time.Since(start)).Error("Flush failed after retries")
+	if err == nil {
+		o.divertDeadLetters(logger, t, rejected)
+		return nil
+	}
+	if halves, ok := o.splitTooLarge(logger, err, samples); ok {
+		return errors.Join(
+			o.flushBatch(splitDedupToken(ctx, 0), logger, t, halves[0]),
+			o.flushBatch(splitDedupToken(ctx, 1), logger, t, halves[1]),
+		)
+	}
+
+	o.flushFailures.Add(1)
+	withErrorHint(logger, err).WithField("elapsed", time.Since(start)).Error("Flush failed after retries")
 
+	switch {
+	case isCommitError(err):
 		// Commit errors are ambiguous — data may already be persisted.
 		// Do NOT buffer these samples to avoid duplication on next flush.
-		if isCommitError(err) {
-			logger.WithError(err).WithField("samples", len(samples)).Warn("Commit error (data may already be persisted), not buffering samples")
+		o.divertDeadLetters(logger, t, rejected)
+		logger.WithError(err).WithField("samples", len(samples)).Warn("Commit error (data may already be persisted), not buffering samples")
+	case classifyError(err) == errClassData:
+		// The batch would fail again on every replay; never buffer it.
+		o.rejectBatch(logger, t, samples, err)
+	case o.exportBatch(ctx, logger, t, samples):
+		o.divertDeadLetters(logger, t, rejected)
+	default:
+		o.bufferSamples(logger, t, samples, rejected)
+	}
+	return err
+}
+
+// bufferSamples pushes undelivered samples into the target's failover buffer
+// for a later flush. Samples that failed conversion are rejected again on
+// replay, so they are only dead-lettered when buffering is disabled.
+func (o *Output) bufferSamples(logger logrus.FieldLogger, t *schemaTarget, samples []metrics.SampleContainer, rejected []deadLetter) {
+	// config is immutable after New(), so reading it without the lock is safe.
+	if !o.config.BufferEnabled || t.failoverBuffer == nil {
+		o.divertDeadLetters(logger, t, rejected)
+		if o.divertFallback(logger, t, fallbackNoBuffer, samples) {
 			return
 		}
+		o.droppedSamples.Add(uint64(len(samples)))
+		logger.WithField("lostSamples", len(samples)).Error("Samples lost (buffering disabled)")
+		return
+	}
 
-		// Buffer failed samples for later retry
-		if bufferEnabled && o.failoverBuffer != nil {
-			dropped := o.failoverBuffer.Push(samples)
-			if dropped > 0 {
-				o.droppedSamples.Add(uint64(dropped))
-				logger.WithFields(logrus.Fields{
-					"dropped":  dropped,
-					"buffered": o.failoverBuffer.Len(),
-				}).Warn("Buffer overflow, dropped samples")
-			} else {
-				logger.WithFields(logrus.Fields{
-					"count":      len(samples),
-					"bufferSize": o.failoverBuffer.Len(),
-				}).Info("Samples buffered for retry")
-			}
-		} else {
-			logger.WithField("lostSamples", len(samples)).Error("Samples lost (buffering disabled)")
-		}
+	dropped := t.failoverBuffer.Push(samples)
+	switch {
+	case dropped > 0 && o.fallback != nil:
+		// The drop handler has moved them to the fallback sink
+	case dropped > 0:
+		o.droppedSamples.Add(uint64(dropped))
+		logger.WithFields(logrus.Fields{
+			"dropped":  dropped,
+			"buffered": t.failoverBuffer.Len(),
+		}).Warn("Buffer overflow, dropped samples")
+	default:
+		logger.WithFields(logrus.Fields{
+			"count":             len(samples),
+			"bufferSize":        t.failoverBuffer.Len(),
+			"bufferFillPercent": t.failoverBuffer.FillPercent(),
+		}).Info("Samples buffered for retry")
 	}
 }
 
 // doFlush performs the actual database insertion for a batch of samples.
 // This is the core flush logic, separated to enable retry wrapping.
 //
-// Delivery semantics: at-least-once. If Commit() succeeds server-side but the
+// Rows are written through the driver's native batch API (see insertBatch).
+// Delivery semantics: at-least-once. If the send succeeds server-side but the
 // response is lost, the caller receives a commitError (which is NOT retried).
 // Samples are optimistically counted as processed before the commit error is returned,
 // because they may already be persisted.
 //
+// Samples failing conversion are appended to rejected (when non-nil), which
+// is reset first so that a retried attempt does not report them twice.
+//
 //nolint:gocyclo // complexity is acceptable for batch processing
-func (o *Output) doFlush(ctx context.Context, samples []metrics.SampleContainer) error {
+func (o *Output) doFlush(ctx context.Context, t *schemaTarget, samples []metrics.SampleContainer, rejected *[]deadLetter) (err error) {
+	if rejected != nil {
+		*rejected = (*rejected)[:0]
+	}
+
+	// A handle that lost its connection is replaced first (see reconnect.go)
+	if err := o.reconnect(ctx, t.shard); err != nil {
+		return err
+	}
+
 	o.mu.RLock()
-	db := o.db
-	insertQuery := o.insertQuery
-	converter := o.converter
+	db := t.handle(o.db)
 	logger := o.logger
+	audit := o.audit
+	tracer := o.tracer
 	o.mu.RUnlock()
 
+	ctx, span := tracer.Start(ctx, spanInsert, trace.WithAttributes(
+		append(o.config.serverAttributes(), attribute.String("db.collection.name", t.table))...))
+	defer func() {
+		if err != nil {
+			o.lastErrorTime.Store(time.Now().UnixNano())
+		}
+		if isConnClosedError(err) {
+			o.markBroken(t.shard)
+		}
+		endSpan(span, err)
+	}()
+
 	if db == nil {
 		return errors.New("database connection not initialized")
 	}
 
-	start := time.Now()
+	insertQuery := t.insertQuery
+	converter := t.converter
 
-	// Begin transaction
-	batch, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin batch: %w", err)
+	// Each insert into a ReplacingMergeTree table supersedes earlier copies
+	if versioned(o.config.TableEngine) {
+		ctx = withRowVersion(ctx, o.nextRowVersion())
 	}
-	defer func() {
-		if rollbackErr := batch.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
-			logger.WithError(rollbackErr).Warn("Failed to rollback transaction")
-		}
-	}()
 
-	stmt, err := batch.PrepareContext(ctx, insertQuery)
-	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %w", err)
+	// An audited batch carries its own query ID (see audit.go)
+	insertCtx := o.config.insertContext(ctx)
+	var queryID string
+	var minTime, maxTime time.Time
+	if audit != nil || span.IsRecording() {
+		// Also ties the span to the server's query_log
+		insertCtx, queryID = withQueryID(insertCtx)
 	}
+	insertCtx, wireBytes := withWireBytes(insertCtx)
+
+	start := time.Now()
+
+	// The batch is opened with the first converted row, so a flush whose
+	// samples all fail conversion never reaches the server.
+	var batch *insertBatch
+	sent := false
 	defer func() {
-		if closeErr := stmt.Close(); closeErr != nil {
-			logger.WithError(closeErr).Warn("Failed to close statement")
+		if batch != nil && !sent {
+			batch.abort()
 		}
 	}()
 
 	count := 0
 	totalSamples := 0
+	payloadBytes := 0 // Estimated native-format size of the appended rows
+
+	rowsByMetric := make(map[string]uint64) // Appended rows per metric (see GetMetricStats)
 
 	// Track conversion errors within this flush operation.
 	// Deferred so every return path (including context cancellation) flushes the counter.
@@ -628,8 +1617,8 @@ func (o *Output) doFlush(ctx context.Context, samples []metrics.SampleContainer)
 		totalSamples += len(container.GetSamples())
 	}
 
-	// Accumulate rows that were successfully passed to ExecContext.
-	// These must NOT be released back to sync.Pool until after batch.Commit(),
+	// Accumulate rows that were successfully appended to the batch.
+	// These must NOT be released back to sync.Pool until after batch.send(),
 	// because the ClickHouse driver holds references to row data internally.
 	pendingRows := make([][]any, 0, totalSamples)
 	defer func() {
@@ -638,38 +1627,66 @@ func (o *Output) doFlush(ctx context.Context, samples []metrics.SampleContainer)
 		}
 	}()
 
+	// Collect the samples routed to this table
+	routed := make([]metrics.Sample, 0, totalSamples)
 	for _, container := range samples {
 		for _, sample := range container.GetSamples() {
-			// Check for context cancellation every 1000 samples
-			if ctx != nil && count%1000 == 0 {
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				default:
-				}
+			if t.accept == nil || t.accept(sample) {
+				routed = append(routed, sample)
 			}
+		}
+	}
+	considered := len(routed) // Conversion attempts
+
+	// Convert concurrently; the rows come back in sample order
+	converted, err := convertSamples(ctx, converter, t.columns, routed)
+	if err != nil {
+		return err
+	}
 
-			// Convert sample using the schema's converter
-			row, convErr := converter.Convert(ctx, sample)
-			if convErr != nil {
-				flushConvertErrors++
-				logger.WithError(convErr).Warn("Failed to convert sample")
-				continue
+	for i, sample := range routed {
+		row, convErr := converted[i].row, converted[i].err
+		if convErr != nil {
+			flushConvertErrors++
+			logger.WithError(convErr).Warn("Failed to convert sample")
+			if rejected != nil {
+				*rejected = append(*rejected, deadLetter{sample: sample, err: convErr})
 			}
+			continue
+		}
 
-			// Execute insert — abort entire batch on first error.
-			// The deferred batch.Rollback() handles cleanup.
-			_, execErr := stmt.ExecContext(ctx, row...)
-			if execErr != nil {
-				converter.Release(row) // Driver discards failed rows, safe to release
-				o.insertErrors.Add(1)
-				return fmt.Errorf("failed to insert sample: %w", execErr)
+		if batch == nil {
+			var err error
+			if batch, err = prepareInsert(insertCtx, db, t.conns, insertQuery); err != nil {
+				releaseConverted(converter, converted[i:])
+				return err
 			}
-			pendingRows = append(pendingRows, row)
-			count++
+		}
+
+		// Append the row — abort the entire batch on first error.
+		// The deferred batch.abort() handles cleanup.
+		if execErr := batch.append(ctx, row...); execErr != nil {
+			// Driver discards failed rows, safe to release
+			releaseConverted(converter, converted[i:])
+			o.insertErrors.Add(1)
+			return fmt.Errorf("failed to insert sample: %w", execErr)
+		}
+		pendingRows = append(pendingRows, row)
+		payloadBytes += estimateRowBytes(row)
+		count++
+		if sample.Metric != nil {
+			rowsByMetric[sample.Metric.Name]++
+		}
+		if minTime.IsZero() || sample.Time.Before(minTime) {
+			minTime = sample.Time
+		}
+		if sample.Time.After(maxTime) {
+			maxTime = sample.Time
 		}
 	}
 
+	o.checkConvertErrorRate(logger, flushConvertErrors, considered)
+
 	// If all samples had conversion errors, nothing to commit.
 	// Conversion errors are deterministic — retrying won't help.
 	if count == 0 {
@@ -682,15 +1699,46 @@ func (o *Output) doFlush(ctx context.Context, samples []metrics.SampleContainer)
 		return nil
 	}
 
-	if err := batch.Commit(); err != nil {
-		// Commit errors are ambiguous: data may already be persisted server-side.
-		// Optimistically count samples as processed and wrap as commitError
-		// so retry logic does NOT re-insert (avoiding duplication).
-		o.samplesProcessed.Add(uint64(count))
-		return &commitError{err: err}
+	sent = true
+	span.SetAttributes(
+		attribute.Int("clickhouse.rows", count),
+		attribute.String("clickhouse.query_id", queryID),
+		attribute.String("clickhouse.dedup_token", dedupToken(ctx)),
+	)
+	auditBatch := func(status string) {
+		if audit != nil {
+			audit.record(auditEntry{
+				queryID: queryID, table: t.table, status: status, rows: count,
+				minTime: minTime, maxTime: maxTime, duration: time.Since(start), sentAt: time.Now(),
+			})
+		}
+	}
+	sentAt := time.Now()
+	if err := batch.send(); err != nil {
+		err = sendError(err)
+		if isCommitError(err) {
+			// Ambiguous: data may already be persisted server-side.
+			// Optimistically count samples as processed; commitError
+			// keeps retry logic from re-inserting (avoiding duplication).
+			o.samplesProcessed.Add(uint64(count))
+			o.metricStats.add(rowsByMetric)
+			auditBatch(auditAmbiguous)
+		}
+		return err
 	}
 
+	sendDuration := time.Since(sentAt)
 	o.samplesProcessed.Add(uint64(count))
+	o.payloadBytes.Add(uint64(payloadBytes))
+	o.wireBytes.Add(uint64(wireBytes.Load()))
+	o.metricStats.add(rowsByMetric)
+	o.sampleLag.record(minTime, sentAt, sendDuration)
+	auditBatch(auditCommitted)
+	span.SetAttributes(
+		attribute.Int64("clickhouse.sample_lag_ms", sentAt.Sub(minTime).Milliseconds()),
+		attribute.Int("clickhouse.payload_bytes", payloadBytes),
+		attribute.Int64("clickhouse.wire_bytes", wireBytes.Load()),
+	)
 
 	// Log summary
 	if flushConvertErrors > 0 {
@@ -702,8 +1750,12 @@ func (o *Output) doFlush(ctx context.Context, samples []metrics.SampleContainer)
 		}).Warn("Flush completed with conversion errors")
 	} else {
 		logger.WithFields(logrus.Fields{
-			"samples": count,
-			"elapsed": time.Since(start),
+			"samples":      count,
+			"elapsed":      time.Since(start),
+			"sampleLag":    sentAt.Sub(minTime),
+			"sendDuration": sendDuration,
+			"payloadBytes": payloadBytes,
+			"wireBytes":    wireBytes.Load(),
 		}).Debug("Flushed metrics")
 	}
 
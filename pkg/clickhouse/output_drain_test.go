@@ -1,6 +1,7 @@
 package clickhouse
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -39,17 +40,18 @@ func TestStop_DrainsFailoverBufferAndAccountsLoss(t *testing.T) {
 
 	// Simulate samples buffered during a prior outage. db is nil, so the drain's
 	// doFlush fails with a non-retryable error, exercising the loss accounting.
-	o.failoverBuffer = NewSampleBuffer(100, DropOldest)
-	dropped := o.failoverBuffer.Push([]metrics.SampleContainer{
+	buf := NewSampleBuffer(100, DropOldest)
+	o.targets = []*schemaTarget{{mode: "simple", table: "samples", failoverBuffer: buf}}
+	dropped := buf.Push([]metrics.SampleContainer{
 		makeSampleContainer(t),
 		makeSampleContainer(t),
 	})
 	require.Zero(t, dropped, "precondition: nothing dropped on push")
-	require.Equal(t, 2, o.failoverBuffer.Len())
+	require.Equal(t, 2, buf.Len())
 
 	require.NoError(t, o.Stop())
 
-	assert.Equal(t, 0, o.failoverBuffer.Len(), "buffer should be emptied by the shutdown drain")
+	assert.Equal(t, 0, buf.Len(), "buffer should be emptied by the shutdown drain")
 
 	m := o.GetErrorMetrics()
 	assert.Equal(t, uint64(2), m.DroppedSamples,
@@ -73,3 +75,50 @@ func TestStart_AfterStop_ReturnsClosedError(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "output already closed")
 }
+
+// TestStop_ShutdownRetryBudget verifies that the final flush retries with
+// shutdownFlushRetries instead of the steady-state retryAttempts.
+func TestStop_ShutdownRetryBudget(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval":         "1h",
+		"retryAttempts":        0,
+		"shutdownFlushRetries": 2,
+		"shutdownRetryBackoff": "1ms",
+	})
+
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	o.AddMetricSamples([]metrics.SampleContainer{makeSampleContainer(t)})
+	o.flush()
+	// Counted once per failed attempt
+	assert.Equal(t, uint64(1), o.GetErrorMetrics().RetryAttempts, "no retries while running")
+
+	o.AddMetricSamples([]metrics.SampleContainer{makeSampleContainer(t)})
+	require.NoError(t, o.Stop())
+	stats := o.GetErrorMetrics()
+	assert.Equal(t, uint64(1+3), stats.RetryAttempts, "the final flush used the shutdown budget")
+	assert.Equal(t, uint64(2), stats.DroppedSamples, "both samples failed to drain")
+}
+
+// TestOutput_RetryPolicy verifies that unset shutdown retry settings fall
+// back to retryAttempts and retryDelay.
+func TestOutput_RetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	_, o := newFakeOutput(t, output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"retryAttempts": 5,
+		"retryDelay":    "50ms",
+	})})
+	steady := retryPolicy{attempts: 5, delay: 50 * time.Millisecond, maxDelay: 5 * time.Second}
+	assert.Equal(t, steady, o.retryPolicy())
+	o.stopping.Store(true)
+	assert.Equal(t, steady, o.retryPolicy(), "unset shutdown settings keep the steady-state ones")
+
+	_, o = newFakeOutput(t, output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"shutdownFlushRetries": 0,
+		"shutdownRetryBackoff": "10s",
+	})})
+	o.stopping.Store(true)
+	assert.Equal(t, retryPolicy{attempts: 0, delay: 10 * time.Second, maxDelay: 10 * time.Second}, o.retryPolicy())
+}
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.k6.io/k6/v2/metrics"
@@ -166,6 +168,17 @@ func TestOutput_Description(t *testing.T) {
 			},
 			expectedDescPrefix: "clickhouse ([::1]:9000)",
 		},
+		{
+			name: "instance name",
+			config: Config{
+				Addr:         "localhost:9000",
+				Database:     "k6",
+				Table:        "samples",
+				PushInterval: 1 * time.Second,
+				InstanceName: "lg-3",
+			},
+			expectedDescPrefix: "clickhouse (localhost:9000, instance=lg-3)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -182,6 +195,42 @@ func TestOutput_Description(t *testing.T) {
 	}
 }
 
+func TestNew_InstanceLogField(t *testing.T) {
+	t.Parallel()
+
+	logger, hook := logtest.NewNullLogger()
+	out, err := New(output.Params{Logger: logger, ConfigArgument: "localhost:9000?instanceName=lg-1"})
+	require.NoError(t, err)
+
+	out.(*Output).logger.Info("hello")
+	require.Len(t, hook.Entries, 1)
+	assert.Equal(t, "lg-1", hook.Entries[0].Data["instance"])
+}
+
+func TestStart_WarnsAboutSubSecondPushInterval(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		config map[string]any
+		warns  bool
+	}{
+		{map[string]any{"pushInterval": "200ms"}, true},
+		{map[string]any{"pushInterval": "200ms", "asyncInsert": true}, false},
+		{map[string]any{"pushInterval": "1s"}, false},
+	} {
+		logger, hook := logtest.NewNullLogger()
+		_, out := newFakeOutput(t, output.Params{Logger: logger, JSONConfig: mustMarshalJSON(tt.config)})
+		require.NoError(t, out.Start())
+		require.NoError(t, out.Stop())
+
+		warned := false
+		for _, e := range hook.AllEntries() {
+			warned = warned || strings.HasPrefix(e.Message, "pushInterval is below 1s")
+		}
+		assert.Equal(t, tt.warns, warned, "%v", tt.config)
+	}
+}
+
 func TestOutput_Stop(t *testing.T) {
 	t.Parallel()
 
@@ -376,6 +425,75 @@ func TestOutput_GetErrorMetrics_AfterStop(t *testing.T) {
 	assert.Equal(t, uint64(100), errMetrics.SamplesProcessed)
 }
 
+func TestOutput_GetErrorMetrics_BufferOccupancy(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{"retryAttempts": 0, "bufferMaxSamples": 4})
+
+	fake.set(func(f *fakeDB) { f.execErr = errors.New("connection refused") })
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("custom", metrics.Counter)
+	for range 3 {
+		o.AddMetricSamples([]metrics.SampleContainer{metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet()},
+			Time:       time.Now(),
+			Value:      1,
+		}})
+	}
+	o.flush()
+
+	stats := o.GetErrorMetrics()
+	assert.Equal(t, uint64(3), stats.BufferHighWatermark)
+	assert.InDelta(t, 75.0, stats.BufferFillPercent, 1e-9)
+
+	// Recovery empties the buffer; the peak is kept
+	fake.set(func(f *fakeDB) { f.execErr = nil })
+	o.flush()
+
+	stats = o.GetErrorMetrics()
+	assert.Equal(t, uint64(3), stats.BufferHighWatermark)
+	assert.InDelta(t, 0.0, stats.BufferFillPercent, 1e-9)
+}
+
+func TestOutput_GetErrorMetrics_RetriesAndDrops(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval": "1h", "bufferEnabled": false,
+		"retryAttempts": 2, "retryDelay": "1ms", "retryMaxDelay": "1ms",
+	})
+	assert.True(t, o.GetErrorMetrics().LastErrorTime.IsZero(), "no error yet")
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("custom", metrics.Counter)
+	send := func() {
+		o.AddMetricSamples([]metrics.SampleContainer{
+			metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet()}, Time: time.Now(), Value: 1},
+			metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet()}, Time: time.Now(), Value: 2},
+		})
+		o.flush()
+	}
+
+	// A batch failing every attempt is retried once and, unbuffered, lost
+	before := time.Now()
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	send()
+	stats := o.GetErrorMetrics()
+	assert.Equal(t, uint64(1), stats.RetriedBatches)
+	assert.Equal(t, uint64(3), stats.RetryAttempts, "counted per failed attempt")
+	assert.Equal(t, uint64(2), stats.DroppedSamples)
+	assert.False(t, stats.LastErrorTime.Before(before))
+	lastError := stats.LastErrorTime
+
+	// A batch succeeding at once is not retried
+	fake.set(func(f *fakeDB) { f.prepareErr = nil })
+	send()
+	stats = o.GetErrorMetrics()
+	assert.Equal(t, uint64(1), stats.RetriedBatches)
+	assert.Equal(t, uint64(2), stats.DroppedSamples)
+	assert.Equal(t, lastError, stats.LastErrorTime)
+}
+
 func TestOutput_ErrorMetrics_AtomicOperations(t *testing.T) {
 	t.Parallel()
 
@@ -464,7 +582,7 @@ func TestDoFlush_ReleaseAfterCommit(t *testing.T) {
 		containers := []metrics.SampleContainer{metrics.Samples{sample}}
 
 		ctx := context.Background()
-		err = clickhouseOut.doFlush(ctx, containers)
+		err = clickhouseOut.doFlush(ctx, &schemaTarget{}, containers, nil)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "database connection not initialized")
 	})
@@ -679,6 +797,57 @@ func TestFlush_OverlappingPrevented(t *testing.T) {
 	clickhouseOut.flushMu.Unlock()
 }
 
+func TestOutput_PublicFlush(t *testing.T) {
+	t.Parallel()
+
+	t.Run("writes buffered samples", func(t *testing.T) {
+		t.Parallel()
+
+		fake, o := startFakeOutput(t, insertConfig())
+		addStatusSamples(o, 3, 0)
+		require.NoError(t, o.Flush(context.Background()))
+		assert.Len(t, fake.Rows(), 3)
+	})
+
+	t.Run("reports undelivered samples", func(t *testing.T) {
+		t.Parallel()
+
+		fake, o := startFakeOutput(t, insertConfig())
+		fake.set(func(f *fakeDB) { f.execErr = errors.New("connection refused") })
+		addStatusSamples(o, 3, 0)
+
+		err := o.Flush(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "table samples")
+		assert.Equal(t, uint64(1), o.GetErrorMetrics().BufferedSamples)
+
+		// The next Flush delivers the buffered samples
+		fake.set(func(f *fakeDB) { f.execErr = nil })
+		require.NoError(t, o.Flush(context.Background()))
+		assert.Len(t, fake.Rows(), 3)
+	})
+
+	t.Run("waits for a running flush", func(t *testing.T) {
+		t.Parallel()
+
+		_, o := startFakeOutput(t, insertConfig())
+		require.True(t, o.tryStartFlush())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, o.Flush(ctx), context.DeadlineExceeded)
+		o.endFlush()
+	})
+
+	t.Run("after stop", func(t *testing.T) {
+		t.Parallel()
+
+		_, o := startFakeOutput(t, nil)
+		require.NoError(t, o.Stop())
+		require.ErrorIs(t, o.Flush(context.Background()), ErrOutputStopped)
+	})
+}
+
 func TestNew_UsesParamsLogger(t *testing.T) {
 	t.Parallel()
 	l := logrus.New()
@@ -700,3 +869,107 @@ func TestNew_FallbackLogger(t *testing.T) {
 }
 
 // mustMarshalJSON is defined in config_test.go
+
+func TestStopWithTestError(t *testing.T) {
+	t.Parallel()
+
+	// With pushInterval 1h the periodic flush never fires on its own, so
+	// Stop's final flush is the only one.
+	addSample := func(o *Output) {
+		registry := metrics.NewRegistry()
+		o.AddMetricSamples([]metrics.SampleContainer{metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("custom", metrics.Counter), Tags: registry.RootTagSet()},
+			Time:       time.Now(),
+			Value:      1,
+		}})
+	}
+
+	t.Run("clean run stops normally", func(t *testing.T) {
+		t.Parallel()
+
+		fake, o := startFakeOutput(t, map[string]any{"pushInterval": "1h"})
+		addSample(o)
+		require.NoError(t, o.StopWithTestError(nil))
+		assert.Len(t, fake.Rows(), 1)
+		assert.False(t, o.interrupted.Load())
+	})
+
+	t.Run("interrupted run flushes remaining samples", func(t *testing.T) {
+		t.Parallel()
+
+		fake, o := startFakeOutput(t, map[string]any{"pushInterval": "1h"})
+		addSample(o)
+		require.NoError(t, o.StopWithTestError(errors.New("test run was aborted")))
+		assert.Len(t, fake.Rows(), 1)
+	})
+
+	t.Run("interrupted run does not wait on retries", func(t *testing.T) {
+		t.Parallel()
+
+		fake, o := startFakeOutput(t, map[string]any{
+			"pushInterval":      "1h",
+			"abortFlushTimeout": "200ms",
+			"retryAttempts":     10,
+			"retryDelay":        "2s",
+		})
+		fake.set(func(f *fakeDB) { f.execErr = errors.New("connection refused") })
+		addSample(o)
+
+		start := time.Now()
+		require.NoError(t, o.StopWithTestError(errors.New("interrupted")))
+		assert.Less(t, time.Since(start), 2*time.Second)
+
+		stats := o.GetErrorMetrics()
+		assert.Zero(t, stats.RetryAttempts)
+		assert.Equal(t, uint64(1), stats.DroppedSamples, "undelivered sample is counted as dropped")
+	})
+}
+
+func TestOutput_Accessors(t *testing.T) {
+	t.Parallel()
+
+	fake, o := newFakeOutput(t, output.Params{
+		JSONConfig: mustMarshalJSON(map[string]any{
+			"pushInterval":  "1h",
+			"retryAttempts": 0,
+			"schemaMode":    "simple,compatible",
+			"hashTags":      []string{"url"},
+		}),
+	})
+
+	assert.Equal(t, "simple,compatible", o.GetSchemaMode())
+	cfg := o.GetConfig()
+	assert.Equal(t, time.Hour, cfg.PushInterval)
+	cfg.HashTags[0] = "name"
+	assert.Equal(t, []string{"url"}, o.GetConfig().HashTags, "the copy does not share the output's slices")
+
+	assert.False(t, o.IsHealthy(), "not started")
+	require.NoError(t, o.Start())
+	assert.True(t, o.IsHealthy())
+
+	assert.Nil(t, o.GetLastFlushError())
+
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	assert.False(t, o.IsHealthy(), "the last flush failed")
+	first := o.GetLastFlushError()
+	require.NotNil(t, first)
+	assert.ErrorContains(t, first.Err, "connection refused")
+	assert.Equal(t, first.Time, first.FailingSince)
+
+	o.flush()
+	second := o.GetLastFlushError()
+	assert.Equal(t, first.FailingSince, second.FailingSince, "the streak started with the first failure")
+
+	fake.set(func(f *fakeDB) { f.prepareErr = nil })
+	o.flush()
+	assert.True(t, o.IsHealthy(), "the next flush succeeded")
+	recovered := o.GetLastFlushError()
+	require.NotNil(t, recovered, "the last error is kept")
+	assert.Equal(t, second.Time, recovered.Time)
+	assert.True(t, recovered.FailingSince.IsZero())
+
+	require.NoError(t, o.Stop())
+	assert.False(t, o.IsHealthy(), "stopped")
+}
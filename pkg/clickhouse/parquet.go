@@ -0,0 +1,749 @@
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+// A minimal Parquet writer for export files (see ExportFormat).
+//
+// Rows are written as one row group of uncompressed, PLAIN-encoded version 1
+// data pages, one page per column, which every Parquet reader accepts,
+// ClickHouse's FORMAT Parquet included. Column types follow the Go types the
+// converters return: strings, numbers, booleans, and times become nullable
+// primitive columns (time as a UTC TIMESTAMP in nanoseconds), Map columns
+// MAP groups, and Array(String) columns LIST groups. A column whose values
+// are all NULL is written as a nullable string. The footer is encoded with
+// Thrift's compact protocol, which this file implements for the few
+// structures a file needs.
+
+// parquetMagic starts and ends every Parquet file.
+const parquetMagic = "PAR1"
+
+// Parquet physical types.
+const (
+	parquetBoolean   int32 = 0
+	parquetInt32     int32 = 1
+	parquetInt64     int32 = 2
+	parquetFloat     int32 = 4
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+)
+
+// Parquet repetition types.
+const (
+	parquetRequired int32 = 0
+	parquetOptional int32 = 1
+	parquetRepeated int32 = 2
+)
+
+// Parquet converted types, for readers predating logical types.
+const (
+	convertedUTF8   int32 = 0
+	convertedMap    int32 = 1
+	convertedList   int32 = 3
+	convertedUint8  int32 = 11
+	convertedUint16 int32 = 12
+	convertedUint32 int32 = 13
+	convertedUint64 int32 = 14
+	convertedInt8   int32 = 15
+	convertedInt16  int32 = 16
+	convertedInt32  int32 = 17
+	convertedInt64  int32 = 18
+)
+
+// Parquet encodings; pages use PLAIN values and RLE levels.
+const (
+	parquetPlain int32 = 0
+	parquetRLE   int32 = 3
+)
+
+// parquetKind is the Go type of a column's values, known from its first
+// non-NULL value.
+type parquetKind int
+
+const (
+	kindUnknown parquetKind = iota
+	kindString
+	kindBool
+	kindInt8
+	kindInt16
+	kindInt32
+	kindInt64
+	kindUint8
+	kindUint16
+	kindUint32
+	kindUint64
+	kindFloat32
+	kindFloat64
+	kindTime
+	kindStringMap
+	kindFloatMap
+	kindBoolMap
+	kindStringList
+)
+
+// parquetKindOf returns the kind of v, or kindUnknown for a type without a
+// Parquet mapping (written as its fmt.Sprint string).
+func parquetKindOf(v any) parquetKind {
+	switch v.(type) {
+	case string, *string:
+		return kindString
+	case bool:
+		return kindBool
+	case int8:
+		return kindInt8
+	case int16:
+		return kindInt16
+	case int32:
+		return kindInt32
+	case int64, int:
+		return kindInt64
+	case uint8:
+		return kindUint8
+	case uint16:
+		return kindUint16
+	case uint32:
+		return kindUint32
+	case uint64, uint:
+		return kindUint64
+	case float32:
+		return kindFloat32
+	case float64:
+		return kindFloat64
+	case time.Time:
+		return kindTime
+	case map[string]string:
+		return kindStringMap
+	case map[string]float64:
+		return kindFloatMap
+	case map[string]bool:
+		return kindBoolMap
+	case []string:
+		return kindStringList
+	default:
+		return kindUnknown
+	}
+}
+
+// parquetLeaf is one primitive column of the file with its levels and
+// PLAIN-encoded values.
+type parquetLeaf struct {
+	path      []string
+	physical  int32
+	maxDef    int32
+	maxRep    int32
+	defLevels []int32
+	repLevels []int32
+	values    bytes.Buffer
+	bools     []bool // BOOLEAN values, bit-packed when the page is written
+}
+
+// add records one level entry, with its value appended by the caller when
+// def is maxDef.
+func (l *parquetLeaf) add(def, rep int32) {
+	l.defLevels = append(l.defLevels, def)
+	if l.maxRep > 0 {
+		l.repLevels = append(l.repLevels, rep)
+	}
+}
+
+// parquetColumn is one column of the target's layout: a primitive leaf, or
+// the key and value leaves of a MAP, or the element leaf of a LIST.
+type parquetColumn struct {
+	name     string
+	jsonMap  bool // maps are written as JSON strings (JSON columns)
+	kind     parquetKind
+	nulls    int // NULLs seen before the kind was known
+	leaves   []*parquetLeaf
+	elements []parquetSchemaElement
+}
+
+// parquetFile collects rows column by column.
+type parquetFile struct {
+	columns []*parquetColumn
+	rows    int
+}
+
+// newParquetFile returns an empty file with columns; jsonCols names the map
+// columns written as JSON strings.
+func newParquetFile(columns []string, jsonCols map[string]bool) *parquetFile {
+	f := &parquetFile{columns: make([]*parquetColumn, len(columns))}
+	for i, name := range columns {
+		f.columns[i] = &parquetColumn{name: name, jsonMap: jsonCols[name]}
+	}
+	return f
+}
+
+// appendRow adds a converted row, whose values must be in column order.
+func (f *parquetFile) appendRow(row []any) error {
+	if len(row) != len(f.columns) {
+		return fmt.Errorf("row has %d values for %d columns", len(row), len(f.columns))
+	}
+	// Check every value before adding any, so a bad row leaves no trace.
+	values := make([]any, len(row))
+	kinds := make([]parquetKind, len(row))
+	for i, v := range row {
+		var err error
+		if values[i], kinds[i], err = f.columns[i].check(v); err != nil {
+			return fmt.Errorf("column %s: %w", f.columns[i].name, err)
+		}
+	}
+	for i, c := range f.columns {
+		c.add(values[i], kinds[i])
+	}
+	f.rows++
+	return nil
+}
+
+// check returns v as the column stores it and its kind, kindUnknown for
+// NULL, or an error when its type differs from the column's.
+func (c *parquetColumn) check(v any) (any, parquetKind, error) {
+	if p, ok := v.(*string); ok {
+		if p == nil {
+			return nil, kindUnknown, nil
+		}
+		v = *p
+	}
+	if v == nil {
+		return nil, kindUnknown, nil
+	}
+
+	kind := parquetKindOf(v)
+	if c.jsonMap && (kind == kindStringMap || kind == kindFloatMap || kind == kindBoolMap) {
+		s, err := exportJSON(v)
+		if err != nil {
+			return nil, kindUnknown, err
+		}
+		v, kind = s, kindString
+	}
+	if kind == kindUnknown {
+		v, kind = fmt.Sprint(v), kindString
+	}
+	if c.kind != kindUnknown && kind != c.kind {
+		return nil, kindUnknown, fmt.Errorf("%T value after values of another type", v)
+	}
+	return v, kind, nil
+}
+
+// add appends a value returned by check, deciding the column's type on its
+// first non-NULL value.
+func (c *parquetColumn) add(v any, kind parquetKind) {
+	if v == nil {
+		if c.kind == kindUnknown {
+			c.nulls++
+			return
+		}
+		for _, l := range c.leaves {
+			l.add(0, 0)
+		}
+		return
+	}
+	if c.kind == kindUnknown {
+		c.setKind(kind)
+	}
+	c.addValue(v)
+}
+
+// setKind lays out the column's schema and leaves for kind and writes the
+// NULLs seen so far.
+func (c *parquetColumn) setKind(kind parquetKind) {
+	c.kind = kind
+	switch kind {
+	case kindStringMap, kindFloatMap, kindBoolMap:
+		value := primitiveElement("value", kind, parquetRequired)
+		c.elements = []parquetSchemaElement{
+			groupElement(c.name, parquetOptional, 1, convertedMap, logicalMap),
+			groupElement("key_value", parquetRepeated, 2, -1, nil),
+			primitiveElement("key", kindString, parquetRequired),
+			value,
+		}
+		c.leaves = []*parquetLeaf{
+			{path: []string{c.name, "key_value", "key"}, physical: parquetByteArray, maxDef: 2, maxRep: 1},
+			{path: []string{c.name, "key_value", "value"}, physical: value.physical, maxDef: 2, maxRep: 1},
+		}
+	case kindStringList:
+		c.elements = []parquetSchemaElement{
+			groupElement(c.name, parquetOptional, 1, convertedList, logicalList),
+			groupElement("list", parquetRepeated, 1, -1, nil),
+			primitiveElement("element", kindString, parquetRequired),
+		}
+		c.leaves = []*parquetLeaf{
+			{path: []string{c.name, "list", "element"}, physical: parquetByteArray, maxDef: 2, maxRep: 1},
+		}
+	default:
+		element := primitiveElement(c.name, kind, parquetOptional)
+		c.elements = []parquetSchemaElement{element}
+		c.leaves = []*parquetLeaf{{path: []string{c.name}, physical: element.physical, maxDef: 1}}
+	}
+	for range c.nulls {
+		for _, l := range c.leaves {
+			l.add(0, 0)
+		}
+	}
+	c.nulls = 0
+}
+
+// addValue appends a non-NULL value of the column's kind.
+func (c *parquetColumn) addValue(v any) {
+	switch v := v.(type) {
+	case map[string]string:
+		addMap(c.leaves, v, func(l *parquetLeaf, s string) { writeByteArray(&l.values, s) })
+	case map[string]float64:
+		addMap(c.leaves, v, func(l *parquetLeaf, f float64) { writeLE(&l.values, math.Float64bits(f)) })
+	case map[string]bool:
+		addMap(c.leaves, v, func(l *parquetLeaf, b bool) { l.bools = append(l.bools, b) })
+	case []string:
+		l := c.leaves[0]
+		if len(v) == 0 {
+			l.add(1, 0)
+		}
+		for i, s := range v {
+			l.add(2, min(int32(i), 1))
+			writeByteArray(&l.values, s)
+		}
+	default:
+		l := c.leaves[0]
+		l.add(1, 0)
+		writePlain(l, v)
+	}
+}
+
+// addMap appends a map's entries in key order: the first entry starts the
+// row (repetition level 0), an empty map is defined but has no entry.
+func addMap[V any](leaves []*parquetLeaf, m map[string]V, write func(*parquetLeaf, V)) {
+	key, value := leaves[0], leaves[1]
+	if len(m) == 0 {
+		key.add(1, 0)
+		value.add(1, 0)
+		return
+	}
+	for i, k := range slices.Sorted(maps.Keys(m)) {
+		rep := min(int32(i), 1)
+		key.add(2, rep)
+		value.add(2, rep)
+		writeByteArray(&key.values, k)
+		write(value, m[k])
+	}
+}
+
+// writePlain appends a primitive value in PLAIN encoding.
+func writePlain(l *parquetLeaf, v any) {
+	switch v := v.(type) {
+	case string:
+		writeByteArray(&l.values, v)
+	case bool:
+		l.bools = append(l.bools, v)
+	case int8:
+		writeLE(&l.values, uint32(int32(v)))
+	case int16:
+		writeLE(&l.values, uint32(int32(v)))
+	case int32:
+		writeLE(&l.values, uint32(v))
+	case int64:
+		writeLE(&l.values, uint64(v))
+	case int:
+		writeLE(&l.values, uint64(int64(v)))
+	case uint8:
+		writeLE(&l.values, uint32(v))
+	case uint16:
+		writeLE(&l.values, uint32(v))
+	case uint32:
+		writeLE(&l.values, v)
+	case uint64:
+		writeLE(&l.values, v)
+	case uint:
+		writeLE(&l.values, uint64(v))
+	case float32:
+		writeLE(&l.values, math.Float32bits(v))
+	case float64:
+		writeLE(&l.values, math.Float64bits(v))
+	case time.Time:
+		writeLE(&l.values, uint64(v.UnixNano()))
+	}
+}
+
+func writeLE[T uint32 | uint64](b *bytes.Buffer, v T) {
+	_ = binary.Write(b, binary.LittleEndian, v)
+}
+
+func writeByteArray(b *bytes.Buffer, s string) {
+	writeLE(b, uint32(len(s))) //nolint:gosec // G115: strings in a row are far below 4 GiB
+	b.WriteString(s)
+}
+
+// parquetSchemaElement is a node of the file's schema.
+type parquetSchemaElement struct {
+	name        string
+	physical    int32 // -1 for groups
+	repetition  int32
+	numChildren int32
+	converted   int32 // -1 for none
+	logical     func(*thriftWriter)
+}
+
+// groupElement returns the schema element of a group; repetition and
+// converted are -1 for none.
+func groupElement(
+	name string, repetition, numChildren, converted int32, logical func(*thriftWriter),
+) parquetSchemaElement {
+	return parquetSchemaElement{
+		name: name, physical: -1, repetition: repetition, numChildren: numChildren,
+		converted: converted, logical: logical,
+	}
+}
+
+// primitiveElement returns the schema element of a leaf of kind.
+func primitiveElement(name string, kind parquetKind, repetition int32) parquetSchemaElement {
+	e := parquetSchemaElement{name: name, repetition: repetition, converted: -1}
+	integer := func(bits int8, signed bool, converted int32) {
+		e.converted = converted
+		e.logical = logicalInt(bits, signed)
+	}
+	switch kind {
+	case kindBool, kindBoolMap:
+		e.physical = parquetBoolean
+	case kindInt8:
+		e.physical = parquetInt32
+		integer(8, true, convertedInt8)
+	case kindInt16:
+		e.physical = parquetInt32
+		integer(16, true, convertedInt16)
+	case kindInt32:
+		e.physical = parquetInt32
+		integer(32, true, convertedInt32)
+	case kindInt64:
+		e.physical = parquetInt64
+		integer(64, true, convertedInt64)
+	case kindUint8:
+		e.physical = parquetInt32
+		integer(8, false, convertedUint8)
+	case kindUint16:
+		e.physical = parquetInt32
+		integer(16, false, convertedUint16)
+	case kindUint32:
+		e.physical = parquetInt32
+		integer(32, false, convertedUint32)
+	case kindUint64:
+		e.physical = parquetInt64
+		integer(64, false, convertedUint64)
+	case kindFloat32:
+		e.physical = parquetFloat
+	case kindFloat64, kindFloatMap:
+		e.physical = parquetDouble
+	case kindTime:
+		e.physical = parquetInt64
+		e.logical = logicalTimestampNanos
+	default: // strings, and the strings of string maps and lists
+		e.physical = parquetByteArray
+		e.converted = convertedUTF8
+		e.logical = logicalString
+	}
+	return e
+}
+
+// Logical type annotations (LogicalType union members).
+func logicalString(w *thriftWriter) { w.emptyStruct(1) }
+func logicalMap(w *thriftWriter)    { w.emptyStruct(2) }
+func logicalList(w *thriftWriter)   { w.emptyStruct(3) }
+
+func logicalTimestampNanos(w *thriftWriter) {
+	w.beginStruct(8)
+	w.boolean(1, true) // isAdjustedToUTC
+	w.beginStruct(2)   // unit
+	w.emptyStruct(3)   // NANOS
+	w.endStruct()
+	w.endStruct()
+}
+
+func logicalInt(bits int8, signed bool) func(*thriftWriter) {
+	return func(w *thriftWriter) {
+		w.beginStruct(10)
+		w.byteField(1, bits)
+		w.boolean(2, signed)
+		w.endStruct()
+	}
+}
+
+// writeTo writes the file: magic, one data page per leaf, and the footer.
+func (f *parquetFile) writeTo(out io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString(parquetMagic)
+
+	root := groupElement("schema", -1, int32(len(f.columns)), -1, nil) //nolint:gosec // G115: a table has few columns
+	schema := []parquetSchemaElement{root}
+	var chunks []parquetChunk
+	for _, c := range f.columns {
+		if c.kind == kindUnknown {
+			c.setKind(kindString) // all NULL
+		}
+		schema = append(schema, c.elements...)
+		for _, l := range c.leaves {
+			offset := int64(buf.Len())
+			if err := l.writePage(&buf); err != nil {
+				return fmt.Errorf("column %s: %w", c.name, err)
+			}
+			chunks = append(chunks, parquetChunk{leaf: l, offset: offset, size: int64(buf.Len()) - offset})
+		}
+	}
+
+	var footer thriftWriter
+	f.writeMetadata(&footer, schema, chunks)
+	buf.Write(footer.buf.Bytes())
+	writeLE(&buf, uint32(footer.buf.Len())) //nolint:gosec // G115: the footer is small
+	buf.WriteString(parquetMagic)
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// parquetChunk locates a leaf's column chunk in the file.
+type parquetChunk struct {
+	leaf   *parquetLeaf
+	offset int64
+	size   int64
+}
+
+// writePage writes the leaf's data page: the page header, then repetition
+// and definition levels and the values.
+func (l *parquetLeaf) writePage(buf *bytes.Buffer) error {
+	var data bytes.Buffer
+	if l.maxRep > 0 {
+		writeLevels(&data, l.repLevels, l.maxRep)
+	}
+	writeLevels(&data, l.defLevels, l.maxDef)
+	if l.physical == parquetBoolean {
+		packed := make([]byte, (len(l.bools)+7)/8)
+		for i, b := range l.bools {
+			if b {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		data.Write(packed)
+	} else {
+		data.Write(l.values.Bytes())
+	}
+	if data.Len() > math.MaxInt32 {
+		return errors.New("page exceeds 2 GiB")
+	}
+
+	var header thriftWriter
+	header.begin()
+	header.i32(1, 0) // DATA_PAGE
+	header.i32(2, int32(data.Len()))
+	header.i32(3, int32(data.Len()))
+	// data_page_header: num_values counts level entries, NULLs included.
+	header.beginStruct(5)
+	header.i32(1, int32(len(l.defLevels))) //nolint:gosec // G115: bounded by the page size
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRLE)
+	header.i32(4, parquetRLE)
+	header.endStruct()
+	header.end()
+
+	buf.Write(header.buf.Bytes())
+	buf.Write(data.Bytes())
+	return nil
+}
+
+// writeLevels writes levels in the RLE/bit-packed hybrid encoding, as RLE
+// runs, prefixed with their length as version 1 data pages expect.
+func writeLevels(buf *bytes.Buffer, levels []int32, maxLevel int32) {
+	var runs bytes.Buffer
+	width := (bitLen(maxLevel) + 7) / 8
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		writeUvarint(&runs, uint64(j-i)<<1)
+		for b := range width {
+			runs.WriteByte(byte(levels[i] >> (8 * b)))
+		}
+		i = j
+	}
+	writeLE(buf, uint32(runs.Len())) //nolint:gosec // G115: bounded by the page size
+	buf.Write(runs.Bytes())
+}
+
+func bitLen(v int32) int {
+	n := 0
+	for ; v > 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+// writeMetadata encodes the FileMetaData footer.
+func (f *parquetFile) writeMetadata(w *thriftWriter, schema []parquetSchemaElement, chunks []parquetChunk) {
+	w.begin()
+	w.i32(1, 1) // version
+	w.listBegin(2, thriftStruct, len(schema))
+	for _, e := range schema {
+		w.begin()
+		if e.physical >= 0 {
+			w.i32(1, e.physical)
+		}
+		if e.repetition >= 0 {
+			w.i32(3, e.repetition)
+		}
+		w.binary(4, e.name)
+		if e.numChildren > 0 {
+			w.i32(5, e.numChildren)
+		}
+		if e.converted >= 0 {
+			w.i32(6, e.converted)
+		}
+		if e.logical != nil {
+			w.beginStruct(10)
+			e.logical(w)
+			w.endStruct()
+		}
+		w.end()
+	}
+	w.i64(3, int64(f.rows))
+
+	var total int64
+	for _, c := range chunks {
+		total += c.size
+	}
+	w.listBegin(4, thriftStruct, 1) // row_groups
+	w.begin()
+	w.listBegin(1, thriftStruct, len(chunks))
+	for _, c := range chunks {
+		w.begin()
+		w.i64(2, c.offset) // file_offset
+		w.beginStruct(3)   // meta_data
+		w.i32(1, c.leaf.physical)
+		w.listBegin(2, thriftI32, 2)
+		w.listI32(parquetPlain)
+		w.listI32(parquetRLE)
+		w.listBegin(3, thriftBinary, len(c.leaf.path))
+		for _, p := range c.leaf.path {
+			w.listBinary(p)
+		}
+		w.i32(4, 0) // UNCOMPRESSED
+		w.i64(5, int64(len(c.leaf.defLevels)))
+		w.i64(6, c.size)
+		w.i64(7, c.size)
+		w.i64(9, c.offset) // data_page_offset
+		w.endStruct()
+		w.end()
+	}
+	w.i64(2, total)
+	w.i64(3, int64(f.rows))
+	w.end()
+	w.binary(6, "xk6-output-clickhouse") // created_by
+	w.end()
+}
+
+// Thrift compact protocol types.
+const (
+	thriftTrue   byte = 1
+	thriftFalse  byte = 2
+	thriftByte   byte = 3
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// thriftWriter encodes structs in Thrift's compact protocol. Fields must be
+// written in increasing id order within a struct.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // id of the last field written, per open struct
+}
+
+// begin opens a struct that is a list element or the top-level value.
+func (w *thriftWriter) begin() { w.last = append(w.last, 0) }
+
+// end closes the struct opened last.
+func (w *thriftWriter) end() {
+	w.buf.WriteByte(0) // STOP
+	w.last = w.last[:len(w.last)-1]
+}
+
+// beginStruct opens a struct field.
+func (w *thriftWriter) beginStruct(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+func (w *thriftWriter) endStruct() { w.end() }
+
+// emptyStruct writes a struct field without fields.
+func (w *thriftWriter) emptyStruct(id int16) {
+	w.beginStruct(id)
+	w.endStruct()
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		writeUvarint(&w.buf, zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	writeUvarint(&w.buf, zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	writeUvarint(&w.buf, zigzag(v))
+}
+
+func (w *thriftWriter) byteField(id int16, v int8) {
+	w.field(id, thriftByte)
+	w.buf.WriteByte(byte(v))
+}
+
+func (w *thriftWriter) boolean(id int16, v bool) {
+	if v {
+		w.field(id, thriftTrue)
+	} else {
+		w.field(id, thriftFalse)
+	}
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.listBinary(s)
+}
+
+// listBegin writes the header of a list field of n elements of typ.
+func (w *thriftWriter) listBegin(id int16, typ byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | typ)
+		return
+	}
+	w.buf.WriteByte(0xf0 | typ)
+	writeUvarint(&w.buf, uint64(n))
+}
+
+func (w *thriftWriter) listI32(v int32) { writeUvarint(&w.buf, zigzag(int64(v))) }
+
+func (w *thriftWriter) listBinary(s string) {
+	writeUvarint(&w.buf, uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func zigzag(v int64) uint64 { return uint64(v<<1) ^ uint64(v>>63) } //nolint:gosec // G115: zigzag encoding
+
+func writeUvarint(b *bytes.Buffer, v uint64) {
+	b.Write(binary.AppendUvarint(nil, v))
+}
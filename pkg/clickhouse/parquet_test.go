@@ -0,0 +1,233 @@
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// thriftReader decodes Thrift compact structs into maps keyed by field id,
+// enough to check the footer and page headers the writer produces.
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1) //nolint:gosec // zigzag decoding
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case thriftByte:
+		r.pos++
+		return int64(int8(r.b[r.pos-1]))
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint()) //nolint:gosec // test data
+		r.pos += n
+		return string(r.b[r.pos-n : r.pos])
+	case thriftList:
+		header := r.b[r.pos]
+		r.pos++
+		n, elem := int(header>>4), header&0x0f
+		if n == 15 {
+			n = int(r.uvarint()) //nolint:gosec // test data
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(elem)
+		}
+		return list
+	case thriftStruct:
+		return r.readStruct()
+	default:
+		panic("unexpected thrift type")
+	}
+}
+
+func (r *thriftReader) readStruct() map[int16]any {
+	fields := map[int16]any{}
+	var last int16
+	for {
+		header := r.b[r.pos]
+		r.pos++
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(header & 0x0f)
+		last = id
+	}
+}
+
+// readParquetFooter checks the magic numbers and decodes the FileMetaData.
+func readParquetFooter(t *testing.T, data []byte) map[int16]any {
+	t.Helper()
+	require.Greater(t, len(data), 12)
+	require.Equal(t, parquetMagic, string(data[:4]))
+	require.Equal(t, parquetMagic, string(data[len(data)-4:]))
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	r := &thriftReader{b: data[len(data)-8-size : len(data)-8]}
+	footer := r.readStruct()
+	require.Equal(t, size, r.pos)
+	return footer
+}
+
+// parquetSchemaNames returns the names of the footer's schema elements.
+func parquetSchemaNames(footer map[int16]any) []string {
+	var names []string
+	for _, e := range footer[2].([]any) {
+		names = append(names, e.(map[int16]any)[4].(string))
+	}
+	return names
+}
+
+// parquetChunkPage returns the definition levels and the PLAIN values of
+// the chunk's data page, leaf i of the first row group.
+func parquetChunkPage(t *testing.T, data []byte, footer map[int16]any, i int) ([]int32, []byte) {
+	t.Helper()
+	group := footer[4].([]any)[0].(map[int16]any)
+	meta := group[1].([]any)[i].(map[int16]any)[3].(map[int16]any)
+	r := &thriftReader{b: data, pos: int(meta[9].(int64))}
+	header := r.readStruct()
+	page := data[r.pos : r.pos+int(header[2].(int64))]
+	entries := int(header[5].(map[int16]any)[1].(int64))
+
+	if len(meta[3].([]any)) > 1 { // nested: skip the repetition levels
+		page = page[4+binary.LittleEndian.Uint32(page):]
+	}
+	n := binary.LittleEndian.Uint32(page)
+	runs := &thriftReader{b: page[4 : 4+n]}
+	var levels []int32
+	for runs.pos < len(runs.b) {
+		count := int(runs.uvarint() >> 1) //nolint:gosec // test data
+		level := int32(runs.b[runs.pos])
+		runs.pos++
+		for range count {
+			levels = append(levels, level)
+		}
+	}
+	require.Len(t, levels, entries)
+	return levels, page[4+n:]
+}
+
+// parquetStrings decodes PLAIN BYTE_ARRAY values.
+func parquetStrings(values []byte) []string {
+	var out []string
+	for len(values) > 0 {
+		n := binary.LittleEndian.Uint32(values)
+		out = append(out, string(values[4:4+n]))
+		values = values[4+n:]
+	}
+	return out
+}
+
+func TestParquetFile(t *testing.T) {
+	t.Parallel()
+
+	f := newParquetFile([]string{"name", "count", "labels", "tags"}, map[string]bool{"tags": true})
+	require.NoError(t, f.appendRow([]any{"a", nil, []string{"x", "y"}, map[string]string{"k": "v"}}))
+	require.NoError(t, f.appendRow([]any{nil, int64(7), []string{}, nil}))
+	require.NoError(t, f.appendRow([]any{"c", int64(-1), nil, map[string]string{}}))
+	assert.ErrorContains(t, f.appendRow([]any{"d", "7", nil, nil}), "column count: string value after values of another type")
+	assert.ErrorContains(t, f.appendRow([]any{"d"}), "1 values for 4 columns")
+
+	var buf bytes.Buffer
+	require.NoError(t, f.writeTo(&buf))
+	data := buf.Bytes()
+	footer := readParquetFooter(t, data)
+
+	assert.Equal(t, int64(3), footer[3], "num_rows")
+	assert.Equal(t, []string{"schema", "name", "count", "labels", "list", "element", "tags"}, parquetSchemaNames(footer))
+
+	levels, values := parquetChunkPage(t, data, footer, 0)
+	assert.Equal(t, []int32{1, 0, 1}, levels)
+	assert.Equal(t, []string{"a", "c"}, parquetStrings(values))
+
+	levels, values = parquetChunkPage(t, data, footer, 1)
+	assert.Equal(t, []int32{0, 1, 1}, levels, "a NULL before the first value")
+	require.Len(t, values, 16)
+	assert.Equal(t, int64(7), int64(binary.LittleEndian.Uint64(values)))      //nolint:gosec // test data
+	assert.Equal(t, int64(-1), int64(binary.LittleEndian.Uint64(values[8:]))) //nolint:gosec // test data
+
+	levels, values = parquetChunkPage(t, data, footer, 2)
+	assert.Equal(t, []int32{2, 2, 1, 0}, levels, "two elements, an empty list, NULL")
+	assert.Equal(t, []string{"x", "y"}, parquetStrings(values))
+
+	levels, values = parquetChunkPage(t, data, footer, 3)
+	assert.Equal(t, []int32{1, 0, 1}, levels)
+	assert.Equal(t, []string{`{"k":"v"}`, `{}`}, parquetStrings(values), "JSON columns hold encoded maps")
+}
+
+func TestOutput_ExportParquet(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval":  "1h",
+		"retryAttempts": 0,
+		"exportDir":     dir,
+		"exportFormat":  "parquet",
+	})
+
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	require.NoError(t, o.Stop())
+
+	files, err := filepath.Glob(filepath.Join(dir, "k6.samples.*.parquet"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0]) // #nosec G304 - test temp dir
+	require.NoError(t, err)
+
+	footer := readParquetFooter(t, data)
+	assert.Equal(t, int64(2), footer[3], "num_rows")
+	assert.Equal(t, []string{"schema", "timestamp", "metric", "value", "tags", "key_value", "key", "value"},
+		parquetSchemaNames(footer))
+
+	_, values := parquetChunkPage(t, data, footer, 1)
+	assert.Equal(t, []string{"http_reqs", "http_reqs"}, parquetStrings(values))
+	_, values = parquetChunkPage(t, data, footer, 2)
+	require.Len(t, values, 16)
+	assert.InDelta(t, 1.0, math.Float64frombits(binary.LittleEndian.Uint64(values)), 0)
+	levels, values := parquetChunkPage(t, data, footer, 3)
+	assert.Equal(t, []int32{2, 2}, levels)
+	assert.Equal(t, []string{"status", "status"}, parquetStrings(values))
+
+	assert.Equal(t, uint64(2), o.GetErrorMetrics().ExportedSamples)
+}
+
+func TestConfig_ValidateExportFormat(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.ExportFormat = ExportFormatParquet
+	require.NoError(t, cfg.Validate())
+
+	cfg.ExportFormat = "orc"
+	assert.ErrorContains(t, cfg.Validate(), "invalid exportFormat: orc")
+}
@@ -0,0 +1,83 @@
+package clickhouse
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// networkReceiveBytes is the server's profile event for the bytes it read
+// from the client's socket: the batch as sent, compressed when the driver
+// compresses it.
+const networkReceiveBytes = "NetworkReceiveBytes"
+
+// estimateRowBytes approximates the size of row in ClickHouse's native
+// format, before compression: fixed-width values take their width, strings
+// their length plus a length prefix, maps and arrays their elements plus an
+// offset. Values of other types count as 8 bytes.
+func estimateRowBytes(row []any) int {
+	n := 0
+	for _, v := range row {
+		n += estimateValueBytes(v)
+	}
+	return n
+}
+
+func estimateValueBytes(v any) int {
+	switch v := v.(type) {
+	case nil, bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case string:
+		return stringBytes(v)
+	case *string:
+		if v == nil {
+			return 1
+		}
+		return 1 + stringBytes(*v)
+	case time.Time:
+		return 8
+	case map[string]string:
+		n := 8 // offset
+		for k, val := range v {
+			n += stringBytes(k) + stringBytes(val)
+		}
+		return n
+	case []string:
+		n := 8 // offset
+		for _, s := range v {
+			n += stringBytes(s)
+		}
+		return n
+	default:
+		return 8
+	}
+}
+
+// stringBytes is the size of s with its varint length prefix.
+func stringBytes(s string) int {
+	n := len(s) + 1
+	for l := len(s) >> 7; l > 0; l >>= 7 {
+		n++
+	}
+	return n
+}
+
+// withWireBytes asks the driver for the profile events the server sends at
+// the end of the INSERT in ctx, and returns the counter they add the
+// batch's NetworkReceiveBytes to. It stays 0 when the server reports none.
+func withWireBytes(ctx context.Context) (context.Context, *atomic.Int64) {
+	wire := new(atomic.Int64)
+	return clickhouse.Context(ctx, clickhouse.WithProfileEvents(func(events []clickhouse.ProfileEvent) {
+		for _, e := range events {
+			if e.Name == networkReceiveBytes && e.Type == "increment" {
+				wire.Add(e.Value)
+			}
+		}
+	})), wire
+}
@@ -0,0 +1,52 @@
+package clickhouse
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateRowBytes(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 200)
+	for _, tt := range []struct {
+		row   []any
+		bytes int
+	}{
+		{row: []any{time.Now(), 1.5, uint64(7)}, bytes: 24},
+		{row: []any{"GET", true, int8(1)}, bytes: 4 + 1 + 1},
+		{row: []any{long}, bytes: 200 + 2},
+		{row: []any{map[string]string{"status": "200"}}, bytes: 8 + 7 + 4},
+		{row: []any{[]string{"a", "bc"}, nil}, bytes: 8 + 2 + 3 + 1},
+	} {
+		assert.Equal(t, tt.bytes, estimateRowBytes(tt.row), "%v", tt.row)
+	}
+}
+
+func TestOutput_PayloadBytes(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, insertConfig())
+	addStatusSamples(o, 3, 0)
+	o.flush()
+
+	rows := fake.Rows()
+	want := 0
+	for _, row := range rows {
+		want += estimateRowBytes(row)
+	}
+	stats := o.GetErrorMetrics()
+	assert.Positive(t, want)
+	assert.Equal(t, uint64(want), stats.PayloadBytes)
+	assert.Zero(t, stats.WireBytes, "the fake server reports no profile events")
+
+	// A failed batch adds nothing
+	fake.set(func(f *fakeDB) { f.commitErr = &clickhouse.Exception{Code: 242, Name: "TABLE_IS_READ_ONLY"} })
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	assert.Equal(t, uint64(want), o.GetErrorMetrics().PayloadBytes)
+}
@@ -0,0 +1,77 @@
+package clickhouse
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// pendingRows queues the rows of an auxiliary table, such as the events or
+// audit table, until a flush writes them. Beyond limit (none when 0) the
+// oldest rows are dropped.
+type pendingRows[T any] struct {
+	mu    sync.Mutex
+	limit int
+	rows  []T
+}
+
+// add queues rows and reports how many old rows were dropped to stay within
+// the limit.
+func (p *pendingRows[T]) add(rows ...T) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rows = append(p.rows, rows...)
+	return p.trim()
+}
+
+// take returns and clears the rows not yet written.
+func (p *pendingRows[T]) take() []T {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rows := p.rows
+	p.rows = nil
+	return rows
+}
+
+// requeue puts rows back, ahead of those queued since, after a failed write
+// so the next flush retries them. It reports how many old rows were dropped
+// to stay within the limit.
+func (p *pendingRows[T]) requeue(rows []T) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rows = append(rows, p.rows...)
+	return p.trim()
+}
+
+// trim drops the oldest rows beyond the limit; p.mu must be held.
+func (p *pendingRows[T]) trim() int {
+	dropped := len(p.rows) - p.limit
+	if p.limit <= 0 || dropped <= 0 {
+		return 0
+	}
+	p.rows = p.rows[dropped:]
+	return dropped
+}
+
+// flushPendingRows writes the rows queued in pending to table with write.
+// Failures are logged, naming the rows by kind, and the rows retried on the
+// next flush; they never fail the samples.
+func flushPendingRows[T any](o *Output, pending *pendingRows[T], table, kind string, write func([]T) error) {
+	rows := pending.take()
+	if len(rows) == 0 {
+		return
+	}
+
+	if err := write(rows); err != nil {
+		logger := o.logger.WithError(err).WithField("table", table)
+		if dropped := pending.requeue(rows); dropped > 0 {
+			logger = logger.WithField("droppedRows", dropped)
+		}
+		logger.Warn("Failed to write " + kind + " rows, will retry")
+		return
+	}
+	o.logger.WithFields(logrus.Fields{"table": table, "rows": len(rows)}).Debug("Wrote " + kind + " rows")
+}
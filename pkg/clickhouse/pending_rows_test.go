@@ -0,0 +1,45 @@
+package clickhouse
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingRows(t *testing.T) {
+	t.Parallel()
+
+	p := pendingRows[int]{limit: 3}
+	assert.Zero(t, p.add(1, 2))
+	assert.Equal(t, 1, p.add(3, 4), "the oldest row is dropped")
+	assert.Equal(t, []int{2, 3, 4}, p.take())
+	assert.Nil(t, p.take())
+
+	p.add(5)
+	assert.Equal(t, 1, p.requeue([]int{2, 3, 4}))
+	assert.Equal(t, []int{3, 4, 5}, p.take(), "requeued rows go first")
+
+	unbounded := pendingRows[int]{}
+	assert.Zero(t, unbounded.add(make([]int, 100)...))
+	assert.Len(t, unbounded.take(), 100)
+}
+
+func TestFlushPendingRows(t *testing.T) {
+	t.Parallel()
+
+	o := &Output{logger: newTestLogger(t)}
+	p := &pendingRows[int]{limit: 2}
+	p.add(1, 2)
+
+	var written []int
+	flushPendingRows(o, p, "rows", "test", func([]int) error { return errors.New("connection refused") })
+	p.add(3)
+	flushPendingRows(o, p, "rows", "test", func(rows []int) error {
+		written = rows
+		return nil
+	})
+	require.Equal(t, []int{2, 3}, written, "failed rows are retried within the limit")
+	assert.Nil(t, p.take())
+}
@@ -0,0 +1,57 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// probeInsert checks at Start that the user may INSERT into t's table, so a
+// missing grant fails the run up front instead of every flush mid-test. The
+// probe opens the insert batch — the server checks access, and the insert
+// settings, when it receives the INSERT header — and discards it without
+// sending rows.
+func (o *Output) probeInsert(ctx context.Context, db *sql.DB, t *schemaTarget) error {
+	batch, err := prepareInsert(o.config.insertContext(ctx), db, nil, t.insertQuery)
+	if err != nil {
+		return o.permissionError(err, "INSERT", t.table)
+	}
+	batch.abort()
+	return nil
+}
+
+// permissionError turns a denied statement into an actionable error naming
+// the grant to add. Other errors are returned with context only.
+func (o *Output) permissionError(err error, privilege, table string) error {
+	object := o.config.Database + "." + table
+	switch classifyError(err) {
+	case errClassAuth:
+		// With a role configured, that is where the grant belongs
+		grantee := o.config.User
+		if o.config.Role != "" {
+			grantee = o.config.Role
+		}
+		return fmt.Errorf("user %q is missing GRANT %s ON %s (run: GRANT %s ON %s TO %s): %w",
+			o.config.User, privilege, object, privilege, object, grantee, err)
+	case errClassSchema:
+		return fmt.Errorf("table %s does not exist or does not match the schema "+
+			"(create it, or enable createTable so the output creates it): %w", object, err)
+	default:
+		return fmt.Errorf("%s probe on %s failed: %w", privilege, object, err)
+	}
+}
+
+// schemaCreationError adds the user and the remedies to a denied CREATE of
+// the database (table "") or a table. The server message names the missing
+// privilege.
+func (o *Output) schemaCreationError(err error, table string) error {
+	if classifyError(err) != errClassAuth {
+		return err
+	}
+	if table == "" {
+		return fmt.Errorf("user %q may not create database %s (grant the privilege named below, "+
+			"or create the database yourself and set createDatabase=false): %w", o.config.User, o.config.Database, err)
+	}
+	return fmt.Errorf("user %q may not create %s.%s (grant the privilege named below, "+
+		"or create the table yourself and set createTable=false): %w", o.config.User, o.config.Database, table, err)
+}
@@ -0,0 +1,83 @@
+package clickhouse
+
+import (
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestStart_PermissionProbe(t *testing.T) {
+	t.Parallel()
+
+	denied := &clickhouse.Exception{Code: 497, Name: "ACCESS_DENIED", Message: "loader: Not enough privileges"}
+
+	tests := []struct {
+		name    string
+		config  map[string]any
+		inject  func(f *fakeDB)
+		wantErr string
+	}{
+		{
+			name:    "insert allowed",
+			config:  map[string]any{},
+			inject:  func(*fakeDB) {},
+			wantErr: "",
+		},
+		{
+			name:    "insert denied",
+			config:  map[string]any{"user": "loader"},
+			inject:  func(f *fakeDB) { f.prepareErr = denied },
+			wantErr: "user \"loader\" is missing GRANT INSERT ON k6.samples (run: GRANT INSERT ON k6.samples TO loader)",
+		},
+		{
+			name:    "insert denied with role",
+			config:  map[string]any{"user": "loader", "role": "k6_writer"},
+			inject:  func(f *fakeDB) { f.prepareErr = denied },
+			wantErr: "(run: GRANT INSERT ON k6.samples TO k6_writer)",
+		},
+		{
+			name:    "table missing without schema creation",
+			config:  map[string]any{"skipSchemaCreation": true},
+			inject:  func(f *fakeDB) { f.prepareErr = &clickhouse.Exception{Code: 60, Name: "UNKNOWN_TABLE"} },
+			wantErr: "table k6.samples does not exist",
+		},
+		{
+			name:    "create database denied",
+			config:  map[string]any{"user": "loader"},
+			inject:  func(f *fakeDB) { f.ddlErr = denied },
+			wantErr: "user \"loader\" may not create database k6",
+		},
+		{
+			name:    "create table denied",
+			config:  map[string]any{"user": "loader", "createDatabase": false},
+			inject:  func(f *fakeDB) { f.ddlErr = denied },
+			wantErr: "user \"loader\" may not create k6.samples",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, o := newFakeOutput(t, output.Params{JSONConfig: mustMarshalJSON(tt.config)})
+			fake.set(tt.inject)
+
+			err := o.Start()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				assert.Len(t, fake.Prepared(), 1, "one probe per table")
+				fake.set(func(f *fakeDB) {
+					assert.Equal(t, 1, f.aborts, "probe batch discarded")
+					assert.Zero(t, f.commits, "probe sends no rows")
+				})
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+			require.NoError(t, o.Stop())
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package clickhouse
+
+import "go.k6.io/k6/v2/metrics"
+
+// rateColumn holds the outcome of Rate samples with RateBoolColumn.
+const rateColumn = "rate"
+
+// rateColumnDDL returns the definition of the rate column, or "" when
+// disabled.
+func rateColumnDDL(enabled bool) string {
+	if !enabled {
+		return ""
+	}
+	return ",\n\t\t\t" + rateColumn + " Bool DEFAULT false"
+}
+
+// rateValue splits a sample into the value and rate columns: a Rate sample
+// writes 0 and its outcome, any other sample its value and false.
+func rateValue(sample metrics.Sample) (value float64, passed bool) {
+	if sample.Metric != nil && sample.Metric.Type == metrics.Rate {
+		return 0, sample.Value != 0
+	}
+	return sample.Value, false
+}
+
+// storedValueExpr returns the expression reading a row's value as k6 emitted
+// it: with the rate column, Rate rows hold 0 in value and their outcome in
+// rate, and every other row holds false in rate.
+func storedValueExpr(schema SchemaCreator) string {
+	if hasRateColumn(schema) {
+		return "(value + " + rateColumn + ")"
+	}
+	return "value"
+}
+
+// hasRateColumn reports whether schema writes the rate column.
+func hasRateColumn(schema SchemaCreator) bool {
+	switch s := schema.(type) {
+	case SimpleSchema:
+		return s.rateBool
+	case CompatibleSchema:
+		return s.opts.rateBool
+	default:
+		return false
+	}
+}
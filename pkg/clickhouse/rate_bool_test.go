@@ -0,0 +1,77 @@
+package clickhouse
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+func TestRateValue(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	checks := registry.MustNewMetric(metrics.ChecksName, metrics.Rate)
+	duration := registry.MustNewMetric(metrics.HTTPReqDurationName, metrics.Trend)
+
+	for _, tt := range []struct {
+		sample    metrics.Sample
+		value     float64
+		passed    bool
+		condition string
+	}{
+		{sample: metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks}, Value: 1}, passed: true, condition: "passed check"},
+		{sample: metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks}, Value: 0}, condition: "failed check"},
+		{sample: metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration}, Value: 12.5}, value: 12.5, condition: "trend"},
+	} {
+		value, passed := rateValue(tt.sample)
+		assert.InDelta(t, tt.value, value, 0, tt.condition)
+		assert.Equal(t, tt.passed, passed, tt.condition)
+	}
+}
+
+func TestSchemas_RateBoolColumn(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.RateBoolColumn = true
+	for _, configure := range []func(Config) (SchemaImplementation, error){configureSimple, configureCompatible} {
+		impl, err := configure(cfg)
+		require.NoError(t, err)
+
+		fake, db := newFakeDB(t)
+		require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		assert.Regexp(t, `rate\s+Bool DEFAULT false`, fake.DDL()[1], impl.Name)
+		assert.Equal(t, "(value + rate)", storedValueExpr(impl.Schema), impl.Name)
+	}
+	assert.Equal(t, "value", storedValueExpr(SimpleSchema{}))
+}
+
+func TestOutput_RateBoolColumn(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []string{"simple", "compatible"} {
+		fake, o := startFakeOutput(t, map[string]any{"schemaMode": mode, "rateBoolColumn": true, "pushInterval": "1h"})
+
+		registry := metrics.NewRegistry()
+		now := time.Now()
+		o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+			{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(metrics.ChecksName, metrics.Rate)}, Time: now, Value: 1},
+			{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(metrics.HTTPReqDurationName, metrics.Trend)}, Time: now, Value: 12.5},
+		}})
+		o.flush()
+		require.NoError(t, o.Stop())
+
+		rate := slices.Index(o.targets[0].columns, rateColumn)
+		require.Positive(t, rate, mode)
+		value := slices.Index(o.targets[0].columns, "value")
+		rows := fake.Rows()
+		require.Len(t, rows, 2, mode)
+		assert.Equal(t, []any{0.0, true}, []any{rows[0][value], rows[0][rate]}, mode)
+		assert.Equal(t, []any{12.5, false}, []any{rows[1][value], rows[1][rate]}, mode)
+	}
+}
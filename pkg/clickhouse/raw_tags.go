@@ -0,0 +1,28 @@
+package clickhouse
+
+import (
+	"fmt"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// rawTagsColumn holds the complete tag set of compatible rows with
+// KeepRawTags.
+const rawTagsColumn = "raw_tags"
+
+// rawTagsValue returns the raw_tags value of sample: its tags before
+// extraction, encoded like extra_tags.
+func (o compatibleOptions) rawTagsValue(sample metrics.Sample) (any, error) {
+	tags := map[string]string{}
+	if sample.Tags != nil {
+		tags = sample.Tags.Map()
+	}
+	if o.tagStorage != TagStorageString {
+		return tags, nil
+	}
+	encoded, err := encodeTags(tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", rawTagsColumn, err)
+	}
+	return encoded, nil
+}
@@ -0,0 +1,101 @@
+package clickhouse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestCompatibleSchema_KeepRawTags(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	sample := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: registry.MustNewMetric("http_req_duration", metrics.Trend),
+			Tags: registry.RootTagSet().WithTagsFromMap(map[string]string{
+				"testid":    "run-1",
+				"method":    "GET",
+				"user_tier": "gold",
+			}),
+		},
+		Time:  time.Now(),
+		Value: 1.0,
+	}
+
+	t.Run("ddl and row", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := NewConfig()
+		cfg.KeepRawTags = true
+		impl, err := configureCompatible(cfg)
+		require.NoError(t, err)
+
+		fake, db := newFakeDB(t)
+		require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		assert.Contains(t, fake.DDL()[1], "raw_tags          Map(LowCardinality(String), String) DEFAULT map()")
+		assert.Contains(t, impl.Schema.InsertQuery("k6", "samples"), "extra_tags, raw_tags")
+		assert.NotContains(t, impl.Schema.(CompatibleSchema).opts.identityColumns(), rawTagsColumn)
+
+		row, err := impl.Converter.Convert(context.Background(), sample)
+		require.NoError(t, err)
+		require.Len(t, row, compatibleColumnCount+1)
+		assert.Equal(t, "GET", row[11])
+		assert.Equal(t, map[string]string{"user_tier": "gold"}, row[20])
+		assert.Equal(t, map[string]string{"testid": "run-1", "method": "GET", "user_tier": "gold"}, row[21])
+		impl.Converter.Release(row)
+	})
+
+	t.Run("string storage", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := NewConfig()
+		cfg.KeepRawTags = true
+		cfg.TagStorage = TagStorageString
+		impl, err := configureCompatible(cfg)
+		require.NoError(t, err)
+
+		fake, db := newFakeDB(t)
+		require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		assert.Contains(t, fake.DDL()[1], "raw_tags          String DEFAULT '{}'")
+
+		row, err := impl.Converter.Convert(context.Background(), sample)
+		require.NoError(t, err)
+		assert.Equal(t, `{"method":"GET","testid":"run-1","user_tier":"gold"}`, row[21])
+		impl.Converter.Release(row)
+	})
+
+	t.Run("sample without tags", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := NewConfig()
+		cfg.KeepRawTags = true
+		impl, err := configureCompatible(cfg)
+		require.NoError(t, err)
+
+		row, err := impl.Converter.Convert(context.Background(), metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: sample.Metric},
+			Time:       time.Now(),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{}, row[21])
+		impl.Converter.Release(row)
+	})
+}
+
+func TestParseConfig_KeepRawTags(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?keepRawTags=true"})
+	require.NoError(t, err)
+	assert.True(t, cfg.KeepRawTags)
+	assert.False(t, NewConfig().KeepRawTags)
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?keepRawTags=maybe"})
+	require.ErrorContains(t, err, "invalid keepRawTags URL parameter value")
+}
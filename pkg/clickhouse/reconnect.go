@@ -0,0 +1,208 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// Reconnecting after the driver reports a closed connection.
+//
+// A server restart or a proxy dropping idle sockets can leave a handle with
+// nothing but dead connections: the one parked for the next batch (see
+// connSlot) and the pool's idle ones. When an insert fails this way, the
+// handle of its shard is marked, and before the next insert on that shard
+// the parked connections are dropped, the handle is replaced with a freshly
+// opened one and pinged, and the insert is prepared on a new connection. A
+// handle injected with WithDB belongs to the embedder: it is only pinged.
+//
+// Flush cycles that began before the replacement may still hold the old
+// handle, so it only stops keeping idle connections at first, and is closed
+// when the last of them ends (see releaseHandles), or at Stop. Targets are never
+// changed in place; those of the shard are replaced with copies holding the
+// new handle.
+
+// isConnClosedError reports whether err means the connection under an
+// insert was closed or broken, rather than refused or answered with a
+// server error.
+func isConnClosedError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, target := range []error{
+		driver.ErrBadConn, sql.ErrConnDone, clickhouse.ErrConnectionClosed,
+		net.ErrClosed, io.EOF, io.ErrUnexpectedEOF,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	errMsg := strings.ToLower(err.Error())
+	for _, pattern := range []string{"connection is closed", "closed connection", "broken pipe", "connection reset"} {
+		if strings.Contains(errMsg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// markBroken records that an insert on shard lost its connection; the
+// handle is replaced before the next insert (see reconnect).
+func (o *Output) markBroken(shard int) {
+	o.reconnectMu.Lock()
+	defer o.reconnectMu.Unlock()
+	if o.brokenShards == nil {
+		o.brokenShards = map[int]bool{}
+	}
+	o.brokenShards[shard] = true
+}
+
+// reconnect replaces the handle of shard if markBroken was called for it.
+// On failure the shard stays marked, and the next insert tries again.
+func (o *Output) reconnect(ctx context.Context, shard int) error {
+	o.reconnectMu.Lock()
+	defer o.reconnectMu.Unlock()
+	if !o.brokenShards[shard] {
+		return nil
+	}
+
+	o.mu.RLock()
+	old, addr, targets := o.db, o.config.Addr, o.targets
+	if shard > 0 {
+		old, addr = o.shards[shard-1], o.config.ShardAddrs[shard-1]
+	}
+	o.mu.RUnlock()
+
+	for _, t := range targets {
+		if t.shard == shard {
+			t.conns.discard()
+		}
+	}
+
+	db := old
+	if old != o.externalDB {
+		var err error
+		if db, err = o.openAddr(addr); err != nil {
+			return err
+		}
+	}
+	if err := db.PingContext(ctx); err != nil {
+		if db != old {
+			_ = db.Close()
+		}
+		return fmt.Errorf("failed to reconnect to clickhouse at %s: %w", addr, err)
+	}
+
+	if db != old {
+		o.mu.Lock()
+		if shard == 0 {
+			o.db = db
+		} else {
+			o.shards[shard-1] = db
+		}
+		o.targets = withShardHandles(o.targets, o.shards)
+		o.retire(old)
+		o.mu.Unlock()
+		old.SetMaxIdleConns(0) // drops its dead idle connections
+	}
+
+	delete(o.brokenShards, shard)
+	o.reconnects.Add(1)
+	o.logger.WithFields(logrus.Fields{"addr": addr, "reopened": db != old}).
+		Warn("Reconnected to ClickHouse after the connection was closed")
+	return nil
+}
+
+// retiredDB is a replaced handle and the last flush cycle that may hold it.
+type retiredDB struct {
+	db       *sql.DB
+	lastSeen uint64
+}
+
+// holdHandles registers a flush cycle before it reads any handle and returns
+// its sequence number, to pass to releaseHandles.
+func (o *Output) holdHandles() uint64 {
+	o.flightMu.Lock()
+	defer o.flightMu.Unlock()
+	o.flightSeq++
+	if o.inFlight == nil {
+		o.inFlight = map[uint64]struct{}{}
+	}
+	o.inFlight[o.flightSeq] = struct{}{}
+	return o.flightSeq
+}
+
+// releaseHandles ends the flush cycle seq and closes the retired handles no
+// flush cycle in flight began early enough to hold.
+func (o *Output) releaseHandles(seq uint64) {
+	o.flightMu.Lock()
+	delete(o.inFlight, seq)
+	oldest := o.flightSeq + 1
+	for s := range o.inFlight {
+		oldest = min(oldest, s)
+	}
+	var closable []*sql.DB
+	kept := o.retiredDBs[:0]
+	for _, r := range o.retiredDBs {
+		if r.lastSeen < oldest {
+			closable = append(closable, r.db)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	o.retiredDBs = kept
+	o.flightMu.Unlock()
+
+	for _, db := range closable {
+		_ = db.Close()
+	}
+}
+
+// retire queues a replaced handle to be closed once the flush cycles begun
+// so far have ended. The caller holds mu, having swapped the handle, so
+// cycles begun later read the new one.
+func (o *Output) retire(db *sql.DB) {
+	o.flightMu.Lock()
+	defer o.flightMu.Unlock()
+	o.retiredDBs = append(o.retiredDBs, retiredDB{db: db, lastSeen: o.flightSeq})
+}
+
+// withShardHandles returns targets with each shard target's handle set to
+// the current one in shards. Targets whose handle changes are copied, so
+// flushes holding the previous slice never see a target change.
+func withShardHandles(targets []*schemaTarget, shards []*sql.DB) []*schemaTarget {
+	out, copied := targets, false
+	for i, t := range targets {
+		if t.shard == 0 || t.db == shards[t.shard-1] {
+			continue
+		}
+		if !copied {
+			out, copied = slices.Clone(targets), true
+		}
+		next := *t
+		next.db = shards[t.shard-1]
+		out[i] = &next
+	}
+	return out
+}
+
+// openAddr opens a handle to addr with the connection settings of Addr.
+func (o *Output) openAddr(addr string) (*sql.DB, error) {
+	tlsConfig, err := o.config.TLS.BuildTLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build TLS config: %w", err)
+	}
+	cfg := o.config
+	cfg.Addr = addr
+	return cfg.openDB(tlsConfig, o.dialContext), nil
+}
@@ -0,0 +1,105 @@
+package clickhouse
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsConnClosedError(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		err    error
+		closed bool
+	}{
+		{err: nil},
+		{err: driver.ErrBadConn, closed: true},
+		{err: sql.ErrConnDone, closed: true},
+		{err: fmt.Errorf("failed to prepare batch: %w", clickhouse.ErrConnectionClosed), closed: true},
+		{err: &commitError{err: io.EOF}, closed: true},
+		{err: errors.New("write tcp 10.0.0.1:9000: broken pipe"), closed: true},
+		{err: errors.New("dial tcp: connection refused")},
+		{err: &clickhouse.Exception{Code: 60, Name: "UNKNOWN_TABLE"}},
+	} {
+		assert.Equal(t, tt.closed, isConnClosedError(tt.err), "%v", tt.err)
+	}
+
+	assert.True(t, isRetryableError(driver.ErrBadConn), "a closed connection is retried on a new one")
+}
+
+func TestOutput_ReconnectsAfterClosedConnection(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, insertConfig())
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	require.NotNil(t, o.targets[0].conns.conn, "precondition: a connection is parked")
+
+	// The driver reports the connection closed: the retry reconnects first,
+	// fails the same way, and leaves the handle marked for the next flush
+	closed := fmt.Errorf("failed to prepare batch: %w", clickhouse.ErrConnectionClosed)
+	fake.set(func(f *fakeDB) { f.prepareErr = closed })
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	assert.True(t, o.brokenShards[0])
+	assert.Equal(t, uint64(1), o.GetErrorMetrics().Reconnects)
+
+	// The server is still down: the reconnect fails and is tried again
+	fake.set(func(f *fakeDB) { f.prepareErr, f.pingErr = nil, errors.New("dial tcp: connection refused") })
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	assert.True(t, o.brokenShards[0])
+	assert.Equal(t, uint64(1), o.GetErrorMetrics().Reconnects)
+
+	fake.set(func(f *fakeDB) { f.pingErr = nil })
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	assert.False(t, o.brokenShards[0])
+	assert.Equal(t, uint64(2), o.GetErrorMetrics().Reconnects)
+	assert.Len(t, fake.Rows(), 12, "the buffered batches are written after the reconnect")
+	assert.Same(t, o.externalDB, o.db, "an injected handle is kept")
+}
+
+func TestWithShardHandles(t *testing.T) {
+	t.Parallel()
+
+	_, old := newFakeDB(t)
+	_, reopened := newFakeDB(t)
+	unsharded := &schemaTarget{table: "samples"}
+	shard := &schemaTarget{table: "samples", shard: 1, db: old}
+	targets := []*schemaTarget{unsharded, shard}
+
+	assert.Same(t, shard, withShardHandles(targets, []*sql.DB{old})[1], "an unchanged handle keeps the target")
+
+	got := withShardHandles(targets, []*sql.DB{reopened})
+	assert.Same(t, unsharded, got[0])
+	assert.Same(t, reopened, got[1].db)
+	assert.Same(t, old, shard.db, "targets a flush may hold are not changed")
+	assert.Same(t, shard, targets[1])
+}
+
+func TestOutput_ClosesRetiredHandles(t *testing.T) {
+	t.Parallel()
+
+	o := &Output{}
+	_, old := newFakeDB(t)
+	first := o.holdHandles()
+	o.retire(old)
+	second := o.holdHandles()
+	o.releaseHandles(second)
+	require.NoError(t, old.Ping(), "a flush begun before the replacement may still hold it")
+
+	third := o.holdHandles()
+	o.releaseHandles(first)
+	assert.ErrorContains(t, old.Ping(), "database is closed", "closed once that flush ended")
+	assert.Empty(t, o.retiredDBs)
+	o.releaseHandles(third)
+}
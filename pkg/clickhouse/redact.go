@@ -0,0 +1,69 @@
+package clickhouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+// redactedValue replaces secrets in logged config, as url.URL.Redacted does
+// for passwords.
+const redactedValue = "xxxxx"
+
+// secretArgumentParam matches the value of a config argument parameter that
+// carries a secret.
+var secretArgumentParam = regexp.MustCompile(`(?i)([?&](?:password|webhookURL|tracesEndpoint)=)[^&#]*`)
+
+// redacted returns a copy of c that is safe to log: the password is masked,
+// and so is everything in WebhookURL and TracesEndpoint past the host, where
+// webhook services put their token. TLS.KeyFile is a path, not the key, and
+// is kept.
+func (c Config) redacted() Config {
+	if c.Password != "" {
+		c.Password = redactedValue
+	}
+	c.WebhookURL = redactURL(c.WebhookURL)
+	c.TracesEndpoint = redactURL(c.TracesEndpoint)
+	return c
+}
+
+// String formats the config with its secrets masked, so that logging a
+// Config, with %v or as a logrus field, never leaks credentials.
+func (c Config) String() string {
+	type plain Config // drops the methods, so %+v does not recurse into String
+	return fmt.Sprintf("%+v", plain(c.redacted()))
+}
+
+// MarshalJSON encodes the config with its secrets masked, for the same
+// reason as String.
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	return json.Marshal(plain(c.redacted()))
+}
+
+// redactURL keeps the scheme and host of rawURL and masks the user info,
+// path, and query. A value that does not parse as a URL is masked whole.
+func redactURL(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return redactedValue
+	}
+	masked := &url.URL{Scheme: u.Scheme, Host: u.Host}
+	if u.User != nil {
+		masked.User = url.User(redactedValue)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		masked.Path = "/" + redactedValue
+	}
+	return masked.String()
+}
+
+// redactConfigArgument masks the secret parameters of a config argument
+// quoted in an error.
+func redactConfigArgument(arg string) string {
+	return secretArgumentParam.ReplaceAllString(arg, "${1}"+redactedValue)
+}
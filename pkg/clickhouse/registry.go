@@ -1,6 +1,8 @@
 package clickhouse
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"sort"
 	"sync"
@@ -71,3 +73,162 @@ func availableSchemasLocked() []string {
 	sort.Strings(names)
 	return names
 }
+
+// filterRegistry holds the sample filters selectable with sampleFilters,
+// including the built-in ones (see filter.go).
+var (
+	filterRegistry   = make(map[string]SampleFilter)
+	filterRegistryMu sync.RWMutex
+)
+
+// RegisterSampleFilter registers a sample filter by name, so that it can be
+// enabled from the config with sampleFilters. Call this in init(). Filters
+// that need no name can be passed to NewWithOptions with WithSampleFilters.
+//
+// Example:
+//
+//	func init() {
+//	    clickhouse.RegisterSampleFilter("noHealthChecks", clickhouse.SampleFilterFunc(
+//	        func(s metrics.Sample) bool {
+//	            name, _ := s.Tags.Get("name")
+//	            return !strings.HasSuffix(name, "/healthz")
+//	        },
+//	    ))
+//	}
+func RegisterSampleFilter(name string, filter SampleFilter) {
+	filterRegistryMu.Lock()
+	defer filterRegistryMu.Unlock()
+
+	if name == "" {
+		panic("sample filter name cannot be empty")
+	}
+	if filter == nil {
+		panic(fmt.Sprintf("sample filter %q is nil", name))
+	}
+
+	filterRegistry[name] = filter
+}
+
+// GetSampleFilter returns a registered sample filter by name.
+// Returns an error if the filter is not found.
+func GetSampleFilter(name string) (SampleFilter, error) {
+	filterRegistryMu.RLock()
+	defer filterRegistryMu.RUnlock()
+
+	if filter, ok := filterRegistry[name]; ok {
+		return filter, nil
+	}
+	return nil, fmt.Errorf("unknown sample filter: %q (available: %v)", name, availableSampleFiltersLocked())
+}
+
+// AvailableSampleFilters returns all registered sample filter names in sorted
+// order.
+func AvailableSampleFilters() []string {
+	filterRegistryMu.RLock()
+	defer filterRegistryMu.RUnlock()
+
+	return availableSampleFiltersLocked()
+}
+
+// availableSampleFiltersLocked returns filter names without acquiring lock
+// (caller must hold lock)
+func availableSampleFiltersLocked() []string {
+	names := make([]string, 0, len(filterRegistry))
+	for name := range filterRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// transformerRegistry holds the tag transformers selectable with
+// tagTransformers, including the built-in ones (see tag_transform.go).
+var (
+	transformerRegistry   = make(map[string]TagTransformer)
+	transformerRegistryMu sync.RWMutex
+)
+
+// RegisterTagTransformer registers a tag transformer by name, so that it can
+// be enabled from the config with tagTransformers. Call this in init().
+// Transformers that need no name can be passed to NewWithOptions with
+// WithTagTransformers.
+//
+// Example:
+//
+//	func init() {
+//	    clickhouse.RegisterTagTransformer("tenant", clickhouse.TagTransformerFunc(
+//	        func(s metrics.Sample) *metrics.TagSet {
+//	            url, _ := s.Tags.Get("url")
+//	            return s.Tags.With("tenant", tenantOf(url))
+//	        },
+//	    ))
+//	}
+func RegisterTagTransformer(name string, transformer TagTransformer) {
+	transformerRegistryMu.Lock()
+	defer transformerRegistryMu.Unlock()
+
+	if name == "" {
+		panic("tag transformer name cannot be empty")
+	}
+	if transformer == nil {
+		panic(fmt.Sprintf("tag transformer %q is nil", name))
+	}
+
+	transformerRegistry[name] = transformer
+}
+
+// GetTagTransformer returns a registered tag transformer by name.
+// Returns an error if the transformer is not found.
+func GetTagTransformer(name string) (TagTransformer, error) {
+	transformerRegistryMu.RLock()
+	defer transformerRegistryMu.RUnlock()
+
+	if transformer, ok := transformerRegistry[name]; ok {
+		return transformer, nil
+	}
+	return nil, fmt.Errorf("unknown tag transformer: %q (available: %v)", name, availableTagTransformersLocked())
+}
+
+// AvailableTagTransformers returns all registered tag transformer names in
+// sorted order.
+func AvailableTagTransformers() []string {
+	transformerRegistryMu.RLock()
+	defer transformerRegistryMu.RUnlock()
+
+	return availableTagTransformersLocked()
+}
+
+// availableTagTransformersLocked returns transformer names without acquiring
+// lock (caller must hold lock)
+func availableTagTransformersLocked() []string {
+	names := make([]string, 0, len(transformerRegistry))
+	for name := range transformerRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// createDatabase runs CREATE DATABASE IF NOT EXISTS for database.
+func createDatabase(ctx context.Context, db *sql.DB, database string) error {
+	// Defense-in-depth: Validate identifiers before using them
+	if !isValidIdentifier(database) {
+		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", database)
+	}
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", escapeIdentifier(database)))
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	return nil
+}
+
+// ingestedAtDDL returns the definition of the ingested_at column, appended to
+// the last column of a built-in schema, or "" when disabled. The server fills
+// the column, so it never appears in an INSERT.
+func ingestedAtDDL(enabled bool) string {
+	if !enabled {
+		return ""
+	}
+	return ",\n\t\t\tingested_at DateTime DEFAULT now()"
+}
@@ -0,0 +1,66 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// driverMaxIdleConns is the pool size clickhouse.OpenDB applies when
+// Options.MaxIdleConns is unset; it then allows five more open connections
+// than idle ones.
+const driverMaxIdleConns = 5
+
+// roleConnector activates a role on every connection it opens. SET ROLE
+// lasts for the connection's session, so each pooled connection needs it
+// once, before its first query.
+type roleConnector struct {
+	driver.Connector
+	role string
+}
+
+// Connect opens a connection and runs SET ROLE on it.
+func (c roleConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.New("driver connection cannot execute SET ROLE")
+	}
+	if _, err := execer.ExecContext(ctx, "SET ROLE "+escapeIdentifier(c.role), nil); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to set role %s: %w", c.role, err)
+	}
+	return conn, nil
+}
+
+// openRoleDB opens a pool whose connections activate c.Role. The pool is
+// sized from opts as clickhouse.OpenDB would size it, driver defaults
+// included, so setting a role does not change it.
+func (c Config) openRoleDB(opts *clickhouse.Options) *sql.DB {
+	db := sql.OpenDB(roleConnector{Connector: clickhouse.Connector(opts), role: c.Role})
+	maxIdle := opts.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = driverMaxIdleConns
+	}
+	maxOpen := opts.MaxOpenConns
+	if maxOpen <= 0 {
+		maxOpen = maxIdle + 5
+	}
+	lifetime := opts.ConnMaxLifetime
+	if lifetime == 0 {
+		lifetime = defaultConnMaxLifetime
+	}
+	db.SetMaxIdleConns(maxIdle)
+	db.SetMaxOpenConns(maxOpen)
+	db.SetConnMaxLifetime(lifetime)
+	return db
+}
@@ -0,0 +1,55 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleConnector(t *testing.T) {
+	t.Parallel()
+
+	fake, _ := newFakeDB(t)
+	db := sql.OpenDB(roleConnector{Connector: fake, role: "k6_writer"})
+	t.Cleanup(func() { _ = db.Close() })
+
+	require.NoError(t, db.PingContext(context.Background()))
+	assert.Equal(t, []string{"SET ROLE `k6_writer`"}, fake.DDL(), "role set once per new connection")
+
+	require.NoError(t, db.PingContext(context.Background()))
+	assert.Len(t, fake.DDL(), 1, "pooled connection keeps its role")
+}
+
+func TestRoleConnector_Denied(t *testing.T) {
+	t.Parallel()
+
+	fake, _ := newFakeDB(t)
+	fake.set(func(f *fakeDB) { f.ddlErr = &clickhouse.Exception{Code: 512, Name: "SET_NON_GRANTED_ROLE"} })
+	db := sql.OpenDB(roleConnector{Connector: fake, role: "k6_writer"})
+	t.Cleanup(func() { _ = db.Close() })
+
+	err := db.PingContext(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to set role k6_writer")
+}
+
+func TestOpenRoleDB_PoolSettings(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.Role = "k6_writer"
+
+	db := cfg.openRoleDB(cfg.buildOptions(nil, nil))
+	t.Cleanup(func() { _ = db.Close() })
+	assert.Equal(t, driverMaxIdleConns+5, db.Stats().MaxOpenConnections, "driver default")
+
+	opts := cfg.buildOptions(nil, nil)
+	opts.MaxOpenConns = 3
+	sized := cfg.openRoleDB(opts)
+	t.Cleanup(func() { _ = sized.Close() })
+	assert.Equal(t, 3, sized.Stats().MaxOpenConnections, "set in the options")
+}
@@ -0,0 +1,87 @@
+package clickhouse
+
+import (
+	"strings"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// Metric routing presets (Config.MetricRouting).
+const (
+	// RoutingNone writes every sample to the schema(s) selected by SchemaMode.
+	RoutingNone = "none"
+
+	// RoutingSplit writes k6 builtin metrics (HTTP, browser, WebSocket, gRPC,
+	// execution) to a typed "compatible" table and custom script metrics to a
+	// map-based "simple" table, avoiding one sparse table holding both.
+	RoutingSplit = "split"
+)
+
+// Table suffixes used by the split routing preset.
+const (
+	splitBuiltinSuffix = "_builtin"
+	splitCustomSuffix  = "_custom"
+)
+
+// builtinMetricNames lists the metrics emitted by k6 itself. Browser metrics
+// are matched by prefix in isBuiltinMetric.
+var builtinMetricNames = map[string]bool{
+	metrics.VUsName:                   true,
+	metrics.VUsMaxName:                true,
+	metrics.IterationsName:            true,
+	metrics.IterationDurationName:     true,
+	metrics.DroppedIterationsName:     true,
+	metrics.ChecksName:                true,
+	metrics.GroupDurationName:         true,
+	metrics.HTTPReqsName:              true,
+	metrics.HTTPReqFailedName:         true,
+	metrics.HTTPReqDurationName:       true,
+	metrics.HTTPReqBlockedName:        true,
+	metrics.HTTPReqConnectingName:     true,
+	metrics.HTTPReqTLSHandshakingName: true,
+	metrics.HTTPReqSendingName:        true,
+	metrics.HTTPReqWaitingName:        true,
+	metrics.HTTPReqReceivingName:      true,
+	metrics.WSSessionsName:            true,
+	metrics.WSMessagesSentName:        true,
+	metrics.WSMessagesReceivedName:    true,
+	metrics.WSPingName:                true,
+	metrics.WSSessionDurationName:     true,
+	metrics.WSConnectingName:          true,
+	metrics.GRPCReqDurationName:       true,
+	metrics.DataSentName:              true,
+	metrics.DataReceivedName:          true,
+}
+
+// isBuiltinMetric reports whether name is a metric emitted by k6 or its
+// browser module rather than defined by the test script.
+func isBuiltinMetric(name string) bool {
+	return builtinMetricNames[name] || strings.HasPrefix(name, "browser_")
+}
+
+// internalMetricNames lists the k6 execution and network-volume metrics
+// dropped by skipBuiltinInternalMetrics. They are emitted for every iteration
+// regardless of protocol and make up a large share of row volume.
+var internalMetricNames = map[string]bool{
+	metrics.VUsName:               true,
+	metrics.VUsMaxName:            true,
+	metrics.IterationsName:        true,
+	metrics.IterationDurationName: true,
+	metrics.DataSentName:          true,
+	metrics.DataReceivedName:      true,
+}
+
+// isInternalSample reports whether sample belongs to internalMetricNames.
+func isInternalSample(sample metrics.Sample) bool {
+	return sample.Metric != nil && internalMetricNames[sample.Metric.Name]
+}
+
+// isBuiltinSample is the accept filter of the split preset's typed table.
+func isBuiltinSample(sample metrics.Sample) bool {
+	return sample.Metric != nil && isBuiltinMetric(sample.Metric.Name)
+}
+
+// isCustomSample is the accept filter of the split preset's map-based table.
+func isCustomSample(sample metrics.Sample) bool {
+	return !isBuiltinSample(sample)
+}
@@ -0,0 +1,184 @@
+package clickhouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestIsBuiltinMetric(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{metrics.HTTPReqDurationName, true},
+		{metrics.HTTPReqsName, true},
+		{metrics.IterationsName, true},
+		{metrics.GRPCReqDurationName, true},
+		{"browser_web_vital_lcp", true},
+		{"browser_http_req_duration", true},
+		{"checkout_duration", false},
+		{"http_req_duration_custom", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, isBuiltinMetric(tt.name))
+		})
+	}
+}
+
+func TestConfig_ValidateRouting(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{"default", func(*Config) {}, ""},
+		{"explicit none", func(c *Config) { c.MetricRouting = RoutingNone }, ""},
+		{"split", func(c *Config) { c.MetricRouting = RoutingSplit }, ""},
+		{"split ignores single schemaMode", func(c *Config) {
+			c.MetricRouting = RoutingSplit
+			c.SchemaMode = "compatible"
+		}, ""},
+		{"unknown preset", func(c *Config) { c.MetricRouting = "byType" }, "invalid metricRouting: byType"},
+		{"split with fan-out", func(c *Config) {
+			c.MetricRouting = RoutingSplit
+			c.SchemaMode = "simple,compatible"
+		}, "cannot be combined with multiple schemaModes"},
+		{"split table name too long", func(c *Config) {
+			c.MetricRouting = RoutingSplit
+			c.Table = "t123456789012345678901234567890123456789012345678901234567"
+		}, "invalid table name for metricRouting split"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := NewConfig()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestParseConfig_MetricRouting(t *testing.T) {
+	t.Run("json config", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{"metricRouting": "split"}),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, RoutingSplit, cfg.MetricRouting)
+	})
+
+	t.Run("url params", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?metricRouting=split"})
+		require.NoError(t, err)
+		assert.Equal(t, RoutingSplit, cfg.MetricRouting)
+	})
+
+	t.Run("env overrides url", func(t *testing.T) {
+		t.Setenv("K6_CLICKHOUSE_METRIC_ROUTING", "none")
+
+		cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?metricRouting=split"})
+		require.NoError(t, err)
+		assert.Equal(t, RoutingNone, cfg.MetricRouting)
+	})
+}
+
+func TestOutput_SplitRouting(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{"metricRouting": "split"})
+
+	ddl := fake.DDL()
+	require.Len(t, ddl, 3, "database once, then table DDL for each routed table")
+	assert.Contains(t, ddl[1], "`k6`.`samples_builtin`")
+	assert.Contains(t, ddl[1], "metric_type", "builtin table uses the typed schema")
+	assert.Contains(t, ddl[2], "`k6`.`samples_custom`")
+	assert.Contains(t, ddl[2], "tags Map(String, String)", "custom table uses the map-based schema")
+
+	// A single container mixing builtin and custom metrics is split per sample.
+	registry := metrics.NewRegistry()
+	now := time.Now()
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+		{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(metrics.HTTPReqDurationName, metrics.Trend)}, Time: now, Value: 12},
+		{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("checkout_duration", metrics.Trend)}, Time: now, Value: 34},
+	}})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 2, "each sample is written to exactly one table")
+	assert.Len(t, rows[0], 21, "builtin metric in compatible row")
+	assert.Equal(t, metrics.HTTPReqDurationName, rows[0][1])
+	assert.Len(t, rows[1], 4, "custom metric in simple row")
+	assert.Equal(t, "checkout_duration", rows[1][1])
+	assert.Equal(t, uint64(2), o.GetErrorMetrics().SamplesProcessed)
+}
+
+func TestConfig_AcceptFilter(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	sample := func(name string) metrics.Sample {
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(name, metrics.Counter)}}
+	}
+
+	cfg := NewConfig()
+	filters, err := cfg.resolveSampleFilters(nil)
+	require.NoError(t, err)
+	assert.Nil(t, acceptFilter(filters, nil), "no filtering by default")
+
+	cfg.SkipBuiltinInternalMetrics = true
+	filters, err = cfg.resolveSampleFilters(nil)
+	require.NoError(t, err)
+	accept := acceptFilter(filters, nil)
+	require.NotNil(t, accept)
+	for _, name := range []string{"vus", "vus_max", "iterations", "iteration_duration", "data_sent", "data_received"} {
+		assert.False(t, accept(sample(name)), name)
+	}
+	assert.True(t, accept(sample(metrics.HTTPReqDurationName)))
+	assert.True(t, accept(sample("checkout_duration")))
+
+	// Combined with the split preset's builtin route
+	builtin := acceptFilter(filters, isBuiltinSample)
+	assert.False(t, builtin(sample(metrics.IterationsName)))
+	assert.True(t, builtin(sample(metrics.HTTPReqsName)))
+	assert.False(t, builtin(sample("checkout_duration")))
+}
+
+func TestOutput_SkipBuiltinInternalMetrics(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{"skipBuiltinInternalMetrics": true})
+
+	registry := metrics.NewRegistry()
+	now := time.Now()
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+		{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(metrics.VUsName, metrics.Gauge)}, Time: now, Value: 10},
+		{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(metrics.DataSentName, metrics.Counter)}, Time: now, Value: 512},
+		{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(metrics.HTTPReqsName, metrics.Counter)}, Time: now, Value: 1},
+	}})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 1)
+	assert.Equal(t, metrics.HTTPReqsName, rows[0][1])
+}
@@ -0,0 +1,91 @@
+package clickhouse
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Placeholders accepted in Config.Database and Config.Table. They give every
+// test run its own database or table, so short-lived experiment data is
+// cleaned up by dropping it as a whole.
+const (
+	// runNameTestID expands to the run's testid tag (k6 --tag testid=...),
+	// with characters invalid in identifiers replaced by "_".
+	runNameTestID = "{testid}"
+
+	// runNameDate expands to the UTC start date as YYYYMMDD.
+	runNameDate = "{date}"
+)
+
+// Placeholders accepted in Config.TableTemplate only. Unlike the per-run
+// placeholders, they are expanded again at every flush (see tableRoller).
+const (
+	// tableNameDay expands to the current UTC date as YYYYMMDD.
+	tableNameDay = "{yyyyMMdd}"
+
+	// tableNameMonth expands to the current UTC month as YYYYMM.
+	tableNameMonth = "{yyyyMM}"
+)
+
+// invalidIdentifierChars matches the characters a testid cannot contribute to
+// an identifier.
+var invalidIdentifierChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// hasRunPlaceholder reports whether name contains a per-run placeholder.
+func hasRunPlaceholder(name string) bool {
+	return strings.Contains(name, runNameTestID) || strings.Contains(name, runNameDate)
+}
+
+// runTestID returns the run's testid tag, falling back to test_run_id.
+func runTestID(runTags map[string]string) (string, bool) {
+	if testID, ok := runTags["testid"]; ok {
+		return testID, true
+	}
+	testID, ok := runTags["test_run_id"]
+	return testID, ok
+}
+
+// expandRunNames replaces the per-run placeholders in Database, Table, and
+// TableTemplate, then names Table after TableTemplate when it is set. runTags
+// are the test-wide tags, and start is the run's start time.
+func (c *Config) expandRunNames(runTags map[string]string, start time.Time) error {
+	if !hasRunPlaceholder(c.Database) && !hasRunPlaceholder(c.Table) && !hasRunPlaceholder(c.TableTemplate) {
+		c.expandTableTemplate(start)
+		return nil
+	}
+
+	testID, ok := runTestID(runTags)
+	r := strings.NewReplacer(
+		runNameTestID, invalidIdentifierChars.ReplaceAllString(testID, "_"),
+		runNameDate, start.UTC().Format("20060102"),
+	)
+
+	for _, name := range []*string{&c.Database, &c.Table, &c.TableTemplate} {
+		if strings.Contains(*name, runNameTestID) && (!ok || testID == "") {
+			return fmt.Errorf("%s uses %s but the run has no testid tag (run k6 with --tag testid=<id>)", *name, runNameTestID)
+		}
+		*name = r.Replace(*name)
+	}
+	c.expandTableTemplate(start)
+	return nil
+}
+
+// expandTableTemplate sets Table to TableTemplate expanded for now, if
+// TableTemplate is set.
+func (c *Config) expandTableTemplate(now time.Time) {
+	if c.TableTemplate != "" {
+		c.Table = tableFromTemplate(c.TableTemplate, now)
+	}
+}
+
+// tableFromTemplate expands the rolling placeholders of a TableTemplate
+// whose per-run placeholders were already expanded.
+func tableFromTemplate(template string, now time.Time) string {
+	now = now.UTC()
+	return strings.NewReplacer(
+		tableNameDay, now.Format("20060102"),
+		tableNameMonth, now.Format("200601"),
+	).Replace(template)
+}
@@ -0,0 +1,93 @@
+package clickhouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/lib"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestConfig_ExpandRunNames(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 3, 7, 23, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	tests := []struct {
+		name      string
+		database  string
+		table     string
+		tags      map[string]string
+		wantDB    string
+		wantTable string
+		wantErr   string
+	}{
+		{
+			name:     "no placeholders",
+			database: "k6", table: "samples",
+			wantDB: "k6", wantTable: "samples",
+		},
+		{
+			name:     "database per run",
+			database: "k6_{testid}_{date}", table: "samples",
+			tags:   map[string]string{"testid": "checkout-v2.1"},
+			wantDB: "k6_checkout_v2_1_20260307", wantTable: "samples",
+		},
+		{
+			name:     "table per run from test_run_id",
+			database: "k6", table: "run_{testid}",
+			tags:   map[string]string{"test_run_id": "42"},
+			wantDB: "k6", wantTable: "run_42",
+		},
+		{
+			name:     "date only",
+			database: "k6_{date}", table: "samples",
+			wantDB: "k6_20260307", wantTable: "samples",
+		},
+		{
+			name:     "testid missing",
+			database: "k6_{testid}", table: "samples",
+			wantErr: "k6_{testid} uses {testid} but the run has no testid tag",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := NewConfig()
+			cfg.Database, cfg.Table = tt.database, tt.table
+			err := cfg.expandRunNames(tt.tags, start)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantDB, cfg.Database)
+			assert.Equal(t, tt.wantTable, cfg.Table)
+		})
+	}
+}
+
+func TestParseConfig_RunNames(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{
+		ConfigArgument: "localhost:9000?database=k6_{testid}",
+		ScriptOptions:  lib.Options{RunTags: map[string]string{"testid": "smoke"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "k6_smoke", cfg.Database)
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?database=k6_{testid}"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no testid tag")
+
+	// A mistyped key is reported before the template it may have caused
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?database=k6_{testid}&tesid=smoke"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"tesid"`)
+}
@@ -0,0 +1,36 @@
+package clickhouse
+
+import (
+	"sync"
+	"time"
+)
+
+// sampleLag tracks, per committed batch, how old its oldest sample was when
+// the batch was sent and how long the send took. The first covers k6's
+// sample buffer, pushInterval, retries, and the failover buffer; the second
+// is ClickHouse's ingest. The zero value is ready to use.
+type sampleLag struct {
+	mu      sync.Mutex
+	last    time.Duration
+	max     time.Duration
+	send    time.Duration
+	maxSend time.Duration
+}
+
+// record adds one committed batch whose send began at sentAt.
+func (l *sampleLag) record(oldest, sentAt time.Time, send time.Duration) {
+	lag := max(sentAt.Sub(oldest), 0)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.last, l.max = lag, max(l.max, lag)
+	l.send, l.maxSend = send, max(l.maxSend, send)
+}
+
+// snapshot returns the last and largest sample lag and send duration.
+func (l *sampleLag) snapshot() (last, maxLag, send, maxSend time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last, l.max, l.send, l.maxSend
+}
@@ -0,0 +1,52 @@
+package clickhouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+func TestSampleLag(t *testing.T) {
+	t.Parallel()
+
+	var l sampleLag
+	sentAt := time.Date(2026, 3, 1, 12, 0, 10, 0, time.UTC)
+	l.record(sentAt.Add(-8*time.Second), sentAt, 300*time.Millisecond)
+	l.record(sentAt.Add(-2*time.Second), sentAt, 900*time.Millisecond)
+
+	last, maxLag, send, maxSend := l.snapshot()
+	assert.Equal(t, 2*time.Second, last)
+	assert.Equal(t, 8*time.Second, maxLag)
+	assert.Equal(t, 900*time.Millisecond, send)
+	assert.Equal(t, 900*time.Millisecond, maxSend)
+
+	// A sample stamped ahead of the load generator's clock is not negative lag
+	l.record(sentAt.Add(time.Second), sentAt, 0)
+	last, _, _, _ = l.snapshot()
+	assert.Zero(t, last)
+}
+
+func TestOutput_SampleLag(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{"pushInterval": "1h"})
+	assert.Zero(t, o.GetErrorMetrics().MaxSampleLag, "no batch sent yet")
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("checkout_duration", metrics.Trend)
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+		{TimeSeries: metrics.TimeSeries{Metric: metric}, Time: time.Now().Add(-time.Minute), Value: 1},
+		{TimeSeries: metrics.TimeSeries{Metric: metric}, Time: time.Now(), Value: 2},
+	}})
+	o.flush()
+	require.Len(t, fake.Rows(), 2)
+
+	stats := o.GetErrorMetrics()
+	assert.GreaterOrEqual(t, stats.SampleLag, time.Minute, "the oldest sample of the batch")
+	assert.Less(t, stats.SampleLag, 2*time.Minute)
+	assert.Equal(t, stats.SampleLag, stats.MaxSampleLag)
+	assert.Equal(t, stats.SendDuration, stats.MaxSendDuration)
+}
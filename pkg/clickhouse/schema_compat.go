@@ -5,7 +5,11 @@ import (
 	"database/sql"
 	"fmt"
 	"maps"
+	"math"
+	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"go.k6.io/k6/v2/metrics"
@@ -14,14 +18,348 @@ import (
 // CompatibleSchemaImpl is the legacy compatible schema implementation.
 // It extracts known k6 tags into dedicated typed columns for query performance.
 //
-// This serves as an example of a custom schema implementation. Fork this file
-// to create your own schema with the columns you need.
-var CompatibleSchemaImpl = SchemaImplementation{
-	Name:   "compatible",
-	Schema: CompatibleSchema{},
-	Converter: CompatibleConverter{
-		defaultBuildID: safeUnixToUint32(time.Now().Unix()),
-	},
+// This serves as an example of a custom schema implementation. To add columns
+// of your own, use NewCompatibleSchemaImpl rather than forking this file.
+var CompatibleSchemaImpl = NewCompatibleSchemaImpl("compatible")
+
+// ExtraColumn is a column appended to the compatible schema by an extension
+// (see NewCompatibleSchemaImpl).
+type ExtraColumn struct {
+	// Name is the column name (alphanumeric + underscore, max 63 chars).
+	Name string
+
+	// Type is the column type with its modifiers, as written in CREATE TABLE,
+	// e.g. "LowCardinality(String) DEFAULT ''".
+	Type string
+
+	// Value returns the column value for sample. tags holds the tags not
+	// extracted into the built-in columns; deleting a tag from it keeps the
+	// tag out of extra_tags.
+	Value func(sample metrics.Sample, tags map[string]string) (any, error)
+}
+
+// NewCompatibleSchemaImpl returns the compatible schema registered as name,
+// extended with columns after the built-in and optional ones. Every output
+// option of the compatible schema applies to it:
+//
+//	clickhouse.RegisterSchema(clickhouse.NewCompatibleSchemaImpl("compatible_tenant",
+//		clickhouse.ExtraColumn{
+//			Name: "tenant",
+//			Type: "LowCardinality(String) DEFAULT ''",
+//			Value: func(_ metrics.Sample, tags map[string]string) (any, error) {
+//				tenant := tags["tenant"]
+//				delete(tags, "tenant")
+//				return tenant, nil
+//			},
+//		}))
+func NewCompatibleSchemaImpl(name string, columns ...ExtraColumn) SchemaImplementation {
+	return SchemaImplementation{
+		Name:   name,
+		Schema: CompatibleSchema{ExtraColumns: columns},
+		Converter: CompatibleConverter{
+			ExtraColumns:   columns,
+			defaultBuildID: compatibleDefaultBuildID,
+		},
+		Configure: func(cfg Config) (SchemaImplementation, error) {
+			impl, err := configureExtendedCompatible(cfg, columns)
+			impl.Name = name
+			return impl, err
+		},
+	}
+}
+
+// compatibleDefaultBuildID is generated once at process start and used for all
+// samples that don't provide a buildId tag.
+var compatibleDefaultBuildID = safeUnixToUint32(time.Now().Unix())
+
+// compatibleColumnCount is the number of columns of the base compatible schema
+// (without optional columns).
+const compatibleColumnCount = 21
+
+// compatibleColumns are the base columns of the compatible schema, in row
+// order.
+var compatibleColumns = []string{
+	"timestamp", "metric", "metric_type", "value",
+	"testid", "release", "scenario", "build_id", "version", "branch",
+	"name", "method", "status", "expected_response", "error_code",
+	"rating", "resource_type", "ui_feature", "check_name", "group_name",
+	"extra_tags",
+}
+
+// compatibleColumnNames returns the inserted columns of a compatible schema
+// variant: the base ones, the enabled optional ones, and ExtraColumns.
+func compatibleColumnNames(opts compatibleOptions, extensions []ExtraColumn) []string {
+	columns := slices.Concat(compatibleColumns, opts.extraColumns())
+	for _, col := range extensions {
+		columns = append(columns, col.Name)
+	}
+	return columns
+}
+
+// compatibleOptions holds the config-dependent variations of the compatible
+// schema. The zero value is the base schema.
+type compatibleOptions struct {
+	// typedExtraTags moves numeric and boolean extra tags into the
+	// extra_tags_num and extra_tags_bool columns.
+	typedExtraTags bool
+
+	// tagStorage is the column type of extra_tags (TagStorageMap,
+	// TagStorageJSON, or TagStorageString).
+	tagStorage string
+
+	// rawTags adds the raw_tags column, holding the complete tag set in the
+	// column type of extra_tags.
+	rawTags bool
+
+	// grpcColumns moves the service and status of gRPC samples into the
+	// grpc_service and grpc_status columns.
+	grpcColumns bool
+
+	// wsColumns moves the url and subprotocol of WebSocket samples into the
+	// ws_url and ws_subprotocol columns.
+	wsColumns bool
+
+	// protocolColumn adds the protocol column, derived from the metric name.
+	protocolColumn bool
+
+	// errorNameColumn adds the error_name column, naming error_code.
+	errorNameColumn bool
+
+	// hostnameColumn adds the hostname column, naming the load generator.
+	hostnameColumn bool
+
+	// vuColumns adds the vu and iter columns, from k6 execution metadata.
+	vuColumns bool
+
+	// traceID adds the trace_id column, from k6's tracing metadata.
+	traceID bool
+
+	// seriesID adds the series_id column (see SeriesID).
+	seriesID bool
+
+	// counterDelta adds the delta column (see CounterModeDelta).
+	counterDelta bool
+
+	// rateBool adds the rate column and writes 0 to value for Rate samples
+	// (see RateBoolColumn).
+	rateBool bool
+
+	// builtin adds the builtin column (see BuiltinColumn).
+	builtin bool
+
+	// ingestedAt adds the server-filled ingested_at column, which is not
+	// part of the INSERT.
+	ingestedAt bool
+
+	// materialized holds the MATERIALIZED columns' expressions by name;
+	// they are computed by the server and not part of the INSERT.
+	materialized map[string]string
+
+	// engine is the table engine (EngineMergeTree when empty); versioned
+	// engines add the row_version column.
+	engine string
+
+	// partitionBy is the partition key (PartitionByTime when empty).
+	partitionBy string
+
+	// metricTypeTTL holds the retention in days by metric type; types not
+	// listed are kept defaultTTLDays.
+	metricTypeTTL map[string]int
+
+	// lowCardinality and plainString list string columns switched to
+	// LowCardinality(String) and String (see stringType).
+	lowCardinality []string
+	plainString    []string
+
+	// nullable declares the columns of optional tags Nullable (see
+	// nullableColumns).
+	nullable bool
+}
+
+// extraTagsDDL returns the type and modifiers of the extra_tags column.
+func (o compatibleOptions) extraTagsDDL() string {
+	switch o.tagStorage {
+	case TagStorageJSON:
+		return "JSON"
+	case TagStorageString:
+		return "String DEFAULT '{}' CODEC(ZSTD(1))"
+	default:
+		return "Map(LowCardinality(String), String) DEFAULT map() CODEC(ZSTD(1))"
+	}
+}
+
+// extraColumnsDDL returns the column definitions appended after extra_tags.
+func (o compatibleOptions) extraColumnsDDL() string {
+	var b strings.Builder
+	if o.typedExtraTags {
+		b.WriteString(",\n\t\t\textra_tags_num    Map(LowCardinality(String), Float64) DEFAULT map() CODEC(ZSTD(1))")
+		b.WriteString(",\n\t\t\textra_tags_bool   Map(LowCardinality(String), Bool) DEFAULT map() CODEC(ZSTD(1))")
+	}
+	if o.rawTags {
+		b.WriteString(",\n\t\t\traw_tags          " + o.extraTagsDDL())
+	}
+	if o.grpcColumns {
+		b.WriteString(",\n\t\t\tgrpc_service      " + o.stringType("grpc_service") + " DEFAULT ''")
+		b.WriteString(",\n\t\t\tgrpc_status       " + o.nullableDDL("Int8", "-1"))
+	}
+	if o.wsColumns {
+		b.WriteString(",\n\t\t\tws_url            " + o.stringType("ws_url") + " DEFAULT '' CODEC(ZSTD(1))")
+		b.WriteString(",\n\t\t\tws_subprotocol    " + o.stringType("ws_subprotocol") + " DEFAULT ''")
+	}
+	if o.protocolColumn {
+		b.WriteString(",\n\t\t\tprotocol          " + o.stringType("protocol") + " DEFAULT ''")
+	}
+	if o.errorNameColumn {
+		b.WriteString(",\n\t\t\terror_name        " + o.stringType("error_name") + " DEFAULT ''")
+	}
+	if o.hostnameColumn {
+		b.WriteString(",\n\t\t\thostname          " + o.stringType("hostname") + " DEFAULT ''")
+	}
+	if o.vuColumns {
+		b.WriteString(",\n\t\t\tvu                UInt32 DEFAULT 0")
+		b.WriteString(",\n\t\t\titer              UInt64 DEFAULT 0")
+	}
+	if o.traceID {
+		b.WriteString(",\n\t\t\ttrace_id          FixedString(32) DEFAULT ''")
+	}
+	if o.seriesID {
+		b.WriteString(",\n\t\t\tseries_id         UInt64")
+	}
+	if o.counterDelta {
+		b.WriteString(",\n\t\t\tdelta             Float64 DEFAULT 0")
+	}
+	if o.rateBool {
+		b.WriteString(",\n\t\t\trate              Bool DEFAULT false")
+	}
+	if o.builtin {
+		b.WriteString(",\n\t\t\tbuiltin           Bool DEFAULT false")
+	}
+	b.WriteString(rowVersionDDL(o.engine))
+	b.WriteString(ingestedAtDDL(o.ingestedAt))
+	b.WriteString(materializedColumnsDDL(o.materialized))
+	return b.String()
+}
+
+// extraColumns returns the names of the optional columns, in row order.
+func (o compatibleOptions) extraColumns() []string {
+	var cols []string
+	if o.typedExtraTags {
+		cols = append(cols, "extra_tags_num", "extra_tags_bool")
+	}
+	if o.rawTags {
+		cols = append(cols, rawTagsColumn)
+	}
+	if o.grpcColumns {
+		cols = append(cols, "grpc_service", "grpc_status")
+	}
+	if o.wsColumns {
+		cols = append(cols, "ws_url", "ws_subprotocol")
+	}
+	if o.protocolColumn {
+		cols = append(cols, "protocol")
+	}
+	if o.errorNameColumn {
+		cols = append(cols, "error_name")
+	}
+	if o.hostnameColumn {
+		cols = append(cols, "hostname")
+	}
+	if o.vuColumns {
+		cols = append(cols, "vu", "iter")
+	}
+	if o.traceID {
+		cols = append(cols, traceIDColumn)
+	}
+	if o.seriesID {
+		cols = append(cols, seriesIDColumn)
+	}
+	if o.counterDelta {
+		cols = append(cols, deltaColumn)
+	}
+	if o.rateBool {
+		cols = append(cols, rateColumn)
+	}
+	if o.builtin {
+		cols = append(cols, builtinColumn)
+	}
+	if versioned(o.engine) {
+		cols = append(cols, rowVersionColumn)
+	}
+	return cols
+}
+
+// identityColumns returns the columns that tell two samples with the same
+// metric, testid, release, and timestamp apart (see orderByDDL).
+func (o compatibleOptions) identityColumns() []string {
+	cols := []string{
+		"scenario", "build_id", "version", "branch", "name", "method", "status",
+		"expected_response", "error_code", "rating", "resource_type", "ui_feature",
+		"check_name", "group_name", "extra_tags",
+	}
+	for _, col := range o.extraColumns() {
+		switch col {
+		case rowVersionColumn, deltaColumn, rateColumn, builtinColumn, rawTagsColumn:
+		default:
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// configureCompatible applies the output configuration to the compatible schema.
+func configureCompatible(cfg Config) (SchemaImplementation, error) {
+	return configureExtendedCompatible(cfg, nil)
+}
+
+// configureExtendedCompatible applies the output configuration to the
+// compatible schema extended with columns.
+func configureExtendedCompatible(cfg Config, columns []ExtraColumn) (SchemaImplementation, error) {
+	opts := compatibleOptions{
+		typedExtraTags:  cfg.TypedExtraTags,
+		tagStorage:      cfg.TagStorage,
+		rawTags:         cfg.KeepRawTags,
+		grpcColumns:     cfg.GRPCColumns,
+		wsColumns:       cfg.WSColumns,
+		protocolColumn:  cfg.ProtocolColumn,
+		errorNameColumn: cfg.ErrorNameColumn,
+		hostnameColumn:  cfg.HostnameColumn,
+		vuColumns:       cfg.VUColumns,
+		traceID:         cfg.TraceIDColumn,
+		seriesID:        cfg.SeriesIDColumn,
+		counterDelta:    cfg.counterDelta(),
+		rateBool:        cfg.RateBoolColumn,
+		builtin:         cfg.BuiltinColumn,
+		ingestedAt:      cfg.IngestedAtColumn,
+		materialized:    cfg.MaterializedColumns,
+		engine:          cfg.TableEngine,
+		partitionBy:     cfg.PartitionBy,
+		metricTypeTTL:   cfg.MetricTypeTTL,
+		lowCardinality:  cfg.LowCardinalityColumns,
+		plainString:     cfg.StringColumns,
+		nullable:        cfg.NullableColumns,
+	}
+	defaults, err := compatibleDefaultsFromConfig(cfg, compatibleDefaultBuildID)
+	if err != nil {
+		return SchemaImplementation{}, err
+	}
+	var hostname string
+	if opts.hostnameColumn {
+		if hostname, err = os.Hostname(); err != nil {
+			return SchemaImplementation{}, fmt.Errorf("hostnameColumn: failed to get the host name: %w", err)
+		}
+	}
+	return SchemaImplementation{
+		Name:   "compatible",
+		Schema: CompatibleSchema{ExtraColumns: columns, opts: opts},
+		Converter: CompatibleConverter{
+			ExtraColumns:   columns,
+			defaultBuildID: compatibleDefaultBuildID,
+			defaults:       &defaults,
+			hostname:       hostname,
+			builtinSet:     cfg.builtinMetrics,
+			opts:           opts,
+		},
+	}, nil
 }
 
 func init() {
@@ -59,10 +397,116 @@ func init() {
 //	ORDER BY (metric, testid, release, timestamp)
 //	TTL toDateTime(timestamp) + INTERVAL 365 DAY DELETE
 //	SETTINGS index_granularity = 8192
-type CompatibleSchema struct{}
+//	COMMENT 'xk6-output-clickhouse schema v1'
+//
+// With typedExtraTags enabled, two more columns follow extra_tags:
+//
+//	extra_tags_num    Map(LowCardinality(String), Float64) DEFAULT map() CODEC(ZSTD(1)),
+//	extra_tags_bool   Map(LowCardinality(String), Bool) DEFAULT map() CODEC(ZSTD(1))
+//
+// With keepRawTags enabled, the sample's complete tag set follows, in the
+// column type of extra_tags:
+//
+//	raw_tags          Map(LowCardinality(String), String) DEFAULT map() CODEC(ZSTD(1))
+//
+// With grpcColumns enabled, two more follow (after the typed maps, if any):
+//
+//	grpc_service      LowCardinality(String) DEFAULT '',
+//	grpc_status       Int8 DEFAULT -1
+//
+// With wsColumns enabled, two more follow (after all of the above):
+//
+//	ws_url            String DEFAULT '' CODEC(ZSTD(1)),
+//	ws_subprotocol    LowCardinality(String) DEFAULT ''
+//
+// With protocolColumn and errorNameColumn enabled, the last columns are:
+//
+//	protocol          LowCardinality(String) DEFAULT '',
+//	error_name        LowCardinality(String) DEFAULT ''
+//
+// With hostnameColumn and vuColumns enabled, these follow:
+//
+//	hostname          LowCardinality(String) DEFAULT '',
+//	vu                UInt32 DEFAULT 0,
+//	iter              UInt64 DEFAULT 0
+//
+// With traceIdColumn enabled, the sample's trace ID follows:
+//
+//	trace_id          FixedString(32) DEFAULT ''
+//
+// With seriesIdColumn enabled, the fingerprint of the series follows:
+//
+//	series_id         UInt64
+//
+// With counterMode=delta, the per-flush increase of Counter series follows:
+//
+//	delta             Float64 DEFAULT 0
+//
+// With rateBoolColumn enabled, the outcome of Rate samples follows (their
+// value is written as 0):
+//
+//	rate              Bool DEFAULT false
+//
+// With builtinColumn enabled, whether the metric is one of k6's follows:
+//
+//	builtin           Bool DEFAULT false
+//
+// With ingestedAtColumn enabled, the table ends with a column the server
+// fills on arrival:
+//
+//	ingested_at       DateTime DEFAULT now()
+//
+// The materializedColumns come last, e.g.:
+//
+//	status_class MATERIALIZED intDiv(status, 100)
+//
+// With tableEngine=ReplacingMergeTree, a row_version UInt64 column follows
+// the optional columns, and the sorting key is extended to cover every column.
+// With partitionBy=testid or testid_time, the partition key starts with testid.
+// lowCardinalityColumns and stringColumns switch string columns between
+// String and LowCardinality(String).
+// With nullableColumns, the columns of optional tags from scenario to
+// group_name (except build_id and branch) and grpc_status are Nullable without
+// a default, e.g. status Nullable(UInt16), method LowCardinality(Nullable(String)).
+// With metricTypeTTL set, the TTL has one rule per metric type, e.g.:
+//
+//	TTL toDateTime(timestamp) + INTERVAL 365 DAY DELETE WHERE metric_type = 'counter',
+//	    ...
+//	    toDateTime(timestamp) + INTERVAL 30 DAY DELETE WHERE metric_type = 'trend'
+//
+// With tagStorage=json, extra_tags is declared as the native JSON type; with
+// tagStorage=string, as a String holding a JSON object.
+//
+// Extensions append ExtraColumns last, after row_version and ingested_at.
+// A type embedding CompatibleSchema may also override InsertQuery; the
+// columns it inserts must then match ColumnCount and the converter's rows.
+type CompatibleSchema struct {
+	// ExtraColumns are the columns an extension appends to the table.
+	ExtraColumns []ExtraColumn
+
+	opts compatibleOptions
+}
+
+// ColumnCount returns the number of inserted columns: the base ones, the
+// enabled optional ones, and ExtraColumns.
+func (s CompatibleSchema) ColumnCount() int {
+	return compatibleColumnCount + len(s.opts.extraColumns()) + len(s.ExtraColumns)
+}
 
 // CreateSchema creates the database and table for the compatible schema.
 func (s CompatibleSchema) CreateSchema(ctx context.Context, db *sql.DB, database, table string) error {
+	// Defense-in-depth: Validate identifiers before creating anything
+	if !isValidIdentifier(table) {
+		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
+	}
+	if err := createDatabase(ctx, db, database); err != nil {
+		return err
+	}
+	return s.CreateTable(ctx, db, database, table)
+}
+
+// CreateTable creates the table for the compatible schema in an existing database.
+func (s CompatibleSchema) CreateTable(ctx context.Context, db *sql.DB, database, table string) error {
 	// Defense-in-depth: Validate identifiers before using them
 	if !isValidIdentifier(database) {
 		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", database)
@@ -70,46 +514,31 @@ func (s CompatibleSchema) CreateSchema(ctx context.Context, db *sql.DB, database
 	if !isValidIdentifier(table) {
 		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
 	}
-
-	// Create database
-	_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", escapeIdentifier(database)))
-	if err != nil {
-		return fmt.Errorf("failed to create database: %w", err)
+	for _, col := range s.ExtraColumns {
+		if !isValidIdentifier(col.Name) {
+			return fmt.Errorf("invalid extra column name: %s (must be alphanumeric + underscore, max 63 chars)", col.Name)
+		}
 	}
 
 	// Create table with optimized schema
 	//nolint:gosec // G201: SQL string formatting is safe - identifiers are validated with isValidIdentifier() (alphanumeric only) and escaped with backticks
 	query := fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s.%s (
-			timestamp         DateTime64(%d, 'UTC') CODEC(DoubleDelta, ZSTD(1)),
-			metric            LowCardinality(String),
-			metric_type       Enum8('counter'=1, 'gauge'=2, 'rate'=3, 'trend'=4),
-			value             Float64 CODEC(Gorilla, ZSTD(1)),
-			testid            LowCardinality(String) DEFAULT '',
-			release           LowCardinality(String) DEFAULT '',
-			scenario          LowCardinality(String) DEFAULT '',
-			build_id          UInt32 DEFAULT 0 CODEC(Delta, ZSTD(1)),
-			version           LowCardinality(String) DEFAULT '',
-			branch            LowCardinality(String) DEFAULT 'master',
-			name              String DEFAULT '' CODEC(ZSTD(1)),
-			method            LowCardinality(String) DEFAULT '',
-			status            UInt16 DEFAULT 0,
-			expected_response Bool DEFAULT true,
-			error_code        LowCardinality(String) DEFAULT '',
-			rating            LowCardinality(String) DEFAULT '',
-			resource_type     LowCardinality(String) DEFAULT '',
-			ui_feature        LowCardinality(String) DEFAULT '',
-			check_name        String DEFAULT '' CODEC(ZSTD(1)),
-			group_name        LowCardinality(String) DEFAULT '',
-			extra_tags        Map(LowCardinality(String), String) DEFAULT map() CODEC(ZSTD(1))
-		) ENGINE = MergeTree()
-		PARTITION BY toYYYYMM(timestamp)
-		ORDER BY (metric, testid, release, timestamp)
-		TTL toDateTime(timestamp) + INTERVAL 365 DAY DELETE
+		CREATE TABLE IF NOT EXISTS %s.%s (%s
+		) ENGINE = %s
+		PARTITION BY %s
+		ORDER BY %s
+		TTL %s
 		SETTINGS index_granularity = 8192
-	`, escapeIdentifier(database), escapeIdentifier(table), TimestampPrecision)
+		%s
+	`, escapeIdentifier(database), escapeIdentifier(table), s.columnsDDL(),
+		engineDDL(s.opts.engine), partitionByDDL(s.opts.partitionBy, "toYYYYMM(timestamp)", "testid"),
+		orderByDDL(s.opts.engine, "metric, testid, release, timestamp", append(s.opts.identityColumns(), s.extensionNames()...)),
+		ttlDDL(s.opts.metricTypeTTL), schemaVersionDDL(compatibleSchemaVersion))
 
-	_, err = db.ExecContext(ctx, query)
+	if s.opts.tagStorage == TagStorageJSON {
+		ctx = jsonTypeContext(ctx)
+	}
+	_, err := db.ExecContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to create table: %w", err)
 	}
@@ -117,17 +546,85 @@ func (s CompatibleSchema) CreateSchema(ctx context.Context, db *sql.DB, database
 	return nil
 }
 
+// columnsDDL returns the column definitions of the table; t gives each
+// string column its type, n the type and default of the columns of optional
+// tags.
+func (s CompatibleSchema) columnsDDL() string {
+	t, n := s.opts.stringType, s.opts.nullableDDL
+	return fmt.Sprintf(`
+			timestamp         DateTime64(%d, 'UTC') CODEC(DoubleDelta, ZSTD(1)),
+			metric            %s,
+			metric_type       Enum8('counter'=1, 'gauge'=2, 'rate'=3, 'trend'=4),
+			value             Float64 CODEC(Gorilla, ZSTD(1)),
+			testid            %s DEFAULT '',
+			release           %s DEFAULT '',
+			scenario          %s,
+			build_id          UInt32 DEFAULT 0 CODEC(Delta, ZSTD(1)),
+			version           %s,
+			branch            %s DEFAULT 'master',
+			name              %s CODEC(ZSTD(1)),
+			method            %s,
+			status            %s,
+			expected_response %s,
+			error_code        %s,
+			rating            %s,
+			resource_type     %s,
+			ui_feature        %s,
+			check_name        %s CODEC(ZSTD(1)),
+			group_name        %s,
+			extra_tags        %s%s`, TimestampPrecision,
+		t("metric"),
+		t("testid"), t("release"), n(t("scenario"), "''"),
+		n(t("version"), "''"), t("branch"),
+		n(t("name"), "''"), n(t("method"), "''"), n("UInt16", "0"), n("Bool", "true"),
+		n(t("error_code"), "''"), n(t("rating"), "''"), n(t("resource_type"), "''"), n(t("ui_feature"), "''"),
+		n(t("check_name"), "''"), n(t("group_name"), "''"),
+		s.opts.extraTagsDDL(), s.opts.extraColumnsDDL()+s.extensionDDL())
+}
+
+// Validate checks that an existing table has the columns and engine of the
+// compatible schema with the configured options and ExtraColumns.
+func (s CompatibleSchema) Validate(ctx context.Context, db *sql.DB, database, table string) error {
+	return validateTable(ctx, db, database, table, s.columnsDDL(), engineDDL(s.opts.engine))
+}
+
+// SchemaVersion returns the version of the compatible schema's table.
+func (s CompatibleSchema) SchemaVersion() int { return compatibleSchemaVersion }
+
+// Migrate upgrades a compatible schema table. A table created before
+// versioning gets the columns it lacks: optional columns enabled since, and
+// ExtraColumns added to the schema.
+func (s CompatibleSchema) Migrate(ctx context.Context, db *sql.DB, database, table string, fromVersion int) error {
+	if fromVersion >= 1 {
+		return nil
+	}
+	if s.opts.tagStorage == TagStorageJSON {
+		ctx = jsonTypeContext(ctx)
+	}
+	return addMissingColumns(ctx, db, database, table, s.columnsDDL())
+}
+
+// extensionDDL returns the definitions of ExtraColumns.
+func (s CompatibleSchema) extensionDDL() string {
+	var b strings.Builder
+	for _, col := range s.ExtraColumns {
+		b.WriteString(",\n\t\t\t" + col.Name + " " + col.Type)
+	}
+	return b.String()
+}
+
+// extensionNames returns the names of ExtraColumns.
+func (s CompatibleSchema) extensionNames() []string {
+	names := make([]string, 0, len(s.ExtraColumns))
+	for _, col := range s.ExtraColumns {
+		names = append(names, col.Name)
+	}
+	return names
+}
+
 // InsertQuery returns the INSERT statement for the compatible schema.
 func (s CompatibleSchema) InsertQuery(database, table string) string {
-	return fmt.Sprintf(`
-		INSERT INTO %s.%s (
-			timestamp, metric, metric_type, value,
-			testid, release, scenario, build_id, version, branch,
-			name, method, status, expected_response, error_code,
-			rating, resource_type, ui_feature, check_name, group_name,
-			extra_tags
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, escapeIdentifier(database), escapeIdentifier(table))
+	return buildInsertQuery(database, table, compatibleColumnNames(s.opts, s.ExtraColumns))
 }
 
 // compatibleSample represents a sample for the compatible schema.
@@ -153,10 +650,145 @@ type compatibleSample struct {
 	CheckName        string
 	GroupName        string
 	ExtraTags        map[string]string
+	ExtraTagsNum     map[string]float64 // Only set with typedExtraTags
+	ExtraTagsBool    map[string]bool    // Only set with typedExtraTags
+	RawTags          any                // Only set with keepRawTags
+	GRPCService      string             // Only set with grpcColumns
+	GRPCStatus       int8               // Only set with grpcColumns
+	WSURL            string             // Only set with wsColumns
+	WSSubprotocol    string             // Only set with wsColumns
+	Hostname         string             // Only set with hostnameColumn
+	VU               uint32             // Only set with vuColumns
+	Iter             uint64             // Only set with vuColumns
+	TraceID          string             // Only set with traceIdColumn
+	SeriesID         uint64             // Only set with seriesIdColumn
+	Delta            float64            // Only set with counterMode=delta
+	Rate             bool               // Only set with rateBoolColumn
+	Builtin          bool               // Only set with builtinColumn
+	RowVersion       uint64             // Only set with a versioned engine
+	Missing          uint32             // Bit per row column whose optional tag was absent
+}
+
+// Row indexes of the columns of optional tags. With nullableColumns they are
+// NULL when their bit in compatibleSample.Missing is set.
+const (
+	colScenario         = 6
+	colVersion          = 8
+	colName             = 10
+	colMethod           = 11
+	colStatus           = 12
+	colExpectedResponse = 13
+	colErrorCode        = 14
+	colRating           = 15
+	colResourceType     = 16
+	colUIFeature        = 17
+	colCheckName        = 18
+	colGroupName        = 19
+)
+
+// takeTag removes the first of tags (a tag and its aliases) found in tagMap
+// and returns its value. When none is present it returns "" and marks row
+// column col missing.
+func (cs *compatibleSample) takeTag(tagMap map[string]string, col int, tags ...string) string {
+	for _, tag := range tags {
+		if v, ok := getAndDelete(tagMap, tag); ok {
+			return v
+		}
+	}
+	cs.Missing |= 1 << col
+	return ""
+}
+
+// Reserved values of the testidDefault, branchDefault, and buildIdDefault
+// options. Any other value is used literally.
+const (
+	// TagDefaultEmpty writes an empty string (or 0 for build_id).
+	TagDefaultEmpty = "empty"
+
+	// TagDefaultError fails conversion of samples missing the tag.
+	TagDefaultError = "error"
+
+	// BuildIDDefaultTimestamp writes the process start time as build_id.
+	BuildIDDefaultTimestamp = "timestamp"
+)
+
+// tagDefault is the value written when a tag is missing, or a requirement
+// that the tag be present.
+type tagDefault struct {
+	value    string
+	required bool
+}
+
+// compatibleDefaults holds the fallbacks for the testid, branch, and buildId
+// tags of the compatible schema.
+type compatibleDefaults struct {
+	testID          tagDefault
+	branch          tagDefault
+	buildID         uint32
+	buildIDRequired bool
+}
+
+// newCompatibleDefaults returns the historical defaults: testid "default",
+// branch "master", and the given build ID.
+func newCompatibleDefaults(buildID uint32) compatibleDefaults {
+	return compatibleDefaults{
+		testID:  tagDefault{value: "default"},
+		branch:  tagDefault{value: "master"},
+		buildID: buildID,
+	}
+}
+
+// parseTagDefault interprets a testidDefault/branchDefault option value.
+func parseTagDefault(s string) tagDefault {
+	switch s {
+	case TagDefaultEmpty:
+		return tagDefault{}
+	case TagDefaultError:
+		return tagDefault{required: true}
+	default:
+		return tagDefault{value: s}
+	}
+}
+
+// compatibleDefaultsFromConfig resolves the configured fallbacks.
+// processBuildID is used for BuildIDDefaultTimestamp.
+func compatibleDefaultsFromConfig(cfg Config, processBuildID uint32) (compatibleDefaults, error) {
+	d := compatibleDefaults{
+		testID: parseTagDefault(cfg.TestIDDefault),
+		branch: parseTagDefault(cfg.BranchDefault),
+	}
+
+	switch cfg.BuildIDDefault {
+	case BuildIDDefaultTimestamp:
+		d.buildID = processBuildID
+	case TagDefaultEmpty:
+		d.buildID = 0
+	case TagDefaultError:
+		d.buildIDRequired = true
+	default:
+		id, err := strconv.ParseUint(cfg.BuildIDDefault, 10, 32)
+		if err != nil {
+			return d, fmt.Errorf("invalid buildIdDefault: %s (valid: %s, %s, %s, or a number)",
+				cfg.BuildIDDefault, BuildIDDefaultTimestamp, TagDefaultEmpty, TagDefaultError)
+		}
+		d.buildID = uint32(id)
+	}
+	return d, nil
+}
+
+// orDefault returns value when the tag was present, else the fallback.
+func (d tagDefault) orDefault(tag, value string, ok bool) (string, error) {
+	if ok {
+		return value, nil
+	}
+	if d.required {
+		return "", fmt.Errorf("missing required tag %s", tag)
+	}
+	return d.value, nil
 }
 
 // convertToCompatible converts a k6 sample to the compatible schema format.
-func convertToCompatible(sample metrics.Sample, defaultBuildID uint32) (compatibleSample, error) {
+func convertToCompatible(sample metrics.Sample, defaults compatibleDefaults) (compatibleSample, error) {
 	// Get a reusable map from the pool to reduce allocations
 	extraTags := tagMapPool.Get().(map[string]string)
 	clear(extraTags)
@@ -170,112 +802,205 @@ func convertToCompatible(sample metrics.Sample, defaultBuildID uint32) (compatib
 		ExtraTags:        extraTags,
 	}
 
-	// Extract and map tags to columns
+	// Copy source tags once into the pooled map; extraction deletes known keys,
+	// leaving only the leftovers as extra_tags — no scratch map, no second copy.
+	// We delete from the pooled copy, so k6's source tag map is never mutated.
+	// A sample without tags goes through the same path so defaults apply equally.
 	if sample.Tags != nil {
-		// Copy source tags once into the pooled map; extraction deletes known keys,
-		// leaving only the leftovers as extra_tags — no scratch map, no second copy.
-		// We delete from the pooled copy, so k6's source tag map is never mutated.
 		maps.Copy(cs.ExtraTags, sample.Tags.Map())
-		tagMap := cs.ExtraTags
-
-		// TestID (with aliases)
-		if testID, ok := getAndDelete(tagMap, "testid"); ok {
-			cs.TestID = testID
-		} else if testID, ok := getAndDelete(tagMap, "test_run_id"); ok {
-			cs.TestID = testID
-		} else {
-			cs.TestID = "default"
-		}
+	}
+	tagMap := cs.ExtraTags
 
-		// BuildID (with type conversion)
-		if buildID, ok := getAndDelete(tagMap, "buildId"); ok {
-			if id, err := strconv.ParseUint(buildID, 10, 32); err == nil {
-				cs.BuildID = uint32(id)
-			} else {
-				return cs, fmt.Errorf("failed to parse buildId: %w", err)
-			}
-		}
-		// If not set from tags, use the default generated at startup
-		if cs.BuildID == 0 {
-			cs.BuildID = defaultBuildID
-		}
+	// TestID (with aliases)
+	testID, ok := getAndDelete(tagMap, "testid")
+	if !ok {
+		testID, ok = getAndDelete(tagMap, "test_run_id")
+	}
+	var err error
+	if cs.TestID, err = defaults.testID.orDefault("testid", testID, ok); err != nil {
+		return cs, err
+	}
 
-		// String fields
-		cs.Release = getAndDeleteWithDefault(tagMap, "release", "")
-		cs.Version = getAndDeleteWithDefault(tagMap, "version", "")
-		cs.Branch = getAndDeleteWithDefault(tagMap, "branch", "master")
-		// UIFeature (with camelCase alias)
-		if uiFeature, ok := getAndDelete(tagMap, "ui_feature"); ok {
-			cs.UIFeature = uiFeature
-		} else {
-			cs.UIFeature = getAndDeleteWithDefault(tagMap, "uiFeature", "")
-		}
-		cs.Scenario = getAndDeleteWithDefault(tagMap, "scenario", "")
-		cs.Name = getAndDeleteWithDefault(tagMap, "name", "")
-		cs.Method = getAndDeleteWithDefault(tagMap, "method", "")
-		cs.ErrorCode = getAndDeleteWithDefault(tagMap, "error_code", "")
-		cs.Rating = getAndDeleteWithDefault(tagMap, "rating", "")
-		cs.ResourceType = getAndDeleteWithDefault(tagMap, "resource_type", "")
-		// CheckName (with alias: k6 native tag is "check", "check_name" is a custom alias)
-		if checkName, ok := getAndDelete(tagMap, "check"); ok {
-			cs.CheckName = checkName
+	// BuildID (with type conversion)
+	if buildID, ok := getAndDelete(tagMap, "buildId"); ok {
+		if id, err := strconv.ParseUint(buildID, 10, 32); err == nil {
+			cs.BuildID = uint32(id)
 		} else {
-			cs.CheckName = getAndDeleteWithDefault(tagMap, "check_name", "")
+			return cs, fmt.Errorf("failed to parse buildId: %w", err)
 		}
+	} else if defaults.buildIDRequired {
+		return cs, fmt.Errorf("missing required tag buildId")
+	}
+	// If not set from tags, use the configured default
+	if cs.BuildID == 0 {
+		cs.BuildID = defaults.buildID
+	}
 
-		// GroupName (with alias)
-		if groupName, ok := getAndDelete(tagMap, "group_name"); ok {
-			cs.GroupName = groupName
-		} else {
-			cs.GroupName = getAndDeleteWithDefault(tagMap, "group", "")
-		}
+	// String fields
+	cs.Release = getAndDeleteWithDefault(tagMap, "release", "")
+	cs.Version = cs.takeTag(tagMap, colVersion, "version")
+	branch, ok := getAndDelete(tagMap, "branch")
+	if cs.Branch, err = defaults.branch.orDefault("branch", branch, ok); err != nil {
+		return cs, err
+	}
+	// UIFeature (with camelCase alias)
+	cs.UIFeature = cs.takeTag(tagMap, colUIFeature, "ui_feature", "uiFeature")
+	cs.Scenario = cs.takeTag(tagMap, colScenario, "scenario")
+	cs.Name = cs.takeTag(tagMap, colName, "name")
+	cs.Method = cs.takeTag(tagMap, colMethod, "method")
+	cs.ErrorCode = cs.takeTag(tagMap, colErrorCode, "error_code")
+	cs.Rating = cs.takeTag(tagMap, colRating, "rating")
+	cs.ResourceType = cs.takeTag(tagMap, colResourceType, "resource_type")
+	// CheckName (with alias: k6 native tag is "check", "check_name" is a custom alias)
+	cs.CheckName = cs.takeTag(tagMap, colCheckName, "check", "check_name")
 
-		// Status (with type conversion)
-		if statusStr, ok := getAndDelete(tagMap, "status"); ok {
-			if statusInt, err := strconv.ParseUint(statusStr, 10, 16); err == nil {
-				cs.Status = uint16(statusInt)
-			} else {
-				return cs, fmt.Errorf("failed to parse status: %w", err)
-			}
-		}
+	// GroupName (with alias)
+	cs.GroupName = cs.takeTag(tagMap, colGroupName, "group_name", "group")
 
-		// ExpectedResponse: k6 only ever emits "true"/"false" for this tag, so a
-		// lenient equality check is sufficient. Any other value is treated as false
-		// (rather than failing the whole sample, as a strict parse would).
-		if expResp, ok := getAndDelete(tagMap, "expected_response"); ok {
-			cs.ExpectedResponse = expResp == "true"
+	// Status (with type conversion)
+	if statusStr, ok := getAndDelete(tagMap, "status"); ok {
+		if statusInt, err := strconv.ParseUint(statusStr, 10, 16); err == nil {
+			cs.Status = uint16(statusInt)
+		} else {
+			return cs, fmt.Errorf("failed to parse status: %w", err)
 		}
+	} else {
+		cs.Missing |= 1 << colStatus
+	}
 
-		// Remaining (unrecognized) tags already live in cs.ExtraTags — no extra copy.
+	// ExpectedResponse: k6 only ever emits "true"/"false" for this tag, so a
+	// lenient equality check is sufficient. Any other value is treated as false
+	// (rather than failing the whole sample, as a strict parse would).
+	if expResp, ok := getAndDelete(tagMap, "expected_response"); ok {
+		cs.ExpectedResponse = expResp == "true"
 	} else {
-		// No tags, use defaults
-		cs.TestID = "default"
-		cs.BuildID = defaultBuildID
-		cs.Branch = "master"
+		cs.Missing |= 1 << colExpectedResponse
 	}
 
+	// Remaining (unrecognized) tags already live in cs.ExtraTags — no extra copy.
 	return cs, nil
 }
 
 // CompatibleConverter implements SampleConverter for the compatible schema.
 // It extracts known k6 tags into dedicated columns with type conversion.
+//
+// A type embedding CompatibleConverter may override Convert, append to the
+// row it returns, and leave Release to the embedded converter: rows longer
+// than the base layout are never pooled.
 type CompatibleConverter struct {
+	// ExtraColumns are the columns an extension appends to each row; they must
+	// match CompatibleSchema.ExtraColumns.
+	ExtraColumns []ExtraColumn
+
 	// defaultBuildID is set once at creation time and used for all samples
 	// that don't provide a buildId tag.
 	defaultBuildID uint32
+
+	// defaults overrides the testid/branch/buildId fallbacks; nil keeps the
+	// historical "default"/"master"/defaultBuildID values.
+	defaults *compatibleDefaults
+
+	// hostname is the host name of the machine running k6, resolved once at
+	// configuration time; only set with hostnameColumn.
+	hostname string
+
+	// builtinSet recognizes builtin metrics for the builtin column; nil
+	// matches them by name.
+	builtinSet builtinMetricSet
+
+	opts compatibleOptions
 }
 
 // Convert transforms a k6 sample into a row for the compatible schema.
 func (c CompatibleConverter) Convert(ctx context.Context, sample metrics.Sample) ([]any, error) {
-	cs, err := convertToCompatible(sample, c.defaultBuildID)
+	defaults := newCompatibleDefaults(c.defaultBuildID)
+	if c.defaults != nil {
+		defaults = *c.defaults
+	}
+
+	cs, err := convertToCompatible(sample, defaults)
 	if err != nil {
 		// Return tag map to pool even on error
 		tagMapPool.Put(cs.ExtraTags)
 		return nil, err
 	}
 
-	// Get row buffer from pool
-	row := compatibleRowPool.Get().([]any)
+	if c.opts.grpcColumns {
+		if err := extractGRPC(&cs, sample); err != nil {
+			tagMapPool.Put(cs.ExtraTags)
+			return nil, err
+		}
+	}
+
+	if c.opts.wsColumns && strings.HasPrefix(cs.Metric, "ws_") {
+		cs.WSURL = getAndDeleteWithDefault(cs.ExtraTags, "url", "")
+		cs.WSSubprotocol = getAndDeleteWithDefault(cs.ExtraTags, "subproto", "")
+	}
+
+	if c.opts.hostnameColumn {
+		cs.Hostname = getAndDeleteWithDefault(cs.ExtraTags, "hostname", c.hostname)
+	}
+
+	if c.opts.vuColumns {
+		if err := extractVU(&cs, sample); err != nil {
+			tagMapPool.Put(cs.ExtraTags)
+			return nil, err
+		}
+	}
+
+	if c.opts.traceID {
+		extractTraceID(&cs, sample)
+	}
+
+	if c.opts.seriesID {
+		cs.SeriesID = sampleSeriesID(sample)
+	}
+	if c.opts.counterDelta {
+		cs.Delta = sampleDelta(sample)
+	}
+	if c.opts.rateBool {
+		cs.Value, cs.Rate = rateValue(sample)
+	}
+	if c.opts.builtin {
+		cs.Builtin = c.builtinSet.isBuiltinSample(sample)
+	}
+
+	// Extensions see the leftover tags before they are split or encoded
+	ext, err := c.extensionValues(sample, cs.ExtraTags)
+	if err != nil {
+		tagMapPool.Put(cs.ExtraTags)
+		return nil, err
+	}
+
+	if c.opts.typedExtraTags {
+		cs.ExtraTagsNum, cs.ExtraTagsBool = splitTypedTags(cs.ExtraTags)
+	}
+	if c.opts.rawTags {
+		if cs.RawTags, err = c.opts.rawTagsValue(sample); err != nil {
+			tagMapPool.Put(cs.ExtraTags)
+			return nil, err
+		}
+	}
+	cs.RowVersion = rowVersion(ctx)
+
+	var extraTags any = cs.ExtraTags
+	if c.opts.tagStorage == TagStorageString {
+		encoded, err := encodeTags(cs.ExtraTags)
+		tagMapPool.Put(cs.ExtraTags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode extra_tags: %w", err)
+		}
+		extraTags = encoded
+	}
+
+	// Get row buffer from pool (base layout) or allocate one with room for the
+	// optional columns.
+	var row []any
+	if count := c.ColumnCount(); count > compatibleColumnCount {
+		row = make([]any, count)
+	} else {
+		row = compatibleRowPool.Get().([]any)
+	}
 
 	// Populate row buffer with sample data (order matches INSERT query)
 	row[0] = cs.Timestamp
@@ -298,11 +1023,258 @@ func (c CompatibleConverter) Convert(ctx context.Context, sample metrics.Sample)
 	row[17] = cs.UIFeature
 	row[18] = cs.CheckName
 	row[19] = cs.GroupName
-	row[20] = cs.ExtraTags
+	row[20] = extraTags
+
+	c.opts.fillNulls(row, cs.Missing)
+	c.opts.fillExtraColumns(row[compatibleColumnCount:], &cs)
+	copy(row[len(row)-len(ext):], ext)
 
 	return row, nil
 }
 
+// ColumnCount returns the length of the rows Convert returns: the base
+// columns, the enabled optional ones, and ExtraColumns.
+func (c CompatibleConverter) ColumnCount() int {
+	return compatibleColumnCount + len(c.opts.extraColumns()) + len(c.ExtraColumns)
+}
+
+// ColumnNames returns the columns of the rows Convert returns.
+func (c CompatibleConverter) ColumnNames() []string {
+	return compatibleColumnNames(c.opts, c.ExtraColumns)
+}
+
+// extensionValues returns the values of ExtraColumns for sample, given its
+// leftover tags.
+func (c CompatibleConverter) extensionValues(sample metrics.Sample, tags map[string]string) ([]any, error) {
+	if len(c.ExtraColumns) == 0 {
+		return nil, nil
+	}
+	values := make([]any, len(c.ExtraColumns))
+	for i, col := range c.ExtraColumns {
+		if col.Value == nil {
+			return nil, fmt.Errorf("extra column %s has no Value function", col.Name)
+		}
+		v, err := col.Value(sample, tags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert column %s: %w", col.Name, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// fillNulls writes NULL into the base columns of row flagged in missing,
+// when the nullable option is set.
+func (o compatibleOptions) fillNulls(row []any, missing uint32) {
+	if !o.nullable {
+		return
+	}
+	for col := range compatibleColumnCount {
+		if missing&(1<<col) != 0 {
+			row[col] = nil
+		}
+	}
+}
+
+// Values of the protocol column.
+const (
+	ProtocolHTTP    = "http"
+	ProtocolWS      = "ws"
+	ProtocolGRPC    = "grpc"
+	ProtocolBrowser = "browser"
+	ProtocolCustom  = "custom"
+)
+
+// metricProtocol returns the protocol family of a metric from its name prefix.
+// Metrics of no protocol, including k6's own vus, iterations, and checks, are
+// ProtocolCustom.
+func metricProtocol(metric string) string {
+	switch {
+	case strings.HasPrefix(metric, "browser_"):
+		return ProtocolBrowser
+	case strings.HasPrefix(metric, "http_"):
+		return ProtocolHTTP
+	case strings.HasPrefix(metric, "ws_"):
+		return ProtocolWS
+	case strings.HasPrefix(metric, "grpc_"):
+		return ProtocolGRPC
+	default:
+		return ProtocolCustom
+	}
+}
+
+// fillExtraColumns writes the optional columns of cs into row, in the order
+// of extraColumns.
+func (o compatibleOptions) fillExtraColumns(row []any, cs *compatibleSample) {
+	i := 0
+	if o.typedExtraTags {
+		row[i], row[i+1] = cs.ExtraTagsNum, cs.ExtraTagsBool
+		i += 2
+	}
+	if o.rawTags {
+		row[i] = cs.RawTags
+		i++
+	}
+	if o.grpcColumns {
+		row[i], row[i+1] = cs.GRPCService, cs.GRPCStatus
+		if o.nullable && cs.GRPCStatus == grpcStatusNone {
+			row[i+1] = nil
+		}
+		i += 2
+	}
+	if o.wsColumns {
+		row[i], row[i+1] = cs.WSURL, cs.WSSubprotocol
+		i += 2
+	}
+	if o.protocolColumn {
+		row[i] = metricProtocol(cs.Metric)
+		i++
+	}
+	if o.errorNameColumn {
+		row[i] = errorName(cs.ErrorCode)
+		i++
+	}
+	if o.hostnameColumn {
+		row[i] = cs.Hostname
+		i++
+	}
+	if o.vuColumns {
+		row[i], row[i+1] = cs.VU, cs.Iter
+		i += 2
+	}
+	if o.traceID {
+		row[i] = cs.TraceID
+		i++
+	}
+	if o.seriesID {
+		row[i] = cs.SeriesID
+		i++
+	}
+	if o.counterDelta {
+		row[i] = cs.Delta
+		i++
+	}
+	if o.rateBool {
+		row[i] = cs.Rate
+		i++
+	}
+	if o.builtin {
+		row[i] = cs.Builtin
+		i++
+	}
+	if versioned(o.engine) {
+		row[i] = cs.RowVersion
+	}
+}
+
+// extractVU fills the vu and iter columns. k6 records the VU and iteration
+// numbers as sample metadata, not tags, when they are enabled in systemTags;
+// tags of the same names (set by a script or an older k6) are used when the
+// metadata is absent and never kept in extra_tags.
+func extractVU(cs *compatibleSample, sample metrics.Sample) error {
+	vu, err := executionNumber(cs.ExtraTags, sample.Metadata, "vu", 32)
+	if err != nil {
+		return err
+	}
+	iter, err := executionNumber(cs.ExtraTags, sample.Metadata, "iter", 64)
+	if err != nil {
+		return err
+	}
+	cs.VU, cs.Iter = uint32(vu), iter
+	return nil
+}
+
+// executionNumber returns the number key holds in metadata, or else in tags,
+// removing it from tags; 0 when neither has it.
+func executionNumber(tags, metadata map[string]string, key string, bitSize int) (uint64, error) {
+	value, ok := getAndDelete(tags, key)
+	if v, inMetadata := metadata[key]; inMetadata {
+		value, ok = v, true
+	}
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// grpcStatusNone is the grpc_status of samples that are not gRPC calls.
+const grpcStatusNone = -1
+
+// extractGRPC fills the gRPC columns of a gRPC sample: one of a grpc_* metric
+// or carrying a grpc_status tag. k6 tags gRPC calls with the code in "status",
+// the service in "service", and the bare method name in "method". The code is
+// moved out of the HTTP status column unless an explicit grpc_status tag
+// provides it, and a full "/pkg.Service/Method" method is split. Other
+// samples keep their tags and get grpcStatusNone.
+func extractGRPC(cs *compatibleSample, sample metrics.Sample) error {
+	cs.GRPCStatus = grpcStatusNone
+	code, explicit := getAndDelete(cs.ExtraTags, "grpc_status")
+	if !explicit && !strings.HasPrefix(cs.Metric, "grpc_") {
+		return nil
+	}
+
+	cs.GRPCService = getAndDeleteWithDefault(cs.ExtraTags, "service", "")
+	if path, ok := strings.CutPrefix(cs.Method, "/"); ok {
+		if service, method, ok := strings.Cut(path, "/"); ok {
+			if cs.GRPCService == "" {
+				cs.GRPCService = service
+			}
+			cs.Method = method
+		}
+	}
+
+	if explicit {
+		v, err := strconv.ParseInt(code, 10, 8)
+		if err != nil {
+			return fmt.Errorf("failed to parse grpc_status: %w", err)
+		}
+		cs.GRPCStatus = int8(v)
+		return nil
+	}
+	if sample.Tags == nil {
+		return nil
+	}
+	if _, ok := sample.Tags.Get("status"); !ok {
+		return nil
+	}
+	if cs.Status > math.MaxInt8 {
+		return fmt.Errorf("invalid gRPC status code %d", cs.Status)
+	}
+	cs.GRPCStatus = int8(cs.Status)
+	cs.Status = 0
+	cs.Missing |= 1 << colStatus
+	return nil
+}
+
+// splitTypedTags moves numeric and boolean values out of tags into typed maps.
+// Only the literals "true" and "false" count as booleans; numbers must parse as
+// finite floats, so "NaN" and "Inf" stay in the string map.
+func splitTypedTags(tags map[string]string) (map[string]float64, map[string]bool) {
+	num := make(map[string]float64)
+	bools := make(map[string]bool)
+	for k, v := range tags {
+		switch v {
+		case "true":
+			bools[k] = true
+			delete(tags, k)
+			continue
+		case "false":
+			bools[k] = false
+			delete(tags, k)
+			continue
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			num[k] = f
+			delete(tags, k)
+		}
+	}
+	return num, bools
+}
+
 // Release returns pooled resources after insertion.
 func (c CompatibleConverter) Release(row []any) {
 	// Return tag map to pool
@@ -311,6 +1283,9 @@ func (c CompatibleConverter) Release(row []any) {
 			tagMapPool.Put(tags)
 		}
 	}
-	// Return row buffer to pool
+	// Return row buffer to pool; rows with optional columns are not pooled
+	if len(row) != compatibleColumnCount {
+		return
+	}
 	compatibleRowPool.Put(row) //nolint:staticcheck // SA6002: pooling a []any boxes the slice header into 'any' (one alloc per Put); accepted to keep the SampleConverter interface stable
 }
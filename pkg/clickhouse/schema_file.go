@@ -0,0 +1,334 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.k6.io/k6/v2/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of a column of a file schema (see ColumnDefinition.Source).
+const (
+	SourceTimestamp  = "timestamp"   // sample time, for a DateTime64 column
+	SourceMetric     = "metric"      // metric name
+	SourceMetricType = "metric_type" // "counter", "gauge", "rate", or "trend"
+	SourceValue      = "value"       // sample value, for a Float64 column
+	SourceTags       = "tags"        // the tags no tag: column takes, for a Map(String, String) column
+	SourceTagPrefix  = "tag:"        // "tag:<name>", the value of one tag ("" when unset)
+)
+
+// SchemaDefinition describes a schema registered from a file listed in
+// Config.SchemaFiles, so that custom schemas can be shared as plain files
+// rather than Go code compiled into k6. A YAML example:
+//
+//	name: checkout
+//	columns:
+//	  - {name: timestamp, type: "DateTime64(3, 'UTC')", source: timestamp}
+//	  - {name: metric, type: LowCardinality(String), source: metric}
+//	  - {name: value, type: Float64, source: value}
+//	  - {name: scenario, type: LowCardinality(String), source: "tag:scenario"}
+//	  - {name: tags, type: "Map(LowCardinality(String), String)", source: tags}
+//	  - {name: status_class, type: "UInt8 MATERIALIZED intDiv(toUInt16OrZero(tags['status']), 100)"}
+//	ddl: |
+//	  CREATE TABLE IF NOT EXISTS {database}.{table} ({columns})
+//	  ENGINE = MergeTree() PARTITION BY toYYYYMM(timestamp) ORDER BY (metric, timestamp)
+type SchemaDefinition struct {
+	// Name is the schemaMode name of the schema. It may not be the name of a
+	// schema registered in Go, such as simple or compatible.
+	Name string `json:"name" yaml:"name"`
+
+	// Columns are the table columns, in order.
+	Columns []ColumnDefinition `json:"columns" yaml:"columns"`
+
+	// DDL is the CREATE TABLE template: {database}, {table}, and {columns}
+	// are replaced by the escaped names and the column definitions. When
+	// empty, the table is a MergeTree ordered by the metric and timestamp
+	// columns, partitioned by month.
+	DDL string `json:"ddl" yaml:"ddl"`
+}
+
+// ColumnDefinition is a column of a SchemaDefinition.
+type ColumnDefinition struct {
+	// Name is the column name (alphanumeric + underscore, max 63 chars).
+	Name string `json:"name" yaml:"name"`
+
+	// Type is the column type with its modifiers, as written in CREATE TABLE.
+	Type string `json:"type" yaml:"type"`
+
+	// Source is the part of the sample inserted into the column: one of the
+	// Source constants, or "tag:<name>", inserted as a string. Columns
+	// without source are created but not inserted; give them a DEFAULT or
+	// MATERIALIZED expression.
+	Source string `json:"source" yaml:"source"`
+}
+
+// fileSchemas holds the names of the schemas registered from files, which a
+// later file may replace, unlike schemas registered in Go.
+var (
+	fileSchemas   = make(map[string]bool)
+	fileSchemasMu sync.Mutex
+)
+
+// loadSchemaFiles loads the definitions in paths, checking that none would
+// replace a schema registered in Go. Nothing is registered yet.
+func loadSchemaFiles(paths []string) ([]SchemaDefinition, error) {
+	fileSchemasMu.Lock()
+	defer fileSchemasMu.Unlock()
+
+	defs := make([]SchemaDefinition, 0, len(paths))
+	for _, path := range paths {
+		def, err := LoadSchemaDefinition(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := GetSchema(def.Name); err == nil && !fileSchemas[def.Name] {
+			return nil, fmt.Errorf("invalid schema file %s: schema %s is already registered", path, def.Name)
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// registerSchemaDefinitions registers the schemas of definitions loaded by
+// loadSchemaFiles.
+func registerSchemaDefinitions(defs []SchemaDefinition) {
+	fileSchemasMu.Lock()
+	defer fileSchemasMu.Unlock()
+
+	for _, def := range defs {
+		RegisterSchema(def.implementation())
+		fileSchemas[def.Name] = true
+	}
+}
+
+// LoadSchemaDefinition reads and checks a schema definition: YAML for the
+// .yaml and .yml extensions, JSON otherwise. Unknown keys are errors.
+func LoadSchemaDefinition(path string) (SchemaDefinition, error) {
+	var def SchemaDefinition
+	data, err := os.ReadFile(path) // #nosec G304 - the path is operator config
+	if err != nil {
+		return def, fmt.Errorf("failed to read schema file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&def)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&def)
+	}
+	if err != nil {
+		return def, fmt.Errorf("invalid schema file %s: %w", path, err)
+	}
+	if err := def.validate(); err != nil {
+		return def, fmt.Errorf("invalid schema file %s: %w", path, err)
+	}
+	return def, nil
+}
+
+// validate checks the names, sources, and template of the definition.
+func (d SchemaDefinition) validate() error {
+	if !isValidIdentifier(d.Name) {
+		return fmt.Errorf("invalid name: %q (must be alphanumeric + underscore, max 63 chars)", d.Name)
+	}
+	if len(d.Columns) == 0 {
+		return errors.New("no columns")
+	}
+
+	var errs []error
+	seen := make(map[string]bool, len(d.Columns))
+	timestamp := false
+	for _, col := range d.Columns {
+		if !isValidIdentifier(col.Name) {
+			errs = append(errs, fmt.Errorf("invalid column name: %q (must be alphanumeric + underscore, max 63 chars)",
+				col.Name))
+			continue
+		}
+		if seen[col.Name] {
+			errs = append(errs, fmt.Errorf("column %s is listed more than once", col.Name))
+		}
+		seen[col.Name] = true
+		if strings.TrimSpace(col.Type) == "" {
+			errs = append(errs, fmt.Errorf("column %s has no type", col.Name))
+		}
+		switch tag, isTag := strings.CutPrefix(col.Source, SourceTagPrefix); {
+		case isTag && tag == "":
+			errs = append(errs, fmt.Errorf("column %s: source %s needs a tag name", col.Name, SourceTagPrefix))
+		case isTag, col.Source == "", col.Source == SourceMetric, col.Source == SourceMetricType,
+			col.Source == SourceValue, col.Source == SourceTags:
+		case col.Source == SourceTimestamp:
+			timestamp = true
+		default:
+			errs = append(errs, fmt.Errorf("column %s: unknown source %q (available: %s, %s, %s, %s, %s, %s<name>)",
+				col.Name, col.Source, SourceTimestamp, SourceMetric, SourceMetricType, SourceValue, SourceTags, SourceTagPrefix))
+		}
+	}
+	if !timestamp {
+		errs = append(errs, fmt.Errorf("no column has source %s", SourceTimestamp))
+	}
+	if d.DDL != "" && (!strings.Contains(d.DDL, "{table}") || !strings.Contains(d.DDL, "{columns}")) {
+		errs = append(errs, errors.New("ddl must contain {table} and {columns}"))
+	}
+	return errors.Join(errs...)
+}
+
+// implementation returns the schema and converter of the definition.
+func (d SchemaDefinition) implementation() SchemaImplementation {
+	return SchemaImplementation{
+		Name:      d.Name,
+		Schema:    definedSchema{def: d},
+		Converter: newDefinedConverter(d.Columns),
+	}
+}
+
+// definedSchema is the SchemaCreator of a SchemaDefinition.
+type definedSchema struct {
+	def SchemaDefinition
+}
+
+// CreateSchema creates the database and the table.
+func (s definedSchema) CreateSchema(ctx context.Context, db *sql.DB, database, table string) error {
+	if err := createDatabase(ctx, db, database); err != nil {
+		return err
+	}
+	return s.CreateTable(ctx, db, database, table)
+}
+
+// CreateTable creates the table from the definition's template.
+func (s definedSchema) CreateTable(ctx context.Context, db *sql.DB, database, table string) error {
+	if !isValidIdentifier(database) {
+		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", database)
+	}
+	if !isValidIdentifier(table) {
+		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
+	}
+	if _, err := db.ExecContext(ctx, s.createTableQuery(database, table)); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+	return nil
+}
+
+// createTableQuery fills the DDL template, or the default one.
+func (s definedSchema) createTableQuery(database, table string) string {
+	defs := make([]string, 0, len(s.def.Columns))
+	for _, col := range s.def.Columns {
+		defs = append(defs, "\n\t"+col.Name+" "+col.Type)
+	}
+
+	template := s.def.DDL
+	if template == "" {
+		template = "CREATE TABLE IF NOT EXISTS {database}.{table} ({columns}\n) ENGINE = MergeTree()" + s.defaultKeysDDL()
+	}
+	return strings.NewReplacer(
+		"{database}", escapeIdentifier(database),
+		"{table}", escapeIdentifier(table),
+		"{columns}", strings.Join(defs, ","),
+	).Replace(template)
+}
+
+// defaultKeysDDL returns the partition and sorting keys of the default
+// template, from the columns of the timestamp and metric sources.
+func (s definedSchema) defaultKeysDDL() string {
+	var timestamp, metric string
+	for _, col := range s.def.Columns {
+		switch {
+		case col.Source == SourceTimestamp && timestamp == "":
+			timestamp = col.Name
+		case col.Source == SourceMetric && metric == "":
+			metric = col.Name
+		}
+	}
+	key := timestamp
+	if metric != "" {
+		key = metric + ", " + timestamp
+	}
+	return fmt.Sprintf("\nPARTITION BY toYYYYMM(%s)\nORDER BY (%s)", timestamp, key)
+}
+
+// InsertQuery returns the INSERT statement for the columns with a source.
+func (s definedSchema) InsertQuery(database, table string) string {
+	return buildInsertQuery(database, table, newDefinedConverter(s.def.Columns).ColumnNames())
+}
+
+// definedConverter is the SampleConverter of a SchemaDefinition. It inserts
+// the columns with a source, in order.
+type definedConverter struct {
+	columns []ColumnDefinition // columns with a source
+	mapped  []string           // tags taken by tag: columns, left out of tags columns
+}
+
+// newDefinedConverter returns the converter for columns.
+func newDefinedConverter(columns []ColumnDefinition) definedConverter {
+	var c definedConverter
+	for _, col := range columns {
+		if col.Source == "" {
+			continue
+		}
+		c.columns = append(c.columns, col)
+		if tag, ok := strings.CutPrefix(col.Source, SourceTagPrefix); ok && !slices.Contains(c.mapped, tag) {
+			c.mapped = append(c.mapped, tag)
+		}
+	}
+	return c
+}
+
+// ColumnNames returns the columns of the rows Convert returns.
+func (c definedConverter) ColumnNames() []string {
+	names := make([]string, 0, len(c.columns))
+	for _, col := range c.columns {
+		names = append(names, col.Name)
+	}
+	return names
+}
+
+// Convert returns the row of sample.
+func (c definedConverter) Convert(_ context.Context, sample metrics.Sample) ([]any, error) {
+	if sample.Metric == nil {
+		return nil, errors.New("sample has no metric")
+	}
+	var tags map[string]string
+	if sample.Tags != nil {
+		tags = sample.Tags.Map()
+	}
+
+	row := make([]any, len(c.columns))
+	for i, col := range c.columns {
+		switch col.Source {
+		case SourceTimestamp:
+			row[i] = sample.Time
+		case SourceMetric:
+			row[i] = sample.Metric.Name
+		case SourceMetricType:
+			row[i] = sample.Metric.Type.String()
+		case SourceValue:
+			row[i] = sample.Value
+		case SourceTags:
+			rest := make(map[string]string, len(tags))
+			for k, v := range tags {
+				if !slices.Contains(c.mapped, k) {
+					rest[k] = v
+				}
+			}
+			row[i] = rest
+		default:
+			row[i] = tags[strings.TrimPrefix(col.Source, SourceTagPrefix)]
+		}
+	}
+	return row, nil
+}
+
+// Release is a no-op: rows are not pooled.
+func (c definedConverter) Release([]any) {}
@@ -0,0 +1,175 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+// writeSchemaFile writes content to name in a temporary directory.
+func writeSchemaFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+const checkoutSchemaYAML = `
+name: %s
+columns:
+  - {name: ts, type: "DateTime64(3, 'UTC')", source: timestamp}
+  - {name: metric, type: LowCardinality(String), source: metric}
+  - {name: kind, type: LowCardinality(String), source: metric_type}
+  - {name: value, type: Float64, source: value}
+  - {name: scenario, type: LowCardinality(String), source: "tag:scenario"}
+  - {name: tags, type: "Map(LowCardinality(String), String)", source: tags}
+  - {name: status_class, type: "UInt8 MATERIALIZED intDiv(toUInt16OrZero(tags['status']), 100)"}
+`
+
+func TestLoadSchemaDefinition(t *testing.T) {
+	t.Parallel()
+
+	t.Run("yaml", func(t *testing.T) {
+		t.Parallel()
+
+		def, err := LoadSchemaDefinition(writeSchemaFile(t, "checkout.yaml", fmt.Sprintf(checkoutSchemaYAML, "checkout")))
+		require.NoError(t, err)
+		assert.Equal(t, "checkout", def.Name)
+		require.Len(t, def.Columns, 7)
+		assert.Equal(t, ColumnDefinition{Name: "scenario", Type: "LowCardinality(String)", Source: "tag:scenario"}, def.Columns[4])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		def, err := LoadSchemaDefinition(writeSchemaFile(t, "minimal.json",
+			`{"name": "minimal", "columns": [{"name": "ts", "type": "DateTime64(3)", "source": "timestamp"}]}`))
+		require.NoError(t, err)
+		assert.Equal(t, "minimal", def.Name)
+	})
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"unknown yaml key", "s.yaml", "name: s\ncolum: []\n", "field colum not found"},
+		{"unknown json key", "s.json", `{"name": "s", "engine": "Log"}`, `unknown field "engine"`},
+		{"invalid name", "s.json", `{"name": "my-schema"}`, `invalid name: "my-schema"`},
+		{"no columns", "s.json", `{"name": "s"}`, "no columns"},
+		{"no timestamp", "s.json", `{"name": "s", "columns": [{"name": "v", "type": "Float64", "source": "value"}]}`,
+			"no column has source timestamp"},
+		{"unknown source", "s.json",
+			`{"name": "s", "columns": [{"name": "ts", "type": "DateTime", "source": "time"}]}`, `unknown source "time"`},
+		{"empty tag", "s.json",
+			`{"name": "s", "columns": [{"name": "ts", "type": "DateTime", "source": "tag:"}]}`, "needs a tag name"},
+		{"duplicate column", "s.json", `{"name": "s", "columns": [
+			{"name": "ts", "type": "DateTime", "source": "timestamp"},
+			{"name": "ts", "type": "DateTime", "source": "timestamp"}]}`, "column ts is listed more than once"},
+		{"ddl without columns", "s.json", `{"name": "s", "ddl": "CREATE TABLE {table}",
+			"columns": [{"name": "ts", "type": "DateTime", "source": "timestamp"}]}`, "ddl must contain {table} and {columns}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := LoadSchemaDefinition(writeSchemaFile(t, tt.file, tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	_, err := LoadSchemaDefinition(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read schema file")
+}
+
+func TestDefinedSchema_DDL(t *testing.T) {
+	t.Parallel()
+
+	def, err := LoadSchemaDefinition(writeSchemaFile(t, "checkout.yaml", fmt.Sprintf(checkoutSchemaYAML, "checkout")))
+	require.NoError(t, err)
+	impl := def.implementation()
+
+	fake, db := newFakeDB(t)
+	require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "checkout"))
+	ddl := fake.DDL()
+	require.Len(t, ddl, 2)
+	assert.Contains(t, ddl[1], "CREATE TABLE IF NOT EXISTS `k6`.`checkout` (\n\tts DateTime64(3, 'UTC'),\n\tmetric LowCardinality(String),")
+	assert.Contains(t, ddl[1], "PARTITION BY toYYYYMM(ts)\nORDER BY (metric, ts)")
+
+	assert.Equal(t, "INSERT INTO `k6`.`checkout` (ts, metric, kind, value, scenario, tags) VALUES (?, ?, ?, ?, ?, ?)",
+		impl.Schema.InsertQuery("k6", "checkout"), "columns without source are not inserted")
+
+	def.DDL = "CREATE TABLE {database}.{table} ({columns}) ENGINE = Log"
+	query := definedSchema{def: def}.createTableQuery("k6", "checkout")
+	assert.Contains(t, query, "CREATE TABLE `k6`.`checkout` (\n\tts DateTime64(3, 'UTC'),")
+	assert.Contains(t, query, ") ENGINE = Log")
+}
+
+func TestDefinedConverter_Convert(t *testing.T) {
+	t.Parallel()
+
+	def, err := LoadSchemaDefinition(writeSchemaFile(t, "checkout.yaml", fmt.Sprintf(checkoutSchemaYAML, "checkout")))
+	require.NoError(t, err)
+	converter := def.implementation().Converter
+
+	registry := metrics.NewRegistry()
+	now := time.Now()
+	row, err := converter.Convert(context.Background(), metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: registry.MustNewMetric("http_req_duration", metrics.Trend),
+			Tags:   registry.RootTagSet().WithTagsFromMap(map[string]string{"scenario": "browse", "status": "200"}),
+		},
+		Time:  now,
+		Value: 12.5,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []any{now, "http_req_duration", "trend", 12.5, "browse", map[string]string{"status": "200"}}, row)
+	converter.Release(row)
+}
+
+func TestParseConfig_SchemaFiles(t *testing.T) {
+	t.Parallel()
+
+	path := writeSchemaFile(t, "checkout.yaml", fmt.Sprintf(checkoutSchemaYAML, "checkout_parse"))
+	fake, o := startFakeOutput(t, map[string]any{
+		"schemaFiles":  []string{path},
+		"schemaMode":   "checkout_parse",
+		"pushInterval": "1h",
+	})
+	assert.Contains(t, AvailableSchemas(), "checkout_parse")
+	assert.Contains(t, fake.DDL()[1], "scenario LowCardinality(String)")
+
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	rows := fake.Rows()
+	require.Len(t, rows, 2)
+	assert.Len(t, rows[0], 6)
+
+	// A file may not replace a schema registered in Go
+	_, err := ParseConfig(output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"schemaFiles": []string{writeSchemaFile(t, "simple.yaml", fmt.Sprintf(checkoutSchemaYAML, "simple"))},
+	})})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "schema simple is already registered")
+
+	// Nothing is registered from an invalid configuration
+	_, err = ParseConfig(output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"schemaFiles": []string{writeSchemaFile(t, "rejected.yaml", fmt.Sprintf(checkoutSchemaYAML, "checkout_rejected"))},
+		"schemaMode":  "checkout_rejected",
+		"tableEngine": "Log",
+	})})
+	require.ErrorContains(t, err, "tableEngine")
+	assert.NotContains(t, AvailableSchemas(), "checkout_rejected")
+}
@@ -0,0 +1,119 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// schemaVersionPrefix starts the table comment that marks a schema version.
+const schemaVersionPrefix = "xk6-output-clickhouse schema v"
+
+// Versions of the built-in schemas (see SchemaMigrator). Version 0 is a
+// table created before versioning.
+const (
+	simpleSchemaVersion     = 1
+	compatibleSchemaVersion = 1
+)
+
+// SchemaVersionComment returns the table comment that marks version of a
+// schema. A SchemaMigrator's CreateTable sets it with a COMMENT clause.
+func SchemaVersionComment(version int) string {
+	return schemaVersionPrefix + strconv.Itoa(version)
+}
+
+// schemaVersionDDL returns the COMMENT clause that stamps a new table with
+// version.
+func schemaVersionDDL(version int) string {
+	return "COMMENT '" + SchemaVersionComment(version) + "'"
+}
+
+// parseSchemaVersion returns the version marked by a table comment, or 0 for
+// a comment that is not a marker.
+func parseSchemaVersion(comment string) int {
+	rest, ok := strings.CutPrefix(comment, schemaVersionPrefix)
+	if !ok {
+		return 0
+	}
+	v, err := strconv.Atoi(rest)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
+
+// readSchemaVersion returns the version marked on an existing table.
+func readSchemaVersion(ctx context.Context, db *sql.DB, database, table string) (int, error) {
+	var comment string
+	err := db.QueryRowContext(ctx,
+		"SELECT comment FROM system.tables WHERE database = ? AND name = ?", database, table).Scan(&comment)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("table %s.%s does not exist", database, table)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the schema version of %s.%s: %w", database, table, err)
+	}
+	return parseSchemaVersion(comment), nil
+}
+
+// addMissingColumns adds the columns of a built-in schema's definitions that
+// the table lacks. Existing columns are left as they are, whatever their type.
+func addMissingColumns(ctx context.Context, db *sql.DB, database, table, columnsDDL string) error {
+	defs := columnDefinitions(columnsDDL)
+	clauses := make([]string, 0, len(defs))
+	for _, def := range defs {
+		clauses = append(clauses, "ADD COLUMN IF NOT EXISTS "+def)
+	}
+	//nolint:gosec // G201: identifiers are validated by the schema and escaped with backticks
+	query := fmt.Sprintf("ALTER TABLE %s.%s %s",
+		escapeIdentifier(database), escapeIdentifier(table), strings.Join(clauses, ", "))
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to add missing columns: %w", err)
+	}
+	return nil
+}
+
+// migrateTable brings t's table to its schema's version (SchemaMigrator) and
+// updates the marker. Schemas without it are not versioned. A failed
+// migration fails Start, as inserts into the table would.
+func (o *Output) migrateTable(ctx context.Context, db *sql.DB, t *schemaTarget) error {
+	m, ok := t.schema.(SchemaMigrator)
+	if !ok {
+		return nil
+	}
+	logger := o.logger.WithFields(logrus.Fields{"schemaMode": t.mode, "table": t.table})
+
+	// Start never needed system.tables before versioning; a table whose
+	// version cannot be read is left as is, as it was then
+	from, err := readSchemaVersion(ctx, db, o.config.Database, t.table)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read the schema version, skipping migration")
+		return nil
+	}
+	to := m.SchemaVersion()
+	switch {
+	case from == to:
+		return nil
+	case from > to:
+		logger.WithFields(logrus.Fields{"tableVersion": from, "schemaVersion": to}).
+			Warn("Table has a newer schema version than this output, leaving it as is")
+		return nil
+	}
+
+	if err := m.Migrate(ctx, db, o.config.Database, t.table, from); err != nil {
+		return fmt.Errorf("schema %s: failed to migrate %s from version %d to %d: %w", t.mode, t.table, from, to, err)
+	}
+	//nolint:gosec // G201: identifiers are validated by the schema and escaped with backticks
+	query := fmt.Sprintf("ALTER TABLE %s.%s MODIFY %s",
+		escapeIdentifier(o.config.Database), escapeIdentifier(t.table), schemaVersionDDL(to))
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("schema %s: failed to mark %s as version %d: %w", t.mode, t.table, to, err)
+	}
+	logger.WithFields(logrus.Fields{"fromVersion": from, "toVersion": to}).Info("Migrated table")
+	return nil
+}
@@ -0,0 +1,133 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+// recordingMigrator is a SchemaMigrator that records its migrations.
+type recordingMigrator struct {
+	SimpleSchema
+	version int
+	err     error
+	from    []int
+}
+
+func (m *recordingMigrator) SchemaVersion() int { return m.version }
+
+func (m *recordingMigrator) Migrate(_ context.Context, _ *sql.DB, _, _ string, fromVersion int) error {
+	m.from = append(m.from, fromVersion)
+	return m.err
+}
+
+func TestParseSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 1, parseSchemaVersion(SchemaVersionComment(1)))
+	assert.Equal(t, 12, parseSchemaVersion("xk6-output-clickhouse schema v12"))
+	assert.Equal(t, 0, parseSchemaVersion(""))
+	assert.Equal(t, 0, parseSchemaVersion("load test results"))
+	assert.Equal(t, 0, parseSchemaVersion("xk6-output-clickhouse schema vX"))
+	assert.Equal(t, 0, parseSchemaVersion("xk6-output-clickhouse schema v-1"))
+}
+
+func TestSchemas_CreateTableMarksVersion(t *testing.T) {
+	t.Parallel()
+
+	for _, schema := range []TableCreator{SimpleSchema{}, CompatibleSchema{}} {
+		fake, db := newFakeDB(t)
+		require.NoError(t, schema.CreateTable(context.Background(), db, "k6", "samples"))
+		assert.Contains(t, fake.DDL()[0], "COMMENT '"+SchemaVersionComment(1)+"'")
+	}
+}
+
+func TestStart_MigratesUnversionedTable(t *testing.T) {
+	t.Parallel()
+
+	fake, out := newFakeOutput(t, output.Params{})
+	tb := simpleTable()
+	tb.columns = tb.columns[:3]
+	fake.set(func(f *fakeDB) { f.tables = map[string]fakeTable{"samples": tb} })
+
+	require.NoError(t, out.Start())
+	require.NoError(t, out.Stop())
+
+	ddl := fake.DDL()
+	require.Len(t, ddl, 4)
+	assert.Contains(t, ddl[2], "ALTER TABLE `k6`.`samples` ADD COLUMN IF NOT EXISTS timestamp DateTime64(3), ")
+	assert.Contains(t, ddl[2], "ADD COLUMN IF NOT EXISTS tags Map(String, String)")
+	assert.Equal(t, "ALTER TABLE `k6`.`samples` MODIFY COMMENT '"+SchemaVersionComment(1)+"'", ddl[3])
+}
+
+func TestMigrateTable(t *testing.T) {
+	t.Parallel()
+
+	migrate := func(t *testing.T, comment string, m *recordingMigrator) ([]string, error) {
+		t.Helper()
+
+		fake, db := newFakeDB(t)
+		fake.set(func(f *fakeDB) {
+			f.tables = map[string]fakeTable{"samples": {engine: "MergeTree", comment: comment}}
+		})
+		o := &Output{config: NewConfig(), logger: newTestLogger(t)}
+		err := o.migrateTable(context.Background(), db, &schemaTarget{mode: "custom", table: "samples", schema: m})
+		return fake.DDL(), err
+	}
+
+	t.Run("older version", func(t *testing.T) {
+		t.Parallel()
+
+		m := &recordingMigrator{version: 3}
+		ddl, err := migrate(t, SchemaVersionComment(1), m)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1}, m.from)
+		assert.Equal(t, []string{"ALTER TABLE `k6`.`samples` MODIFY COMMENT '" + SchemaVersionComment(3) + "'"}, ddl)
+	})
+
+	t.Run("current version", func(t *testing.T) {
+		t.Parallel()
+
+		m := &recordingMigrator{version: 3}
+		ddl, err := migrate(t, SchemaVersionComment(3), m)
+		require.NoError(t, err)
+		assert.Empty(t, m.from)
+		assert.Empty(t, ddl)
+	})
+
+	t.Run("newer version is left as is", func(t *testing.T) {
+		t.Parallel()
+
+		m := &recordingMigrator{version: 3}
+		ddl, err := migrate(t, SchemaVersionComment(4), m)
+		require.NoError(t, err)
+		assert.Empty(t, m.from)
+		assert.Empty(t, ddl)
+	})
+
+	t.Run("failed migration keeps the marker", func(t *testing.T) {
+		t.Parallel()
+
+		m := &recordingMigrator{version: 2, err: errors.New("boom")}
+		ddl, err := migrate(t, "", m)
+		require.EqualError(t, err, "schema custom: failed to migrate samples from version 0 to 2: boom")
+		assert.Equal(t, []int{0}, m.from)
+		assert.Empty(t, ddl)
+	})
+
+	t.Run("unversioned schema", func(t *testing.T) {
+		t.Parallel()
+
+		fake, db := newFakeDB(t)
+		fake.set(func(f *fakeDB) { f.tables = map[string]fakeTable{"samples": {engine: "MergeTree"}} })
+		o := &Output{config: NewConfig(), logger: newTestLogger(t)}
+		target := &schemaTarget{mode: "legacy", table: "samples", schema: struct{ SchemaCreator }{SimpleSchema{}}}
+		require.NoError(t, o.migrateTable(context.Background(), db, target))
+		assert.Empty(t, fake.DDL())
+	})
+}
@@ -16,6 +16,34 @@ var SimpleSchemaImpl = SchemaImplementation{
 	Name:      "simple",
 	Schema:    SimpleSchema{},
 	Converter: SimpleConverter{},
+	Configure: configureSimple,
+}
+
+// configureSimple applies the output configuration to the simple schema.
+func configureSimple(cfg Config) (SchemaImplementation, error) {
+	return SchemaImplementation{
+		Name: "simple",
+		Schema: SimpleSchema{
+			tagStorage:   cfg.TagStorage,
+			seriesID:     cfg.SeriesIDColumn,
+			counterDelta: cfg.counterDelta(),
+			rateBool:     cfg.RateBoolColumn,
+			builtin:      cfg.BuiltinColumn,
+			ingestedAt:   cfg.IngestedAtColumn,
+			materialized: cfg.MaterializedColumns,
+			engine:       cfg.TableEngine,
+			partitionBy:  cfg.PartitionBy,
+		},
+		Converter: SimpleConverter{
+			tagStorage:   cfg.TagStorage,
+			seriesID:     cfg.SeriesIDColumn,
+			counterDelta: cfg.counterDelta(),
+			rateBool:     cfg.RateBoolColumn,
+			builtin:      cfg.BuiltinColumn,
+			builtinSet:   cfg.builtinMetrics,
+			versioned:    versioned(cfg.TableEngine),
+		},
+	}, nil
 }
 
 func init() {
@@ -34,10 +62,62 @@ func init() {
 //	) ENGINE = MergeTree()
 //	PARTITION BY toYYYYMMDD(timestamp)
 //	ORDER BY (metric, timestamp)
-type SimpleSchema struct{}
+//
+// With tagStorage=json, tags is declared as the native JSON type; with
+// tagStorage=string, as a String holding a JSON object. With seriesIdColumn,
+// a series_id UInt64 column follows tags, with counterMode=delta, a delta
+// Float64 column, with rateBoolColumn, a rate Bool column, and with
+// builtinColumn, a builtin Bool column. With
+// ingestedAtColumn, an
+// ingested_at DateTime DEFAULT now() column follows, and the
+// materializedColumns end the table.
+// With tableEngine=ReplacingMergeTree, a row_version UInt64 column follows
+// tags (and series_id) and the sorting key covers every column. With partitionBy=testid or
+// testid_time, the partition key starts with the testid tag.
+type SimpleSchema struct {
+	// tagStorage is the column type of tags (TagStorageMap, TagStorageJSON,
+	// or TagStorageString).
+	tagStorage string
+
+	// seriesID adds the series_id column (see SeriesID).
+	seriesID bool
+
+	// counterDelta adds the delta column (see CounterModeDelta).
+	counterDelta bool
+
+	// rateBool adds the rate column (see RateBoolColumn).
+	rateBool bool
+
+	// builtin adds the builtin column (see BuiltinColumn).
+	builtin bool
+
+	// ingestedAt adds the server-filled ingested_at column.
+	ingestedAt bool
+
+	// materialized holds the MATERIALIZED columns' expressions by name.
+	materialized map[string]string
+
+	// engine is the table engine (EngineMergeTree when empty).
+	engine string
+
+	// partitionBy is the partition key (PartitionByTime when empty).
+	partitionBy string
+}
 
 // CreateSchema creates the database and table for the simple schema.
 func (s SimpleSchema) CreateSchema(ctx context.Context, db *sql.DB, database, table string) error {
+	// Defense-in-depth: Validate identifiers before creating anything
+	if !isValidIdentifier(table) {
+		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
+	}
+	if err := createDatabase(ctx, db, database); err != nil {
+		return err
+	}
+	return s.CreateTable(ctx, db, database, table)
+}
+
+// CreateTable creates the table for the simple schema in an existing database.
+func (s SimpleSchema) CreateTable(ctx context.Context, db *sql.DB, database, table string) error {
 	// Defense-in-depth: Validate identifiers before using them
 	if !isValidIdentifier(database) {
 		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", database)
@@ -46,37 +126,112 @@ func (s SimpleSchema) CreateSchema(ctx context.Context, db *sql.DB, database, ta
 		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
 	}
 
-	// Create database
-	_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", escapeIdentifier(database)))
+	// Create table
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s.%s (%s
+		) ENGINE = %s
+		PARTITION BY %s
+		ORDER BY %s
+		%s
+	`, escapeIdentifier(database), escapeIdentifier(table), s.columnsDDL(), engineDDL(s.engine),
+		partitionByDDL(s.partitionBy, "toYYYYMMDD(timestamp)", s.testidDDL()), orderByDDL(s.engine, "metric, timestamp", []string{"tags"}),
+		schemaVersionDDL(simpleSchemaVersion))
+
+	if s.tagStorage == TagStorageJSON {
+		ctx = jsonTypeContext(ctx)
+	}
+
+	_, err := db.ExecContext(ctx, query)
 	if err != nil {
-		return fmt.Errorf("failed to create database: %w", err)
+		return fmt.Errorf("failed to create table: %w", err)
 	}
 
-	// Create table
-	query := fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s.%s (
+	return nil
+}
+
+// columnsDDL returns the column definitions of the table.
+func (s SimpleSchema) columnsDDL() string {
+	return fmt.Sprintf(`
 			timestamp DateTime64(%d),
 			metric LowCardinality(String),
 			value Float64,
-			tags Map(String, String)
-		) ENGINE = MergeTree()
-		PARTITION BY toYYYYMMDD(timestamp)
-		ORDER BY (metric, timestamp)
-	`, escapeIdentifier(database), escapeIdentifier(table), TimestampPrecision)
+			tags %s%s%s%s%s%s%s`, TimestampPrecision, s.tagsDDL(), seriesIDDDL(s.seriesID),
+		deltaColumnDDL(s.counterDelta), rateColumnDDL(s.rateBool), builtinColumnDDL(s.builtin),
+		rowVersionDDL(s.engine), ingestedAtDDL(s.ingestedAt)) + materializedColumnsDDL(s.materialized)
+}
 
-	_, err = db.ExecContext(ctx, query)
-	if err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
+// Validate checks that an existing table has the columns and engine of the
+// simple schema.
+func (s SimpleSchema) Validate(ctx context.Context, db *sql.DB, database, table string) error {
+	return validateTable(ctx, db, database, table, s.columnsDDL(), engineDDL(s.engine))
+}
+
+// SchemaVersion returns the version of the simple schema's table.
+func (s SimpleSchema) SchemaVersion() int { return simpleSchemaVersion }
+
+// Migrate upgrades a simple schema table. A table created before versioning
+// gets the columns it lacks, such as those of options enabled since.
+func (s SimpleSchema) Migrate(ctx context.Context, db *sql.DB, database, table string, fromVersion int) error {
+	if fromVersion >= 1 {
+		return nil
+	}
+	if s.tagStorage == TagStorageJSON {
+		ctx = jsonTypeContext(ctx)
 	}
+	return addMissingColumns(ctx, db, database, table, s.columnsDDL())
+}
 
-	return nil
+// tagsDDL returns the type of the tags column.
+func (s SimpleSchema) tagsDDL() string {
+	switch s.tagStorage {
+	case TagStorageJSON:
+		return "JSON"
+	case TagStorageString:
+		return "String"
+	default:
+		return "Map(String, String)"
+	}
+}
+
+// testidDDL returns the expression reading the testid tag.
+func (s SimpleSchema) testidDDL() string {
+	switch s.tagStorage {
+	case TagStorageJSON:
+		return "JSONExtractString(toString(tags), 'testid')"
+	case TagStorageString:
+		return "JSONExtractString(tags, 'testid')"
+	default:
+		return "tags['testid']"
+	}
 }
 
 // InsertQuery returns the INSERT statement for the simple schema.
 func (s SimpleSchema) InsertQuery(database, table string) string {
-	return fmt.Sprintf(
-		"INSERT INTO %s.%s (timestamp, metric, value, tags) VALUES (?, ?, ?, ?)",
-		escapeIdentifier(database), escapeIdentifier(table))
+	return buildInsertQuery(database, table,
+		simpleColumns(s.seriesID, s.counterDelta, s.rateBool, s.builtin, versioned(s.engine)))
+}
+
+// simpleColumns returns the inserted columns of the simple schema, in row
+// order; seriesID adds series_id, counterDelta adds delta, rateBool adds
+// rate, builtin adds builtin, and versioned tables add row_version.
+func simpleColumns(seriesID, counterDelta, rateBool, builtin, versioned bool) []string {
+	columns := []string{"timestamp", "metric", "value", "tags"}
+	if seriesID {
+		columns = append(columns, seriesIDColumn)
+	}
+	if counterDelta {
+		columns = append(columns, deltaColumn)
+	}
+	if rateBool {
+		columns = append(columns, rateColumn)
+	}
+	if builtin {
+		columns = append(columns, builtinColumn)
+	}
+	if versioned {
+		columns = append(columns, rowVersionColumn)
+	}
+	return columns
 }
 
 // simpleSample represents a sample for the simple schema.
@@ -109,22 +264,84 @@ func convertToSimple(sample metrics.Sample) simpleSample {
 
 // SimpleConverter implements SampleConverter for the simple schema.
 // All k6 tags are stored as-is in the tags Map column.
-type SimpleConverter struct{}
+type SimpleConverter struct {
+	// tagStorage selects how tags are written; TagStorageString encodes them
+	// as a JSON object, every other value passes the map through.
+	tagStorage string
+
+	// seriesID appends the SeriesID of each sample.
+	seriesID bool
+
+	// counterDelta appends the increase of aggregated Counter samples (see
+	// CounterModeDelta).
+	counterDelta bool
+
+	// rateBool moves the outcome of Rate samples to the rate column (see
+	// RateBoolColumn).
+	rateBool bool
+
+	// builtin appends whether each sample belongs to a builtin metric,
+	// recognized by builtinSet (see BuiltinColumn).
+	builtin    bool
+	builtinSet builtinMetricSet
+
+	// versioned appends the row_version set on the context (see
+	// withRowVersion) to each row.
+	versioned bool
+}
 
 // Convert transforms a k6 sample into a row for the simple schema.
 func (c SimpleConverter) Convert(ctx context.Context, sample metrics.Sample) ([]any, error) {
 	ss := convertToSimple(sample)
 
-	// Get row buffer from pool
-	row := simpleRowPool.Get().([]any)
+	var tags any = ss.Tags
+	if c.tagStorage == TagStorageString {
+		encoded, err := encodeTags(ss.Tags)
+		tagMapPool.Put(ss.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode tags: %w", err)
+		}
+		tags = encoded
+	}
+
+	// Get row buffer from pool; rows with optional columns are longer
+	var row []any
+	value := ss.Value
+	if c.seriesID || c.counterDelta || c.rateBool || c.builtin || c.versioned {
+		row = make([]any, 4, 9)
+		if c.seriesID {
+			row = append(row, sampleSeriesID(sample))
+		}
+		if c.counterDelta {
+			row = append(row, sampleDelta(sample))
+		}
+		if c.rateBool {
+			var passed bool
+			value, passed = rateValue(sample)
+			row = append(row, passed)
+		}
+		if c.builtin {
+			row = append(row, c.builtinSet.isBuiltinSample(sample))
+		}
+		if c.versioned {
+			row = append(row, rowVersion(ctx))
+		}
+	} else {
+		row = simpleRowPool.Get().([]any)
+	}
 	row[0] = ss.Timestamp
 	row[1] = ss.Metric
-	row[2] = ss.Value
-	row[3] = ss.Tags
+	row[2] = value
+	row[3] = tags
 
 	return row, nil
 }
 
+// ColumnNames returns the columns of the rows Convert returns.
+func (c SimpleConverter) ColumnNames() []string {
+	return simpleColumns(c.seriesID, c.counterDelta, c.rateBool, c.builtin, c.versioned)
+}
+
 // Release returns pooled resources after insertion.
 func (c SimpleConverter) Release(row []any) {
 	// Return tag map to pool
@@ -133,6 +350,9 @@ func (c SimpleConverter) Release(row []any) {
 			tagMapPool.Put(tags)
 		}
 	}
-	// Return row buffer to pool
+	// Return row buffer to pool; longer rows are not pooled
+	if len(row) != 4 {
+		return
+	}
 	simpleRowPool.Put(row) //nolint:staticcheck // SA6002: pooling a []any boxes the slice header into 'any' (one alloc per Put); accepted to keep the SampleConverter interface stable
 }
@@ -0,0 +1,267 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// StarSchemaImpl is the normalized star schema implementation. The fact
+// table holds only (series_id, timestamp, value); each distinct series
+// (metric and tags) is written once to the SeriesTable dimension table, which
+// shrinks storage when the same tag sets repeat across millions of samples.
+var StarSchemaImpl = SchemaImplementation{
+	Name:      "star",
+	Schema:    StarSchema{table: "series"},
+	Converter: StarConverter{},
+	Configure: configureStar,
+}
+
+// configureStar gives each target its own series catalog, shared by its
+// schema and converter.
+func configureStar(cfg Config) (SchemaImplementation, error) {
+	catalog := newSeriesCatalog()
+	return SchemaImplementation{
+		Name:      "star",
+		Schema:    StarSchema{table: cfg.SeriesTable, catalog: catalog},
+		Converter: StarConverter{catalog: catalog},
+	}, nil
+}
+
+func init() {
+	RegisterSchema(StarSchemaImpl)
+}
+
+// StarSchema implements SchemaCreator for the star schema.
+//
+// Schema structure (the dimension table is Config.SeriesTable):
+//
+//	CREATE TABLE {db}.{table} (
+//	    series_id UInt64,
+//	    timestamp DateTime64(3),
+//	    value Float64
+//	) ENGINE = MergeTree()
+//	PARTITION BY toYYYYMMDD(timestamp)
+//	ORDER BY (series_id, timestamp)
+//
+//	CREATE TABLE {db}.series (
+//	    series_id UInt64,
+//	    metric LowCardinality(String),
+//	    metric_type LowCardinality(String),
+//	    tags Map(LowCardinality(String), String) CODEC(ZSTD(1)),
+//	    first_seen DateTime64(3) DEFAULT now64(3)
+//	) ENGINE = ReplacingMergeTree()
+//	ORDER BY series_id
+//
+// series_id is the SeriesID of the sample. The dimension table's
+// ReplacingMergeTree collapses the rows written again by later runs.
+type StarSchema struct {
+	// table is the dimension table.
+	table string
+
+	// catalog holds the series not yet written to table; nil for a schema
+	// that was not configured, which writes no series.
+	catalog *seriesCatalog
+}
+
+// CreateSchema creates the database and the star schema's tables.
+func (s StarSchema) CreateSchema(ctx context.Context, db *sql.DB, database, table string) error {
+	if !isValidIdentifier(table) {
+		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
+	}
+	if err := createDatabase(ctx, db, database); err != nil {
+		return err
+	}
+	return s.CreateTable(ctx, db, database, table)
+}
+
+// CreateTable creates the fact and dimension tables in an existing database.
+func (s StarSchema) CreateTable(ctx context.Context, db *sql.DB, database, table string) error {
+	if !isValidIdentifier(database) {
+		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", database)
+	}
+	for _, name := range []string{table, s.table} {
+		if !isValidIdentifier(name) {
+			return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", name)
+		}
+	}
+
+	//nolint:gosec // G201: identifiers are validated with isValidIdentifier() and escaped with backticks
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s.%s (%s
+		) ENGINE = MergeTree()
+		PARTITION BY toYYYYMMDD(timestamp)
+		ORDER BY (series_id, timestamp)
+	`, escapeIdentifier(database), escapeIdentifier(table), starFactDDL())
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	//nolint:gosec // G201: identifiers are validated with isValidIdentifier() and escaped with backticks
+	query = fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s.%s (%s
+		) ENGINE = ReplacingMergeTree()
+		ORDER BY series_id
+	`, escapeIdentifier(database), escapeIdentifier(s.table), starSeriesDDL())
+	if _, err := db.ExecContext(ctx, query); err != nil && !createdConcurrently(err) {
+		return fmt.Errorf("failed to create series table: %w", err)
+	}
+	return nil
+}
+
+// starFactDDL returns the column definitions of the fact table.
+func starFactDDL() string {
+	return fmt.Sprintf(`
+			series_id UInt64,
+			timestamp DateTime64(%d),
+			value Float64`, TimestampPrecision)
+}
+
+// starSeriesDDL returns the column definitions of the dimension table.
+func starSeriesDDL() string {
+	return fmt.Sprintf(`
+			series_id UInt64,
+			metric LowCardinality(String),
+			metric_type LowCardinality(String),
+			tags Map(LowCardinality(String), String) CODEC(ZSTD(1)),
+			first_seen DateTime64(%d) DEFAULT now64(%d)`, TimestampPrecision, TimestampPrecision)
+}
+
+// Validate checks that the existing fact and dimension tables have the
+// columns and engines of the star schema.
+func (s StarSchema) Validate(ctx context.Context, db *sql.DB, database, table string) error {
+	if err := validateTable(ctx, db, database, table, starFactDDL(), "MergeTree()"); err != nil {
+		return err
+	}
+	return validateTable(ctx, db, database, s.table, starSeriesDDL(), "ReplacingMergeTree()")
+}
+
+// InsertQuery returns the INSERT statement of the fact table.
+func (s StarSchema) InsertQuery(database, table string) string {
+	return buildInsertQuery(database, table, starColumns)
+}
+
+// starColumns are the inserted columns of the fact table, in row order.
+var starColumns = []string{"series_id", "timestamp", "value"}
+
+// StarConverter implements SampleConverter for the star schema. It records
+// each series it has not seen for the dimension table and returns the fact
+// row.
+type StarConverter struct {
+	catalog *seriesCatalog
+}
+
+// Convert transforms a k6 sample into a fact row.
+func (c StarConverter) Convert(_ context.Context, sample metrics.Sample) ([]any, error) {
+	if sample.Metric == nil {
+		return nil, errors.New("sample has no metric")
+	}
+	var tags map[string]string
+	if sample.Tags != nil {
+		tags = sample.Tags.Map()
+	}
+	id := SeriesID(sample.Metric.Name, tags)
+	if c.catalog != nil {
+		c.catalog.record(id, sample.Metric, tags)
+	}
+	return []any{id, sample.Time, sample.Value}, nil
+}
+
+// ColumnNames returns the columns of the rows Convert returns.
+func (c StarConverter) ColumnNames() []string {
+	return starColumns
+}
+
+// Release is a no-op: rows are not pooled.
+func (c StarConverter) Release([]any) {}
+
+// seriesRow is one series definition recorded for the dimension table.
+type seriesRow struct {
+	id         uint64
+	metric     string
+	metricType string
+	tags       map[string]string
+}
+
+// seriesCatalog records the series a run has seen and queues the new ones
+// until they are written.
+type seriesCatalog struct {
+	mu      sync.Mutex
+	seen    map[uint64]struct{}
+	pending pendingRows[seriesRow]
+}
+
+// newSeriesCatalog returns an empty catalog.
+func newSeriesCatalog() *seriesCatalog {
+	return &seriesCatalog{seen: make(map[uint64]struct{})}
+}
+
+// record queues a series unless it was already seen. tags must not be
+// modified afterwards.
+func (c *seriesCatalog) record(id uint64, metric *metrics.Metric, tags map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.seen[id]; ok {
+		return
+	}
+	c.seen[id] = struct{}{}
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	c.pending.add(seriesRow{id: id, metric: metric.Name, metricType: metric.Type.String(), tags: tags})
+}
+
+// starSchema returns the star schema of t, if it has one.
+func starSchema(t *schemaTarget) (StarSchema, bool) {
+	s, ok := t.schema.(StarSchema)
+	return s, ok && s.catalog != nil
+}
+
+// writeSeries inserts series definitions into the dimension table in one
+// batch.
+func writeSeries(ctx context.Context, db *sql.DB, database, table string, rows []seriesRow) error {
+	if db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	batch, err := prepareInsert(ctx, db, nil, fmt.Sprintf(
+		"INSERT INTO %s.%s (series_id, metric, metric_type, tags) VALUES (?, ?, ?, ?)",
+		escapeIdentifier(database), escapeIdentifier(table)))
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		if err := batch.append(ctx, r.id, r.metric, r.metricType, r.tags); err != nil {
+			batch.abort()
+			return fmt.Errorf("failed to insert series row: %w", err)
+		}
+	}
+	if err := batch.send(); err != nil {
+		return fmt.Errorf("failed to send series rows: %w", err)
+	}
+	return nil
+}
+
+// flushSeries writes the series the star schema targets recorded since the
+// last flush. Failures are logged and the series retried on the next flush;
+// they never fail the samples.
+func (o *Output) flushSeries(ctx context.Context, targets []*schemaTarget) {
+	for _, t := range targets {
+		s, ok := starSchema(t)
+		if !ok {
+			continue
+		}
+		flushPendingRows(o, &s.catalog.pending, s.table, "series", func(rows []seriesRow) error {
+			o.mu.RLock()
+			db := o.db
+			o.mu.RUnlock()
+			return writeSeries(o.config.insertContext(ctx), db, o.config.Database, s.table, rows)
+		})
+	}
+}
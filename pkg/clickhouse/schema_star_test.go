@@ -0,0 +1,108 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+func TestStarSchema_CreateTable(t *testing.T) {
+	t.Parallel()
+
+	impl, err := configureStar(NewConfig())
+	require.NoError(t, err)
+
+	fake, db := newFakeDB(t)
+	require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	ddl := fake.DDL()
+	require.Len(t, ddl, 3)
+	assert.Contains(t, ddl[1], "CREATE TABLE IF NOT EXISTS `k6`.`samples`")
+	assert.Contains(t, ddl[1], "ORDER BY (series_id, timestamp)")
+	assert.Contains(t, ddl[2], "CREATE TABLE IF NOT EXISTS `k6`.`series`")
+	assert.Contains(t, ddl[2], "tags Map(LowCardinality(String), String)")
+	assert.Contains(t, ddl[2], "ENGINE = ReplacingMergeTree()")
+
+	assert.Equal(t, "INSERT INTO `k6`.`samples` (series_id, timestamp, value) VALUES (?, ?, ?)",
+		impl.Schema.InsertQuery("k6", "samples"))
+
+	err = StarSchema{table: "bad-name"}.CreateTable(context.Background(), db, "k6", "samples")
+	require.EqualError(t, err, "invalid table name: bad-name (must be alphanumeric + underscore, max 63 chars)")
+}
+
+func TestStarConverter_RecordsSeriesOnce(t *testing.T) {
+	t.Parallel()
+
+	impl, err := configureStar(NewConfig())
+	require.NoError(t, err)
+	catalog := impl.Schema.(StarSchema).catalog
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("http_reqs", metrics.Counter)
+	tags := map[string]string{"status": "200"}
+	sample := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet().WithTagsFromMap(tags)},
+		Value:      1,
+	}
+
+	for range 3 {
+		row, err := impl.Converter.Convert(context.Background(), sample)
+		require.NoError(t, err)
+		assert.Equal(t, []any{SeriesID("http_reqs", tags), sample.Time, 1.0}, row)
+	}
+	pending := catalog.pending.take()
+	assert.Equal(t, []seriesRow{{id: SeriesID("http_reqs", tags), metric: "http_reqs", metricType: "counter", tags: tags}},
+		pending)
+
+	// A requeued series is written again, but not recorded twice
+	catalog.pending.requeue(pending)
+	_, err = impl.Converter.Convert(context.Background(), sample)
+	require.NoError(t, err)
+	assert.Len(t, catalog.pending.take(), 1)
+}
+
+func TestOutput_StarSchema(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"schemaMode":   "star",
+		"seriesTable":  "k6_series",
+		"pushInterval": "1h",
+	})
+	assert.Contains(t, fake.DDL()[2], "`k6`.`k6_series`")
+
+	// A failed series write is retried on the next flush
+	fake.set(func(f *fakeDB) { f.commitErr = errors.New("boom") })
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	fake.set(func(f *fakeDB) { f.commitErr = nil })
+	require.Empty(t, fake.Rows())
+
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	rows := fake.Rows()
+	require.Len(t, rows, 3, "two fact rows, one series row")
+	assert.Len(t, rows[0], 3)
+	assert.Equal(t, rows[0][0], rows[2][0])
+	assert.Equal(t, []any{"http_reqs", "counter", map[string]string{"status": "200"}}, rows[2][1:])
+	assert.Contains(t, fake.Prepared(), "INSERT INTO `k6`.`k6_series` (series_id, metric, metric_type, tags) VALUES (?, ?, ?, ?)")
+}
+
+func TestConfig_SeriesTable(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.SchemaMode = "star"
+	cfg.SeriesTable = "samples"
+	cfg.Table = "samples"
+	require.ErrorContains(t, cfg.Validate(), "seriesTable samples must differ from table")
+
+	cfg.SeriesTable = ""
+	require.ErrorContains(t, cfg.Validate(), `invalid seriesTable: ""`)
+
+	cfg.SchemaMode = "simple"
+	require.NoError(t, cfg.Validate(), "only the star schema uses seriesTable")
+}
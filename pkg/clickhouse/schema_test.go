@@ -5,10 +5,14 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.k6.io/k6/v2/metrics"
 )
 
@@ -121,6 +125,54 @@ func TestSchema_InsertQuery(t *testing.T) {
 	}
 }
 
+func TestConverters_ColumnNames(t *testing.T) {
+	t.Parallel()
+
+	extended := NewCompatibleSchemaImpl("compatible_tenant", ExtraColumn{
+		Name:  "tenant",
+		Type:  "LowCardinality(String) DEFAULT ''",
+		Value: func(metrics.Sample, map[string]string) (any, error) { return "", nil },
+	})
+	configs := map[string]func(*Config){
+		"defaults":  func(*Config) {},
+		"replacing": func(c *Config) { c.TableEngine = EngineReplacingMergeTree },
+		"all columns": func(c *Config) {
+			c.TypedExtraTags, c.GRPCColumns, c.WSColumns, c.ProtocolColumn, c.ErrorNameColumn = true, true, true, true, true
+			c.HostnameColumn, c.VUColumns, c.SeriesIDColumn = true, true, true
+		},
+	}
+
+	registry := metrics.NewRegistry()
+	sample := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: registry.MustNewMetric("http_reqs", metrics.Counter),
+			Tags:   registry.RootTagSet(),
+		},
+		Time:  time.Now(),
+		Value: 1,
+	}
+
+	for name, configure := range configs {
+		cfg := NewConfig()
+		configure(&cfg)
+		for _, impl := range []SchemaImplementation{SimpleSchemaImpl, CompatibleSchemaImpl, extended} {
+			configured, err := impl.Configure(cfg)
+			require.NoError(t, err)
+
+			columns := configured.Converter.(ColumnNamer).ColumnNames()
+			fromQuery, err := insertColumns(configured.Schema.InsertQuery("k6", "samples"))
+			require.NoError(t, err)
+			assert.Equal(t, fromQuery, columns, "%s/%s", impl.Name, name)
+
+			ctx := withRowVersion(context.Background(), 1)
+			row, err := configured.Converter.Convert(ctx, sample)
+			require.NoError(t, err)
+			assert.Len(t, row, len(columns), "%s/%s", impl.Name, name)
+			configured.Converter.Release(row)
+		}
+	}
+}
+
 func TestConvertToSimple(t *testing.T) {
 	t.Parallel()
 
@@ -267,7 +319,7 @@ func TestConvertToCompatible(t *testing.T) {
 			Value: 1.0,
 		}
 
-		cs, err := convertToCompatible(sample, 12345)
+		cs, err := convertToCompatible(sample, newCompatibleDefaults(12345))
 		assert.NoError(t, err)
 		assert.Equal(t, uint32(123), cs.BuildID)
 		assert.Equal(t, uint16(200), cs.Status)
@@ -289,7 +341,7 @@ func TestConvertToCompatible(t *testing.T) {
 			Value: 1.0,
 		}
 
-		_, err := convertToCompatible(sample, 12345)
+		_, err := convertToCompatible(sample, newCompatibleDefaults(12345))
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "failed to parse buildId")
 	})
@@ -310,7 +362,7 @@ func TestConvertToCompatible(t *testing.T) {
 			Value: 1.0,
 		}
 
-		_, err := convertToCompatible(sample, 12345)
+		_, err := convertToCompatible(sample, newCompatibleDefaults(12345))
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "failed to parse status")
 	})
@@ -530,7 +582,7 @@ func TestConvertToCompatibleEdgeCases(t *testing.T) {
 			t.Parallel()
 
 			sample := tt.setupSample()
-			result, err := convertToCompatible(sample, 12345)
+			result, err := convertToCompatible(sample, newCompatibleDefaults(12345))
 
 			tt.checkResult(t, result, err)
 		})
@@ -601,6 +653,524 @@ func TestCompatibleConverter_Convert(t *testing.T) {
 	})
 }
 
+func TestSplitTypedTags(t *testing.T) {
+	t.Parallel()
+
+	tags := map[string]string{
+		"user_tier":  "gold",
+		"cart_items": "3",
+		"ratio":      "0.25",
+		"negative":   "-7",
+		"cached":     "true",
+		"retried":    "false",
+		"bool_like":  "TRUE",
+		"nan":        "NaN",
+		"inf":        "Inf",
+	}
+
+	num, bools := splitTypedTags(tags)
+
+	assert.Equal(t, map[string]float64{"cart_items": 3, "ratio": 0.25, "negative": -7}, num)
+	assert.Equal(t, map[string]bool{"cached": true, "retried": false}, bools)
+	assert.Equal(t, map[string]string{
+		"user_tier": "gold",
+		"bool_like": "TRUE",
+		"nan":       "NaN",
+		"inf":       "Inf",
+	}, tags, "only typed values are moved out of extra_tags")
+}
+
+func TestCompatibleSchema_TypedExtraTags(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.TypedExtraTags = true
+	impl, err := configureCompatible(cfg)
+	assert.NoError(t, err)
+
+	t.Run("ddl and insert include typed columns", func(t *testing.T) {
+		t.Parallel()
+
+		fake, db := newFakeDB(t)
+		assert.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		ddl := fake.DDL()
+		assert.Len(t, ddl, 2)
+		assert.Contains(t, ddl[1], "extra_tags_num    Map(LowCardinality(String), Float64)")
+		assert.Contains(t, ddl[1], "extra_tags_bool   Map(LowCardinality(String), Bool)")
+
+		query := impl.Schema.InsertQuery("k6", "samples")
+		assert.Contains(t, query, "extra_tags, extra_tags_num, extra_tags_bool")
+		assert.Equal(t, 23, strings.Count(query, "?"))
+	})
+
+	t.Run("row carries typed maps", func(t *testing.T) {
+		t.Parallel()
+
+		registry := metrics.NewRegistry()
+		sample := metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: registry.MustNewMetric("checkout", metrics.Trend),
+				Tags: registry.RootTagSet().WithTagsFromMap(map[string]string{
+					"method":     "POST",
+					"cart_items": "3",
+					"cached":     "true",
+					"user_tier":  "gold",
+				}),
+			},
+			Time:  time.Now(),
+			Value: 1.0,
+		}
+
+		row, err := impl.Converter.Convert(context.Background(), sample)
+		assert.NoError(t, err)
+		assert.Len(t, row, 23)
+		assert.Equal(t, "POST", row[11])
+		assert.Equal(t, map[string]string{"user_tier": "gold"}, row[20])
+		assert.Equal(t, map[string]float64{"cart_items": 3}, row[21])
+		assert.Equal(t, map[string]bool{"cached": true}, row[22])
+		impl.Converter.Release(row)
+	})
+
+	t.Run("disabled keeps base layout", func(t *testing.T) {
+		t.Parallel()
+
+		base, err := configureCompatible(NewConfig())
+		assert.NoError(t, err)
+		assert.NotContains(t, base.Schema.InsertQuery("k6", "samples"), "extra_tags_num")
+	})
+}
+
+func TestCompatibleSchema_GRPCColumns(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.TypedExtraTags = true
+	cfg.GRPCColumns = true
+	impl, err := configureCompatible(cfg)
+	assert.NoError(t, err)
+
+	t.Run("ddl and insert include gRPC columns", func(t *testing.T) {
+		t.Parallel()
+
+		fake, db := newFakeDB(t)
+		assert.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		ddl := fake.DDL()
+		assert.Len(t, ddl, 2)
+		assert.Contains(t, ddl[1], "grpc_service      LowCardinality(String) DEFAULT ''")
+		assert.Contains(t, ddl[1], "grpc_status       Int8 DEFAULT -1")
+
+		query := impl.Schema.InsertQuery("k6", "samples")
+		assert.Contains(t, query, "extra_tags_bool, grpc_service, grpc_status")
+		assert.Equal(t, 25, strings.Count(query, "?"))
+	})
+
+	registry := metrics.NewRegistry()
+	convert := func(t *testing.T, metric string, tags map[string]string) []any {
+		t.Helper()
+		row, err := impl.Converter.Convert(context.Background(), metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: registry.MustNewMetric(metric, metrics.Trend),
+				Tags:   registry.RootTagSet().WithTagsFromMap(tags),
+			},
+			Time:  time.Now(),
+			Value: 1.0,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, row, 25)
+		return row
+	}
+
+	t.Run("k6 gRPC call tags", func(t *testing.T) {
+		t.Parallel()
+
+		row := convert(t, "grpc_req_duration", map[string]string{
+			"service": "hello.HelloService",
+			"method":  "SayHello",
+			"status":  "14",
+		})
+		assert.Equal(t, "SayHello", row[11])
+		assert.Equal(t, uint16(0), row[12], "the gRPC code is not an HTTP status")
+		assert.Equal(t, map[string]string{}, row[20])
+		assert.Equal(t, "hello.HelloService", row[23])
+		assert.Equal(t, int8(14), row[24])
+		impl.Converter.Release(row)
+	})
+
+	t.Run("explicit grpc_status and full method", func(t *testing.T) {
+		t.Parallel()
+
+		row := convert(t, "rpc_latency", map[string]string{
+			"method":      "/hello.HelloService/SayHello",
+			"grpc_status": "0",
+		})
+		assert.Equal(t, "SayHello", row[11])
+		assert.Equal(t, "hello.HelloService", row[23])
+		assert.Equal(t, int8(0), row[24])
+		assert.Equal(t, map[string]float64{}, row[21], "grpc_status is not a typed extra tag")
+		impl.Converter.Release(row)
+	})
+
+	t.Run("other samples", func(t *testing.T) {
+		t.Parallel()
+
+		row := convert(t, "http_req_duration", map[string]string{"status": "200", "service": "checkout"})
+		assert.Equal(t, uint16(200), row[12])
+		assert.Equal(t, map[string]string{"service": "checkout"}, row[20])
+		assert.Equal(t, "", row[23])
+		assert.Equal(t, int8(grpcStatusNone), row[24])
+		impl.Converter.Release(row)
+	})
+
+	t.Run("invalid grpc_status", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := impl.Converter.Convert(context.Background(), metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: registry.MustNewMetric("grpc_req_duration", metrics.Trend),
+				Tags:   registry.RootTagSet().With("grpc_status", "UNAVAILABLE"),
+			},
+			Time: time.Now(),
+		})
+		assert.ErrorContains(t, err, "failed to parse grpc_status")
+	})
+}
+
+func TestCompatibleSchema_WSColumns(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.WSColumns = true
+	impl, err := configureCompatible(cfg)
+	assert.NoError(t, err)
+
+	query := impl.Schema.InsertQuery("k6", "samples")
+	assert.Contains(t, query, "extra_tags, ws_url, ws_subprotocol")
+	assert.Equal(t, 23, strings.Count(query, "?"))
+
+	registry := metrics.NewRegistry()
+	tags := registry.RootTagSet().WithTagsFromMap(map[string]string{
+		"url":      "wss://echo.example.com/chat",
+		"status":   "101",
+		"subproto": "chat.v2",
+		"room":     "lobby",
+	})
+	sample := func(metric string) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric(metric, metrics.Counter), Tags: tags},
+			Time:       time.Now(),
+			Value:      1.0,
+		}
+	}
+
+	row, err := impl.Converter.Convert(context.Background(), sample("ws_sessions"))
+	assert.NoError(t, err)
+	assert.Len(t, row, 23)
+	assert.Equal(t, uint16(101), row[12])
+	assert.Equal(t, map[string]string{"room": "lobby"}, row[20])
+	assert.Equal(t, "wss://echo.example.com/chat", row[21])
+	assert.Equal(t, "chat.v2", row[22])
+	impl.Converter.Release(row)
+
+	row, err = impl.Converter.Convert(context.Background(), sample("http_reqs"))
+	assert.NoError(t, err)
+	assert.Equal(t, "wss://echo.example.com/chat", row[20].(map[string]string)["url"], "other protocols keep url in extra_tags")
+	assert.Equal(t, "", row[21])
+	impl.Converter.Release(row)
+}
+
+func TestMetricProtocol(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"http_req_duration":         ProtocolHTTP,
+		"http_reqs":                 ProtocolHTTP,
+		"ws_sessions":               ProtocolWS,
+		"grpc_req_duration":         ProtocolGRPC,
+		"browser_web_vital_lcp":     ProtocolBrowser,
+		"browser_http_req_duration": ProtocolBrowser,
+		"vus":                       ProtocolCustom,
+		"checkout_duration":         ProtocolCustom,
+		"httpbin_calls":             ProtocolCustom,
+	}
+	for metric, expected := range tests {
+		assert.Equal(t, expected, metricProtocol(metric), metric)
+	}
+}
+
+func TestCompatibleSchema_ProtocolColumn(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.WSColumns = true
+	cfg.ProtocolColumn = true
+	impl, err := configureCompatible(cfg)
+	assert.NoError(t, err)
+
+	query := impl.Schema.InsertQuery("k6", "samples")
+	assert.Contains(t, query, "ws_subprotocol, protocol")
+	assert.Equal(t, 24, strings.Count(query, "?"))
+
+	registry := metrics.NewRegistry()
+	row, err := impl.Converter.Convert(context.Background(), metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: registry.MustNewMetric("ws_msgs_sent", metrics.Counter),
+			Tags:   registry.RootTagSet(),
+		},
+		Time:  time.Now(),
+		Value: 1.0,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, row, 24)
+	assert.Equal(t, ProtocolWS, row[23])
+	impl.Converter.Release(row)
+}
+
+func TestCompatibleSchema_GeneratorColumns(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.HostnameColumn = true
+	cfg.VUColumns = true
+	impl, err := configureCompatible(cfg)
+	require.NoError(t, err)
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	fake, db := newFakeDB(t)
+	require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	ddl := fake.DDL()[1]
+	assert.Contains(t, ddl, "hostname          LowCardinality(String) DEFAULT ''")
+	assert.Contains(t, ddl, "vu                UInt32 DEFAULT 0,\n\t\t\titer              UInt64 DEFAULT 0")
+	assert.Contains(t, impl.Schema.InsertQuery("k6", "samples"), "extra_tags, hostname, vu, iter)")
+
+	registry := metrics.NewRegistry()
+	convert := func(tags map[string]string, metadata map[string]string) ([]any, error) {
+		return impl.Converter.Convert(context.Background(), metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: registry.MustNewMetric("http_reqs", metrics.Counter),
+				Tags:   registry.RootTagSet().WithTagsFromMap(tags),
+			},
+			Time:     time.Now(),
+			Value:    1,
+			Metadata: metadata,
+		})
+	}
+
+	row, err := convert(map[string]string{"tier": "gold"}, map[string]string{"vu": "7", "iter": "42"})
+	require.NoError(t, err)
+	require.Len(t, row, 24)
+	assert.Equal(t, []any{hostname, uint32(7), uint64(42)}, row[21:])
+	assert.Equal(t, map[string]string{"tier": "gold"}, row[20])
+	impl.Converter.Release(row)
+
+	// Tags stand in for absent metadata and are not kept in extra_tags
+	row, err = convert(map[string]string{"hostname": "pod-3", "vu": "2"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"pod-3", uint32(2), uint64(0)}, row[21:])
+	assert.Empty(t, row[20])
+	impl.Converter.Release(row)
+
+	_, err = convert(nil, map[string]string{"vu": "-1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse vu")
+}
+
+func TestSchemas_IngestedAtColumn(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.IngestedAtColumn = true
+	for _, configure := range []func(Config) (SchemaImplementation, error){configureSimple, configureCompatible} {
+		impl, err := configure(cfg)
+		assert.NoError(t, err)
+
+		fake, db := newFakeDB(t)
+		assert.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		ddl := fake.DDL()
+		assert.Len(t, ddl, 2)
+		assert.Contains(t, ddl[1], "ingested_at DateTime DEFAULT now()", impl.Name)
+		assert.NotContains(t, impl.Schema.InsertQuery("k6", "samples"), "ingested_at", "the server fills the column")
+	}
+
+	base, err := configureSimple(NewConfig())
+	assert.NoError(t, err)
+	fake, db := newFakeDB(t)
+	assert.NoError(t, base.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	assert.NotContains(t, fake.DDL()[1], "ingested_at")
+}
+
+func TestCompatibleSchema_NullableColumns(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.NullableColumns = true
+	cfg.GRPCColumns = true
+	cfg.StringColumns = []string{"scenario"}
+	impl, err := configureCompatible(cfg)
+	assert.NoError(t, err)
+
+	fake, db := newFakeDB(t)
+	assert.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	ddl := fake.DDL()[1]
+	assert.Contains(t, ddl, "status            Nullable(UInt16),")
+	assert.Contains(t, ddl, "expected_response Nullable(Bool),")
+	assert.Contains(t, ddl, "method            LowCardinality(Nullable(String)),")
+	assert.Contains(t, ddl, "scenario          Nullable(String),")
+	assert.Contains(t, ddl, "name              Nullable(String) CODEC(ZSTD(1)),")
+	assert.Contains(t, ddl, "grpc_status       Nullable(Int8)")
+	assert.Contains(t, ddl, "release           LowCardinality(String) DEFAULT '',", "sorting key columns stay non-nullable")
+
+	registry := metrics.NewRegistry()
+	sample := func(metric string, tags map[string]string) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: registry.MustNewMetric(metric, metrics.Counter),
+				Tags:   registry.RootTagSet().WithTagsFromMap(tags),
+			},
+			Time:  time.Now(),
+			Value: 1,
+		}
+	}
+
+	row, err := impl.Converter.Convert(context.Background(), sample("checks", map[string]string{"check": "status is 200", "scenario": "smoke"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "smoke", row[6])
+	assert.Equal(t, "status is 200", row[18])
+	for _, col := range []int{8, 10, 11, 12, 13, 14, 15, 16, 17, 19} {
+		assert.Nil(t, row[col], "column %d", col)
+	}
+	assert.Equal(t, "default", row[4], "columns with configured defaults keep them")
+	assert.Nil(t, row[22], "grpc_status")
+	impl.Converter.Release(row)
+
+	row, err = impl.Converter.Convert(context.Background(), sample("http_reqs", map[string]string{"status": "0", "method": "GET", "expected_response": "false"}))
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0), row[12], "status 0 is not NULL")
+	assert.Equal(t, "GET", row[11])
+	assert.Equal(t, false, row[13])
+	impl.Converter.Release(row)
+
+	row, err = impl.Converter.Convert(context.Background(), sample("grpc_req_duration", map[string]string{"status": "5", "method": "/pkg.Svc/Get"}))
+	assert.NoError(t, err)
+	assert.Nil(t, row[12], "gRPC codes move out of status")
+	assert.Equal(t, int8(5), row[22])
+	impl.Converter.Release(row)
+
+	// Without the option, absent tags keep their sentinel values
+	row, err = CompatibleConverter{}.Convert(context.Background(), sample("checks", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0), row[12])
+	assert.Equal(t, true, row[13])
+	assert.Equal(t, "", row[11])
+}
+
+func TestNewCompatibleSchemaImpl_ExtraColumns(t *testing.T) {
+	t.Parallel()
+
+	impl := NewCompatibleSchemaImpl("compatible_tenant",
+		ExtraColumn{
+			Name: "tenant",
+			Type: "LowCardinality(String) DEFAULT ''",
+			Value: func(_ metrics.Sample, tags map[string]string) (any, error) {
+				tenant := tags["tenant"]
+				delete(tags, "tenant")
+				return tenant, nil
+			},
+		},
+		ExtraColumn{
+			Name: "shard",
+			Type: "UInt8",
+			Value: func(_ metrics.Sample, tags map[string]string) (any, error) {
+				v, err := strconv.ParseUint(tags["shard"], 10, 8)
+				return uint8(v), err
+			},
+		})
+	assert.Equal(t, "compatible_tenant", impl.Name)
+
+	cfg := NewConfig()
+	cfg.ProtocolColumn = true
+	cfg.TableEngine = EngineReplacingMergeTree
+	configured, err := impl.Configure(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "compatible_tenant", configured.Name)
+
+	schema := configured.Schema.(CompatibleSchema)
+	assert.Equal(t, 25, schema.ColumnCount())
+	query := schema.InsertQuery("k6", "samples")
+	assert.Contains(t, query, "extra_tags, protocol, row_version, tenant, shard")
+	assert.Equal(t, 25, strings.Count(query, "?"))
+
+	fake, db := newFakeDB(t)
+	assert.NoError(t, schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	ddl := fake.DDL()[1]
+	assert.Contains(t, ddl, "tenant LowCardinality(String) DEFAULT '',\n\t\t\tshard UInt8\n")
+	assert.Contains(t, ddl, "extra_tags, protocol, tenant, shard))), value)", "extension columns are part of the identity")
+
+	registry := metrics.NewRegistry()
+	sample := func(tags map[string]string) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: registry.MustNewMetric("http_reqs", metrics.Counter),
+				Tags:   registry.RootTagSet().WithTagsFromMap(tags),
+			},
+			Time:  time.Now(),
+			Value: 1,
+		}
+	}
+
+	converter := configured.Converter.(CompatibleConverter)
+	assert.Equal(t, schema.ColumnCount(), converter.ColumnCount())
+	row, err := converter.Convert(withRowVersion(context.Background(), 7), sample(map[string]string{"tenant": "acme", "shard": "3", "zone": "eu"}))
+	assert.NoError(t, err)
+	assert.Len(t, row, 25)
+	assert.Equal(t, map[string]string{"shard": "3", "zone": "eu"}, row[20], "consumed tags leave extra_tags")
+	assert.Equal(t, ProtocolHTTP, row[21])
+	assert.Equal(t, uint64(7), row[22])
+	assert.Equal(t, "acme", row[23])
+	assert.Equal(t, uint8(3), row[24])
+	converter.Release(row)
+
+	_, err = converter.Convert(context.Background(), sample(map[string]string{"shard": "many"}))
+	assert.ErrorContains(t, err, "failed to convert column shard")
+
+	bad := NewCompatibleSchemaImpl("bad", ExtraColumn{Name: "bad-name", Type: "String"})
+	assert.ErrorContains(t, bad.Schema.(CompatibleSchema).CreateTable(context.Background(), db, "k6", "samples"), "invalid extra column name")
+}
+
+// regionConverter extends the compatible converter by embedding it.
+type regionConverter struct {
+	CompatibleConverter
+}
+
+func (c regionConverter) Convert(ctx context.Context, sample metrics.Sample) ([]any, error) {
+	row, err := c.CompatibleConverter.Convert(ctx, sample)
+	if err != nil {
+		return nil, err
+	}
+	return append(row, "eu-west-1"), nil
+}
+
+func TestCompatibleConverter_Embedding(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	c := regionConverter{}
+	row, err := c.Convert(context.Background(), metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("vus", metrics.Gauge)},
+		Time:       time.Now(),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, row, c.ColumnCount()+1)
+	assert.Equal(t, "eu-west-1", row[c.ColumnCount()])
+	c.Release(row) // Longer rows must not go back to the pool
+
+	row, err = CompatibleConverter{}.Convert(context.Background(), metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("vus", metrics.Gauge)},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, row, compatibleColumnCount)
+}
+
 func TestCompatibleSchema_ErrorWrapping(t *testing.T) {
 	t.Parallel()
 
@@ -671,10 +1241,131 @@ func BenchmarkConvertToCompatible(b *testing.B) {
 
 	b.ResetTimer()
 	for b.Loop() {
-		cs, err := convertToCompatible(sample, 12345)
+		cs, err := convertToCompatible(sample, newCompatibleDefaults(12345))
 		if err != nil {
 			b.Fatal(err)
 		}
 		_ = cs
 	}
 }
+
+func TestCompatibleDefaultsFromConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		want    compatibleDefaults
+		wantErr string
+	}{
+		{"historical defaults", func(*Config) {}, newCompatibleDefaults(777), ""},
+		{"literal values", func(c *Config) {
+			c.TestIDDefault = "adhoc"
+			c.BranchDefault = "main"
+			c.BuildIDDefault = "42"
+		}, compatibleDefaults{testID: tagDefault{value: "adhoc"}, branch: tagDefault{value: "main"}, buildID: 42}, ""},
+		{"empty", func(c *Config) {
+			c.TestIDDefault = TagDefaultEmpty
+			c.BranchDefault = TagDefaultEmpty
+			c.BuildIDDefault = TagDefaultEmpty
+		}, compatibleDefaults{}, ""},
+		{"error", func(c *Config) {
+			c.TestIDDefault = TagDefaultError
+			c.BranchDefault = TagDefaultError
+			c.BuildIDDefault = TagDefaultError
+		}, compatibleDefaults{
+			testID:          tagDefault{required: true},
+			branch:          tagDefault{required: true},
+			buildIDRequired: true,
+		}, ""},
+		{"invalid build id", func(c *Config) { c.BuildIDDefault = "yesterday" }, compatibleDefaults{}, "invalid buildIdDefault: yesterday"},
+		{"build id overflow", func(c *Config) { c.BuildIDDefault = "4294967296" }, compatibleDefaults{}, "invalid buildIdDefault"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := NewConfig()
+			tt.modify(&cfg)
+			got, err := compatibleDefaultsFromConfig(cfg, 777)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.ErrorContains(t, cfg.Validate(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConvertToCompatible_ConfiguredDefaults(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("http_reqs", metrics.Counter)
+	untagged := metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric}, Time: time.Now(), Value: 1}
+	tagged := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: metric,
+			Tags: registry.RootTagSet().WithTagsFromMap(map[string]string{
+				"testid": "run-1", "branch": "main", "buildId": "9",
+			}),
+		},
+		Time:  time.Now(),
+		Value: 1,
+	}
+
+	t.Run("empty mode", func(t *testing.T) {
+		t.Parallel()
+
+		cs, err := convertToCompatible(untagged, compatibleDefaults{})
+		assert.NoError(t, err)
+		assert.Equal(t, "", cs.TestID)
+		assert.Equal(t, "", cs.Branch)
+		assert.Equal(t, uint32(0), cs.BuildID)
+	})
+
+	t.Run("error mode rejects missing tags", func(t *testing.T) {
+		t.Parallel()
+
+		for _, d := range []compatibleDefaults{
+			{testID: tagDefault{required: true}},
+			{branch: tagDefault{required: true}},
+			{buildIDRequired: true},
+		} {
+			_, err := convertToCompatible(untagged, d)
+			assert.ErrorContains(t, err, "missing required tag")
+		}
+	})
+
+	t.Run("error mode accepts tagged samples", func(t *testing.T) {
+		t.Parallel()
+
+		cs, err := convertToCompatible(tagged, compatibleDefaults{
+			testID:          tagDefault{required: true},
+			branch:          tagDefault{required: true},
+			buildIDRequired: true,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "run-1", cs.TestID)
+		assert.Equal(t, "main", cs.Branch)
+		assert.Equal(t, uint32(9), cs.BuildID)
+	})
+
+	t.Run("configured converter", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := NewConfig()
+		cfg.BranchDefault = "trunk"
+		impl, err := configureCompatible(cfg)
+		assert.NoError(t, err)
+
+		row, err := impl.Converter.Convert(context.Background(), untagged)
+		assert.NoError(t, err)
+		assert.Equal(t, "default", row[4])
+		assert.Equal(t, "trunk", row[9])
+		impl.Converter.Release(row)
+	})
+}
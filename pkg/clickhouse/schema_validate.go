@@ -0,0 +1,146 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// columnModifiers start the part of a column definition after its type.
+var columnModifiers = []string{" DEFAULT ", " MATERIALIZED ", " ALIAS ", " EPHEMERAL", " CODEC(", " TTL ", " COMMENT "}
+
+// tableColumn is a column a schema expects in its table.
+type tableColumn struct {
+	name string
+	typ  string
+}
+
+// columnDefinitions splits the column definitions of a CREATE TABLE, one per
+// line as the built-in schemas write them.
+func columnDefinitions(ddl string) []string {
+	var defs []string
+	for def := range strings.SplitSeq(ddl, ",\n") {
+		if def = strings.TrimSpace(def); def != "" {
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
+// parseColumnsDDL splits the column definitions of a CREATE TABLE into names
+// and types.
+func parseColumnsDDL(ddl string) []tableColumn {
+	var columns []tableColumn
+	for _, def := range columnDefinitions(ddl) {
+		name, typ, ok := strings.Cut(def, " ")
+		if !ok {
+			continue
+		}
+		typ = " " + strings.TrimSpace(typ)
+		for _, modifier := range columnModifiers {
+			if i := strings.Index(typ, modifier); i >= 0 {
+				typ = typ[:i]
+			}
+		}
+		columns = append(columns, tableColumn{name: name, typ: strings.TrimSpace(typ)})
+	}
+	return columns
+}
+
+// normalizeType drops the spaces ClickHouse adds to a type when reporting it
+// ("Enum8('counter' = 1)"), so it compares equal to the type as written.
+func normalizeType(typ string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, typ)
+}
+
+// engineFamily returns the engine name without arguments and without the
+// Replicated or Shared prefix of its cluster variants, which store the same
+// data.
+func engineFamily(engine string) string {
+	engine, _, _ = strings.Cut(engine, "(")
+	for _, prefix := range []string{"Replicated", "Shared"} {
+		engine = strings.TrimPrefix(engine, prefix)
+	}
+	return engine
+}
+
+// validateTable checks an existing table against the column definitions and
+// ENGINE expression of a built-in schema: every column must exist with its
+// type, and a MergeTree-family engine must be of the same kind. Other engines
+// (Distributed, Buffer, ...) forward to a table of their own and pass.
+func validateTable(ctx context.Context, db *sql.DB, database, table, columnsDDL, engine string) error {
+	var actualEngine string
+	err := db.QueryRowContext(ctx,
+		"SELECT engine FROM system.tables WHERE database = ? AND name = ?", database, table).Scan(&actualEngine)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("table %s.%s does not exist", database, table)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the engine of %s.%s: %w", database, table, err)
+	}
+
+	rows, err := db.QueryContext(ctx,
+		"SELECT name, type FROM system.columns WHERE database = ? AND table = ?", database, table)
+	if err != nil {
+		return fmt.Errorf("failed to read the columns of %s.%s: %w", database, table, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	actual := make(map[string]string)
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return fmt.Errorf("failed to read the columns of %s.%s: %w", database, table, err)
+		}
+		actual[name] = typ
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read the columns of %s.%s: %w", database, table, err)
+	}
+
+	var problems []string
+	for _, col := range parseColumnsDDL(columnsDDL) {
+		typ, ok := actual[col.name]
+		switch {
+		case !ok:
+			problems = append(problems, strings.TrimSpace(fmt.Sprintf("column %s %s", col.name, col.typ))+" is missing")
+		case col.typ == "":
+			// A column declared without a type, such as a MATERIALIZED one,
+			// takes the type of its expression
+		case normalizeType(typ) != normalizeType(col.typ):
+			problems = append(problems, fmt.Sprintf("column %s is %s, expected %s", col.name, typ, col.typ))
+		}
+	}
+	if family := engineFamily(actualEngine); strings.HasSuffix(family, "MergeTree") && family != engineFamily(engine) {
+		problems = append(problems, fmt.Sprintf("engine is %s, expected %s", actualEngine, engineFamily(engine)))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("table %s.%s does not match the schema: %s", database, table, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateExistingTable runs t's schema validation (SchemaValidator) on a
+// table the output did not create. Schemas without it are not checked.
+func (o *Output) validateExistingTable(ctx context.Context, db *sql.DB, t *schemaTarget) error {
+	v, ok := t.schema.(SchemaValidator)
+	if !ok || o.config.SkipSchemaValidation {
+		return nil
+	}
+	if err := v.Validate(ctx, db, o.config.Database, t.table); err != nil {
+		return fmt.Errorf("schema %s: %w (fix the table or the options that shape it, "+
+			"such as tagStorage and tableEngine, or set skipSchemaValidation=true)", t.mode, err)
+	}
+	o.logger.WithFields(logrus.Fields{"schemaMode": t.mode, "table": t.table}).Debug("Table matches the schema")
+	return nil
+}
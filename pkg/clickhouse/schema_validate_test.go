@@ -0,0 +1,155 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+// simpleTable returns the table the simple schema creates, with the types as
+// ClickHouse reports them.
+func simpleTable() fakeTable {
+	return fakeTable{
+		engine: "MergeTree",
+		columns: [][]driver.Value{
+			{"timestamp", "DateTime64(3)"},
+			{"metric", "LowCardinality(String)"},
+			{"value", "Float64"},
+			{"tags", "Map(String, String)"},
+		},
+	}
+}
+
+func TestParseColumnsDDL(t *testing.T) {
+	t.Parallel()
+
+	cols := parseColumnsDDL(CompatibleSchema{}.columnsDDL())
+	require.Len(t, cols, 21)
+	assert.Equal(t, tableColumn{"timestamp", "DateTime64(3, 'UTC')"}, cols[0])
+	assert.Equal(t, tableColumn{"metric_type", "Enum8('counter'=1, 'gauge'=2, 'rate'=3, 'trend'=4)"}, cols[2])
+	assert.Equal(t, tableColumn{"testid", "LowCardinality(String)"}, cols[4], "DEFAULT is not part of the type")
+	assert.Equal(t, tableColumn{"build_id", "UInt32"}, cols[7], "DEFAULT and CODEC are not part of the type")
+
+	assert.Equal(t, []tableColumn{
+		{"timestamp", "DateTime64(3)"},
+		{"metric", "LowCardinality(String)"},
+		{"value", "Float64"},
+		{"tags", "Map(String, String)"},
+	}, parseColumnsDDL(SimpleSchema{}.columnsDDL()))
+}
+
+func TestEngineFamily(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "MergeTree", engineFamily("MergeTree()"))
+	assert.Equal(t, "ReplacingMergeTree", engineFamily("ReplacingMergeTree(row_version)"))
+	assert.Equal(t, "ReplacingMergeTree", engineFamily("ReplicatedReplacingMergeTree"))
+	assert.Equal(t, "MergeTree", engineFamily("SharedMergeTree"))
+	assert.Equal(t, "Distributed", engineFamily("Distributed"))
+}
+
+func TestSimpleSchema_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		table   func(*fakeTable)
+		wantErr []string
+	}{
+		{name: "matches", table: func(*fakeTable) {}},
+		{name: "reported spacing", table: func(tb *fakeTable) { tb.columns[3][1] = "Map(String,String)" }},
+		{name: "replicated engine", table: func(tb *fakeTable) { tb.engine = "ReplicatedMergeTree" }},
+		{name: "forwarding engine", table: func(tb *fakeTable) { tb.engine = "Distributed" }},
+		{
+			name:    "missing column",
+			table:   func(tb *fakeTable) { tb.columns = tb.columns[:3] },
+			wantErr: []string{"column tags Map(String, String) is missing"},
+		},
+		{
+			name:    "type mismatch",
+			table:   func(tb *fakeTable) { tb.columns[3][1] = "JSON" },
+			wantErr: []string{"column tags is JSON, expected Map(String, String)"},
+		},
+		{
+			name:    "engine mismatch",
+			table:   func(tb *fakeTable) { tb.engine = "ReplacingMergeTree" },
+			wantErr: []string{"engine is ReplacingMergeTree, expected MergeTree"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tb := simpleTable()
+			tt.table(&tb)
+			fake, db := newFakeDB(t)
+			fake.set(func(f *fakeDB) { f.tables = map[string]fakeTable{"samples": tb} })
+
+			err := SimpleSchema{}.Validate(context.Background(), db, "k6", "samples")
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "table k6.samples does not match the schema")
+			for _, want := range tt.wantErr {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+
+	t.Run("missing table", func(t *testing.T) {
+		t.Parallel()
+
+		fake, db := newFakeDB(t)
+		fake.set(func(f *fakeDB) { f.tables = map[string]fakeTable{"samples": {}} })
+
+		err := SimpleSchema{}.Validate(context.Background(), db, "k6", "samples")
+		require.EqualError(t, err, "table k6.samples does not exist")
+	})
+}
+
+func TestStart_SchemaValidation(t *testing.T) {
+	t.Parallel()
+
+	start := func(t *testing.T, config map[string]any) error {
+		t.Helper()
+
+		fake, out := newFakeOutput(t, output.Params{JSONConfig: mustMarshalJSON(config)})
+		tb := simpleTable()
+		tb.columns[3][1] = "JSON"
+		fake.set(func(f *fakeDB) { f.tables = map[string]fakeTable{"samples": tb} })
+
+		if err := out.Start(); err != nil {
+			return err
+		}
+		require.NoError(t, out.Stop())
+		return nil
+	}
+
+	t.Run("mismatch fails Start", func(t *testing.T) {
+		t.Parallel()
+
+		err := start(t, map[string]any{"skipSchemaCreation": true})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "schema simple: table k6.samples does not match the schema")
+		assert.Contains(t, err.Error(), "skipSchemaValidation=true")
+	})
+
+	t.Run("skipSchemaValidation", func(t *testing.T) {
+		t.Parallel()
+
+		require.NoError(t, start(t, map[string]any{"skipSchemaCreation": true, "skipSchemaValidation": true}))
+	})
+
+	t.Run("not validated when created", func(t *testing.T) {
+		t.Parallel()
+
+		require.NoError(t, start(t, map[string]any{}))
+	})
+}
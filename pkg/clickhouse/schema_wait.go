@@ -0,0 +1,108 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// schemaWaitInterval is how often a schema follower checks for the leader's
+// tables.
+var schemaWaitInterval = time.Second
+
+// createdConcurrently reports whether a CREATE ... IF NOT EXISTS failed
+// because another instance created the object at the same moment
+// (TABLE_ALREADY_EXISTS, DATABASE_ALREADY_EXISTS). The object exists, which
+// is all the statement was for.
+func createdConcurrently(err error) bool {
+	exc, ok := errors.AsType[*clickhouse.Exception](err)
+	return ok && (exc.Code == 57 || exc.Code == 82)
+}
+
+// schemaTables returns the tables Start would create: the targets' tables and
+// the configured side tables.
+func (o *Output) schemaTables(targets []*schemaTarget, hasher *tagHasher) []string {
+	tables := make([]string, 0, len(targets))
+	for _, t := range targets {
+		tables = append(tables, t.table)
+	}
+	if hasher != nil && hasher.lookup {
+		tables = append(tables, o.config.HashTagsLookupTable)
+	}
+	for _, t := range targets {
+		if s, ok := starSchema(t); ok && !slices.Contains(tables, s.table) {
+			tables = append(tables, s.table)
+		}
+	}
+	for _, table := range []string{
+		o.config.AuditTable,
+		o.config.LoadProfileTable,
+		o.config.ThresholdsTable,
+		o.config.EventsTable,
+	} {
+		if table != "" {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// waitForSchema polls system.tables until every table in tables exists in
+// Database, for up to SchemaWaitTimeout.
+func (o *Output) waitForSchema(ctx context.Context, db *sql.DB, tables []string) error {
+	ctx, cancel := context.WithTimeout(ctx, o.config.SchemaWaitTimeout)
+	defer cancel()
+
+	missing := tables
+	for {
+		var err error
+		missing, err = missingTables(ctx, db, o.config.Database, missing)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			return fmt.Errorf("failed to check for the schema leader's tables: %w", err)
+		case err == nil && len(missing) == 0:
+			o.logger.Debug("Schema leader's tables are ready")
+			return nil
+		}
+
+		o.logger.WithField("missingTables", missing).Debug("Waiting for the schema leader's tables")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %v waiting for the schema leader to create %s.{%s} "+
+				"(start an instance without schemaFollower, or create the tables)",
+				o.config.SchemaWaitTimeout, o.config.Database, strings.Join(missing, ","))
+		case <-time.After(schemaWaitInterval):
+		}
+	}
+}
+
+// missingTables returns the tables of database not yet in system.tables.
+func missingTables(ctx context.Context, db *sql.DB, database string, tables []string) ([]string, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT name FROM system.tables WHERE database = ? AND name IN (?)", database, tables)
+	if err != nil {
+		return tables, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var existing []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return tables, err
+		}
+		existing = append(existing, name)
+	}
+	if err := rows.Err(); err != nil {
+		return tables, err
+	}
+	return slices.DeleteFunc(slices.Clone(tables), func(t string) bool {
+		return slices.Contains(existing, t)
+	}), nil
+}
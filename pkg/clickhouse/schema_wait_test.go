@@ -0,0 +1,65 @@
+package clickhouse
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestStart_SchemaFollower(t *testing.T) {
+	t.Parallel()
+
+	fake, o := newFakeOutput(t, output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"pushInterval":   "1h",
+		"eventsTable":    "events",
+		"schemaFollower": true,
+	})})
+	fake.set(func(f *fakeDB) { f.selectRows = [][]driver.Value{{"samples"}, {"events"}} })
+	require.NoError(t, o.Start())
+	defer func() { require.NoError(t, o.Stop()) }()
+
+	assert.Empty(t, fake.DDL(), "followers run no DDL")
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.Len(t, fake.selects, 1)
+	assert.Contains(t, fake.selects[0], "FROM system.tables")
+	assert.Equal(t, []any{"k6", []string{"samples", "events"}}, fake.selectArgs[0])
+}
+
+func TestStart_SchemaFollowerTimeout(t *testing.T) {
+	t.Parallel()
+
+	fake, o := newFakeOutput(t, output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"pushInterval":      "1h",
+		"eventsTable":       "events",
+		"schemaFollower":    true,
+		"schemaWaitTimeout": "50ms",
+	})})
+	fake.set(func(f *fakeDB) { f.selectRows = [][]driver.Value{{"events"}} })
+
+	err := o.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "waiting for the schema leader to create k6.{samples}")
+	require.NoError(t, o.Stop())
+}
+
+func TestStart_CreatedConcurrently(t *testing.T) {
+	t.Parallel()
+
+	config := output.Params{JSONConfig: mustMarshalJSON(map[string]any{"pushInterval": "1h"})}
+	fake, o := newFakeOutput(t, config)
+	fake.set(func(f *fakeDB) {
+		f.ddlErr = &clickhouse.Exception{Code: 57, Name: "TABLE_ALREADY_EXISTS", Message: "Table k6.samples already exists"}
+	})
+	require.NoError(t, o.Start(), "a table another instance just created is fine")
+	require.NoError(t, o.Stop())
+
+	fake, o = newFakeOutput(t, config)
+	fake.set(func(f *fakeDB) { f.ddlErr = &clickhouse.Exception{Code: 60, Name: "UNKNOWN_TABLE"} })
+	require.Error(t, o.Start())
+	require.NoError(t, o.Stop())
+}
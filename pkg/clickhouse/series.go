@@ -0,0 +1,53 @@
+package clickhouse
+
+import (
+	"slices"
+
+	"github.com/cespare/xxhash/v2"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// seriesIDColumn is the column of the series fingerprint (SeriesIDColumn).
+const seriesIDColumn = "series_id"
+
+// SeriesID returns the fingerprint of a time series: the xxHash64 of the
+// metric name and the tags sorted by name, each part followed by a zero byte.
+// It does not depend on map order, the run, or the host, so the same series
+// has the same ID in every table and every test.
+func SeriesID(metric string, tags map[string]string) uint64 {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	d := xxhash.New()
+	writePart := func(s string) {
+		_, _ = d.WriteString(s)
+		_, _ = d.Write([]byte{0})
+	}
+	writePart(metric)
+	for _, k := range keys {
+		writePart(k)
+		writePart(tags[k])
+	}
+	return d.Sum64()
+}
+
+// sampleSeriesID returns the SeriesID of sample, from the tags it is
+// converted with (after transformers and tag hashing).
+func sampleSeriesID(sample metrics.Sample) uint64 {
+	var tags map[string]string
+	if sample.Tags != nil {
+		tags = sample.Tags.Map()
+	}
+	return SeriesID(sample.Metric.Name, tags)
+}
+
+// seriesIDDDL returns the definition of the series_id column, when enabled.
+func seriesIDDDL(enabled bool) string {
+	if !enabled {
+		return ""
+	}
+	return ",\n\t\t\t" + seriesIDColumn + " UInt64"
+}
@@ -0,0 +1,61 @@
+package clickhouse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+func TestSeriesID(t *testing.T) {
+	t.Parallel()
+
+	// SELECT xxHash64('http_reqs\0method\0GET\0status\0200\0')
+	id := SeriesID("http_reqs", map[string]string{"status": "200", "method": "GET"})
+	assert.Equal(t, hashTagValue("http_reqs\x00method\x00GET\x00status\x00200\x00"), id)
+	assert.Equal(t, hashTagValue("vus\x00"), SeriesID("vus", nil))
+
+	assert.NotEqual(t, id, SeriesID("http_req_duration", map[string]string{"status": "200", "method": "GET"}))
+	assert.NotEqual(t, id, SeriesID("http_reqs", map[string]string{"status": "500", "method": "GET"}))
+	assert.NotEqual(t, SeriesID("m", map[string]string{"a": "bc"}), SeriesID("m", map[string]string{"ab": "c"}),
+		"separators keep tag boundaries apart")
+}
+
+func TestSchemas_SeriesIDColumn(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.SeriesIDColumn = true
+
+	registry := metrics.NewRegistry()
+	tags := map[string]string{"scenario": "browse", "status": "200"}
+	sample := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: registry.MustNewMetric("http_reqs", metrics.Counter),
+			Tags:   registry.RootTagSet().WithTagsFromMap(tags),
+		},
+		Time:  time.Now(),
+		Value: 1,
+	}
+	want := SeriesID("http_reqs", tags)
+
+	for _, configure := range []func(Config) (SchemaImplementation, error){configureSimple, configureCompatible} {
+		impl, err := configure(cfg)
+		require.NoError(t, err)
+
+		fake, db := newFakeDB(t)
+		require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		assert.Regexp(t, `series_id\s+UInt64`, fake.DDL()[1], impl.Name)
+
+		columns := impl.Converter.(ColumnNamer).ColumnNames()
+		row, err := impl.Converter.Convert(context.Background(), sample)
+		require.NoError(t, err)
+		require.Len(t, row, len(columns))
+		assert.Equal(t, "series_id", columns[len(columns)-1], impl.Name)
+		assert.Equal(t, want, row[len(row)-1], "every schema fingerprints the full tag set: %s", impl.Name)
+		impl.Converter.Release(row)
+	}
+}
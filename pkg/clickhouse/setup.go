@@ -0,0 +1,158 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// prepareServer readies ClickHouse for the run: it checks connectivity and
+// server features, creates the schema, and probes INSERT access for every
+// target. It is idempotent, so a failed attempt can simply be repeated.
+func (o *Output) prepareServer(ctx context.Context, db *sql.DB, targets []*schemaTarget, hasher *tagHasher) error {
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect to clickhouse at %s: %w "+
+			"(verify the address and the native port — 9000 by default, not the 8123 HTTP port — and the credentials)",
+			o.config.Addr, err)
+	}
+	o.logger.Debug("Connected to ClickHouse")
+
+	if err := o.config.checkServerFeatures(ctx, db); err != nil {
+		return err
+	}
+
+	if o.config.createsDatabase() {
+		if err := createDatabase(ctx, db, o.config.Database); err != nil && !createdConcurrently(err) {
+			return o.schemaCreationError(err, "")
+		}
+		o.logger.WithField("database", o.config.Database).Debug("Database created")
+	}
+	if err := o.prepareShards(ctx); err != nil {
+		return err
+	}
+
+	// Followers wait for the leader's schema before probing it
+	if o.config.SchemaFollower {
+		if err := o.waitForSchema(ctx, db, o.schemaTables(targets, hasher)); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range targets {
+		logger := o.logger.WithFields(logrus.Fields{"schemaMode": t.mode, "table": t.table})
+		tdb := t.handle(db)
+
+		// Create the table if not skipped
+		if o.config.createsTable() {
+			if err := o.createTableTraced(ctx, tdb, t); err != nil && !createdConcurrently(err) {
+				return o.schemaCreationError(err, t.table)
+			}
+			logger.Debug("Table created")
+			if err := o.migrateTable(ctx, tdb, t); err != nil {
+				return err
+			}
+		} else {
+			logger.Debug("Table creation skipped")
+			if err := o.validateExistingTable(ctx, tdb, t); err != nil {
+				return err
+			}
+		}
+
+		// Fail now rather than on every flush if the user cannot write
+		if err := o.probeInsert(ctx, tdb, t); err != nil {
+			return err
+		}
+	}
+
+	// The lookup, audit, load profile, thresholds, and events tables, and
+	// the baseline view, live next to the sample tables, created above
+	if hasher != nil && hasher.lookup && o.config.createsTable() {
+		if err := createTagLookupTable(ctx, db, o.config.Database, o.config.HashTagsLookupTable); err != nil && !createdConcurrently(err) {
+			return err
+		}
+	}
+	if o.config.AuditTable != "" && o.config.createsTable() {
+		if err := createAuditTable(ctx, db, o.config.Database, o.config.AuditTable); err != nil && !createdConcurrently(err) {
+			return o.schemaCreationError(err, o.config.AuditTable)
+		}
+	}
+	if o.config.LoadProfileTable != "" && o.config.createsTable() {
+		if err := createLoadProfileTable(ctx, db, o.config.Database, o.config.LoadProfileTable); err != nil && !createdConcurrently(err) {
+			return o.schemaCreationError(err, o.config.LoadProfileTable)
+		}
+	}
+	if o.config.ThresholdsTable != "" && o.config.createsTable() {
+		if err := createThresholdsTable(ctx, db, o.config.Database, o.config.ThresholdsTable); err != nil && !createdConcurrently(err) {
+			return o.schemaCreationError(err, o.config.ThresholdsTable)
+		}
+	}
+	if o.config.EventsTable != "" && o.config.createsTable() {
+		if err := createEventsTable(ctx, db, o.config.Database, o.config.EventsTable); err != nil && !createdConcurrently(err) {
+			return o.schemaCreationError(err, o.config.EventsTable)
+		}
+	}
+	if o.config.BaselineView != "" && o.config.createsTable() {
+		if err := o.createBaselineView(ctx, db, targets); err != nil {
+			return o.schemaCreationError(err, o.config.BaselineView)
+		}
+	}
+	return nil
+}
+
+// createTableTraced runs createTable in a clickhouse.create_schema span.
+func (o *Output) createTableTraced(ctx context.Context, db *sql.DB, t *schemaTarget) error {
+	ctx, span := o.tracer.Start(ctx, spanCreateSchema, trace.WithAttributes(append(o.config.serverAttributes(),
+		attribute.String("db.collection.name", t.table),
+		attribute.String("clickhouse.schema", t.mode),
+	)...))
+	err := o.createTable(ctx, db, t)
+	endSpan(span, err)
+	return err
+}
+
+// createTable creates t's table. A schema that cannot create its table alone
+// (no TableCreator) may only run when the database is created as well.
+func (o *Output) createTable(ctx context.Context, db *sql.DB, t *schemaTarget) error {
+	if tc, ok := t.schema.(TableCreator); ok {
+		return tc.CreateTable(ctx, db, o.config.Database, t.table)
+	}
+	if !o.config.createsDatabase() {
+		return fmt.Errorf("schema %s cannot create its table without creating the database "+
+			"(set createDatabase=true, or createTable=false and create the table yourself)", t.mode)
+	}
+	return t.schema.CreateSchema(ctx, db, o.config.Database, t.table)
+}
+
+// ensureServer runs prepareServer once after a Start() that deferred it
+// (see Config.SkipPing). Concurrent flushes wait for a single attempt. It is
+// a no-op before Start().
+func (o *Output) ensureServer(ctx context.Context, db *sql.DB, targets []*schemaTarget, hasher *tagHasher) error {
+	if db == nil || o.serverReady.Load() {
+		return nil
+	}
+	o.setupMu.Lock()
+	defer o.setupMu.Unlock()
+	if o.serverReady.Load() {
+		return nil
+	}
+
+	if err := o.prepareServer(ctx, db, targets, hasher); err != nil {
+		return err
+	}
+	o.serverReady.Store(true)
+	o.logger.Info("ClickHouse is reachable, deferred setup complete")
+	return nil
+}
+
+// isServerError reports whether err carries a ClickHouse exception, i.e. the
+// server was reached and refused. Anything else is treated as unreachable.
+func isServerError(err error) bool {
+	_, ok := errors.AsType[*clickhouse.Exception](err)
+	return ok
+}
@@ -0,0 +1,122 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+// newSkipPingOutput returns an unstarted output with skipPing enabled.
+func newSkipPingOutput(t *testing.T) (*fakeDB, *Output) {
+	t.Helper()
+
+	return newFakeOutput(t, output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"schemaMode":   "compatible",
+		"pushInterval": "1h",
+		"skipPing":     true,
+	})})
+}
+
+func TestStart_SkipPing(t *testing.T) {
+	t.Parallel()
+
+	fake, o := newSkipPingOutput(t)
+	fake.set(func(f *fakeDB) { f.pingErr = errors.New("dial tcp: connection refused") })
+	require.NoError(t, o.Start(), "unreachable server does not fail Start")
+
+	// Samples wait in the buffer while the server is unreachable
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	assert.Empty(t, fake.DDL())
+	assert.Empty(t, fake.Rows())
+	assert.Equal(t, uint64(1), o.GetErrorMetrics().BufferedSamples)
+
+	// Once it comes up, setup completes and the early samples are delivered
+	fake.set(func(f *fakeDB) { f.pingErr = nil })
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	assert.Len(t, fake.DDL(), 2, "schema created on the first reachable flush")
+	assert.Len(t, fake.Rows(), 5)
+
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	assert.Len(t, fake.DDL(), 2, "setup runs once")
+
+	require.NoError(t, o.Stop())
+}
+
+func TestStart_SkipPingServerError(t *testing.T) {
+	t.Parallel()
+
+	fake, o := newSkipPingOutput(t)
+	fake.set(func(f *fakeDB) { f.prepareErr = &clickhouse.Exception{Code: 497, Name: "ACCESS_DENIED"} })
+
+	err := o.Start()
+	require.Error(t, err, "a reachable server refusing access still fails Start")
+	assert.Contains(t, err.Error(), "missing GRANT INSERT")
+	require.NoError(t, o.Stop())
+}
+
+func TestStop_SkipPingDrainsAfterLateSetup(t *testing.T) {
+	t.Parallel()
+
+	fake, o := newSkipPingOutput(t)
+	fake.set(func(f *fakeDB) { f.pingErr = errors.New("dial tcp: connection refused") })
+	require.NoError(t, o.Start())
+
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	fake.set(func(f *fakeDB) { f.pingErr = nil })
+
+	require.NoError(t, o.Stop())
+	assert.Len(t, fake.Rows(), 3)
+}
+
+func TestStart_SchemaCreationToggles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		config map[string]any
+		want   []string
+	}{
+		{"defaults", map[string]any{}, []string{"CREATE DATABASE", "CREATE TABLE"}},
+		{"table only", map[string]any{"createDatabase": false}, []string{"CREATE TABLE"}},
+		{"database only", map[string]any{"createTable": false}, []string{"CREATE DATABASE"}},
+		{"skipSchemaCreation wins", map[string]any{"skipSchemaCreation": true, "createTable": true}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake, _ := startFakeOutput(t, tt.config)
+
+			ddl := fake.DDL()
+			require.Len(t, ddl, len(tt.want))
+			for i, stmt := range tt.want {
+				assert.Contains(t, ddl[i], stmt)
+			}
+		})
+	}
+}
+
+func TestCreateTable_RequiresTableCreator(t *testing.T) {
+	t.Parallel()
+
+	_, db := newFakeDB(t)
+	cfg := NewConfig()
+	cfg.CreateDatabase = false
+	o := &Output{config: cfg}
+	// Wrapping hides CreateTable, as in a custom schema written before it existed
+	target := &schemaTarget{mode: "legacy", table: "samples", schema: struct{ SchemaCreator }{SimpleSchema{}}}
+
+	err := o.createTable(context.Background(), db, target)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "schema legacy cannot create its table without creating the database")
+}
@@ -0,0 +1,154 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/cespare/xxhash/v2"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// Shard keys (Config.ShardBy).
+const (
+	// ShardByNone writes every sample to Addr.
+	ShardByNone = "none"
+
+	// ShardByTestID routes the samples of a test run, by their testid tag,
+	// to one shard.
+	ShardByTestID = "testid"
+
+	// ShardBySeries routes the samples of a time series, by their SeriesID,
+	// to one shard.
+	ShardBySeries = "series"
+)
+
+// sharded reports whether samples are spread over Addr and ShardAddrs.
+func (c Config) sharded() bool {
+	return c.ShardBy != "" && c.ShardBy != ShardByNone
+}
+
+// validateSharding checks ShardBy, ShardAddrs, and the options that keep
+// per-table state on disk, which cannot tell the shards of a table apart.
+func (c Config) validateSharding() error {
+	switch c.ShardBy {
+	case "", ShardByNone:
+		if len(c.ShardAddrs) > 0 {
+			return fmt.Errorf("shardAddrs requires shardBy (%s or %s)", ShardByTestID, ShardBySeries)
+		}
+		return nil
+	case ShardByTestID, ShardBySeries:
+	default:
+		return fmt.Errorf("invalid shardBy: %s (valid: %s, %s, %s)", c.ShardBy, ShardByNone, ShardByTestID, ShardBySeries)
+	}
+
+	if len(c.ShardAddrs) == 0 {
+		return fmt.Errorf("shardBy=%s requires shardAddrs", c.ShardBy)
+	}
+	seen := map[string]bool{c.Addr: true}
+	for _, addr := range c.ShardAddrs {
+		if err := validateAddr(addr); err != nil {
+			return fmt.Errorf("invalid shardAddrs: %w", err)
+		}
+		if seen[addr] {
+			return fmt.Errorf("invalid shardAddrs: %s is listed more than once, or is addr", addr)
+		}
+		seen[addr] = true
+	}
+	switch {
+	case c.WALDir != "":
+		return fmt.Errorf("shardBy cannot be combined with walDir")
+	case c.SpillDir != "":
+		return fmt.Errorf("shardBy cannot be combined with spillDir")
+	case slices.Contains(c.SchemaModes(), "star"):
+		return fmt.Errorf("shardBy cannot be combined with the star schema")
+	}
+	return nil
+}
+
+// shardKey returns the hash placing sample on a shard.
+func (c Config) shardKey(sample metrics.Sample) uint64 {
+	if c.ShardBy == ShardBySeries {
+		return sampleSeriesID(sample)
+	}
+	var testID string
+	if sample.Tags != nil {
+		testID, _ = sample.Tags.Get("testid")
+	}
+	return xxhash.Sum64String(testID)
+}
+
+// shardTargets replaces each target with one target per shard, writing the
+// same table on Addr and on every ShardAddrs entry. Each keeps its own
+// failover buffer and connection, so a failing shard never causes samples
+// committed to another to be re-sent.
+func (c Config) shardTargets(targets []*schemaTarget) ([]*schemaTarget, error) {
+	if !c.sharded() {
+		return targets, nil
+	}
+
+	n := uint64(len(c.ShardAddrs) + 1)
+	sharded := make([]*schemaTarget, 0, len(targets)*int(n))
+	for _, t := range targets {
+		accept := t.accept
+		for shard := range n {
+			onShard := func(s metrics.Sample) bool {
+				return c.shardKey(s)%n == shard && (accept == nil || accept(s))
+			}
+			st := t
+			if shard > 0 {
+				var err error
+				if st, err = c.newTarget(t.mode, t.table, onShard); err != nil {
+					return nil, err
+				}
+				st.shard = int(shard)
+			}
+			st.accept = onShard
+			sharded = append(sharded, st)
+		}
+	}
+	return sharded, nil
+}
+
+// openShards opens a database handle for every ShardAddrs entry, with the
+// connection settings of Addr.
+func (o *Output) openShards() ([]*sql.DB, error) {
+	dbs := make([]*sql.DB, 0, len(o.config.ShardAddrs))
+	for _, addr := range o.config.ShardAddrs {
+		db, err := o.openAddr(addr)
+		if err != nil {
+			for _, opened := range dbs {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// prepareShards connects to every shard and creates the database on it; the
+// tables are created with the targets (see prepareServer).
+func (o *Output) prepareShards(ctx context.Context) error {
+	for i, db := range o.shards {
+		if err := db.PingContext(ctx); err != nil {
+			return fmt.Errorf("failed to connect to clickhouse shard at %s: %w", o.config.ShardAddrs[i], err)
+		}
+		if o.config.createsDatabase() {
+			if err := createDatabase(ctx, db, o.config.Database); err != nil && !createdConcurrently(err) {
+				return o.schemaCreationError(err, "")
+			}
+		}
+	}
+	return nil
+}
+
+// handle returns the database handle t writes to: its shard's, or db for
+// shard 0.
+func (t *schemaTarget) handle(db *sql.DB) *sql.DB {
+	if t.db != nil {
+		return t.db
+	}
+	return db
+}
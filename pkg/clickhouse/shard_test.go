@@ -0,0 +1,128 @@
+package clickhouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestConfig_Sharding(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?shardBy=series&shardAddrs=ch-2,ch-3:9001"})
+	require.NoError(t, err)
+	assert.Equal(t, ShardBySeries, cfg.ShardBy)
+	assert.Equal(t, []string{"ch-2:9000", "ch-3:9001"}, cfg.ShardAddrs, "bare hosts get the default port")
+	assert.Equal(t, ShardByNone, NewConfig().ShardBy)
+
+	for _, tt := range []struct {
+		query string
+		err   string
+	}{
+		{query: "shardAddrs=ch-2", err: "shardAddrs requires shardBy (testid or series)"},
+		{query: "shardBy=testid", err: "shardBy=testid requires shardAddrs"},
+		{query: "shardBy=metric&shardAddrs=ch-2", err: "invalid shardBy: metric (valid: none, testid, series)"},
+		{query: "shardBy=testid&shardAddrs=localhost", err: "localhost:9000 is listed more than once, or is addr"},
+		{query: "shardBy=testid&shardAddrs=ch-2,ch-2:9000", err: "ch-2:9000 is listed more than once"},
+		{query: "shardBy=testid&shardAddrs=ch-2&walDir=/tmp/wal", err: "shardBy cannot be combined with walDir"},
+		{query: "shardBy=testid&shardAddrs=ch-2&schemaMode=star", err: "shardBy cannot be combined with the star schema"},
+	} {
+		_, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?" + tt.query})
+		assert.ErrorContains(t, err, tt.err, tt.query)
+	}
+}
+
+func TestShardTargets(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("http_req_duration", metrics.Trend)
+	sample := func(testID, url string) metrics.Sample {
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{
+			Metric: metric,
+			Tags:   registry.RootTagSet().With("testid", testID).With("url", url),
+		}}
+	}
+
+	for _, shardBy := range []string{ShardByTestID, ShardBySeries} {
+		cfg := NewConfig()
+		cfg.SchemaMode = "simple,compatible"
+		cfg.ShardBy = shardBy
+		cfg.ShardAddrs = []string{"ch-2:9000", "ch-3:9000"}
+		targets, err := cfg.newTargets(nil, nil)
+		require.NoError(t, err)
+		require.Len(t, targets, 6, "one target per schema and shard")
+		assert.Equal(t, []int{0, 1, 2}, []int{targets[0].shard, targets[1].shard, targets[2].shard})
+		assert.Equal(t, targets[0].table, targets[2].table, "every shard writes the same table")
+		assert.NotSame(t, targets[0].failoverBuffer, targets[1].failoverBuffer)
+
+		for _, s := range []metrics.Sample{sample("run-1", "/a"), sample("run-1", "/b"), sample("run-2", "/a")} {
+			var shards []int
+			for _, tgt := range targets[:3] {
+				if tgt.accept(s) {
+					shards = append(shards, tgt.shard)
+				}
+			}
+			require.Len(t, shards, 1, "%s: each sample goes to exactly one shard", shardBy)
+			assert.Equal(t, cfg.shardKey(s)%3, uint64(shards[0]))
+		}
+	}
+
+	cfg := NewConfig()
+	cfg.ShardBy = ShardByTestID
+	cfg.ShardAddrs = []string{"ch-2:9000"}
+	assert.Equal(t, cfg.shardKey(sample("run-1", "/a")), cfg.shardKey(sample("run-1", "/b")),
+		"a test run stays on one shard")
+}
+
+func TestOutput_Sharded(t *testing.T) {
+	t.Parallel()
+
+	primary, o := newFakeOutput(t, output.Params{
+		JSONConfig: mustMarshalJSON(map[string]any{
+			"pushInterval": "1h",
+			"skipPing":     true,
+			"shardBy":      "testid",
+			"shardAddrs":   []string{"127.0.0.1:1"},
+		}),
+	})
+	require.NoError(t, o.Start(), "an unreachable shard defers the setup with skipPing")
+	defer func() { require.NoError(t, o.Stop()) }()
+	require.Len(t, o.targets, 2)
+
+	// Swap the unreachable shard for a fake; the deferred setup runs on the
+	// next flush
+	shard, shardDB := newFakeDB(t)
+	require.NoError(t, o.shards[0].Close())
+	o.shards[0], o.targets[1].db = shardDB, shardDB
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("http_req_duration", metrics.Trend)
+	onShard := map[uint64][]string{}
+	for _, testID := range []string{"run-1", "run-2", "run-3", "run-4", "run-5", "run-6"} {
+		s := metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet().With("testid", testID)},
+			Time:       time.Now(),
+			Value:      1,
+		}
+		k := o.config.shardKey(s) % 2
+		onShard[k] = append(onShard[k], testID)
+		o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{s}})
+	}
+	require.Len(t, onShard, 2, "precondition: the test runs spread over both shards")
+	o.flush()
+
+	assert.NotEmpty(t, shard.DDL(), "the shard got its database and table")
+	for k, fake := range []*fakeDB{primary, shard} {
+		rows := fake.Rows()
+		require.Len(t, rows, len(onShard[uint64(k)]), "shard %d", k)
+		for _, row := range rows {
+			testID, _ := row[3].(map[string]string)
+			assert.Contains(t, onShard[uint64(k)], testID["testid"], "shard %d", k)
+		}
+	}
+}
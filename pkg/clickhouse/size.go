@@ -0,0 +1,128 @@
+package clickhouse
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// byteUnits maps the units parseByteSize accepts, lower-cased, to their size:
+// decimal (KB, MB, ...) and binary (KiB, MiB, ...).
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"m":   1e6,
+	"mb":  1e6,
+	"g":   1e9,
+	"gb":  1e9,
+	"t":   1e12,
+	"tb":  1e12,
+	"ki":  1 << 10,
+	"kib": 1 << 10,
+	"mi":  1 << 20,
+	"mib": 1 << 20,
+	"gi":  1 << 30,
+	"gib": 1 << 30,
+	"ti":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// quantityUnits maps the suffixes parseQuantity accepts, lower-cased, to
+// their multiplier.
+var quantityUnits = map[string]float64{
+	"":  1,
+	"k": 1e3,
+	"m": 1e6,
+	"g": 1e9,
+}
+
+// scaledValue matches a number with an optional unit: "10", "1.5 GiB".
+var scaledValue = regexp.MustCompile(`^\s*(-?[0-9]*\.?[0-9]+)\s*([a-zA-Z]*)\s*$`)
+
+// parseByteSize parses a size in bytes: a plain number ("10485760") or a
+// number with a unit ("10MiB", "1.5 GB"). Units are case-insensitive;
+// fractions of a byte are dropped. The sign is left for Validate to check.
+func parseByteSize(value string) (int64, error) {
+	n, ok := parseScaled(value, byteUnits, false)
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q (expected bytes, e.g. 10485760, \"10MiB\", or \"10MB\")", value)
+	}
+	return n, nil
+}
+
+// parseQuantity parses a count: a plain number ("50000") or a number with a
+// k, M, or G suffix ("50k", "1.5M") that leaves a whole number.
+func parseQuantity(value string) (int64, error) {
+	n, ok := parseScaled(value, quantityUnits, true)
+	if !ok {
+		return 0, fmt.Errorf("invalid quantity %q (expected a whole number, e.g. 50000 or \"50k\")", value)
+	}
+	return n, nil
+}
+
+// parseScaled parses a number followed by one of units. With whole, the
+// result must be a whole number.
+func parseScaled(value string, units map[string]float64, whole bool) (int64, bool) {
+	m := scaledValue.FindStringSubmatch(value)
+	if m == nil {
+		return 0, false
+	}
+	scale, ok := units[strings.ToLower(m[2])]
+	if !ok {
+		return 0, false
+	}
+	// Whole numbers are scaled exactly, past the 2^53 a float64 holds
+	if n, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+		unit := int64(scale)
+		if n > math.MaxInt64/unit || n < math.MinInt64/unit {
+			return 0, false
+		}
+		return n * unit, true
+	}
+	f, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	f *= scale
+	if math.Abs(f) >= math.MaxInt64 || (whole && f != math.Trunc(f)) {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// intSize converts a parsed size or quantity for an int option.
+func intSize(n int64, err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	if n > math.MaxInt || n < math.MinInt {
+		return 0, fmt.Errorf("%d is out of range", n)
+	}
+	return int(n), nil
+}
+
+// uint64Size converts a parsed size or quantity for a uint64 option.
+func uint64Size(n int64, err error) (uint64, error) {
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%d must not be negative", n)
+	}
+	return uint64(n), nil
+}
+
+// uintSize converts a parsed quantity for a uint option.
+func uintSize(n int64, err error) (uint, error) {
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > math.MaxUint32 {
+		return 0, fmt.Errorf("%d is out of range", n)
+	}
+	return uint(n), nil
+}
@@ -0,0 +1,84 @@
+package clickhouse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+
+	for value, want := range map[string]int64{
+		"10485760": 10485760,
+		"256MiB":   256 << 20,
+		"256mib":   256 << 20,
+		"1.5 GB":   1500000000,
+		"64k":      64000,
+		"2Ki":      2048,
+		"100B":     100,
+		"0.5KiB":   512,
+	} {
+		n, err := parseByteSize(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, n, value)
+	}
+
+	for _, value := range []string{"", "MiB", "10 furlongs", "1e3", "10MiB extra"} {
+		_, err := parseByteSize(value)
+		assert.ErrorContains(t, err, "invalid size", value)
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	t.Parallel()
+
+	for value, want := range map[string]int64{
+		"50000": 50000,
+		"50k":   50000,
+		"50K":   50000,
+		"1.5M":  1500000,
+		"-1":    -1,
+
+		"9007199254740993": 9007199254740993, // past float64 precision
+	} {
+		n, err := parseQuantity(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, n, value)
+	}
+
+	for _, value := range []string{"1.5", "1.0005k", "50KiB", "lots", "9223372036854775807k"} {
+		_, err := parseQuantity(value)
+		assert.ErrorContains(t, err, "invalid quantity", value)
+	}
+}
+
+func TestParseConfig_Sizes(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"maxCompressionBuffer":  "16MiB",
+		"maxMemoryUsage":        "2GiB",
+		"bufferMaxSamples":      "50k",
+		"maxBatchRows":          100000,
+		"webhookDroppedSamples": "1k",
+	})})
+	require.NoError(t, err)
+	assert.Equal(t, 16<<20, cfg.MaxCompressionBuffer)
+	assert.Equal(t, uint64(2<<30), cfg.MaxMemoryUsage)
+	assert.Equal(t, 50000, cfg.BufferMaxSamples)
+	assert.Equal(t, 100000, cfg.MaxBatchRows)
+	assert.Equal(t, uint(1000), cfg.WebhookDroppedSamples)
+
+	cfg, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?maxMemoryUsage=512MB&maxBatchRows=1.5M"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(512000000), cfg.MaxMemoryUsage)
+	assert.Equal(t, 1500000, cfg.MaxBatchRows)
+
+	_, err = ParseConfig(output.Params{JSONConfig: mustMarshalJSON(map[string]any{"maxMemoryUsage": "-1MiB"})})
+	assert.ErrorContains(t, err, "invalid maxMemoryUsage")
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?bufferMaxSamples=10MiB"})
+	assert.ErrorContains(t, err, `invalid bufferMaxSamples URL parameter value "10MiB"`)
+}
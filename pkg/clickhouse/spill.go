@@ -0,0 +1,257 @@
+package clickhouse
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// spillFileExt is the extension of spill files; files being written carry an
+// additional ".tmp" suffix until they are complete.
+const spillFileExt = ".ndjson"
+
+// spillRecord is one sample in a spill or dead-letter file (one JSON object
+// per line). It keeps everything the converters read from a metrics.Sample.
+type spillRecord struct {
+	Metric   string             `json:"metric"`
+	Type     metrics.MetricType `json:"type"`
+	Time     time.Time          `json:"time"`
+	Value    float64            `json:"value"`
+	Tags     map[string]string  `json:"tags,omitempty"`
+	Metadata map[string]string  `json:"metadata,omitempty"`
+
+	// Error is why a dead-lettered sample was rejected, or why a sample went
+	// to the fallback sink (dead-letter and fallback records only).
+	Error string `json:"error,omitempty"`
+
+	// Table is the table the sample was not delivered to (fallback records
+	// only).
+	Table string `json:"table,omitempty"`
+}
+
+// newSpillRecord captures a sample for a spill or dead-letter file.
+func newSpillRecord(s metrics.Sample) spillRecord {
+	rec := spillRecord{Time: s.Time, Value: s.Value, Metadata: s.Metadata}
+	if s.Metric != nil {
+		rec.Metric, rec.Type = s.Metric.Name, s.Metric.Type
+	}
+	if s.Tags != nil {
+		rec.Tags = s.Tags.Map()
+	}
+	return rec
+}
+
+// spillFileName returns the file name used for samples that could not be
+// delivered to database.table. Identifiers never contain dots, so the name
+// can be split back into its parts.
+func spillFileName(database, table string, at time.Time) string {
+	return fmt.Sprintf("%s.%s.%d%s", database, table, at.UnixNano(), spillFileExt)
+}
+
+// writeSpillFile writes samples to a new spill file in dir and returns its
+// path and the number of samples written.
+func writeSpillFile(dir, database, table string, samples []metrics.SampleContainer) (string, int, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", 0, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	path := filepath.Join(dir, spillFileName(database, table, time.Now()))
+	count, err := writeSampleFile(path, samples, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write spill file: %w", err)
+	}
+	return path, count, nil
+}
+
+// writeSampleFile writes the samples accepted by accept (nil accepts all) to
+// a new file at path, one spill record per line, and returns how many were
+// written. The file is written under a temporary name and renamed once
+// synced, so a crash mid-write never leaves a truncated file behind.
+func writeSampleFile(path string, samples []metrics.SampleContainer, accept func(metrics.Sample) bool) (int, error) {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600) // #nosec G304 - dir is operator config, name is built from identifiers
+	if err != nil {
+		return 0, err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	count := 0
+	for _, sc := range samples {
+		for _, s := range sc.GetSamples() {
+			if accept != nil && !accept(s) {
+				continue
+			}
+			if err = enc.Encode(newSpillRecord(s)); err != nil {
+				break
+			}
+			count++
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+	return count, nil
+}
+
+// replayedSamples holds samples read back from a spill file. The failover
+// buffer never evicts them for age: they were already old when spilled, and
+// the file they came from is removed once they are queued.
+type replayedSamples metrics.Samples
+
+// GetSamples implements metrics.SampleContainer.
+func (r replayedSamples) GetSamples() []metrics.Sample {
+	return r
+}
+
+// sameOrigin returns samples, taken from sc, in a container that keeps sc's
+// exemption from age eviction when sc was replayed from a spill file.
+func sameOrigin(sc metrics.SampleContainer, samples []metrics.Sample) metrics.SampleContainer {
+	if _, ok := sc.(replayedSamples); ok {
+		return replayedSamples(samples)
+	}
+	return metrics.Samples(samples)
+}
+
+// spillReplayChunk is the number of replayed samples grouped into one
+// container, so a large spill file occupies a bounded number of failover
+// buffer slots.
+const spillReplayChunk = 1000
+
+// spillFiles returns the complete spill files for database.table in dir,
+// oldest first.
+func spillFiles(dir, database, table string) ([]string, error) {
+	prefix := database + "." + table + "."
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"*"+spillFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spill files: %w", err)
+	}
+	// Only <prefix><unix-nanos>.ndjson; skips other files sharing the prefix
+	files = slices.DeleteFunc(files, func(path string) bool {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), spillFileExt)
+		_, err := strconv.ParseInt(stamp, 10, 64)
+		return err != nil
+	})
+	// The Unix-nanosecond suffix has a fixed width, so name order is age order.
+	slices.Sort(files)
+	return files, nil
+}
+
+// readSpillFile decodes a spill file back into samples carrying their
+// original metric, tags, and timestamps. Metrics are resolved through
+// registry, which must be shared by all files replayed together.
+func readSpillFile(path string, registry *metrics.Registry) ([]metrics.SampleContainer, int, error) {
+	f, err := os.Open(path) // #nosec G304 - path comes from spillFiles
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open spill file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var containers []metrics.SampleContainer
+	var chunk metrics.Samples
+	count := 0
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var rec spillRecord
+		if err := dec.Decode(&rec); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("invalid spill record %d in %s: %w", count+1, path, err)
+		}
+
+		metric := registry.Get(rec.Metric)
+		if metric == nil {
+			if metric, err = registry.NewMetric(rec.Metric, rec.Type); err != nil {
+				return nil, 0, fmt.Errorf("invalid spill record %d in %s: %w", count+1, path, err)
+			}
+		}
+
+		chunk = append(chunk, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: metric,
+				Tags:   registry.RootTagSet().WithTagsFromMap(rec.Tags),
+			},
+			Time:     rec.Time,
+			Value:    rec.Value,
+			Metadata: rec.Metadata,
+		})
+		count++
+		if len(chunk) == spillReplayChunk {
+			containers = append(containers, replayedSamples(chunk))
+			chunk = nil
+		}
+	}
+	if len(chunk) > 0 {
+		containers = append(containers, replayedSamples(chunk))
+	}
+	return containers, count, nil
+}
+
+// loadSpill queues the spill files of every target for delivery: their
+// samples are pushed into the target's failover buffer, exempt from
+// BufferMaxAge, so the regular flushes replay them alongside live traffic,
+// and the file is removed.
+// Should the run stop before they are delivered, they are spilled again.
+// Files that cannot be read are left in place for inspection.
+func (o *Output) loadSpill(targets []*schemaTarget) {
+	registry := metrics.NewRegistry()
+	for _, t := range targets {
+		logger := o.logger.WithField("table", t.table)
+
+		files, err := spillFiles(o.config.SpillDir, o.config.Database, t.table)
+		if err != nil {
+			logger.WithError(err).Warn("Skipping spill replay")
+			continue
+		}
+		if len(files) > 0 && t.failoverBuffer == nil {
+			logger.WithField("spillFiles", len(files)).Warn("Spill files found but buffering is disabled; not replaying them")
+			continue
+		}
+
+		for _, path := range files {
+			samples, n, err := readSpillFile(path, registry)
+			if err != nil {
+				logger.WithError(err).WithField("spillFile", path).Warn("Skipping unreadable spill file")
+				continue
+			}
+			if dropped := t.failoverBuffer.Push(samples); dropped > 0 && o.fallback == nil {
+				o.droppedSamples.Add(uint64(dropped))
+				logger.WithField("dropped", dropped).Warn("Buffer overflow while loading spill file, dropped samples")
+			}
+			if err := os.Remove(path); err != nil {
+				logger.WithError(err).WithField("spillFile", path).Warn("Failed to remove replayed spill file")
+			}
+			logger.WithFields(logrus.Fields{
+				"spillFile": path,
+				"samples":   n,
+			}).Info("Replaying spilled samples")
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package clickhouse
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// readSpillRecords decodes every record of a spill file.
+func readSpillRecords(t *testing.T, path string) []spillRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	var records []spillRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec spillRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestWriteSpillFile(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "spill")
+	registry := metrics.NewRegistry()
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 123000000, time.UTC)
+	samples := []metrics.SampleContainer{
+		metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: registry.MustNewMetric("http_req_duration", metrics.Trend),
+				Tags:   registry.RootTagSet().With("method", "GET"),
+			},
+			Time:     ts,
+			Value:    12.5,
+			Metadata: map[string]string{"trace_id": "abc"},
+		},
+		metrics.Samples{
+			{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("vus", metrics.Gauge), Tags: registry.RootTagSet()}, Time: ts, Value: 3},
+			{TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("checks", metrics.Rate), Tags: registry.RootTagSet()}, Time: ts, Value: 1},
+		},
+	}
+
+	path, n, err := writeSpillFile(dir, "k6", "samples", samples)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, dir, filepath.Dir(path))
+	assert.True(t, strings.HasPrefix(filepath.Base(path), "k6.samples."))
+	assert.True(t, strings.HasSuffix(path, spillFileExt))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	records := readSpillRecords(t, path)
+	require.Len(t, records, 3)
+	assert.Equal(t, spillRecord{
+		Metric:   "http_req_duration",
+		Type:     metrics.Trend,
+		Time:     ts,
+		Value:    12.5,
+		Tags:     map[string]string{"method": "GET"},
+		Metadata: map[string]string{"trace_id": "abc"},
+	}, records[0])
+	assert.Equal(t, metrics.Gauge, records[1].Type)
+	assert.Equal(t, metrics.Rate, records[2].Type)
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestWriteSpillFile_Error(t *testing.T) {
+	t.Parallel()
+
+	// A regular file where the directory should be
+	parent := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(parent, nil, 0o600))
+
+	_, _, err := writeSpillFile(filepath.Join(parent, "spill"), "k6", "samples", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create spill directory")
+}
+
+func TestStop_SpillsUndeliveredBuffer(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	fake, o := startFakeOutput(t, map[string]any{"retryAttempts": 0, "pushInterval": "1h", "spillDir": dir})
+
+	fake.set(func(f *fakeDB) { f.execErr = errors.New("connection refused") })
+	registry := metrics.NewRegistry()
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("custom", metrics.Counter), Tags: registry.RootTagSet()},
+		Time:       time.Now(),
+		Value:      1,
+	}})
+	o.flush()
+	require.NoError(t, o.Stop())
+
+	stats := o.GetErrorMetrics()
+	assert.Equal(t, uint64(1), stats.SpilledSamples)
+	assert.Zero(t, stats.DroppedSamples)
+
+	files, err := filepath.Glob(filepath.Join(dir, "k6.samples.*"+spillFileExt))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	records := readSpillRecords(t, files[0])
+	require.Len(t, records, 1)
+	assert.Equal(t, "custom", records[0].Metric)
+}
+
+func TestReadSpillFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	registry := metrics.NewRegistry()
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	samples := make(metrics.Samples, 0, spillReplayChunk+1)
+	for i := range spillReplayChunk + 1 {
+		samples = append(samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: registry.MustNewMetric("http_reqs", metrics.Counter),
+				Tags:   registry.RootTagSet().With("status", "200"),
+			},
+			Time:  ts.Add(time.Duration(i) * time.Millisecond),
+			Value: float64(i),
+		})
+	}
+	path, _, err := writeSpillFile(dir, "k6", "samples", []metrics.SampleContainer{samples})
+	require.NoError(t, err)
+
+	replayRegistry := metrics.NewRegistry()
+	containers, n, err := readSpillFile(path, replayRegistry)
+	require.NoError(t, err)
+	assert.Equal(t, spillReplayChunk+1, n)
+	require.Len(t, containers, 2, "samples are grouped into bounded containers")
+	assert.Len(t, containers[0].GetSamples(), spillReplayChunk)
+
+	last := containers[1].GetSamples()[0]
+	assert.Equal(t, "http_reqs", last.Metric.Name)
+	assert.Equal(t, metrics.Counter, last.Metric.Type)
+	assert.True(t, last.Time.Equal(ts.Add(spillReplayChunk*time.Millisecond)), "original timestamp is kept")
+	status, _ := last.Tags.Get("status")
+	assert.Equal(t, "200", status)
+
+	t.Run("corrupt file", func(t *testing.T) {
+		t.Parallel()
+		bad := filepath.Join(t.TempDir(), "k6.samples.1"+spillFileExt)
+		require.NoError(t, os.WriteFile(bad, []byte("{\"metric\":\"custom\"}\nnot json\n"), 0o600))
+
+		_, _, err := readSpillFile(bad, metrics.NewRegistry())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid spill record 2")
+	})
+}
+
+func TestStart_ReplaysSpillFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	registry := metrics.NewRegistry()
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	spilled := []metrics.SampleContainer{metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: registry.MustNewMetric("custom", metrics.Counter), Tags: registry.RootTagSet()},
+		Time:       ts,
+		Value:      42,
+	}}
+	path, _, err := writeSpillFile(dir, "k6", "samples", spilled)
+	require.NoError(t, err)
+	// A spill file for another table is left alone
+	other, _, err := writeSpillFile(dir, "k6", "other", spilled)
+	require.NoError(t, err)
+
+	// The spilled sample is far older than bufferMaxAge, but its file is
+	// gone, so it must not be evicted
+	fake, o := startFakeOutput(t, map[string]any{"pushInterval": "1h", "spillDir": dir, "bufferMaxAge": "1m"})
+
+	assert.NoFileExists(t, path)
+	assert.FileExists(t, other)
+
+	o.flush()
+	rows := fake.Rows()
+	require.Len(t, rows, 1)
+	assert.True(t, rows[0][0].(time.Time).Equal(ts))
+	assert.Equal(t, "custom", rows[0][1])
+	assert.InDelta(t, 42.0, rows[0][2], 1e-9)
+	assert.Zero(t, o.GetErrorMetrics().EvictedSamples)
+}
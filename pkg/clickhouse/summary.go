@@ -0,0 +1,446 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// runSummary records which metrics the output received, the time span of
+// their samples, and the tables they went to, so Stop can read exactly those
+// rows back for Config.SummaryFile.
+type runSummary struct {
+	mu      sync.Mutex
+	metrics map[string]*metrics.Metric
+	first   time.Time
+	last    time.Time
+
+	// tables lists the tables each target (in o.targets order) wrote to:
+	// TableTemplate moves targets to a new table during the run.
+	tables [][]string
+
+	// inMemory aggregates the samples by metric when a target's schema
+	// cannot be read back (see readsBack); nil otherwise.
+	inMemory map[string]*memAggregates
+}
+
+// newRunSummary returns nil when no summary file is configured.
+func newRunSummary(path string, targets []*schemaTarget) *runSummary {
+	if path == "" {
+		return nil
+	}
+	s := &runSummary{metrics: make(map[string]*metrics.Metric), tables: make([][]string, len(targets))}
+	for i, t := range targets {
+		s.tables[i] = []string{t.table}
+		if !readsBack(t.schema) && s.inMemory == nil {
+			s.inMemory = make(map[string]*memAggregates)
+		}
+	}
+	return s
+}
+
+// observe records the metrics and timestamps of samples about to be written
+// to targets.
+func (s *runSummary) observe(samples []metrics.SampleContainer, targets []*schemaTarget) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range targets {
+		if i < len(s.tables) && !slices.Contains(s.tables[i], t.table) {
+			s.tables[i] = append(s.tables[i], t.table)
+		}
+	}
+
+	for _, sc := range samples {
+		for _, sample := range sc.GetSamples() {
+			if m := sample.Metric; m != nil {
+				if _, ok := s.metrics[m.Name]; !ok {
+					s.metrics[m.Name] = m
+				}
+				if s.inMemory != nil {
+					a, ok := s.inMemory[m.Name]
+					if !ok {
+						a = newMemAggregates(m.Type)
+						s.inMemory[m.Name] = a
+					}
+					a.add(sample)
+				}
+			}
+			if s.first.IsZero() || sample.Time.Before(s.first) {
+				s.first = sample.Time
+			}
+			if sample.Time.After(s.last) {
+				s.last = sample.Time
+			}
+		}
+	}
+}
+
+// summarySnapshot is the state of a runSummary at Stop.
+type summarySnapshot struct {
+	observed    map[string]*metrics.Metric
+	first, last time.Time
+	tables      [][]string
+	inMemory    map[string]storedAggregates
+}
+
+// snapshot returns the observed metrics, time span, and tables, and the
+// in-memory aggregates.
+func (s *runSummary) snapshot() summarySnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := summarySnapshot{
+		observed: make(map[string]*metrics.Metric, len(s.metrics)),
+		first:    s.first,
+		last:     s.last,
+		tables:   make([][]string, len(s.tables)),
+		inMemory: make(map[string]storedAggregates, len(s.inMemory)),
+	}
+	for name, m := range s.metrics {
+		snap.observed[name] = m
+	}
+	for i, tables := range s.tables {
+		snap.tables[i] = slices.Clone(tables)
+	}
+	for name, a := range s.inMemory {
+		snap.inMemory[name] = a.aggregates()
+	}
+	return snap
+}
+
+// memAggregates aggregates the samples of one metric in memory, for schemas
+// whose tables cannot be read back. Like k6's own summary, it keeps every
+// value of a Trend for its quantiles.
+type memAggregates struct {
+	storedAggregates
+	lastTime time.Time
+	trend    *metrics.TrendSink // nil unless the metric is a Trend
+}
+
+func newMemAggregates(typ metrics.MetricType) *memAggregates {
+	a := &memAggregates{}
+	if typ == metrics.Trend {
+		a.trend = metrics.NewTrendSink()
+	}
+	return a
+}
+
+// add aggregates sample.
+func (a *memAggregates) add(sample metrics.Sample) {
+	v := sample.Value
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.count++
+	a.sum += v
+	if v != 0 {
+		a.nonZero++
+	}
+	if !sample.Time.Before(a.lastTime) {
+		a.last, a.lastTime = v, sample.Time
+	}
+	if a.trend != nil {
+		a.trend.Add(sample)
+	}
+}
+
+// aggregates returns the aggregates as queryStoredAggregates reads them.
+func (a *memAggregates) aggregates() storedAggregates {
+	r := a.storedAggregates
+	if r.count > 0 {
+		r.avg = r.sum / float64(r.count)
+	}
+	if a.trend != nil {
+		r.quantiles = []float64{a.trend.P(0.5), a.trend.P(0.9), a.trend.P(0.95)}
+	}
+	return r
+}
+
+// storedAggregates are the aggregates of one metric as read back from a table.
+type storedAggregates struct {
+	count     uint64
+	sum       float64
+	min       float64
+	max       float64
+	avg       float64
+	quantiles []float64 // median, p(90), p(95)
+	nonZero   uint64
+	last      float64
+}
+
+// summaryFile is the JSON document written to Config.SummaryFile. Its metrics
+// section follows the layout of k6's handleSummary data.
+type summaryFile struct {
+	Source  string                   `json:"source"`
+	TestID  string                   `json:"testid,omitempty"`
+	Start   time.Time                `json:"start"`
+	End     time.Time                `json:"end"`
+	Tables  []string                 `json:"tables"`
+	Metrics map[string]summaryMetric `json:"metrics"`
+}
+
+// summaryMetric is one metric of the summary file.
+type summaryMetric struct {
+	Type     string             `json:"type"`
+	Contains string             `json:"contains"`
+	Table    string             `json:"table,omitempty"` // empty when aggregated in memory
+	Samples  uint64             `json:"samples"`
+	Values   map[string]float64 `json:"values"`
+}
+
+// readsBack reports whether queryStoredAggregates can read the tables of
+// schema: the built-in simple and compatible schemas, which store one sample
+// per row in metric, timestamp, and value columns.
+func readsBack(schema SchemaCreator) bool {
+	switch schema.(type) {
+	case SimpleSchema, CompatibleSchema:
+		return true
+	default:
+		return false
+	}
+}
+
+// testIDCondition returns the condition selecting a run's rows by testid in
+// the built-in schemas, or "" for schemas whose testid column is unknown.
+func testIDCondition(schema SchemaCreator) string {
+	if expr := runTagExpr(schema, "testid"); expr != "" {
+		return expr + " = ?"
+	}
+	return ""
+}
+
+// runTagExpr returns the expression reading a run-wide tag (testid, branch)
+// that the compatible schema stores in a column of the same name, or "" for
+// schemas that do not store it.
+func runTagExpr(schema SchemaCreator, tag string) string {
+	switch s := schema.(type) {
+	case CompatibleSchema:
+		return tag
+	case SimpleSchema:
+		switch s.tagStorage {
+		case TagStorageJSON:
+			return "toString(tags." + tag + ")"
+		case TagStorageString:
+			return "JSONExtractString(tags, '" + tag + "')"
+		default:
+			return "tags['" + tag + "']"
+		}
+	default:
+		return ""
+	}
+}
+
+// queryStoredAggregates reads back per-metric aggregates of the rows written
+// to tables, laid out as schema (see readsBack), between first and last,
+// narrowed to the run's testid when the schema stores it.
+func queryStoredAggregates(ctx context.Context, db *sql.DB, database string, schema SchemaCreator, tables []string,
+	testID string, first, last time.Time,
+) (map[string]storedAggregates, error) {
+	where := "timestamp BETWEEN fromUnixTimestamp64Milli(?) AND fromUnixTimestamp64Milli(?)"
+	args := []any{first.UnixMilli(), last.UnixMilli()}
+	if cond := testIDCondition(schema); cond != "" && testID != "" {
+		where += " AND " + cond
+		args = append(args, testID)
+	}
+
+	value := storedValueExpr(schema)
+	sum := "sum(" + value + ")"
+
+	// The tables of a target rolled over by TableTemplate share its layout
+	from := escapeIdentifier(database) + "." + escapeIdentifier(tables[0])
+	if len(tables) > 1 {
+		from = fmt.Sprintf("merge('%s', '^(%s)$')", database, strings.Join(tables, "|"))
+	}
+
+	//nolint:gosec // G201: identifiers are validated with isValidIdentifier() and escaped with backticks
+	query := fmt.Sprintf(`
+		SELECT metric, count(), %[1]s, min(%[2]s), max(%[2]s), avg(%[2]s),
+			quantiles(0.5, 0.9, 0.95)(%[2]s), countIf(%[2]s != 0), argMax(%[2]s, timestamp)
+		FROM %[3]s
+		WHERE %[4]s
+		GROUP BY metric
+	`, sum, value, from, where)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stored samples: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	result := make(map[string]storedAggregates)
+	for rows.Next() {
+		var (
+			metric string
+			a      storedAggregates
+		)
+		if err := rows.Scan(&metric, &a.count, &a.sum, &a.min, &a.max, &a.avg, &a.quantiles, &a.nonZero, &a.last); err != nil {
+			return nil, fmt.Errorf("failed to read stored samples: %w", err)
+		}
+		result[metric] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stored samples: %w", err)
+	}
+	return result, nil
+}
+
+// summaryValues maps stored aggregates onto the values k6 reports for a
+// metric type. Counter rates are per second of the observed time span.
+func summaryValues(typ metrics.MetricType, a storedAggregates, span time.Duration) map[string]float64 {
+	values := make(map[string]float64)
+	switch typ {
+	case metrics.Counter:
+		values["count"] = a.sum
+		if span > 0 {
+			values["rate"] = a.sum / span.Seconds()
+		}
+	case metrics.Gauge:
+		values["value"] = a.last
+		values["min"] = a.min
+		values["max"] = a.max
+	case metrics.Rate:
+		values["passes"] = float64(a.nonZero)
+		values["fails"] = float64(a.count - a.nonZero)
+		if a.count > 0 {
+			values["rate"] = float64(a.nonZero) / float64(a.count)
+		}
+	default:
+		values["avg"] = a.avg
+		values["min"] = a.min
+		values["max"] = a.max
+		for i, key := range []string{"med", "p(90)", "p(95)"} {
+			if i < len(a.quantiles) {
+				values[key] = a.quantiles[i]
+			}
+		}
+	}
+
+	// encoding/json cannot represent NaN or infinities
+	for key, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			delete(values, key)
+		}
+	}
+	return values
+}
+
+// buildSummary reads back the samples the output wrote and assembles the
+// summary file. With several targets, each metric is reported from the first
+// target holding it, and from the in-memory aggregates when no target whose
+// tables can be read back does.
+func (o *Output) buildSummary(ctx context.Context, db *sql.DB, summary *runSummary) (summaryFile, error) {
+	snap := summary.snapshot()
+	doc := summaryFile{
+		Source:  "clickhouse",
+		TestID:  o.testID,
+		Start:   snap.first.UTC(),
+		End:     snap.last.UTC(),
+		Metrics: make(map[string]summaryMetric),
+	}
+	if len(snap.observed) == 0 {
+		return doc, nil
+	}
+
+	span := snap.last.Sub(snap.first)
+	var errs []error
+	for i, t := range o.targets {
+		tables := []string{t.table}
+		if i < len(snap.tables) {
+			tables = snap.tables[i]
+		}
+		doc.Tables = append(doc.Tables, tables...)
+		if !readsBack(t.schema) {
+			continue
+		}
+		stored, err := queryStoredAggregates(ctx, t.handle(db), o.config.Database, t.schema, tables,
+			o.testID, snap.first, snap.last)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("table %s: %w", t.table, err))
+			continue
+		}
+
+		names := make([]string, 0, len(stored))
+		for name := range stored {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			m, ok := snap.observed[name]
+			if !ok {
+				continue // written by another run in the same time span
+			}
+			if _, done := doc.Metrics[name]; done {
+				continue
+			}
+			a := stored[name]
+			doc.Metrics[name] = summaryMetric{
+				Type:     m.Type.String(),
+				Contains: m.Contains.String(),
+				Table:    strings.Join(tables, ","),
+				Samples:  a.count,
+				Values:   summaryValues(m.Type, a, span),
+			}
+		}
+	}
+
+	for name, a := range snap.inMemory {
+		if _, done := doc.Metrics[name]; done {
+			continue
+		}
+		m := snap.observed[name]
+		doc.Metrics[name] = summaryMetric{
+			Type:     m.Type.String(),
+			Contains: m.Contains.String(),
+			Samples:  a.count,
+			Values:   summaryValues(m.Type, a, span),
+		}
+	}
+	return doc, errors.Join(errs...)
+}
+
+// writeSummary writes Config.SummaryFile at shutdown. Failures are logged;
+// they never fail Stop.
+func (o *Output) writeSummary(ctx context.Context, summary *runSummary) {
+	if summary == nil || o.db == nil {
+		return
+	}
+
+	path := o.config.SummaryFile
+	logger := o.logger.WithField("summaryFile", path)
+
+	doc, err := o.buildSummary(ctx, o.db, summary)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read back stored samples, summary is incomplete")
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		logger.WithError(err).Warn("Failed to encode summary")
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil { // #nosec G304 - path is operator config
+		logger.WithError(err).Warn("Failed to write summary")
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		logger.WithError(err).Warn("Failed to write summary")
+		return
+	}
+	logger.WithField("metrics", len(doc.Metrics)).Info("Wrote summary of stored samples")
+}
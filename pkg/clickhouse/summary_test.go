@@ -0,0 +1,152 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/lib"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestOutput_SummaryFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	fake, out := newFakeOutput(t, output.Params{
+		JSONConfig:    mustMarshalJSON(map[string]any{"pushInterval": "1h", "summaryFile": path}),
+		ScriptOptions: lib.Options{RunTags: map[string]string{"testid": "nightly-42"}},
+	})
+	fake.set(func(f *fakeDB) {
+		// metric, count, sum, min, max, avg, quantiles, non-zero count, last
+		f.selectRows = [][]driver.Value{
+			{"http_req_duration", uint64(2), 300.0, 100.0, 200.0, 150.0, []float64{150, 190, 195}, uint64(2), 200.0},
+			{"http_reqs", uint64(2), 2.0, 1.0, 1.0, 1.0, []float64{1, 1, 1}, uint64(2), 1.0},
+			{"other_run_metric", uint64(9), 9.0, 1.0, 1.0, 1.0, []float64{1, 1, 1}, uint64(9), 1.0},
+		}
+	})
+
+	require.NoError(t, out.Start())
+
+	registry := metrics.NewRegistry()
+	duration := registry.MustNewMetric(metrics.HTTPReqDurationName, metrics.Trend, metrics.Time)
+	reqs := registry.MustNewMetric(metrics.HTTPReqsName, metrics.Counter)
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	tags := registry.RootTagSet()
+	out.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+		{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: tags}, Time: start, Value: 100},
+		{TimeSeries: metrics.TimeSeries{Metric: reqs, Tags: tags}, Time: start, Value: 1},
+		{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: tags}, Time: start.Add(2 * time.Second), Value: 200},
+		{TimeSeries: metrics.TimeSeries{Metric: reqs, Tags: tags}, Time: start.Add(2 * time.Second), Value: 1},
+	}})
+	require.NoError(t, out.Stop())
+
+	fake.set(func(f *fakeDB) {
+		require.Len(t, f.selects, 1)
+		assert.Contains(t, f.selects[0], "FROM `k6`.`samples`")
+		assert.Contains(t, f.selects[0], "AND tags['testid'] = ?")
+		assert.Equal(t, []any{start.UnixMilli(), start.Add(2 * time.Second).UnixMilli(), "nightly-42"}, f.selectArgs[0])
+	})
+
+	data, err := os.ReadFile(path) // #nosec G304 - test temp dir
+	require.NoError(t, err)
+	var doc summaryFile
+	require.NoError(t, json.Unmarshal(data, &doc))
+
+	assert.Equal(t, "nightly-42", doc.TestID)
+	assert.Equal(t, []string{"samples"}, doc.Tables)
+	assert.Equal(t, start, doc.Start)
+	require.Len(t, doc.Metrics, 2, "rows of metrics this run did not write are ignored")
+	assert.Equal(t, summaryMetric{
+		Type: "trend", Contains: "time", Table: "samples", Samples: 2,
+		Values: map[string]float64{"avg": 150, "min": 100, "max": 200, "med": 150, "p(90)": 190, "p(95)": 195},
+	}, doc.Metrics["http_req_duration"])
+	assert.Equal(t, map[string]float64{"count": 2, "rate": 1}, doc.Metrics["http_reqs"].Values)
+}
+
+func TestSummaryValues(t *testing.T) {
+	t.Parallel()
+
+	a := storedAggregates{count: 4, sum: 3, min: 0, max: 1, avg: 0.75, nonZero: 3, last: 1}
+	assert.Equal(t, map[string]float64{"rate": 0.75, "passes": 3, "fails": 1}, summaryValues(metrics.Rate, a, time.Second))
+	assert.Equal(t, map[string]float64{"value": 1, "min": 0, "max": 1}, summaryValues(metrics.Gauge, a, time.Second))
+	assert.Equal(t, map[string]float64{"count": 3}, summaryValues(metrics.Counter, a, 0), "no rate without a time span")
+}
+
+func TestTestIDCondition(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "testid = ?", testIDCondition(CompatibleSchema{}))
+	assert.Equal(t, "tags['testid'] = ?", testIDCondition(SimpleSchema{tagStorage: TagStorageMap}))
+	assert.Equal(t, "toString(tags.testid) = ?", testIDCondition(SimpleSchema{tagStorage: TagStorageJSON}))
+	assert.Equal(t, "JSONExtractString(tags, 'testid') = ?", testIDCondition(SimpleSchema{tagStorage: TagStorageString}))
+	assert.Empty(t, testIDCondition(struct{ SchemaCreator }{}))
+}
+
+func TestOutput_SummaryFileInMemory(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval": "1h",
+		"schemaMode":   "star",
+		"seriesTable":  "k6_series",
+		"summaryFile":  path,
+	})
+
+	registry := metrics.NewRegistry()
+	duration := registry.MustNewMetric(metrics.HTTPReqDurationName, metrics.Trend, metrics.Time)
+	failed := registry.MustNewMetric(metrics.HTTPReqFailedName, metrics.Rate)
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	tags := registry.RootTagSet()
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+		{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: tags}, Time: start, Value: 100},
+		{TimeSeries: metrics.TimeSeries{Metric: failed, Tags: tags}, Time: start, Value: 1},
+		{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: tags}, Time: start.Add(time.Second), Value: 300},
+		{TimeSeries: metrics.TimeSeries{Metric: failed, Tags: tags}, Time: start.Add(time.Second), Value: 0},
+	}})
+	require.NoError(t, o.Stop())
+
+	fake.set(func(f *fakeDB) { assert.Empty(t, f.selects, "the star schema is not read back") })
+
+	data, err := os.ReadFile(path) // #nosec G304 - test temp dir
+	require.NoError(t, err)
+	var doc summaryFile
+	require.NoError(t, json.Unmarshal(data, &doc))
+
+	assert.Equal(t, []string{"samples"}, doc.Tables)
+	assert.Equal(t, summaryMetric{
+		Type: "trend", Contains: "time", Samples: 2,
+		Values: map[string]float64{"avg": 200, "min": 100, "max": 300, "med": 200, "p(90)": 280, "p(95)": 290},
+	}, doc.Metrics["http_req_duration"])
+	assert.Equal(t, map[string]float64{"rate": 0.5, "passes": 1, "fails": 1}, doc.Metrics["http_req_failed"].Values)
+}
+
+func TestRunSummary_RolledOverTables(t *testing.T) {
+	t.Parallel()
+
+	targets := []*schemaTarget{{table: "samples_20260501", schema: SimpleSchema{}}}
+	summary := newRunSummary("summary.json", targets)
+	assert.Nil(t, summary.inMemory, "the simple schema is read back")
+
+	summary.observe([]metrics.SampleContainer{makeSampleContainer(t)}, targets)
+	summary.observe([]metrics.SampleContainer{makeSampleContainer(t)},
+		[]*schemaTarget{{table: "samples_20260502", schema: SimpleSchema{}}})
+	snap := summary.snapshot()
+	assert.Equal(t, [][]string{{"samples_20260501", "samples_20260502"}}, snap.tables)
+
+	fake, db := newFakeDB(t)
+	_, err := queryStoredAggregates(context.Background(), db, "k6", SimpleSchema{}, snap.tables[0], "", snap.first, snap.last)
+	require.NoError(t, err)
+	fake.set(func(f *fakeDB) {
+		require.Len(t, f.selects, 1)
+		assert.Contains(t, f.selects[0], "FROM merge('k6', '^(samples_20260501|samples_20260502)$')")
+	})
+}
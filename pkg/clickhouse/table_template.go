@@ -0,0 +1,81 @@
+package clickhouse
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tableRoller moves the targets to a new table when the name TableTemplate
+// expands to changes, e.g. at UTC midnight with {yyyyMMdd}.
+type tableRoller struct {
+	template string // TableTemplate with the per-run placeholders expanded
+
+	mu      sync.Mutex // Serializes rollovers of concurrent flushes
+	current string     // Table the targets derive their tables from
+}
+
+// newTableRoller returns nil unless template has a placeholder that changes
+// during the run. current is the table named at startup.
+func newTableRoller(template, current string) *tableRoller {
+	if !strings.Contains(template, tableNameDay) && !strings.Contains(template, tableNameMonth) {
+		return nil
+	}
+	return &tableRoller{template: template, current: current}
+}
+
+// rollTables switches the targets to the tables TableTemplate names at now,
+// creating them first. Flushes already running finish on the old tables. If
+// a table cannot be created, the targets keep writing to the old tables and
+// the next flush tries again.
+func (o *Output) rollTables(ctx context.Context, now time.Time) {
+	r := o.tableRoller
+	if r == nil {
+		return
+	}
+	table := tableFromTemplate(r.template, now)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if table == r.current {
+		return
+	}
+
+	o.mu.RLock()
+	db, closed := o.db, o.closed
+	previous := o.targets
+	o.mu.RUnlock()
+	if db == nil || closed {
+		return
+	}
+
+	// Before the deferred setup, ensureServer creates whichever tables the
+	// targets name by then
+	create := o.config.createsTable() && o.serverReady.Load()
+
+	targets := make([]*schemaTarget, len(previous))
+	for i, t := range previous {
+		next := *t
+		// Target tables share the template's name as prefix (see targetTable)
+		next.table = table + strings.TrimPrefix(t.table, r.current)
+		next.insertQuery = next.schema.InsertQuery(o.config.Database, next.table)
+		if create {
+			if err := o.createTableTraced(ctx, next.handle(db), &next); err != nil && !createdConcurrently(err) {
+				o.logger.WithError(err).WithField("table", next.table).
+					Warn("Failed to create the next table of tableTemplate, writing to the current one until it succeeds")
+				return
+			}
+		}
+		targets[i] = &next
+	}
+
+	o.mu.Lock()
+	// A reconnect since the copies were made may have replaced a shard's handle
+	o.targets = withShardHandles(targets, o.shards)
+	o.mu.Unlock()
+	o.logger.WithFields(logrus.Fields{"from": r.current, "to": table}).Info("Switched to the next table of tableTemplate")
+	r.current = table
+}
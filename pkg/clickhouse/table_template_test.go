@@ -0,0 +1,68 @@
+package clickhouse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_TableTemplate(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 3, 7, 23, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	cfg := NewConfig()
+	cfg.TableTemplate = "samples_{testid}_{yyyyMMdd}"
+	require.NoError(t, cfg.expandRunNames(map[string]string{"testid": "exp-42"}, start))
+	assert.Equal(t, "samples_exp_42_{yyyyMMdd}", cfg.TableTemplate, "{testid} is fixed for the run")
+	assert.Equal(t, "samples_exp_42_20260307", cfg.Table, "dates are UTC")
+
+	cfg = NewConfig()
+	cfg.TableTemplate = "samples_{yyyyMM}"
+	require.NoError(t, cfg.expandRunNames(nil, start))
+	assert.Equal(t, "samples_202603", cfg.Table)
+
+	cfg = NewConfig()
+	cfg.TableTemplate = "samples_{testid}"
+	require.ErrorContains(t, cfg.expandRunNames(nil, start), "uses {testid} but the run has no testid tag")
+
+	assert.Nil(t, newTableRoller("samples_exp_42", "samples_exp_42"), "nothing to roll")
+	assert.Nil(t, newTableRoller("", "samples"))
+}
+
+func TestOutput_TableTemplate(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"tableTemplate": "samples_{yyyyMMdd}",
+		"schemaMode":    "simple,compatible",
+		"pushInterval":  "1h",
+	})
+
+	today := "samples_" + time.Now().UTC().Format("20060102")
+	tomorrow := "samples_" + time.Now().UTC().Add(24*time.Hour).Format("20060102")
+	created := len(fake.DDL())
+
+	o.rollTables(context.Background(), time.Now().Add(24*time.Hour))
+	ddl := fake.DDL()[created:]
+	require.Len(t, ddl, 2)
+	assert.Contains(t, ddl[0], "`k6`.`"+tomorrow+"`")
+	assert.Contains(t, ddl[1], "`k6`.`"+tomorrow+"_compatible`")
+	assert.Equal(t, tomorrow+"_compatible", o.targets[1].table)
+
+	// A failed creation keeps the current tables
+	fake.set(func(f *fakeDB) { f.ddlErr = assert.AnError })
+	o.rollTables(context.Background(), time.Now())
+	assert.Equal(t, tomorrow, o.targets[0].table)
+	fake.set(func(f *fakeDB) { f.ddlErr = nil })
+
+	// The flush itself moves to the table of the current day
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	assert.Equal(t, today, o.targets[0].table)
+	assert.Contains(t, fake.Prepared(), "INSERT INTO `k6`.`"+today+"` (timestamp, metric, value, tags) VALUES (?, ?, ?, ?)")
+	assert.Len(t, fake.Rows(), 2)
+}
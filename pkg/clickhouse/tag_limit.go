@@ -0,0 +1,92 @@
+package clickhouse
+
+import (
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mstoykov/atlas"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// overflowTag is the tag that collects the tags beyond MaxTagsPerSample.
+const overflowTag = "_overflow"
+
+// tagLimiter enforces MaxTagsPerSample. A sample with more tags keeps
+// maxTags-1 of them, k6's system tags first and then by name, and the rest
+// become one _overflow tag holding them as a JSON object.
+type tagLimiter struct {
+	maxTags    int
+	overflowed *atomic.Uint64
+}
+
+// newTagLimiter returns nil when the number of tags is not limited.
+// overflowed counts the samples whose tags were collapsed.
+func newTagLimiter(maxTags int, overflowed *atomic.Uint64) *tagLimiter {
+	if maxTags <= 0 {
+		return nil
+	}
+	return &tagLimiter{maxTags: maxTags, overflowed: overflowed}
+}
+
+// apply returns sample with its tags limited.
+func (l *tagLimiter) apply(sample metrics.Sample) metrics.Sample {
+	if sample.Tags == nil {
+		return sample
+	}
+	tags := sample.Tags.Map()
+	if len(tags) <= l.maxTags {
+		return sample
+	}
+
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if as, bs := isSystemTag(a), isSystemTag(b); as != bs {
+			if as {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+
+	// Split the tags, then build the limited set from the empty one in a
+	// single pass rather than removing the overflowing tags one by one
+	kept := make(map[string]string, l.maxTags)
+	overflow := make(map[string]string, len(names)-l.maxTags+1)
+	for i, name := range names {
+		if i < l.maxTags-1 {
+			kept[name] = tags[name]
+		} else {
+			overflow[name] = tags[name]
+		}
+	}
+	encoded, err := metrics.MarshalJSONWithoutHTMLEscape(overflow)
+	if err != nil {
+		// A map of strings always encodes; keep the sample intact regardless
+		return sample
+	}
+	kept[overflowTag] = string(encoded)
+	sample.Tags = rootTagSet(sample.Tags).WithTagsFromMap(kept)
+	l.overflowed.Add(1)
+	return sample
+}
+
+// rootTagSet returns the empty tag set tags descend from, that of the run's
+// registry, so that derived sets compare equal to those k6 builds.
+func rootTagSet(tags *metrics.TagSet) *metrics.TagSet {
+	n := (*atlas.Node)(tags)
+	for !n.IsRoot() {
+		n, _, _ = n.Data()
+	}
+	return (*metrics.TagSet)(n)
+}
+
+// isSystemTag reports whether name is one of k6's system tags.
+func isSystemTag(name string) bool {
+	_, err := metrics.SystemTagString(name)
+	return err == nil
+}
@@ -0,0 +1,79 @@
+package clickhouse
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+func TestTagLimiter(t *testing.T) {
+	t.Parallel()
+
+	var overflowed atomic.Uint64
+	assert.Nil(t, newTagLimiter(0, &overflowed))
+
+	registry := metrics.NewRegistry()
+	sample := metrics.Sample{TimeSeries: metrics.TimeSeries{
+		Metric: registry.MustNewMetric("http_reqs", metrics.Counter),
+		Tags: registry.RootTagSet().WithTagsFromMap(map[string]string{
+			"method": "GET", "status": "200", "a_custom": "x", "user": "alice",
+		}),
+	}}
+
+	limiter := newTagLimiter(3, &overflowed)
+	limited := limiter.apply(sample)
+	assert.Equal(t, map[string]string{
+		"method":    "GET",
+		"status":    "200",
+		"_overflow": `{"a_custom":"x","user":"alice"}`,
+	}, limited.Tags.Map(), "system tags are kept ahead of custom ones")
+	assert.Same(t, registry.RootTagSet().WithTagsFromMap(limited.Tags.Map()), limited.Tags,
+		"the limited set descends from the registry's root")
+	assert.Equal(t, uint64(1), overflowed.Load())
+
+	// Samples within the limit are left alone
+	assert.Same(t, sample.Tags, newTagLimiter(4, &overflowed).apply(sample).Tags)
+	assert.Equal(t, uint64(1), overflowed.Load())
+
+	assert.Equal(t, map[string]string{
+		"_overflow": `{"a_custom":"x","method":"GET","status":"200","user":"alice"}`,
+	}, newTagLimiter(1, &overflowed).apply(sample).Tags.Map())
+}
+
+func TestOutput_MaxTagsPerSample(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"maxTagsPerSample": 2,
+		"pushInterval":     "1h",
+	})
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("http_reqs", metrics.Counter)
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{
+		{
+			TimeSeries: metrics.TimeSeries{
+				Metric: metric,
+				Tags:   registry.RootTagSet().With("status", "200").With("id1", "a").With("id2", "b"),
+			},
+			Time:  time.Now(),
+			Value: 1,
+		},
+		{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet().With("status", "200")},
+			Time:       time.Now(),
+			Value:      1,
+		},
+	}})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 2)
+	assert.Equal(t, map[string]string{"status": "200", "_overflow": `{"id1":"a","id2":"b"}`}, rows[0][3])
+	assert.Equal(t, map[string]string{"status": "200"}, rows[1][3])
+	assert.Equal(t, uint64(1), o.GetErrorMetrics().TagOverflowSamples)
+}
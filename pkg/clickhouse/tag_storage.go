@@ -0,0 +1,122 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// Tag storage formats (Config.TagStorage) for the tags / extra_tags columns.
+const (
+	// TagStorageMap stores tags in a Map(String, String) column (default).
+	TagStorageMap = "map"
+
+	// TagStorageJSON stores tags in a native JSON column, enabling dot-notation
+	// access (tags.method) and per-path columnar compression. Requires
+	// ClickHouse 24.8 or newer.
+	TagStorageJSON = "json"
+
+	// TagStorageString stores tags as a JSON-encoded String column, for
+	// downstream tools that cannot read Map columns.
+	TagStorageString = "string"
+)
+
+// jsonTypeMinVersion is the first ClickHouse release with the new JSON type.
+var jsonTypeMinVersion = serverVersion{Major: 24, Minor: 8}
+
+// validateTagStorage checks the TagStorage value.
+func (c Config) validateTagStorage() error {
+	switch c.TagStorage {
+	case TagStorageMap, TagStorageJSON, TagStorageString:
+		return nil
+	default:
+		return fmt.Errorf("invalid tagStorage: %s (valid: %s, %s, %s)", c.TagStorage, TagStorageMap, TagStorageJSON, TagStorageString)
+	}
+}
+
+// jsonTypeContext enables the JSON type for DDL sent with the returned
+// context. The setting is required on 24.8-25.2, where the type is still
+// experimental, and accepted as a no-op alias on later releases.
+func jsonTypeContext(ctx context.Context) context.Context {
+	return clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"allow_experimental_json_type": 1,
+	}))
+}
+
+// encodeTags renders tags as a JSON object for TagStorageString. Keys are
+// sorted, so equal tag sets always encode to the same string.
+func encodeTags(tags map[string]string) (string, error) {
+	b, err := json.Marshal(tags)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// serverVersion is a ClickHouse release number (major.minor).
+type serverVersion struct {
+	Major int
+	Minor int
+}
+
+func (v serverVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// atLeast reports whether v is the same release as minVersion or newer.
+func (v serverVersion) atLeast(minVersion serverVersion) bool {
+	if v.Major != minVersion.Major {
+		return v.Major > minVersion.Major
+	}
+	return v.Minor >= minVersion.Minor
+}
+
+// parseServerVersion parses the output of SELECT version(), e.g. "24.8.4.13".
+func parseServerVersion(s string) (serverVersion, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ".", 3)
+	if len(parts) < 2 {
+		return serverVersion{}, fmt.Errorf("unrecognized server version %q", s)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return serverVersion{}, fmt.Errorf("unrecognized server version %q: %w", s, err)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return serverVersion{}, fmt.Errorf("unrecognized server version %q: %w", s, err)
+	}
+	return serverVersion{Major: major, Minor: minor}, nil
+}
+
+// queryServerVersion returns the release of the connected server.
+func queryServerVersion(ctx context.Context, db *sql.DB) (serverVersion, error) {
+	var raw string
+	if err := db.QueryRowContext(ctx, "SELECT version()").Scan(&raw); err != nil {
+		return serverVersion{}, fmt.Errorf("failed to query server version: %w", err)
+	}
+	return parseServerVersion(raw)
+}
+
+// checkServerFeatures verifies that the server supports the features the
+// configuration depends on, so an unsupported option fails at Start rather
+// than on the first DDL or insert.
+func (c Config) checkServerFeatures(ctx context.Context, db *sql.DB) error {
+	if c.TagStorage != TagStorageJSON {
+		return nil
+	}
+
+	v, err := queryServerVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("tagStorage=%s requires server feature detection: %w", TagStorageJSON, err)
+	}
+	if !v.atLeast(jsonTypeMinVersion) {
+		return fmt.Errorf("tagStorage=%s requires ClickHouse %s or newer (server is %s); use tagStorage=%s",
+			TagStorageJSON, jsonTypeMinVersion, v, TagStorageMap)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input   string
+		want    serverVersion
+		wantErr bool
+	}{
+		{"24.8.4.13", serverVersion{24, 8}, false},
+		{"25.3.1.2703", serverVersion{25, 3}, false},
+		{" 23.12.1 ", serverVersion{23, 12}, false},
+		{"24", serverVersion{}, true},
+		{"v24.8", serverVersion{}, true},
+		{"", serverVersion{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseServerVersion(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServerVersion_AtLeast(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, serverVersion{24, 8}.atLeast(jsonTypeMinVersion))
+	assert.True(t, serverVersion{24, 10}.atLeast(jsonTypeMinVersion))
+	assert.True(t, serverVersion{25, 1}.atLeast(jsonTypeMinVersion))
+	assert.False(t, serverVersion{24, 3}.atLeast(jsonTypeMinVersion))
+	assert.False(t, serverVersion{23, 12}.atLeast(jsonTypeMinVersion))
+}
+
+func TestConfig_ValidateTagStorage(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TagStorage = TagStorageJSON
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TagStorage = "Nested"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid tagStorage: Nested")
+}
+
+func TestParseConfig_TagStorage(t *testing.T) {
+	t.Run("json config", func(t *testing.T) {
+		cfg, err := ParseConfig(output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{"tagStorage": "json"}),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, TagStorageJSON, cfg.TagStorage)
+	})
+
+	t.Run("env overrides url", func(t *testing.T) {
+		t.Setenv("K6_CLICKHOUSE_TAG_STORAGE", "map")
+
+		cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?tagStorage=json"})
+		require.NoError(t, err)
+		assert.Equal(t, TagStorageMap, cfg.TagStorage)
+	})
+}
+
+func TestOutput_JSONTagStorage(t *testing.T) {
+	t.Parallel()
+
+	t.Run("declares JSON columns on supported servers", func(t *testing.T) {
+		t.Parallel()
+
+		fake, o := newFakeOutput(t, output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{
+				"schemaMode": "simple,compatible",
+				"tagStorage": "json",
+			}),
+		})
+		fake.set(func(f *fakeDB) { f.version = "24.8.4.13" })
+		require.NoError(t, o.Start())
+		defer func() { require.NoError(t, o.Stop()) }()
+
+		ddl := fake.DDL()
+		require.Len(t, ddl, 3)
+		assert.Contains(t, ddl[1], "tags JSON")
+		assert.Contains(t, ddl[2], "extra_tags        JSON")
+
+		registry := metrics.NewRegistry()
+		o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{{
+			TimeSeries: metrics.TimeSeries{
+				Metric: registry.MustNewMetric("checkout", metrics.Trend),
+				Tags:   registry.RootTagSet().WithTagsFromMap(map[string]string{"user_tier": "gold"}),
+			},
+			Value: 1,
+		}}})
+		o.flush()
+
+		rows := fake.Rows()
+		require.Len(t, rows, 2)
+		assert.Equal(t, map[string]string{"user_tier": "gold"}, rows[0][3], "JSON columns accept the tag map as-is")
+		assert.Equal(t, map[string]string{"user_tier": "gold"}, rows[1][20])
+	})
+
+	t.Run("fails at Start on older servers", func(t *testing.T) {
+		t.Parallel()
+
+		fake, out := newFakeOutput(t, output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{"tagStorage": "json"}),
+		})
+		fake.set(func(f *fakeDB) { f.version = "24.3.2.23" })
+
+		err := out.Start()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "requires ClickHouse 24.8 or newer (server is 24.3)")
+		assert.Empty(t, fake.DDL(), "no DDL is sent to an unsupported server")
+		require.NoError(t, out.Stop())
+	})
+
+	t.Run("fails at Start when detection fails", func(t *testing.T) {
+		t.Parallel()
+
+		fake, out := newFakeOutput(t, output.Params{
+			JSONConfig: mustMarshalJSON(map[string]any{"tagStorage": "json"}),
+		})
+		fake.set(func(f *fakeDB) { f.queryErr = errors.New("access denied") })
+
+		err := out.Start()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "feature detection")
+		require.NoError(t, out.Stop())
+	})
+
+	t.Run("map storage skips detection", func(t *testing.T) {
+		t.Parallel()
+
+		fake, out := newFakeOutput(t, output.Params{})
+		fake.set(func(f *fakeDB) { f.queryErr = errors.New("must not be queried") })
+		require.NoError(t, out.Start())
+		require.NoError(t, out.Stop())
+	})
+}
+
+func TestSchemas_TagStorageDDL(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "Map(String, String)", SimpleSchema{}.tagsDDL())
+	assert.Equal(t, "JSON", SimpleSchema{tagStorage: TagStorageJSON}.tagsDDL())
+	assert.Contains(t, compatibleOptions{}.extraTagsDDL(), "Map(LowCardinality(String), String)")
+	assert.Equal(t, "JSON", compatibleOptions{tagStorage: TagStorageJSON}.extraTagsDDL())
+
+	_, db := newFakeDB(t)
+	assert.NoError(t, SimpleSchema{tagStorage: TagStorageJSON}.CreateSchema(context.Background(), db, "k6", "samples"))
+}
+
+func TestEncodeTags(t *testing.T) {
+	t.Parallel()
+
+	got, err := encodeTags(map[string]string{"status": "200", "method": "GET", "quote": `a"b`})
+	require.NoError(t, err)
+	assert.Equal(t, `{"method":"GET","quote":"a\"b","status":"200"}`, got, "keys are sorted for stable output")
+
+	got, err = encodeTags(map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, "{}", got)
+}
+
+func TestStringTagStorage(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.TagStorage = TagStorageString
+	cfg.TypedExtraTags = true
+
+	registry := metrics.NewRegistry()
+	sample := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: registry.MustNewMetric("http_reqs", metrics.Counter),
+			Tags: registry.RootTagSet().WithTagsFromMap(map[string]string{
+				"method":    "GET",
+				"user_tier": "gold",
+				"attempt":   "2",
+			}),
+		},
+		Value: 1,
+	}
+
+	t.Run("simple", func(t *testing.T) {
+		t.Parallel()
+
+		impl, err := configureSimple(cfg)
+		require.NoError(t, err)
+		assert.Contains(t, impl.Schema.(SimpleSchema).tagsDDL(), "String")
+
+		row, err := impl.Converter.Convert(context.Background(), sample)
+		require.NoError(t, err)
+		assert.Equal(t, `{"attempt":"2","method":"GET","user_tier":"gold"}`, row[3])
+		impl.Converter.Release(row)
+	})
+
+	t.Run("compatible", func(t *testing.T) {
+		t.Parallel()
+
+		impl, err := configureCompatible(cfg)
+		require.NoError(t, err)
+
+		fake, db := newFakeDB(t)
+		require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+		assert.Contains(t, fake.DDL()[1], "extra_tags        String DEFAULT '{}'")
+
+		row, err := impl.Converter.Convert(context.Background(), sample)
+		require.NoError(t, err)
+		assert.Equal(t, "GET", row[11])
+		assert.Equal(t, `{"user_tier":"gold"}`, row[20], "typed tags are split out before encoding")
+		assert.Equal(t, map[string]float64{"attempt": 2}, row[21])
+		impl.Converter.Release(row)
+	})
+}
@@ -0,0 +1,73 @@
+package clickhouse
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// Names of the built-in tag transformers.
+const (
+	// TransformerStripURLQuery removes the query string from the url and
+	// name tags, where it often carries tokens and inflates cardinality.
+	TransformerStripURLQuery = "stripURLQuery"
+)
+
+func init() {
+	RegisterTagTransformer(TransformerStripURLQuery, TagTransformerFunc(stripURLQuery))
+}
+
+// stripURLQuery is the stripURLQuery transformer.
+func stripURLQuery(sample metrics.Sample) *metrics.TagSet {
+	tags := sample.Tags
+	for _, tag := range []string{"url", "name"} {
+		if value, ok := tags.Get(tag); ok {
+			if before, _, found := strings.Cut(value, "?"); found {
+				tags = tags.With(tag, before)
+			}
+		}
+	}
+	return tags
+}
+
+// validateTagTransformers checks that every transformer in TagTransformers is
+// registered.
+func (c Config) validateTagTransformers() error {
+	var errs []error
+	for _, name := range c.TagTransformers {
+		if _, err := GetTagTransformer(name); err != nil {
+			errs = append(errs, fmt.Errorf("invalid tagTransformers: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolveTagTransformers returns the transformers listed in TagTransformers,
+// in order.
+func (c Config) resolveTagTransformers() ([]TagTransformer, error) {
+	transformers := make([]TagTransformer, 0, len(c.TagTransformers))
+	for _, name := range c.TagTransformers {
+		t, err := GetTagTransformer(name)
+		if err != nil {
+			return nil, err
+		}
+		transformers = append(transformers, t)
+	}
+	return transformers, nil
+}
+
+// transformTags returns sample with its tags rewritten by each transformer in
+// turn. Samples without tags are left alone.
+func transformTags(transformers []TagTransformer, sample metrics.Sample) metrics.Sample {
+	if sample.Tags == nil {
+		return sample
+	}
+	for _, t := range transformers {
+		if tags := t.Transform(sample); tags != nil {
+			sample.Tags = tags
+		}
+	}
+	return sample
+}
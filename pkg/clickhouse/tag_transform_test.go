@@ -0,0 +1,100 @@
+package clickhouse
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestTagTransformerRegistry(t *testing.T) {
+	t.Parallel()
+
+	assert.Contains(t, AvailableTagTransformers(), TransformerStripURLQuery)
+
+	_, err := GetTagTransformer("nope")
+	assert.ErrorContains(t, err, `unknown tag transformer: "nope"`)
+
+	assert.Panics(t, func() { RegisterTagTransformer("", TagTransformerFunc(nil)) })
+	assert.Panics(t, func() { RegisterTagTransformer("test_nil", nil) })
+
+	cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?tagTransformers=stripURLQuery"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{TransformerStripURLQuery}, cfg.TagTransformers)
+
+	_, err = ParseConfig(output.Params{JSONConfig: mustMarshalJSON(map[string]any{
+		"tagTransformers": []string{"stripUrlQuery"},
+	})})
+	assert.ErrorContains(t, err, `invalid tagTransformers: unknown tag transformer: "stripUrlQuery"`)
+}
+
+func TestStripURLQuery(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	sample := metrics.Sample{TimeSeries: metrics.TimeSeries{
+		Metric: registry.MustNewMetric(metrics.HTTPReqsName, metrics.Counter),
+		Tags: registry.RootTagSet().
+			With("url", "https://api.example.com/items?token=s3cret").
+			With("name", "https://api.example.com/items?token=s3cret").
+			With("method", "GET"),
+	}}
+
+	got := transformTags([]TagTransformer{TagTransformerFunc(stripURLQuery)}, sample)
+	assert.Equal(t, map[string]string{
+		"url":    "https://api.example.com/items",
+		"name":   "https://api.example.com/items",
+		"method": "GET",
+	}, got.Tags.Map())
+	assert.Equal(t, "https://api.example.com/items?token=s3cret", sample.Tags.Map()["url"], "the source sample is untouched")
+
+	sample.Tags = nil
+	assert.Nil(t, transformTags([]TagTransformer{TagTransformerFunc(stripURLQuery)}, sample).Tags)
+}
+
+func TestOutput_TagTransformers(t *testing.T) {
+	t.Parallel()
+
+	rename := TagTransformerFunc(func(s metrics.Sample) *metrics.TagSet {
+		user, ok := s.Tags.Get("uid")
+		if !ok {
+			return nil
+		}
+		return s.Tags.Without("uid").With("user_id", user)
+	})
+
+	fake, db := newFakeDB(t)
+	out, err := NewWithOptions(output.Params{
+		Logger: newTestLogger(t),
+		JSONConfig: mustMarshalJSON(map[string]any{
+			"tagTransformers": []string{TransformerStripURLQuery},
+			"hashTags":        []string{"user_id"},
+		}),
+	}, WithDB(db), WithTagTransformers(rename, nil))
+	require.NoError(t, err)
+	o := out.(*Output)
+	require.NoError(t, o.Start())
+	defer func() { require.NoError(t, o.Stop()) }()
+
+	registry := metrics.NewRegistry()
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{{
+		TimeSeries: metrics.TimeSeries{
+			Metric: registry.MustNewMetric(metrics.HTTPReqsName, metrics.Counter),
+			Tags:   registry.RootTagSet().With("url", "https://example.com/?q=1").With("uid", "alice"),
+		},
+		Time:  time.Now(),
+		Value: 1,
+	}}})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 1)
+	assert.Equal(t, map[string]string{
+		"url":     "https://example.com/",
+		"user_id": strconv.FormatUint(hashTagValue("alice"), 10),
+	}, rows[0][3], "the renamed tag is hashed")
+}
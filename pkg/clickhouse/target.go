@@ -0,0 +1,176 @@
+package clickhouse
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// schemaTarget is one destination table written on every flush. A run has a
+// single target unless schemaMode lists several schemas (fan-out), in which
+// case every sample is written to each target independently.
+//
+// Each target owns its failover buffer so that a failure on one table never
+// causes already-committed samples to be re-sent to another.
+type schemaTarget struct {
+	mode           string // Registered schema name (schemaMode entry)
+	table          string // Destination table in Config.Database
+	schema         SchemaCreator
+	converter      SampleConverter
+	insertQuery    string        // Pre-computed INSERT query
+	columns        []string      // Columns of insertQuery, in row order; nil if unknown
+	failoverBuffer *SampleBuffer // nil when buffering is disabled
+	conns          *connSlot     // connection reused by consecutive batches
+	wal            *walLog       // nil when WALDir is unset
+	shard          int           // Index of the shard written (see Config.ShardBy)
+	db             *sql.DB       // Handle of the shard; nil writes to the output's
+
+	// accept selects the samples written to this target; nil accepts all.
+	accept func(metrics.Sample) bool
+}
+
+// SchemaModes returns the schema names listed in SchemaMode, in order.
+// SchemaMode accepts a single name ("simple") or a comma-separated list
+// ("simple,compatible") to write every sample to several schemas at once.
+func (c Config) SchemaModes() []string {
+	return splitList(c.SchemaMode)
+}
+
+// targetTable returns the table written by the i-th schema mode. The first
+// mode writes to Table itself, so adding a second schema during a migration
+// leaves the existing table in place; additional modes write to Table_<mode>.
+func (c Config) targetTable(i int, mode string) string {
+	if i == 0 {
+		return c.Table
+	}
+	return c.Table + "_" + mode
+}
+
+// validateSchemaModes checks that every listed schema is registered, listed
+// once, and yields a valid table name.
+func (c Config) validateSchemaModes() error {
+	modes := c.SchemaModes()
+	if len(modes) == 0 {
+		return fmt.Errorf("invalid schemaMode: %q (available: %v)", c.SchemaMode, AvailableSchemas())
+	}
+
+	seen := make(map[string]bool, len(modes))
+	for i, mode := range modes {
+		if _, err := GetSchema(mode); err != nil && !c.definesSchema(mode) {
+			return fmt.Errorf("invalid schemaMode: %s (available: %v)", mode, AvailableSchemas())
+		}
+		if seen[mode] {
+			return fmt.Errorf("invalid schemaMode: %s is listed more than once", mode)
+		}
+		seen[mode] = true
+
+		// The first table is Table itself, which Validate checks
+		if table := c.targetTable(i, mode); i > 0 && !isValidIdentifier(table) {
+			return fmt.Errorf("invalid table name for schema %s: %s (must be alphanumeric + underscore, max 63 chars)", mode, table)
+		}
+	}
+	return nil
+}
+
+// definesSchema reports whether one of SchemaFiles defines the schema name,
+// which New registers.
+func (c Config) definesSchema(name string) bool {
+	return slices.ContainsFunc(c.schemaDefinitions, func(def SchemaDefinition) bool { return def.Name == name })
+}
+
+// validateRouting checks MetricRouting and the table names it derives.
+func (c Config) validateRouting() error {
+	switch c.MetricRouting {
+	case "", RoutingNone:
+		return nil
+	case RoutingSplit:
+		if len(c.SchemaModes()) > 1 {
+			return fmt.Errorf("metricRouting %q cannot be combined with multiple schemaModes (%s)", RoutingSplit, c.SchemaMode)
+		}
+		for _, suffix := range []string{splitBuiltinSuffix, splitCustomSuffix} {
+			if table := c.Table + suffix; !isValidIdentifier(table) {
+				return fmt.Errorf("invalid table name for metricRouting %s: %s (must be alphanumeric + underscore, max 63 chars)", RoutingSplit, table)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid metricRouting: %s (valid: %s, %s)", c.MetricRouting, RoutingNone, RoutingSplit)
+	}
+}
+
+// newTargets resolves the configured schema modes (or routing preset) into
+// flush targets, each applying filters before its own routing. The split
+// preset and the builtin column match by builtinMetrics (nil matches
+// builtin metrics by name).
+func (c Config) newTargets(filters []SampleFilter, builtinMetrics builtinMetricSet) ([]*schemaTarget, error) {
+	c.builtinMetrics = builtinMetrics
+	if c.MetricRouting == RoutingSplit {
+		builtin, err := c.newTarget("compatible", c.Table+splitBuiltinSuffix,
+			acceptFilter(filters, builtinMetrics.isBuiltinSample))
+		if err != nil {
+			return nil, err
+		}
+		custom, err := c.newTarget("simple", c.Table+splitCustomSuffix, acceptFilter(filters, builtinMetrics.isCustomSample))
+		if err != nil {
+			return nil, err
+		}
+		return c.shardTargets([]*schemaTarget{builtin, custom})
+	}
+
+	modes := c.SchemaModes()
+	targets := make([]*schemaTarget, 0, len(modes))
+	for i, mode := range modes {
+		t, err := c.newTarget(mode, c.targetTable(i, mode), acceptFilter(filters, nil))
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return c.shardTargets(targets)
+}
+
+// newTarget builds a single flush target for a registered schema. accept
+// selects the samples it writes; nil accepts all.
+func (c Config) newTarget(mode, table string, accept func(metrics.Sample) bool) (*schemaTarget, error) {
+	impl, err := GetSchema(mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema implementation: %w", err)
+	}
+	if impl.Configure != nil {
+		if impl, err = impl.Configure(c); err != nil {
+			return nil, fmt.Errorf("failed to configure schema %s: %w", mode, err)
+		}
+	}
+
+	t := &schemaTarget{
+		mode:      mode,
+		table:     table,
+		schema:    impl.Schema,
+		converter: impl.Converter,
+		accept:    accept,
+		conns:     c.newConnSlot(),
+	}
+	t.insertQuery = t.schema.InsertQuery(c.Database, table)
+	t.columns, _ = insertColumns(t.insertQuery) // rows are not checked without a column list
+	if namer, ok := impl.Converter.(ColumnNamer); ok {
+		names := namer.ColumnNames()
+		for _, col := range names {
+			if !isValidIdentifier(col) {
+				return nil, fmt.Errorf("invalid column name of schema %s: %q (must be alphanumeric + underscore, max 63 chars)",
+					mode, col)
+			}
+		}
+		// The query's own column list wins, as for a schema embedding a
+		// built-in one with its InsertQuery overridden
+		if t.columns == nil {
+			t.columns = names
+		}
+	}
+	if c.BufferEnabled {
+		t.failoverBuffer = NewSampleBuffer(c.BufferMaxSamples, DropPolicy(c.BufferDropPolicy))
+		t.failoverBuffer.SetMaxAge(c.BufferMaxAge)
+	}
+	return t, nil
+}
@@ -0,0 +1,155 @@
+package clickhouse
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+func TestConfig_SchemaModes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"simple", []string{"simple"}},
+		{"simple,compatible", []string{"simple", "compatible"}},
+		{" simple , compatible ,", []string{"simple", "compatible"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := Config{SchemaMode: tt.mode}
+			assert.Equal(t, tt.want, cfg.SchemaModes())
+		})
+	}
+}
+
+func TestConfig_ValidateSchemaModes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		mode          string
+		table         string
+		errorContains string
+	}{
+		{"single mode", "compatible", "samples", ""},
+		{"fan-out", "simple,compatible", "samples", ""},
+		{"unknown mode in list", "simple,nope", "samples", "invalid schemaMode: nope"},
+		{"duplicate mode", "simple,simple", "samples", "listed more than once"},
+		{"empty list", " , ", "samples", "invalid schemaMode"},
+		{
+			"derived table name too long", "simple,compatible",
+			"a123456789012345678901234567890123456789012345678901234567890", "invalid table name for schema compatible",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := NewConfig()
+			cfg.SchemaMode = tt.mode
+			cfg.Table = tt.table
+
+			err := cfg.Validate()
+			if tt.errorContains == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorContains)
+		})
+	}
+}
+
+func TestConfig_NewTargets(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.SchemaMode = "simple,compatible"
+
+	targets, err := cfg.newTargets(nil, nil)
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+
+	assert.Equal(t, "simple", targets[0].mode)
+	assert.Equal(t, "samples", targets[0].table, "first schema keeps the configured table")
+	assert.Contains(t, targets[0].insertQuery, "`k6`.`samples`")
+	assert.Equal(t, []string{"timestamp", "metric", "value", "tags"}, targets[0].columns, "from the converter")
+
+	assert.Equal(t, "compatible", targets[1].mode)
+	assert.Equal(t, "samples_compatible", targets[1].table)
+	assert.Contains(t, targets[1].insertQuery, "`k6`.`samples_compatible`")
+
+	assert.NotSame(t, targets[0].failoverBuffer, targets[1].failoverBuffer, "each target buffers independently")
+}
+
+// asyncInsertSchema embeds the compatible schema and overrides InsertQuery.
+type asyncInsertSchema struct {
+	CompatibleSchema
+}
+
+func (s asyncInsertSchema) InsertQuery(database, table string) string {
+	return s.CompatibleSchema.InsertQuery(database, table) + " SETTINGS async_insert = 1"
+}
+
+// narrowSchema embeds the compatible schema and inserts fewer columns.
+type narrowSchema struct {
+	CompatibleSchema
+}
+
+func (narrowSchema) InsertQuery(database, table string) string {
+	return buildInsertQuery(database, table, []string{"timestamp", "metric_name", "metric_value"})
+}
+
+func TestConfig_NewTargetEmbeddedSchema(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range []SchemaImplementation{
+		{Name: "test_async_insert", Schema: asyncInsertSchema{}, Converter: CompatibleSchemaImpl.Converter},
+		{Name: "test_narrow", Schema: narrowSchema{}, Converter: CompatibleSchemaImpl.Converter},
+	} {
+		RegisterSchema(impl)
+	}
+
+	cfg := NewConfig()
+	target, err := cfg.newTarget("test_async_insert", "samples", nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(target.insertQuery, "SETTINGS async_insert = 1"), "the overridden InsertQuery is used")
+	assert.Len(t, target.columns, compatibleColumnCount)
+
+	target, err = cfg.newTarget("test_narrow", "samples", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO `k6`.`samples` (timestamp, metric_name, metric_value) VALUES (?, ?, ?)", target.insertQuery)
+	assert.Equal(t, []string{"timestamp", "metric_name", "metric_value"}, target.columns,
+		"rows are checked against the query's columns, not the embedded converter's")
+}
+
+func TestOutput_FanOut(t *testing.T) {
+	t.Parallel()
+
+	fake, o := startFakeOutput(t, map[string]any{"schemaMode": "simple,compatible"})
+
+	ddl := fake.DDL()
+	require.Len(t, ddl, 3, "database once, then table DDL for each schema")
+	assert.Contains(t, ddl[1], "`k6`.`samples`")
+	assert.Contains(t, ddl[2], "`k6`.`samples_compatible`")
+
+	o.AddMetricSamples([]metrics.SampleContainer{makeSampleContainer(t)})
+	o.flush()
+
+	rows := fake.Rows()
+	require.Len(t, rows, 2, "one row per schema")
+	assert.Len(t, rows[0], 4, "simple schema row")
+	assert.Len(t, rows[1], 21, "compatible schema row")
+	assert.Equal(t, uint64(2), o.GetErrorMetrics().SamplesProcessed, "rows written, one per table for the sample")
+}
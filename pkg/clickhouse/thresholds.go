@@ -0,0 +1,155 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+var _ output.WithThresholds = (*Output)(nil)
+
+// thresholdExpression splits a threshold source such as "p(95)<500" into its
+// aggregation, operator, and value.
+var thresholdExpression = regexp.MustCompile(`^\s*([a-z]+(?:\(\s*[0-9.]+\s*\))?)\s*(<=|>=|===|==|!=|<|>)\s*(-?[0-9.]+(?:[eE][-+]?[0-9]+)?)\s*$`)
+
+// thresholdRow is one row of the thresholds table.
+type thresholdRow struct {
+	metric      string // metric name, with the submetric selector if any
+	source      string // threshold expression as written in the script
+	aggregation string // "" when source could not be split
+	operator    string
+	value       float64 // NaN when source could not be split
+	abortOnFail bool
+}
+
+// thresholdLog holds the rows for Config.ThresholdsTable until they are
+// written. The thresholds are known before the run starts, so the rows are
+// written once, at Start, or on the first flush that reaches the server.
+type thresholdLog struct {
+	createdAt time.Time
+	pending   pendingRows[thresholdRow]
+}
+
+// newThresholdLog returns nil when no thresholds table is configured.
+func newThresholdLog(table string, thresholds map[string]metrics.Thresholds, now time.Time) *thresholdLog {
+	if table == "" {
+		return nil
+	}
+	log := &thresholdLog{createdAt: now}
+	for _, metric := range slices.Sorted(maps.Keys(thresholds)) {
+		for _, t := range thresholds[metric].Thresholds {
+			if t == nil {
+				continue
+			}
+			log.pending.add(newThresholdRow(metric, t))
+		}
+	}
+	return log
+}
+
+// newThresholdRow splits the expression of t for the row of metric.
+func newThresholdRow(metric string, t *metrics.Threshold) thresholdRow {
+	row := thresholdRow{metric: metric, source: t.Source, value: math.NaN(), abortOnFail: t.AbortOnFail}
+	m := thresholdExpression.FindStringSubmatch(t.Source)
+	if m == nil {
+		return row
+	}
+	value, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return row
+	}
+	row.aggregation, row.operator, row.value = m[1], m[2], value
+	return row
+}
+
+// SetThresholds records the run's thresholds for Config.ThresholdsTable.
+// k6 calls it before Start, which writes them.
+func (o *Output) SetThresholds(thresholds map[string]metrics.Thresholds) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.thresholds = newThresholdLog(o.config.ThresholdsTable, thresholds, time.Now())
+}
+
+// createThresholdsTable creates the thresholds table.
+func createThresholdsTable(ctx context.Context, db *sql.DB, database, table string) error {
+	if !isValidIdentifier(database) {
+		return fmt.Errorf("invalid database name: %s (must be alphanumeric + underscore, max 63 chars)", database)
+	}
+	if !isValidIdentifier(table) {
+		return fmt.Errorf("invalid table name: %s (must be alphanumeric + underscore, max 63 chars)", table)
+	}
+
+	//nolint:gosec // G201: identifiers are validated with isValidIdentifier() and escaped with backticks
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s.%s (
+			created_at    DateTime64(%d, 'UTC'),
+			testid        LowCardinality(String),
+			instance      LowCardinality(String),
+			metric        LowCardinality(String),
+			threshold     String,
+			aggregation   LowCardinality(String),
+			operator      LowCardinality(String),
+			value         Float64,
+			abort_on_fail Bool
+		) ENGINE = MergeTree()
+		ORDER BY (testid, metric)
+	`, escapeIdentifier(database), escapeIdentifier(table), TimestampPrecision)
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create thresholds table: %w", err)
+	}
+	return nil
+}
+
+// writeThresholds inserts rows into the thresholds table in one batch.
+func writeThresholds(ctx context.Context, db *sql.DB, database, table, testID, instance string, createdAt time.Time, rows []thresholdRow) error {
+	if db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	batch, err := prepareInsert(ctx, db, nil, fmt.Sprintf(
+		"INSERT INTO %s.%s (created_at, testid, instance, metric, threshold, aggregation, operator, value, abort_on_fail) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		escapeIdentifier(database), escapeIdentifier(table)))
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		if err := batch.append(ctx, createdAt, testID, instance, r.metric, r.source,
+			r.aggregation, r.operator, r.value, r.abortOnFail); err != nil {
+			batch.abort()
+			return fmt.Errorf("failed to insert threshold row: %w", err)
+		}
+	}
+	if err := batch.send(); err != nil {
+		return fmt.Errorf("failed to send threshold rows: %w", err)
+	}
+	return nil
+}
+
+// flushThresholds writes the threshold rows not yet written. It takes db
+// rather than reading o.db because Start calls it with o.mu held. Failures
+// are logged and the rows retried on the next flush; they never fail the
+// samples.
+func (o *Output) flushThresholds(ctx context.Context, db *sql.DB, log *thresholdLog) {
+	if log == nil {
+		return
+	}
+	table := o.config.ThresholdsTable
+	flushPendingRows(o, &log.pending, table, "threshold", func(rows []thresholdRow) error {
+		return writeThresholds(o.config.insertContext(ctx), db, o.config.Database, table,
+			o.testID, o.config.InstanceName, log.createdAt, rows)
+	})
+}
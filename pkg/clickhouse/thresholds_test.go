@@ -0,0 +1,67 @@
+package clickhouse
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/lib"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestOutput_ThresholdsTable(t *testing.T) {
+	t.Parallel()
+
+	fake, o := newFakeOutput(t, output.Params{
+		JSONConfig: mustMarshalJSON(map[string]any{
+			"pushInterval":    "1h",
+			"thresholdsTable": "thresholds",
+			"instanceName":    "eu",
+		}),
+		ScriptOptions: lib.Options{RunTags: map[string]string{"testid": "nightly-7"}},
+	})
+
+	abort := metrics.NewThresholds([]string{"rate<0.01"})
+	abort.Thresholds[0].AbortOnFail = true
+	o.SetThresholds(map[string]metrics.Thresholds{
+		"http_req_duration{status:200}": metrics.NewThresholds([]string{"p(95) < 500", "avg<=200.5"}),
+		"http_req_failed":               abort,
+	})
+	require.NoError(t, o.Start())
+	defer func() { require.NoError(t, o.Stop()) }()
+
+	ddl := fake.DDL()
+	assert.Contains(t, ddl[len(ddl)-1], "CREATE TABLE IF NOT EXISTS `k6`.`thresholds`")
+
+	// Written at Start, before any flush
+	rows := fake.Rows()
+	require.Len(t, rows, 3)
+	createdAt := o.thresholds.createdAt
+	assert.Equal(t, []any{createdAt, "nightly-7", "eu", "http_req_duration{status:200}", "p(95) < 500", "p(95)", "<", 500.0, false}, rows[0])
+	assert.Equal(t, []any{createdAt, "nightly-7", "eu", "http_req_duration{status:200}", "avg<=200.5", "avg", "<=", 200.5, false}, rows[1])
+	assert.Equal(t, []any{createdAt, "nightly-7", "eu", "http_req_failed", "rate<0.01", "rate", "<", 0.01, true}, rows[2])
+
+	// Flushes do not write them again
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	n := 0
+	for _, row := range fake.Rows() {
+		if len(row) == 9 {
+			n++
+		}
+	}
+	assert.Equal(t, 3, n)
+}
+
+func TestNewThresholdRow_Unparsed(t *testing.T) {
+	t.Parallel()
+
+	row := newThresholdRow("checks", &metrics.Threshold{Source: "rate>bogus"})
+	assert.Equal(t, "rate>bogus", row.source)
+	assert.Empty(t, row.aggregation)
+	assert.True(t, math.IsNaN(row.value))
+	assert.Nil(t, newThresholdLog("", nil, time.Time{}))
+}
@@ -0,0 +1,43 @@
+package clickhouse
+
+import (
+	"strings"
+
+	"go.k6.io/k6/v2/metrics"
+)
+
+// traceIDColumn holds the trace ID of compatible rows with TraceIDColumn.
+const traceIDColumn = "trace_id"
+
+// traceIDLength is the length of a W3C trace ID in hex digits, the width of
+// the trace_id column.
+const traceIDLength = 32
+
+// extractTraceID fills the trace_id column from the trace_id metadata k6's
+// tracing instrumentation records, or else a tag of that name, which is
+// never kept in extra_tags. Values that are not 32 hex digits (such as the
+// all-zero invalid ID) are written as empty, lowercase hex otherwise.
+func extractTraceID(cs *compatibleSample, sample metrics.Sample) {
+	id, _ := getAndDelete(cs.ExtraTags, traceIDColumn)
+	if v, ok := sample.Metadata[traceIDColumn]; ok {
+		id = v
+	}
+	id = strings.ToLower(id)
+	if !validTraceID(id) {
+		id = ""
+	}
+	cs.TraceID = id
+}
+
+// validTraceID reports whether id is a valid lowercase W3C trace ID.
+func validTraceID(id string) bool {
+	if len(id) != traceIDLength || id == strings.Repeat("0", traceIDLength) {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
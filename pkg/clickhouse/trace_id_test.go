@@ -0,0 +1,80 @@
+package clickhouse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestCompatibleSchema_TraceIDColumn(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.TraceIDColumn = true
+	impl, err := configureCompatible(cfg)
+	require.NoError(t, err)
+
+	fake, db := newFakeDB(t)
+	require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	assert.Contains(t, fake.DDL()[1], "trace_id          FixedString(32) DEFAULT ''")
+	assert.Contains(t, impl.Schema.InsertQuery("k6", "samples"), "extra_tags, trace_id")
+	assert.Contains(t, impl.Schema.(CompatibleSchema).opts.identityColumns(), traceIDColumn)
+
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("http_req_duration", metrics.Trend)
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	for _, tt := range []struct {
+		tags      map[string]string
+		metadata  map[string]string
+		traceID   string
+		condition string
+	}{
+		{metadata: map[string]string{"trace_id": traceID}, traceID: traceID, condition: "metadata"},
+		{
+			metadata:  map[string]string{"trace_id": "4BF92F3577B34DA6A3CE929D0E0E4736"},
+			traceID:   traceID,
+			condition: "upper case",
+		},
+		{tags: map[string]string{"trace_id": traceID}, traceID: traceID, condition: "tag"},
+		{
+			tags:      map[string]string{"trace_id": "not-a-trace"},
+			metadata:  map[string]string{"trace_id": traceID},
+			traceID:   traceID,
+			condition: "metadata wins over the tag",
+		},
+		{metadata: map[string]string{"trace_id": "4bf92f35"}, condition: "too short"},
+		{metadata: map[string]string{"trace_id": "00000000000000000000000000000000"}, condition: "all zero"},
+		{metadata: map[string]string{"trace_id": "4bf92f3577b34da6a3ce929d0e0e473g"}, condition: "not hex"},
+		{condition: "no trace"},
+	} {
+		row, err := impl.Converter.Convert(context.Background(), metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet().WithTagsFromMap(tt.tags)},
+			Metadata:   tt.metadata,
+			Time:       time.Now(),
+			Value:      1,
+		})
+		require.NoError(t, err, tt.condition)
+		require.Len(t, row, compatibleColumnCount+1, tt.condition)
+		assert.Equal(t, tt.traceID, row[21], tt.condition)
+		assert.NotContains(t, row[20], traceIDColumn, "%s: never kept in extra_tags", tt.condition)
+		impl.Converter.Release(row)
+	}
+}
+
+func TestParseConfig_TraceIDColumn(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{ConfigArgument: "localhost:9000?traceIdColumn=true"})
+	require.NoError(t, err)
+	assert.True(t, cfg.TraceIDColumn)
+	assert.False(t, NewConfig().TraceIDColumn)
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?traceIdColumn=maybe"})
+	require.ErrorContains(t, err, "invalid traceIdColumn URL parameter value")
+}
@@ -0,0 +1,117 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the output's spans.
+const tracerName = "github.com/mkutlak/xk6-output-clickhouse"
+
+// Names of the output's spans.
+const (
+	spanStart        = "clickhouse.start"
+	spanCreateSchema = "clickhouse.create_schema"
+	spanFlush        = "clickhouse.flush"
+	spanInsert       = "clickhouse.insert"
+)
+
+// tracerShutdownTimeout bounds the export of the last spans at Stop.
+const tracerShutdownTimeout = 5 * time.Second
+
+// WithTracerProvider makes the output create its OpenTelemetry spans with tp,
+// e.g. the provider the embedding application already exports. It takes
+// precedence over TracesEndpoint; tp is not shut down by the output.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *Output) {
+		if tp != nil {
+			o.tracer = tp.Tracer(tracerName)
+			o.customTracer = true
+		}
+	}
+}
+
+// defaultTracer returns the tracer of the global provider, which records
+// nothing unless the embedding application installed one.
+func defaultTracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+// validateTracing checks TracesEndpoint.
+func (c Config) validateTracing() error {
+	if c.TracesEndpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(c.TracesEndpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid tracesEndpoint: must be an http or https URL of an OTLP/HTTP receiver")
+	}
+	return nil
+}
+
+// startTracing installs the OTLP exporter for TracesEndpoint, unless the
+// embedder supplied a provider. The exporter connects lazily, so an
+// unreachable collector never fails Start.
+func (o *Output) startTracing(ctx context.Context) error {
+	if o.customTracer || o.config.TracesEndpoint == "" {
+		return nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(o.config.TracesEndpoint))
+	if err != nil {
+		return fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	attrs := []attribute.KeyValue{attribute.String("service.name", "xk6-output-clickhouse")}
+	if o.config.InstanceName != "" {
+		attrs = append(attrs, attribute.String("service.instance.id", o.config.InstanceName))
+	}
+	o.tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attrs...)),
+	)
+	o.tracer = o.tracerProvider.Tracer(tracerName)
+	return nil
+}
+
+// stopTracing exports the remaining spans and shuts the output's own
+// provider down.
+func (o *Output) stopTracing() {
+	if o.tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+	defer cancel()
+	if err := o.tracerProvider.Shutdown(ctx); err != nil {
+		o.logger.WithError(err).Warn("Failed to export traces")
+	}
+	o.tracerProvider = nil
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// serverAttributes describe the ClickHouse server and database in every
+// span, following the OpenTelemetry database conventions.
+func (c Config) serverAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("db.system.name", "clickhouse"),
+		attribute.String("db.namespace", c.Database),
+		attribute.String("server.address", c.Addr),
+	}
+}
@@ -0,0 +1,76 @@
+package clickhouse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanAttr returns the value of a span attribute.
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestOutput_Tracing(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	fake, db := newFakeDB(t)
+	out, err := NewWithOptions(output.Params{
+		Logger:     newTestLogger(t),
+		JSONConfig: mustMarshalJSON(map[string]any{"pushInterval": "1h"}),
+	}, WithDB(db), WithTracerProvider(tp))
+	require.NoError(t, err)
+	o := out.(*Output)
+	require.NoError(t, o.Start())
+
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	require.Len(t, fake.Rows(), 2)
+	require.NoError(t, o.Stop())
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		if _, seen := spans[span.Name()]; !seen {
+			spans[span.Name()] = span
+		}
+	}
+	require.Contains(t, spans, spanStart)
+	require.Contains(t, spans, spanCreateSchema)
+	require.Contains(t, spans, spanFlush)
+	require.Contains(t, spans, spanInsert)
+
+	start, schema := spans[spanStart], spans[spanCreateSchema]
+	assert.Equal(t, start.SpanContext().SpanID(), schema.Parent().SpanID(), "schema creation is part of Start")
+	assert.Equal(t, "samples", spanAttr(schema, "db.collection.name").AsString())
+
+	flush, insert := spans[spanFlush], spans[spanInsert]
+	assert.Equal(t, int64(2), spanAttr(flush, "k6.samples").AsInt64())
+	assert.Equal(t, flush.SpanContext().SpanID(), insert.Parent().SpanID())
+	assert.Equal(t, int64(2), spanAttr(insert, "clickhouse.rows").AsInt64())
+	assert.NotEmpty(t, spanAttr(insert, "clickhouse.query_id").AsString(), "recorded inserts carry a query ID")
+	assert.Equal(t, "clickhouse", spanAttr(insert, "db.system.name").AsString())
+}
+
+func TestConfig_ValidateTracing(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.TracesEndpoint = "http://localhost:4318"
+	require.NoError(t, cfg.validateTracing())
+
+	cfg.TracesEndpoint = "localhost:4318"
+	assert.ErrorContains(t, cfg.validateTracing(), "invalid tracesEndpoint")
+}
@@ -0,0 +1,65 @@
+package clickhouse
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultTTLDays is how long the compatible schema keeps samples of metric
+// types without a Config.MetricTypeTTL entry.
+const defaultTTLDays = 365
+
+// metricTypeNames are the metric_type values of the compatible schema, in
+// enum order.
+var metricTypeNames = []string{"counter", "gauge", "rate", "trend"}
+
+// parseMetricTypeTTL parses a URL/env metricTypeTTL value such as
+// "trend=30,counter=730" into days by metric type.
+func parseMetricTypeTTL(s string) (map[string]int, error) {
+	ttl := make(map[string]int)
+	for _, item := range splitList(s) {
+		typ, days, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not type=days", item)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(days))
+		if err != nil {
+			return nil, fmt.Errorf("invalid days in %q: %w", item, err)
+		}
+		ttl[strings.TrimSpace(typ)] = n
+	}
+	return ttl, nil
+}
+
+// validateMetricTypeTTL checks the MetricTypeTTL entries.
+func (c Config) validateMetricTypeTTL() error {
+	for typ, days := range c.MetricTypeTTL {
+		if !slices.Contains(metricTypeNames, typ) {
+			return fmt.Errorf("invalid metricTypeTTL: unknown metric type %q (valid: %s)", typ, strings.Join(metricTypeNames, ", "))
+		}
+		if days <= 0 {
+			return fmt.Errorf("invalid metricTypeTTL: %s must be kept at least 1 day, got %d", typ, days)
+		}
+	}
+	return nil
+}
+
+// ttlDDL returns the TTL expression of the compatible schema: a single
+// 365-day rule, or with ttl set, one rule per metric type so that, e.g., raw
+// trend samples expire long before counters.
+func ttlDDL(ttl map[string]int) string {
+	if len(ttl) == 0 {
+		return fmt.Sprintf("toDateTime(timestamp) + INTERVAL %d DAY DELETE", defaultTTLDays)
+	}
+	rules := make([]string, 0, len(metricTypeNames))
+	for _, typ := range metricTypeNames {
+		days, ok := ttl[typ]
+		if !ok {
+			days = defaultTTLDays
+		}
+		rules = append(rules, fmt.Sprintf("toDateTime(timestamp) + INTERVAL %d DAY DELETE WHERE metric_type = '%s'", days, typ))
+	}
+	return strings.Join(rules, ",\n\t\t\t")
+}
@@ -0,0 +1,65 @@
+package clickhouse
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/output"
+)
+
+func TestParseConfig_MetricTypeTTL(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseConfig(output.Params{
+		ConfigArgument: "localhost:9000?metricTypeTTL=trend=30,%20counter=730",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"trend": 30, "counter": 730}, cfg.MetricTypeTTL)
+
+	cfg, err = ParseConfig(output.Params{
+		JSONConfig: mustMarshalJSON(map[string]any{"metricTypeTTL": map[string]int{"rate": 90}}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"rate": 90}, cfg.MetricTypeTTL)
+
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?metricTypeTTL=trend"})
+	assert.ErrorContains(t, err, "invalid metricTypeTTL URL parameter")
+	_, err = ParseConfig(output.Params{ConfigArgument: "localhost:9000?metricTypeTTL=trend=month"})
+	assert.ErrorContains(t, err, "invalid metricTypeTTL URL parameter")
+}
+
+func TestConfig_ValidateMetricTypeTTL(t *testing.T) {
+	t.Parallel()
+
+	cfg := NewConfig()
+	cfg.MetricTypeTTL = map[string]int{"trend": 30, "counter": 365}
+	require.NoError(t, cfg.Validate())
+
+	cfg.MetricTypeTTL = map[string]int{"histogram": 30}
+	assert.ErrorContains(t, cfg.Validate(), `unknown metric type "histogram"`)
+
+	cfg.MetricTypeTTL = map[string]int{"trend": 0}
+	assert.ErrorContains(t, cfg.Validate(), "at least 1 day")
+}
+
+func TestCompatibleSchema_MetricTypeTTL(t *testing.T) {
+	t.Parallel()
+
+	fake, db := newFakeDB(t)
+	require.NoError(t, CompatibleSchema{}.CreateSchema(context.Background(), db, "k6", "samples"))
+	assert.Contains(t, fake.DDL()[1], "TTL toDateTime(timestamp) + INTERVAL 365 DAY DELETE\n")
+
+	cfg := NewConfig()
+	cfg.MetricTypeTTL = map[string]int{"trend": 30, "counter": 730}
+	impl, err := configureCompatible(cfg)
+	require.NoError(t, err)
+	fake, db = newFakeDB(t)
+	require.NoError(t, impl.Schema.CreateSchema(context.Background(), db, "k6", "samples"))
+	ddl := fake.DDL()[1]
+	assert.Contains(t, ddl, "INTERVAL 730 DAY DELETE WHERE metric_type = 'counter',")
+	assert.Contains(t, ddl, "INTERVAL 365 DAY DELETE WHERE metric_type = 'gauge',")
+	assert.Contains(t, ddl, "INTERVAL 365 DAY DELETE WHERE metric_type = 'rate',")
+	assert.Contains(t, ddl, "INTERVAL 30 DAY DELETE WHERE metric_type = 'trend'\n")
+}
@@ -0,0 +1,311 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// walSegmentExt is the extension of WAL segments. Their content is in the
+// spill format, one record per line.
+const walSegmentExt = ".wal"
+
+// walSegmentID matches the <run>-<seq> part of a segment name.
+var walSegmentID = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+// walSegment is one batch in the write-ahead log. Its name, without the
+// extension, is the insert_deduplication_token the batch is sent with, so a
+// replayed segment the server already committed is deduplicated.
+type walSegment struct {
+	path  string
+	token string
+}
+
+// walLog is the write-ahead log of one target (see Config.WALDir). Every
+// batch is written to a segment before it is sent; the segment is removed
+// once the batch is committed. A segment whose samples went to the failover
+// buffer stays until they are written to a new segment by the flush that
+// retries them. Segments of ambiguous sends are kept until the next run, which
+// replays them with their original token.
+//
+// A nil *walLog is valid and logs nothing.
+type walLog struct {
+	dir      string
+	database string
+	table    string
+	run      int64 // Start time, keeps segment names unique across runs
+
+	mu        sync.Mutex
+	seq       uint64
+	buffered  []walSegment // samples held by the failover buffer
+	recovered []walSegment // left by a previous run, not yet replayed
+
+	registry *metrics.Registry // resolves the metrics of replayed segments
+}
+
+// walState is what becomes of a segment once its batch was handled.
+type walState int
+
+const (
+	walDelivered walState = iota // committed or disposed of: remove the segment
+	walBuffered                  // in the failover buffer: remove once re-logged
+	walPending                   // undelivered or ambiguous: replay at the next start
+)
+
+// newWALLog returns the WAL of database.table in dir, or nil when dir is
+// empty.
+func newWALLog(dir, database, table string) *walLog {
+	if dir == "" {
+		return nil
+	}
+	return &walLog{
+		dir:      dir,
+		database: database,
+		table:    table,
+		run:      time.Now().UnixNano(),
+		registry: metrics.NewRegistry(),
+	}
+}
+
+// prefix returns the name prefix of the log's segments.
+func (w *walLog) prefix() string {
+	return w.database + "." + w.table + "."
+}
+
+// recover queues the segments left in dir by earlier runs for replay and
+// returns their number.
+func (w *walLog) recover() (int, error) {
+	if w == nil {
+		return 0, nil
+	}
+	files, err := filepath.Glob(filepath.Join(w.dir, w.prefix()+"*"+walSegmentExt))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list WAL segments: %w", err)
+	}
+	var segments []walSegment
+	for _, path := range files {
+		name := strings.TrimSuffix(filepath.Base(path), walSegmentExt)
+		if walSegmentID.MatchString(strings.TrimPrefix(name, w.prefix())) {
+			segments = append(segments, walSegment{path: path, token: name})
+		}
+	}
+	slices.SortFunc(segments, func(a, b walSegment) int { return strings.Compare(a.path, b.path) })
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.recovered = segments
+	return len(segments), nil
+}
+
+// append writes the samples of a batch accepted by accept to a new segment.
+// The zero walSegment is returned when the batch holds no such samples.
+func (w *walLog) append(samples []metrics.SampleContainer, accept func(metrics.Sample) bool) (walSegment, error) {
+	if w == nil {
+		return walSegment{}, nil
+	}
+	if err := os.MkdirAll(w.dir, 0o750); err != nil {
+		return walSegment{}, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+
+	w.mu.Lock()
+	w.seq++
+	seq := w.seq
+	w.mu.Unlock()
+
+	// Fixed-width numbers make name order write order
+	token := fmt.Sprintf("%s%019d-%010d", w.prefix(), w.run, seq)
+	seg := walSegment{path: filepath.Join(w.dir, token+walSegmentExt), token: token}
+	n, err := writeSampleFile(seg.path, samples, accept)
+	if err != nil {
+		return walSegment{}, fmt.Errorf("failed to write WAL segment: %w", err)
+	}
+	if n == 0 {
+		_ = os.Remove(seg.path)
+		return walSegment{}, nil
+	}
+	return seg, nil
+}
+
+// settle records what became of seg's batch.
+func (w *walLog) settle(logger logrus.FieldLogger, seg walSegment, state walState) {
+	if w == nil || seg.path == "" {
+		return
+	}
+	switch state {
+	case walDelivered:
+		w.remove(logger, []walSegment{seg})
+	case walBuffered:
+		w.mu.Lock()
+		w.buffered = append(w.buffered, seg)
+		w.mu.Unlock()
+	case walPending:
+		// Stays on disk for the next run
+	}
+}
+
+// takeBuffered returns the segments of samples in the failover buffer and
+// forgets them. It is called before the buffer is popped: samples buffered
+// afterwards keep their segments.
+func (w *walLog) takeBuffered() []walSegment {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	segments := w.buffered
+	w.buffered = nil
+	return segments
+}
+
+// restoreBuffered gives back segments taken by takeBuffered whose samples
+// could not be logged again.
+func (w *walLog) restoreBuffered(segments []walSegment) {
+	if w == nil || len(segments) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buffered = append(segments, w.buffered...)
+}
+
+// nextRecovered returns the next segment to replay.
+func (w *walLog) nextRecovered() (walSegment, bool) {
+	if w == nil {
+		return walSegment{}, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.recovered) == 0 {
+		return walSegment{}, false
+	}
+	seg := w.recovered[0]
+	w.recovered = w.recovered[1:]
+	return seg, true
+}
+
+// remove deletes segments whose samples are no longer needed.
+func (w *walLog) remove(logger logrus.FieldLogger, segments []walSegment) {
+	for _, seg := range segments {
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			logger.WithError(err).WithField("walSegment", seg.path).Warn("Failed to remove WAL segment")
+		}
+	}
+}
+
+// dedupTokenKey is the context key of a batch's insert_deduplication_token.
+type dedupTokenKey struct{}
+
+// withDedupToken makes the insert prepared with ctx carry token (see
+// Config.insertContext).
+func withDedupToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, dedupTokenKey{}, token)
+}
+
+// dedupToken returns the insert_deduplication_token set on ctx, if any.
+func dedupToken(ctx context.Context) string {
+	token, _ := ctx.Value(dedupTokenKey{}).(string)
+	return token
+}
+
+// splitDedupToken derives the token of the i-th half of a batch split after a
+// too-large rejection. A replayed segment is split the same way, so its
+// halves get the same tokens as the first time.
+func splitDedupToken(ctx context.Context, i int) context.Context {
+	token := dedupToken(ctx)
+	if token == "" {
+		return ctx
+	}
+	return withDedupToken(ctx, fmt.Sprintf("%s-%d", token, i))
+}
+
+// logBatches writes every batch to a new segment of t's WAL. Once all are
+// written, the segments of earlier buffered samples, released by
+// takeBuffered, are redundant and removed; if a batch cannot be logged they
+// are kept, and the batch is sent without a segment.
+func (o *Output) logBatches(logger logrus.FieldLogger, t *schemaTarget, batches [][]metrics.SampleContainer, released []walSegment) []walSegment {
+	segments := make([]walSegment, len(batches))
+	if t.wal == nil {
+		return segments
+	}
+
+	complete := true
+	for i, batch := range batches {
+		seg, err := t.wal.append(batch, t.accept)
+		if err != nil {
+			complete = false
+			logger.WithError(err).Warn("Failed to write WAL segment, sending the batch without it")
+			continue
+		}
+		segments[i] = seg
+	}
+	if complete {
+		t.wal.remove(logger, released)
+	} else {
+		t.wal.restoreBuffered(released)
+	}
+	return segments
+}
+
+// walStateAfterFlush returns what becomes of a segment after flushBatch
+// returned err for its batch.
+func walStateAfterFlush(t *schemaTarget, err error) walState {
+	switch {
+	case err == nil:
+		return walDelivered
+	case isCommitError(err):
+		return walPending
+	case t.failoverBuffer != nil:
+		return walBuffered
+	case classifyError(err) == errClassData:
+		return walDelivered // dead-lettered; replaying it would fail again
+	default:
+		return walPending
+	}
+}
+
+// flushSegment flushes one batch with seg's dedup token and settles the
+// segment.
+func (o *Output) flushSegment(ctx context.Context, logger logrus.FieldLogger, t *schemaTarget, batch []metrics.SampleContainer, seg walSegment) error {
+	if seg.path == "" {
+		return o.flushBatch(ctx, logger, t, batch)
+	}
+	err := o.flushBatch(withDedupToken(ctx, seg.token), logger, t, batch)
+	t.wal.settle(logger, seg, walStateAfterFlush(t, err))
+	return err
+}
+
+// replayWAL sends the segments an earlier run left in t's WAL, each with its
+// original dedup token. It runs after the target's own batches went through,
+// so a server that is still down is not hit twice per flush; it stops at the
+// first failure, whose segment is then handled like any failed batch.
+func (o *Output) replayWAL(ctx context.Context, logger logrus.FieldLogger, t *schemaTarget) error {
+	for {
+		seg, ok := t.wal.nextRecovered()
+		if !ok {
+			return nil
+		}
+		samples, n, err := readSpillFile(seg.path, t.wal.registry)
+		if err != nil {
+			logger.WithError(err).WithField("walSegment", seg.path).Warn("Skipping unreadable WAL segment")
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"walSegment": seg.path,
+			"samples":    n,
+		}).Info("Replaying WAL segment")
+		if err := o.flushSegment(ctx, logger, t, samples, seg); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/v2/metrics"
+)
+
+// walSegmentsIn returns the WAL segments in dir.
+func walSegmentsIn(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+walSegmentExt))
+	require.NoError(t, err)
+	return files
+}
+
+// walConfig configures an output with a WAL in dir.
+func walConfig(dir string) map[string]any {
+	return map[string]any{
+		"pushInterval":  "1h",
+		"retryAttempts": 0,
+		"walDir":        dir,
+	}
+}
+
+func TestWAL_SegmentLifecycle(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	fake, o := startFakeOutput(t, walConfig(dir))
+
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	assert.Len(t, fake.Rows(), 2)
+	assert.Empty(t, walSegmentsIn(t, dir), "committed batches leave no segment")
+
+	// A failed batch keeps its segment while it is buffered
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	addStatusSamples(o, 3, 0)
+	o.flush()
+	assert.Len(t, walSegmentsIn(t, dir), 1)
+
+	fake.set(func(f *fakeDB) { f.prepareErr = nil })
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	assert.Len(t, fake.Rows(), 6)
+	assert.Empty(t, walSegmentsIn(t, dir), "the retried batch was logged again and committed")
+
+	require.NoError(t, o.Stop())
+}
+
+func TestWAL_AmbiguousSendIsReplayed(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	fake, o := startFakeOutput(t, walConfig(dir))
+
+	fake.set(func(f *fakeDB) { f.commitErr = errors.New("read: connection reset by peer") })
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	require.NoError(t, o.Stop())
+	segments := walSegmentsIn(t, dir)
+	require.Len(t, segments, 1, "an ambiguous send is kept for the next run")
+
+	// The next run replays it after its own first batch
+	fake, o = startFakeOutput(t, walConfig(dir))
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	assert.Len(t, fake.Rows(), 3)
+	assert.Empty(t, walSegmentsIn(t, dir))
+	require.NoError(t, o.Stop())
+}
+
+func TestWAL_UndrainedSamplesAreKept(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	fake, o := startFakeOutput(t, walConfig(dir))
+
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	addStatusSamples(o, 2, 0)
+	o.flush()
+	require.NoError(t, o.Stop())
+
+	assert.NotZero(t, o.GetErrorMetrics().DroppedSamples)
+	assert.Len(t, walSegmentsIn(t, dir), 1, "samples lost at shutdown stay in the WAL")
+}
+
+func TestWALLog_Recover(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	registry := metrics.NewRegistry()
+	metric := registry.MustNewMetric("checks", metrics.Rate)
+	samples := []metrics.SampleContainer{metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: metric, Tags: registry.RootTagSet()},
+		Time:       time.Now(),
+		Value:      1,
+	}}
+
+	previous := newWALLog(dir, "k6", "samples")
+	first, err := previous.append(samples, nil)
+	require.NoError(t, err)
+	second, err := previous.append(samples, nil)
+	require.NoError(t, err)
+	_, err = newWALLog(dir, "k6", "other").append(samples, nil)
+	require.NoError(t, err)
+
+	empty, err := previous.append(samples, func(metrics.Sample) bool { return false })
+	require.NoError(t, err)
+	assert.Equal(t, walSegment{}, empty, "no segment for a batch without routed samples")
+
+	w := newWALLog(dir, "k6", "samples")
+	n, err := w.recover()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "only this table's segments")
+
+	seg, ok := w.nextRecovered()
+	require.True(t, ok)
+	assert.Equal(t, first, seg, "oldest first, with the token it was sent with")
+	seg, ok = w.nextRecovered()
+	require.True(t, ok)
+	assert.Equal(t, second, seg)
+	_, ok = w.nextRecovered()
+	assert.False(t, ok)
+}
+
+func TestDedupToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	assert.Empty(t, dedupToken(ctx))
+	assert.Equal(t, ctx, splitDedupToken(ctx, 0), "no token, nothing to split")
+	assert.Equal(t, ctx, NewConfig().insertContext(ctx), "no token, context unchanged")
+
+	ctx = withDedupToken(ctx, "k6.samples.1-1")
+	assert.Equal(t, "k6.samples.1-1-1", dedupToken(splitDedupToken(ctx, 1)))
+	assert.NotEqual(t, ctx, NewConfig().insertContext(ctx), "the token is sent as a setting")
+}
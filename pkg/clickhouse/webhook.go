@@ -0,0 +1,222 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Values of a webhook notification's event field.
+const (
+	// webhookFlushFailing is sent when WebhookFailures flushes in a row failed.
+	webhookFlushFailing = "flush_failing"
+
+	// webhookSamplesDropped is sent once dropped samples reach
+	// WebhookDroppedSamples.
+	webhookSamplesDropped = "samples_dropped"
+
+	// webhookRecovered is sent by the first successful flush after
+	// webhookFlushFailing.
+	webhookRecovered = "recovered"
+)
+
+// webhookTimeout bounds a single notification request.
+const webhookTimeout = 10 * time.Second
+
+// validateWebhook checks the webhook URL and thresholds.
+func (c Config) validateWebhook() error {
+	if c.WebhookURL == "" {
+		return nil
+	}
+	u, err := url.Parse(c.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid webhookURL: must be an absolute http or https URL")
+	}
+	if c.WebhookFailures == 0 {
+		return errors.New("invalid webhookFailures: must be at least 1")
+	}
+	if c.WebhookDroppedSamples == 0 {
+		return errors.New("invalid webhookDroppedSamples: must be at least 1")
+	}
+	return nil
+}
+
+// webhookEvent is the JSON body posted to WebhookURL. Text repeats the event
+// as a sentence, which chat webhooks (Slack, Mattermost, ...) display as is.
+type webhookEvent struct {
+	Event               string    `json:"event"`
+	Text                string    `json:"text"`
+	Instance            string    `json:"instance,omitempty"`
+	Database            string    `json:"database"`
+	ConsecutiveFailures uint      `json:"consecutiveFailures"`
+	DroppedSamples      uint64    `json:"droppedSamples"`
+	Error               string    `json:"error,omitempty"`
+	Time                time.Time `json:"time"`
+}
+
+// webhookNotifier posts webhook events for persistent flush failures and
+// dropped samples. Each condition is reported once until it clears; requests
+// are sent in the background so a slow receiver never delays a flush.
+type webhookNotifier struct {
+	url              string
+	instance         string
+	database         string
+	failureThreshold uint
+	dropThreshold    uint64
+	client           *http.Client
+	logger           logrus.FieldLogger
+
+	mu          sync.Mutex
+	failures    uint // consecutive failed flushes
+	failing     bool // webhookFlushFailing sent, not yet recovered
+	dropsSent   bool
+	lastDropped uint64
+
+	pending sync.WaitGroup // requests in flight
+}
+
+// newWebhookNotifier returns nil when no webhook is configured.
+func (c Config) newWebhookNotifier(logger logrus.FieldLogger) *webhookNotifier {
+	if c.WebhookURL == "" {
+		return nil
+	}
+	host := c.WebhookURL
+	if u, err := url.Parse(c.WebhookURL); err == nil {
+		host = u.Host // the path and query often carry a token
+	}
+	return &webhookNotifier{
+		url:              c.WebhookURL,
+		instance:         c.InstanceName,
+		database:         c.Database,
+		failureThreshold: c.WebhookFailures,
+		dropThreshold:    uint64(c.WebhookDroppedSamples),
+		client:           &http.Client{Timeout: webhookTimeout},
+		logger:           logger.WithField("webhook", host),
+	}
+}
+
+// flushDone records the outcome of a flush cycle and the cumulative number of
+// dropped samples.
+func (n *webhookNotifier) flushDone(err error, dropped uint64) {
+	n.mu.Lock()
+	var events []webhookEvent
+	if err != nil {
+		n.failures++
+		if !n.failing && n.failures >= n.failureThreshold {
+			n.failing = true
+			events = append(events, n.event(webhookFlushFailing, err,
+				fmt.Sprintf("k6 ClickHouse output: %d flushes in a row failed, samples are being buffered", n.failures)))
+		}
+	} else {
+		if n.failing {
+			events = append(events, n.event(webhookRecovered, nil,
+				fmt.Sprintf("k6 ClickHouse output: flushes succeed again after %d failures", n.failures)))
+		}
+		n.failures = 0
+		n.failing = false
+	}
+	events = append(events, n.droppedEvents(dropped)...)
+	n.mu.Unlock()
+
+	for _, e := range events {
+		n.send(e)
+	}
+}
+
+// checkDropped reports drops that happened outside a flush cycle, such as
+// during the final drain.
+func (n *webhookNotifier) checkDropped(dropped uint64) {
+	n.mu.Lock()
+	events := n.droppedEvents(dropped)
+	n.mu.Unlock()
+
+	for _, e := range events {
+		n.send(e)
+	}
+}
+
+// droppedEvents returns the samples-dropped event when the threshold is
+// first reached. The caller holds n.mu.
+func (n *webhookNotifier) droppedEvents(dropped uint64) []webhookEvent {
+	n.lastDropped = dropped
+	if n.dropsSent || dropped < n.dropThreshold {
+		return nil
+	}
+	n.dropsSent = true
+	return []webhookEvent{n.event(webhookSamplesDropped, nil,
+		fmt.Sprintf("k6 ClickHouse output: %d samples dropped, results are incomplete", dropped))}
+}
+
+// event builds an event with the current counters. The caller holds n.mu.
+func (n *webhookNotifier) event(name string, err error, text string) webhookEvent {
+	e := webhookEvent{
+		Event:               name,
+		Text:                text,
+		Instance:            n.instance,
+		Database:            n.database,
+		ConsecutiveFailures: n.failures,
+		DroppedSamples:      n.lastDropped,
+		Time:                time.Now().UTC(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// send posts e in the background.
+func (n *webhookNotifier) send(e webhookEvent) {
+	n.pending.Go(func() {
+		if err := n.post(e); err != nil {
+			n.logger.WithError(err).WithField("event", e.Event).Warn("Failed to send webhook notification")
+			return
+		}
+		n.logger.WithField("event", e.Event).Info("Sent webhook notification")
+	})
+}
+
+// post sends one event and checks the response status.
+func (n *webhookNotifier) post(e webhookEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req) // #nosec G704 - the URL is operator config
+	if err != nil {
+		if urlErr, ok := errors.AsType[*url.Error](err); ok {
+			urlErr.URL = redactURL(urlErr.URL) // the error is logged
+		}
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// wait blocks until sent notifications complete, then releases idle
+// connections.
+func (n *webhookNotifier) wait() {
+	n.pending.Wait()
+	n.client.CloseIdleConnections()
+}
@@ -0,0 +1,137 @@
+package clickhouse
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookReceiver records the events posted to it.
+type webhookReceiver struct {
+	mu     sync.Mutex
+	events []webhookEvent
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var e webhookEvent
+	if err := json.NewDecoder(req.Body).Decode(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+}
+
+// names returns the received event names.
+func (r *webhookReceiver) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.events))
+	for _, e := range r.events {
+		names = append(names, e.Event)
+	}
+	return names
+}
+
+func TestOutput_Webhook(t *testing.T) {
+	t.Parallel()
+
+	receiver := &webhookReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	fake, o := startFakeOutput(t, map[string]any{
+		"pushInterval":     "1h",
+		"retryAttempts":    0,
+		"bufferMaxSamples": 1,
+		"webhookURL":       srv.URL + "/hooks/secret-token",
+		"webhookFailures":  2,
+		"instanceName":     "eu",
+	})
+
+	fake.set(func(f *fakeDB) { f.prepareErr = errors.New("dial tcp: connection refused") })
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	o.webhook.wait()
+	assert.Empty(t, receiver.names(), "a single failure is not persistent")
+
+	// The second failure reaches webhookFailures, and the buffer of one
+	// container overflows
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	o.webhook.wait()
+	assert.ElementsMatch(t, []string{webhookFlushFailing, webhookSamplesDropped}, receiver.names())
+
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	o.webhook.wait()
+	assert.Len(t, receiver.names(), 2, "conditions are reported once")
+
+	fake.set(func(f *fakeDB) { f.prepareErr = nil })
+	addStatusSamples(o, 1, 0)
+	o.flush()
+	require.NoError(t, o.Stop())
+
+	names := receiver.names()
+	require.Len(t, names, 3)
+	assert.Equal(t, webhookRecovered, names[2])
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	for _, e := range receiver.events {
+		assert.Equal(t, "eu", e.Instance)
+		assert.Equal(t, "k6", e.Database)
+		assert.NotEmpty(t, e.Text)
+		if e.Event == webhookFlushFailing {
+			assert.Equal(t, uint(2), e.ConsecutiveFailures)
+			assert.Contains(t, e.Error, "connection refused")
+		}
+	}
+}
+
+func TestConfig_ValidateWebhook(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr string
+	}{
+		{name: "disabled", mutate: func(*Config) {}},
+		{name: "valid", mutate: func(c *Config) { c.WebhookURL = "https://hooks.example.com/T0/B0" }},
+		{name: "relative URL", mutate: func(c *Config) { c.WebhookURL = "/hooks" }, wantErr: "invalid webhookURL"},
+		{name: "unsupported scheme", mutate: func(c *Config) { c.WebhookURL = "ftp://example.com" }, wantErr: "invalid webhookURL"},
+		{
+			name: "zero failures",
+			mutate: func(c *Config) {
+				c.WebhookURL = "https://example.com"
+				c.WebhookFailures = 0
+			},
+			wantErr: "invalid webhookFailures",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := NewConfig()
+			tt.mutate(&cfg)
+			err := cfg.validateWebhook()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}